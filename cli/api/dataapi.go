@@ -0,0 +1,784 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// RepairSummary describes the operations a replica would perform in a repair.
+type RepairSummary struct {
+	Addr                string   `json:"addr"`
+	ExtentsToBeCreated  []uint64 `json:"extentsToBeCreated"`
+	ExtentsToBeRepaired []uint64 `json:"extentsToBeRepaired"`
+	BytesToBeRepaired   uint64   `json:"bytesToBeRepaired"`
+}
+
+// FragmentationReport describes how the space of the extent store of a replica is used.
+type FragmentationReport struct {
+	TinyExtentCount   int     `json:"tinyExtentCount"`
+	TinyExtentBytes   uint64  `json:"tinyExtentBytes"`
+	TinyWastedBytes   uint64  `json:"tinyWastedBytes"`
+	NormalExtentCount int     `json:"normalExtentCount"`
+	NormalExtentBytes uint64  `json:"normalExtentBytes"`
+	AvgFillRatio      float64 `json:"avgFillRatio"`
+}
+
+// RepairStats records what the latest repair of a partition has done.
+type RepairStats struct {
+	ID                 uint64 `json:"id"`
+	JobID              string `json:"jobID"`
+	Repairing          bool   `json:"repairing"`
+	ExtentsCreated     uint64 `json:"extentsCreated"`
+	ExtentsRepaired    uint64 `json:"extentsRepaired"`
+	BytesTransferred   uint64 `json:"bytesTransferred"`
+	LastRepairDuration int64  `json:"lastRepairDurationMs"`
+	ReadRepairs        uint64 `json:"readRepairs"`
+	TinyRepairBatch    int    `json:"tinyRepairBatch"`
+	NoSourceExtents    int    `json:"noSourceExtents"`
+	Finished           bool   `json:"finished,omitempty"`
+}
+
+// PartitionSpace describes the space of a partition on a data node.
+type PartitionSpace struct {
+	ID        uint64 `json:"id"`
+	Size      uint64 `json:"size"`
+	Used      uint64 `json:"used"`
+	Available int64  `json:"available"`
+}
+
+// RaftProgress describes how far the state machine of a replica falls behind the raft log.
+type RaftProgress struct {
+	ID             uint64 `json:"id"`
+	AppliedID      uint64 `json:"appliedID"`
+	CommittedID    uint64 `json:"committedID"`
+	Lag            uint64 `json:"lag"`
+	LastTruncateID uint64 `json:"lastTruncateID"`
+	MinAppliedID   uint64 `json:"minAppliedID"`
+	MaxAppliedID   uint64 `json:"maxAppliedID"`
+}
+
+// RaftLeader describes the raft leader of a partition seen by a replica.
+type RaftLeader struct {
+	ID         uint64 `json:"id"`
+	LeaderID   uint64 `json:"leaderID"`
+	LeaderAddr string `json:"leaderAddr"`
+	Term       uint64 `json:"term"`
+	IsLeader   bool   `json:"isLeader"`
+}
+
+// DataPartitionMetadata is the metadata persisted in the META file of a replica, with the peers sorted by the id.
+type DataPartitionMetadata struct {
+	VolumeID                string
+	PartitionID             uint64
+	PartitionSize           int
+	CreateTime              string
+	Peers                   []proto.Peer
+	Hosts                   []string
+	DataPartitionCreateType int
+	LastTruncateID          uint64
+	ManualReadOnly          bool
+	LogicalSize             int
+	RestartCount            uint64
+}
+
+// SizeMismatchedExtent describes an extent whose sizes differ between two replicas.
+type SizeMismatchedExtent struct {
+	ExtentID  uint64 `json:"extentID"`
+	LocalSize uint32 `json:"localSize"`
+	PeerSize  uint32 `json:"peerSize"`
+}
+
+// SnapshotDiff describes the difference between the snapshots of two replicas.
+type SnapshotDiff struct {
+	PeerAddr       string                  `json:"peerAddr"`
+	MissingLocally []uint64                `json:"missingLocally"`
+	ExtraLocally   []uint64                `json:"extraLocally"`
+	SizeMismatched []*SizeMismatchedExtent `json:"sizeMismatched"`
+}
+
+// DiskSummary aggregates the partitions on a disk of a data node.
+type DiskSummary struct {
+	Path                string `json:"path"`
+	Status              int    `json:"status"`
+	Total               uint64 `json:"total"`
+	Available           uint64 `json:"available"`
+	PartitionCount      int    `json:"partitionCount"`
+	ReadOnlyCount       int    `json:"readOnlyCount"`
+	UnavailableCount    int    `json:"unavailableCount"`
+	PartitionsAllocated uint64 `json:"partitionsAllocated"`
+	PartitionsUsed      uint64 `json:"partitionsUsed"`
+}
+
+// PartitionRepairStatus describes whether a partition on a data node needs repair.
+type PartitionRepairStatus struct {
+	ID                      uint64 `json:"id"`
+	VolName                 string `json:"volName"`
+	IsLeader                bool   `json:"isLeader"`
+	Repairing               bool   `json:"repairing"`
+	BrokenTinyExtents       int    `json:"brokenTinyExtents"`
+	MismatchedNormalExtents int    `json:"mismatchedNormalExtents"`
+	MismatchedTinyExtents   int    `json:"mismatchedTinyExtents"`
+	PendingExtents          int    `json:"pendingExtents"`
+	QueuedExtents           int64  `json:"queuedExtents"`
+	LastCheckTime           int64  `json:"lastCheckTime"`
+}
+
+// FlushResult describes the flush of the metadata and the applied ids of the partitions on a data node.
+type FlushResult struct {
+	Flushed  int               `json:"flushed"`
+	Failed   map[uint64]string `json:"failed"`
+	Duration int64             `json:"durationMs"`
+}
+
+// LeaderTransfer describes the transfer of the leadership of a partition on a data node to a follower.
+type LeaderTransfer struct {
+	PartitionID uint64 `json:"partitionID"`
+	TargetID    uint64 `json:"targetID"`
+	TargetAddr  string `json:"targetAddr"`
+	Transferred bool   `json:"transferred"`
+	Err         string `json:"err"`
+	Duration    int64  `json:"durationMs"`
+}
+
+// LeaderTransferResult describes the transfers of the leaderships of the partitions led by a data node.
+type LeaderTransferResult struct {
+	Transferred int               `json:"transferred"`
+	Failed      int               `json:"failed"`
+	Transfers   []*LeaderTransfer `json:"transfers"`
+	Duration    int64             `json:"durationMs"`
+}
+
+// PartitionFreezeState describes whether a partition on a data node is frozen for an investigation.
+type PartitionFreezeState struct {
+	ID     uint64 `json:"id"`
+	Frozen bool   `json:"frozen"`
+	Reason string `json:"reason"`
+	Status int    `json:"status"`
+}
+
+// PartitionMoveResult describes a partition moved to another disk of a data node.
+type PartitionMoveResult struct {
+	PartitionID uint64 `json:"partitionID"`
+	SourcePath  string `json:"sourcePath"`
+	TargetPath  string `json:"targetPath"`
+	Files       int    `json:"files"`
+	Bytes       int64  `json:"bytes"`
+	Cost        int64  `json:"cost"`
+}
+
+// PartitionReadOnlyState describes whether a partition on a data node is set read-only by the operator,
+// with who and when changed it last.
+type PartitionReadOnlyState struct {
+	ID             uint64 `json:"id"`
+	ManualReadOnly bool   `json:"manualReadOnly"`
+	SetBy          string `json:"setBy"`
+	SetTime        string `json:"setTime"`
+	Status         int    `json:"status"`
+}
+
+// PartitionGrowth describes how fast a partition on a data node grows, and when it will be full.
+type PartitionGrowth struct {
+	ID         uint64  `json:"id"`
+	VolName    string  `json:"volName"`
+	Used       int     `json:"used"`
+	Size       int     `json:"size"`
+	Rate       float64 `json:"rate"`
+	TimeToFull int64   `json:"timeToFull"`
+}
+
+// PartitionUptime describes how long a partition has been served by a data node, and its restart count.
+type PartitionUptime struct {
+	ID           uint64 `json:"id"`
+	CreateTime   string `json:"createTime"`
+	LoadTime     int64  `json:"loadTime"`
+	Uptime       int64  `json:"uptime"`
+	RestartCount uint64 `json:"restartCount"`
+}
+
+// ActiveRepair describes the repair of an extent being run on a data node.
+type ActiveRepair struct {
+	ID               uint64 `json:"id"`
+	ExtentID         uint64 `json:"extentID"`
+	Source           string `json:"source"`
+	Size             uint64 `json:"size"`
+	BytesTransferred uint64 `json:"bytesTransferred"`
+	StartTime        int64  `json:"startTime"`
+}
+
+// ExtentSize is the size an extent takes on the disk of a data node.
+type ExtentSize struct {
+	ExtentID uint64 `json:"extentID"`
+	IsTiny   bool   `json:"isTiny"`
+	Size     int64  `json:"size"`
+}
+
+// TopExtents lists the largest extents of a replica, with the count and the size of all its extents.
+type TopExtents struct {
+	ExtentCount int           `json:"extentCount"`
+	TotalSize   int64         `json:"totalSize"`
+	Extents     []*ExtentSize `json:"extents"`
+}
+
+// ColdExtent is a normal extent of a replica not read by the clients within the window.
+type ColdExtent struct {
+	ExtentID   uint64 `json:"extentID"`
+	Size       uint64 `json:"size"`
+	CreateTime int64  `json:"createTime"`
+	LastAccess int64  `json:"lastAccess"`
+}
+
+// ColdExtents lists the normal extents of a replica not read within the window, the least recently read first.
+type ColdExtents struct {
+	OlderThan     int64         `json:"olderThan"`
+	TrackingSince int64         `json:"trackingSince"`
+	Extents       []*ColdExtent `json:"extents"`
+}
+
+// ExtentOwner is the inode an extent of a replica is created for, 0 if unknown or a tiny extent.
+type ExtentOwner struct {
+	ExtentID uint64 `json:"extentID"`
+	Exists   bool   `json:"exists"`
+	IsTiny   bool   `json:"isTiny"`
+	Inode    uint64 `json:"inode"`
+	Size     uint64 `json:"size"`
+}
+
+// ExtentOwners maps the extents of a replica back to the volume and the inodes they belong to.
+type ExtentOwners struct {
+	PartitionID uint64         `json:"partitionID"`
+	VolName     string         `json:"volName"`
+	Extents     []*ExtentOwner `json:"extents"`
+}
+
+// PartitionExtent is an extent of a replica, the crc is 0 if not computed yet.
+type PartitionExtent struct {
+	FileID     uint64 `json:"fileId"`
+	Size       uint64 `json:"size"`
+	Crc        uint32 `json:"Crc"`
+	ModifyTime int64  `json:"modTime"`
+}
+
+// RaftState is the raft state of a replica cross-checked by the data node, with the problems found.
+type RaftState struct {
+	ID                 uint64   `json:"id"`
+	PersistedAppliedID uint64   `json:"persistedAppliedID"`
+	AppliedID          uint64   `json:"appliedID"`
+	RaftAppliedID      uint64   `json:"raftAppliedID"`
+	CommittedID        uint64   `json:"committedID"`
+	LastIndex          uint64   `json:"lastIndex"`
+	LastTruncateID     uint64   `json:"lastTruncateID"`
+	Verdict            string   `json:"verdict"`
+	Problems           []string `json:"problems"`
+}
+
+// DataHttpClient talks to the HTTP API of a data node.
+type DataHttpClient struct {
+	useSSL bool
+	host   string
+}
+
+// NewDataHttpClient returns a new DataHttpClient instance.
+func NewDataHttpClient(host string, useSSL bool) *DataHttpClient {
+	return &DataHttpClient{host: host, useSSL: useSSL}
+}
+
+func (dc *DataHttpClient) serveRequest(r *request) (respData []byte, err error) {
+	var resp *http.Response
+	var schema string
+	if dc.useSSL {
+		schema = "https"
+	} else {
+		schema = "http"
+	}
+	params := url.Values{}
+	for k, v := range r.params {
+		params.Set(k, v)
+	}
+	var reqURL = fmt.Sprintf("%s://%s%s", schema, dc.host, r.path)
+	if len(params) > 0 {
+		reqURL = reqURL + "?" + params.Encode()
+	}
+	client := http.DefaultClient
+	client.Timeout = requestTimeout
+	var req *http.Request
+	if req, err = http.NewRequest(r.method, reqURL, bytes.NewReader(r.body)); err != nil {
+		return
+	}
+	req.Header.Set("Connection", "close")
+	for k, v := range r.header {
+		req.Header.Set(k, v)
+	}
+	if resp, err = client.Do(req); err != nil {
+		log.LogErrorf("serveRequest: send http request fail: method(%v) url(%v) err(%v)", r.method, reqURL, err)
+		return
+	}
+	respData, err = ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		log.LogErrorf("serveRequest: read http response body fail: err(%v)", err)
+		return
+	}
+	// the data node replies the same body for both of the success and the failure
+	var body = &struct {
+		Code int32           `json:"code"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err = json.Unmarshal(respData, body); err != nil {
+		return nil, fmt.Errorf("unmarshal response body err:%v", err)
+	}
+	if body.Code != http.StatusOK {
+		return nil, fmt.Errorf("request %v failed: code(%v) msg(%v)", r.path, body.Code, body.Msg)
+	}
+	return []byte(body.Data), nil
+}
+
+// GetRepairPlan asks the repair leader of the partition to plan a repair in dry-run mode.
+func (dc *DataHttpClient) GetRepairPlan(partitionID uint64, extentType string) (summaries []*RepairSummary, err error) {
+	request := newAPIRequest(http.MethodGet, "/repairPlan")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	request.addParam("extentType", extentType)
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	summaries = make([]*RepairSummary, 0)
+	if err = json.Unmarshal(respData, &summaries); err != nil {
+		return
+	}
+	return
+}
+
+// GetFragmentationReport returns the fragmentation report of the partition on the data node.
+func (dc *DataHttpClient) GetFragmentationReport(partitionID uint64) (report *FragmentationReport, err error) {
+	request := newAPIRequest(http.MethodGet, "/fragmentation")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	report = &FragmentationReport{}
+	if err = json.Unmarshal(respData, report); err != nil {
+		return
+	}
+	return
+}
+
+// LaunchRepair asks the repair leader of the partition to launch a repair immediately.
+func (dc *DataHttpClient) LaunchRepair(partitionID uint64, extentType string) (stats *RepairStats, err error) {
+	request := newAPIRequest(http.MethodGet, "/repair")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	request.addParam("extentType", extentType)
+	return dc.requestRepairStats(request)
+}
+
+// GetRepairStats returns the statistics of the latest repair of the partition.
+func (dc *DataHttpClient) GetRepairStats(partitionID uint64) (stats *RepairStats, err error) {
+	request := newAPIRequest(http.MethodGet, "/repairStats")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	return dc.requestRepairStats(request)
+}
+
+func (dc *DataHttpClient) requestRepairStats(request *request) (stats *RepairStats, err error) {
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	stats = &RepairStats{}
+	if err = json.Unmarshal(respData, stats); err != nil {
+		return
+	}
+	return
+}
+
+// GetPartitionSpace returns the space of the partition, the used space is recomputed at once if force is set.
+func (dc *DataHttpClient) GetPartitionSpace(partitionID uint64, force bool) (space *PartitionSpace, err error) {
+	request := newAPIRequest(http.MethodGet, "/partitionSpace")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	request.addParam("force", strconv.FormatBool(force))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	space = &PartitionSpace{}
+	if err = json.Unmarshal(respData, space); err != nil {
+		return
+	}
+	return
+}
+
+// GetRaftProgress returns the raft progress of the partition on the data node.
+func (dc *DataHttpClient) GetRaftProgress(partitionID uint64) (progress *RaftProgress, err error) {
+	request := newAPIRequest(http.MethodGet, "/raftProgress")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	progress = &RaftProgress{}
+	if err = json.Unmarshal(respData, progress); err != nil {
+		return
+	}
+	return
+}
+
+// GetRaftLeader returns the raft leader and the term of the partition seen by the data node.
+func (dc *DataHttpClient) GetRaftLeader(partitionID uint64) (leader *RaftLeader, err error) {
+	request := newAPIRequest(http.MethodGet, "/raftLeader")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	leader = &RaftLeader{}
+	if err = json.Unmarshal(respData, leader); err != nil {
+		return
+	}
+	return
+}
+
+// GetPartitionMetadata returns the metadata persisted by the data node for the partition.
+func (dc *DataHttpClient) GetPartitionMetadata(partitionID uint64) (meta *DataPartitionMetadata, err error) {
+	request := newAPIRequest(http.MethodGet, "/partitionMetadata")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	meta = &DataPartitionMetadata{}
+	if err = json.Unmarshal(respData, meta); err != nil {
+		return
+	}
+	return
+}
+
+// RebuildMetadata rebuilds the lost metadata of the partition under the directory on the data node from the
+// volume and the peers, and loads the partition with it. A valid metadata is only overwritten with force.
+func (dc *DataHttpClient) RebuildMetadata(dir, volume string, peers []proto.Peer, hosts []string, force bool) (meta *DataPartitionMetadata, err error) {
+	peerStrs := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		peerStrs = append(peerStrs, fmt.Sprintf("%v:%v", peer.ID, peer.Addr))
+	}
+	request := newAPIRequest(http.MethodGet, "/rebuildMetadata")
+	request.addParam("dir", dir)
+	request.addParam("volume", volume)
+	request.addParam("peers", strings.Join(peerStrs, ","))
+	request.addParam("hosts", strings.Join(hosts, ","))
+	request.addParam("force", strconv.FormatBool(force))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	meta = &DataPartitionMetadata{}
+	if err = json.Unmarshal(respData, meta); err != nil {
+		return
+	}
+	return
+}
+
+// GetSnapshot returns the snapshot of the extents of the partition cached by the data node.
+func (dc *DataHttpClient) GetSnapshot(partitionID uint64) (files []*proto.File, err error) {
+	request := newAPIRequest(http.MethodGet, "/snapshot")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	files = make([]*proto.File, 0)
+	if err = json.Unmarshal(respData, &files); err != nil {
+		return
+	}
+	return
+}
+
+// DiffSnapshot compares the snapshot of the partition on the data node with the one on the peer.
+func (dc *DataHttpClient) DiffSnapshot(partitionID uint64, peerAddr string) (diff *SnapshotDiff, err error) {
+	request := newAPIRequest(http.MethodGet, "/diffSnapshot")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	request.addParam("peer", peerAddr)
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	diff = &SnapshotDiff{}
+	if err = json.Unmarshal(respData, diff); err != nil {
+		return
+	}
+	return
+}
+
+// GetDiskStatus returns the summary of the partitions on the disk of the data node.
+func (dc *DataHttpClient) GetDiskStatus(diskPath string) (summary *DiskSummary, err error) {
+	request := newAPIRequest(http.MethodGet, "/diskStatus")
+	request.addParam("path", diskPath)
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	summary = &DiskSummary{}
+	if err = json.Unmarshal(respData, summary); err != nil {
+		return
+	}
+	return
+}
+
+// GetRepairingPartitions returns the partitions on the data node which need repair.
+func (dc *DataHttpClient) GetRepairingPartitions() (statuses []*PartitionRepairStatus, err error) {
+	request := newAPIRequest(http.MethodGet, "/repairingPartitions")
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	statuses = make([]*PartitionRepairStatus, 0)
+	if err = json.Unmarshal(respData, &statuses); err != nil {
+		return
+	}
+	return
+}
+
+// GetPartitionsGrowth returns the growth of all the partitions on the data node, the ones to be full first come first.
+func (dc *DataHttpClient) GetPartitionsGrowth() (growths []*PartitionGrowth, err error) {
+	request := newAPIRequest(http.MethodGet, "/partitionsGrowth")
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	growths = make([]*PartitionGrowth, 0)
+	if err = json.Unmarshal(respData, &growths); err != nil {
+		return
+	}
+	return
+}
+
+// FlushPartitions persists the metadata and the applied ids of all the partitions on the data node.
+func (dc *DataHttpClient) FlushPartitions() (result *FlushResult, err error) {
+	request := newAPIRequest(http.MethodGet, "/flushPartitions")
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	result = &FlushResult{}
+	if err = json.Unmarshal(respData, result); err != nil {
+		return
+	}
+	return
+}
+
+// TransferLeaderships transfers the leaderships of all the partitions led by the data node to their best followers.
+func (dc *DataHttpClient) TransferLeaderships() (result *LeaderTransferResult, err error) {
+	request := newAPIRequest(http.MethodGet, "/transferLeadership")
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	result = &LeaderTransferResult{}
+	if err = json.Unmarshal(respData, result); err != nil {
+		return
+	}
+	return
+}
+
+// FreezePartition freezes or unfreezes the partition on the data node, the reason is kept with the frozen state.
+func (dc *DataHttpClient) FreezePartition(partitionID uint64, freeze bool, reason string) (state *PartitionFreezeState, err error) {
+	request := newAPIRequest(http.MethodGet, "/freezePartition")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	request.addParam("freeze", strconv.FormatBool(freeze))
+	if freeze {
+		request.addParam("reason", reason)
+	}
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	state = &PartitionFreezeState{}
+	if err = json.Unmarshal(respData, state); err != nil {
+		return
+	}
+	return
+}
+
+// MovePartitionToDisk moves the partition to the disk of the given path on the same data node.
+func (dc *DataHttpClient) MovePartitionToDisk(partitionID uint64, diskPath string) (result *PartitionMoveResult, err error) {
+	request := newAPIRequest(http.MethodGet, "/movePartition")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	request.addParam("disk", diskPath)
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	result = &PartitionMoveResult{}
+	if err = json.Unmarshal(respData, result); err != nil {
+		return
+	}
+	return
+}
+
+// GetManualReadOnly returns whether the partition on the data node is set read-only by the operator.
+func (dc *DataHttpClient) GetManualReadOnly(partitionID uint64) (state *PartitionReadOnlyState, err error) {
+	request := newAPIRequest(http.MethodGet, "/manualReadOnly")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	return dc.serveManualReadOnly(request)
+}
+
+// SetManualReadOnly sets the partition on the data node read-only or back on behalf of the operator.
+func (dc *DataHttpClient) SetManualReadOnly(partitionID uint64, readOnly bool, operator string) (state *PartitionReadOnlyState, err error) {
+	request := newAPIRequest(http.MethodGet, "/manualReadOnly")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	request.addParam("readOnly", strconv.FormatBool(readOnly))
+	request.addParam("operator", operator)
+	return dc.serveManualReadOnly(request)
+}
+
+func (dc *DataHttpClient) serveManualReadOnly(request *request) (state *PartitionReadOnlyState, err error) {
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	state = &PartitionReadOnlyState{}
+	if err = json.Unmarshal(respData, state); err != nil {
+		return
+	}
+	return
+}
+
+// GetPartitionUptime returns how long the partition has been served by the data node, and its restart count.
+func (dc *DataHttpClient) GetPartitionUptime(partitionID uint64) (uptime *PartitionUptime, err error) {
+	request := newAPIRequest(http.MethodGet, "/partitionUptime")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	uptime = &PartitionUptime{}
+	if err = json.Unmarshal(respData, uptime); err != nil {
+		return
+	}
+	return
+}
+
+// GetActiveRepairs returns the repairs of the extents being run on the partition. The repairs of the extent
+// are canceled at first if cancelExtentID is not 0.
+func (dc *DataHttpClient) GetActiveRepairs(partitionID, cancelExtentID uint64) (repairs []*ActiveRepair, err error) {
+	request := newAPIRequest(http.MethodGet, "/activeRepairs")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	if cancelExtentID != 0 {
+		request.addParam("cancel", fmt.Sprintf("%v", cancelExtentID))
+	}
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	repairs = make([]*ActiveRepair, 0)
+	if err = json.Unmarshal(respData, &repairs); err != nil {
+		return
+	}
+	return
+}
+
+// GetTopExtents returns the limit largest extents of the partition by the size on the disk.
+func (dc *DataHttpClient) GetTopExtents(partitionID uint64, limit int) (top *TopExtents, err error) {
+	request := newAPIRequest(http.MethodGet, "/topExtents")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	request.addParam("limit", fmt.Sprintf("%v", limit))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	top = &TopExtents{}
+	if err = json.Unmarshal(respData, top); err != nil {
+		return
+	}
+	return
+}
+
+// GetColdExtents returns the normal extents of the partition not read by the clients within olderThan.
+func (dc *DataHttpClient) GetColdExtents(partitionID uint64, olderThan time.Duration) (cold *ColdExtents, err error) {
+	request := newAPIRequest(http.MethodGet, "/coldExtents")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	request.addParam("olderThan", fmt.Sprintf("%v", int64(olderThan/time.Second)))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	cold = &ColdExtents{}
+	if err = json.Unmarshal(respData, cold); err != nil {
+		return
+	}
+	return
+}
+
+// GetPartitionExtents returns the extents of the partition on the data node, read from its extent store.
+func (dc *DataHttpClient) GetPartitionExtents(partitionID uint64) (extents []*PartitionExtent, err error) {
+	request := newAPIRequest(http.MethodGet, "/partition")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	result := &struct {
+		Extents []*PartitionExtent `json:"extents"`
+	}{}
+	if err = json.Unmarshal(respData, result); err != nil {
+		return
+	}
+	return result.Extents, nil
+}
+
+// GetExtentOwners returns the volume of the partition and the inodes the extents are created for.
+func (dc *DataHttpClient) GetExtentOwners(partitionID uint64, extentIDs []uint64) (owners *ExtentOwners, err error) {
+	ids := make([]string, 0, len(extentIDs))
+	for _, extentID := range extentIDs {
+		ids = append(ids, strconv.FormatUint(extentID, 10))
+	}
+	request := newAPIRequest(http.MethodGet, "/extentOwners")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	request.addParam("extents", strings.Join(ids, ","))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	owners = &ExtentOwners{}
+	if err = json.Unmarshal(respData, owners); err != nil {
+		return
+	}
+	return
+}
+
+// VerifyRaftState cross-checks the applied ids of the partition against the raft log on the data node.
+func (dc *DataHttpClient) VerifyRaftState(partitionID uint64) (state *RaftState, err error) {
+	request := newAPIRequest(http.MethodGet, "/verifyRaft")
+	request.addParam("id", fmt.Sprintf("%v", partitionID))
+	var respData []byte
+	if respData, err = dc.serveRequest(request); err != nil {
+		return
+	}
+	state = &RaftState{}
+	if err = json.Unmarshal(respData, state); err != nil {
+		return
+	}
+	return
+}
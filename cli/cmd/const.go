@@ -33,6 +33,31 @@ const (
 	CliOpReset             = "reset"
 	CliOpReplicate         = "add-replica"
 	CliOpDelReplica        = "del-replica"
+	CliOpRepairPlan        = "repair-plan"
+	CliOpFragmentation     = "fragmentation"
+	CliOpRepair            = "repair"
+	CliOpRepairStats       = "repair-stats"
+	CliOpSpaceReport       = "space-report"
+	CliOpRaftProgress      = "raft-progress"
+	CliOpMigrateReplica    = "migrate-replica"
+	CliOpDiff              = "diff"
+	CliOpLeader            = "leader"
+	CliOpMetaDiff          = "meta-diff"
+	CliOpSnapshot          = "snapshot"
+	CliOpRepairStatus      = "repair-status"
+	CliOpFlush             = "flush"
+	CliOpTimeToFull        = "time-to-full"
+	CliOpActiveRepairs     = "active-repairs"
+	CliOpTopExtents        = "top-extents"
+	CliOpVerifyRaft        = "verify-raft"
+	CliOpSetReadOnly       = "set-readonly"
+	CliOpColdExtents       = "cold-extents"
+	CliOpRebuildMeta       = "rebuild-meta"
+	CliOpMoveDisk          = "move-disk"
+	CliOpRaftLag           = "raft-lag"
+	CliOpExtentOwners      = "extent-owners"
+	CliOpVerifyAll         = "verify-all"
+	CliOpTransferLeader    = "transfer-leadership"
 
 	//Shorthand format of operation name
 	CliOpDecommissionShortHand = "dec"
@@ -63,6 +88,27 @@ const (
 	CliFlagAuthKey            = "authkey"
 	CliFlagINodeStartID       = "inode-start"
 	CliFlagId                 = "id"
+	CliFlagProfPort           = "prof-port"
+	CliFlagExtentType         = "type"
+	CliFlagExtentTypeAlias    = "extent-type" // deprecated name of CliFlagExtentType
+	CliFlagHuman              = "human"       // space-report only, which prints the raw bytes by default
+	CliFlagTimeout            = "timeout"
+	CliFlagJSON               = "json"
+	CliFlagReason             = "reason"
+	CliFlagWithin             = "within"
+	CliFlagCancel             = "cancel"
+	CliFlagVolume             = "volume"
+	CliFlagStatus             = "status"
+	CliFlagDryRun             = "dry-run"
+	CliFlagYes                = "yes"
+	CliFlagLimit              = "limit"
+	CliFlagOn                 = "on"
+	CliFlagOff                = "off"
+	CliFlagOperator           = "operator"
+	CliFlagOlderThan          = "older-than"
+	CliFlagPeers              = "peers"
+	CliFlagForce              = "force"
+	CliFlagWatch              = "watch"
 
 	//CliFlagSetDataPartitionCount	= "count" use dp-count instead
 
@@ -15,10 +15,13 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/chubaofs/chubaofs/cli/api"
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/sdk/master"
 	"github.com/spf13/cobra"
@@ -37,6 +40,10 @@ func newDataNodeCmd(client *master.MasterClient) *cobra.Command {
 		newDataNodeListCmd(client),
 		newDataNodeInfoCmd(client),
 		newDataNodeDecommissionCmd(client),
+		newDataNodeRepairStatusCmd(client),
+		newDataNodeFlushCmd(client),
+		newDataNodeTimeToFullCmd(client),
+		newDataNodeTransferLeadershipCmd(client),
 	)
 	return cmd
 }
@@ -45,6 +52,10 @@ const (
 	cmdDataNodeListShort             = "List information of data nodes"
 	cmdDataNodeInfoShort             = "Show information of a data node"
 	cmdDataNodeDecommissionInfoShort = "decommission partitions in a data node to others"
+	cmdDataNodeRepairStatusShort     = "List the partitions needing repair on a data node"
+	cmdDataNodeFlushShort            = "Persist the metadata and the applied ids of all the partitions on a data node"
+	cmdDataNodeTimeToFullShort       = "Estimate when the partitions on a data node will be full at their growth rates"
+	cmdDataNodeTransferLeaderShort   = "Transfer the leaderships of the partitions led by a data node to their followers"
 )
 
 func newDataNodeListCmd(client *master.MasterClient) *cobra.Command {
@@ -152,3 +163,173 @@ func newDataNodeDecommissionCmd(client *master.MasterClient) *cobra.Command {
 	}
 	return cmd
 }
+
+func newDataNodeRepairStatusCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
+	var cmd = &cobra.Command{
+		Use:   CliOpRepairStatus + " [NODE ADDRESS]",
+		Short: cmdDataNodeRepairStatusShort,
+		Long: `List the partitions on the data node which have broken tiny extents, or extents mismatched
+among the replicas in their latest repair cycles, with the number of the extents pending repair.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err      error
+				statuses []*api.PartitionRepairStatus
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			addr := args[0]
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+			if statuses, err = dataClient.GetRepairingPartitions(); err != nil {
+				return
+			}
+			stdout("%v\n", formatPartitionRepairStatuses(addr, statuses))
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return validDataNodes(client, toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	return cmd
+}
+
+func newDataNodeFlushCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
+	var cmd = &cobra.Command{
+		Use:   CliOpFlush + " [NODE ADDRESS]",
+		Short: cmdDataNodeFlushShort,
+		Long: `Persist the META and APPLY files of every partition on the data node at once, instead of waiting
+for the periodic persistence. Run it before stopping a data node for maintenance.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err    error
+				result *api.FlushResult
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			addr := args[0]
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+			if result, err = dataClient.FlushPartitions(); err != nil {
+				return
+			}
+			stdout("%v\n", formatFlushResult(addr, result))
+			if len(result.Failed) > 0 {
+				err = fmt.Errorf("%v partitions failed to flush", len(result.Failed))
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return validDataNodes(client, toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	return cmd
+}
+
+func newDataNodeTimeToFullCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort uint16
+		optWithin   time.Duration
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpTimeToFull + " [NODE ADDRESS]",
+		Short: cmdDataNodeTimeToFullShort,
+		Long: `List the partitions on the data node with their growth rates over the latest half an hour, and the time
+until they turn read-only if they keep growing at these rates. The ones to be full first come first, so the data
+can be moved off them in time. The partitions not growing are listed last.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err     error
+				growths []*api.PartitionGrowth
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			addr := args[0]
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+			if growths, err = dataClient.GetPartitionsGrowth(); err != nil {
+				return
+			}
+			if optWithin > 0 {
+				filtered := make([]*api.PartitionGrowth, 0, len(growths))
+				for _, growth := range growths {
+					if growth.TimeToFull >= 0 && time.Duration(growth.TimeToFull)*time.Second <= optWithin {
+						filtered = append(filtered, growth)
+					}
+				}
+				growths = filtered
+			}
+			stdout("%v\n", formatPartitionsGrowth(addr, growths))
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return validDataNodes(client, toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().DurationVar(&optWithin, CliFlagWithin, 0, "Only list the partitions to be full within the duration, 0 lists all")
+	return cmd
+}
+
+func newDataNodeTransferLeadershipCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
+	var cmd = &cobra.Command{
+		Use:   CliOpTransferLeader + " [NODE ADDRESS]",
+		Short: cmdDataNodeTransferLeaderShort,
+		Long: `Hand the leadership of every partition led by the data node over to the follower caught up the most,
+before stopping the node for maintenance, so the partitions do not elect their new leaders all at once after it
+is gone. A partition without a follower caught up with the log committed keeps its leader, and is reported with
+the reason. The command fails if any partition keeps its leader.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err    error
+				result *api.LeaderTransferResult
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			addr := args[0]
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+			if result, err = dataClient.TransferLeaderships(); err != nil {
+				return
+			}
+			stdout("%v\n", formatLeaderTransferResult(addr, result))
+			if result.Failed > 0 {
+				err = fmt.Errorf("%v partitions failed to transfer the leadership", result.Failed)
+			}
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return validDataNodes(client, toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	return cmd
+}
@@ -15,11 +15,20 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/cli/api"
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/sdk/master"
 	"github.com/spf13/cobra"
-	"sort"
-	"strconv"
 )
 
 const (
@@ -38,6 +47,28 @@ func newDataPartitionCmd(client *master.MasterClient) *cobra.Command {
 		newDataPartitionDecommissionCmd(client),
 		newDataPartitionReplicateCmd(client),
 		newDataPartitionDeleteReplicaCmd(client),
+		newDataPartitionRepairPlanCmd(client),
+		newDataPartitionFragmentationCmd(client),
+		newDataPartitionRepairCmd(client),
+		newDataPartitionRepairStatsCmd(client),
+		newDataPartitionSpaceReportCmd(client),
+		newDataPartitionRaftProgressCmd(client),
+		newDataPartitionMigrateReplicaCmd(client),
+		newDataPartitionDiffCmd(client),
+		newDataPartitionLeaderCmd(client),
+		newDataPartitionMetaDiffCmd(client),
+		newDataPartitionSnapshotCmd(),
+		newDataPartitionFreezeCmd(),
+		newDataPartitionActiveRepairsCmd(),
+		newDataPartitionTopExtentsCmd(client),
+		newDataPartitionVerifyRaftCmd(client),
+		newDataPartitionSetReadOnlyCmd(client),
+		newDataPartitionColdExtentsCmd(client),
+		newDataPartitionRebuildMetaCmd(client),
+		newDataPartitionMoveDiskCmd(client),
+		newDataPartitionRaftLagCmd(client),
+		newDataPartitionExtentOwnersCmd(client),
+		newDataPartitionVerifyAllCmd(client),
 	)
 	return cmd
 }
@@ -48,9 +79,63 @@ const (
 	cmdDataPartitionDecommissionShort     = "Decommission a replication of the data partition to a new address"
 	cmdDataPartitionReplicateShort        = "Add a replication of the data partition on a new address"
 	cmdDataPartitionDeleteReplicaShort    = "Delete a replication of the data partition on a fixed address"
+	cmdDataPartitionRepairPlanShort       = "Preview the repair of a data partition without performing it"
+	cmdDataPartitionFragmentationShort    = "Show the extent fragmentation of all the replicas of a data partition"
+	cmdDataPartitionRepairShort           = "Launch a repair of a data partition immediately"
+	cmdDataPartitionRepairStatsShort      = "Show the statistics of the latest repair of a data partition"
+	cmdDataPartitionSpaceReportShort      = "Show the space of all the replicas of a data partition"
+	cmdDataPartitionRaftProgressShort     = "Show the raft progress of all the replicas of a data partition"
+	cmdDataPartitionMigrateReplicaShort   = "Move a replication of the data partition from an address to a new address"
+	cmdDataPartitionDiffShort             = "Compare the extents of two replications of a data partition"
+	cmdDataPartitionLeaderShort           = "Show the raft leader and term seen by all the replicas of a data partition"
+	cmdDataPartitionMetaDiffShort         = "Compare the metadata persisted by all the replicas of a data partition"
+	cmdDataPartitionSnapshotShort         = "Show the extents in the snapshot of a replication of a data partition"
+	cmdDataPartitionFreezeShort           = "Freeze or unfreeze a replication of a data partition for an investigation"
+	cmdDataPartitionActiveRepairsShort    = "List or cancel the repairs of the extents being run on a replication of a data partition"
+	cmdDataPartitionTopExtentsShort       = "List the largest extents of a data partition by the size on the disk"
+	cmdDataPartitionVerifyRaftShort       = "Verify the applied ids of all the replicas of a data partition against the raft logs"
+	cmdDataPartitionSetReadOnlyShort      = "Set all the replicas of a data partition read-only or back by the operator"
+	cmdDataPartitionColdExtentsShort      = "List the extents of a data partition not read within a duration"
+	cmdDataPartitionRebuildMetaShort      = "Rebuild the lost metadata of a replication of a data partition from its directory"
+	cmdDataPartitionMoveDiskShort         = "Move a replication of a data partition to another disk of its data node"
+	cmdDataPartitionRaftLagShort          = "Show the raft lag of all the replicas of a data partition behind the leader"
+	cmdDataPartitionExtentOwnersShort     = "Show the volume and the inodes the extents of a data partition belong to"
+	cmdDataPartitionVerifyAllShort        = "Verify the extents of all the replicas of a data partition agree in the sizes and the crcs"
 	)
 
+const (
+	defaultDataNodeProfPort = 17320
+	defaultMigrateTimeout   = 30 * time.Minute
+	migrateCheckInterval    = 5 * time.Second
+)
+
+// Find the repair leader of the partition, which has to be the raft leader at the same time.
+func dataPartitionRepairLeader(partition *proto.DataPartitionInfo) (leader string, err error) {
+	if len(partition.Hosts) == 0 {
+		err = fmt.Errorf("partition(%v) has no hosts", partition.PartitionID)
+		return
+	}
+	leader = partition.Hosts[0]
+	for _, replica := range partition.Replicas {
+		if replica.IsLeader && replica.Addr != leader {
+			err = fmt.Errorf("partition(%v) repair leader(%v) is not the raft leader(%v)", partition.PartitionID, leader, replica.Addr)
+			return
+		}
+	}
+	return
+}
+
+// Build the address of the http service of a data node from its tcp address.
+func dataNodeHttpAddr(addr string, profPort uint16) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(profPort)))
+}
+
 func newDataPartitionGetCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
 	var cmd = &cobra.Command{
 		Use:   CliOpInfo + " [DATA PARTITION ID]",
 		Short: cmdDataPartitionGetShort,
@@ -67,8 +152,27 @@ func newDataPartitionGetCmd(client *master.MasterClient) *cobra.Command {
 				return
 			}
 			stdout(formatDataPartitionInfo(partition))
+			uptimes := make(map[string]*api.PartitionUptime)
+			errs := make(map[string]error)
+			for _, host := range partition.Hosts {
+				dataClient := api.NewDataHttpClient(dataNodeHttpAddr(host, optProfPort), false)
+				if uptimes[host], err = dataClient.GetPartitionUptime(partitionID); err != nil {
+					errs[host] = err
+				}
+			}
+			stdout("%v\n", formatPartitionUptimes(partition.Hosts, uptimes, errs))
+			states := make(map[string]*api.PartitionReadOnlyState)
+			errs = make(map[string]error)
+			for _, host := range partition.Hosts {
+				dataClient := api.NewDataHttpClient(dataNodeHttpAddr(host, optProfPort), false)
+				if states[host], err = dataClient.GetManualReadOnly(partitionID); err != nil {
+					errs[host] = err
+				}
+			}
+			stdout("%v\n", formatPartitionReadOnlyStates(partition.Hosts, states, errs))
 		},
 	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
 	return cmd
 }
 
@@ -221,3 +325,1445 @@ func newDataPartitionDeleteReplicaCmd(client *master.MasterClient) *cobra.Comman
 	}
 	return cmd
 }
+
+func newDataPartitionRepairPlanCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort   uint16
+		optExtentType string
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpRepairPlan + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionRepairPlanShort,
+		Long: `Ask the repair leader, which is the first host of the partition, to compare the extents of all the
+replicas and show the extents every replica would create and repair. Nothing is changed on the data nodes.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+				summaries []*api.RepairSummary
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			if len(partition.Hosts) == 0 {
+				err = fmt.Errorf("partition(%v) has no hosts", partitionID)
+				return
+			}
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(partition.Hosts[0], optProfPort), false)
+			if summaries, err = dataClient.GetRepairPlan(partitionID, optExtentType); err != nil {
+				return
+			}
+			stdout("%v\n", formatRepairSummaryTableHeader())
+			for _, summary := range summaries {
+				stdout("%v\n", formatRepairSummaryTableRow(summary))
+			}
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	addExtentTypeFlag(cmd, &optExtentType)
+	return cmd
+}
+
+// The flag of the type of the extents to be repaired, which keeps the old name as a deprecated alias.
+func addExtentTypeFlag(cmd *cobra.Command, extentType *string) {
+	cmd.Flags().StringVar(extentType, CliFlagExtentType, "normal", "Type of the extents to be repaired [normal, tiny]")
+	cmd.Flags().StringVar(extentType, CliFlagExtentTypeAlias, "normal", "Type of the extents to be repaired [normal, tiny]")
+	_ = cmd.Flags().MarkDeprecated(CliFlagExtentTypeAlias, fmt.Sprintf("use --%v instead", CliFlagExtentType))
+}
+
+func newDataPartitionFragmentationCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
+	var cmd = &cobra.Command{
+		Use:   CliOpFragmentation + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionFragmentationShort,
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			stdout("%v\n", formatFragmentationTableHeader())
+			for _, host := range partition.Hosts {
+				dataClient := api.NewDataHttpClient(dataNodeHttpAddr(host, optProfPort), false)
+				report, reportErr := dataClient.GetFragmentationReport(partitionID)
+				if reportErr != nil {
+					errout("get fragmentation of partition(%v) on %v failed: %v\n", partitionID, host, reportErr)
+					continue
+				}
+				stdout("%v\n", formatFragmentationTableRow(host, report))
+			}
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	return cmd
+}
+
+// Launch a repair on the leader of the partition, which is returned with the stats of the repair.
+func launchDataPartitionRepair(client *master.MasterClient, partitionID uint64, profPort uint16, extentType string) (
+	leader string, stats *api.RepairStats, err error) {
+	var partition *proto.DataPartitionInfo
+	if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+		return
+	}
+	if leader, err = dataPartitionRepairLeader(partition); err != nil {
+		return
+	}
+	dataClient := api.NewDataHttpClient(dataNodeHttpAddr(leader, profPort), false)
+	stats, err = dataClient.LaunchRepair(partitionID, extentType)
+	return
+}
+
+func newDataPartitionRepairCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort   uint16
+		optExtentType string
+		optSelector   dataPartitionSelector
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpRepair + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionRepairShort,
+		Long: `Ask the leader of the partition to repair the extents of the given type at once instead of waiting for
+the next scheduled repair. If the repair does not finish in a few seconds, the job id is printed and the progress
+can be checked by the "repair-stats" command.
+
+With --volume, the repairs are launched on all the partitions of the volume, or the ones of the status given by
+--status, after a confirmation. The partitions are listed without being repaired with --dry-run.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err    error
+				leader string
+				stats  *api.RepairStats
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			if optSelector.selected() {
+				err = optSelector.apply(client, CliOpRepair, func(partitionID uint64) (result string, err error) {
+					if leader, stats, err = launchDataPartitionRepair(client, partitionID, optProfPort, optExtentType); err != nil {
+						return
+					}
+					if !stats.Finished {
+						return fmt.Sprintf("job %v still running on %v", stats.JobID, leader), nil
+					}
+					return fmt.Sprintf("job %v finished on %v", stats.JobID, leader), nil
+				})
+				return
+			}
+			if len(args) < 1 {
+				err = fmt.Errorf("requires a data partition id or --%v", CliFlagVolume)
+				return
+			}
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if leader, stats, err = launchDataPartitionRepair(client, partitionID, optProfPort, optExtentType); err != nil {
+				return
+			}
+			if !stats.Finished {
+				stdout("Repair job %v of partition %v is still running on %v.\n", stats.JobID, partitionID, leader)
+				return
+			}
+			stdout("Repair job %v of partition %v finished on %v:\n", stats.JobID, partitionID, leader)
+			stdout("%v", formatRepairStats(stats))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	addExtentTypeFlag(cmd, &optExtentType)
+	optSelector.addFlags(cmd)
+	return cmd
+}
+
+func newDataPartitionRepairStatsCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
+	var cmd = &cobra.Command{
+		Use:   CliOpRepairStats + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionRepairStatsShort,
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+				leader    string
+				stats     *api.RepairStats
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			if leader, err = dataPartitionRepairLeader(partition); err != nil {
+				return
+			}
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(leader, optProfPort), false)
+			if stats, err = dataClient.GetRepairStats(partitionID); err != nil {
+				return
+			}
+			stdout("%v", formatRepairStats(stats))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	return cmd
+}
+
+func newDataPartitionSpaceReportCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort uint16
+		optHuman    bool
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpSpaceReport + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionSpaceReportShort,
+		Long:  `The used space is recomputed by every replica before being reported, so the numbers are accurate.`,
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			stdout("%v\n", formatPartitionSpaceTableHeader())
+			for _, host := range partition.Hosts {
+				dataClient := api.NewDataHttpClient(dataNodeHttpAddr(host, optProfPort), false)
+				space, spaceErr := dataClient.GetPartitionSpace(partitionID, true)
+				if spaceErr != nil {
+					errout("get space of partition(%v) on %v failed: %v\n", partitionID, host, spaceErr)
+					continue
+				}
+				stdout("%v\n", formatPartitionSpaceTableRow(host, space, optHuman))
+			}
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	// the other commands print the sizes in the units already, the raw bytes are kept here for the scripts
+	cmd.Flags().BoolVar(&optHuman, CliFlagHuman, false, "Print the sizes in KB/MB/GB/TB instead of bytes")
+	return cmd
+}
+
+func newDataPartitionRaftProgressCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
+	var cmd = &cobra.Command{
+		Use:   CliOpRaftProgress + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionRaftProgressShort,
+		Long:  `The lag is the number of the committed raft logs which have not been applied by the replica yet.`,
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			stdout("%v\n", formatRaftProgressTableHeader())
+			for _, host := range partition.Hosts {
+				dataClient := api.NewDataHttpClient(dataNodeHttpAddr(host, optProfPort), false)
+				progress, progressErr := dataClient.GetRaftProgress(partitionID)
+				if progressErr != nil {
+					errout("get raft progress of partition(%v) on %v failed: %v\n", partitionID, host, progressErr)
+					continue
+				}
+				stdout("%v\n", formatRaftProgressTableRow(host, progress))
+			}
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	return cmd
+}
+
+func newDataPartitionMigrateReplicaCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort uint16
+		optTimeout  time.Duration
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpMigrateReplica + " [DATA PARTITION ID] [OLD ADDRESS] [NEW ADDRESS]",
+		Short: cmdDataPartitionMigrateReplicaShort,
+		Long: `Add a replication on the new address, wait until its raft log catches up with the raft leader,
+and then delete the replication on the old address. The old replication is deleted at last, so it does
+not matter if the old data node is already down.`,
+		Args: cobra.MinimumNArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			oldAddr, newAddr := args[1], args[2]
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			if !containsHost(partition.Hosts, oldAddr) {
+				err = fmt.Errorf("partition(%v) has no replication on %v", partitionID, oldAddr)
+				return
+			}
+			if !containsHost(partition.Hosts, newAddr) {
+				if err = client.AdminAPI().AddDataReplica(partitionID, newAddr); err != nil {
+					return
+				}
+				stdout("Replication of partition(%v) added on %v\n", partitionID, newAddr)
+			}
+			if err = waitReplicaCatchUp(partition, oldAddr, newAddr, optProfPort, optTimeout); err != nil {
+				return
+			}
+			if err = client.AdminAPI().DeleteDataReplica(partitionID, oldAddr); err != nil {
+				return
+			}
+			stdout("Replication of partition(%v) deleted on %v\n", partitionID, oldAddr)
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().DurationVar(&optTimeout, CliFlagTimeout, defaultMigrateTimeout, "Max time to wait for the new replication to catch up")
+	return cmd
+}
+
+func containsHost(hosts []string, addr string) bool {
+	for _, host := range hosts {
+		if host == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait until the applied id of the new replication reaches the committed id of the raft leader.
+func waitReplicaCatchUp(partition *proto.DataPartitionInfo, oldAddr, newAddr string, profPort uint16, timeout time.Duration) (err error) {
+	var leader string
+	for _, replica := range partition.Replicas {
+		if replica.IsLeader {
+			leader = replica.Addr
+		}
+	}
+	if leader == "" || leader == oldAddr {
+		// the raft leader is unknown or going to be removed, so compare with the repair leader instead
+		for _, host := range partition.Hosts {
+			if host != oldAddr {
+				leader = host
+				break
+			}
+		}
+	}
+	if leader == "" {
+		return fmt.Errorf("partition(%v) has no replication to catch up with", partition.PartitionID)
+	}
+	leaderClient := api.NewDataHttpClient(dataNodeHttpAddr(leader, profPort), false)
+	newClient := api.NewDataHttpClient(dataNodeHttpAddr(newAddr, profPort), false)
+	deadline := time.Now().Add(timeout)
+	for {
+		leaderProgress, leaderErr := leaderClient.GetRaftProgress(partition.PartitionID)
+		newProgress, newErr := newClient.GetRaftProgress(partition.PartitionID)
+		switch {
+		case leaderErr != nil:
+			stdout("Waiting for raft progress of leader %v: %v\n", leader, leaderErr)
+		case newErr != nil:
+			stdout("Waiting for raft progress of %v: %v\n", newAddr, newErr)
+		case newProgress.AppliedID >= leaderProgress.CommittedID:
+			stdout("Replication on %v caught up: applied(%v) leader committed(%v)\n",
+				newAddr, newProgress.AppliedID, leaderProgress.CommittedID)
+			return
+		default:
+			stdout("Replication on %v syncing: applied(%v) leader committed(%v) lag(%v)\n", newAddr,
+				newProgress.AppliedID, leaderProgress.CommittedID, leaderProgress.CommittedID-newProgress.AppliedID)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("replication on %v not caught up in %v", newAddr, timeout)
+		}
+		time.Sleep(migrateCheckInterval)
+	}
+}
+
+func newDataPartitionDiffCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort uint16
+		optAddr     string
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpDiff + " [DATA PARTITION ID] [PEER ADDRESS]",
+		Short: cmdDataPartitionDiffShort,
+		Long: `Compare the extents of the replication on the given address, which is the first host of the partition
+by default, with the ones of the replication on the peer address.`,
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+				diff      *api.SnapshotDiff
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			peerAddr := args[1]
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			addr := optAddr
+			if addr == "" && len(partition.Hosts) > 0 {
+				addr = partition.Hosts[0]
+			}
+			if addr == "" || addr == peerAddr {
+				err = fmt.Errorf("specify a replication other than the peer with --%v", CliFlagAddress)
+				return
+			}
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+			if diff, err = dataClient.DiffSnapshot(partitionID, peerAddr); err != nil {
+				return
+			}
+			stdout("%v", formatSnapshotDiff(addr, diff))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().StringVar(&optAddr, CliFlagAddress, "", "Address of the replication to compare with the peer")
+	return cmd
+}
+
+func newDataPartitionLeaderCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
+	var cmd = &cobra.Command{
+		Use:   CliOpLeader + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionLeaderShort,
+		Long: `Every replica reports the raft leader and term it sees. The replicas which see different
+leaders, or more than one replica claiming to be the leader, are reported as a conflict, which may
+be a symptom of a split brain.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			leaders := make(map[string]*api.RaftLeader)
+			stdout("%v\n", formatRaftLeaderTableHeader())
+			for _, host := range partition.Hosts {
+				dataClient := api.NewDataHttpClient(dataNodeHttpAddr(host, optProfPort), false)
+				leader, leaderErr := dataClient.GetRaftLeader(partitionID)
+				if leaderErr != nil {
+					errout("get raft leader of partition(%v) on %v failed: %v\n", partitionID, host, leaderErr)
+					continue
+				}
+				leaders[host] = leader
+				stdout("%v\n", formatRaftLeaderTableRow(host, leader))
+			}
+			stdout("%v\n", formatRaftLeaderConflicts(findRaftLeaderConflicts(leaders)))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	return cmd
+}
+
+func newDataPartitionRaftLagCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort uint16
+		optWatch    time.Duration
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpRaftLag + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionRaftLagShort,
+		Long: `Every replica reports its applied id and committed index, and the raft leader it sees. The lag is the
+number of the committed raft logs the replica has not applied yet, and the behind is the number of the logs
+committed by the leader the replica has not applied yet. The follower furthest behind the leader is marked,
+which should be caught up before the leader is removed or a node is taken down for a maintenance. With
+--watch, the replicas are queried again at the interval until interrupted.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			for {
+				if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+					return
+				}
+				replicas := make([]*raftLagReplica, 0, len(partition.Hosts))
+				for _, host := range partition.Hosts {
+					replicas = append(replicas, getRaftLag(host, partitionID, optProfPort))
+				}
+				if optWatch > 0 {
+					stdout("%v\n", time.Now().Format("2006-01-02 15:04:05"))
+				}
+				leader, laggiest := computeRaftLag(replicas)
+				stdout("%v\n", formatRaftLag(replicas, leader, laggiest))
+				if optWatch <= 0 {
+					return
+				}
+				time.Sleep(optWatch)
+				stdout("\n")
+			}
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().DurationVar(&optWatch, CliFlagWatch, 0, "Refresh at the interval until interrupted, e.g. 2s")
+	return cmd
+}
+
+// raftLagReplica is the raft progress of a replica and the leader it sees, err is why they are unknown.
+type raftLagReplica struct {
+	addr     string
+	progress *api.RaftProgress
+	leader   *api.RaftLeader
+	behind   uint64 // logs committed by the leader not applied by the replica yet
+	err      error
+}
+
+func getRaftLag(host string, partitionID uint64, profPort uint16) (replica *raftLagReplica) {
+	replica = &raftLagReplica{addr: host}
+	dataClient := api.NewDataHttpClient(dataNodeHttpAddr(host, profPort), false)
+	if replica.progress, replica.err = dataClient.GetRaftProgress(partitionID); replica.err != nil {
+		return
+	}
+	replica.leader, replica.err = dataClient.GetRaftLeader(partitionID)
+	return
+}
+
+// Compute how far each replica falls behind the committed index of the leader, and return the leader and the
+// follower furthest behind it, nil if not found. A replica reporting no leader role is a follower.
+func computeRaftLag(replicas []*raftLagReplica) (leader, laggiest *raftLagReplica) {
+	for _, replica := range replicas {
+		if replica.err == nil && replica.leader.IsLeader {
+			leader = replica
+			break
+		}
+	}
+	if leader == nil {
+		return
+	}
+	for _, replica := range replicas {
+		if replica.err != nil || replica == leader {
+			continue
+		}
+		if leader.progress.CommittedID > replica.progress.AppliedID {
+			replica.behind = leader.progress.CommittedID - replica.progress.AppliedID
+		}
+		if laggiest == nil || replica.behind > laggiest.behind {
+			laggiest = replica
+		}
+	}
+	return
+}
+
+// Group the replicas by the leader they see, there is a conflict if more than one group exists,
+// or more than one replica claims to be the leader.
+func findRaftLeaderConflicts(leaders map[string]*api.RaftLeader) (views map[string][]string, claimants []string) {
+	views = make(map[string][]string)
+	claimants = make([]string, 0)
+	for host, leader := range leaders {
+		view := fmt.Sprintf("%v (term %v)", leader.LeaderAddr, leader.Term)
+		if leader.LeaderID == 0 {
+			view = "none"
+		}
+		views[view] = append(views[view], host)
+		if leader.IsLeader {
+			claimants = append(claimants, host)
+		}
+	}
+	for _, hosts := range views {
+		sort.Strings(hosts)
+	}
+	sort.Strings(claimants)
+	return
+}
+
+func newDataPartitionMetaDiffCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
+	var cmd = &cobra.Command{
+		Use:   CliOpMetaDiff + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionMetaDiffShort,
+		Long: `Every replica reports the metadata in its META file. The volume, the partition size,
+the logical size and the peers are compared across the replicas, and the divergent fields are
+highlighted, which catches the metadata drift after the membership changes.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			hosts := make([]string, 0, len(partition.Hosts))
+			metas := make(map[string]*api.DataPartitionMetadata)
+			for _, host := range partition.Hosts {
+				dataClient := api.NewDataHttpClient(dataNodeHttpAddr(host, optProfPort), false)
+				meta, metaErr := dataClient.GetPartitionMetadata(partitionID)
+				if metaErr != nil {
+					errout("get metadata of partition(%v) on %v failed: %v\n", partitionID, host, metaErr)
+					continue
+				}
+				hosts = append(hosts, host)
+				metas[host] = meta
+			}
+			stdout("%v\n", formatMetadataDiffs(hosts, diffPartitionMetadata(hosts, metas)))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	return cmd
+}
+
+// metadataFieldDiff holds the values of a metadata field reported by the replicas.
+type metadataFieldDiff struct {
+	name      string
+	values    map[string]string // host -> value
+	divergent bool
+}
+
+// Compare the fields of the metadata of the replicas. The peers are sorted by the id on the data nodes,
+// and sorted again here for the replicas of the older versions, so the comparison does not depend on the order.
+func diffPartitionMetadata(hosts []string, metas map[string]*api.DataPartitionMetadata) (diffs []*metadataFieldDiff) {
+	fields := []struct {
+		name  string
+		value func(meta *api.DataPartitionMetadata) string
+	}{
+		{"VolumeID", func(meta *api.DataPartitionMetadata) string { return meta.VolumeID }},
+		{"PartitionSize", func(meta *api.DataPartitionMetadata) string { return strconv.Itoa(meta.PartitionSize) }},
+		{"LogicalSize", func(meta *api.DataPartitionMetadata) string { return strconv.Itoa(meta.LogicalSize) }},
+		{"Peers", func(meta *api.DataPartitionMetadata) string {
+			peers := make([]proto.Peer, len(meta.Peers))
+			copy(peers, meta.Peers)
+			sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+			values := make([]string, 0, len(peers))
+			for _, peer := range peers {
+				values = append(values, fmt.Sprintf("%v:%v", peer.ID, peer.Addr))
+			}
+			return strings.Join(values, ",")
+		}},
+	}
+	diffs = make([]*metadataFieldDiff, 0, len(fields))
+	for _, field := range fields {
+		diff := &metadataFieldDiff{name: field.name, values: make(map[string]string)}
+		for _, host := range hosts {
+			diff.values[host] = field.value(metas[host])
+			if diff.values[host] != diff.values[hosts[0]] {
+				diff.divergent = true
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return
+}
+
+func newDataPartitionSnapshotCmd() *cobra.Command {
+	var (
+		optProfPort uint16
+		optJSON     bool
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpSnapshot + " [DATA PARTITION ID] [ADDRESS]",
+		Short: cmdDataPartitionSnapshotShort,
+		Long: `Show the extents in the snapshot of the replication on the given address, which is the list
+the repair compares to decide the extents to create or to repair. The snapshot cached by the data node
+is returned as it is, so it is safe to run against a live leader.`,
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err   error
+				files []*proto.File
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			addr := args[1]
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+			if files, err = dataClient.GetSnapshot(partitionID); err != nil {
+				return
+			}
+			if optJSON {
+				var data []byte
+				if data, err = json.MarshalIndent(files, "", "  "); err != nil {
+					return
+				}
+				stdout("%v\n", string(data))
+				return
+			}
+			stdout("%v\n", formatSnapshotFiles(addr, files))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().BoolVar(&optJSON, CliFlagJSON, false, "Print the snapshot in json")
+	return cmd
+}
+
+func newDataPartitionFreezeCmd() *cobra.Command {
+	var (
+		optProfPort uint16
+		optReason   string
+	)
+	var cmd = &cobra.Command{
+		Use:       CliOpFreeze + " [DATA PARTITION ID] [ADDRESS] [ENABLE]",
+		ValidArgs: []string{"true", "false"},
+		Short:     cmdDataPartitionFreezeShort,
+		Long: `Freeze the replication on the given address, so that its extents stay as they are for an investigation.
+A frozen replication is unavailable: it is never repaired, and it rejects the packets of the clients and
+the peers. The frozen state survives the restarts of the data node, until it is unfrozen with 'false'.`,
+		Args: cobra.MinimumNArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err    error
+				freeze bool
+				state  *api.PartitionFreezeState
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			addr := args[1]
+			if freeze, err = strconv.ParseBool(args[2]); err != nil {
+				return
+			}
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+			if state, err = dataClient.FreezePartition(partitionID, freeze, optReason); err != nil {
+				return
+			}
+			stdout("%v\n", formatPartitionFreezeState(addr, state))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().StringVar(&optReason, CliFlagReason, "", "Why the partition is frozen, kept with the frozen state")
+	return cmd
+}
+
+func newDataPartitionActiveRepairsCmd() *cobra.Command {
+	var (
+		optProfPort uint16
+		optCancel   uint64
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpActiveRepairs + " [DATA PARTITION ID] [ADDRESS]",
+		Short: cmdDataPartitionActiveRepairsShort,
+		Long: `List the repairs of the extents being run on the replication on the given address, with the bytes
+transferred from their sources. A stuck one can be canceled with --cancel, which stops it after the packet
+being written. The canceled extent is continued by the next repair cycle.`,
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err     error
+				repairs []*api.ActiveRepair
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			addr := args[1]
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+			if repairs, err = dataClient.GetActiveRepairs(partitionID, optCancel); err != nil {
+				return
+			}
+			stdout("%v\n", formatActiveRepairs(addr, repairs))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().Uint64Var(&optCancel, CliFlagCancel, 0, "Cancel the repair of the extent before listing")
+	return cmd
+}
+
+func newDataPartitionTopExtentsCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort uint16
+		optLimit    int
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpTopExtents + " [DATA PARTITION ID] [ADDRESS]",
+		Short: cmdDataPartitionTopExtentsShort,
+		Long: `List the largest extents of the replication on the given address, or on the leader of the partition if
+no address is given. The sizes are the space taken on the disk, so the holes punched in the tiny extents are not
+counted. The share of the listed extents in the partition tells whether it is dominated by a few large files.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+				top       *api.TopExtents
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			var addr string
+			if len(args) > 1 {
+				addr = args[1]
+			} else {
+				if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+					return
+				}
+				if len(partition.Hosts) == 0 {
+					err = fmt.Errorf("partition(%v) has no hosts", partitionID)
+					return
+				}
+				addr = partition.Hosts[0]
+			}
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+			if top, err = dataClient.GetTopExtents(partitionID, optLimit); err != nil {
+				return
+			}
+			stdout("%v\n", formatTopExtents(addr, top))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().IntVar(&optLimit, CliFlagLimit, 20, "Number of the largest extents to list")
+	return cmd
+}
+
+func newDataPartitionVerifyRaftCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
+	var cmd = &cobra.Command{
+		Use:   CliOpVerifyRaft + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionVerifyRaftShort,
+		Long: `Cross-check the applied id persisted and applied by each replica against the committed and the last raft
+logs and the truncate point, and report the gaps and the regressions among them. Nothing is changed on the replicas,
+the command fails if any of them is inconsistent.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			var inconsistent, failed int
+			for _, host := range partition.Hosts {
+				dataClient := api.NewDataHttpClient(dataNodeHttpAddr(host, optProfPort), false)
+				state, verifyErr := dataClient.VerifyRaftState(partitionID)
+				if verifyErr != nil {
+					errout("verify raft state of partition(%v) on %v failed: %v\n", partitionID, host, verifyErr)
+					failed++
+					continue
+				}
+				if len(state.Problems) > 0 {
+					inconsistent++
+				}
+				stdout("%v\n", formatRaftState(host, state))
+			}
+			if inconsistent > 0 || failed > 0 {
+				err = fmt.Errorf("%v of %v replicas inconsistent, %v failed to verify", inconsistent, len(partition.Hosts), failed)
+			}
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	return cmd
+}
+
+func newDataPartitionSetReadOnlyCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort uint16
+		optOn       bool
+		optOff      bool
+		optOperator string
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpSetReadOnly + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionSetReadOnlyShort,
+		Long: `Set all the replicas of the data partition read-only with --on, or back with --off. The manual read-only
+state is persisted by the data nodes with the operator and the time, and survives their restarts. It never makes
+a replica more writable than its usage allows.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			if optOn == optOff {
+				err = fmt.Errorf("exactly one of --%v and --%v is required", CliFlagOn, CliFlagOff)
+				return
+			}
+			if optOperator == "" {
+				err = fmt.Errorf("--%v is required", CliFlagOperator)
+				return
+			}
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			states := make(map[string]*api.PartitionReadOnlyState)
+			errs := make(map[string]error)
+			for _, host := range partition.Hosts {
+				dataClient := api.NewDataHttpClient(dataNodeHttpAddr(host, optProfPort), false)
+				state, setErr := dataClient.SetManualReadOnly(partitionID, optOn, optOperator)
+				if setErr != nil {
+					errs[host] = setErr
+					continue
+				}
+				states[host] = state
+			}
+			stdout("%v\n", formatPartitionReadOnlyStates(partition.Hosts, states, errs))
+			if len(errs) > 0 {
+				err = fmt.Errorf("%v of %v replicas failed to set", len(errs), len(partition.Hosts))
+			}
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().BoolVar(&optOn, CliFlagOn, false, "Set the data partition read-only")
+	cmd.Flags().BoolVar(&optOff, CliFlagOff, false, "Set the data partition back from read-only")
+	cmd.Flags().StringVar(&optOperator, CliFlagOperator, os.Getenv("USER"), "Who sets the read-only state, kept for the audit")
+	return cmd
+}
+
+func newDataPartitionColdExtentsCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort  uint16
+		optOlderThan time.Duration
+		optJSON      bool
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpColdExtents + " [DATA PARTITION ID] [ADDRESS]",
+		Short: cmdDataPartitionColdExtentsShort,
+		Long: `List the normal extents of the replication on the given address, or on the leader of the partition if
+no address is given, which are not read by the clients within the duration. The last reads are tracked by the
+minute and persisted every few minutes, so the reads just before a crash of the data node may be lost. An extent
+is not listed before the duration has passed since its creation and since the tracking began on the replica, and
+the tiny extents are never listed as they are shared by the files. Use --json to feed a tiering process.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+				cold      *api.ColdExtents
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			if optOlderThan < time.Second {
+				err = fmt.Errorf("--%v must be at least 1s", CliFlagOlderThan)
+				return
+			}
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			var addr string
+			if len(args) > 1 {
+				addr = args[1]
+			} else {
+				if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+					return
+				}
+				if len(partition.Hosts) == 0 {
+					err = fmt.Errorf("partition(%v) has no hosts", partitionID)
+					return
+				}
+				addr = partition.Hosts[0]
+			}
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+			if cold, err = dataClient.GetColdExtents(partitionID, optOlderThan); err != nil {
+				return
+			}
+			if optJSON {
+				var data []byte
+				if data, err = json.MarshalIndent(cold, "", "  "); err != nil {
+					return
+				}
+				stdout("%v\n", string(data))
+				return
+			}
+			stdout("%v\n", formatColdExtents(addr, cold))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().DurationVar(&optOlderThan, CliFlagOlderThan, 30*24*time.Hour, "List the extents not read within the duration")
+	cmd.Flags().BoolVar(&optJSON, CliFlagJSON, false, "Print the cold extents in json")
+	return cmd
+}
+
+func newDataPartitionRebuildMetaCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort uint16
+		optAddr     string
+		optVolume   string
+		optPeers    string
+		optForce    bool
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpRebuildMeta + " [DATA PARTITION DIR]",
+		Short: cmdDataPartitionRebuildMetaShort,
+		Long: `Rebuild the META and the META.bak of the replication under the directory on the data node of the given
+address, after both are lost. The partition id and the size are taken from the directory name, which is in the
+format datapartition_ID_SIZE. The volume and the peers are fetched from the master, unless given by --volume and
+--peers in the format ID:HOST:PORT,... The data node loads the partition with the rebuilt metadata. A valid
+metadata is only overwritten with --force, and the states only kept in the metadata, like the frozen or the
+manual read-only one, start over.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+				peers     []proto.Peer
+				hosts     []string
+				meta      *api.DataPartitionMetadata
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			if optAddr == "" {
+				err = fmt.Errorf("--%v of the data node holding the directory is required", CliFlagAddress)
+				return
+			}
+			dir := path.Clean(args[0])
+			arr := strings.Split(path.Base(dir), "_")
+			if len(arr) != 3 {
+				err = fmt.Errorf("directory name(%v) is not in the format datapartition_ID_SIZE", path.Base(dir))
+				return
+			}
+			partitionID, err := strconv.ParseUint(arr[1], 10, 64)
+			if err != nil {
+				return
+			}
+			if optPeers != "" {
+				if peers, err = proto.ParsePeers(optPeers); err != nil {
+					return
+				}
+			}
+			if optVolume == "" || len(peers) == 0 {
+				if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+					return
+				}
+				if optVolume == "" {
+					optVolume = partition.VolName
+				}
+				if len(peers) == 0 {
+					peers, hosts = partition.Peers, partition.Hosts
+				}
+				if !containsHost(partition.Hosts, optAddr) {
+					err = fmt.Errorf("%v is not a replication of partition(%v) on the master, hosts(%v)", optAddr, partitionID, partition.Hosts)
+					return
+				}
+			}
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(optAddr, optProfPort), false)
+			if meta, err = dataClient.RebuildMetadata(dir, optVolume, peers, hosts, optForce); err != nil {
+				return
+			}
+			stdout("Rebuilt metadata of partition(%v) on %v: volume(%v) size(%v) peers(%v) hosts(%v)\n",
+				meta.PartitionID, optAddr, meta.VolumeID, meta.PartitionSize, meta.Peers, meta.Hosts)
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().StringVar(&optAddr, CliFlagAddress, "", "Address of the data node holding the directory")
+	cmd.Flags().StringVar(&optVolume, CliFlagVolume, "", "Volume of the partition, fetched from the master if not given")
+	cmd.Flags().StringVar(&optPeers, CliFlagPeers, "", "Peers of the partition in the format ID:HOST:PORT,..., fetched from the master if not given")
+	cmd.Flags().BoolVar(&optForce, CliFlagForce, false, "Overwrite a valid metadata")
+	return cmd
+}
+
+func newDataPartitionMoveDiskCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort uint16
+		optAddr     string
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpMoveDisk + " [DATA PARTITION ID] [TARGET DISK PATH]",
+		Short: cmdDataPartitionMoveDiskShort,
+		Long: `Move the replication on the data node of the given address to another disk of the node. The replication
+is stopped, copied to the target disk and verified, and then loaded from the target disk, which takes as long as
+copying the partition. The replication is not served meanwhile, and the requests to it fail to be retried.`,
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+				result    *api.PartitionMoveResult
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			if optAddr == "" {
+				err = fmt.Errorf("--%v of the data node holding the replication is required", CliFlagAddress)
+				return
+			}
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			if !containsHost(partition.Hosts, optAddr) {
+				err = fmt.Errorf("%v is not a replication of partition(%v) on the master, hosts(%v)", optAddr, partitionID, partition.Hosts)
+				return
+			}
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(optAddr, optProfPort), false)
+			if result, err = dataClient.MovePartitionToDisk(partitionID, path.Clean(args[1])); err != nil {
+				return
+			}
+			stdout("%v\n", formatPartitionMoveResult(optAddr, result))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().StringVar(&optAddr, CliFlagAddress, "", "Address of the data node holding the replication")
+	return cmd
+}
+
+func newDataPartitionExtentOwnersCmd(client *master.MasterClient) *cobra.Command {
+	var (
+		optProfPort uint16
+		optAddr     string
+		optJSON     bool
+	)
+	var cmd = &cobra.Command{
+		Use:   CliOpExtentOwners + " [DATA PARTITION ID] [EXTENT ID]...",
+		Short: cmdDataPartitionExtentOwnersShort,
+		Long: `Map the extents of a data partition, such as the ones reported corrupted by a scrub, back to the volume of
+the partition and the inodes the extents are created for. The replicas are asked in the order of the hosts until one
+answers, or only the one given by --addr. The inode is 0 for a tiny extent, which is shared by many files, and for
+an extent created before the data node recorded the inodes. Use --json to feed another tool.`,
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+				owners    *api.ExtentOwners
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			extentIDs := make([]uint64, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				for _, value := range strings.Split(arg, ",") {
+					if value = strings.TrimSpace(value); value == "" {
+						continue
+					}
+					var extentID uint64
+					if extentID, err = strconv.ParseUint(value, 10, 64); err != nil {
+						return
+					}
+					extentIDs = append(extentIDs, extentID)
+				}
+			}
+			hosts := []string{optAddr}
+			if optAddr == "" {
+				if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+					return
+				}
+				if len(partition.Hosts) == 0 {
+					err = fmt.Errorf("partition(%v) has no hosts", partitionID)
+					return
+				}
+				hosts = partition.Hosts
+			}
+			var addr string
+			for _, addr = range hosts {
+				dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+				if owners, err = dataClient.GetExtentOwners(partitionID, extentIDs); err == nil {
+					break
+				}
+				errout("Get the extent owners from %v fail: %v\n", addr, err)
+			}
+			if err != nil {
+				return
+			}
+			if optJSON {
+				var data []byte
+				if data, err = json.MarshalIndent(owners, "", "  "); err != nil {
+					return
+				}
+				stdout("%v\n", string(data))
+				return
+			}
+			stdout("%v\n", formatExtentOwners(addr, owners))
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	cmd.Flags().StringVar(&optAddr, CliFlagAddress, "", "Address of the data node to ask only")
+	cmd.Flags().BoolVar(&optJSON, CliFlagJSON, false, "Print the extent owners in json")
+	return cmd
+}
+
+func newDataPartitionVerifyAllCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
+	var cmd = &cobra.Command{
+		Use:   CliOpVerifyAll + " [DATA PARTITION ID]",
+		Short: cmdDataPartitionVerifyAllShort,
+		Long: `Collect the size and the crc of every extent from all the replicas of the partition, and report an extent
+missing on some replicas, or whose sizes or crcs differ across the replicas. The crc of an extent is computed by
+the data node a while after the last write, and the tiny extents have none, so the crcs are only compared among the
+replicas which have computed them. The extents being written show as the size mismatches, rerun the command to tell
+them from the real ones. Nothing is changed on the replicas, the command fails if any extent is not consistent or if
+any replica fails to report, which tells the replicas are not safe to lose redundancy yet.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err       error
+				partition *proto.DataPartitionInfo
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			partitionID, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return
+			}
+			if partition, err = client.AdminAPI().GetDataPartition("", partitionID); err != nil {
+				return
+			}
+			if len(partition.Hosts) == 0 {
+				err = fmt.Errorf("partition(%v) has no hosts", partitionID)
+				return
+			}
+			replicas := make(map[string][]*api.PartitionExtent)
+			for _, host := range partition.Hosts {
+				dataClient := api.NewDataHttpClient(dataNodeHttpAddr(host, optProfPort), false)
+				extents, extentsErr := dataClient.GetPartitionExtents(partitionID)
+				if extentsErr != nil {
+					err = fmt.Errorf("get the extents of partition(%v) on %v failed: %v", partitionID, host, extentsErr)
+					return
+				}
+				replicas[host] = extents
+			}
+			verdicts := verifyReplicaExtents(partition.Hosts, replicas)
+			stdout("%v\n", formatExtentVerdicts(partition.Hosts, verdicts))
+			if anomalies := countExtentAnomalies(verdicts); anomalies > 0 {
+				err = fmt.Errorf("%v of %v extents are not consistent across the replicas", anomalies, len(verdicts))
+			}
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	return cmd
+}
+
+// The verdicts of an extent compared across the replicas, an extent missing on some replicas is reported as
+// extentMissingOn followed by the replicas.
+const (
+	extentConsistent   = "consistent"
+	extentSizeMismatch = "size-mismatch"
+	extentCrcMismatch  = "crc-mismatch"
+	extentMissingOn    = "missing-on-"
+)
+
+// extentVerdict is the verdict of an extent, with the extent reported by each replica, nil if missing on it.
+type extentVerdict struct {
+	extentID    uint64
+	verdict     string
+	crcVerified bool // the crcs of at least two replicas are compared
+	replicas    map[string]*api.PartitionExtent
+}
+
+// Compare the extents of the replicas, sorted by the extent id. An extent missing on some replicas is not
+// compared further.
+func verifyReplicaExtents(hosts []string, replicas map[string][]*api.PartitionExtent) (verdicts []*extentVerdict) {
+	byID := make(map[uint64]*extentVerdict)
+	for host, extents := range replicas {
+		for _, extent := range extents {
+			v, ok := byID[extent.FileID]
+			if !ok {
+				v = &extentVerdict{extentID: extent.FileID, replicas: make(map[string]*api.PartitionExtent)}
+				byID[extent.FileID] = v
+			}
+			v.replicas[host] = extent
+		}
+	}
+	verdicts = make([]*extentVerdict, 0, len(byID))
+	for _, v := range byID {
+		v.verdict = judgeExtent(hosts, v)
+		verdicts = append(verdicts, v)
+	}
+	sort.Slice(verdicts, func(i, j int) bool { return verdicts[i].extentID < verdicts[j].extentID })
+	return
+}
+
+func judgeExtent(hosts []string, v *extentVerdict) string {
+	var missing []string
+	for _, host := range hosts {
+		if v.replicas[host] == nil {
+			missing = append(missing, host)
+		}
+	}
+	if len(missing) > 0 {
+		return extentMissingOn + strings.Join(missing, ",")
+	}
+	size := v.replicas[hosts[0]].Size
+	for _, host := range hosts[1:] {
+		if v.replicas[host].Size != size {
+			return extentSizeMismatch
+		}
+	}
+	var (
+		crc      uint32
+		computed int
+	)
+	for _, host := range hosts {
+		extent := v.replicas[host]
+		if extent.Crc == 0 {
+			continue
+		}
+		if computed > 0 && extent.Crc != crc {
+			return extentCrcMismatch
+		}
+		crc = extent.Crc
+		computed++
+	}
+	v.crcVerified = computed > 1
+	return extentConsistent
+}
+
+func countExtentAnomalies(verdicts []*extentVerdict) (anomalies int) {
+	for _, v := range verdicts {
+		if v.verdict != extentConsistent {
+			anomalies++
+		}
+	}
+	return
+}
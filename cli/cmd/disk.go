@@ -0,0 +1,78 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/chubaofs/chubaofs/cli/api"
+	"github.com/chubaofs/chubaofs/sdk/master"
+	"github.com/spf13/cobra"
+)
+
+const (
+	cmdDiskShort = "Manage disks of data nodes"
+)
+
+func newDiskCmd(client *master.MasterClient) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   CliResourceDisk,
+		Short: cmdDiskShort,
+	}
+	cmd.AddCommand(
+		newDiskStatusCmd(client),
+	)
+	return cmd
+}
+
+const (
+	cmdDiskStatusShort = "Show the partitions and the space of a disk on a data node"
+)
+
+func newDiskStatusCmd(client *master.MasterClient) *cobra.Command {
+	var optProfPort uint16
+	var cmd = &cobra.Command{
+		Use:     CliOpStatus + " [ADDRESS] [PATH]",
+		Short:   cmdDiskStatusShort,
+		Aliases: []string{"status"},
+		Args:    cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				err     error
+				summary *api.DiskSummary
+			)
+			defer func() {
+				if err != nil {
+					errout("Error: %v\n", err)
+					os.Exit(1)
+				}
+			}()
+			addr, diskPath := args[0], args[1]
+			dataClient := api.NewDataHttpClient(dataNodeHttpAddr(addr, optProfPort), false)
+			if summary, err = dataClient.GetDiskStatus(diskPath); err != nil {
+				return
+			}
+			stdout("%v\n", formatDiskSummary(addr, summary))
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return validDataNodes(client, toComplete), cobra.ShellCompDirectiveNoFileComp
+		},
+	}
+	cmd.Flags().Uint16Var(&optProfPort, CliFlagProfPort, defaultDataNodeProfPort, "Http port of the data nodes")
+	return cmd
+}
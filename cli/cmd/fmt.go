@@ -17,10 +17,12 @@ package cmd
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/chubaofs/chubaofs/cli/api"
 	"github.com/chubaofs/chubaofs/proto"
 )
 
@@ -203,6 +205,44 @@ func formatDataPartitionInfo(partition *proto.DataPartitionInfo) string {
 	return sb.String()
 }
 
+var partitionUptimeTableRowPattern = "%-22v    %-19v    %-19v    %-16v    %-8v"
+
+// Format the uptimes of the replicas of a partition, a high restart count points to a bad disk or a crash loop.
+func formatPartitionUptimes(hosts []string, uptimes map[string]*api.PartitionUptime, errs map[string]error) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("Uptime :\n"))
+	sb.WriteString(fmt.Sprintf(partitionUptimeTableRowPattern+"\n", "ADDRESS", "CREATE TIME", "LOAD TIME", "UPTIME", "RESTARTS"))
+	for _, host := range hosts {
+		if err, ok := errs[host]; ok {
+			sb.WriteString(fmt.Sprintf("%-22v    %v\n", host, err))
+			continue
+		}
+		uptime := uptimes[host]
+		sb.WriteString(fmt.Sprintf(partitionUptimeTableRowPattern+"\n", host, uptime.CreateTime, formatTime(uptime.LoadTime),
+			time.Duration(uptime.Uptime)*time.Second, uptime.RestartCount))
+	}
+	return sb.String()
+}
+
+var partitionReadOnlyTableRowPattern = "%-22v    %-9v    %-16v    %-19v    %-10v"
+
+// Format the manual read-only states of the replicas of a partition, with who and when changed them last.
+func formatPartitionReadOnlyStates(hosts []string, states map[string]*api.PartitionReadOnlyState, errs map[string]error) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("Manual read-only :\n"))
+	sb.WriteString(fmt.Sprintf(partitionReadOnlyTableRowPattern+"\n", "ADDRESS", "READ ONLY", "SET BY", "SET TIME", "STATUS"))
+	for _, host := range hosts {
+		if err, ok := errs[host]; ok {
+			sb.WriteString(fmt.Sprintf("%-22v    %v\n", host, err))
+			continue
+		}
+		state := states[host]
+		sb.WriteString(fmt.Sprintf(partitionReadOnlyTableRowPattern+"\n", host, state.ManualReadOnly, state.SetBy,
+			state.SetTime, formatDataPartitionStatus(int8(state.Status))))
+	}
+	return sb.String()
+}
+
 func formatMetaPartitionInfo(partition *proto.MetaPartitionInfo) string {
 	var sb = strings.Builder{}
 	sb.WriteString("\n")
@@ -356,6 +396,18 @@ func formatSize(size uint64) string {
 	return fmt.Sprintf("%v %v", fixedSize, units[fixedUnitIndex])
 }
 
+// Format the byte count as formatSize does if human is set, or as the raw bytes otherwise, which is kept
+// as the default for the scripts parsing the output. The count may be negative, e.g. the space overcommitted.
+func formatBytes(size int64, human bool) string {
+	if !human {
+		return strconv.FormatInt(size, 10)
+	}
+	if size < 0 {
+		return "-" + formatSize(uint64(-size))
+	}
+	return formatSize(uint64(size))
+}
+
 func formatTime(timeUnix int64) string {
 	return time.Unix(timeUnix, 0).Format("2006-01-02 15:04:05")
 }
@@ -473,3 +525,511 @@ func formatMetaNodeDetail(mn *proto.MetaNodeInfo, rowTable bool) string {
 	sb.WriteString(fmt.Sprintf("  Persist partitions  : %v\n", mn.PersistenceMetaPartitions))
 	return sb.String()
 }
+
+var repairSummaryTableRowPattern = "%-18v    %-8v    %-8v    %-10v    %v"
+
+func formatRepairSummaryTableHeader() string {
+	return fmt.Sprintf(repairSummaryTableRowPattern, "ADDRESS", "CREATE", "REPAIR", "BYTES", "EXTENTS")
+}
+
+func formatRepairSummaryTableRow(summary *api.RepairSummary) string {
+	extents := make([]string, 0, len(summary.ExtentsToBeRepaired))
+	for _, extentID := range summary.ExtentsToBeRepaired {
+		extents = append(extents, strconv.FormatUint(extentID, 10))
+	}
+	return fmt.Sprintf(repairSummaryTableRowPattern, summary.Addr, len(summary.ExtentsToBeCreated),
+		len(summary.ExtentsToBeRepaired), formatSize(summary.BytesToBeRepaired), strings.Join(extents, ","))
+}
+
+var fragmentationTableRowPattern = "%-18v    %-10v    %-10v    %-10v    %-12v    %-12v    %-10v"
+
+func formatFragmentationTableHeader() string {
+	return fmt.Sprintf(fragmentationTableRowPattern, "ADDRESS", "TINY", "TINY SIZE", "WASTED", "NORMAL", "NORMAL SIZE", "FILL RATIO")
+}
+
+func formatFragmentationTableRow(addr string, report *api.FragmentationReport) string {
+	return fmt.Sprintf(fragmentationTableRowPattern, addr, report.TinyExtentCount, formatSize(report.TinyExtentBytes),
+		formatSize(report.TinyWastedBytes), report.NormalExtentCount, formatSize(report.NormalExtentBytes),
+		fmt.Sprintf("%.2f%%", report.AvgFillRatio*100))
+}
+
+func formatRepairStats(stats *api.RepairStats) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  PartitionID         : %v\n", stats.ID))
+	sb.WriteString(fmt.Sprintf("  Job ID              : %v\n", stats.JobID))
+	sb.WriteString(fmt.Sprintf("  Repairing           : %v\n", formatYesNo(stats.Repairing)))
+	sb.WriteString(fmt.Sprintf("  Extents created     : %v\n", stats.ExtentsCreated))
+	sb.WriteString(fmt.Sprintf("  Extents repaired    : %v\n", stats.ExtentsRepaired))
+	sb.WriteString(fmt.Sprintf("  Bytes transferred   : %v\n", formatSize(stats.BytesTransferred)))
+	sb.WriteString(fmt.Sprintf("  Last repair cost    : %vms\n", stats.LastRepairDuration))
+	sb.WriteString(fmt.Sprintf("  Read repairs        : %v\n", stats.ReadRepairs))
+	sb.WriteString(fmt.Sprintf("  Tiny repair batch   : %v\n", stats.TinyRepairBatch))
+	sb.WriteString(fmt.Sprintf("  No source extents   : %v\n", stats.NoSourceExtents))
+	return sb.String()
+}
+
+var partitionSpaceTableRowPattern = "%-18v    %-16v    %-16v    %-16v"
+
+func formatPartitionSpaceTableHeader() string {
+	return fmt.Sprintf(partitionSpaceTableRowPattern, "ADDRESS", "SIZE", "USED", "AVAILABLE")
+}
+
+func formatPartitionSpaceTableRow(addr string, space *api.PartitionSpace, human bool) string {
+	return fmt.Sprintf(partitionSpaceTableRowPattern, addr, formatBytes(int64(space.Size), human),
+		formatBytes(int64(space.Used), human), formatBytes(space.Available, human))
+}
+
+var raftProgressTableRowPattern = "%-18v    %-12v    %-12v    %-10v    %-14v"
+
+func formatRaftProgressTableHeader() string {
+	return fmt.Sprintf(raftProgressTableRowPattern, "ADDRESS", "APPLIED", "COMMITTED", "LAG", "LAST TRUNCATE")
+}
+
+func formatRaftProgressTableRow(addr string, progress *api.RaftProgress) string {
+	return fmt.Sprintf(raftProgressTableRowPattern, addr, progress.AppliedID, progress.CommittedID, progress.Lag, progress.LastTruncateID)
+}
+
+var raftLagTableRowPattern = "%-18v    %-8v    %-12v    %-12v    %-10v    %-10v    %v"
+
+func formatRaftLag(replicas []*raftLagReplica, leader, laggiest *raftLagReplica) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf(raftLagTableRowPattern, "ADDRESS", "ROLE", "APPLIED", "COMMITTED", "LAG", "BEHIND", ""))
+	for _, replica := range replicas {
+		sb.WriteString("\n")
+		if replica.err != nil {
+			sb.WriteString(fmt.Sprintf(raftLagTableRowPattern, replica.addr, "-", "-", "-", "-", "-", replica.err))
+			continue
+		}
+		role, behind, mark := "follower", fmt.Sprintf("%v", replica.behind), ""
+		if replica == leader {
+			role, behind = "LEADER", "-"
+		} else if leader == nil {
+			behind = "-"
+		}
+		if replica == laggiest && replica.behind > 0 {
+			mark = "<- laggiest"
+		}
+		sb.WriteString(fmt.Sprintf(raftLagTableRowPattern, replica.addr, role, replica.progress.AppliedID,
+			replica.progress.CommittedID, replica.progress.Lag, behind, mark))
+	}
+	sb.WriteString("\n")
+	switch {
+	case leader == nil:
+		sb.WriteString("No replica reports itself the leader, the lag behind the leader is unknown")
+	case laggiest == nil:
+		sb.WriteString(fmt.Sprintf("Leader %v has no follower reporting", leader.addr))
+	case laggiest.behind == 0:
+		sb.WriteString(fmt.Sprintf("All the followers have applied the logs committed by leader %v", leader.addr))
+	default:
+		sb.WriteString(fmt.Sprintf("Laggiest follower %v is %v logs behind leader %v", laggiest.addr, laggiest.behind, leader.addr))
+	}
+	return sb.String()
+}
+
+var raftLeaderTableRowPattern = "%-18v    %-12v    %-18v    %-8v    %-6v"
+
+func formatRaftLeaderTableHeader() string {
+	return fmt.Sprintf(raftLeaderTableRowPattern, "ADDRESS", "LEADER ID", "LEADER", "TERM", "SELF")
+}
+
+func formatRaftLeaderTableRow(addr string, leader *api.RaftLeader) string {
+	return fmt.Sprintf(raftLeaderTableRowPattern, addr, leader.LeaderID, leader.LeaderAddr, leader.Term, formatYesNo(leader.IsLeader))
+}
+
+func formatRaftLeaderConflicts(views map[string][]string, claimants []string) string {
+	var sb = strings.Builder{}
+	if len(views) <= 1 && len(claimants) <= 1 {
+		for view := range views {
+			sb.WriteString(fmt.Sprintf("All the replicas agree on the leader: %v", view))
+		}
+		return sb.String()
+	}
+	sb.WriteString("CONFLICT: the replicas disagree about the leader\n")
+	keys := make([]string, 0, len(views))
+	for view := range views {
+		keys = append(keys, view)
+	}
+	sort.Strings(keys)
+	for _, view := range keys {
+		sb.WriteString(fmt.Sprintf("  %v seen by %v\n", view, strings.Join(views[view], ", ")))
+	}
+	if len(claimants) > 1 {
+		sb.WriteString(fmt.Sprintf("  %v replicas claim to be the leader: %v\n", len(claimants), strings.Join(claimants, ", ")))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func formatMetadataDiffs(hosts []string, diffs []*metadataFieldDiff) string {
+	var sb = strings.Builder{}
+	divergent := 0
+	for _, diff := range diffs {
+		if !diff.divergent {
+			if len(hosts) > 0 {
+				sb.WriteString(fmt.Sprintf("  %-14v: %v\n", diff.name, diff.values[hosts[0]]))
+			}
+			continue
+		}
+		divergent++
+		sb.WriteString(fmt.Sprintf("* %-14v: DIVERGENT\n", diff.name))
+		for _, host := range hosts {
+			sb.WriteString(fmt.Sprintf("    %-20v: %v\n", host, diff.values[host]))
+		}
+	}
+	if divergent == 0 {
+		sb.WriteString(fmt.Sprintf("The metadata of all the %v replicas agree", len(hosts)))
+	} else {
+		sb.WriteString(fmt.Sprintf("CONFLICT: %v fields diverge across the replicas", divergent))
+	}
+	return sb.String()
+}
+
+func formatSnapshotDiff(addr string, diff *api.SnapshotDiff) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Local                : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Peer                 : %v\n", diff.PeerAddr))
+	sb.WriteString(fmt.Sprintf("  Missing locally      : %v\n", diff.MissingLocally))
+	sb.WriteString(fmt.Sprintf("  Extra locally        : %v\n", diff.ExtraLocally))
+	sb.WriteString(fmt.Sprintf("  Size mismatched      : %v\n", len(diff.SizeMismatched)))
+	for _, extent := range diff.SizeMismatched {
+		sb.WriteString(fmt.Sprintf("    extent(%v) local size(%v) peer size(%v)\n", extent.ExtentID, extent.LocalSize, extent.PeerSize))
+	}
+	return sb.String()
+}
+
+var snapshotFileTableRowPattern = "%-12v    %-12v    %-12v    %-20v"
+
+// Format the extents in the snapshot sorted by the extent id, the size is in bytes so that it can be
+// compared with the one in the repair logs.
+func formatSnapshotFiles(addr string, files []*proto.File) string {
+	sort.Slice(files, func(i, j int) bool {
+		idI, _ := strconv.ParseUint(files[i].Name, 10, 64)
+		idJ, _ := strconv.ParseUint(files[j].Name, 10, 64)
+		return idI < idJ
+	})
+	var (
+		sb        = strings.Builder{}
+		totalSize uint64
+	)
+	sb.WriteString(fmt.Sprintf("  Address              : %v\n", addr))
+	sb.WriteString(fmt.Sprintf(snapshotFileTableRowPattern+"\n", "EXTENT", "SIZE", "CRC", "MODIFIED"))
+	for _, file := range files {
+		totalSize += uint64(file.Size)
+		sb.WriteString(fmt.Sprintf(snapshotFileTableRowPattern+"\n", file.Name, file.Size, file.Crc,
+			formatTime(file.Modified)))
+	}
+	sb.WriteString(fmt.Sprintf("  Extents              : %v\n", len(files)))
+	sb.WriteString(fmt.Sprintf("  Total size           : %v (%v)", totalSize, formatSize(totalSize)))
+	return sb.String()
+}
+
+var partitionRepairStatusTableRowPattern = "%-8v    %-20v    %-8v    %-9v    %-11v    %-17v    %-15v    %-7v    %-6v    %-19v"
+
+func formatPartitionRepairStatuses(addr string, statuses []*api.PartitionRepairStatus) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Partitions           : %v\n", len(statuses)))
+	if len(statuses) == 0 {
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf(partitionRepairStatusTableRowPattern+"\n", "ID", "VOLUME", "LEADER", "REPAIRING",
+		"BROKEN TINY", "MISMATCHED NORMAL", "MISMATCHED TINY", "PENDING", "QUEUED", "LAST CHECK"))
+	for _, status := range statuses {
+		sb.WriteString(fmt.Sprintf(partitionRepairStatusTableRowPattern+"\n", status.ID, status.VolName, status.IsLeader,
+			status.Repairing, status.BrokenTinyExtents, status.MismatchedNormalExtents, status.MismatchedTinyExtents,
+			status.PendingExtents, status.QueuedExtents, formatTime(status.LastCheckTime)))
+	}
+	return sb.String()
+}
+
+var partitionGrowthTableRowPattern = "%-8v    %-20v    %-12v    %-12v    %-12v    %-16v"
+
+func formatPartitionsGrowth(addr string, growths []*api.PartitionGrowth) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Partitions           : %v\n", len(growths)))
+	if len(growths) == 0 {
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf(partitionGrowthTableRowPattern+"\n", "ID", "VOLUME", "USED", "SIZE", "RATE", "TIME TO FULL"))
+	for _, growth := range growths {
+		timeToFull := "-"
+		if growth.TimeToFull >= 0 {
+			timeToFull = (time.Duration(growth.TimeToFull) * time.Second).String()
+		}
+		var rate uint64
+		if growth.Rate > 0 {
+			rate = uint64(growth.Rate)
+		}
+		sb.WriteString(fmt.Sprintf(partitionGrowthTableRowPattern+"\n", growth.ID, growth.VolName,
+			formatSize(uint64(growth.Used)), formatSize(uint64(growth.Size)), formatSize(rate)+"/s", timeToFull))
+	}
+	return sb.String()
+}
+
+var topExtentTableRowPattern = "%-10v    %-6v    %-12v    %v"
+
+func formatTopExtents(addr string, top *api.TopExtents) string {
+	var topSize int64
+	for _, extent := range top.Extents {
+		topSize += extent.Size
+	}
+	var share float64
+	if top.TotalSize > 0 {
+		share = float64(topSize) / float64(top.TotalSize) * 100
+	}
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Extents              : %v\n", top.ExtentCount))
+	sb.WriteString(fmt.Sprintf("  Total size           : %v\n", formatSize(uint64(top.TotalSize))))
+	sb.WriteString(fmt.Sprintf("  Top %-4v share       : %.2f%%\n", len(top.Extents), share))
+	if len(top.Extents) == 0 {
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf(topExtentTableRowPattern+"\n", "EXTENT", "TYPE", "SIZE", "SHARE"))
+	for _, extent := range top.Extents {
+		extentType := "normal"
+		if extent.IsTiny {
+			extentType = "tiny"
+		}
+		var extentShare float64
+		if top.TotalSize > 0 {
+			extentShare = float64(extent.Size) / float64(top.TotalSize) * 100
+		}
+		sb.WriteString(fmt.Sprintf(topExtentTableRowPattern+"\n", extent.ExtentID, extentType,
+			formatSize(uint64(extent.Size)), fmt.Sprintf("%.2f%%", extentShare)))
+	}
+	return sb.String()
+}
+
+var coldExtentTableRowPattern = "%-10v    %-12v    %-19v    %v"
+
+func formatColdExtents(addr string, cold *api.ColdExtents) string {
+	var totalSize uint64
+	for _, extent := range cold.Extents {
+		totalSize += extent.Size
+	}
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Not read within      : %v\n", time.Duration(cold.OlderThan)*time.Second))
+	sb.WriteString(fmt.Sprintf("  Tracking since       : %v\n", formatTime(cold.TrackingSince)))
+	sb.WriteString(fmt.Sprintf("  Cold extents         : %v\n", len(cold.Extents)))
+	sb.WriteString(fmt.Sprintf("  Cold size            : %v\n", formatSize(totalSize)))
+	if len(cold.Extents) == 0 {
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf(coldExtentTableRowPattern+"\n", "EXTENT", "SIZE", "CREATED", "LAST READ"))
+	for _, extent := range cold.Extents {
+		lastAccess := "never"
+		if extent.LastAccess > 0 {
+			lastAccess = formatTime(extent.LastAccess)
+		}
+		sb.WriteString(fmt.Sprintf(coldExtentTableRowPattern+"\n", extent.ExtentID, formatSize(extent.Size),
+			formatTime(extent.CreateTime), lastAccess))
+	}
+	return sb.String()
+}
+
+var selectedPartitionResultTableRowPattern = "%-8v    %-7v    %v"
+
+func formatSelectedPartitionResults(results []*selectedPartitionResult) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf(selectedPartitionResultTableRowPattern+"\n", "ID", "RESULT", "DETAIL"))
+	for _, r := range results {
+		if r.err != nil {
+			sb.WriteString(fmt.Sprintf(selectedPartitionResultTableRowPattern+"\n", r.partitionID, "FAILED", r.err))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf(selectedPartitionResultTableRowPattern+"\n", r.partitionID, "OK", r.result))
+	}
+	return sb.String()
+}
+
+var activeRepairTableRowPattern = "%-10v    %-22v    %-12v    %-12v    %-19v"
+
+func formatActiveRepairs(addr string, repairs []*api.ActiveRepair) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Active repairs       : %v\n", len(repairs)))
+	if len(repairs) == 0 {
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf(activeRepairTableRowPattern+"\n", "EXTENT", "SOURCE", "SIZE", "TRANSFERRED", "START TIME"))
+	for _, repair := range repairs {
+		sb.WriteString(fmt.Sprintf(activeRepairTableRowPattern+"\n", repair.ExtentID, repair.Source,
+			formatSize(repair.Size), formatSize(repair.BytesTransferred), formatTime(repair.StartTime)))
+	}
+	return sb.String()
+}
+
+func formatFlushResult(addr string, result *api.FlushResult) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Flushed              : %v\n", result.Flushed))
+	sb.WriteString(fmt.Sprintf("  Failed               : %v\n", len(result.Failed)))
+	ids := make([]uint64, 0, len(result.Failed))
+	for id := range result.Failed {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		sb.WriteString(fmt.Sprintf("    partition(%v) %v\n", id, result.Failed[id]))
+	}
+	sb.WriteString(fmt.Sprintf("  Cost                 : %vms", result.Duration))
+	return sb.String()
+}
+
+func formatLeaderTransferResult(addr string, result *api.LeaderTransferResult) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Transferred          : %v\n", result.Transferred))
+	sb.WriteString(fmt.Sprintf("  Failed               : %v\n", result.Failed))
+	sb.WriteString(fmt.Sprintf("  Cost                 : %vms", result.Duration))
+	if len(result.Transfers) == 0 {
+		return sb.String()
+	}
+	sb.WriteString("\n")
+	sb.WriteString(fmt.Sprintf(leaderTransferTableRowPattern, "PARTITION", "TARGET", "RESULT", "COST"))
+	for _, transfer := range result.Transfers {
+		target := "-"
+		if transfer.TargetID != 0 {
+			target = fmt.Sprintf("%v(%v)", transfer.TargetAddr, transfer.TargetID)
+		}
+		outcome := "transferred"
+		if !transfer.Transferred {
+			outcome = "failed: " + transfer.Err
+		}
+		sb.WriteString("\n")
+		sb.WriteString(fmt.Sprintf(leaderTransferTableRowPattern, transfer.PartitionID, target, outcome,
+			fmt.Sprintf("%vms", transfer.Duration)))
+	}
+	return sb.String()
+}
+
+var leaderTransferTableRowPattern = "%-10v    %-26v    %-12v    %v"
+
+func formatPartitionFreezeState(addr string, state *api.PartitionFreezeState) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Partition            : %v\n", state.ID))
+	sb.WriteString(fmt.Sprintf("  Frozen               : %v\n", state.Frozen))
+	if state.Frozen {
+		sb.WriteString(fmt.Sprintf("  Reason               : %v\n", state.Reason))
+	}
+	sb.WriteString(fmt.Sprintf("  Status               : %v", formatDataPartitionStatus(int8(state.Status))))
+	return sb.String()
+}
+
+func formatPartitionMoveResult(addr string, result *api.PartitionMoveResult) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Partition            : %v\n", result.PartitionID))
+	sb.WriteString(fmt.Sprintf("  Source               : %v\n", result.SourcePath))
+	sb.WriteString(fmt.Sprintf("  Target               : %v\n", result.TargetPath))
+	sb.WriteString(fmt.Sprintf("  Files                : %v\n", result.Files))
+	sb.WriteString(fmt.Sprintf("  Size                 : %v\n", formatSize(uint64(result.Bytes))))
+	sb.WriteString(fmt.Sprintf("  Not served for       : %v", time.Duration(result.Cost)*time.Millisecond))
+	return sb.String()
+}
+
+func formatDiskSummary(addr string, summary *api.DiskSummary) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Path                 : %v\n", summary.Path))
+	sb.WriteString(fmt.Sprintf("  Status               : %v\n", formatDataPartitionStatus(int8(summary.Status))))
+	sb.WriteString(fmt.Sprintf("  Total                : %v\n", formatSize(summary.Total)))
+	sb.WriteString(fmt.Sprintf("  Available            : %v\n", formatSize(summary.Available)))
+	sb.WriteString(fmt.Sprintf("  Partitions           : %v\n", summary.PartitionCount))
+	sb.WriteString(fmt.Sprintf("  Read only partitions : %v\n", summary.ReadOnlyCount))
+	sb.WriteString(fmt.Sprintf("  Unavailable          : %v\n", summary.UnavailableCount))
+	sb.WriteString(fmt.Sprintf("  Partitions allocated : %v\n", formatSize(summary.PartitionsAllocated)))
+	sb.WriteString(fmt.Sprintf("  Partitions used      : %v", formatSize(summary.PartitionsUsed)))
+	return sb.String()
+}
+
+func formatRaftState(addr string, state *api.RaftState) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Verdict              : %v\n", state.Verdict))
+	sb.WriteString(fmt.Sprintf("  Persisted applied    : %v\n", state.PersistedAppliedID))
+	sb.WriteString(fmt.Sprintf("  Applied              : %v\n", state.AppliedID))
+	sb.WriteString(fmt.Sprintf("  Raft applied         : %v\n", state.RaftAppliedID))
+	sb.WriteString(fmt.Sprintf("  Committed            : %v\n", state.CommittedID))
+	sb.WriteString(fmt.Sprintf("  Last index           : %v\n", state.LastIndex))
+	sb.WriteString(fmt.Sprintf("  Last truncate        : %v\n", state.LastTruncateID))
+	for _, problem := range state.Problems {
+		sb.WriteString(fmt.Sprintf("  Problem              : %v\n", problem))
+	}
+	return sb.String()
+}
+
+var extentOwnerTableRowPattern = "%-10v    %-6v    %-7v    %-12v    %v"
+
+func formatExtentOwners(addr string, owners *api.ExtentOwners) string {
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Data node            : %v\n", addr))
+	sb.WriteString(fmt.Sprintf("  Partition            : %v\n", owners.PartitionID))
+	sb.WriteString(fmt.Sprintf("  Volume               : %v\n", owners.VolName))
+	sb.WriteString(fmt.Sprintf(extentOwnerTableRowPattern+"\n", "EXTENT", "TYPE", "EXISTS", "SIZE", "INODE"))
+	for _, extent := range owners.Extents {
+		extentType := "normal"
+		if extent.IsTiny {
+			extentType = "tiny"
+		}
+		size, inode := "-", "-"
+		if extent.Exists {
+			size = formatSize(extent.Size)
+			if extent.Inode != 0 {
+				inode = strconv.FormatUint(extent.Inode, 10)
+			} else if !extent.IsTiny {
+				inode = "unknown"
+			}
+		}
+		sb.WriteString(fmt.Sprintf(extentOwnerTableRowPattern+"\n", extent.ExtentID, extentType, extent.Exists, size, inode))
+	}
+	return sb.String()
+}
+
+// Format the summary of the verdicts and the extents not consistent, with the size and the crc on each replica.
+func formatExtentVerdicts(hosts []string, verdicts []*extentVerdict) string {
+	var consistent, crcVerified, sizeMismatch, crcMismatch, missing int
+	for _, v := range verdicts {
+		switch {
+		case v.verdict == extentConsistent:
+			consistent++
+			if v.crcVerified {
+				crcVerified++
+			}
+		case v.verdict == extentSizeMismatch:
+			sizeMismatch++
+		case v.verdict == extentCrcMismatch:
+			crcMismatch++
+		default:
+			missing++
+		}
+	}
+	var sb = strings.Builder{}
+	sb.WriteString(fmt.Sprintf("  Replicas             : %v\n", strings.Join(hosts, ", ")))
+	sb.WriteString(fmt.Sprintf("  Extents              : %v\n", len(verdicts)))
+	sb.WriteString(fmt.Sprintf("  Consistent           : %v\n", consistent))
+	sb.WriteString(fmt.Sprintf("  Crc verified         : %v\n", crcVerified))
+	sb.WriteString(fmt.Sprintf("  Size mismatched      : %v\n", sizeMismatch))
+	sb.WriteString(fmt.Sprintf("  Crc mismatched       : %v\n", crcMismatch))
+	sb.WriteString(fmt.Sprintf("  Missing on replicas  : %v", missing))
+	if consistent == len(verdicts) {
+		return sb.String()
+	}
+	sb.WriteString("\n")
+	sb.WriteString(fmt.Sprintf("%-10v    %v\n", "EXTENT", "VERDICT"))
+	for _, v := range verdicts {
+		if v.verdict == extentConsistent {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%-10v    %v\n", v.extentID, v.verdict))
+		for _, host := range hosts {
+			if extent := v.replicas[host]; extent != nil {
+				sb.WriteString(fmt.Sprintf("    %-20v: size(%v) crc(%v)\n", host, extent.Size, extent.Crc))
+			}
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
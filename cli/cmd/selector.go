@@ -0,0 +1,131 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/sdk/master"
+	"github.com/spf13/cobra"
+)
+
+// dataPartitionSelector selects the data partitions of a volume by their status, so that a command working
+// on a partition can be applied to all the matching ones at once.
+type dataPartitionSelector struct {
+	volume string
+	status string
+	dryRun bool
+	yes    bool
+}
+
+// The result of an operation applied to a selected partition.
+type selectedPartitionResult struct {
+	partitionID uint64
+	result      string
+	err         error
+}
+
+func (s *dataPartitionSelector) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&s.volume, CliFlagVolume, "", "Apply to the data partitions of the volume instead of the given one")
+	cmd.Flags().StringVar(&s.status, CliFlagStatus, "", "Select the data partitions of the status [readonly, writable, unavailable]")
+	cmd.Flags().BoolVar(&s.dryRun, CliFlagDryRun, false, "List the selected data partitions without applying to them")
+	cmd.Flags().BoolVarP(&s.yes, CliFlagYes, "y", false, "Answer yes for all questions")
+}
+
+func (s *dataPartitionSelector) selected() bool {
+	return s.volume != ""
+}
+
+func parseDataPartitionStatus(status string) (value int8, err error) {
+	switch strings.ToLower(status) {
+	case "readonly", "read-only":
+		value = proto.ReadOnly
+	case "writable", "readwrite", "read-write":
+		value = proto.ReadWrite
+	case "unavailable":
+		value = proto.Unavailable
+	default:
+		err = fmt.Errorf("unknown status %v, expected one of [readonly, writable, unavailable]", status)
+	}
+	return
+}
+
+// Resolve the selected partitions by the master, sorted by the partition id.
+func (s *dataPartitionSelector) resolve(client *master.MasterClient) (partitions []*proto.DataPartitionResponse, err error) {
+	var status int8
+	if s.status != "" {
+		if status, err = parseDataPartitionStatus(s.status); err != nil {
+			return
+		}
+	}
+	var view *proto.DataPartitionsView
+	if view, err = client.ClientAPI().GetDataPartitions(s.volume); err != nil {
+		return
+	}
+	partitions = make([]*proto.DataPartitionResponse, 0, len(view.DataPartitions))
+	for _, partition := range view.DataPartitions {
+		if s.status == "" || partition.Status == status {
+			partitions = append(partitions, partition)
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].PartitionID < partitions[j].PartitionID
+	})
+	return
+}
+
+// Apply the operation to each of the selected partitions after the confirmation, and report the result of
+// each one. The partitions failed do not stop the others, an error is returned if any of them failed.
+func (s *dataPartitionSelector) apply(client *master.MasterClient, opName string,
+	op func(partitionID uint64) (result string, err error)) (err error) {
+	var partitions []*proto.DataPartitionResponse
+	if partitions, err = s.resolve(client); err != nil {
+		return
+	}
+	stdout("%v data partitions of volume %v selected to %v:\n", len(partitions), s.volume, opName)
+	stdout("%v\n", dataPartitionTableHeader)
+	for _, partition := range partitions {
+		stdout("%v\n", formatDataPartitionTableRow(partition))
+	}
+	if s.dryRun || len(partitions) == 0 {
+		return
+	}
+	if !s.yes {
+		stdout("\nConfirm (yes/no)[no]: ")
+		var userConfirm string
+		_, _ = fmt.Scanln(&userConfirm)
+		if userConfirm != "yes" {
+			stdout("Abort by user.\n")
+			return
+		}
+	}
+	results := make([]*selectedPartitionResult, 0, len(partitions))
+	var failed int
+	for _, partition := range partitions {
+		r := &selectedPartitionResult{partitionID: partition.PartitionID}
+		if r.result, r.err = op(partition.PartitionID); r.err != nil {
+			failed++
+		}
+		results = append(results, r)
+	}
+	stdout("\n%v", formatSelectedPartitionResults(results))
+	if failed > 0 {
+		err = fmt.Errorf("%v of %v data partitions failed to %v", failed, len(partitions), opName)
+	}
+	return
+}
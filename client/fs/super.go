@@ -85,6 +85,7 @@ func NewSuper(opt *proto.MountOptions) (s *Super, err error) {
 		FollowerRead:      opt.FollowerRead,
 		ReadRate:          opt.ReadRate,
 		WriteRate:         opt.WriteRate,
+		TinySize:          opt.TinySize,
 		OnAppendExtentKey: s.mw.AppendExtentKey,
 		OnGetExtents:      s.mw.GetExtents,
 		OnTruncate:        s.mw.Truncate,
@@ -14,10 +14,65 @@
 
 package datanode
 
+import "time"
+
+const (
+	IntervalToUpdateReplica          = 600 // interval to update the replica
+	IntervalToUpdatePartitionSize    = 60  // interval to update the partition size
+	NumOfFilesToRecoverInParallel    = 17   // number of files to be recovered simultaneously
+	MaxNumOfFilesToRecoverInParallel = 256  // max number of files to be recovered simultaneously
+	ManualRepairWaitTime             = 10   // seconds to wait for a manual repair before replying the job id
+	UsageReconcileInterval           = 3600 // seconds between two reconciliations of the running used space
+)
+
+// Write latency histogram
+const (
+	DefaultLatencyWindow = 300 // seconds
+	MinLatencyWindow     = 60  // seconds, the window is checked by the status ticker every minute
+)
+
+// Idle partitions
+const (
+	IdleMetricsIntervals = 3  // status intervals without any read or write before a partition is idle
+	IdleMetricsBackoff   = 10 // the metrics of an idle partition are reported once every so many status intervals
+)
+
+// Repair bandwidth
+const (
+	RepairBandwidthBurst = 128 * 1024 // max bytes of a repair read from the peer at once
+)
+
+// Tickers of the partition
+const (
+	DefaultStatusInterval   = time.Minute     // interval to update the status and launch the repair
+	DefaultSnapshotInterval = 5 * time.Minute // interval to reload the snapshot
+)
+
+// Drain
+const (
+	DefaultDrainTimeout = 30 * time.Second // max time to wait for the repairs on shutdown
+	DeleteFlushTimeout  = 10 * time.Second // max time to wait for the delete records to be synced on stop
+)
+
+// Soft limit of the used space
+const (
+	DefaultNearFullRatio = 0.9 // fraction of the partition size above which the partition is near full
+)
+
+// Persistence of the applied id
+const (
+	StoreAppliedIDInterval   = 10 * time.Second // interval to persist the applied id into the APPLY file
+	ApplyIDPersistStaleAfter = 6 * StoreAppliedIDInterval
+)
+
+// Space reserved on the creation of a partition
+const (
+	DefaultCreateReserveRatio = 0.05 // fraction of the disk kept free beyond the size of a new partition
+)
+
+// Status change event
 const (
-	IntervalToUpdateReplica       = 600 // interval to update the replica
-	IntervalToUpdatePartitionSize = 60  // interval to update the partition size
-	NumOfFilesToRecoverInParallel = 17  // number of files to be recovered simultaneously
+	StatusChangeEventBufferSize = 64 // events exceed the buffer are dropped
 )
 
 // Network protocol
@@ -65,7 +120,8 @@ const (
 
 // Apply the raft log operation. Currently we only have the random write operation.
 const (
-	MinTinyExtentsToRepair = 10 // minimum number of tiny extents to repair
+	MinTinyExtentsToRepair        = 10 // minimum number of tiny extents to repair
+	DefaultMaxTinyExtentsToRepair = 64 // default cap of the tiny extents to repair in a cycle, all of them
 )
 
 // Tiny extent has been put back to store
@@ -73,7 +129,8 @@ const (
 	IsReleased = 1
 )
 
-// Sector size
+// Sector size, which is the unit of the blocks counted by stat. Linux always counts them in 512 bytes,
+// even on the 4K native disks, so it is the only sector size a disk may be configured with.
 const (
 	DiskSectorSize = 512
 )
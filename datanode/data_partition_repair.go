@@ -15,9 +15,11 @@
 package datanode
 
 import (
+	"context"
 	"encoding/json"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"encoding/binary"
@@ -27,6 +29,7 @@ import (
 	"github.com/chubaofs/chubaofs/storage"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/log"
+	"hash"
 	"hash/crc32"
 )
 
@@ -39,6 +42,33 @@ type DataPartitionRepairTask struct {
 	ExtentsToBeRepaired            []*storage.ExtentInfo
 	LeaderTinyDeleteRecordFileSize int64
 	LeaderAddr                     string
+	DryRun                         bool              // only plan the repair, do not create or fix any extent
+	TraceContext                   map[string]string `json:",omitempty"` // span context of the cycle of the leader, see RepairTracer
+}
+
+// RepairSummary describes the operations a repair task is going to perform.
+type RepairSummary struct {
+	Addr                string   `json:"addr"`
+	ExtentsToBeCreated  []uint64 `json:"extentsToBeCreated"`
+	ExtentsToBeRepaired []uint64 `json:"extentsToBeRepaired"`
+	BytesToBeRepaired   uint64   `json:"bytesToBeRepaired"`
+	ExtentsCompleted    int      `json:"extentsCompleted"`
+	ExtentsCanceled     int      `json:"extentsCanceled"`
+}
+
+// repairProgress counts the extents fixed by a repair task, and the ones left by the cancellation.
+type repairProgress struct {
+	completed int32
+	canceled  int32
+	bytes     uint64 // transferred by the extents fixed or not
+}
+
+// RepairStats records what the latest repair cycle of a data partition has done.
+type RepairStats struct {
+	ExtentsCreated     uint64
+	ExtentsRepaired    uint64
+	BytesTransferred   uint64
+	LastRepairDuration time.Duration
 }
 
 func NewDataPartitionRepairTask(extentFiles []*storage.ExtentInfo, tinyDeleteRecordFileSize int64, source, leaderAddr string) (task *DataPartitionRepairTask) {
@@ -73,11 +103,7 @@ func NewDataPartitionRepairTask(extentFiles []*storage.ExtentInfo, tinyDeleteRec
 // - for each extent, we compare all the replicas to find the one with the largest size.
 // - periodically check the size of the local extent, and if it is smaller than the largest size,
 //   add it to the tobeRepaired list, and generate the corresponding tasks.
-func (dp *DataPartition) repair(extentType uint8) {
-	start := time.Now().UnixNano()
-	log.LogInfof("action[repair] partition(%v) start.",
-		dp.partitionID)
-
+func (dp *DataPartition) repair(traceCtx context.Context, extentType uint8) {
 	var tinyExtents []uint64 // unsvailable extents 小文件写
 	if extentType == proto.TinyExtentType {
 		tinyExtents = dp.brokenTinyExtents()
@@ -85,9 +111,21 @@ func (dp *DataPartition) repair(extentType uint8) {
 			return
 		}
 	}
+	dp.repairExtents(traceCtx, extentType, tinyExtents)
+	if extentType == proto.TinyExtentType {
+		dp.adaptTinyRepairBatch()
+	}
+}
 
-	repairTasks := make([]*DataPartitionRepairTask, dp.getReplicaLen())
-	err := dp.buildDataPartitionRepairTask(repairTasks, extentType, tinyExtents)
+// Repair the extents of the given type, only the given tiny extents are repaired if the type is tiny.
+// The tiny extents are sent back to the available or the broken channel after the repair. The span context of
+// traceCtx is carried to the followers.
+func (dp *DataPartition) repairExtents(traceCtx context.Context, extentType uint8, tinyExtents []uint64) {
+	start := time.Now().UnixNano()
+	log.LogInfof("action[repair] partition(%v) start.",
+		dp.partitionID)
+
+	repairTasks, err := dp.buildDataPartitionRepairTask(extentType, tinyExtents)
 
 	if err != nil {
 		log.LogErrorf(errors.Stack(err))
@@ -99,9 +137,10 @@ func (dp *DataPartition) repair(extentType uint8) {
 
 	// compare all the extents in the replicas to compute the good and bad ones
 	availableTinyExtents, brokenTinyExtents := dp.prepareRepairTasks(repairTasks)
+	dp.recordRepairCycle(extentType, repairTasks)
 
 	// notify the replicas to repair the extent
-	err = dp.NotifyExtentRepair(repairTasks)
+	err = dp.NotifyExtentRepair(traceCtx, repairTasks)
 	if err != nil {
 		dp.sendAllTinyExtentsToC(extentType, availableTinyExtents, brokenTinyExtents)
 		log.LogErrorf("action[repair] partition(%v) err(%v).",
@@ -111,8 +150,11 @@ func (dp *DataPartition) repair(extentType uint8) {
 	}
 
 	// ask the leader to do the repair
-	dp.DoRepair(repairTasks)
+	ctx, cancel := dp.newRepairContext(traceCtx)
+	dp.DoRepair(ctx, repairTasks)
+	cancel()
 	end := time.Now().UnixNano()
+	dp.setRepairDuration(time.Duration(end - start))
 
 	// every time we need to figureAnnotatef out which extents need to be repaired and which ones do not.
 	dp.sendAllTinyExtentsToC(extentType, availableTinyExtents, brokenTinyExtents)
@@ -129,26 +171,35 @@ func (dp *DataPartition) repair(extentType uint8) {
 		dp.extentStore.BrokenTinyExtentCnt(), (end-start)/int64(time.Millisecond), MasterClient.Nodes())
 }
 
-func (dp *DataPartition) buildDataPartitionRepairTask(repairTasks []*DataPartitionRepairTask, extentType uint8, tinyExtents []uint64) (err error) {
+// Build the repair tasks of the replicas, indexed as a snapshot of the replicas taken at once, so that an
+// update of the replicas in the middle does not mix two of them. The task of a follower failed to report its
+// extents is left nil.
+func (dp *DataPartition) buildDataPartitionRepairTask(extentType uint8, tinyExtents []uint64) (repairTasks []*DataPartitionRepairTask, err error) {
+	replicas := dp.Replicas()
+	if len(replicas) == 0 {
+		err = fmt.Errorf("partition(%v) has no replicas to repair", dp.partitionID)
+		return
+	}
 	// get the local extent info
 	extents, leaderTinyDeleteRecordFileSize, err := dp.getLocalExtentInfo(extentType, tinyExtents)
 	if err != nil {
-		return err
+		return
 	}
+	repairTasks = make([]*DataPartitionRepairTask, len(replicas))
 
 	// new repair task for the leader
-	repairTasks[0] = NewDataPartitionRepairTask(extents, leaderTinyDeleteRecordFileSize, dp.getReplicaAddr(0), dp.getReplicaAddr(0))
-	repairTasks[0].addr = dp.getReplicaAddr(0)
+	repairTasks[0] = NewDataPartitionRepairTask(extents, leaderTinyDeleteRecordFileSize, replicas[0], replicas[0])
+	repairTasks[0].addr = replicas[0]
 
 	// new repair tasks for the followers
-	for index := 1; index < dp.getReplicaLen(); index++ {
-		extents, err := dp.getRemoteExtentInfo(extentType, tinyExtents, dp.getReplicaAddr(index))
+	for index := 1; index < len(replicas); index++ {
+		extents, err := dp.getRemoteExtentInfo(extentType, tinyExtents, replicas[index])
 		if err != nil {
-			log.LogErrorf("buildDataPartitionRepairTask PartitionID(%v) on (%v) err(%v)", dp.partitionID, dp.getReplicaAddr(index), err)
+			log.LogErrorf("buildDataPartitionRepairTask PartitionID(%v) on (%v) err(%v)", dp.partitionID, replicas[index], err)
 			continue
 		}
-		repairTasks[index] = NewDataPartitionRepairTask(extents, leaderTinyDeleteRecordFileSize, dp.getReplicaAddr(index), dp.getReplicaAddr(0))
-		repairTasks[index].addr = dp.getReplicaAddr(index)
+		repairTasks[index] = NewDataPartitionRepairTask(extents, leaderTinyDeleteRecordFileSize, replicas[index], replicas[0])
+		repairTasks[index].addr = replicas[index]
 	}
 
 	return
@@ -175,7 +226,9 @@ func (dp *DataPartition) getLocalExtentInfo(extentType uint8, tinyExtents []uint
 
 	if err = json.Unmarshal(data, &extents); err != nil {
 		err = errors.Trace(err, "getLocalExtentInfo extent DataPartition(%v) GetAllWaterMark", dp.partitionID)
+		return
 	}
+	extents = dp.maskUnverifiedExtents(extents)
 
 	return
 }
@@ -220,19 +273,85 @@ func (dp *DataPartition) getRemoteExtentInfo(extentType uint8, tinyExtents []uin
 	return
 }
 
+// PlanRepair builds the repair tasks of all the replicas in dry-run mode and
+// returns what each replica would do, without creating or fixing any extent.
+func (dp *DataPartition) PlanRepair(extentType uint8) (summaries []*RepairSummary, err error) {
+	if !dp.isRepairLeader() {
+		err = fmt.Errorf("partition(%v) is not the repair leader", dp.partitionID)
+		return
+	}
+	var tinyExtents []uint64
+	if extentType == proto.TinyExtentType {
+		// only peek at the broken extents, which are left to the repair cycle and the writes
+		tinyExtents = dp.peekBrokenTinyExtents()
+		if len(tinyExtents) == 0 {
+			return
+		}
+	}
+	repairTasks, err := dp.buildDataPartitionRepairTask(extentType, tinyExtents)
+	if err != nil {
+		return
+	}
+	dp.prepareRepairTasks(repairTasks)
+	summaries = make([]*RepairSummary, 0, len(repairTasks))
+	for _, repairTask := range repairTasks {
+		if repairTask == nil {
+			continue
+		}
+		repairTask.DryRun = true
+		summary, _ := dp.DoExtentStoreRepair(context.Background(), repairTask)
+		summaries = append(summaries, summary)
+	}
+	return
+}
+
+// Compute the summary of a dry-run repair task. The extents reported by the replica are preferred
+// to the local extent store, so that the leader is able to plan the repair on behalf of the followers.
+func (dp *DataPartition) summarizeRepairTask(repairTask *DataPartitionRepairTask, summary *RepairSummary) {
+	planned := make(map[uint64]bool)
+	for _, extentInfo := range repairTask.ExtentsToBeRepaired {
+		if planned[extentInfo.FileID] {
+			continue
+		}
+		planned[extentInfo.FileID] = true
+		var localSize uint64
+		if localExtentInfo, ok := repairTask.extents[extentInfo.FileID]; ok {
+			localSize = localExtentInfo.Size
+		} else if repairTask.extents == nil {
+			if localExtentInfo, err := dp.extentStore.Watermark(extentInfo.FileID); err == nil {
+				localSize = localExtentInfo.Size
+			}
+		}
+		if extentInfo.Size <= localSize {
+			continue
+		}
+		summary.ExtentsToBeRepaired = append(summary.ExtentsToBeRepaired, extentInfo.FileID)
+		summary.BytesToBeRepaired += extentInfo.Size - localSize
+	}
+}
+
 // DoRepair asks the leader to perform the repair tasks.
-func (dp *DataPartition) DoRepair(repairTasks []*DataPartitionRepairTask) {
+func (dp *DataPartition) DoRepair(ctx context.Context, repairTasks []*DataPartitionRepairTask) {
 	store := dp.extentStore
 	for _, extentInfo := range repairTasks[0].ExtentsToBeCreated {
 		if !AutoRepairStatus {
 			log.LogWarnf("AutoRepairStatus is False,so cannot Create extent(%v)", extentInfo.String())
 			continue
 		}
-		store.Create(extentInfo.FileID)
+		if err := store.Create(extentInfo.FileID, extentInfo.Inode); err == nil {
+			dp.recordExtentCreated()
+		}
 	}
 	for _, extentInfo := range repairTasks[0].ExtentsToBeRepaired {
-		err := dp.streamRepairExtent(extentInfo)
-		if err != nil {
+		if dp.IsDraining() {
+			return
+		}
+		if ctx.Err() != nil {
+			log.LogWarnf("action[DoRepair] partition(%v) repair %v.", dp.partitionID, ctx.Err())
+			return
+		}
+		_, err := dp.streamRepairExtent(ctx, extentInfo)
+		if err != nil && !isRepairCanceled(err) {
 			err = errors.Trace(err, "doStreamExtentFixRepair %v", dp.applyRepairKey(int(extentInfo.FileID)))
 			localExtentInfo, opErr := dp.ExtentStore().Watermark(uint64(extentInfo.FileID))
 			if opErr != nil {
@@ -270,7 +389,7 @@ func (dp *DataPartition) sendAllTinyExtentsToC(extentType uint8, availableTinyEx
 
 func (dp *DataPartition) brokenTinyExtents() (brokenTinyExtents []uint64) {
 	brokenTinyExtents = make([]uint64, 0)
-	extentsToBeRepaired := MinTinyExtentsToRepair
+	extentsToBeRepaired := dp.TinyRepairBatchSize()
 	if dp.extentStore.AvailableTinyExtentCnt() == 0 {
 		extentsToBeRepaired = storage.TinyExtentCount
 	}
@@ -284,6 +403,15 @@ func (dp *DataPartition) brokenTinyExtents() (brokenTinyExtents []uint64) {
 	return
 }
 
+// The broken tiny extents the next repair cycle would take, which are left in the channel.
+func (dp *DataPartition) peekBrokenTinyExtents() []uint64 {
+	extentsToBeRepaired := dp.TinyRepairBatchSize()
+	if dp.extentStore.AvailableTinyExtentCnt() == 0 {
+		extentsToBeRepaired = storage.TinyExtentCount
+	}
+	return dp.extentStore.PeekBrokenTinyExtents(extentsToBeRepaired)
+}
+
 func (dp *DataPartition) prepareRepairTasks(repairTasks []*DataPartitionRepairTask) (availableTinyExtents []uint64, brokenTinyExtents []uint64) {
 	extentInfoMap := make(map[uint64]*storage.ExtentInfo)
 	for index := 0; index < len(repairTasks); index++ {
@@ -329,7 +457,7 @@ func (dp *DataPartition) buildExtentCreationTasks(repairTasks []*DataPartitionRe
 				if extentInfo.IsDeleted {
 					continue
 				}
-				ei := &storage.ExtentInfo{Source: extentInfo.Source, FileID: extentID, Size: extentInfo.Size}
+				ei := &storage.ExtentInfo{Source: dp.selectRepairSource(repairTasks, index, extentID, extentInfo), FileID: extentID, Size: extentInfo.Size, Inode: extentInfo.Inode}
 				repairTask.ExtentsToBeCreated = append(repairTask.ExtentsToBeCreated, ei)
 				repairTask.ExtentsToBeRepaired = append(repairTask.ExtentsToBeRepaired, ei)
 				log.LogInfof("action[generatorAddExtentsTasks] addFile(%v_%v) on Index(%v).", dp.partitionID, ei, index)
@@ -357,7 +485,7 @@ func (dp *DataPartition) buildExtentRepairTasks(repairTasks []*DataPartitionRepa
 				continue
 			}
 			if extentInfo.Size < maxFileInfo.Size {
-				fixExtent := &storage.ExtentInfo{Source: maxFileInfo.Source, FileID: extentID, Size: maxFileInfo.Size}
+				fixExtent := &storage.ExtentInfo{Source: dp.selectRepairSource(repairTasks, index, extentID, maxFileInfo), FileID: extentID, Size: maxFileInfo.Size}
 				repairTasks[index].ExtentsToBeRepaired = append(repairTasks[index].ExtentsToBeRepaired, fixExtent)
 				log.LogInfof("action[generatorFixExtentSizeTasks] fixExtent(%v_%v) on Index(%v) on(%v).",
 					dp.partitionID, fixExtent, index, repairTasks[index].addr)
@@ -376,10 +504,11 @@ func (dp *DataPartition) buildExtentRepairTasks(repairTasks []*DataPartitionRepa
 	return
 }
 
-func (dp *DataPartition) notifyFollower(wg *sync.WaitGroup, index int, members []*DataPartitionRepairTask) (err error) {
+func (dp *DataPartition) notifyFollower(traceCtx context.Context, wg *sync.WaitGroup, index int, members []*DataPartitionRepairTask) (err error) {
 	p := repl.NewPacketToNotifyExtentRepair(dp.partitionID) // notify all the followers to repair
 	var conn *net.TCPConn
-	target := dp.getReplicaAddr(index)
+	target := members[index].addr
+	injectRepairTrace(traceCtx, members[index])
 	p.Data, _ = json.Marshal(members[index])
 	p.Size = uint32(len(p.Data))
 	conn, err = gConnPool.GetConnect(target)
@@ -401,25 +530,41 @@ func (dp *DataPartition) notifyFollower(wg *sync.WaitGroup, index int, members [
 }
 
 // NotifyExtentRepair notifies the followers to repair.
-func (dp *DataPartition) NotifyExtentRepair(members []*DataPartitionRepairTask) (err error) {
+func (dp *DataPartition) NotifyExtentRepair(traceCtx context.Context, members []*DataPartitionRepairTask) (err error) {
 	wg := new(sync.WaitGroup)
 	for i := 1; i < len(members); i++ {
 		if members[i] == nil {
 			continue
 		}
 		wg.Add(1)
-		go dp.notifyFollower(wg, i, members)
+		go dp.notifyFollower(traceCtx, wg, i, members)
 	}
 	wg.Wait()
 	return
 }
 
 // DoStreamExtentFixRepair executes the repair on the followers.
-func (dp *DataPartition) doStreamExtentFixRepair(wg *sync.WaitGroup, remoteExtentInfo *storage.ExtentInfo) {
+func (dp *DataPartition) doStreamExtentFixRepair(ctx context.Context, wg *sync.WaitGroup, remoteExtentInfo *storage.ExtentInfo, progress *repairProgress) {
 	defer wg.Done()
 
-	err := dp.streamRepairExtent(remoteExtentInfo)
-
+	var err error
+	ctx, span := dp.startRepairSpan(ctx, SpanStreamExtentRepair)
+	span.SetAttribute(TraceAttrExtentID, remoteExtentInfo.FileID)
+	span.SetAttribute(TraceAttrSource, remoteExtentInfo.Source)
+	defer func() { span.End(err) }()
+	bytes, err := dp.streamRepairExtent(ctx, remoteExtentInfo)
+	span.SetAttribute(TraceAttrBytes, bytes)
+	atomic.AddUint64(&progress.bytes, bytes)
+
+	if isRepairCanceled(err) {
+		// canceled with the cycle or alone by CancelRepair, not a failure of the extent
+		atomic.AddInt32(&progress.canceled, 1)
+		return
+	}
+	if IsRepairSourceUnavailableError(err) {
+		dp.recordNoSource(remoteExtentInfo.FileID, remoteExtentInfo.Source, err)
+		return
+	}
 	if err != nil {
 		err = errors.Trace(err, "doStreamExtentFixRepair %v", dp.applyRepairKey(int(remoteExtentInfo.FileID)))
 		localExtentInfo, opErr := dp.ExtentStore().Watermark(uint64(remoteExtentInfo.FileID))
@@ -429,61 +574,142 @@ func (dp *DataPartition) doStreamExtentFixRepair(wg *sync.WaitGroup, remoteExten
 		err = errors.Trace(err, "partition(%v) remote(%v) local(%v)",
 			dp.partitionID, remoteExtentInfo, localExtentInfo)
 		log.LogWarnf("action[doStreamExtentFixRepair] err(%v).", err)
+		dp.recordRepairFailure(remoteExtentInfo.FileID, err)
+		return
 	}
+	atomic.AddInt32(&progress.completed, 1)
+	dp.recordRepairSuccess(remoteExtentInfo.FileID)
+	dp.clearNoSource(remoteExtentInfo.FileID)
+}
+
+// GetRepairStats returns a copy of the repair statistics of the current repair cycle.
+func (dp *DataPartition) GetRepairStats() (stats RepairStats) {
+	dp.repairStatsLock.Lock()
+	stats = dp.repairStats
+	dp.repairStatsLock.Unlock()
+	return
+}
+
+func (dp *DataPartition) resetRepairStats() {
+	dp.repairStatsLock.Lock()
+	dp.repairStats = RepairStats{}
+	dp.repairStatsLock.Unlock()
+}
+
+func (dp *DataPartition) recordExtentCreated() {
+	dp.repairStatsLock.Lock()
+	dp.repairStats.ExtentsCreated++
+	dp.repairStatsLock.Unlock()
+}
+
+func (dp *DataPartition) recordExtentRepaired() {
+	dp.repairStatsLock.Lock()
+	dp.repairStats.ExtentsRepaired++
+	dp.repairStatsLock.Unlock()
+}
+
+func (dp *DataPartition) recordBytesTransferred(size uint64) {
+	dp.repairStatsLock.Lock()
+	dp.repairStats.BytesTransferred += size
+	dp.repairStatsLock.Unlock()
+}
+
+func (dp *DataPartition) setRepairDuration(cost time.Duration) {
+	dp.repairStatsLock.Lock()
+	dp.repairStats.LastRepairDuration = cost
+	dp.repairStatsLock.Unlock()
 }
 
 func (dp *DataPartition) applyRepairKey(extentID int) (m string) {
 	return fmt.Sprintf("ApplyRepairKey(%v_%v)", dp.partitionID, extentID)
 }
 
-// The actual repair of an extent happens here.
-func (dp *DataPartition) streamRepairExtent(remoteExtentInfo *storage.ExtentInfo) (err error) {
+// The actual repair of an extent happens here, registered as an active repair while it runs.
+// The repair stops between two packets once the context is canceled, and returns the error of the context.
+func (dp *DataPartition) streamRepairExtent(ctx context.Context, remoteExtentInfo *storage.ExtentInfo) (bytes uint64, err error) {
 	store := dp.ExtentStore()
 	if !store.HasExtent(remoteExtentInfo.FileID) {
 		return
 	}
+	// the read repair adds the extent for all its steps, and removes it itself
+	if dp.tryAddInflightExtent(remoteExtentInfo.FileID) {
+		defer dp.removeInflightExtent(remoteExtentInfo.FileID)
+	}
+	ctx, repair, done := dp.startActiveRepair(ctx, remoteExtentInfo.FileID, remoteExtentInfo.Source, remoteExtentInfo.Size)
+	defer func() {
+		bytes = dp.activeRepairBytes(repair)
+		done()
+	}()
 	if !AutoRepairStatus && !storage.IsTinyExtent(remoteExtentInfo.FileID) {
 		log.LogWarnf("AutoRepairStatus is False,so cannot AutoRepair extent(%v)", remoteExtentInfo.String())
 		return
 	}
 	localExtentInfo, err := store.Watermark(remoteExtentInfo.FileID)
 	if err != nil {
-		return errors.Trace(err, "streamRepairExtent Watermark error")
+		err = errors.Trace(err, "streamRepairExtent Watermark error")
+		return
 	}
 
-	if localExtentInfo.Size >= remoteExtentInfo.Size {
-		return nil
+	// the range failed the verification in the last repair is repaired again
+	startOffset := dp.repairStartOffset(remoteExtentInfo.FileID, localExtentInfo.Size)
+	if startOffset >= remoteExtentInfo.Size {
+		return
 	}
 	// size difference between the local extent and the remote extent
-	sizeDiff := remoteExtentInfo.Size - localExtentInfo.Size
-	request := repl.NewExtentRepairReadPacket(dp.partitionID, remoteExtentInfo.FileID, int(localExtentInfo.Size), int(sizeDiff))
+	sizeDiff := remoteExtentInfo.Size - startOffset
+	request := repl.NewExtentRepairReadPacket(dp.partitionID, remoteExtentInfo.FileID, int(startOffset), int(sizeDiff))
 	if storage.IsTinyExtent(remoteExtentInfo.FileID) {
-		request = repl.NewTinyExtentRepairReadPacket(dp.partitionID, remoteExtentInfo.FileID, int(localExtentInfo.Size), int(sizeDiff))
+		request = repl.NewTinyExtentRepairReadPacket(dp.partitionID, remoteExtentInfo.FileID, int(startOffset), int(sizeDiff))
 	}
 	var conn *net.TCPConn
 	conn, err = gConnPool.GetConnect(remoteExtentInfo.Source)
 	if err != nil {
-		return errors.Trace(err, "streamRepairExtent get conn from host(%v) error", remoteExtentInfo.Source)
+		err = &RepairSourceUnavailableError{Source: remoteExtentInfo.Source, Err: err}
+		return
 	}
 	defer gConnPool.PutConnect(conn, true)
+	// unblock the read of the packet once the repair is canceled, the connection is closed after all
+	repairDone := make(chan struct{})
+	defer close(repairDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-repairDone:
+		}
+	}()
 
 	if err = request.WriteToConn(conn); err != nil {
-		err = errors.Trace(err, "streamRepairExtent send streamRead to host(%v) error", remoteExtentInfo.Source)
-		log.LogWarnf("action[streamRepairExtent] err(%v).", err)
+		log.LogWarnf("action[streamRepairExtent] send streamRead to host(%v) err(%v).", remoteExtentInfo.Source, err)
+		err = &RepairSourceUnavailableError{Source: remoteExtentInfo.Source, Err: err}
 		return
 	}
-	currFixOffset := localExtentInfo.Size
+	currFixOffset := startOffset
 	var (
 		hasRecoverySize uint64
+		repairedCrc     hash.Hash32
 	)
+	// the tiny extents are not verified, since the holes are recovered without the data
+	verify := dp.disk.space.GetRepairVerify() && !storage.IsTinyExtent(remoteExtentInfo.FileID)
+	if verify {
+		repairedCrc = crc32.NewIEEE()
+	}
 	for currFixOffset < remoteExtentInfo.Size {
 		if currFixOffset >= remoteExtentInfo.Size {
 			break
 		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
 		reply := repl.NewPacket()
 
 		// read 64k streaming repair packet
 		if err = reply.ReadFromConn(conn, 60); err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				return
+			}
 			err = errors.Trace(err, "streamRepairExtent receive data error,localExtentSize(%v) remoteExtentSize(%v)", currFixOffset, remoteExtentInfo.Size)
 			return
 		}
@@ -515,10 +741,17 @@ func (dp *DataPartition) streamRepairExtent(remoteExtentInfo *storage.ExtentInfo
 			err = fmt.Errorf("streamRepairExtent crc mismatch expectCrc(%v) actualCrc(%v) extent(%v_%v) start fix from (%v)"+
 				" remoteSize(%v) localSize(%v) request(%v) reply(%v) ", reply.CRC, actualCrc, dp.partitionID, remoteExtentInfo.String(),
 				remoteExtentInfo.Source, remoteExtentInfo.Size, currFixOffset, request.GetUniqueLogId(), reply.GetUniqueLogId())
-			return errors.Trace(err, "streamRepairExtent receive data error")
+			err = errors.Trace(err, "streamRepairExtent receive data error")
+			return
 		}
 
 		isEmptyResponse := false
+		if reply.Arg != nil && storage.IsTinyExtent(uint64(localExtentInfo.FileID)) {
+			isEmptyResponse = reply.Arg[0] == EmptyResponse
+		}
+		if !isEmptyResponse {
+			dp.disk.space.waitRepairBandwidth(int(reply.Size), dp.RepairPriority())
+		}
 		// Write it to local extent file
 		if storage.IsTinyExtent(uint64(localExtentInfo.FileID)) {
 			currRecoverySize := uint64(reply.Size)
@@ -549,13 +782,25 @@ func (dp *DataPartition) streamRepairExtent(remoteExtentInfo *storage.ExtentInfo
 			err = errors.Trace(err, "streamRepairExtent repair data error ")
 			return
 		}
+		if verify {
+			repairedCrc.Write(reply.Data[:reply.Size])
+		}
 		hasRecoverySize += uint64(reply.Size)
 		currFixOffset += uint64(reply.Size)
+		dp.recordBytesTransferred(uint64(reply.Size))
+		dp.recordActiveRepairBytes(repair, uint64(reply.Size))
 		if currFixOffset >= remoteExtentInfo.Size {
 			break
 		}
 
 	}
+	if verify {
+		if err = dp.verifyRepairedExtent(remoteExtentInfo.FileID, startOffset, currFixOffset, repairedCrc.Sum32()); err != nil {
+			return
+		}
+	}
+	dp.clearUnverified(remoteExtentInfo.FileID)
+	dp.recordExtentRepaired()
 	return
 
 }
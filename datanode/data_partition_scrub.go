@@ -0,0 +1,185 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// SuspectExtent describes an extent whose replicas have the same size but different crcs.
+type SuspectExtent struct {
+	ExtentID uint64            `json:"extentID"`
+	Size     uint64            `json:"size"`
+	Crcs     map[string]uint32 `json:"crcs"`     // key: replica address
+	Disagree []string          `json:"disagree"` // the replicas whose crc differs from the leader's
+}
+
+// ScrubExtents compares the crcs of the normal extents across the replicas, and returns the extents
+// whose crcs differ even if their sizes match, which the size based repair can never find.
+// The crc of an extent is computed only after it stops being modified, so the extents without
+// the crc on any replica are skipped.
+func (dp *DataPartition) ScrubExtents() (suspects []*SuspectExtent, err error) {
+	if !dp.isRepairLeader() {
+		err = fmt.Errorf("partition(%v) is not the repair leader", dp.partitionID)
+		return
+	}
+	repairTasks, err := dp.buildDataPartitionRepairTask(proto.NormalExtentType, nil)
+	if err != nil {
+		return
+	}
+	leaderTask := repairTasks[0]
+	suspects = make([]*SuspectExtent, 0)
+	for extentID, leaderExtent := range leaderTask.extents {
+		if leaderExtent.IsDeleted || leaderExtent.Crc == 0 {
+			continue
+		}
+		suspect := &SuspectExtent{
+			ExtentID: extentID,
+			Size:     leaderExtent.Size,
+			Crcs:     map[string]uint32{leaderTask.addr: leaderExtent.Crc},
+			Disagree: make([]string, 0),
+		}
+		for _, task := range repairTasks[1:] {
+			if task == nil {
+				continue
+			}
+			extent, ok := task.extents[extentID]
+			if !ok || extent.IsDeleted || extent.Crc == 0 || extent.Size != leaderExtent.Size {
+				continue
+			}
+			suspect.Crcs[task.addr] = extent.Crc
+			if extent.Crc != leaderExtent.Crc {
+				suspect.Disagree = append(suspect.Disagree, task.addr)
+			}
+		}
+		if len(suspect.Disagree) > 0 {
+			suspects = append(suspects, suspect)
+		}
+	}
+	sort.Slice(suspects, func(i, j int) bool {
+		return suspects[i].ExtentID < suspects[j].ExtentID
+	})
+	for _, suspect := range suspects {
+		log.LogWarnf("action[ScrubExtents] partition(%v) extent(%v) size(%v) crcs(%v) mismatch on replicas(%v).",
+			dp.partitionID, suspect.ExtentID, suspect.Size, suspect.Crcs, suspect.Disagree)
+	}
+	return
+}
+
+// SizeMismatchedExtent describes an extent whose sizes differ between the local and the peer replicas.
+type SizeMismatchedExtent struct {
+	ExtentID  uint64 `json:"extentID"`
+	LocalSize uint32 `json:"localSize"`
+	PeerSize  uint32 `json:"peerSize"`
+}
+
+// SnapshotDiff describes the difference between the snapshots of the local and the peer replicas.
+type SnapshotDiff struct {
+	PeerAddr       string                  `json:"peerAddr"`
+	MissingLocally []uint64                `json:"missingLocally"`
+	ExtraLocally   []uint64                `json:"extraLocally"`
+	SizeMismatched []*SizeMismatchedExtent `json:"sizeMismatched"`
+}
+
+// DiffSnapshots compares the snapshot of the local replica with the one of the given peer replica.
+func (dp *DataPartition) DiffSnapshots(peerAddr string) (diff *SnapshotDiff, err error) {
+	isReplica := false
+	for _, replica := range dp.Replicas() {
+		if replica == peerAddr {
+			isReplica = true
+		}
+	}
+	if !isReplica {
+		err = fmt.Errorf("%v is not a replica of partition(%v)", peerAddr, dp.partitionID)
+		return
+	}
+	peerFiles, err := dp.getRemoteSnapshot(peerAddr)
+	if err != nil {
+		return
+	}
+	peer := make(map[string]*proto.File, len(peerFiles))
+	for _, file := range peerFiles {
+		peer[file.Name] = file
+	}
+	diff = &SnapshotDiff{
+		PeerAddr:       peerAddr,
+		MissingLocally: make([]uint64, 0),
+		ExtraLocally:   make([]uint64, 0),
+		SizeMismatched: make([]*SizeMismatchedExtent, 0),
+	}
+	dp.IterateExtents(func(localFile *proto.File) bool {
+		extentID, _ := strconv.ParseUint(localFile.Name, 10, 64)
+		peerFile, ok := peer[localFile.Name]
+		if !ok {
+			diff.ExtraLocally = append(diff.ExtraLocally, extentID)
+			return true
+		}
+		delete(peer, localFile.Name)
+		if localFile.Size != peerFile.Size {
+			diff.SizeMismatched = append(diff.SizeMismatched, &SizeMismatchedExtent{
+				ExtentID:  extentID,
+				LocalSize: localFile.Size,
+				PeerSize:  peerFile.Size,
+			})
+		}
+		return true
+	})
+	for name := range peer {
+		extentID, _ := strconv.ParseUint(name, 10, 64)
+		diff.MissingLocally = append(diff.MissingLocally, extentID)
+	}
+	sortExtentIDs(diff.MissingLocally)
+	sortExtentIDs(diff.ExtraLocally)
+	sort.Slice(diff.SizeMismatched, func(i, j int) bool {
+		return diff.SizeMismatched[i].ExtentID < diff.SizeMismatched[j].ExtentID
+	})
+	return
+}
+
+// Build the snapshot of the remote replica from the watermarks of all its extents.
+func (dp *DataPartition) getRemoteSnapshot(target string) (files []*proto.File, err error) {
+	var normalExtents, tinyExtents []*storage.ExtentInfo
+	if normalExtents, err = dp.getRemoteExtentInfo(proto.NormalExtentType, nil, target); err != nil {
+		return
+	}
+	tinyExtentIDs := make([]uint64, 0, storage.TinyExtentCount)
+	for extentID := uint64(storage.TinyExtentStartID); extentID < storage.TinyExtentStartID+storage.TinyExtentCount; extentID++ {
+		tinyExtentIDs = append(tinyExtentIDs, extentID)
+	}
+	if tinyExtents, err = dp.getRemoteExtentInfo(proto.TinyExtentType, tinyExtentIDs, target); err != nil {
+		return
+	}
+	files = make([]*proto.File, 0, len(normalExtents)+len(tinyExtents))
+	for _, ei := range append(normalExtents, tinyExtents...) {
+		files = append(files, &proto.File{
+			Name:     strconv.FormatUint(ei.FileID, 10),
+			Size:     uint32(ei.Size),
+			Modified: ei.ModifyTime,
+		})
+	}
+	return
+}
+
+func sortExtentIDs(extentIDs []uint64) {
+	sort.Slice(extentIDs, func(i, j int) bool {
+		return extentIDs[i] < extentIDs[j]
+	})
+}
@@ -52,31 +52,74 @@ type Disk struct {
 	Unallocated uint64
 	Allocated   uint64
 
-	MaxErrCnt     int // maximum number of errors
+	MaxErrCnt     int // maximum number of the io errors within DiskErrWindow
 	Status        int // disk status such as READONLY
 	ReservedSpace uint64
+	SectorSize    int64 // bytes of a block counted by stat, always DiskSectorSize on Linux
 
 	RejectWrite  bool
 	partitionMap map[uint64]*DataPartition
 	space        *SpaceManager
+	ioErrors     ioErrorWindow
+	ioErrorsDown int32           // set if the disk is taken down by the io errors, which it recovers from
+	stoppedRafts map[uint64]bool // partitions whose raft is stopped by ForceExitRaftStore, under the lock
+	health       diskHealth      // reported by the SMART monitor
+}
+
+// DiskErrWindow is the window the io errors of a disk are counted in, the disk is taken down with its
+// partitions once the errors within it exceed MaxErrCnt, and brought back once a window passes without any.
+const DiskErrWindow = 10 * time.Minute
+
+// ioErrorWindow keeps the times of the io errors of a disk within DiskErrWindow.
+type ioErrorWindow struct {
+	sync.Mutex
+	times []time.Time
+}
+
+func (w *ioErrorWindow) add(now time.Time) {
+	w.Lock()
+	w.times = append(w.times, now)
+	w.Unlock()
+}
+
+// Return the number of the errors within the window before now, the older ones are dropped.
+func (w *ioErrorWindow) count(now time.Time) int {
+	w.Lock()
+	defer w.Unlock()
+	var expired int
+	for expired < len(w.times) && now.Sub(w.times[expired]) > DiskErrWindow {
+		expired++
+	}
+	w.times = w.times[expired:]
+	return len(w.times)
 }
 
 type PartitionVisitor func(dp *DataPartition)
 
-func NewDisk(path string, reservedSpace uint64, maxErrCnt int, space *SpaceManager) (d *Disk) {
+func NewDisk(path string, reservedSpace uint64, sectorSize int64, maxErrCnt int, space *SpaceManager) (d *Disk) {
 	d = new(Disk)
 	d.Path = path
 	d.ReservedSpace = reservedSpace
+	d.SectorSize = sectorSize
 	d.MaxErrCnt = maxErrCnt
 	d.RejectWrite = false
 	d.space = space
 	d.partitionMap = make(map[uint64]*DataPartition)
 	d.computeUsage()
 	d.updateSpaceInfo()
+	d.refreshHealth()
 	d.startScheduleToUpdateSpaceInfo()
 	return
 }
 
+// Return the bytes of a block counted in the stat of the files on the disk.
+func (d *Disk) sectorSize() int64 {
+	if d.SectorSize <= 0 {
+		return DiskSectorSize
+	}
+	return d.SectorSize
+}
+
 // PartitionCount returns the number of partitions in the partition map.
 func (d *Disk) PartitionCount() int {
 	d.RLock()
@@ -139,10 +182,61 @@ func (d *Disk) computeUsage() (err error) {
 
 func (d *Disk) incReadErrCnt() {
 	atomic.AddUint64(&d.ReadErrCnt, 1)
+	d.ioErrors.add(time.Now())
 }
 
 func (d *Disk) incWriteErrCnt() {
 	atomic.AddUint64(&d.WriteErrCnt, 1)
+	d.ioErrors.add(time.Now())
+}
+
+// Mark the disk unavailable if the io errors within DiskErrWindow exceed MaxErrCnt. The partitions on the
+// disk follow at their next status update, and leave the raft store with the disk. The disk taken down by
+// the io errors recovers once DiskErrWindow passes without any.
+func (d *Disk) checkIOErrors() {
+	count := d.ioErrors.count(time.Now())
+	if d.Status == proto.Unavailable {
+		if count == 0 && atomic.CompareAndSwapInt32(&d.ioErrorsDown, 1, 0) {
+			d.recoverFromIOErrors()
+		}
+		return
+	}
+	if count > d.MaxErrCnt {
+		mesg := fmt.Sprintf("disk path %v has %v io errors within %v on %v, exceeds %v", d.Path, count,
+			DiskErrWindow, LocalIP, d.MaxErrCnt)
+		exporter.Warning(mesg)
+		log.LogErrorf("%v", mesg)
+		atomic.StoreInt32(&d.ioErrorsDown, 1)
+		d.Status = proto.Unavailable
+	}
+}
+
+// Bring the disk back from the io errors, restart the raft of the partitions stopped with it, and update
+// their status, which the ones failing to start the raft keep unavailable.
+func (d *Disk) recoverFromIOErrors() {
+	mesg := fmt.Sprintf("disk path %v has no io errors within %v on %v, recovered", d.Path, DiskErrWindow, LocalIP)
+	exporter.Warning(mesg)
+	log.LogWarnf("%v", mesg)
+	d.Lock()
+	stoppedRafts := d.stoppedRafts
+	d.stoppedRafts = nil
+	d.Unlock()
+	d.Status = proto.ReadWrite
+	for _, partitionID := range d.DataPartitionList() {
+		partition := d.GetDataPartition(partitionID)
+		if partition == nil {
+			continue
+		}
+		if stoppedRafts[partitionID] {
+			if err := partition.StartRaft(); err != nil {
+				log.LogErrorf("action[recoverFromIOErrors] partition(%v) start raft err(%v).", partitionID, err)
+				continue
+			}
+		}
+		if frozen, _ := partition.IsFrozen(); !frozen {
+			partition.updateStatus(partition.raftReadiness.result() != nil)
+		}
+	}
 }
 
 func (d *Disk) startScheduleToUpdateSpaceInfo() {
@@ -160,6 +254,7 @@ func (d *Disk) startScheduleToUpdateSpaceInfo() {
 				d.updateSpaceInfo()
 			case <-checkStatusTickser.C:
 				d.checkDiskStatus()
+				d.refreshHealth()
 			}
 		}
 	}()
@@ -227,6 +322,7 @@ func (d *Disk) updateSpaceInfo() (err error) {
 	if err = syscall.Statfs(d.Path, &statsInfo); err != nil {
 		d.incReadErrCnt()
 	}
+	d.checkIOErrors()
 	if d.Status == proto.Unavailable {
 		mesg := fmt.Sprintf("disk path %v error on %v", d.Path, LocalIP)
 		log.LogErrorf(mesg)
@@ -243,6 +339,23 @@ func (d *Disk) updateSpaceInfo() (err error) {
 	return
 }
 
+// Check that the disk has room for a new partition of the given size plus the reserve, so that the
+// partitions on the disk are not all turned read-only by a full disk once the new one is written.
+// Both the free space and the space not yet allocated to the partitions are checked.
+func (d *Disk) checkSpaceToCreate(partitionSize int) (err error) {
+	d.computeUsage()
+	available := d.Available
+	if d.Unallocated < available {
+		available = d.Unallocated
+	}
+	reserve := uint64(float64(d.Total) * d.space.GetCreateReserveRatio())
+	if available < uint64(partitionSize)+reserve {
+		err = fmt.Errorf("disk(%v) available(%v) is less than the partition size(%v) plus the reserve(%v)",
+			d.Path, available, partitionSize, reserve)
+	}
+	return
+}
+
 // AttachDataPartition adds a data partition to the partition map.
 func (d *Disk) AttachDataPartition(dp *DataPartition) {
 	d.Lock()
@@ -261,6 +374,44 @@ func (d *Disk) DetachDataPartition(dp *DataPartition) {
 	d.computeUsage()
 }
 
+// DiskSummary aggregates the partitions attached to a disk.
+type DiskSummary struct {
+	Path                string `json:"path"`
+	Status              int    `json:"status"`
+	Total               uint64 `json:"total"`
+	Available           uint64 `json:"available"`
+	PartitionCount      int    `json:"partitionCount"`
+	ReadOnlyCount       int    `json:"readOnlyCount"`
+	UnavailableCount    int    `json:"unavailableCount"`
+	PartitionsAllocated uint64 `json:"partitionsAllocated"`
+	PartitionsUsed      uint64 `json:"partitionsUsed"`
+}
+
+// Summary aggregates the partitions attached to the disk.
+// The partition map is locked during the aggregation, so no partition can be attached or detached meanwhile.
+func (d *Disk) Summary() (summary *DiskSummary) {
+	summary = &DiskSummary{
+		Path:      d.Path,
+		Status:    d.Status,
+		Total:     d.Total,
+		Available: d.Available,
+	}
+	d.RLock()
+	defer d.RUnlock()
+	summary.PartitionCount = len(d.partitionMap)
+	for _, dp := range d.partitionMap {
+		switch dp.Status() {
+		case proto.ReadOnly:
+			summary.ReadOnlyCount++
+		case proto.Unavailable:
+			summary.UnavailableCount++
+		}
+		summary.PartitionsAllocated += uint64(dp.Size())
+		summary.PartitionsUsed += uint64(dp.Used())
+	}
+	return
+}
+
 // GetDataPartition returns the data partition based on the given partition ID.
 func (d *Disk) GetDataPartition(partitionID uint64) (partition *DataPartition) {
 	d.RLock()
@@ -273,6 +424,14 @@ func (d *Disk) ForceExitRaftStore() {
 	for _, partitionID := range partitionList {
 		partition := d.GetDataPartition(partitionID)
 		partition.partitionStatus = proto.Unavailable
+		if partition.raftPartition != nil {
+			d.Lock()
+			if d.stoppedRafts == nil {
+				d.stoppedRafts = make(map[uint64]bool)
+			}
+			d.stoppedRafts[partitionID] = true
+			d.Unlock()
+		}
 		partition.stopRaft()
 	}
 }
@@ -288,6 +447,25 @@ func (d *Disk) DataPartitionList() (partitionIDs []uint64) {
 	return
 }
 
+// Set the size of the partition if its growth fits into the space not allocated to the other partitions of the disk.
+// The lock of the disk is held, so the resizes and the usage computed at the same time see the sizes in one order.
+func (d *Disk) reserveResize(dp *DataPartition, newSize int) (err error) {
+	d.Lock()
+	defer d.Unlock()
+	allocated := uint64(newSize)
+	for _, partition := range d.partitionMap {
+		if partition != dp {
+			allocated += uint64(partition.Size())
+		}
+	}
+	if growth := newSize - dp.Size(); growth > 0 && allocated > d.Total {
+		return fmt.Errorf("partition(%v) growth(%v) exceeds the unallocated space of disk(%v) total(%v)",
+			dp.partitionID, growth, d.Path, d.Total)
+	}
+	atomic.StoreInt64(&dp.partitionSize, int64(newSize))
+	return
+}
+
 func unmarshalPartitionName(name string) (partitionID uint64, partitionSize int, err error) {
 	arr := strings.Split(name, "_")
 	if len(arr) != 3 {
@@ -303,13 +481,38 @@ func unmarshalPartitionName(name string) (partitionID uint64, partitionSize int,
 	return
 }
 
+// Find the directory of the given partition on the disk.
+func (d *Disk) findPartitionDir(partitionID uint64) (partitionDir string, err error) {
+	var fileInfos []os.FileInfo
+	if fileInfos, err = ioutil.ReadDir(d.Path); err != nil {
+		return
+	}
+	for _, fileInfo := range fileInfos {
+		if !fileInfo.IsDir() || !d.isPartitionDir(fileInfo.Name()) {
+			continue
+		}
+		id, _, nameErr := unmarshalPartitionName(fileInfo.Name())
+		if nameErr == nil && id == partitionID {
+			return path.Join(d.Path, fileInfo.Name()), nil
+		}
+	}
+	err = fmt.Errorf("partition(%v) not found on disk(%v)", partitionID, d.Path)
+	return
+}
+
 func (d *Disk) isPartitionDir(filename string) (isPartitionDir bool) {
 	isPartitionDir = RegexpDataPartitionDir.MatchString(filename)
 	return
 }
 
-// RestorePartition reads the files stored on the local disk and restores the data partitions.
-func (d *Disk) RestorePartition(visitor PartitionVisitor) {
+// RestorePartition reads the files stored on the local disk and restores the data partitions, by the load
+// concurrency of the space manager at most. The partitions failed to be loaded are returned in the report.
+func (d *Disk) RestorePartition(visitor PartitionVisitor) (report *DiskLoadReport) {
+	start := time.Now()
+	report = &DiskLoadReport{Disk: d.Path}
+	defer func() {
+		report.Duration = time.Since(start)
+	}()
 	var convert = func(node *proto.DataNodeInfo) *DataNodeInfo {
 		result := &DataNodeInfo{}
 		result.Addr = node.Addr
@@ -343,9 +546,19 @@ func (d *Disk) RestorePartition(visitor PartitionVisitor) {
 		return
 	}
 
-	var wg sync.WaitGroup
+	dirs := make([]*partitionDir, 0, len(fileInfoList))
 	for _, fileInfo := range fileInfoList {
 		filename := fileInfo.Name()
+		if strings.HasPrefix(filename, importTempDirPrefix) {
+			log.LogWarnf("action[RestorePartition] remove the import(%v) left on disk(%v).", filename, d.Path)
+			os.RemoveAll(path.Join(d.Path, filename))
+			continue
+		}
+		if strings.HasPrefix(filename, movingDirPrefix) || strings.HasPrefix(filename, moveTempDirPrefix) {
+			if filename = d.recoverMove(filename); filename == "" {
+				continue
+			}
+		}
 		if !d.isPartitionDir(filename) {
 			continue
 		}
@@ -367,28 +580,31 @@ func (d *Disk) RestorePartition(visitor PartitionVisitor) {
 			continue
 		}
 
-		wg.Add(1)
-
-		go func(partitionID uint64, filename string) {
-			var (
-				dp  *DataPartition
-				err error
-			)
-			defer wg.Done()
-			if dp, err = LoadDataPartition(path.Join(d.Path, filename), d); err != nil {
-				mesg := fmt.Sprintf("action[RestorePartition] new partition(%v) err(%v) ",
-					partitionID, err.Error())
-				log.LogError(mesg)
-				exporter.Warning(mesg)
-				return
-			}
-			if visitor != nil {
-				visitor(dp)
-			}
+		dirs = append(dirs, &partitionDir{partitionID: partitionID, filename: filename})
+	}
 
-		}(partitionID, filename)
+	errs := loadPartitions(dirs, d.space.GetLoadConcurrency(), func(dir *partitionDir) (err error) {
+		var dp *DataPartition
+		if dp, err = LoadDataPartition(path.Join(d.Path, dir.filename), d); err != nil {
+			mesg := fmt.Sprintf("action[RestorePartition] new partition(%v) err(%v) ",
+				dir.partitionID, err.Error())
+			log.LogError(mesg)
+			exporter.Warning(mesg)
+			return
+		}
+		if visitor != nil {
+			visitor(dp)
+		}
+		return
+	})
+	for i, err := range errs {
+		if err != nil {
+			report.Failed = append(report.Failed, newPartitionLoadFailure(dirs[i].partitionID, d.Path, dirs[i].filename, err))
+			continue
+		}
+		report.Loaded++
 	}
-	wg.Wait()
+	return
 }
 
 func (d *Disk) AddSize(size uint64) {
@@ -0,0 +1,152 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The health of a disk reported by the SMART monitor. No partition is created on a failing or prefail disk,
+// while the partitions already on it are served as before, to be moved away by the operator.
+const (
+	DiskHealthUnknown = ""        // never reported, treated as healthy
+	DiskHealthPassed  = "passed"  // the overall health self-assessment passed
+	DiskHealthPrefail = "prefail" // a prefailure attribute reached its threshold
+	DiskHealthFailing = "failing" // the overall health self-assessment failed
+)
+
+// DiskHealthSource reports the SMART health of a disk by its path, one of the DiskHealth states, with a detail
+// such as the attributes beyond their thresholds. It is installed by SpaceManager.SetDiskHealthSource, and
+// queried before a partition is created on the disk and every time the status of the disk is checked. A monitor
+// pushing the health sets it by Disk.SetHealth instead.
+type DiskHealthSource interface {
+	DiskHealth(diskPath string) (health string, detail string, err error)
+}
+
+// DiskHealthSourceFunc adapts a function to a DiskHealthSource.
+type DiskHealthSourceFunc func(diskPath string) (health string, detail string, err error)
+
+func (f DiskHealthSourceFunc) DiskHealth(diskPath string) (health string, detail string, err error) {
+	return f(diskPath)
+}
+
+// DiskHealthError is the error a partition creation fails with, when the disk picked for it is not healthy.
+type DiskHealthError struct {
+	Path   string
+	Health string
+	Detail string
+}
+
+func (e *DiskHealthError) Error() string {
+	return fmt.Sprintf("disk(%v) is %v by SMART (%v), no partition is created on it", e.Path, e.Health, e.Detail)
+}
+
+// IsDiskHealthError tells if the error is the one of a partition creation refused by the disk health.
+func IsDiskHealthError(err error) bool {
+	_, ok := err.(*DiskHealthError)
+	return ok
+}
+
+// diskHealth is the health of a disk reported last.
+type diskHealth struct {
+	sync.Mutex
+	health string
+	detail string
+}
+
+func isUnhealthy(health string) bool {
+	return health == DiskHealthFailing || health == DiskHealthPrefail
+}
+
+// SetDiskHealthSource installs the SMART source of the node, which is supposed to be called before Start, so the
+// disks are checked since they are loaded.
+func (s *DataNode) SetDiskHealthSource(source DiskHealthSource) {
+	s.diskHealthSource = source
+	if s.space != nil {
+		s.space.SetDiskHealthSource(source)
+	}
+}
+
+func (manager *SpaceManager) SetDiskHealthSource(source DiskHealthSource) {
+	manager.diskHealthMutex.Lock()
+	manager.diskHealthSource = source
+	manager.diskHealthMutex.Unlock()
+}
+
+func (manager *SpaceManager) getDiskHealthSource() DiskHealthSource {
+	manager.diskHealthMutex.RLock()
+	defer manager.diskHealthMutex.RUnlock()
+	return manager.diskHealthSource
+}
+
+// Tell if any disk of the node is reported failing or prefail.
+func (manager *SpaceManager) hasUnhealthyDisk() bool {
+	for _, disk := range manager.GetDisks() {
+		if health, _ := disk.Health(); isUnhealthy(health) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHealth records the SMART health of the disk, for the monitors pushing the health instead of being queried.
+func (d *Disk) SetHealth(health, detail string) {
+	h := &d.health
+	h.Lock()
+	if h.health != health && isUnhealthy(health) {
+		log.LogWarnf("action[SetHealth] disk(%v) health from (%v) to (%v) detail(%v), no partition is created on it.",
+			d.Path, h.health, health, detail)
+	}
+	h.health, h.detail = health, detail
+	h.Unlock()
+}
+
+// Health returns the SMART health of the disk reported last.
+func (d *Disk) Health() (health, detail string) {
+	h := &d.health
+	h.Lock()
+	defer h.Unlock()
+	return h.health, h.detail
+}
+
+// Query the health of the disk from the source if installed. The health reported last is kept if the query
+// fails, so a flaky monitor neither blocks nor allows the creations.
+func (d *Disk) refreshHealth() {
+	if d.space == nil {
+		return
+	}
+	source := d.space.getDiskHealthSource()
+	if source == nil {
+		return
+	}
+	health, detail, err := source.DiskHealth(d.Path)
+	if err != nil {
+		log.LogWarnf("action[refreshHealth] disk(%v) query the health err(%v), keep the one reported last.", d.Path, err)
+		return
+	}
+	d.SetHealth(health, detail)
+}
+
+// Check the disk is not known to be dying before a partition is created on it.
+func (d *Disk) checkHealthToCreate() (err error) {
+	d.refreshHealth()
+	if health, detail := d.Health(); isUnhealthy(health) {
+		return &DiskHealthError{Path: d.Path, Health: health, Detail: detail}
+	}
+	return nil
+}
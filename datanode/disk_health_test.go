@@ -0,0 +1,81 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestDiskHealth(t *testing.T) {
+	space := &SpaceManager{disks: make(map[string]*Disk)}
+	dying := &Disk{Path: "/data0", Total: 100 * util.GB, Available: 50 * util.GB, Status: proto.ReadWrite, space: space}
+	healthy := &Disk{Path: "/data1", Total: 100 * util.GB, Available: 50 * util.GB, Allocated: 20 * util.GB,
+		Status: proto.ReadWrite, space: space}
+	space.disks[dying.Path], space.disks[healthy.Path] = dying, healthy
+
+	// no source installed
+	if err := dying.checkHealthToCreate(); err != nil {
+		t.Fatalf("disk of unknown health refused: %v", err)
+	}
+	if disk := space.minPartitionCnt(); disk != dying {
+		t.Fatalf("disk(%v) picked, expected the least allocated %v", disk.Path, dying.Path)
+	}
+
+	var queryErr error
+	space.SetDiskHealthSource(DiskHealthSourceFunc(func(diskPath string) (string, string, error) {
+		if diskPath == dying.Path {
+			return DiskHealthPrefail, "Reallocated_Sector_Ct", queryErr
+		}
+		return DiskHealthPassed, "", queryErr
+	}))
+	err := dying.checkHealthToCreate()
+	if !IsDiskHealthError(err) || !strings.Contains(err.Error(), DiskHealthPrefail) {
+		t.Fatalf("prefail disk checked err(%v)", err)
+	}
+	if err = healthy.checkHealthToCreate(); err != nil {
+		t.Fatalf("healthy disk refused: %v", err)
+	}
+	if disk := space.minPartitionCnt(); disk != healthy {
+		t.Fatalf("disk(%v) picked, expected the healthy %v", disk.Path, healthy.Path)
+	}
+	// the capacity to create the partitions reported to the master leaves the dying disk out
+	dying.Unallocated, healthy.Unallocated = 80*util.GB, 30*util.GB
+	space.stats = NewStats("")
+	space.updateMetrics()
+	if space.stats.RemainingCapacityToCreatePartition != healthy.Unallocated ||
+		space.stats.MaxCapacityToCreatePartition != healthy.Unallocated || space.stats.Total != 200*util.GB {
+		t.Fatalf("unexpected stats(%+v) with a dying disk", space.stats)
+	}
+
+	// a failed query keeps the health reported last
+	queryErr = errors.New("smartctl timeout")
+	if err = dying.checkHealthToCreate(); !IsDiskHealthError(err) {
+		t.Fatalf("prefail disk allowed by a failed query: %v", err)
+	}
+
+	// pushed by the monitor
+	healthy.SetHealth(DiskHealthFailing, "SMART overall-health self-assessment failed")
+	if disk := space.minPartitionCnt(); disk != nil {
+		t.Fatalf("disk(%v) picked while all the disks are dying", disk.Path)
+	}
+	if !space.hasUnhealthyDisk() {
+		t.Fatal("dying disks not found")
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestDiskIOErrorsTakePartitionsDown(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{1024: 10}))
+	dp.partitionSize = 1024
+	dp.usageUpdateInterval = IntervalToUpdatePartitionSize
+	dp.intervalToUpdatePartitionSize = time.Now().Unix()
+	dp.disk = &Disk{Status: proto.ReadWrite, MaxErrCnt: 2, space: &SpaceManager{nearFullRatio: DefaultNearFullRatio}}
+	dp.partitionStatus = proto.ReadWrite
+
+	// the errors out of the window are not counted
+	dp.disk.ioErrors.add(time.Now().Add(-DiskErrWindow - time.Minute))
+	dp.disk.incReadErrCnt()
+	dp.disk.incWriteErrCnt()
+	dp.statusUpdate()
+	if dp.Status() != proto.ReadWrite || dp.disk.Status != proto.ReadWrite {
+		t.Fatalf("partition status(%v) disk status(%v) with the errors tolerated", dp.Status(), dp.disk.Status)
+	}
+	if count := dp.disk.ioErrors.count(time.Now()); count != 2 {
+		t.Fatalf("io errors(%v) within the window, expected 2", count)
+	}
+	dp.disk.incReadErrCnt()
+	dp.statusUpdate()
+	if dp.Status() != proto.Unavailable || dp.disk.Status != proto.Unavailable {
+		t.Fatalf("partition status(%v) disk status(%v) with the errors exceeding", dp.Status(), dp.disk.Status)
+	}
+
+	// the disk and its partitions recover once the window passes without the errors
+	dp.disk.partitionMap = map[uint64]*DataPartition{dp.partitionID: dp}
+	dp.disk.ioErrors.times = []time.Time{time.Now().Add(-time.Minute)}
+	dp.statusUpdate()
+	if dp.Status() != proto.Unavailable || dp.disk.Status != proto.Unavailable {
+		t.Fatalf("partition status(%v) disk status(%v) with the errors in the window", dp.Status(), dp.disk.Status)
+	}
+	dp.disk.ioErrors.times = []time.Time{time.Now().Add(-DiskErrWindow - time.Minute)}
+	dp.statusUpdate()
+	if dp.Status() != proto.ReadWrite || dp.disk.Status != proto.ReadWrite {
+		t.Fatalf("partition status(%v) disk status(%v) after the window without errors", dp.Status(), dp.disk.Status)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The lifecycle events of the partitions written to the event log.
+const (
+	EventPartitionCreate  = "create"
+	EventPartitionLoad    = "load"
+	EventStatusChange     = "status_change"
+	EventRepairStart      = "repair_start"
+	EventRepairEnd        = "repair_end"
+	EventMembershipChange = "membership_change"
+	EventManualReadOnly   = "manual_read_only"
+	EventExtentExpiry     = "extent_expiry"
+	EventPeersMismatch    = "peers_mismatch"
+	EventPartitionMove    = "move"
+	EventLeaderTransfer   = "leader_transfer"
+)
+
+// PartitionEvent is a lifecycle event of a partition, written as a line of json into the event log.
+// The field names are kept stable for the log pipelines parsing them.
+type PartitionEvent struct {
+	Time        string `json:"time"`
+	Node        string `json:"node"`
+	PartitionID uint64 `json:"partition_id"`
+	Volume      string `json:"volume"`
+	Event       string `json:"event"`
+	Detail      string `json:"detail"`
+}
+
+type eventLog struct {
+	sync.Mutex
+	file *os.File
+}
+
+// The event log is shared by all the partitions on the node, and is disabled unless eventLogFile is configured.
+var partitionEventLog = &eventLog{}
+
+func (l *eventLog) open(fileName string) (err error) {
+	var file *os.File
+	if file, err = os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666); err != nil {
+		return
+	}
+	l.Lock()
+	l.file = file
+	l.Unlock()
+	return
+}
+
+func (l *eventLog) close() {
+	l.Lock()
+	defer l.Unlock()
+	if l.file == nil {
+		return
+	}
+	l.file.Close()
+	l.file = nil
+}
+
+func (l *eventLog) enabled() bool {
+	l.Lock()
+	defer l.Unlock()
+	return l.file != nil
+}
+
+func (l *eventLog) write(event *PartitionEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+	l.Lock()
+	defer l.Unlock()
+	if l.file == nil {
+		return
+	}
+	if _, err = l.file.Write(data); err != nil {
+		log.LogErrorf("action[eventLog] write event(%v) err(%v).", string(data), err)
+	}
+}
+
+// Write a lifecycle event of the partition into the event log, in addition to the plain logs.
+func (dp *DataPartition) logEvent(event string, format string, args ...interface{}) {
+	if !partitionEventLog.enabled() {
+		return
+	}
+	partitionEventLog.write(&PartitionEvent{
+		Time:        time.Now().Format(time.RFC3339),
+		Node:        LocalIP,
+		PartitionID: dp.partitionID,
+		Volume:      dp.volumeID,
+		Event:       event,
+		Detail:      fmt.Sprintf(format, args...),
+	})
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+// ExtentStorer is the extent store a data partition depends on, which is implemented by storage.ExtentStore.
+// It has the methods called by the data node, so the partition logic can be tested against a store in memory.
+type ExtentStorer interface {
+	// extents
+	Create(extentID, inode uint64) (err error)
+	HasExtent(extentID uint64) (exist bool)
+	Write(extentID uint64, offset, size int64, data []byte, crc uint32, writeType int, isSync bool) (err error)
+	SyncExtent(extentID uint64) (err error)
+	Read(extentID uint64, offset, size int64, nbuf []byte, isRepairRead bool) (crc uint32, err error)
+	MarkDelete(extentID uint64, offset, size int64) (err error)
+	NextExtentID() (extentID uint64, err error)
+	GetExtentCount() (count int)
+	ScanBlocks(extentID uint64) (bcs []*storage.BlockCrc, err error)
+	AutoComputeExtentCrc()
+	FlushDelete() (err error)
+	PendingDeletes() int64
+	Close()
+
+	// watermarks and snapshots
+	Watermark(extentID uint64) (ei *storage.ExtentInfo, err error)
+	GetAllWatermarks(filter storage.ExtentFilter) (extents []*storage.ExtentInfo, tinyDeleteFileSize int64, err error)
+	SnapShot() (files []*proto.File, err error)
+	RangeSnapShot(fn func(file *proto.File) bool)
+	ExportSnapshot() (extents []*storage.ExtentInfo, baseExtentID uint64)
+	StoreSizeExtentID(maxExtentID uint64) (totalSize uint64)
+	GetMaxExtentIDAndPartitionSize() (maxExtentID, totalSize uint64)
+	ChangeSeq() uint64
+	ChangedExtentsSince(seq uint64) (extentIDs []uint64, current uint64, ok bool)
+	ExtentSnapShot(extentID uint64, file *proto.File) (in, unsettled bool)
+	UnsettledExtents() (extentIDs []uint64)
+
+	// tiny extents
+	GetAvailableTinyExtent() (extentID uint64, err error)
+	GetBrokenTinyExtent() (extentID uint64, err error)
+	SendToAvailableTinyExtentC(extentID uint64)
+	SendToBrokenTinyExtentC(extentID uint64)
+	SendAllToBrokenTinyExtentC(extentIds []uint64)
+	MoveAllToBrokenTinyExtentC(cnt int)
+	AvailableTinyExtentCnt() int
+	BrokenTinyExtentCnt() int
+	PeekBrokenTinyExtents(limit int) (extentIDs []uint64)
+	TakeTinyExtents(extentIDs []uint64) (taken []uint64)
+	TakeAvailableTinyExtents(extentIDs []uint64) (taken []uint64)
+	GetTinyExtentOffset(extentID uint64) (watermark int64, err error)
+	TinyExtentRecover(extentID uint64, offset, size int64, data []byte, crc uint32, isEmptyPacket bool) (err error)
+	TinyExtentGetFinfoSize(extentID uint64) (size uint64, err error)
+	TinyExtentAvaliOffset(extentID uint64, offset int64) (newOffset, newEnd int64, err error)
+	PunchTinyZeroPages(extentID uint64, offset, size int64) (err error)
+	ReplayTinyDeletes(extentID uint64) (err error)
+	LoadTinyDeleteFileOffset() (offset int64, err error)
+	ReadTinyDeleteRecords(offset, size int64, data []byte) (crc uint32, err error)
+
+	// used space
+	UsedSize() (used int64, ok bool)
+	ResetUsedSize(used int64)
+	MarkUsageDirty()
+}
+
+var _ ExtentStorer = (*storage.ExtentStore)(nil)
+
+// newExtentStore creates the extent store of a partition, it can be replaced to inject a store in the tests.
+// The extents are sealed by the cipher if it is not nil.
+var newExtentStore = func(dataDir string, partitionID uint64, storeSize int, c *storage.ExtentCipher) (store ExtentStorer, err error) {
+	var extentStore *storage.ExtentStore
+	if extentStore, err = storage.NewEncryptedExtentStore(dataDir, partitionID, storeSize, c); err != nil {
+		return
+	}
+	return extentStore, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"hash/crc32"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+// mockExtentStore keeps the sizes of the extents in the memory, the methods not overridden panic.
+type mockExtentStore struct {
+	ExtentStorer
+	sync.Mutex
+	sizes   map[uint64]uint64
+	created []uint64
+	data    map[uint64][]byte
+}
+
+func newMockExtentStore(sizes map[uint64]uint64) *mockExtentStore {
+	return &mockExtentStore{sizes: sizes}
+}
+
+func (s *mockExtentStore) Create(extentID, inode uint64) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.sizes[extentID] = 0
+	s.created = append(s.created, extentID)
+	return
+}
+
+func (s *mockExtentStore) HasExtent(extentID uint64) (exist bool) {
+	s.Lock()
+	defer s.Unlock()
+	_, exist = s.sizes[extentID]
+	return
+}
+
+func (s *mockExtentStore) Watermark(extentID uint64) (ei *storage.ExtentInfo, err error) {
+	s.Lock()
+	defer s.Unlock()
+	return &storage.ExtentInfo{FileID: extentID, Size: s.sizes[extentID]}, nil
+}
+
+func (s *mockExtentStore) Read(extentID uint64, offset, size int64, nbuf []byte, isRepairRead bool) (crc uint32, err error) {
+	s.Lock()
+	defer s.Unlock()
+	data := s.data[extentID]
+	if offset+size > int64(len(data)) {
+		return 0, io.EOF
+	}
+	copy(nbuf, data[offset:offset+size])
+	return crc32.ChecksumIEEE(nbuf[:size]), nil
+}
+
+func (s *mockExtentStore) LoadTinyDeleteFileOffset() (offset int64, err error) {
+	return
+}
+
+func (s *mockExtentStore) BrokenTinyExtentCnt() int {
+	return 0
+}
+
+func (s *mockExtentStore) GetExtentCount() (count int) {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.sizes)
+}
+
+func (s *mockExtentStore) UsedSize() (used int64, ok bool) {
+	s.Lock()
+	defer s.Unlock()
+	for _, size := range s.sizes {
+		used += int64(size)
+	}
+	return used, true
+}
+
+// Peers of the partitions whose metadata is persisted by the tests.
+var testPeers = []proto.Peer{{ID: 1, Addr: "192.168.0.11:17310"}, {ID: 2, Addr: "192.168.0.12:17310"}}
+
+func newMockPartition(store ExtentStorer) (dp *DataPartition) {
+	dp = &DataPartition{
+		partitionID:            1,
+		extentStore:            store,
+		inflightExtents:        make(map[uint64]bool),
+		FullSyncTinyDeleteTime: time.Now().Unix(),
+		metrics:                NewDataPartitionMetrics(1, 0),
+	}
+	dp.initLockOrder()
+	dp.initRepairConds()
+	dp.SetRepairConcurrency(0)
+	return
+}
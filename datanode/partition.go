@@ -15,15 +15,18 @@
 package datanode
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math"
+	"math/rand"
 	"os"
 	"path"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"hash/crc32"
@@ -35,9 +38,11 @@ import (
 	"github.com/chubaofs/chubaofs/raftstore"
 	"github.com/chubaofs/chubaofs/repl"
 	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/tiglabs/raft"
 	raftProto "github.com/tiglabs/raft/proto"
 )
 
@@ -45,12 +50,21 @@ const (
 	DataPartitionPrefix           = "datapartition"
 	DataPartitionMetadataFileName = "META"
 	TempMetadataFileName          = ".meta"
+	MetadataBackupFileName        = "META.bak"
+	TempMetadataBackupFileName    = ".meta.bak"
 	ApplyIndexFile                = "APPLY"
 	TempApplyIndexFile            = ".apply"
 	TimeLayout                    = "2006-01-02 15:04:05"
 )
 
+// DataPartitionMetadataVersion is the version of the metadata persisted by this data node. The metadata of
+// the versions before carry no version and are read as version 0. A data node refuses to load the metadata of
+// a version newer than it knows, whose fields it would drop on the next persistence. Version 2 adds the
+// encryption of the extents, which a data node of version 1 would lose track of.
+const DataPartitionMetadataVersion = 2
+
 type DataPartitionMetadata struct {
+	Version                 int `json:",omitempty"`
 	VolumeID                string
 	PartitionID             uint64
 	PartitionSize           int
@@ -59,6 +73,17 @@ type DataPartitionMetadata struct {
 	Hosts                   []string
 	DataPartitionCreateType int
 	LastTruncateID          uint64
+	ManualReadOnly          bool
+	LogicalSize             int    `json:",omitempty"` // the size set by ResizePartition, the dir name keeps the size on creation
+	Frozen                  bool   `json:",omitempty"`
+	FrozenReason            string `json:",omitempty"`
+	RestartCount            uint64 `json:",omitempty"` // times the partition is loaded since its creation
+	ReadOnlySetBy           string `json:",omitempty"` // the operator changed the manual read-only state last
+	ReadOnlySetTime         string `json:",omitempty"`
+	ExtentTTL               int64  `json:",omitempty"` // seconds the extents expire after, 0 follows the volume
+	Encrypted               bool   `json:",omitempty"` // the extents are sealed by the key of the volume
+	TinySize                int    `json:",omitempty"` // size limit of the files in the tiny extents on creation, 0 follows the data node
+	Checksum                uint32 // crc32 of the metadata with the checksum set to zero
 }
 
 type sortedPeers []proto.Peer
@@ -75,12 +100,105 @@ func (sp sortedPeers) Swap(i, j int) {
 	sp[i], sp[j] = sp[j], sp[i]
 }
 
+// ComputeChecksum computes the crc32 over the json of the metadata without the checksum itself.
+func (md *DataPartitionMetadata) ComputeChecksum() (checksum uint32, err error) {
+	var data []byte
+	origin := *md
+	origin.Checksum = 0
+	if data, err = json.Marshal(&origin); err != nil {
+		return
+	}
+	checksum = crc32.ChecksumIEEE(data)
+	return
+}
+
+// VerifyChecksum checks the integrity of the metadata. The metadata persisted by the
+// previous versions carry no checksum, and they are regarded as unverified.
+func (md *DataPartitionMetadata) VerifyChecksum() (verified bool, err error) {
+	if md.Checksum == 0 {
+		return
+	}
+	var checksum uint32
+	if checksum, err = md.ComputeChecksum(); err != nil {
+		return
+	}
+	if checksum != md.Checksum {
+		err = ErrMetadataCorrupted
+		return
+	}
+	verified = true
+	return
+}
+
+// MetadataVersionError is the error of loading the metadata persisted by a newer data node.
+type MetadataVersionError struct {
+	Version   int
+	Supported int
+}
+
+func (e *MetadataVersionError) Error() string {
+	return fmt.Sprintf("Data partition metadata version(%v) is newer than the supported version(%v), upgrade the data node to load it",
+		e.Version, e.Supported)
+}
+
+// IsMetadataVersionError tells if the error is the one of the metadata of an unsupported version.
+func IsMetadataVersionError(err error) bool {
+	_, ok := err.(*MetadataVersionError)
+	return ok
+}
+
+// Check the version of the metadata before the checksum, since the checksum of the metadata of a newer
+// version covers the fields unknown here and fails as a corruption.
+func (md *DataPartitionMetadata) checkVersion() (err error) {
+	if md.Version > DataPartitionMetadataVersion {
+		return &MetadataVersionError{Version: md.Version, Supported: DataPartitionMetadataVersion}
+	}
+	return
+}
+
+// Default the fields the metadata of the older versions lack, a version at a time, and mark the metadata with
+// the current version, which is persisted on the next PersistMetadata.
+func (md *DataPartitionMetadata) upgrade() {
+	// the fields added before version 1 are all off by the zero value. The creation time left empty by the
+	// oldest versions stays empty, since when the partition was created is unknown.
+	// the partitions before version 2 are all kept in plaintext, which the zero Encrypted stands for.
+	md.Version = DataPartitionMetadataVersion
+}
+
 func (md *DataPartitionMetadata) Validate() (err error) {
 	md.VolumeID = strings.TrimSpace(md.VolumeID)
 	if len(md.VolumeID) == 0 || md.PartitionID == 0 || md.PartitionSize == 0 {
 		err = errors.New("illegal data partition metadata")
 		return
 	}
+	err = validatePeers(md.Peers)
+	return
+}
+
+// Check the peers in the metadata, so that the broken ones fail the load of the partition with the peer
+// named, instead of the start of the raft later.
+func validatePeers(peers []proto.Peer) (err error) {
+	if len(peers) == 0 {
+		return errors.New("illegal data partition metadata: no peers")
+	}
+	ids := make(map[uint64]string, len(peers))
+	for _, peer := range peers {
+		if peer.ID == 0 {
+			return fmt.Errorf("illegal data partition metadata: peer(%v) has no id", peer.Addr)
+		}
+		host, port, splitErr := net.SplitHostPort(peer.Addr)
+		if splitErr != nil {
+			return fmt.Errorf("illegal data partition metadata: peer(%v) addr(%v): %v", peer.ID, peer.Addr, splitErr)
+		}
+		if _, portErr := strconv.ParseUint(port, 10, 16); host == "" || portErr != nil {
+			return fmt.Errorf("illegal data partition metadata: peer(%v) addr(%v) is not host:port", peer.ID, peer.Addr)
+		}
+		if addr, ok := ids[peer.ID]; ok {
+			return fmt.Errorf("illegal data partition metadata: peer(%v) duplicated by addr(%v) and addr(%v)",
+				peer.ID, addr, peer.Addr)
+		}
+		ids[peer.ID] = peer.Addr
+	}
 	return
 }
 
@@ -89,15 +207,15 @@ type DataPartition struct {
 	volumeID        string
 	partitionID     uint64
 	partitionStatus int
-	partitionSize   int
+	partitionSize   int64    // accessed atomically, since a resize applied by raft changes it
 	replicas        []string // addresses of the replicas
-	replicasLock    sync.RWMutex
+	replicasLock    orderedRWMutex
 	disk            *Disk
 	isLeader        bool
 	isRaftLeader    bool
 	path            string
 	used            int
-	extentStore     *storage.ExtentStore
+	extentStore     ExtentStorer
 	raftPartition   raftstore.Partition
 	config          *dataPartitionCfg
 	appliedID       uint64 // apply id used in Raft
@@ -107,21 +225,90 @@ type DataPartition struct {
 	stopRaftC       chan uint64
 	storeC          chan uint64
 	stopC           chan bool
+	stopOnce        sync.Once
 
 	intervalToUpdateReplicas      int64 // interval to ask the master for updating the replica information
 	snapshot                      []*proto.File
-	snapshotMutex                 sync.RWMutex
-	intervalToUpdatePartitionSize int64
+	snapshotMutex                 orderedRWMutex
+	intervalToUpdatePartitionSize int64 // last time the used space was computed
+	usageUpdateInterval           int64 // seconds between two computations of the used space
+	usageLock                     orderedMutex
+	lastUsageReconcileTime        int64 // last time the used space was computed by walking the directory
+	metrics                       *DataPartitionMetrics
 	loadExtentHeaderStatus        int
 	FullSyncTinyDeleteTime        int64
 	DataPartitionCreateType       int
+
+	repairStats       RepairStats
+	repairStatsLock   orderedMutex
+	repairConcurrency int32
+	isRepairing       int32
+	repairingLock     sync.Mutex
+	repairingCond     *sync.Cond // broadcast on repairingLock once the repair cycle returns
+	repairLaunching   int32      // a scheduled repair cycle is waiting for the slot or running
+	repairJobID       string     // id of the latest repair launched by the operator
+	repairJobLock     sync.Mutex
+	isDraining        int32
+	isMoving          int32           // being moved to another disk, see MovePartitionToDisk
+	inflightExtents   map[uint64]bool // extents being repaired
+	inflightLock      orderedMutex
+	inflightCond      *sync.Cond // broadcast on inflightLock once no extent is being repaired
+	extentTTL         int64      // seconds after the creation the extents expire, 0 follows the volume, see ExtentTTL
+	nearFull          bool       // still writable, but the used space reaches the soft limit
+	loadTime          int64      // when the partition is created or loaded by this process
+	restartCount      uint64     // times the partition is loaded since its creation, persisted in the metadata
+	createTime        string     // set on the creation of the partition and kept in the metadata since then, empty if unknown
+	resizeLock        orderedMutex
+	persistLock       orderedMutex // serializes the writes of the META and APPLY files, which use fixed temp files
+	compactor         tinyCompactor
+	quarantine        extentQuarantine // extents excluded from the automatic repair
+	noSource          noSourceExtents  // extents whose repair sources can not be reached
+	extentShards      int              // shard directories of the normal extents, 0 if flat
+
+	applyIDPersistence applyIDPersistence
+	raftReadiness      raftReadiness
+	repairCycleResult  repairCycleResult
+	readRepairer       readRepairer
+	tinyRepairBatch    tinyRepairBatch
+	usageHistory       usageHistory
+	repairVerifier     repairVerifier
+	activeRepairs      activeRepairs
+	snapshotReload     snapshotReload
+	repairSource       repairSource
+	extentExpiry       extentExpiry
+	membershipCheck    membershipCheck
+	extentAccess       extentAccess
+	extentFsync        extentFsync
+	extentWarmUp       extentWarmUp
+	deleteAudit        deleteAudit
+	storeQueue         storeQueue
+	manualReadOnly     manualReadOnly // set by the operator to stop writing regardless of the usage
+	frozen             frozenState    // kept unavailable by the operator for an investigation, see Freeze
+
+	statusChangeHandler     func(old, new int)
+	statusChangeHandlerLock orderedRWMutex
+	statusChangeC           chan *statusChangeEvent
+	startStatusDispatcher   sync.Once
 }
 
-func CreateDataPartition(dpCfg *dataPartitionCfg, disk *Disk, request *proto.CreateDataPartitionRequest) (dp *DataPartition, err error) {
+type statusChangeEvent struct {
+	old int
+	new int
+}
 
+func CreateDataPartition(dpCfg *dataPartitionCfg, disk *Disk, request *proto.CreateDataPartitionRequest) (dp *DataPartition, err error) {
+	if err = disk.checkHealthToCreate(); err != nil {
+		log.LogErrorf("action[CreateDataPartition] partition(%v) err(%v).", dpCfg.PartitionID, err)
+		return
+	}
+	if err = disk.checkSpaceToCreate(dpCfg.PartitionSize); err != nil {
+		log.LogErrorf("action[CreateDataPartition] partition(%v) err(%v).", dpCfg.PartitionID, err)
+		return
+	}
 	if dp, err = newDataPartition(dpCfg, disk); err != nil {
 		return
 	}
+	dp.createTime = time.Now().Format(TimeLayout)
 	dp.ForceLoadHeader()
 	if request.CreateType == proto.NormalCreateDataPartition {
 		err = dp.StartRaft()
@@ -137,6 +324,8 @@ func CreateDataPartition(dpCfg *dataPartitionCfg, disk *Disk, request *proto.Cre
 	dp.DataPartitionCreateType = request.CreateType
 	err = dp.PersistMetadata()
 	disk.AddSize(uint64(dp.Size()))
+	dp.logEvent(EventPartitionCreate, "size(%v) createType(%v) peers(%v) disk(%v)",
+		dp.Size(), request.CreateType, dp.config.Peers, disk.Path)
 	return
 }
 
@@ -168,52 +357,244 @@ func (dp *DataPartition) IsEquareCreateDataPartitionRequst(request *proto.Create
 // and creates the partition instance.
 func LoadDataPartition(partitionDir string, disk *Disk) (dp *DataPartition, err error) {
 	var (
-		metaFileData []byte
+		meta *DataPartitionMetadata
 	)
-	if metaFileData, err = ioutil.ReadFile(path.Join(partitionDir, DataPartitionMetadataFileName)); err != nil {
+	if err = checkExtentStoreDir(partitionDir, disk.space.GetRepairStoreFiles()); err != nil {
 		return
 	}
-	meta := &DataPartitionMetadata{}
-	if err = json.Unmarshal(metaFileData, meta); err != nil {
+	if meta, err = loadMetadata(partitionDir); err != nil {
 		return
 	}
-	if err = meta.Validate(); err != nil {
+	if _, err = checkPartitionSize(partitionDir, meta); err != nil {
 		return
 	}
+	cleanupTempFiles(partitionDir)
 
 	dpCfg := &dataPartitionCfg{
 		VolName:       meta.VolumeID,
 		PartitionSize: meta.PartitionSize,
+		LogicalSize:   meta.LogicalSize,
 		PartitionID:   meta.PartitionID,
 		Peers:         meta.Peers,
 		Hosts:         meta.Hosts,
 		RaftStore:     disk.space.GetRaftStore(),
 		NodeID:        disk.space.GetNodeID(),
 		ClusterID:     disk.space.GetClusterID(),
+
+		RepairConcurrency:   disk.space.GetRepairConcurrency(),
+		UsageUpdateInterval: disk.space.GetUsageUpdateInterval(),
+		LatencyWindow:       disk.space.GetLatencyWindow(),
+		Encrypted:           meta.Encrypted,
+		TinySize:            meta.TinySize,
+	}
+	if dpCfg.TinySize == 0 {
+		dpCfg.TinySize = disk.space.GetTinySize()
+	}
+	if !meta.Encrypted && disk.space.IsVolumeEncrypted(meta.VolumeID) {
+		log.LogWarnf("action[LoadDataPartition] partition(%v) of the encrypted volume(%v) was created in plaintext and stays so.",
+			meta.PartitionID, meta.VolumeID)
 	}
+	dpCfg.StatusInterval, dpCfg.SnapshotInterval, dpCfg.TickerJitter = disk.space.GetTickerIntervals()
+	dpCfg.ExtentShards, dpCfg.LayoutExtents = disk.space.GetExtentShards()
 	if dp, err = newDataPartition(dpCfg, disk); err != nil {
 		return
 	}
 	disk.space.AttachPartition(dp)
 	if err = dp.LoadAppliedID(); err != nil {
 		log.LogErrorf("action[loadApplyIndex] %v", err)
+		err = nil
 	}
 	log.LogInfof("Action(LoadDataPartition) PartitionID(%v) meta(%v)", dp.partitionID, meta)
 	dp.DataPartitionCreateType = meta.DataPartitionCreateType
 	dp.lastTruncateID = meta.LastTruncateID
+	dp.manualReadOnly.set(meta.ManualReadOnly, meta.ReadOnlySetBy, meta.ReadOnlySetTime)
+	dp.extentTTL = meta.ExtentTTL
+	dp.createTime = meta.CreateTime
+	if meta.Frozen {
+		dp.frozen.set(true, meta.FrozenReason)
+		dp.partitionStatus = proto.Unavailable
+		log.LogWarnf("action[LoadDataPartition] partition(%v) loaded frozen, reason(%v).", dp.partitionID, meta.FrozenReason)
+	}
+	// the peers are corrected before the raft is started, which is what applies the member changes
+	correctPeers := disk.space.GetReconcilePeers()
+	if correctPeers {
+		dp.reconcilePeers(true)
+	}
+	dp.restartCount = meta.RestartCount + 1
+	if err = dp.PersistMetadata(); err != nil {
+		log.LogErrorf("action[LoadDataPartition] partition(%v) persist restart count(%v) err(%v).",
+			dp.partitionID, dp.restartCount, err)
+		err = nil
+	}
+	// the raft is started in the background, see RaftReady and WaitRaftReady.
 	if meta.DataPartitionCreateType == proto.NormalCreateDataPartition {
-		err = dp.StartRaft()
+		go dp.startRaftOnLoad()
 	} else {
 		go dp.StartRaftAfterRepair()
 	}
-	if err != nil {
-		log.LogErrorf("PartitionID(%v) start raft err(%v)..", dp.partitionID, err)
-		disk.space.DetachDataPartition(dp.partitionID)
-	}
 
 	go dp.StartRaftLoggingSchedule()
+	if !correctPeers {
+		go dp.reconcilePeers(false)
+	}
 	disk.AddSize(uint64(dp.Size()))
 	dp.ForceLoadHeader()
+	dp.logEvent(EventPartitionLoad, "size(%v) createType(%v) peers(%v) disk(%v)",
+		dp.Size(), meta.DataPartitionCreateType, meta.Peers, disk.Path)
+	dp.startWarmUp()
+	return
+}
+
+// Load the partition metadata from the META file, and fall back to the backup
+// file if the META file is missing or broken.
+func loadMetadata(partitionDir string) (meta *DataPartitionMetadata, err error) {
+	if meta, err = readMetadataFile(path.Join(partitionDir, DataPartitionMetadataFileName)); err == nil {
+		log.LogInfof("action[loadMetadata] dir(%v) load metadata from %v.", partitionDir, DataPartitionMetadataFileName)
+		return
+	}
+	if err == ErrMetadataCorrupted {
+		// do not hide the corruption behind the backup, the operator has to check the disk.
+		log.LogErrorf("action[loadMetadata] dir(%v) load %v err(%v).", partitionDir, DataPartitionMetadataFileName, err)
+		exporter.Warning(fmt.Sprintf("data partition metadata corrupted: dir(%v) on %v", partitionDir, LocalIP))
+		return
+	}
+	if IsMetadataVersionError(err) {
+		// the backup is either of the same version or older than the metadata, loading it would roll back
+		// the changes made by the newer data node.
+		log.LogErrorf("action[loadMetadata] dir(%v) load %v err(%v).", partitionDir, DataPartitionMetadataFileName, err)
+		exporter.Warning(fmt.Sprintf("data partition metadata of unsupported version: dir(%v) on %v: %v", partitionDir, LocalIP, err))
+		return
+	}
+	log.LogWarnf("action[loadMetadata] dir(%v) load %v err(%v), try %v.",
+		partitionDir, DataPartitionMetadataFileName, err, MetadataBackupFileName)
+	var backupErr error
+	if meta, backupErr = readMetadataFile(path.Join(partitionDir, MetadataBackupFileName)); backupErr != nil {
+		log.LogErrorf("action[loadMetadata] dir(%v) load %v err(%v).", partitionDir, MetadataBackupFileName, backupErr)
+		return
+	}
+	log.LogWarnf("action[loadMetadata] dir(%v) load metadata from %v created at %v.",
+		partitionDir, MetadataBackupFileName, meta.CreateTime)
+	err = nil
+	return
+}
+
+// Remove the temp files left by a crash in the middle of writing the metadata or the applied id.
+// A temp file is only removed if the file it would have replaced is valid, so the only good copy is never discarded.
+func cleanupTempFiles(partitionDir string) {
+	tempFiles := []struct {
+		tempFileName string
+		fileName     string
+		validate     func(fileName string) error
+	}{
+		{TempMetadataFileName, DataPartitionMetadataFileName, validateMetadataFile},
+		{TempMetadataBackupFileName, MetadataBackupFileName, validateMetadataFile},
+		{TempApplyIndexFile, ApplyIndexFile, validateApplyIndexFile},
+	}
+	for _, f := range tempFiles {
+		tempFile := path.Join(partitionDir, f.tempFileName)
+		if _, err := os.Stat(tempFile); err != nil {
+			continue
+		}
+		if err := f.validate(path.Join(partitionDir, f.fileName)); err != nil {
+			log.LogWarnf("action[cleanupTempFiles] dir(%v) keep %v since %v is invalid: %v.",
+				partitionDir, f.tempFileName, f.fileName, err)
+			continue
+		}
+		if err := os.Remove(tempFile); err != nil {
+			log.LogErrorf("action[cleanupTempFiles] dir(%v) remove %v err(%v).", partitionDir, f.tempFileName, err)
+			continue
+		}
+		log.LogWarnf("action[cleanupTempFiles] dir(%v) removed stale %v.", partitionDir, f.tempFileName)
+	}
+}
+
+func validateMetadataFile(fileName string) (err error) {
+	_, err = readMetadataFile(fileName)
+	return
+}
+
+func validateApplyIndexFile(fileName string) (err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+	var appliedID uint64
+	if _, err = fmt.Sscanf(string(data), "%d", &appliedID); err != nil {
+		return
+	}
+	return
+}
+
+// Check the partition size in the metadata against the one in the name of the partition directory.
+// The directory name is trusted since the path of the partition is derived from it.
+func checkPartitionSize(partitionDir string, meta *DataPartitionMetadata) (dirSize int, err error) {
+	if _, dirSize, err = unmarshalPartitionName(path.Base(partitionDir)); err != nil {
+		return
+	}
+	if meta.PartitionSize != dirSize {
+		mesg := fmt.Sprintf("action[checkPartitionSize] dir(%v) partition size in metadata(%v) mismatches the one in dir name(%v) on %v",
+			partitionDir, meta.PartitionSize, dirSize, LocalIP)
+		log.LogErrorf("%v", mesg)
+		exporter.Warning(mesg)
+		err = ErrPartitionSizeMismatch
+	}
+	return
+}
+
+// RepairPartitionSize rewrites the partition size in the metadata with the one in the name of the partition directory.
+// It is supposed to be called after the operator confirms the mismatch reported by LoadDataPartition.
+func RepairPartitionSize(partitionDir string) (meta *DataPartitionMetadata, err error) {
+	var (
+		dirSize  int
+		metaData []byte
+	)
+	if meta, err = loadMetadata(partitionDir); err != nil {
+		return
+	}
+	if dirSize, err = checkPartitionSize(partitionDir, meta); err != ErrPartitionSizeMismatch {
+		return
+	}
+	log.LogWarnf("action[RepairPartitionSize] dir(%v) rewrite partition size from (%v) to (%v).",
+		partitionDir, meta.PartitionSize, dirSize)
+	meta.PartitionSize = dirSize
+	if meta.Checksum, err = meta.ComputeChecksum(); err != nil {
+		return
+	}
+	if metaData, err = json.Marshal(meta); err != nil {
+		return
+	}
+	if err = writeFileAtomically(partitionDir, TempMetadataFileName, DataPartitionMetadataFileName, metaData); err != nil {
+		return
+	}
+	err = writeFileAtomically(partitionDir, TempMetadataBackupFileName, MetadataBackupFileName, metaData)
+	return
+}
+
+func readMetadataFile(fileName string) (meta *DataPartitionMetadata, err error) {
+	var metaFileData []byte
+	if metaFileData, err = ioutil.ReadFile(fileName); err != nil {
+		return
+	}
+	meta = &DataPartitionMetadata{}
+	if err = json.Unmarshal(metaFileData, meta); err != nil {
+		return
+	}
+	if err = meta.checkVersion(); err != nil {
+		return
+	}
+	var verified bool
+	if verified, err = meta.VerifyChecksum(); err != nil {
+		return
+	}
+	if !verified {
+		log.LogWarnf("action[readMetadataFile] file(%v) has no checksum, metadata is unverified.", fileName)
+	}
+	if meta.Version < DataPartitionMetadataVersion {
+		log.LogInfof("action[readMetadataFile] file(%v) upgrade metadata from version(%v) to (%v).",
+			fileName, meta.Version, DataPartitionMetadataVersion)
+		meta.upgrade()
+	}
+	err = meta.Validate()
 	return
 }
 
@@ -226,20 +607,54 @@ func newDataPartition(dpCfg *dataPartitionCfg, disk *Disk) (dp *DataPartition, e
 		partitionID:     partitionID,
 		disk:            disk,
 		path:            dataPath,
-		partitionSize:   dpCfg.PartitionSize,
+		partitionSize:   int64(dpCfg.PartitionSize),
 		replicas:        make([]string, 0),
 		stopC:           make(chan bool, 0),
 		stopRaftC:       make(chan uint64, 0),
-		storeC:          make(chan uint64, 128),
+		storeC:          make(chan uint64, storeQueueCapacity(disk)),
 		snapshot:        make([]*proto.File, 0),
 		partitionStatus: proto.ReadWrite,
 		config:          dpCfg,
+		statusChangeC:   make(chan *statusChangeEvent, StatusChangeEventBufferSize),
+		inflightExtents: make(map[uint64]bool),
+		loadTime:        time.Now().Unix(),
+	}
+	partition.initLockOrder()
+	partition.initRepairConds()
+	if dpCfg.LogicalSize > 0 {
+		partition.partitionSize = int64(dpCfg.LogicalSize)
 	}
+	partition.usageUpdateInterval = dpCfg.UsageUpdateInterval
+	if partition.usageUpdateInterval <= 0 {
+		partition.usageUpdateInterval = IntervalToUpdatePartitionSize
+	}
+	partition.metrics = NewDataPartitionMetrics(partitionID, dpCfg.LatencyWindow)
 	partition.replicasInit()
-	partition.extentStore, err = storage.NewExtentStore(partition.path, dpCfg.PartitionID, dpCfg.PartitionSize)
+	if err = partition.SetRepairConcurrency(dpCfg.RepairConcurrency); err != nil {
+		log.LogWarnf("action[newDataPartition] partition(%v) err(%v), use default repair concurrency",
+			partitionID, err)
+		partition.SetRepairConcurrency(0)
+	}
+	var extentCipher *storage.ExtentCipher
+	if extentCipher, err = extentCipherOf(dpCfg, disk); err != nil {
+		err = newExtentStoreLoadError(ErrExtentStoreKeyUnavailable, partition.path, err)
+		return
+	}
+	if partition.extentShards, err = layoutPartitionExtents(dpCfg, partition.path); err != nil {
+		err = classifyExtentStoreError(partition.path, err)
+		return
+	}
+	partition.extentStore, err = newExtentStore(partition.path, dpCfg.PartitionID, dpCfg.PartitionSize, extentCipher)
 	if err != nil {
+		err = classifyExtentStoreError(partition.path, err)
 		return
 	}
+	if quarantineErr := partition.loadQuarantine(); quarantineErr != nil {
+		log.LogErrorf("action[newDataPartition] partition(%v) load quarantined extents err(%v).", partitionID, quarantineErr)
+	}
+	if accessErr := partition.loadExtentAccess(); accessErr != nil {
+		log.LogErrorf("action[newDataPartition] partition(%v) load extent access times err(%v).", partitionID, accessErr)
+	}
 
 	disk.AttachDataPartition(partition)
 	dp = partition
@@ -257,19 +672,32 @@ func (dp *DataPartition) replicasInit() {
 	}
 	dp.replicasLock.Lock()
 	dp.replicas = replicas
+	if dp.config.Hosts != nil && len(dp.config.Hosts) >= 1 && isLocalAddr(dp.config.Hosts[0]) {
+		dp.isLeader = true
+	}
 	dp.replicasLock.Unlock()
-	if dp.config.Hosts != nil && len(dp.config.Hosts) >= 1 {
-		leaderAddr := strings.Split(dp.config.Hosts[0], ":")
-		if len(leaderAddr) == 2 && strings.TrimSpace(leaderAddr[0]) == LocalIP {
-			dp.isLeader = true
-		}
+}
+
+// isLocalAddr tells if the given address in the form of host:port is on the local node.
+// Both the IPv4, the bracketed IPv6 and the host name forms are accepted.
+func isLocalAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(addr))
+	if err != nil {
+		return false
 	}
+	return host == LocalIP
 }
 
 func (dp *DataPartition) GetExtentCount() int {
 	return dp.extentStore.GetExtentCount()
 }
 
+// GetCreateTime returns the time when the partition was created, an error if it is unknown, e.g. lacked by the
+// metadata of the oldest versions.
+func (dp *DataPartition) GetCreateTime() (createTime time.Time, err error) {
+	return time.ParseInLocation(TimeLayout, dp.createTime, time.Local)
+}
+
 func (dp *DataPartition) Path() string {
 	return dp.path
 }
@@ -293,10 +721,20 @@ func (dp *DataPartition) IsRaftLeader() (addr string, ok bool) {
 	return
 }
 
-func (dp *DataPartition) Replicas() []string {
+// Replicas returns a copy of the replicas, since they are replaced by updateReplicas in the background.
+func (dp *DataPartition) Replicas() (replicas []string) {
+	dp.replicasLock.RLock()
+	defer dp.replicasLock.RUnlock()
+	replicas = make([]string, len(dp.replicas))
+	copy(replicas, dp.replicas)
+	return
+}
+
+// isRepairLeader tells if the local replica is the first one of the replicas, which leads the repair.
+func (dp *DataPartition) isRepairLeader() bool {
 	dp.replicasLock.RLock()
 	defer dp.replicasLock.RUnlock()
-	return dp.replicas
+	return dp.isLeader
 }
 
 func (dp *DataPartition) getReplicaAddr(index int) string {
@@ -322,20 +760,34 @@ func (dp *DataPartition) IsExsitReplica(addr string) bool {
 	return false
 }
 
+// ReloadSnapshot brings the snapshot up to date by the extents changed since the last reload, or rebuilds it
+// if the changes are too many. The new snapshot is built outside of the lock, which is held only to swap it in.
 func (dp *DataPartition) ReloadSnapshot() {
-	files, err := dp.extentStore.SnapShot()
-	if err != nil {
-		return
+	r := &dp.snapshotReload
+	r.Lock()
+	defer r.Unlock()
+	files, ok := dp.updateSnapshot(r)
+	if !ok {
+		var err error
+		if files, err = dp.rebuildSnapshot(r); err != nil {
+			return
+		}
 	}
 	dp.snapshotMutex.Lock()
-	for _, f := range dp.snapshot {
-		storage.PutSnapShotFileToPool(f)
-	}
 	dp.snapshot = files
 	dp.snapshotMutex.Unlock()
 }
 
-// Snapshot returns the snapshot of the data partition.
+// IterateExtents walks the current snapshot of the extents without building the whole list, until fn returns false.
+// The file passed to fn is only valid during the call. The load and the repair keep the lists, since the load
+// replies the cached snapshot to the master as it is, and the repair sends the watermarks to the other replicas.
+func (dp *DataPartition) IterateExtents(fn func(file *proto.File) bool) {
+	dp.extentStore.RangeSnapShot(fn)
+}
+
+// Snapshot returns the snapshot of the data partition. The snapshot is immutable once it is published, the
+// reload builds a new one with new files instead of changing it in place, and the files are never put back
+// to the pool. So the callers may keep iterating it while it is reloaded, but must not modify it.
 func (dp *DataPartition) SnapShot() (files []*proto.File) {
 	dp.snapshotMutex.RLock()
 	defer dp.snapshotMutex.RUnlock()
@@ -343,14 +795,145 @@ func (dp *DataPartition) SnapShot() (files []*proto.File) {
 	return dp.snapshot
 }
 
-// Stop close the store and the raft store.
+// CopySnapShot returns a copy of the snapshot of the data partition, for the callers to modify the files.
+func (dp *DataPartition) CopySnapShot() (files []*proto.File) {
+	dp.snapshotMutex.RLock()
+	defer dp.snapshotMutex.RUnlock()
+	files = make([]*proto.File, 0, len(dp.snapshot))
+	for _, f := range dp.snapshot {
+		file := *f
+		files = append(files, &file)
+	}
+	return
+}
+
+// Stop close the store and the raft store. It may be called more than once, such as by the drain and the
+// deletion of the partition, and only the first call stops it.
 func (dp *DataPartition) Stop() {
-	if dp.stopC != nil {
-		close(dp.stopC)
+	dp.stopOnce.Do(func() {
+		if dp.stopC != nil {
+			close(dp.stopC)
+		}
+		// Close the store and raftstore.
+		if dp.flushDelete(DeleteFlushTimeout) {
+			dp.closeDeleteAudit()
+			dp.extentStore.Close()
+		} else {
+			go func() {
+				dp.closeDeleteAudit()
+				dp.extentStore.Close()
+			}()
+		}
+		dp.stopRaft()
+	})
+}
+
+// Sync the delete records before the extent store is closed, so that the deleted extents do not come back
+// on the restart to be repaired. ok is false if it times out, and the caller should not wait for closing
+// the store, which syncs the same files on the stuck disk again. The access times of the extents are
+// persisted on the way, as they are written on the same disk.
+func (dp *DataPartition) flushDelete(timeout time.Duration) (ok bool) {
+	done := make(chan error, 1)
+	go func() {
+		dp.flushExtentAccess()
+		done <- dp.flushDeletes()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			log.LogErrorf("action[flushDelete] partition(%v) err(%v), %v deletes not synced may be repaired on the restart.",
+				dp.partitionID, err, dp.extentStore.PendingDeletes())
+		}
+		return true
+	case <-time.After(timeout):
+		log.LogErrorf("action[flushDelete] partition(%v) timeout after %v, %v deletes not synced may be repaired on the restart.",
+			dp.partitionID, timeout, dp.extentStore.PendingDeletes())
+		return false
 	}
-	// Close the store and raftstore.
-	dp.extentStore.Close()
-	dp.stopRaft()
+}
+
+// Drain stops accepting new repairs, waits for the extents being repaired until the timeout elapses,
+// and then stops the partition.
+func (dp *DataPartition) Drain(timeout time.Duration) {
+	atomic.StoreInt32(&dp.isDraining, 1)
+	dp.inflightLock.Lock()
+	drained := waitCondTimeout(dp.inflightCond, timeout, func() bool { return len(dp.inflightExtents) == 0 })
+	dp.inflightLock.Unlock()
+	if !drained {
+		log.LogWarnf("action[Drain] partition(%v) timeout after %v, extents(%v) are still being repaired.",
+			dp.partitionID, timeout, dp.inflightRepairExtents())
+	}
+	dp.Stop()
+}
+
+func (dp *DataPartition) initRepairConds() {
+	dp.repairingCond = sync.NewCond(&dp.repairingLock)
+	dp.inflightCond = sync.NewCond(&dp.inflightLock)
+}
+
+// Wait on the condition until done returns true or the timeout elapses, and tell if it is done. The caller
+// holds the lock of the condition, and whoever makes done true broadcasts the condition under the lock.
+func waitCondTimeout(cond *sync.Cond, timeout time.Duration, done func() bool) bool {
+	timedOut := false
+	timer := time.AfterFunc(timeout, func() {
+		cond.L.Lock()
+		timedOut = true
+		cond.Broadcast()
+		cond.L.Unlock()
+	})
+	defer timer.Stop()
+	for !done() && !timedOut {
+		cond.Wait()
+	}
+	return done()
+}
+
+// IsDraining tells if the partition is draining and refuses new repairs.
+func (dp *DataPartition) IsDraining() bool {
+	return atomic.LoadInt32(&dp.isDraining) == 1
+}
+
+func (dp *DataPartition) addInflightExtent(extentID uint64) {
+	dp.inflightLock.Lock()
+	dp.inflightExtents[extentID] = true
+	dp.inflightLock.Unlock()
+}
+
+// Add the extent being repaired unless it is added already, and tell if it is added by this call.
+func (dp *DataPartition) tryAddInflightExtent(extentID uint64) (added bool) {
+	dp.inflightLock.Lock()
+	defer dp.inflightLock.Unlock()
+	if dp.inflightExtents[extentID] {
+		return false
+	}
+	dp.inflightExtents[extentID] = true
+	return true
+}
+
+func (dp *DataPartition) removeInflightExtent(extentID uint64) {
+	dp.inflightLock.Lock()
+	delete(dp.inflightExtents, extentID)
+	if len(dp.inflightExtents) == 0 {
+		dp.inflightCond.Broadcast()
+	}
+	dp.inflightLock.Unlock()
+}
+
+func (dp *DataPartition) isInflightExtent(extentID uint64) (inflight bool) {
+	dp.inflightLock.Lock()
+	inflight = dp.inflightExtents[extentID]
+	dp.inflightLock.Unlock()
+	return
+}
+
+func (dp *DataPartition) inflightRepairExtents() (extents []uint64) {
+	dp.inflightLock.Lock()
+	defer dp.inflightLock.Unlock()
+	extents = make([]uint64, 0, len(dp.inflightExtents))
+	for extentID := range dp.inflightExtents {
+		extents = append(extents, extentID)
+	}
+	return
 }
 
 // Disk returns the disk instance.
@@ -369,7 +952,7 @@ func (dp *DataPartition) Status() int {
 
 // Size returns the partition size.
 func (dp *DataPartition) Size() int {
-	return dp.partitionSize
+	return int(atomic.LoadInt64(&dp.partitionSize))
 }
 
 // Used returns the used space.
@@ -379,7 +962,7 @@ func (dp *DataPartition) Used() int {
 
 // Available returns the available space.
 func (dp *DataPartition) Available() int {
-	return dp.partitionSize - dp.used
+	return dp.Size() - dp.used
 }
 
 func (dp *DataPartition) ForceLoadHeader() {
@@ -387,86 +970,552 @@ func (dp *DataPartition) ForceLoadHeader() {
 }
 
 // PersistMetadata persists the file metadata on the disk.
+// The META file is written first, and then a backup copy is written for recovery.
 func (dp *DataPartition) PersistMetadata() (err error) {
 	var (
-		metadataFile *os.File
-		metaData     []byte
+		metaData []byte
 	)
-	fileName := path.Join(dp.Path(), TempMetadataFileName)
-	if metadataFile, err = os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0666); err != nil {
-		return
-	}
-	defer func() {
-		metadataFile.Sync()
-		metadataFile.Close()
-		os.Remove(fileName)
-	}()
-
 	sp := sortedPeers(dp.config.Peers)
 	sort.Sort(sp)
+	readOnly, readOnlySetBy, readOnlySetTime := dp.manualReadOnly.get()
+	frozen, frozenReason := dp.frozen.get()
 
 	md := &DataPartitionMetadata{
+		Version:                 DataPartitionMetadataVersion,
 		VolumeID:                dp.config.VolName,
 		PartitionID:             dp.config.PartitionID,
 		PartitionSize:           dp.config.PartitionSize,
 		Peers:                   dp.config.Peers,
 		Hosts:                   dp.config.Hosts,
 		DataPartitionCreateType: dp.DataPartitionCreateType,
-		CreateTime:              time.Now().Format(TimeLayout),
+		CreateTime:              dp.createTime,
 		LastTruncateID:          dp.lastTruncateID,
+		ManualReadOnly:          readOnly,
+		LogicalSize:             dp.logicalSize(),
+		Frozen:                  frozen,
+		FrozenReason:            frozenReason,
+		RestartCount:            dp.restartCount,
+		ReadOnlySetBy:           readOnlySetBy,
+		ReadOnlySetTime:         readOnlySetTime,
+		ExtentTTL:               dp.extentTTL,
+		Encrypted:               dp.config.Encrypted,
+		TinySize:                dp.config.TinySize,
+	}
+	if md.Checksum, err = md.ComputeChecksum(); err != nil {
+		return
 	}
 	if metaData, err = json.Marshal(md); err != nil {
 		return
 	}
-	if _, err = metadataFile.Write(metaData); err != nil {
+	dp.persistLock.Lock()
+	defer dp.persistLock.Unlock()
+	if err = writeFileAtomically(dp.Path(), TempMetadataFileName, DataPartitionMetadataFileName, metaData); err != nil {
 		return
 	}
 	log.LogInfof("PersistMetadata DataPartition(%v) data(%v)", dp.partitionID, string(metaData))
-	err = os.Rename(fileName, path.Join(dp.Path(), DataPartitionMetadataFileName))
+	if backupErr := writeFileAtomically(dp.Path(), TempMetadataBackupFileName, MetadataBackupFileName, metaData); backupErr != nil {
+		log.LogErrorf("PersistMetadata DataPartition(%v) write backup err(%v)", dp.partitionID, backupErr)
+	}
+	return
+}
+
+// Flush persists the metadata and the applied id of the partition at once, instead of waiting for the schedule.
+func (dp *DataPartition) Flush() (err error) {
+	if err = dp.PersistMetadata(); err != nil {
+		return fmt.Errorf("persist metadata: %v", err)
+	}
+	if err = dp.persistAppliedID(); err != nil {
+		return fmt.Errorf("persist applied id: %v", err)
+	}
+	return
+}
+
+// Write the data into a temporary file, sync it, and rename it to the target file.
+func writeFileAtomically(dir, tempFileName, fileName string, data []byte) (err error) {
+	var file *os.File
+	tempFile := path.Join(dir, tempFileName)
+	if file, err = os.OpenFile(tempFile, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666); err != nil {
+		return
+	}
+	defer os.Remove(tempFile)
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tempFile, path.Join(dir, fileName)); err != nil {
+		return
+	}
+	err = syncDir(dir)
+	return
+}
+
+// Sync the directory to make the rename of the files in it durable.
+// Some filesystems do not support syncing a directory, on which it is skipped.
+func syncDir(dir string) (err error) {
+	var file *os.File
+	if file, err = os.Open(dir); err != nil {
+		return
+	}
+	defer file.Close()
+	if err = file.Sync(); err != nil {
+		if pathErr, ok := err.(*os.PathError); ok && (pathErr.Err == syscall.ENOTSUP || pathErr.Err == syscall.EINVAL) {
+			log.LogWarnf("action[syncDir] dir(%v) sync not supported: %v", dir, err)
+			return nil
+		}
+	}
+	return
+}
+
+// Compute the intervals of the tickers of the partition. With the jitter, the first tick is delayed in a
+// deterministic way by the partition id, so the partitions on the node do not tick at the same time.
+func (dp *DataPartition) tickerIntervals() (statusInterval, snapshotInterval, jitter time.Duration) {
+	statusInterval = DefaultStatusInterval
+	if dp.config.StatusInterval > 0 {
+		statusInterval = time.Duration(dp.config.StatusInterval) * time.Second
+	}
+	snapshotInterval = DefaultSnapshotInterval
+	if dp.config.SnapshotInterval > 0 {
+		snapshotInterval = time.Duration(dp.config.SnapshotInterval) * time.Second
+	}
+	if dp.config.TickerJitter {
+		jitter = time.Duration(rand.New(rand.NewSource(int64(dp.partitionID))).Int63n(int64(statusInterval)))
+	}
 	return
 }
+
 func (dp *DataPartition) statusUpdateScheduler() {
-	ticker := time.NewTicker(time.Minute)
-	snapshotTicker := time.NewTicker(time.Minute * 5)
+	statusInterval, snapshotInterval, jitter := dp.tickerIntervals()
+	if jitter > 0 {
+		select {
+		case <-time.After(jitter):
+		case <-dp.stopC:
+			return
+		}
+	}
+	ticker := time.NewTicker(statusInterval)
+	snapshotTicker := time.NewTicker(snapshotInterval)
+	expiryTicker := time.NewTicker(ExtentExpiryInterval)
+	accessTicker := time.NewTicker(ExtentAccessFlushInterval)
+	// the policy is fixed once the node is started, only the partitions synced by the interval need the ticker
+	var fsyncC <-chan time.Time
+	if dp.FsyncPolicy() == FsyncPolicyInterval {
+		fsyncTicker := time.NewTicker(dp.fsyncInterval())
+		defer fsyncTicker.Stop()
+		fsyncC = fsyncTicker.C
+	}
 	var index int
 	for {
 		select {
 		case <-ticker.C:
 			index++
 			dp.statusUpdate()
+			// the windows are rotated by the idle ticks as well, so the IOs after the idle are not mixed with
+			// the latencies recorded before it
+			dp.metrics.rotateIfExpired()
+			if dp.metrics.tick() {
+				dp.metrics.report()
+			}
 			if index >= math.MaxUint32 {
 				index = 0
 			}
 			if index%2 == 0 {
-				dp.LaunchRepair(proto.TinyExtentType)
+				dp.launchRepairAsync(proto.TinyExtentType)
 			} else {
-				dp.LaunchRepair(proto.NormalExtentType)
+				dp.launchRepairAsync(proto.NormalExtentType)
 			}
 		case <-snapshotTicker.C:
 			dp.ReloadSnapshot()
+		case <-expiryTicker.C:
+			dp.ExpireExtents()
+		case <-accessTicker.C:
+			dp.flushExtentAccess()
+		case <-fsyncC:
+			dp.syncDirtyExtents()
 		case <-dp.stopC:
 			ticker.Stop()
 			snapshotTicker.Stop()
+			expiryTicker.Stop()
+			accessTicker.Stop()
 			return
 		}
 	}
 }
 
+// IsIdle tells if the partition has served no read or write recently, whose metrics are reported less often.
+func (dp *DataPartition) IsIdle() bool {
+	return dp.metrics.IsIdle()
+}
+
+// GetLatencyPercentiles returns the percentiles of the recent write latencies of the partition.
+func (dp *DataPartition) GetLatencyPercentiles() *LatencyPercentiles {
+	return dp.metrics.LatencyPercentiles()
+}
+
 func (dp *DataPartition) statusUpdate() {
+	dp.updateStatus(true)
+}
+
+// Update the status of the partition by its usage. An unavailable partition stays unavailable,
+// unless keepUnavailable is false, which is only the case when the partition is unfrozen.
+func (dp *DataPartition) updateStatus(keepUnavailable bool) {
 	status := proto.ReadWrite
 	dp.computeUsage()
+	dp.usageHistory.record(dp.used, time.Now())
+	dp.disk.checkIOErrors()
 
-	if dp.used >= dp.partitionSize {
+	if dp.used >= dp.Size() {
 		status = proto.ReadOnly
 	}
-	if dp.extentStore.GetExtentCount() >= storage.MaxExtentCount {
+	if dp.extentStore.GetExtentCount() >= dp.MaxActiveExtents() {
 		status = proto.ReadOnly
 	}
-	if dp.Status() == proto.Unavailable {
+	if dp.IsManualReadOnly() && status == proto.ReadWrite {
+		status = proto.ReadOnly
+	}
+	if keepUnavailable && dp.Status() == proto.Unavailable {
+		status = proto.Unavailable
+	}
+	if frozen, _ := dp.IsFrozen(); frozen {
 		status = proto.Unavailable
 	}
 
+	oldStatus := dp.partitionStatus
 	dp.partitionStatus = int(math.Min(float64(status), float64(dp.disk.Status)))
+	if oldStatus != dp.partitionStatus {
+		dp.notifyStatusChange(oldStatus, dp.partitionStatus)
+	}
+	if oldStatus == proto.ReadWrite && dp.partitionStatus == proto.ReadOnly && dp.used >= dp.Size() {
+		dp.notifyFull()
+	}
+	nearFull := dp.partitionStatus == proto.ReadWrite &&
+		float64(dp.used) >= float64(dp.Size())*dp.disk.space.GetNearFullRatio()
+	if nearFull != dp.nearFull {
+		log.LogWarnf("action[statusUpdate] partition(%v) nearFull(%v) used(%v) size(%v).",
+			dp.partitionID, nearFull, dp.used, dp.Size())
+	}
+	dp.nearFull = nearFull
+}
+
+// IsNearFull tells if the partition is still writable but its used space reaches the soft limit, so that
+// the new writes should go to the other partitions before this one turns read-only.
+// It is kept apart from the status, which is compared with ReadWrite by the master and the clients.
+func (dp *DataPartition) IsNearFull() bool {
+	return dp.nearFull
+}
+
+// PartitionHealth tells if the partition is ready to serve, and why not if it is not.
+type PartitionHealth struct {
+	ID         uint64            `json:"id"`
+	Ready      bool              `json:"ready"`
+	Reasons    []string          `json:"reasons"`
+	ApplyIndex *ApplyIndexStatus `json:"applyIndex"`
+}
+
+// HealthCheck checks if the partition is ready to serve: the raft leader is known, neither the partition
+// nor the disk is unavailable, and the replicas are the same as the ones on the master.
+func (dp *DataPartition) HealthCheck() (health *PartitionHealth) {
+	health = &PartitionHealth{ID: dp.partitionID, Reasons: make([]string, 0)}
+	if leader, ok := dp.GetRaftLeader(); !ok {
+		health.Reasons = append(health.Reasons, "raft not started")
+	} else if leader.LeaderID == 0 {
+		health.Reasons = append(health.Reasons, "raft leader unknown")
+	}
+	if dp.Status() == proto.Unavailable {
+		health.Reasons = append(health.Reasons, "partition unavailable")
+	}
+	if dp.disk.Status == proto.Unavailable {
+		health.Reasons = append(health.Reasons, fmt.Sprintf("disk(%v) unavailable", dp.disk.Path))
+	}
+	if health.ApplyIndex = dp.GetApplyIndexStatus(); health.ApplyIndex.Stale {
+		lastPersist := "never"
+		if health.ApplyIndex.LastPersistTime > 0 {
+			lastPersist = time.Unix(health.ApplyIndex.LastPersistTime, 0).Format(TimeLayout)
+		}
+		health.Reasons = append(health.Reasons, fmt.Sprintf("applied id(%v) lags the persisted one(%v), last persisted(%v) err(%v)",
+			health.ApplyIndex.AppliedID, health.ApplyIndex.PersistedAppliedID, lastPersist, health.ApplyIndex.LastError))
+	}
+	if _, replicas, err := dp.fetchReplicasFromMaster(); err != nil {
+		health.Reasons = append(health.Reasons, fmt.Sprintf("fetch replicas from master failed: %v", err))
+	} else if localReplicas := dp.Replicas(); !dp.compareReplicas(localReplicas, replicas) {
+		health.Reasons = append(health.Reasons, fmt.Sprintf("replicas(%v) mismatch the ones(%v) on master", localReplicas, replicas))
+	}
+	health.Ready = len(health.Reasons) == 0
+	return
+}
+
+// RegisterStatusChangeHandler registers the handler to be invoked when the partition status changes.
+// The handler is called asynchronously, and the events are dropped when the handler is too slow.
+func (dp *DataPartition) RegisterStatusChangeHandler(handler func(old, new int)) {
+	dp.statusChangeHandlerLock.Lock()
+	dp.statusChangeHandler = handler
+	dp.statusChangeHandlerLock.Unlock()
+	dp.startStatusDispatcher.Do(func() {
+		go dp.dispatchStatusChange()
+	})
+}
+
+func (dp *DataPartition) notifyStatusChange(old, new int) {
+	dp.logEvent(EventStatusChange, "status from (%v) to (%v) used(%v) size(%v)", old, new, dp.used, dp.Size())
+	dp.statusChangeHandlerLock.RLock()
+	handler := dp.statusChangeHandler
+	dp.statusChangeHandlerLock.RUnlock()
+	if handler == nil {
+		return
+	}
+	select {
+	case dp.statusChangeC <- &statusChangeEvent{old: old, new: new}:
+	default:
+		log.LogWarnf("action[notifyStatusChange] partition(%v) drop status change event from (%v) to (%v).",
+			dp.partitionID, old, new)
+	}
+}
+
+func (dp *DataPartition) dispatchStatusChange() {
+	for {
+		select {
+		case event := <-dp.statusChangeC:
+			dp.statusChangeHandlerLock.RLock()
+			handler := dp.statusChangeHandler
+			dp.statusChangeHandlerLock.RUnlock()
+			if handler != nil {
+				handler(event.old, event.new)
+			}
+		case <-dp.stopC:
+			return
+		}
+	}
+}
+
+// manualReadOnly is the read-only state set by the operator, with the operator and the time of the change.
+// It is changed by the http handlers and read by the status updates and the reports to the master, so the fields
+// are read and written under the lock, and the changes are serialized by update.
+type manualReadOnly struct {
+	sync.RWMutex
+	update   sync.Mutex
+	readOnly bool
+	setBy    string
+	setTime  string
+}
+
+func (s *manualReadOnly) get() (readOnly bool, setBy, setTime string) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.readOnly, s.setBy, s.setTime
+}
+
+func (s *manualReadOnly) set(readOnly bool, setBy, setTime string) {
+	s.Lock()
+	s.readOnly, s.setBy, s.setTime = readOnly, setBy, setTime
+	s.Unlock()
+}
+
+// SetManualReadOnly freezes or unfreezes the writes of the partition on behalf of the operator. The flag is
+// persisted with the operator and the time of the change, and it never makes the partition more writable
+// than its usage allows. The change is written to the event log for the audit.
+func (dp *DataPartition) SetManualReadOnly(readOnly bool, operator string) (err error) {
+	state := &dp.manualReadOnly
+	state.update.Lock()
+	defer state.update.Unlock()
+	old, oldSetBy, oldSetTime := state.get()
+	state.set(readOnly, operator, time.Now().Format(TimeLayout))
+	if err = dp.PersistMetadata(); err != nil {
+		state.set(old, oldSetBy, oldSetTime)
+		log.LogErrorf("action[SetManualReadOnly] partition(%v) persist metadata err(%v).", dp.partitionID, err)
+		return
+	}
+	dp.statusUpdate()
+	dp.logEvent(EventManualReadOnly, "manualReadOnly from (%v) to (%v) by (%v) status(%v)",
+		old, readOnly, operator, dp.Status())
+	log.LogWarnf("action[SetManualReadOnly] partition(%v) manualReadOnly from (%v) to (%v) by (%v) status(%v).",
+		dp.partitionID, old, readOnly, operator, dp.Status())
+	return
+}
+
+// IsManualReadOnly tells if the partition has been set read-only by the operator.
+func (dp *DataPartition) IsManualReadOnly() bool {
+	readOnly, _, _ := dp.manualReadOnly.get()
+	return readOnly
+}
+
+// ManualReadOnlySetBy returns the operator changed the manual read-only state last and the time of it,
+// both empty if it has never been changed.
+func (dp *DataPartition) ManualReadOnlySetBy() (operator, setTime string) {
+	_, operator, setTime = dp.manualReadOnly.get()
+	return
+}
+
+// Freeze keeps the partition unavailable so that its files stay as they are for an investigation:
+// the repairs are not launched and the packets of the clients and the peers are rejected.
+// The frozen state and the reason are persisted in the metadata, so the partition is loaded frozen
+// after a restart. The raft keeps running, since skipping the applies would lose the committed writes.
+func (dp *DataPartition) Freeze(reason string) (err error) {
+	state := &dp.frozen
+	state.update.Lock()
+	defer state.update.Unlock()
+	wasFrozen, oldReason := state.get()
+	state.set(true, reason)
+	if err = dp.PersistMetadata(); err != nil {
+		state.set(wasFrozen, oldReason)
+		log.LogErrorf("action[Freeze] partition(%v) persist metadata err(%v).", dp.partitionID, err)
+		return
+	}
+	dp.statusUpdate()
+	mesg := fmt.Sprintf("action[Freeze] partition(%v) on %v frozen, reason(%v)", dp.partitionID, LocalIP, reason)
+	log.LogWarnf("%v", mesg)
+	exporter.Warning(mesg)
+	return
+}
+
+// Unfreeze lets the partition serve again. It stays unavailable if its raft failed to start.
+func (dp *DataPartition) Unfreeze() (err error) {
+	state := &dp.frozen
+	state.update.Lock()
+	defer state.update.Unlock()
+	frozen, oldReason := state.get()
+	if !frozen {
+		return fmt.Errorf("partition(%v) is not frozen", dp.partitionID)
+	}
+	state.set(false, "")
+	if err = dp.PersistMetadata(); err != nil {
+		state.set(true, oldReason)
+		log.LogErrorf("action[Unfreeze] partition(%v) persist metadata err(%v).", dp.partitionID, err)
+		return
+	}
+	dp.updateStatus(dp.raftReadiness.result() != nil)
+	log.LogInfof("action[Unfreeze] partition(%v) unfrozen, status(%v).", dp.partitionID, dp.Status())
+	return
+}
+
+// IsFrozen tells if the partition has been frozen by the operator, and why.
+func (dp *DataPartition) IsFrozen() (frozen bool, reason string) {
+	return dp.frozen.get()
+}
+
+// frozenState is the frozen state set by the operator. The flag is checked by every packet from the connection
+// goroutines, so it is atomic, and the reason is read and written under the lock. The changes are serialized by
+// update.
+type frozenState struct {
+	sync.RWMutex
+	update sync.Mutex
+	frozen int32
+	reason string
+}
+
+func (s *frozenState) get() (frozen bool, reason string) {
+	if atomic.LoadInt32(&s.frozen) == 0 {
+		return false, ""
+	}
+	s.RLock()
+	defer s.RUnlock()
+	return atomic.LoadInt32(&s.frozen) == 1, s.reason
+}
+
+func (s *frozenState) set(frozen bool, reason string) {
+	s.Lock()
+	defer s.Unlock()
+	s.reason = reason
+	if frozen {
+		atomic.StoreInt32(&s.frozen, 1)
+	} else {
+		atomic.StoreInt32(&s.frozen, 0)
+	}
+}
+
+// PartitionUptime describes how long a partition has been served by the data node process,
+// and how many times it has been loaded since its creation.
+type PartitionUptime struct {
+	ID           uint64 `json:"id"`
+	CreateTime   string `json:"createTime"`
+	LoadTime     int64  `json:"loadTime"`
+	Uptime       int64  `json:"uptime"` // seconds
+	RestartCount uint64 `json:"restartCount"`
+}
+
+// GetUptimeInfo returns the uptime of the partition in this process and its restart count.
+// A partition restarted much more often than the others on the node points to a bad disk or a crash loop.
+func (dp *DataPartition) GetUptimeInfo() (uptime *PartitionUptime) {
+	return &PartitionUptime{
+		ID:           dp.partitionID,
+		CreateTime:   dp.createTime,
+		LoadTime:     dp.loadTime,
+		Uptime:       time.Now().Unix() - dp.loadTime,
+		RestartCount: dp.restartCount,
+	}
+}
+
+// ResizePartition changes the logical capacity of the partition on all the replicas, by the raft log applied
+// by each of them. The growth must fit into the unallocated space of the disk, and the partition can not be
+// shrunk below its used space, which the leader checks before the submit and each replica on the apply.
+// The directory keeps the name with the size on creation, since the raft log and the extent store hold
+// the path of the partition, and the new size is kept in the metadata.
+func (dp *DataPartition) ResizePartition(newSize int) (err error) {
+	if _, ok := dp.IsRaftLeader(); !ok {
+		return fmt.Errorf("partition(%v) %v", dp.partitionID, raft.ErrNotLeader)
+	}
+	if err = dp.checkResize(newSize); err != nil {
+		return
+	}
+	val, err := MarshalRandWriteRaftLog(proto.OpResizeDataPartition, 0, int64(newSize), 0, nil, 0)
+	if err != nil {
+		return
+	}
+	resp, err := dp.Put(nil, val)
+	if err != nil {
+		return
+	}
+	if resp != proto.OpOk {
+		err = fmt.Errorf("partition(%v) resize to (%v) failed on the apply", dp.partitionID, newSize)
+	}
+	return
+}
+
+func (dp *DataPartition) checkResize(newSize int) (err error) {
+	if newSize <= 0 {
+		return fmt.Errorf("illegal partition size(%v)", newSize)
+	}
+	if newSize < dp.used {
+		return fmt.Errorf("partition(%v) size(%v) is less than the used space(%v)", dp.partitionID, newSize, dp.used)
+	}
+	return
+}
+
+// Apply the resize of the raft log. The growth is reserved from the disk at once, and a replica failing to
+// persist the new size goes back to the old one.
+func (dp *DataPartition) applyResize(newSize int) (err error) {
+	dp.resizeLock.Lock()
+	defer dp.resizeLock.Unlock()
+	oldSize := dp.Size()
+	if err = dp.checkResize(newSize); err != nil {
+		return
+	}
+	if err = dp.disk.reserveResize(dp, newSize); err != nil {
+		return
+	}
+	if err = dp.PersistMetadata(); err != nil {
+		log.LogErrorf("action[applyResize] partition(%v) persist metadata err(%v).", dp.partitionID, err)
+		atomic.StoreInt64(&dp.partitionSize, int64(oldSize))
+		return
+	}
+	dp.disk.computeUsage()
+	dp.statusUpdate()
+	log.LogInfof("action[applyResize] partition(%v) size from (%v) to (%v) status(%v).",
+		dp.partitionID, oldSize, newSize, dp.Status())
+	return
+}
+
+// The size kept in the metadata, 0 while the partition keeps the size on creation.
+func (dp *DataPartition) logicalSize() int {
+	if size := dp.Size(); size > 0 && size != dp.config.PartitionSize {
+		return size
+	}
+	return 0
 }
 
 func parseFileName(filename string) (extentID uint64, isExtent bool) {
@@ -496,32 +1545,111 @@ func (dp *DataPartition) actualSize(path string, finfo os.FileInfo) (size int64)
 		if err != nil {
 			return finfo.Size()
 		}
-		return stat.Blocks * DiskSectorSize
+		return stat.Blocks * dp.disk.sectorSize()
 	}
 
 	return finfo.Size()
 }
 
+// The used space is taken from the running total of the extent store. The directory is walked
+// only when the running total is dirty, or periodically to reconcile the drift of the running total.
 func (dp *DataPartition) computeUsage() {
-	var (
-		used  int64
-		files []os.FileInfo
-		err   error
-	)
-	if time.Now().Unix()-dp.intervalToUpdatePartitionSize < IntervalToUpdatePartitionSize {
+	dp.usageLock.Lock()
+	defer dp.usageLock.Unlock()
+	// both intervals are extended while the node is under a high write latency, see usageBackoff
+	factor := dp.usageBackoffFactor()
+	if used, ok := dp.extentStore.UsedSize(); ok && time.Now().Unix()-dp.lastUsageReconcileTime < UsageReconcileInterval*factor {
+		dp.used = int(used)
+		dp.intervalToUpdatePartitionSize = time.Now().Unix()
+		return
+	}
+	if time.Now().Unix()-dp.intervalToUpdatePartitionSize < dp.usageUpdateInterval*factor {
 		return
 	}
-	if files, err = ioutil.ReadDir(dp.path); err != nil {
+	dp.reconcileUsage()
+}
+
+// UsageReconciliation compares the used space recorded by the running total of the extent store with the one
+// computed by walking the directory.
+type UsageReconciliation struct {
+	Recorded int64 `json:"recorded"` // -1 if the running total is not trustworthy, see ExtentStore.UsedSize
+	Computed int64 `json:"computed"`
+	Drift    int64 `json:"drift"` // computed minus recorded, 0 if the running total is not trustworthy
+}
+
+// ReconcileUsage walks the directory at once regardless of the update interval to compute the authoritative
+// used space, compares it with the running total of the extent store, and corrects the running total.
+func (dp *DataPartition) ReconcileUsage() (result *UsageReconciliation, err error) {
+	dp.usageLock.Lock()
+	defer dp.usageLock.Unlock()
+	return dp.reconcileUsage()
+}
+
+func (dp *DataPartition) reconcileUsage() (result *UsageReconciliation, err error) {
+	var used int64
+	err = dp.walkExtentFiles(func(dir string, file os.FileInfo) {
+		used += dp.actualSize(dir, file)
+	})
+	if err != nil {
 		return
 	}
-	for _, file := range files {
-		used += dp.actualSize(dp.path, file)
+	result = &UsageReconciliation{Recorded: -1, Computed: used}
+	if runningUsed, ok := dp.extentStore.UsedSize(); ok {
+		result.Recorded, result.Drift = runningUsed, used-runningUsed
+	}
+	if result.Drift != 0 {
+		log.LogInfof("action[reconcileUsage] partition(%v) running used(%v) drifts from actual used(%v).",
+			dp.partitionID, result.Recorded, used)
 	}
+	dp.extentStore.ResetUsedSize(used)
 	dp.used = int(used)
 	dp.intervalToUpdatePartitionSize = time.Now().Unix()
+	dp.lastUsageReconcileTime = dp.intervalToUpdatePartitionSize
+	return
+}
+
+// FragmentationReport describes how the space of the extent store is used.
+type FragmentationReport struct {
+	TinyExtentCount   int     `json:"tinyExtentCount"`
+	TinyExtentBytes   uint64  `json:"tinyExtentBytes"` // bytes actually allocated on the disk
+	TinyWastedBytes   uint64  `json:"tinyWastedBytes"` // logical bytes of the tiny extents no longer backed by blocks
+	NormalExtentCount int     `json:"normalExtentCount"`
+	NormalExtentBytes uint64  `json:"normalExtentBytes"`
+	AvgFillRatio      float64 `json:"avgFillRatio"` // average size of the normal extents against the max extent size
+}
+
+// FragmentationReport walks the extent files of the partition and reports the usage of the tiny and normal extents.
+func (dp *DataPartition) FragmentationReport() (report *FragmentationReport, err error) {
+	report = &FragmentationReport{}
+	var fillRatio float64
+	err = dp.walkExtentFiles(func(dir string, file os.FileInfo) {
+		extentID, isExtent := parseFileName(file.Name())
+		if !isExtent {
+			return
+		}
+		size := dp.actualSize(dir, file)
+		if storage.IsTinyExtent(extentID) {
+			report.TinyExtentCount++
+			report.TinyExtentBytes += uint64(size)
+			if file.Size() > size {
+				report.TinyWastedBytes += uint64(file.Size() - size)
+			}
+			return
+		}
+		report.NormalExtentCount++
+		report.NormalExtentBytes += uint64(size)
+		fillRatio += float64(size) / float64(util.ExtentSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if report.NormalExtentCount > 0 {
+		report.AvgFillRatio = fillRatio / float64(report.NormalExtentCount)
+	}
+	return
 }
 
-func (dp *DataPartition) ExtentStore() *storage.ExtentStore {
+func (dp *DataPartition) ExtentStore() ExtentStorer {
 	return dp.extentStore
 }
 
@@ -546,36 +1674,178 @@ func (dp *DataPartition) checkIsDiskError(err error) (diskError bool) {
 
 // String returns the string format of the data partition information.
 func (dp *DataPartition) String() (m string) {
-	return fmt.Sprintf(DataPartitionPrefix+"_%v_%v", dp.partitionID, dp.partitionSize)
+	return fmt.Sprintf(DataPartitionPrefix+"_%v_%v", dp.partitionID, dp.config.PartitionSize)
 }
 
-// LaunchRepair launches the repair of extents.
-func (dp *DataPartition) LaunchRepair(extentType uint8) {
-	if dp.partitionStatus == proto.Unavailable {
+// Launch the scheduled repair cycle in the background, so the status updates go on while the cycle waits for
+// a repair slot. The cycle is skipped while the one launched before is still waiting or running.
+func (dp *DataPartition) launchRepairAsync(extentType uint8) {
+	if !atomic.CompareAndSwapInt32(&dp.repairLaunching, 0, 1) {
 		return
 	}
-	if err := dp.updateReplicas(); err != nil {
+	go func() {
+		defer atomic.StoreInt32(&dp.repairLaunching, 0)
+		dp.LaunchRepair(extentType)
+	}()
+}
+
+// LaunchRepair launches the repair of extents, and tells if the repair cycle ran, or why it did not.
+// It waits for a repair slot of the node before it marks the partition repairing, so a partition waiting
+// for the slot is not reported as being repaired.
+func (dp *DataPartition) LaunchRepair(extentType uint8) (ran bool, err error) {
+	if dp.partitionStatus == proto.Unavailable || dp.IsDraining() {
+		return false, fmt.Errorf("partition(%v) is not available for repair", dp.partitionID)
+	}
+	if dp.IsRepairing() {
+		log.LogWarnf("action[LaunchRepair] partition(%v) is being repaired, skip.", dp.partitionID)
+		return false, fmt.Errorf("partition(%v) is being repaired", dp.partitionID)
+	}
+	if err = dp.updateReplicas(); err != nil {
 		log.LogErrorf("action[LaunchRepair] partition(%v) err(%v).", dp.partitionID, err)
 		return
 	}
-	if !dp.isLeader {
-		return
+	if !dp.isRepairLeader() {
+		return false, fmt.Errorf("partition(%v) is not the repair leader on %v", dp.partitionID, LocalIP)
+	}
+	release, ok := dp.acquireRepairSlot()
+	if !ok {
+		return false, fmt.Errorf("partition(%v) has no repair slot free", dp.partitionID)
+	}
+	defer release()
+	if !atomic.CompareAndSwapInt32(&dp.isRepairing, 0, 1) {
+		log.LogWarnf("action[LaunchRepair] partition(%v) is being repaired, skip.", dp.partitionID)
+		return false, fmt.Errorf("partition(%v) is being repaired", dp.partitionID)
 	}
+	defer dp.endRepairing()
+	dp.resetRepairStats()
+	ctx, span := dp.startRepairSpan(context.Background(), SpanLaunchRepair)
+	span.SetAttribute(TraceAttrExtentType, extentType)
+	defer span.End(nil)
 	if dp.extentStore.BrokenTinyExtentCnt() == 0 {
 		dp.extentStore.MoveAllToBrokenTinyExtentC(MinTinyExtentsToRepair)
 	}
-	dp.repair(extentType)
+	dp.repair(ctx, extentType)
+	return true, nil
+}
+
+// RepairTinyExtents repairs only the given tiny extents instead of all the broken ones.
+// The extents being written at the moment are skipped, and the repaired ones are returned.
+func (dp *DataPartition) RepairTinyExtents(ids []uint64) (repaired []uint64, err error) {
+	for _, id := range ids {
+		if !storage.IsTinyExtent(id) {
+			err = fmt.Errorf("extent(%v) is not a tiny extent", id)
+			return
+		}
+	}
+	if dp.partitionStatus == proto.Unavailable || dp.IsDraining() {
+		err = fmt.Errorf("partition(%v) is not available for repair", dp.partitionID)
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&dp.isRepairing, 0, 1) {
+		err = fmt.Errorf("partition(%v) is being repaired", dp.partitionID)
+		return
+	}
+	defer dp.endRepairing()
+	dp.resetRepairStats()
+	if err = dp.updateReplicas(); err != nil {
+		return
+	}
+	if !dp.isRepairLeader() {
+		err = fmt.Errorf("partition(%v) is not the repair leader on %v", dp.partitionID, LocalIP)
+		return
+	}
+	if repaired = dp.extentStore.TakeTinyExtents(ids); len(repaired) == 0 {
+		return
+	}
+	log.LogInfof("action[RepairTinyExtents] partition(%v) repair tiny extents(%v) of (%v).", dp.partitionID, repaired, ids)
+	dp.repairExtents(context.Background(), proto.TinyExtentType, repaired)
+	return
+}
+
+// IsRepairing tells if a repair cycle is running on the partition.
+func (dp *DataPartition) IsRepairing() bool {
+	return atomic.LoadInt32(&dp.isRepairing) == 1
+}
+
+// End the repair cycle, and wake up the ones waiting for it to return.
+func (dp *DataPartition) endRepairing() {
+	dp.repairingLock.Lock()
+	atomic.StoreInt32(&dp.isRepairing, 0)
+	dp.repairingCond.Broadcast()
+	dp.repairingLock.Unlock()
+}
+
+// LaunchManualRepair launches a repair requested by the operator and waits until it finishes or the timeout elapses.
+// The returned job id identifies the repair, whose progress can be polled from the repair statistics. A repair
+// cycle which does not run, such as one losing to a scheduled cycle or stopped while waiting for a repair slot,
+// fails with the reason, and the job id of the last repair is kept.
+func (dp *DataPartition) LaunchManualRepair(extentType uint8, timeout time.Duration) (jobID string, finished bool, err error) {
+	if !dp.isRepairLeader() {
+		err = fmt.Errorf("partition(%v) is not the repair leader on %v", dp.partitionID, LocalIP)
+		return
+	}
+	if leaderAddr, isRaftLeader := dp.IsRaftLeader(); !isRaftLeader {
+		err = fmt.Errorf("partition(%v) raft leader is (%v), not on %v", dp.partitionID, leaderAddr, LocalIP)
+		return
+	}
+	if dp.IsRepairing() {
+		err = fmt.Errorf("partition(%v) is being repaired", dp.partitionID)
+		return
+	}
+	jobID = fmt.Sprintf("repair_%v_%v", dp.partitionID, time.Now().UnixNano())
+	lastJobID := dp.setRepairJobID(jobID)
+	log.LogInfof("action[LaunchManualRepair] partition(%v) job(%v) extentType(%v) start.", dp.partitionID, jobID, extentType)
+	var (
+		ran       bool
+		launchErr error
+	)
+	done := make(chan struct{})
+	go func() {
+		ran, launchErr = dp.LaunchRepair(extentType)
+		close(done)
+	}()
+	select {
+	case <-done:
+		if !ran {
+			dp.repairJobLock.Lock()
+			if dp.repairJobID == jobID {
+				dp.repairJobID = lastJobID
+			}
+			dp.repairJobLock.Unlock()
+			return "", false, launchErr
+		}
+		finished = true
+	case <-time.After(timeout):
+	}
+	return
+}
+
+func (dp *DataPartition) setRepairJobID(jobID string) (last string) {
+	dp.repairJobLock.Lock()
+	defer dp.repairJobLock.Unlock()
+	last, dp.repairJobID = dp.repairJobID, jobID
+	return
+}
+
+// RepairJobID returns the id of the latest repair launched by the operator.
+func (dp *DataPartition) RepairJobID() string {
+	dp.repairJobLock.Lock()
+	defer dp.repairJobLock.Unlock()
+	return dp.repairJobID
 }
 
 func (dp *DataPartition) updateReplicas() (err error) {
 	if time.Now().Unix()-dp.intervalToUpdateReplicas <= IntervalToUpdateReplica {
 		return
 	}
+	dp.replicasLock.Lock()
 	dp.isLeader = false
+	dp.replicasLock.Unlock()
 	isLeader, replicas, err := dp.fetchReplicasFromMaster()
 	if err != nil {
 		return
 	}
+	dp.checkMembership(replicas)
 	dp.replicasLock.Lock()
 	defer dp.replicasLock.Unlock()
 	if !dp.compareReplicas(dp.replicas, replicas) {
@@ -610,28 +1880,112 @@ func (dp *DataPartition) compareReplicas(v1, v2 []string) (equals bool) {
 // Fetch the replica information from the master.
 func (dp *DataPartition) fetchReplicasFromMaster() (isLeader bool, replicas []string, err error) {
 
-	var partition *proto.DataPartitionInfo
-	if partition, err = MasterClient.AdminAPI().GetDataPartition(dp.volumeID, dp.partitionID); err != nil {
+	var hosts []string
+	if hosts, err = dp.fetchReplicaHosts(); err != nil {
 		isLeader = false
 		return
 	}
-	for _, host := range partition.Hosts {
+	for _, host := range hosts {
 		replicas = append(replicas, host)
 	}
-	if partition.Hosts != nil && len(partition.Hosts) >= 1 {
-		leaderAddr := strings.Split(partition.Hosts[0], ":")
-		if len(leaderAddr) == 2 && strings.TrimSpace(leaderAddr[0]) == LocalIP {
-			isLeader = true
-		}
+	if len(hosts) >= 1 && isLocalAddr(hosts[0]) {
+		isLeader = true
 	}
 	return
 }
 
+// Fetch the peers and the replica information from the master.
+func (dp *DataPartition) fetchPeersFromMaster() (peers []proto.Peer, replicas []string, err error) {
+	var partition *proto.DataPartitionInfo
+	if partition, err = MasterClient.AdminAPI().GetDataPartition(dp.volumeID, dp.partitionID); err != nil {
+		return
+	}
+	peers = append(peers, partition.Peers...)
+	replicas = append(replicas, partition.Hosts...)
+	return
+}
+
+// Compare the peers regardless of the order.
+func (dp *DataPartition) comparePeers(v1, v2 []proto.Peer) (equals bool) {
+	if len(v1) != len(v2) {
+		return false
+	}
+	sp1 := make(sortedPeers, len(v1))
+	sp2 := make(sortedPeers, len(v2))
+	copy(sp1, v1)
+	copy(sp2, v2)
+	sort.Sort(sp1)
+	sort.Sort(sp2)
+	for i := 0; i < len(sp1); i++ {
+		if sp1[i] != sp2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare the replicas regardless of the order.
+func (dp *DataPartition) compareHostsOfPeers(peers []proto.Peer, replicas []string) (equals bool) {
+	if len(peers) != len(replicas) {
+		return false
+	}
+	sp := make(sortedPeers, len(peers))
+	copy(sp, peers)
+	sort.Sort(sp)
+	addrs := make([]string, 0, len(sp))
+	for _, peer := range sp {
+		addrs = append(addrs, peer.Addr)
+	}
+	hosts := make([]string, len(replicas))
+	copy(hosts, replicas)
+	sort.Strings(addrs)
+	sort.Strings(hosts)
+	return dp.compareReplicas(addrs, hosts)
+}
+
+// reconcilePeers checks the peers persisted in META against the ones known by the master, and warns of a mismatch.
+// The peers and hosts are replaced by the master's only if correct is set, which is done by the load before the
+// raft is started, so that no member change is applied meanwhile, and the caller persists them.
+func (dp *DataPartition) reconcilePeers(correct bool) (corrected bool) {
+	peers, replicas, err := dp.fetchPeersFromMaster()
+	if err != nil {
+		log.LogErrorf("action[reconcilePeers] partition(%v) fetch peers from master err(%v).", dp.partitionID, err)
+		return
+	}
+	if dp.comparePeers(dp.config.Peers, peers) && dp.compareHostsOfPeers(dp.config.Peers, replicas) {
+		return
+	}
+	mesg := fmt.Sprintf("action[reconcilePeers] partition(%v) persisted peers(%v) hosts(%v) mismatch master peers(%v) hosts(%v) on %v",
+		dp.partitionID, dp.config.Peers, dp.config.Hosts, peers, replicas, LocalIP)
+	log.LogWarnf("%v", mesg)
+	exporter.Warning(mesg)
+	if !correct {
+		return
+	}
+	if err = validatePeers(peers); err != nil {
+		log.LogErrorf("action[reconcilePeers] partition(%v) master peers not corrected to: %v.", dp.partitionID, err)
+		return
+	}
+	if !dp.compareHostsOfPeers(peers, replicas) {
+		log.LogErrorf("action[reconcilePeers] partition(%v) master peers(%v) mismatch master hosts(%v), not corrected.",
+			dp.partitionID, peers, replicas)
+		return
+	}
+	dp.config.Peers = peers
+	dp.config.Hosts = replicas
+	dp.replicasInit()
+	log.LogInfof("action[reconcilePeers] partition(%v) peers corrected to (%v) hosts(%v).", dp.partitionID, peers, replicas)
+	return true
+}
+
 func (dp *DataPartition) Load() (response *proto.LoadDataPartitionResponse) {
 	response = &proto.LoadDataPartitionResponse{}
 	response.PartitionId = uint64(dp.partitionID)
 	response.PartitionStatus = dp.partitionStatus
 	response.Used = uint64(dp.Used())
+	response.ManualReadOnly = dp.IsManualReadOnly()
+	response.NearFull = dp.nearFull
+	response.MaxActiveExtents = dp.MaxActiveExtents()
 	var err error
 	if dp.loadExtentHeaderStatus != FinishLoadDataPartitionExtentHeader {
 		response.PartitionSnapshot = make([]*proto.File, 0)
@@ -646,16 +2000,86 @@ func (dp *DataPartition) Load() (response *proto.LoadDataPartitionResponse) {
 	return
 }
 
+// Create the context of a repair cycle, which is canceled when the partition stops,
+// or when the repair timeout configured on the node elapses. The parent carries the span of the trace if any.
+func (dp *DataPartition) newRepairContext(parent context.Context) (ctx context.Context, cancel context.CancelFunc) {
+	if timeout := dp.disk.space.GetRepairTimeout(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, time.Duration(timeout)*time.Second)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	go func() {
+		select {
+		case <-dp.stopC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return
+}
+
 // DoExtentStoreRepair performs the repairs of the extent store.
 // 1. when the extent size is smaller than the max size on the record, start to repair the missing part.
 // 2. if the extent does not even exist, create the extent first, and then repair.
-func (dp *DataPartition) DoExtentStoreRepair(repairTask *DataPartitionRepairTask) {
+// In dry-run mode nothing is created or fixed, and the returned summary describes the planned operations.
+// Once the context is canceled, the extents being fixed stop after the packet being written, which leaves
+// them valid to be continued by the next cycle, and the error tells how many extents are completed and canceled.
+func (dp *DataPartition) DoExtentStoreRepair(ctx context.Context, repairTask *DataPartitionRepairTask) (summary *RepairSummary, err error) {
+	summary = &RepairSummary{
+		Addr:                repairTask.addr,
+		ExtentsToBeCreated:  make([]uint64, 0),
+		ExtentsToBeRepaired: make([]uint64, 0),
+	}
+	if dp.IsDraining() && !repairTask.DryRun {
+		log.LogWarnf("action[DoExtentStoreRepair] partition(%v) is draining, refuse to repair.", dp.partitionID)
+		return
+	}
+	progress := new(repairProgress)
+	if !repairTask.DryRun {
+		var span RepairSpan
+		ctx, span = dp.startRepairSpan(ctx, SpanDoExtentStoreRepair)
+		span.SetAttribute(TraceAttrSource, repairTask.addr)
+		span.SetAttribute(TraceAttrExtentType, repairTask.TaskType)
+		defer func() {
+			span.SetAttribute(TraceAttrExtentsCreated, len(repairTask.ExtentsToBeCreated))
+			span.SetAttribute(TraceAttrExtentsRepaired, len(repairTask.ExtentsToBeRepaired))
+			span.SetAttribute(TraceAttrExtentsDone, atomic.LoadInt32(&progress.completed))
+			span.SetAttribute(TraceAttrExtentsCanceled, atomic.LoadInt32(&progress.canceled))
+			span.SetAttribute(TraceAttrBytes, atomic.LoadUint64(&progress.bytes))
+			span.End(err)
+		}()
+	}
 	store := dp.extentStore
+	hasExtent := store.HasExtent
+	if repairTask.DryRun {
+		if repairTask.extents != nil {
+			hasExtent = func(extentID uint64) bool {
+				_, ok := repairTask.extents[extentID]
+				return ok
+			}
+		}
+	} else {
+		// a follower repairs once for every cycle the leader notifies, which counts the stats of its own
+		dp.resetRepairStats()
+		start := time.Now()
+		dp.logEvent(EventRepairStart, "type(%v) source(%v) toBeCreated(%v) toBeRepaired(%v)", repairTask.TaskType,
+			repairTask.addr, len(repairTask.ExtentsToBeCreated), len(repairTask.ExtentsToBeRepaired))
+		defer func() {
+			dp.setRepairDuration(time.Since(start))
+			dp.logEvent(EventRepairEnd, "type(%v) source(%v) duration(%v)", repairTask.TaskType, repairTask.addr, time.Since(start))
+		}()
+	}
 	for _, extentInfo := range repairTask.ExtentsToBeCreated {
-		if storage.IsTinyExtent(extentInfo.FileID) {
+		if storage.IsTinyExtent(extentInfo.FileID) || dp.IsQuarantined(extentInfo.FileID) {
+			continue
+		}
+		if hasExtent(uint64(extentInfo.FileID)) {
+			info := &storage.ExtentInfo{Source: extentInfo.Source, FileID: extentInfo.FileID, Size: extentInfo.Size}
+			repairTask.ExtentsToBeRepaired = append(repairTask.ExtentsToBeRepaired, info)
 			continue
 		}
-		if store.HasExtent(uint64(extentInfo.FileID)) {
+		if repairTask.DryRun {
+			summary.ExtentsToBeCreated = append(summary.ExtentsToBeCreated, extentInfo.FileID)
 			info := &storage.ExtentInfo{Source: extentInfo.Source, FileID: extentInfo.FileID, Size: extentInfo.Size}
 			repairTask.ExtentsToBeRepaired = append(repairTask.ExtentsToBeRepaired, info)
 			continue
@@ -664,35 +2088,86 @@ func (dp *DataPartition) DoExtentStoreRepair(repairTask *DataPartitionRepairTask
 			log.LogWarnf("AutoRepairStatus is False,so cannot Create extent(%v)", extentInfo.String())
 			continue
 		}
-		err := store.Create(uint64(extentInfo.FileID))
-		if err != nil {
+		if createErr := store.Create(uint64(extentInfo.FileID), extentInfo.Inode); createErr != nil {
+			dp.recordRepairFailure(extentInfo.FileID, createErr)
 			continue
 		}
+		dp.recordExtentCreated()
 		info := &storage.ExtentInfo{Source: extentInfo.Source, FileID: extentInfo.FileID, Size: extentInfo.Size}
 		repairTask.ExtentsToBeRepaired = append(repairTask.ExtentsToBeRepaired, info)
 	}
+	if repairTask.DryRun {
+		dp.summarizeRepairTask(repairTask, summary)
+		return
+	}
 	var (
 		wg           *sync.WaitGroup
 		recoverIndex int
 	)
+	concurrency := dp.RepairConcurrency()
 	wg = new(sync.WaitGroup)
-	for _, extentInfo := range repairTask.ExtentsToBeRepaired {
+	queueTime := time.Now()
+	dp.metrics.addRepairQueueDepth(len(repairTask.ExtentsToBeRepaired))
+	for index, extentInfo := range repairTask.ExtentsToBeRepaired {
+		dp.metrics.addRepairQueueDepth(-1)
 
-		if !store.HasExtent(uint64(extentInfo.FileID)) {
+		if !store.HasExtent(uint64(extentInfo.FileID)) || dp.IsQuarantined(extentInfo.FileID) {
 			continue
 		}
+		if dp.IsDraining() {
+			dp.metrics.addRepairQueueDepth(index + 1 - len(repairTask.ExtentsToBeRepaired))
+			break
+		}
+		if ctx.Err() != nil {
+			atomic.AddInt32(&progress.canceled, 1)
+			continue
+		}
+		dp.metrics.RecordRepairWait(time.Since(queueTime))
 		wg.Add(1)
 
 		// repair the extents
-		go dp.doStreamExtentFixRepair(wg, extentInfo)
+		go dp.doStreamExtentFixRepair(ctx, wg, extentInfo, progress)
 		recoverIndex++
 
-		if recoverIndex%NumOfFilesToRecoverInParallel == 0 {
+		if recoverIndex%concurrency == 0 {
 			wg.Wait()
 		}
 	}
 	wg.Wait()
+	summary.ExtentsCompleted = int(atomic.LoadInt32(&progress.completed))
+	summary.ExtentsCanceled = int(atomic.LoadInt32(&progress.canceled))
+	if ctx.Err() != nil {
+		err = fmt.Errorf("partition(%v) repair from %v %v: %v extents completed, %v canceled",
+			dp.partitionID, repairTask.addr, ctx.Err(), summary.ExtentsCompleted, summary.ExtentsCanceled)
+		log.LogWarnf("action[DoExtentStoreRepair] %v.", err)
+		return
+	}
+	toBeRepaired := make(map[uint64]bool, len(repairTask.ExtentsToBeRepaired))
+	for _, extentInfo := range repairTask.ExtentsToBeRepaired {
+		toBeRepaired[extentInfo.FileID] = true
+	}
+	dp.pruneNoSource(repairTask.TaskType == proto.TinyExtentType, toBeRepaired)
 	dp.doStreamFixTinyDeleteRecord(repairTask, time.Now().Unix()-dp.FullSyncTinyDeleteTime > MaxFullSyncTinyDeleteTime)
+	return
+}
+
+// SetRepairConcurrency sets the number of extents to be recovered simultaneously.
+// Zero restores the default, and the new value takes effect on the next repair.
+func (dp *DataPartition) SetRepairConcurrency(n int) (err error) {
+	if n == 0 {
+		n = NumOfFilesToRecoverInParallel
+	}
+	if n < 0 || n > MaxNumOfFilesToRecoverInParallel {
+		err = fmt.Errorf("repair concurrency(%v) out of range [1, %v]", n, MaxNumOfFilesToRecoverInParallel)
+		return
+	}
+	atomic.StoreInt32(&dp.repairConcurrency, int32(n))
+	return
+}
+
+// RepairConcurrency returns the number of extents to be recovered simultaneously.
+func (dp *DataPartition) RepairConcurrency() int {
+	return int(atomic.LoadInt32(&dp.repairConcurrency))
 }
 
 func (dp *DataPartition) doStreamFixTinyDeleteRecord(repairTask *DataPartitionRepairTask, isFullSync bool) {
@@ -735,7 +2210,6 @@ func (dp *DataPartition) doStreamFixTinyDeleteRecord(repairTask *DataPartitionRe
 	if err = p.WriteToConn(conn); err != nil {
 		return
 	}
-	store := dp.extentStore
 	start := time.Now().Unix()
 	for localTinyDeleteFileSize < repairTask.LeaderTinyDeleteRecordFileSize {
 		if localTinyDeleteFileSize >= repairTask.LeaderTinyDeleteRecordFileSize {
@@ -768,13 +2242,18 @@ func (dp *DataPartition) doStreamFixTinyDeleteRecord(repairTask *DataPartitionRe
 				continue
 			}
 			log.LogInfof("doStreamFixTinyDeleteRecord Delete PartitionID(%v)_Extent(%v)_Offset(%v)_Size(%v)", dp.partitionID, extentID, offset, size)
-			store.MarkDelete(extentID, int64(offset), int64(size))
+			dp.markDelete(extentID, int64(offset), int64(size), DeleteOpTinyRepair)
 		}
 	}
 }
 
 // ChangeRaftMember is a wrapper function of changing the raft member.
 func (dp *DataPartition) ChangeRaftMember(changeType raftProto.ConfChangeType, peer raftProto.Peer, context []byte) (resp interface{}, err error) {
-	resp, err = dp.raftPartition.ChangeMember(changeType, peer, context)
+	raftPartition := dp.raftPartition
+	if raftPartition == nil {
+		err = fmt.Errorf("%s partition(%v)", RaftNotStarted, dp.partitionID)
+		return
+	}
+	resp, err = raftPartition.ChangeMember(changeType, peer, context)
 	return
 }
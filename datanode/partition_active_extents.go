@@ -0,0 +1,65 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+// The creation of the extents is refused once a partition has this many times of its max active extents,
+// so that the partition turned read only by the limit is not written on forever by the open files.
+const maxActiveExtentsCreateFactor = 3
+
+// MaxActiveExtents returns the number of the extents above which the partition turns read only, which is
+// configured for its volume or for the node.
+func (dp *DataPartition) MaxActiveExtents() int {
+	return dp.disk.space.GetMaxActiveExtents(dp.volumeID)
+}
+
+// Parse the max active extents of the volumes in the format VOLUME:COUNT.
+func parseVolMaxActiveExtents(values []interface{}) (limits map[string]int, err error) {
+	limits = make(map[string]int, len(values))
+	for _, value := range values {
+		str, _ := value.(string)
+		arr := strings.Split(str, ":")
+		if len(arr) != 2 || arr[0] == "" {
+			return nil, fmt.Errorf("Err:%v invalid (%v), expected VOLUME:COUNT", ConfigKeyVolMaxActiveExtents, value)
+		}
+		limit, parseErr := strconv.Atoi(arr[1])
+		if parseErr != nil || limit <= 0 {
+			return nil, fmt.Errorf("Err:%v of volume(%v) must be a positive integer", ConfigKeyVolMaxActiveExtents, arr[0])
+		}
+		limits[arr[0]] = limit
+	}
+	return
+}
+
+// Check that the disk has the inodes for a partition to reach the limit of the active extents, as each
+// extent takes an inode. The file systems reporting no inodes are not checked.
+func checkActiveExtentsLimit(path string, limit int) (err error) {
+	var fs syscall.Statfs_t
+	if err = syscall.Statfs(path, &fs); err != nil {
+		return fmt.Errorf("Statfs disk path(%v) error: %v", path, err)
+	}
+	if fs.Files > 0 && uint64(limit)+storage.TinyExtentCount > fs.Files {
+		return fmt.Errorf("Err:%v(%v) exceeds the inodes(%v) of disk(%v)", ConfigKeyMaxActiveExtents, limit, fs.Files, path)
+	}
+	return
+}
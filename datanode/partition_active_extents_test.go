@@ -0,0 +1,86 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestMaxActiveExtents(t *testing.T) {
+	if _, err := parseVolMaxActiveExtents([]interface{}{"smallfiles"}); err == nil {
+		t.Fatal("parse a volume without the count")
+	}
+	if _, err := parseVolMaxActiveExtents([]interface{}{"smallfiles:0"}); err == nil {
+		t.Fatal("parse a volume with a zero count")
+	}
+	limits, err := parseVolMaxActiveExtents([]interface{}{"smallfiles:100000", "bigfiles:3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	space := &SpaceManager{nearFullRatio: DefaultNearFullRatio}
+	if limit := space.GetMaxActiveExtents("bigfiles"); limit != storage.MaxExtentCount {
+		t.Fatalf("max active extents(%v) without the config, expected %v", limit, storage.MaxExtentCount)
+	}
+	space.SetMaxActiveExtents(50000, limits)
+	if limit := space.GetMaxActiveExtents("other"); limit != 50000 {
+		t.Fatalf("max active extents(%v) of a volume not configured, expected the one of the node", limit)
+	}
+	if limit := space.maxActiveExtentsUpperBound(); limit != 100000 {
+		t.Fatalf("upper bound(%v) of the max active extents, expected 100000", limit)
+	}
+
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{1024: 10, 1025: 10, 1026: 10}))
+	dp.volumeID = "bigfiles"
+	dp.partitionSize = 1024 * 1024
+	dp.usageUpdateInterval = IntervalToUpdatePartitionSize
+	dp.intervalToUpdatePartitionSize = time.Now().Unix()
+	dp.disk = &Disk{Status: proto.ReadWrite, MaxErrCnt: 2, space: space}
+	dp.partitionStatus = proto.ReadWrite
+	dp.statusUpdate()
+	if dp.Status() != proto.ReadOnly {
+		t.Fatalf("partition status(%v) with the max active extents reached, expected read only", dp.Status())
+	}
+	if load := dp.Load(); load.MaxActiveExtents != 3 {
+		t.Fatalf("max active extents(%v) in the load response, expected 3", load.MaxActiveExtents)
+	}
+	dp.volumeID = "smallfiles"
+	dp.statusUpdate()
+	if dp.Status() != proto.ReadWrite {
+		t.Fatalf("partition status(%v) below the max active extents, expected read write", dp.Status())
+	}
+
+	dir, err := ioutil.TempDir("", "active_extents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = checkActiveExtentsLimit(dir, storage.MaxExtentCount); err != nil {
+		t.Fatalf("check the default limit: %v", err)
+	}
+	var fs syscall.Statfs_t
+	if err = syscall.Statfs(dir, &fs); err == nil && fs.Files > 0 && fs.Files < math.MaxInt32 {
+		if err = checkActiveExtentsLimit(dir, int(fs.Files)); err == nil {
+			t.Fatal("a limit beyond the inodes of the disk accepted")
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// ActiveRepair describes the repair of an extent being run, by a repair cycle or a read repair.
+type ActiveRepair struct {
+	ID               uint64 `json:"id"` // unique among the repairs of the partition since the start
+	ExtentID         uint64 `json:"extentID"`
+	Source           string `json:"source"`
+	Size             uint64 `json:"size"` // the size of the source to repair to
+	BytesTransferred uint64 `json:"bytesTransferred"`
+	StartTime        int64  `json:"startTime"`
+}
+
+type activeRepair struct {
+	info   ActiveRepair
+	cancel context.CancelFunc
+}
+
+// activeRepairs registers the repairs of the extents being run, so that a stuck one can be canceled alone.
+// The repairs are kept by their ids, since the repairs of an extent may overlap, such as the one of the
+// leader and the one sent to the follower on the same node.
+type activeRepairs struct {
+	sync.Mutex
+	lastID  uint64
+	repairs map[uint64]*activeRepair
+}
+
+// Register the repair of the extent, the returned context is canceled by CancelRepair or along with ctx.
+func (dp *DataPartition) startActiveRepair(ctx context.Context, extentID uint64, source string, size uint64) (
+	repairCtx context.Context, repair *activeRepair, done func()) {
+	var cancel context.CancelFunc
+	repairCtx, cancel = context.WithCancel(ctx)
+	a := &dp.activeRepairs
+	a.Lock()
+	if a.repairs == nil {
+		a.repairs = make(map[uint64]*activeRepair)
+	}
+	a.lastID++
+	repair = &activeRepair{
+		info: ActiveRepair{ID: a.lastID, ExtentID: extentID, Source: source, Size: size,
+			StartTime: time.Now().Unix()},
+		cancel: cancel,
+	}
+	a.repairs[repair.info.ID] = repair
+	a.Unlock()
+	done = func() {
+		a.Lock()
+		delete(a.repairs, repair.info.ID)
+		a.Unlock()
+		cancel()
+	}
+	return
+}
+
+func (dp *DataPartition) recordActiveRepairBytes(repair *activeRepair, size uint64) {
+	a := &dp.activeRepairs
+	a.Lock()
+	repair.info.BytesTransferred += size
+	a.Unlock()
+}
+
+// Return the bytes the repair has transferred.
+func (dp *DataPartition) activeRepairBytes(repair *activeRepair) uint64 {
+	a := &dp.activeRepairs
+	a.Lock()
+	defer a.Unlock()
+	return repair.info.BytesTransferred
+}
+
+// The repair stopped by the context, of the cycle or by CancelRepair, is not a failure of the extent.
+func isRepairCanceled(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
+
+// ListActiveRepairs returns the repairs of the extents being run, sorted by the extent id and the repair id.
+func (dp *DataPartition) ListActiveRepairs() (repairs []*ActiveRepair) {
+	a := &dp.activeRepairs
+	a.Lock()
+	defer a.Unlock()
+	repairs = make([]*ActiveRepair, 0, len(a.repairs))
+	for _, repair := range a.repairs {
+		info := repair.info
+		repairs = append(repairs, &info)
+	}
+	sort.Slice(repairs, func(i, j int) bool {
+		if repairs[i].ExtentID != repairs[j].ExtentID {
+			return repairs[i].ExtentID < repairs[j].ExtentID
+		}
+		return repairs[i].ID < repairs[j].ID
+	})
+	return
+}
+
+// CancelRepair cancels the repairs of the extent being run. The repair stops after the packet being written,
+// which leaves the extent valid to be continued by the next repair cycle, and it is not counted as a failure.
+func (dp *DataPartition) CancelRepair(extentID uint64) (err error) {
+	a := &dp.activeRepairs
+	a.Lock()
+	defer a.Unlock()
+	canceled := 0
+	for _, repair := range a.repairs {
+		if repair.info.ExtentID != extentID {
+			continue
+		}
+		repair.cancel()
+		canceled++
+		log.LogWarnf("action[CancelRepair] partition(%v) extent(%v) repair(%v) from %v canceled, %v bytes transferred.",
+			dp.partitionID, extentID, repair.info.ID, repair.info.Source, repair.info.BytesTransferred)
+	}
+	if canceled == 0 {
+		return fmt.Errorf("extent(%v) of partition(%v) is not being repaired", extentID, dp.partitionID)
+	}
+	return
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCancelActiveRepair(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	repairCtx, repair, done := dp.startActiveRepair(context.Background(), 1025, "192.168.0.2:17310", 4096)
+	_, _, otherDone := dp.startActiveRepair(context.Background(), 1024, "192.168.0.3:17310", 8192)
+	// the repair of the same extent, by the leader and by the read repair, registered alone
+	sameCtx, _, sameDone := dp.startActiveRepair(context.Background(), 1025, "192.168.0.3:17310", 4096)
+	dp.recordActiveRepairBytes(repair, 1024)
+	repairs := dp.ListActiveRepairs()
+	if len(repairs) != 3 || repairs[0].ExtentID != 1024 || repairs[1].ExtentID != 1025 || repairs[2].ExtentID != 1025 {
+		t.Fatalf("active repairs(%v), expected extents 1024 and 1025 twice", repairs)
+	}
+	if repairs[1].ID == repairs[2].ID || repairs[1].ID != repair.info.ID {
+		t.Fatalf("active repairs(%v) of extent 1025, expected unique ids sorted", repairs[1:])
+	}
+	if repairs[1].BytesTransferred != 1024 || repairs[1].Source != "192.168.0.2:17310" || repairs[2].BytesTransferred != 0 {
+		t.Fatalf("active repairs(%v) of extent 1025 unexpected", repairs[1:])
+	}
+	if err := dp.CancelRepair(1025); err != nil {
+		t.Fatal(err)
+	}
+	for _, ctx := range []context.Context{repairCtx, sameCtx} {
+		select {
+		case <-ctx.Done():
+			if !isRepairCanceled(ctx.Err()) {
+				t.Fatalf("repair of extent 1025 stopped by %v", ctx.Err())
+			}
+		default:
+			t.Fatalf("repair of extent 1025 not canceled")
+		}
+	}
+	done()
+	sameDone()
+	if repairs = dp.ListActiveRepairs(); len(repairs) != 1 || repairs[0].ExtentID != 1024 {
+		t.Fatalf("active repairs(%v) after the cancel, expected extent 1024", repairs)
+	}
+	if err := dp.CancelRepair(1025); err == nil {
+		t.Fatalf("cancel the repair done succeeded")
+	}
+	otherDone()
+	if repairs = dp.ListActiveRepairs(); len(repairs) != 0 {
+		t.Fatalf("active repairs(%v) left", repairs)
+	}
+}
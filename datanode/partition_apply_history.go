@@ -0,0 +1,117 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	ApplyHistoryFile        = "APPLY_HISTORY"
+	RotatedApplyHistoryFile = "APPLY_HISTORY.1"
+
+	DefaultApplyHistoryLimit = 100
+)
+
+// The events the applied ids are recorded at in the apply history.
+const (
+	ApplyCheckpointPersist = "persist"
+	ApplyCheckpointLoad    = "load"
+)
+
+// ApplyCheckpoint is an applied id recorded in the apply history, with the time and the event it is recorded at.
+type ApplyCheckpoint struct {
+	Time      int64  `json:"time"`
+	AppliedID uint64 `json:"appliedID"`
+	Event     string `json:"event"`
+}
+
+// Append the applied id to the apply history if it is enabled by applyHistorySize. The history is kept in
+// two files of half the size, the current one is rotated once it is full. It must be called with persistLock.
+func (dp *DataPartition) recordApplyCheckpoint(appliedID uint64, event string) {
+	var size int64
+	if dp.disk != nil && dp.disk.space != nil {
+		size = dp.disk.space.GetApplyHistorySize()
+	}
+	if size <= 0 {
+		return
+	}
+	if err := dp.appendApplyCheckpoint(appliedID, event, size/2); err != nil {
+		log.LogWarnf("action[recordApplyCheckpoint] partition(%v) appliedID(%v) err(%v).", dp.partitionID, appliedID, err)
+	}
+}
+
+func (dp *DataPartition) appendApplyCheckpoint(appliedID uint64, event string, fileSize int64) (err error) {
+	filename := path.Join(dp.Path(), ApplyHistoryFile)
+	if info, statErr := os.Stat(filename); statErr == nil && info.Size() >= fileSize {
+		if err = os.Rename(filename, path.Join(dp.Path(), RotatedApplyHistoryFile)); err != nil {
+			return
+		}
+	}
+	fp, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+	defer fp.Close()
+	_, err = fp.WriteString(fmt.Sprintf("%d %d %s\n", time.Now().Unix(), appliedID, event))
+	return
+}
+
+// ApplyHistory returns the limit latest applied ids recorded in the apply history, oldest first.
+func (dp *DataPartition) ApplyHistory(limit int) (checkpoints []*ApplyCheckpoint, err error) {
+	if limit <= 0 {
+		limit = DefaultApplyHistoryLimit
+	}
+	dp.persistLock.Lock()
+	defer dp.persistLock.Unlock()
+	checkpoints = make([]*ApplyCheckpoint, 0)
+	for _, name := range []string{RotatedApplyHistoryFile, ApplyHistoryFile} {
+		if checkpoints, err = readApplyCheckpoints(path.Join(dp.Path(), name), checkpoints); err != nil {
+			return
+		}
+	}
+	if len(checkpoints) > limit {
+		checkpoints = checkpoints[len(checkpoints)-limit:]
+	}
+	return
+}
+
+// Append the checkpoints in the file to the given ones. A missing file has no checkpoints, and the lines
+// failed to be parsed, such as the one cut by a crash, are skipped.
+func readApplyCheckpoints(filename string, checkpoints []*ApplyCheckpoint) ([]*ApplyCheckpoint, error) {
+	fp, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return checkpoints, nil
+	}
+	if err != nil {
+		return checkpoints, err
+	}
+	defer fp.Close()
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		checkpoint := &ApplyCheckpoint{}
+		if _, err = fmt.Sscanf(scanner.Text(), "%d %d %s", &checkpoint.Time, &checkpoint.AppliedID, &checkpoint.Event); err != nil {
+			continue
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints, scanner.Err()
+}
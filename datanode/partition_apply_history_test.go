@@ -0,0 +1,76 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestApplyHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apply_history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	dp.path = dir
+	dp.disk = &Disk{space: &SpaceManager{}}
+	if err = dp.storeAppliedID(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path.Join(dir, ApplyHistoryFile)); !os.IsNotExist(err) {
+		t.Fatalf("apply history written while disabled: %v", err)
+	}
+
+	dp.disk.space.SetApplyHistorySize(200)
+	for appliedID := uint64(1); appliedID <= 20; appliedID++ {
+		if err = dp.storeAppliedID(appliedID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkpoints, err := dp.ApplyHistory(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 3 || checkpoints[0].AppliedID != 18 || checkpoints[2].AppliedID != 20 ||
+		checkpoints[2].Event != ApplyCheckpointPersist {
+		t.Fatalf("latest checkpoints %+v, expected 18 to 20", checkpoints)
+	}
+	if checkpoints, err = dp.ApplyHistory(100); err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) >= 20 || checkpoints[len(checkpoints)-1].AppliedID != 20 {
+		t.Fatalf("%v checkpoints kept, expected the history bounded and up to 20", len(checkpoints))
+	}
+	for i := 1; i < len(checkpoints); i++ {
+		if checkpoints[i].AppliedID != checkpoints[i-1].AppliedID+1 {
+			t.Fatalf("checkpoints not in order: %+v", checkpoints)
+		}
+	}
+	var size int64
+	for _, name := range []string{ApplyHistoryFile, RotatedApplyHistoryFile} {
+		info, err := os.Stat(path.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += info.Size()
+	}
+	if size > 200+2*32 {
+		t.Fatalf("apply history of %v bytes exceeds the limit", size)
+	}
+}
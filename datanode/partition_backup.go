@@ -0,0 +1,245 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The metadata files of the extent store which are exported along with the extents.
+var exportedStoreFiles = []string{
+	storage.ExtBaseExtentIDFileName,
+	storage.ExtCrcHeaderFileName,
+	storage.TinyExtDeletedFileName,
+	storage.NormalExtDeletedFileName,
+}
+
+const (
+	importTempDirPrefix = ".import_" // the partition being imported, removed on the load of the disk if left
+)
+
+type exportedExtent struct {
+	id       uint64
+	name     string
+	size     int64
+	modified int64
+}
+
+// ExportExtents writes the META, the metadata files of the extent store and the extents of the partition into w
+// as a tar archive.
+// The extents and the base extent id are taken at once under the lock of the extent store, and every extent not
+// deleted is exported up to its size at that time, including the empty ones and the ones just written, so the
+// data appended later is left out and the base extent id in the archive covers all the extents in it. The
+// repairs, the compaction and the deletes are not held off, so an extent deleted meanwhile is skipped, and the
+// ranges rewritten meanwhile are exported as they are read.
+// The raft log and the applied index are not exported, neither are the encrypted partitions, whose extents are
+// of no use without the seal files and the key of the volume.
+func (dp *DataPartition) ExportExtents(w io.Writer) (err error) {
+	if dp.IsEncrypted() {
+		return fmt.Errorf("partition(%v) is encrypted and can not be exported", dp.partitionID)
+	}
+	infos, baseExtentID := dp.extentStore.ExportSnapshot()
+	extents := make([]*exportedExtent, 0, len(infos))
+	for _, ei := range infos {
+		if !storage.IsTinyExtent(ei.FileID) && ei.FileID > baseExtentID {
+			baseExtentID = ei.FileID
+		}
+		extents = append(extents, &exportedExtent{id: ei.FileID, name: strconv.FormatUint(ei.FileID, 10),
+			size: int64(ei.Size), modified: ei.ModifyTime})
+	}
+	sort.Slice(extents, func(i, j int) bool { return extents[i].id < extents[j].id })
+	tw := tar.NewWriter(w)
+	for _, name := range append([]string{DataPartitionMetadataFileName}, exportedStoreFiles...) {
+		var data []byte
+		if data, err = ioutil.ReadFile(path.Join(dp.Path(), name)); err != nil {
+			return
+		}
+		if name == storage.ExtBaseExtentIDFileName {
+			data = setBaseExtentID(data, baseExtentID)
+		}
+		header := &tar.Header{Name: name, Mode: 0666, Size: int64(len(data)), ModTime: time.Now()}
+		if err = tw.WriteHeader(header); err != nil {
+			return
+		}
+		if _, err = tw.Write(data); err != nil {
+			return
+		}
+	}
+	exported := 0
+	for _, extent := range extents {
+		if err = exportExtentFile(tw, dp.extentFilePath(extent.id), extent); os.IsNotExist(err) {
+			log.LogWarnf("action[ExportExtents] partition(%v) extent(%v) deleted during the export, skipped.",
+				dp.partitionID, extent.id)
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		exported++
+	}
+	if err = tw.Close(); err != nil {
+		return
+	}
+	log.LogInfof("action[ExportExtents] partition(%v) exported %v extents, base extent id(%v).",
+		dp.partitionID, exported, baseExtentID)
+	return
+}
+
+// Put the base extent id taken with the extents into the EXTENT_META read later, which may have been advanced
+// by the extents created since.
+func setBaseExtentID(data []byte, baseExtentID uint64) []byte {
+	if len(data) < storage.BaseExtentIDOffset+8 {
+		grown := make([]byte, storage.BaseExtentIDOffset+8)
+		copy(grown, data)
+		data = grown
+	}
+	binary.BigEndian.PutUint64(data[storage.BaseExtentIDOffset:], baseExtentID)
+	return data
+}
+
+func exportExtentFile(tw *tar.Writer, filePath string, extent *exportedExtent) (err error) {
+	var file *os.File
+	if file, err = os.Open(filePath); err != nil {
+		return
+	}
+	defer file.Close()
+	header := &tar.Header{Name: extent.name, Mode: 0666, Size: extent.size, ModTime: time.Unix(extent.modified, 0)}
+	if err = tw.WriteHeader(header); err != nil {
+		return
+	}
+	if _, err = io.CopyN(tw, file, extent.size); err != nil {
+		err = fmt.Errorf("export extent(%v) size(%v): %v", extent.name, extent.size, err)
+	}
+	return
+}
+
+// Only the files written by ExportExtents may appear in the archive, which keeps the entries from
+// escaping the partition directory.
+func isExportedFileName(name string) bool {
+	if name == DataPartitionMetadataFileName {
+		return true
+	}
+	for _, storeFile := range exportedStoreFiles {
+		if name == storeFile {
+			return true
+		}
+	}
+	_, err := strconv.ParseUint(name, 10, 64)
+	return err == nil
+}
+
+// ImportExtents recreates a partition directory on the disk from the tar archive written by ExportExtents.
+// The archive is unpacked into a temporary directory which is renamed to the partition directory at the end,
+// so a broken archive never leaves a partial partition behind. The partition must not exist on the disk.
+func (d *Disk) ImportExtents(r io.Reader) (partitionDir string, err error) {
+	tempDir := path.Join(d.Path, fmt.Sprintf(importTempDirPrefix+"%v", time.Now().UnixNano()))
+	if err = os.Mkdir(tempDir, 0755); err != nil {
+		return
+	}
+	// the directory is gone once renamed to the partition directory, and it is removed on any failure before
+	defer os.RemoveAll(tempDir)
+	tr := tar.NewReader(r)
+	var metaData []byte
+	for {
+		var header *tar.Header
+		if header, err = tr.Next(); err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+		if header.Typeflag != tar.TypeReg || !isExportedFileName(header.Name) {
+			err = fmt.Errorf("unexpected entry(%v) in the archive", header.Name)
+			return
+		}
+		if header.Name == DataPartitionMetadataFileName {
+			if metaData, err = ioutil.ReadAll(tr); err != nil {
+				return
+			}
+			continue
+		}
+		if err = importFile(tempDir, header, tr); err != nil {
+			return
+		}
+	}
+	if metaData == nil {
+		err = fmt.Errorf("no %v in the archive", DataPartitionMetadataFileName)
+		return
+	}
+	meta := &DataPartitionMetadata{}
+	if err = json.Unmarshal(metaData, meta); err != nil {
+		return
+	}
+	var verified bool
+	if verified, err = meta.VerifyChecksum(); err != nil {
+		return
+	}
+	if !verified {
+		err = fmt.Errorf("%v in the archive is corrupted", DataPartitionMetadataFileName)
+		return
+	}
+	if err = writeFileAtomically(tempDir, TempMetadataFileName, DataPartitionMetadataFileName, metaData); err != nil {
+		return
+	}
+	if err = writeFileAtomically(tempDir, TempMetadataBackupFileName, MetadataBackupFileName, metaData); err != nil {
+		return
+	}
+	if _, err = d.findPartitionDir(meta.PartitionID); err == nil {
+		err = fmt.Errorf("partition(%v) already exists on disk(%v)", meta.PartitionID, d.Path)
+		return
+	}
+	partitionDir = path.Join(d.Path, fmt.Sprintf(DataPartitionPrefix+"_%v_%v", meta.PartitionID, meta.PartitionSize))
+	if err = os.Rename(tempDir, partitionDir); err != nil {
+		return
+	}
+	if syncErr := syncDir(d.Path); syncErr != nil {
+		log.LogWarnf("action[ImportExtents] disk(%v) sync err(%v).", d.Path, syncErr)
+	}
+	log.LogInfof("action[ImportExtents] disk(%v) imported partition(%v) into %v.", d.Path, meta.PartitionID, partitionDir)
+	return
+}
+
+func importFile(dir string, header *tar.Header, r io.Reader) (err error) {
+	var file *os.File
+	if file, err = os.OpenFile(path.Join(dir, header.Name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666); err != nil {
+		return
+	}
+	defer file.Close()
+	if _, err = io.CopyN(file, r, header.Size); err != nil {
+		return
+	}
+	if err = file.Sync(); err != nil {
+		return
+	}
+	if !header.ModTime.IsZero() {
+		os.Chtimes(path.Join(dir, header.Name), header.ModTime, header.ModTime)
+	}
+	return
+}
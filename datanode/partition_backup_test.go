@@ -0,0 +1,136 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"archive/tar"
+	"bytes"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestExportImportExtents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export_import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := path.Join(dir, "src", "datapartition_1_128")
+	store, err := storage.NewExtentStore(src, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("extent"), 1000)
+	// the extents just written and the empty ones are exported as well
+	for _, extentID := range []uint64{1025, 1026} {
+		if err = store.Create(extentID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = store.Write(1025, 0, int64(len(data)), data, crc32.ChecksumIEEE(data), storage.AppendWriteType, true); err != nil {
+		t.Fatal(err)
+	}
+	dp := newMockPartition(store)
+	dp.path = src
+	dp.config = &dataPartitionCfg{VolName: "vol", PartitionID: 1, PartitionSize: 128,
+		Peers: []proto.Peer{{ID: 1, Addr: "127.0.0.1:17310"}}, Hosts: []string{"127.0.0.1:17310"}}
+	if err = dp.PersistMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err = dp.ExportExtents(&archive); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	disk := &Disk{Path: path.Join(dir, "dst")}
+	os.Mkdir(disk.Path, 0755)
+	partitionDir, err := disk.ImportExtents(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := ioutil.ReadDir(disk.Path); len(entries) != 1 || strings.HasPrefix(entries[0].Name(), importTempDirPrefix) {
+		t.Fatalf("disk holds %v entries after the import, expected the partition only", len(entries))
+	}
+	imported, err := storage.NewExtentStore(partitionDir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imported.Close()
+	if !imported.HasExtent(1025) || !imported.HasExtent(1026) {
+		t.Fatalf("extents not imported")
+	}
+	read := make([]byte, len(data))
+	if _, err = imported.Read(1025, 0, int64(len(read)), read, false); err != nil || !bytes.Equal(read, data) {
+		t.Fatalf("imported extent read err(%v)", err)
+	}
+	if extentID, _ := imported.NextExtentID(); extentID <= 1026 {
+		t.Fatalf("next extent id(%v) of the imported store reuses an imported extent", extentID)
+	}
+}
+
+func TestImportExtentsBroken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "import_broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	tw.WriteHeader(&tar.Header{Name: "1025", Mode: 0666, Size: 6})
+	tw.Write([]byte("extent"))
+	tw.Close()
+	disk := &Disk{Path: dir}
+	if _, err = disk.ImportExtents(&archive); err == nil {
+		t.Fatalf("archive without %v imported", DataPartitionMetadataFileName)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("import left %v behind", entries[0].Name())
+	}
+}
+
+func TestExportExtentFileDeleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export_extent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	extent := &exportedExtent{id: 1025, name: "1025", size: 6}
+	if err = exportExtentFile(tw, path.Join(dir, "1025"), extent); !os.IsNotExist(err) {
+		t.Fatalf("deleted extent exported err(%v)", err)
+	}
+	ioutil.WriteFile(path.Join(dir, "1025"), []byte("extent"), 0666)
+	if err = exportExtentFile(tw, path.Join(dir, "1025"), extent); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	tr := tar.NewReader(&buf)
+	if header, err := tr.Next(); err != nil || header.Name != "1025" || header.Size != 6 {
+		t.Fatalf("first entry(%v) err(%v), expected only the extent written", header, err)
+	}
+	if _, err = tr.Next(); err != io.EOF {
+		t.Fatalf("more entries than the extent written, err(%v)", err)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type partitionMetricDesc struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     func(dp *DataPartition) float64
+}
+
+// partitionCollector collects the metrics of all the partitions of the space at each scrape, labeled by the
+// partition id, the volume and the disk of the partition, so the metrics of a partition leave with it.
+type partitionCollector struct {
+	space        *SpaceManager
+	metrics      []*partitionMetricDesc
+	writeLatency *prometheus.Desc
+	repairWait   *prometheus.Desc
+}
+
+var partitionMetricLabels = []string{"partition_id", "volume", "disk"}
+
+func newPartitionCollector(space *SpaceManager) *partitionCollector {
+	metric := func(name, help string, valueType prometheus.ValueType, value func(dp *DataPartition) float64) *partitionMetricDesc {
+		return &partitionMetricDesc{
+			desc:      exporter.NewDesc("partition_"+name, help, partitionMetricLabels),
+			valueType: valueType,
+			value:     value,
+		}
+	}
+	return &partitionCollector{
+		space: space,
+		metrics: []*partitionMetricDesc{
+			metric("size_bytes", "Size of the data partition.", prometheus.GaugeValue,
+				func(dp *DataPartition) float64 { return float64(dp.Size()) }),
+			metric("used_bytes", "Space used by the data partition.", prometheus.GaugeValue,
+				func(dp *DataPartition) float64 { return float64(dp.Used()) }),
+			metric("available_bytes", "Space left in the data partition.", prometheus.GaugeValue,
+				func(dp *DataPartition) float64 { return float64(dp.Available()) }),
+			metric("status", "Status of the data partition, 1 read only, 2 read write, -1 unavailable.", prometheus.GaugeValue,
+				func(dp *DataPartition) float64 { return float64(dp.Status()) }),
+			metric("extents", "Extents in the data partition.", prometheus.GaugeValue,
+				func(dp *DataPartition) float64 { return float64(dp.GetExtentCount()) }),
+			metric("repair_queue_depth", "Extents waiting to be repaired.", prometheus.GaugeValue,
+				func(dp *DataPartition) float64 { return float64(dp.metrics.RepairQueueDepth()) }),
+			metric("read_repairs_total", "Extents repaired on the reads since the partition is loaded.", prometheus.CounterValue,
+				func(dp *DataPartition) float64 { return float64(dp.metrics.ReadRepairs()) }),
+			metric("repair_extents_created", "Extents created by the current repair cycle.", prometheus.GaugeValue,
+				func(dp *DataPartition) float64 { return float64(dp.GetRepairStats().ExtentsCreated) }),
+			metric("repair_extents_repaired", "Extents repaired by the current repair cycle.", prometheus.GaugeValue,
+				func(dp *DataPartition) float64 { return float64(dp.GetRepairStats().ExtentsRepaired) }),
+			metric("repair_transferred_bytes", "Bytes transferred by the current repair cycle.", prometheus.GaugeValue,
+				func(dp *DataPartition) float64 { return float64(dp.GetRepairStats().BytesTransferred) }),
+			metric("repair_duration_seconds", "Duration of the latest repair cycle.", prometheus.GaugeValue,
+				func(dp *DataPartition) float64 { return dp.GetRepairStats().LastRepairDuration.Seconds() }),
+		},
+		writeLatency: exporter.NewDesc("partition_write_latency_seconds",
+			"Latencies of the writes in the recent windows.", partitionMetricLabels),
+		repairWait: exporter.NewDesc("partition_repair_wait_seconds",
+			"Waits of the extents before their repairs start.", partitionMetricLabels),
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *partitionCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range c.metrics {
+		ch <- metric.desc
+	}
+	ch <- c.writeLatency
+	ch <- c.repairWait
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *partitionCollector) Collect(ch chan<- prometheus.Metric) {
+	partitions := make([]*DataPartition, 0)
+	c.space.RangePartitions(func(partition *DataPartition) bool {
+		partitions = append(partitions, partition)
+		return true
+	})
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].partitionID < partitions[j].partitionID
+	})
+	for _, dp := range partitions {
+		var diskPath string
+		if dp.disk != nil {
+			diskPath = dp.disk.Path
+		}
+		labels := []string{strconv.FormatUint(dp.partitionID, 10), dp.volumeID, diskPath}
+		for _, metric := range c.metrics {
+			ch <- prometheus.MustNewConstMetric(metric.desc, metric.valueType, metric.value(dp), labels...)
+		}
+		ch <- percentilesSummary(c.writeLatency, dp.metrics.LatencyPercentiles(), labels)
+		ch <- percentilesSummary(c.repairWait, dp.metrics.RepairWaitPercentiles(), labels)
+	}
+}
+
+// The percentiles as a summary, with the quantiles and the sum in seconds.
+func percentilesSummary(desc *prometheus.Desc, percentiles *LatencyPercentiles, labels []string) prometheus.Metric {
+	return prometheus.MustNewConstSummary(desc, percentiles.Count, percentiles.Sum.Seconds(), map[float64]float64{
+		0.5:  percentiles.P50.Seconds(),
+		0.95: percentiles.P95.Seconds(),
+		0.99: percentiles.P99.Seconds(),
+	}, labels...)
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestPartitionCollector(t *testing.T) {
+	space := &SpaceManager{partitions: make(map[uint64]*DataPartition)}
+	for _, partitionID := range []uint64{1, 2} {
+		dp := newMockPartition(newMockExtentStore(map[uint64]uint64{1024: 10}))
+		dp.partitionID = partitionID
+		dp.volumeID = "vol1"
+		dp.partitionSize = 1024
+		dp.used = 256
+		dp.partitionStatus = proto.ReadWrite
+		dp.disk = &Disk{Path: "/data1"}
+		dp.metrics.RecordWriteLatency(2047 * time.Microsecond)
+		space.partitions[partitionID] = dp
+	}
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(newPartitionCollector(space)); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := make(map[string][]*dto.Metric)
+	for _, family := range families {
+		metrics[strings.TrimPrefix(family.GetName(), "_partition_")] = family.GetMetric()
+	}
+	for name, expected := range map[string]float64{"used_bytes": 256, "available_bytes": 768, "status": 2} {
+		if len(metrics[name]) != 2 {
+			t.Fatalf("%v of %v partitions collected, expected 2", name, len(metrics[name]))
+		}
+		for _, metric := range metrics[name] {
+			if value := metric.GetGauge().GetValue(); value != expected {
+				t.Fatalf("%v(%v) of %v, expected %v", name, value, metric.GetLabel(), expected)
+			}
+		}
+	}
+	labels := metrics["used_bytes"][1].GetLabel()
+	if len(labels) != 3 || labels[0].GetValue() != "/data1" || labels[1].GetValue() != "2" || labels[2].GetValue() != "vol1" {
+		t.Fatalf("labels(%v) of partition 2 unexpected", labels)
+	}
+	summary := metrics["write_latency_seconds"][0].GetSummary()
+	if summary.GetSampleCount() != 1 || summary.GetSampleSum() != 0.002047 {
+		t.Fatalf("write latency(%v), expected a sample of 0.002047", summary)
+	}
+	for _, quantile := range summary.GetQuantile() {
+		if quantile.GetQuantile() == 0.99 && quantile.GetValue() != 0.002047 {
+			t.Fatalf("quantile 0.99 of the write latency(%v), expected 0.002047", quantile.GetValue())
+		}
+	}
+}
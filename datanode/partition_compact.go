@@ -0,0 +1,265 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	tinyCompactionChunkSize     = util.BlockSize
+	tinyCompactionPauseInterval = time.Second
+)
+
+// TinyCompactionProgress describes the progress of the latest compaction of the tiny extents of a partition.
+type TinyCompactionProgress struct {
+	ID             uint64 `json:"id"`
+	Running        bool   `json:"running"`
+	Paused         bool   `json:"paused"`
+	Canceled       bool   `json:"canceled"`
+	ExtentsDone    int    `json:"extentsDone"`
+	ExtentsSkipped int    `json:"extentsSkipped"`
+	CurrentExtent  uint64 `json:"currentExtent"`
+	BytesScanned   uint64 `json:"bytesScanned"`
+	BytesReclaimed int64  `json:"bytesReclaimed"`
+	StartTime      int64  `json:"startTime"`
+	EndTime        int64  `json:"endTime"`
+	LastError      string `json:"lastError"`
+}
+
+type tinyCompactor struct {
+	sync.Mutex
+	running  int32
+	paused   int32
+	cancelC  chan struct{}
+	progress TinyCompactionProgress
+}
+
+// CompactTinyExtents reclaims the space of the tiny extents that holds no live data. For each tiny extent,
+// the holes of its delete records are punched again, and the allocated pages holding only zeros are punched,
+// e.g. the deleted ranges written back by a repair. The live data is never moved, since the extent keys on
+// the meta nodes refer to it by the extent id and offset.
+// The compaction runs on the repair leader of the partition only, and is refused on the followers. A tiny
+// extent being written is skipped, and the scan is throttled by the repair bandwidth limiter.
+func (dp *DataPartition) CompactTinyExtents() (err error) {
+	c := &dp.compactor
+	if dp.partitionStatus == proto.Unavailable || dp.IsDraining() {
+		return fmt.Errorf("partition(%v) is not available for compaction", dp.partitionID)
+	}
+	if !dp.isRepairLeader() {
+		return fmt.Errorf("partition(%v) is not the leader to compact on %v", dp.partitionID, LocalIP)
+	}
+	if !atomic.CompareAndSwapInt32(&c.running, 0, 1) {
+		return fmt.Errorf("partition(%v) is being compacted", dp.partitionID)
+	}
+	c.Lock()
+	c.cancelC = make(chan struct{})
+	c.progress = TinyCompactionProgress{ID: dp.partitionID, Running: true, StartTime: time.Now().Unix()}
+	c.Unlock()
+	atomic.StoreInt32(&c.paused, 0)
+	defer func() {
+		c.Lock()
+		c.progress.Running = false
+		c.progress.CurrentExtent = 0
+		c.progress.EndTime = time.Now().Unix()
+		if err != nil {
+			c.progress.LastError = err.Error()
+		}
+		c.Unlock()
+		atomic.StoreInt32(&c.running, 0)
+		dp.extentStore.MarkUsageDirty()
+		log.LogInfof("action[CompactTinyExtents] partition(%v) progress(%+v) err(%v).",
+			dp.partitionID, dp.GetTinyCompactionProgress(), err)
+	}()
+	for extentID := uint64(storage.TinyExtentStartID); extentID < storage.TinyExtentStartID+storage.TinyExtentCount; extentID++ {
+		if c.waitIfPaused() {
+			c.Lock()
+			c.progress.Canceled = true
+			c.Unlock()
+			return
+		}
+		var canceled bool
+		if canceled, err = dp.compactTinyExtent(extentID); err != nil {
+			return
+		}
+		if canceled {
+			c.Lock()
+			c.progress.Canceled = true
+			c.Unlock()
+			return
+		}
+	}
+	return
+}
+
+// Compact the tiny extent if it is available, which is skipped if it is being written. The extent is given
+// back to the writes while the compaction is paused, and taken again on the resume, which skips the rest of
+// it if it is being written by then. Only the extent compacted to the end is counted as done.
+func (dp *DataPartition) compactTinyExtent(extentID uint64) (canceled bool, err error) {
+	c := &dp.compactor
+	if !dp.takeTinyExtent(extentID) {
+		c.Lock()
+		c.progress.ExtentsSkipped++
+		c.Unlock()
+		return
+	}
+	taken := true
+	c.Lock()
+	c.progress.CurrentExtent = extentID
+	c.Unlock()
+	before := dp.tinyExtentAllocatedSize(extentID)
+	defer func() {
+		if taken {
+			dp.extentStore.SendToAvailableTinyExtentC(extentID)
+		}
+		c.Lock()
+		c.progress.BytesReclaimed += before - dp.tinyExtentAllocatedSize(extentID)
+		c.Unlock()
+	}()
+	if err = dp.extentStore.ReplayTinyDeletes(extentID); err != nil {
+		return
+	}
+	watermark, err := dp.extentStore.GetTinyExtentOffset(extentID)
+	if err != nil {
+		return
+	}
+	for offset := int64(0); offset < watermark; offset += tinyCompactionChunkSize {
+		if c.isPaused() {
+			dp.extentStore.SendToAvailableTinyExtentC(extentID)
+			taken = false
+			if canceled = c.waitIfPaused(); canceled {
+				return
+			}
+			if taken = dp.takeTinyExtent(extentID); !taken {
+				c.Lock()
+				c.progress.ExtentsSkipped++
+				c.Unlock()
+				return
+			}
+		} else if canceled = c.isCanceled(); canceled {
+			return
+		}
+		dp.disk.space.waitRepairBandwidth(tinyCompactionChunkSize, dp.RepairPriority())
+		if err = dp.extentStore.PunchTinyZeroPages(extentID, offset, tinyCompactionChunkSize); err != nil {
+			return
+		}
+		c.Lock()
+		c.progress.BytesScanned += tinyCompactionChunkSize
+		c.Unlock()
+	}
+	c.Lock()
+	c.progress.ExtentsDone++
+	c.Unlock()
+	return
+}
+
+// Take the tiny extent from the available ones, which fails if it is being written.
+func (dp *DataPartition) takeTinyExtent(extentID uint64) bool {
+	return len(dp.extentStore.TakeAvailableTinyExtents([]uint64{extentID})) > 0
+}
+
+func (dp *DataPartition) tinyExtentAllocatedSize(extentID uint64) int64 {
+	finfo, err := os.Stat(path.Join(dp.Path(), strconv.FormatUint(extentID, 10)))
+	if err != nil {
+		return 0
+	}
+	return dp.actualSize(dp.Path(), finfo)
+}
+
+func (c *tinyCompactor) isPaused() bool {
+	return atomic.LoadInt32(&c.paused) == 1
+}
+
+func (c *tinyCompactor) isCanceled() bool {
+	c.Lock()
+	cancelC := c.cancelC
+	c.Unlock()
+	select {
+	case <-cancelC:
+		return true
+	default:
+		return false
+	}
+}
+
+// Block while the compaction is paused, and tell if it is canceled. No tiny extent is to be held by the
+// compaction when it waits.
+func (c *tinyCompactor) waitIfPaused() (canceled bool) {
+	c.Lock()
+	cancelC := c.cancelC
+	c.Unlock()
+	for c.isPaused() {
+		select {
+		case <-cancelC:
+			return true
+		case <-time.After(tinyCompactionPauseInterval):
+		}
+	}
+	return c.isCanceled()
+}
+
+// PauseTinyCompaction pauses or resumes the running compaction of the tiny extents.
+func (dp *DataPartition) PauseTinyCompaction(pause bool) (err error) {
+	if atomic.LoadInt32(&dp.compactor.running) == 0 {
+		return fmt.Errorf("partition(%v) is not being compacted", dp.partitionID)
+	}
+	var paused int32
+	if pause {
+		paused = 1
+	}
+	atomic.StoreInt32(&dp.compactor.paused, paused)
+	return
+}
+
+// CancelTinyCompaction cancels the running compaction of the tiny extents, which stops at the next chunk.
+func (dp *DataPartition) CancelTinyCompaction() (err error) {
+	c := &dp.compactor
+	if atomic.LoadInt32(&c.running) == 0 {
+		return fmt.Errorf("partition(%v) is not being compacted", dp.partitionID)
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.cancelC == nil {
+		return
+	}
+	select {
+	case <-c.cancelC:
+	default:
+		close(c.cancelC)
+	}
+	return
+}
+
+// GetTinyCompactionProgress returns the progress of the latest compaction of the tiny extents.
+func (dp *DataPartition) GetTinyCompactionProgress() (progress TinyCompactionProgress) {
+	c := &dp.compactor
+	c.Lock()
+	defer c.Unlock()
+	progress = c.progress
+	progress.ID = dp.partitionID
+	progress.Paused = progress.Running && atomic.LoadInt32(&c.paused) == 1
+	return
+}
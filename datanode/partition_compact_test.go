@@ -0,0 +1,177 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+	"golang.org/x/time/rate"
+)
+
+// compactStore keeps the tiny extents available to the compaction in the memory. Only the first tiny extent
+// has data to compact, the others are being written.
+type compactStore struct {
+	*mockExtentStore
+	available map[uint64]bool
+	watermark int64
+	punches   int32
+	onPunch   func()
+}
+
+func (s *compactStore) TakeAvailableTinyExtents(extentIDs []uint64) (taken []uint64) {
+	s.Lock()
+	defer s.Unlock()
+	for _, extentID := range extentIDs {
+		if s.available[extentID] {
+			s.available[extentID] = false
+			taken = append(taken, extentID)
+		}
+	}
+	return
+}
+
+func (s *compactStore) SendToAvailableTinyExtentC(extentID uint64) {
+	s.Lock()
+	defer s.Unlock()
+	s.available[extentID] = true
+}
+
+func (s *compactStore) isAvailable(extentID uint64) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.available[extentID]
+}
+
+func (s *compactStore) ReplayTinyDeletes(extentID uint64) (err error) {
+	return
+}
+
+func (s *compactStore) GetTinyExtentOffset(extentID uint64) (watermark int64, err error) {
+	return s.watermark, nil
+}
+
+func (s *compactStore) PunchTinyZeroPages(extentID uint64, offset, size int64) (err error) {
+	if atomic.AddInt32(&s.punches, 1) == 1 && s.onPunch != nil {
+		s.onPunch()
+	}
+	return
+}
+
+func (s *compactStore) MarkUsageDirty() {
+}
+
+func newCompactPartition(t *testing.T) (dp *DataPartition, store *compactStore) {
+	store = &compactStore{
+		mockExtentStore: newMockExtentStore(map[uint64]uint64{}),
+		available:       map[uint64]bool{storage.TinyExtentStartID: true},
+		watermark:       3 * tinyCompactionChunkSize,
+	}
+	dp = newMockPartition(store)
+	dp.partitionStatus = proto.ReadWrite
+	dp.isLeader = true
+	dp.disk = &Disk{space: &SpaceManager{repairLimiter: rate.NewLimiter(rate.Inf, RepairBandwidthBurst)}}
+	return
+}
+
+// Pause the compaction at its first chunk, and wait until the extent is given back to the writes.
+func pauseAtFirstChunk(t *testing.T, dp *DataPartition, store *compactStore) (errC chan error) {
+	pausedC := make(chan struct{})
+	store.onPunch = func() {
+		if err := dp.PauseTinyCompaction(true); err != nil {
+			t.Error(err)
+		}
+		close(pausedC)
+	}
+	errC = make(chan error, 1)
+	go func() {
+		errC <- dp.CompactTinyExtents()
+	}()
+	<-pausedC
+	for deadline := time.Now().Add(5 * time.Second); !store.isAvailable(storage.TinyExtentStartID); {
+		if time.Now().After(deadline) {
+			t.Fatalf("tiny extent held by the paused compaction")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if progress := dp.GetTinyCompactionProgress(); !progress.Running || !progress.Paused || progress.ExtentsDone != 0 {
+		t.Fatalf("progress(%+v) of the paused compaction", progress)
+	}
+	return
+}
+
+func TestTinyCompactionPauseResume(t *testing.T) {
+	dp, store := newCompactPartition(t)
+	errC := pauseAtFirstChunk(t, dp, store)
+	if err := dp.PauseTinyCompaction(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+	progress := dp.GetTinyCompactionProgress()
+	if progress.Running || progress.Canceled || progress.ExtentsDone != 1 ||
+		progress.ExtentsSkipped != storage.TinyExtentCount-1 || progress.BytesScanned != uint64(store.watermark) {
+		t.Fatalf("progress(%+v) of the resumed compaction", progress)
+	}
+	if !store.isAvailable(storage.TinyExtentStartID) {
+		t.Fatalf("tiny extent not given back after the compaction")
+	}
+}
+
+func TestTinyCompactionPausedTaken(t *testing.T) {
+	dp, store := newCompactPartition(t)
+	errC := pauseAtFirstChunk(t, dp, store)
+	// a write takes the extent while the compaction is paused, the rest of it is skipped on the resume
+	if taken := store.TakeAvailableTinyExtents([]uint64{storage.TinyExtentStartID}); len(taken) != 1 {
+		t.Fatalf("tiny extent not taken by the write")
+	}
+	if err := dp.PauseTinyCompaction(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+	if progress := dp.GetTinyCompactionProgress(); progress.ExtentsDone != 0 || progress.ExtentsSkipped != storage.TinyExtentCount {
+		t.Fatalf("progress(%+v) with the extent taken by a write", progress)
+	}
+	if store.isAvailable(storage.TinyExtentStartID) {
+		t.Fatalf("tiny extent taken by the write given back by the compaction")
+	}
+}
+
+func TestTinyCompactionCancel(t *testing.T) {
+	dp, store := newCompactPartition(t)
+	errC := pauseAtFirstChunk(t, dp, store)
+	if err := dp.CancelTinyCompaction(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+	progress := dp.GetTinyCompactionProgress()
+	if progress.Running || !progress.Canceled || progress.ExtentsDone != 0 {
+		t.Fatalf("progress(%+v) of the canceled compaction", progress)
+	}
+	if !store.isAvailable(storage.TinyExtentStartID) {
+		t.Fatalf("tiny extent not given back after the cancel")
+	}
+	if err := dp.PauseTinyCompaction(true); err == nil {
+		t.Fatalf("pause of the compaction canceled succeeded")
+	}
+}
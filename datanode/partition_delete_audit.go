@@ -0,0 +1,187 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	DeleteAuditFile        = "DELETE_AUDIT"
+	RotatedDeleteAuditFile = "DELETE_AUDIT.1"
+
+	DefaultDeleteAuditLimit = 100
+)
+
+// The operations the deletes of the extents are initiated by, recorded in the delete audit log.
+const (
+	DeleteOpClient      = "client"       // OpMarkDelete sent by the meta node or a client
+	DeleteOpClientBatch = "client_batch" // OpBatchDeleteExtent sent by the meta node
+	DeleteOpExpiry      = "ttl_expiry"   // the extents expired by the ttl, on the leader and sent by it to the followers
+	DeleteOpTinyRepair  = "tiny_repair"  // the tiny delete records repaired from the leader
+)
+
+// DeleteRecord is a delete of an extent recorded in the delete audit log. The inode is 0 for the tiny extents,
+// whose deletes punch the holes of the files sharing them, and for the extents of the unknown inodes.
+type DeleteRecord struct {
+	Time     int64  `json:"time"`
+	ExtentID uint64 `json:"extentID"`
+	Inode    uint64 `json:"inode"`
+	Offset   int64  `json:"offset"`
+	Size     int64  `json:"size"`
+	Op       string `json:"op"`
+}
+
+// deleteAudit keeps the delete audit log of the partition open between the deletes.
+type deleteAudit struct {
+	sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Delete the extent after the delete is written ahead to the delete audit log, enabled by deleteAuditSize.
+// The record of a delete failed afterwards is kept, as what was asked is what the audit is for.
+func (dp *DataPartition) markDelete(extentID uint64, offset, size int64, op string) (err error) {
+	dp.recordDelete(extentID, offset, size, op)
+	return dp.extentStore.MarkDelete(extentID, offset, size)
+}
+
+// Append the delete to the audit log. The log is kept in two files of half the size, the current one is rotated
+// once it is full. The records reach the disk with the delete records of the extent store by flushDeletes.
+func (dp *DataPartition) recordDelete(extentID uint64, offset, size int64, op string) {
+	var limit int64
+	if dp.disk != nil && dp.disk.space != nil {
+		limit = dp.disk.space.GetDeleteAuditSize()
+	}
+	if limit <= 0 {
+		return
+	}
+	var inode uint64
+	if !storage.IsTinyExtent(extentID) {
+		if ei, err := dp.extentStore.Watermark(extentID); err == nil {
+			inode = ei.Inode
+		}
+	}
+	line := fmt.Sprintf("%d %d %d %d %d %s\n", time.Now().Unix(), extentID, inode, offset, size, op)
+	if err := dp.appendDeleteRecord(line, limit/2); err != nil {
+		log.LogWarnf("action[recordDelete] partition(%v) extent(%v) op(%v) err(%v).", dp.partitionID, extentID, op, err)
+	}
+}
+
+func (dp *DataPartition) appendDeleteRecord(line string, fileSize int64) (err error) {
+	a := &dp.deleteAudit
+	a.Lock()
+	defer a.Unlock()
+	filename := path.Join(dp.Path(), DeleteAuditFile)
+	if a.file != nil && a.size >= fileSize {
+		a.file.Sync()
+		a.file.Close()
+		a.file = nil
+		if err = os.Rename(filename, path.Join(dp.Path(), RotatedDeleteAuditFile)); err != nil {
+			return
+		}
+	}
+	if a.file == nil {
+		if a.file, err = os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+			return
+		}
+		var info os.FileInfo
+		if info, err = a.file.Stat(); err != nil {
+			a.file.Close()
+			a.file = nil
+			return
+		}
+		a.size = info.Size()
+	}
+	n, err := a.file.WriteString(line)
+	a.size += int64(n)
+	return
+}
+
+// Sync the delete audit log and then the delete records of the extent store.
+func (dp *DataPartition) flushDeletes() (err error) {
+	a := &dp.deleteAudit
+	a.Lock()
+	if a.file != nil {
+		err = a.file.Sync()
+	}
+	a.Unlock()
+	if storeErr := dp.extentStore.FlushDelete(); storeErr != nil {
+		err = storeErr
+	}
+	return
+}
+
+func (dp *DataPartition) closeDeleteAudit() {
+	a := &dp.deleteAudit
+	a.Lock()
+	defer a.Unlock()
+	if a.file == nil {
+		return
+	}
+	a.file.Sync()
+	a.file.Close()
+	a.file = nil
+}
+
+// RecentDeletes returns the limit latest deletes recorded in the delete audit log, oldest first.
+func (dp *DataPartition) RecentDeletes(limit int) (records []*DeleteRecord, err error) {
+	if limit <= 0 {
+		limit = DefaultDeleteAuditLimit
+	}
+	a := &dp.deleteAudit
+	a.Lock()
+	defer a.Unlock()
+	records = make([]*DeleteRecord, 0)
+	for _, name := range []string{RotatedDeleteAuditFile, DeleteAuditFile} {
+		if records, err = readDeleteRecords(path.Join(dp.Path(), name), records); err != nil {
+			return
+		}
+	}
+	if len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	return
+}
+
+// Append the records in the file to the given ones. A missing file has no records, and the lines failed to
+// be parsed, such as the one cut by a crash, are skipped.
+func readDeleteRecords(filename string, records []*DeleteRecord) ([]*DeleteRecord, error) {
+	fp, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return records, err
+	}
+	defer fp.Close()
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		r := &DeleteRecord{}
+		if _, err = fmt.Sscanf(scanner.Text(), "%d %d %d %d %d %s", &r.Time, &r.ExtentID, &r.Inode, &r.Offset, &r.Size, &r.Op); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
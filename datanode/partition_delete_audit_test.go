@@ -0,0 +1,90 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestDeleteAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delete_audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.NewExtentStore(dir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	dp := newMockPartition(store)
+	dp.path = dir
+	dp.disk = &Disk{space: &SpaceManager{}}
+	dp.disk.space.SetDeleteAuditSize(400)
+	if err = store.Create(1025, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err = dp.markDelete(1025, 0, 0, DeleteOpClient); err != nil {
+		t.Fatal(err)
+	}
+	if ei, err := store.Watermark(1025); err != nil || !ei.IsDeleted {
+		t.Fatalf("extent(%v) not deleted, err(%v)", ei, err)
+	}
+	dp.markDelete(storage.TinyExtentStartID, 0, 4096, DeleteOpTinyRepair)
+	if err = dp.flushDeletes(); err != nil {
+		t.Fatal(err)
+	}
+	records, err := dp.RecentDeletes(0)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("records(%v) err(%v), expected 2", records, err)
+	}
+	if r := records[0]; r.ExtentID != 1025 || r.Inode != 7 || r.Op != DeleteOpClient || r.Time == 0 {
+		t.Fatalf("normal extent record(%+v)", r)
+	}
+	if r := records[1]; r.ExtentID != storage.TinyExtentStartID || r.Inode != 0 || r.Size != 4096 || r.Op != DeleteOpTinyRepair {
+		t.Fatalf("tiny extent record(%+v)", r)
+	}
+
+	// the log is bounded by the rotation, keeping the latest records
+	for i := uint64(0); i < 30; i++ {
+		dp.markDelete(2048+i, 0, 0, DeleteOpClientBatch)
+	}
+	if records, err = dp.RecentDeletes(1000); err != nil || len(records) >= 32 || len(records) == 0 {
+		t.Fatalf("rotated records(%v) err(%v)", len(records), err)
+	}
+	if last := records[len(records)-1]; last.ExtentID != 2048+29 {
+		t.Fatalf("latest record(%+v), expected extent %v", last, 2048+29)
+	}
+	for _, name := range []string{DeleteAuditFile, RotatedDeleteAuditFile} {
+		if info, err := os.Stat(path.Join(dir, name)); err != nil || info.Size() > 400 {
+			t.Fatalf("audit file(%v) info(%v) err(%v), expected within the size", name, info, err)
+		}
+	}
+	if records, err = dp.RecentDeletes(3); err != nil || len(records) != 3 {
+		t.Fatalf("limited records(%v) err(%v), expected 3", len(records), err)
+	}
+	dp.closeDeleteAudit()
+
+	dp.disk.space.SetDeleteAuditSize(0)
+	dp.markDelete(4096, 0, 0, DeleteOpClient)
+	if records, err = dp.RecentDeletes(1000); err != nil || records[len(records)-1].ExtentID == 4096 {
+		t.Fatalf("delete recorded with the audit disabled, err(%v)", err)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+// The partitions created for the volumes in volEncryption keep their extents sealed by the key of the volume,
+// and they are marked encrypted in the metadata, so a partition is loaded the way it was created whatever the
+// configuration is now. The pages are sealed below the crcs, which are computed over the plaintext, so the
+// replicas of a partition compare the same crcs, and the repair streams the plaintext read from the source
+// and sealed again by the target, whether the replicas are encrypted or not.
+const (
+	VolumeKeyFileSuffix = ".key" // the key of a volume in volumeKeyDir is the hex in the file VOLUME.key
+)
+
+var (
+	ErrNoVolumeKeySource = errors.New("no volume key source is installed")
+)
+
+// VolumeKeySource supplies the keys the extents of the encrypted volumes are sealed by, 16, 24 or 32 bytes for
+// AES-128, AES-192 or AES-256. It is asked every time a partition of an encrypted volume is created or loaded,
+// and a key it fails to supply keeps the partition from being served. A client of the KMS is installed by
+// DataNode.SetVolumeKeySource, otherwise the keys are read from the volumeKeyDir.
+type VolumeKeySource interface {
+	VolumeKey(volName string) (key []byte, err error)
+}
+
+// VolumeKeySourceFunc adapts a function to a VolumeKeySource.
+type VolumeKeySourceFunc func(volName string) (key []byte, err error)
+
+func (f VolumeKeySourceFunc) VolumeKey(volName string) (key []byte, err error) {
+	return f(volName)
+}
+
+// keyDirSource reads the keys of the volumes from the files in a directory, which is supposed to be readable by
+// the data node only.
+type keyDirSource string
+
+func (dir keyDirSource) VolumeKey(volName string) (key []byte, err error) {
+	if volName == "" || volName == "." || volName == ".." || strings.ContainsRune(volName, '/') {
+		return nil, fmt.Errorf("invalid volume name(%v) for a key file", volName)
+	}
+	var data []byte
+	if data, err = ioutil.ReadFile(path.Join(string(dir), volName+VolumeKeyFileSuffix)); err != nil {
+		return
+	}
+	if key, err = hex.DecodeString(strings.TrimSpace(string(data))); err != nil {
+		return nil, fmt.Errorf("key file of volume(%v) is not in hex: %v", volName, err)
+	}
+	return
+}
+
+// SetVolumeKeySource installs the source of the volume keys, such as a client of the KMS, which has to be called
+// before Start, since the partitions of the encrypted volumes are loaded by the start.
+func (s *DataNode) SetVolumeKeySource(source VolumeKeySource) {
+	s.volumeKeySource = source
+}
+
+func (manager *SpaceManager) SetEncryption(vols map[string]bool, source VolumeKeySource) {
+	manager.volEncryption = vols
+	manager.volumeKeySource = source
+}
+
+// IsVolumeEncrypted tells if the partitions created for the volume are encrypted.
+func (manager *SpaceManager) IsVolumeEncrypted(volName string) bool {
+	return manager.volEncryption[volName]
+}
+
+// Get the cipher of the extents of the volume from the key supplied by the source.
+func (manager *SpaceManager) volumeCipher(volName string) (c *storage.ExtentCipher, err error) {
+	if manager.volumeKeySource == nil {
+		return nil, ErrNoVolumeKeySource
+	}
+	var key []byte
+	if key, err = manager.volumeKeySource.VolumeKey(volName); err != nil {
+		return nil, fmt.Errorf("volume(%v) key: %v", volName, err)
+	}
+	if c, err = storage.NewExtentCipher(key); err != nil {
+		return nil, fmt.Errorf("volume(%v) key: %v", volName, err)
+	}
+	return
+}
+
+// Get the cipher the extent store of the partition to be opened is sealed by, nil if it is kept in plaintext.
+func extentCipherOf(dpCfg *dataPartitionCfg, disk *Disk) (c *storage.ExtentCipher, err error) {
+	if !dpCfg.Encrypted {
+		return nil, nil
+	}
+	if disk == nil || disk.space == nil {
+		return nil, ErrNoVolumeKeySource
+	}
+	return disk.space.volumeCipher(dpCfg.VolName)
+}
+
+// IsEncrypted tells if the extents of the partition are encrypted at rest.
+func (dp *DataPartition) IsEncrypted() bool {
+	return dp.config.Encrypted
+}
+
+// Parse the volumes whose new partitions are encrypted.
+func parseVolEncryption(values []interface{}) (vols map[string]bool, err error) {
+	vols = make(map[string]bool, len(values))
+	for _, value := range values {
+		vol, _ := value.(string)
+		if vol == "" {
+			return nil, fmt.Errorf("Err:%v invalid volume (%v)", ConfigKeyVolEncryption, value)
+		}
+		vols[vol] = true
+	}
+	return
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestVolumeKeySource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "volume_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := bytes.Repeat([]byte{7}, 32)
+	if err = ioutil.WriteFile(path.Join(dir, "vol"+VolumeKeyFileSuffix), []byte(fmt.Sprintf("%x\n", key)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path.Join(dir, "short"+VolumeKeyFileSuffix), []byte("0102"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	source := keyDirSource(dir)
+	if got, err := source.VolumeKey("vol"); err != nil || !bytes.Equal(got, key) {
+		t.Fatalf("key(%x) err(%v), expected(%x)", got, err, key)
+	}
+	for _, vol := range []string{"", "..", "../vol", "missing"} {
+		if _, err = source.VolumeKey(vol); err == nil {
+			t.Fatalf("key of volume(%v) supplied", vol)
+		}
+	}
+
+	space := &SpaceManager{}
+	space.SetEncryption(map[string]bool{"vol": true, "short": true}, source)
+	if !space.IsVolumeEncrypted("vol") || space.IsVolumeEncrypted("other") {
+		t.Fatal("encrypted volumes mismatch the configuration")
+	}
+	disk := &Disk{space: space}
+	if c, err := extentCipherOf(&dataPartitionCfg{VolName: "vol"}, disk); err != nil || c != nil {
+		t.Fatalf("plaintext partition cipher(%v) err(%v)", c, err)
+	}
+	c, err := extentCipherOf(&dataPartitionCfg{VolName: "vol", Encrypted: true}, disk)
+	if err != nil || c == nil {
+		t.Fatalf("encrypted partition cipher(%v) err(%v)", c, err)
+	}
+	if _, err = extentCipherOf(&dataPartitionCfg{VolName: "short", Encrypted: true}, disk); err == nil {
+		t.Fatal("cipher made of a short key")
+	}
+	if _, err = extentCipherOf(&dataPartitionCfg{VolName: "vol", Encrypted: true}, &Disk{space: &SpaceManager{}}); err != ErrNoVolumeKeySource {
+		t.Fatalf("cipher without a key source err(%v)", err)
+	}
+
+	// the store opened without its key fails to load by the kind of the unavailable key
+	storeDir := path.Join(dir, "datapartition_1_1024")
+	store, err := storage.NewEncryptedExtentStore(storeDir, 1, 1024, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	_, err = storage.NewExtentStore(storeDir, 1, 1024)
+	if kind := ExtentStoreLoadErrorKind(classifyExtentStoreError(storeDir, err)); kind != ErrExtentStoreKeyUnavailable {
+		t.Fatalf("store opened without the key failed by kind(%v) err(%v)", kind, err)
+	}
+
+	if _, err = parseVolEncryption([]interface{}{"vol", 1}); err == nil {
+		t.Fatal("invalid volume parsed")
+	}
+}
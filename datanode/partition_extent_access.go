@@ -0,0 +1,202 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	ExtentAccessFileName     = "EXTENT_ACCESS"
+	TempExtentAccessFileName = ".extent_access"
+
+	ExtentAccessBucket        = 60               // seconds the last access times of the extents are rounded down to
+	ExtentAccessFlushInterval = 10 * time.Minute // how often the changed access times are persisted
+)
+
+// extentAccess keeps the last time each normal extent of the partition is read by the clients, in buckets
+// of ExtentAccessBucket, so that a read only takes the write lock once per extent in a bucket. The times are
+// persisted periodically, so the reads in the latest interval are lost on a crash.
+type extentAccess struct {
+	sync.RWMutex
+	since int64            // when the tracking began, no extent is known cold before the window passes since then
+	times map[uint64]int64 // extent id -> bucket of the last read
+	dirty bool
+}
+
+type extentAccessFile struct {
+	Since int64            `json:"since"`
+	Times map[uint64]int64 `json:"times"`
+}
+
+// ColdExtent is a normal extent not read by the clients within the window.
+type ColdExtent struct {
+	ExtentID   uint64 `json:"extentID"`
+	Size       uint64 `json:"size"`
+	CreateTime int64  `json:"createTime"`
+	LastAccess int64  `json:"lastAccess"` // 0 if not read since the tracking began
+}
+
+// ColdExtents lists the normal extents of a partition not read within the window, the least recently read first.
+type ColdExtents struct {
+	OlderThan     int64         `json:"olderThan"`
+	TrackingSince int64         `json:"trackingSince"`
+	Extents       []*ColdExtent `json:"extents"`
+}
+
+// Load the access times of the extents persisted in the partition directory. The tracking begins now if none.
+func (dp *DataPartition) loadExtentAccess() (err error) {
+	a := &dp.extentAccess
+	a.Lock()
+	defer a.Unlock()
+	a.since = time.Now().Unix()
+	a.times = make(map[uint64]int64)
+	data, err := ioutil.ReadFile(path.Join(dp.Path(), ExtentAccessFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	f := &extentAccessFile{}
+	if err = json.Unmarshal(data, f); err != nil {
+		return
+	}
+	if f.Since > 0 {
+		a.since = f.Since
+	}
+	if f.Times != nil {
+		a.times = f.Times
+	}
+	return
+}
+
+// Record a read of the extent by the clients. The tiny extents are shared by the files, so they are not tracked.
+func (dp *DataPartition) recordExtentAccess(extentID uint64) {
+	if storage.IsTinyExtent(extentID) {
+		return
+	}
+	bucket := time.Now().Unix() / ExtentAccessBucket
+	a := &dp.extentAccess
+	a.RLock()
+	last, ok := a.times[extentID]
+	a.RUnlock()
+	if ok && last >= bucket {
+		return
+	}
+	a.Lock()
+	if a.times == nil {
+		a.times = make(map[uint64]int64)
+	}
+	if a.times[extentID] < bucket {
+		a.times[extentID] = bucket
+		a.dirty = true
+	}
+	a.Unlock()
+}
+
+// Persist the access times if any changed since the latest flush. The deleted extents are dropped at the same time.
+func (dp *DataPartition) flushExtentAccess() (err error) {
+	a := &dp.extentAccess
+	a.Lock()
+	if !a.dirty {
+		a.Unlock()
+		return
+	}
+	f := &extentAccessFile{Since: a.since, Times: make(map[uint64]int64, len(a.times))}
+	for extentID, bucket := range a.times {
+		f.Times[extentID] = bucket
+	}
+	a.dirty = false
+	a.Unlock()
+	// the extents deleted are dropped off the lock, not to hold the reads recording their access up
+	gone := make([]uint64, 0)
+	for extentID := range f.Times {
+		if !dp.extentStore.HasExtent(extentID) {
+			delete(f.Times, extentID)
+			gone = append(gone, extentID)
+		}
+	}
+	if len(gone) > 0 {
+		a.Lock()
+		for _, extentID := range gone {
+			delete(a.times, extentID)
+		}
+		a.Unlock()
+	}
+	data, err := json.Marshal(f)
+	if err == nil {
+		err = writeFileAtomically(dp.Path(), TempExtentAccessFileName, ExtentAccessFileName, data)
+	}
+	if err != nil {
+		a.Lock()
+		a.dirty = true
+		a.Unlock()
+		log.LogWarnf("action[flushExtentAccess] partition(%v) err(%v).", dp.partitionID, err)
+	}
+	return
+}
+
+// ColdExtents returns the normal extents not read by the clients within olderThan. An extent counts as accessed
+// on its creation and when the tracking began, so the extents are only reported cold once the window has passed
+// since both, instead of all of them being cold right after the tracking began.
+func (dp *DataPartition) ColdExtents(olderThan time.Duration) (cold *ColdExtents, err error) {
+	extents, _, err := dp.extentStore.GetAllWatermarks(func(ei *storage.ExtentInfo) bool {
+		return !storage.IsTinyExtent(ei.FileID) && !ei.IsDeleted
+	})
+	if err != nil {
+		return
+	}
+	a := &dp.extentAccess
+	a.RLock()
+	since := a.since
+	times := make(map[uint64]int64, len(extents))
+	for _, ei := range extents {
+		if bucket, ok := a.times[ei.FileID]; ok {
+			times[ei.FileID] = bucket * ExtentAccessBucket
+		}
+	}
+	a.RUnlock()
+	cutoff := time.Now().Unix() - int64(olderThan/time.Second)
+	cold = &ColdExtents{OlderThan: int64(olderThan / time.Second), TrackingSince: since, Extents: make([]*ColdExtent, 0)}
+	for _, ei := range extents {
+		lastAccess := times[ei.FileID]
+		if lastAccess >= cutoff || ei.CreateTime >= cutoff || since >= cutoff {
+			continue
+		}
+		cold.Extents = append(cold.Extents, &ColdExtent{
+			ExtentID:   ei.FileID,
+			Size:       ei.Size,
+			CreateTime: ei.CreateTime,
+			LastAccess: lastAccess,
+		})
+	}
+	sort.Slice(cold.Extents, func(i, j int) bool {
+		if cold.Extents[i].LastAccess != cold.Extents[j].LastAccess {
+			return cold.Extents[i].LastAccess < cold.Extents[j].LastAccess
+		}
+		return cold.Extents[i].ExtentID < cold.Extents[j].ExtentID
+	})
+	return
+}
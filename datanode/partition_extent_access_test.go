@@ -0,0 +1,80 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestColdExtents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cold_extents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now().Unix()
+	store := &expiringExtentStore{extents: map[uint64]*storage.ExtentInfo{
+		storage.TinyExtentStartID: {FileID: storage.TinyExtentStartID},
+		1025:                      {FileID: 1025, Size: 4096, CreateTime: now - 7200},
+		1026:                      {FileID: 1026, Size: 4096, CreateTime: now - 7200},
+		1027:                      {FileID: 1027, Size: 4096, CreateTime: now - 60},
+		1028:                      {FileID: 1028, Size: 4096, CreateTime: now - 7200},
+	}}
+	dp := newMockPartition(store)
+	dp.path = dir
+	if err = dp.loadExtentAccess(); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is cold before the window has passed since the tracking began
+	if cold, err := dp.ColdExtents(time.Hour); err != nil || len(cold.Extents) != 0 {
+		t.Fatalf("cold extents(%+v) err(%v) right after the tracking began", cold, err)
+	}
+	dp.extentAccess.since = now - 7200
+	dp.recordExtentAccess(storage.TinyExtentStartID)
+	dp.recordExtentAccess(1025)
+	dp.extentAccess.times[1028] = (now - 5400) / ExtentAccessBucket
+	cold, err := dp.ColdExtents(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cold.Extents) != 2 || cold.Extents[0].ExtentID != 1026 || cold.Extents[1].ExtentID != 1028 ||
+		cold.Extents[0].LastAccess != 0 || cold.Extents[1].LastAccess == 0 {
+		t.Fatalf("unexpected cold extents(%+v)", cold.Extents)
+	}
+	if _, tracked := dp.extentAccess.times[storage.TinyExtentStartID]; tracked {
+		t.Fatalf("the read of a tiny extent is tracked")
+	}
+
+	// the access times survive the reload, without the deleted extents
+	store.extents[1028].IsDeleted = true
+	if err = dp.flushExtentAccess(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := newMockPartition(store)
+	reloaded.path = dir
+	if err = reloaded.loadExtentAccess(); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.extentAccess.since != now-7200 || len(reloaded.extentAccess.times) != 1 ||
+		reloaded.extentAccess.times[1025] != dp.extentAccess.times[1025] {
+		t.Fatalf("unexpected reloaded access times(%v) since(%v)", reloaded.extentAccess.times, reloaded.extentAccess.since)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"os"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// SetExtentShards sets the shard count the normal extents of the new partitions are laid out by, and tells if
+// the partitions loaded in another layout are migrated to it, which keeps the flat ones flat if not.
+func (manager *SpaceManager) SetExtentShards(shards int, onLoad bool) {
+	manager.extentShards = shards
+	manager.shardExtentsOnLoad = onLoad
+}
+
+func (manager *SpaceManager) GetExtentShards() (shards int, onLoad bool) {
+	return manager.extentShards, manager.shardExtentsOnLoad
+}
+
+// Lay the extents under the partition directory out as configured before the extent store opens it. The
+// directory of a new partition does not exist yet and is created in the layout.
+func layoutPartitionExtents(dpCfg *dataPartitionCfg, dataPath string) (shards int, err error) {
+	if dpCfg.LayoutExtents {
+		var moved int
+		if moved, err = storage.MigrateExtentLayout(dataPath, dpCfg.ExtentShards); err != nil {
+			return
+		}
+		if moved > 0 {
+			log.LogInfof("action[layoutPartitionExtents] partition(%v) moved %v extents to the layout of %v shards.",
+				dpCfg.PartitionID, moved, dpCfg.ExtentShards)
+		}
+	}
+	return storage.ReadExtentLayout(dataPath)
+}
+
+// The path of the extent file by the layout of the partition.
+func (dp *DataPartition) extentFilePath(extentID uint64) string {
+	return storage.ExtentFilePath(dp.path, dp.extentShards, extentID)
+}
+
+// Walk the extent files of the partition in whatever layout.
+func (dp *DataPartition) walkExtentFiles(fn func(dir string, info os.FileInfo)) error {
+	return storage.WalkExtentDir(dp.path, fn)
+}
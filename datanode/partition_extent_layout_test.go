@@ -0,0 +1,80 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestLayoutPartitionExtents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.NewExtentStore(dir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for extentID := uint64(1025); extentID <= 1034; extentID++ {
+		if err = store.Create(extentID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	// kept flat unless configured
+	dpCfg := &dataPartitionCfg{PartitionID: 1, ExtentShards: 4}
+	if shards, err := layoutPartitionExtents(dpCfg, dir); err != nil || shards != 0 {
+		t.Fatalf("unconfigured layout shards(%v) err(%v), expected flat", shards, err)
+	}
+	dpCfg.LayoutExtents = true
+	if shards, err := layoutPartitionExtents(dpCfg, dir); err != nil || shards != 4 {
+		t.Fatalf("layout shards(%v) err(%v), expected 4", shards, err)
+	}
+	if store, err = storage.NewExtentStore(dir, 1, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	dp := newMockPartition(store)
+	dp.path, dp.extentShards, dp.disk = dir, 4, &Disk{}
+	for extentID := uint64(1025); extentID <= 1034; extentID++ {
+		if _, err = os.Stat(dp.extentFilePath(extentID)); err != nil {
+			t.Fatalf("extent(%v) not in its shard: %v", extentID, err)
+		}
+		if path.Dir(dp.extentFilePath(extentID)) == dir {
+			t.Fatalf("extent(%v) left in the partition directory", extentID)
+		}
+	}
+	top, err := dp.ListExtentsBySize(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.ExtentCount != 10+storage.TinyExtentCount {
+		t.Fatalf("listed extents(%v), expected %v", top.ExtentCount, 10+storage.TinyExtentCount)
+	}
+	report, err := dp.FragmentationReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NormalExtentCount != 10 || report.TinyExtentCount != storage.TinyExtentCount {
+		t.Fatalf("fragmentation report normal(%v) tiny(%v) unexpected", report.NormalExtentCount, report.TinyExtentCount)
+	}
+}
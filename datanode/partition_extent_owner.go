@@ -0,0 +1,59 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+// MaxExtentOwnersLookup is the most extents looked up at once.
+const MaxExtentOwnersLookup = 1024
+
+// ExtentOwner is the inode an extent of the partition is created for. The inode is 0 for a tiny extent, which
+// is shared by many files, and for an extent created before the data node recorded the inodes.
+type ExtentOwner struct {
+	ExtentID uint64 `json:"extentID"`
+	Exists   bool   `json:"exists"`
+	IsTiny   bool   `json:"isTiny"`
+	Inode    uint64 `json:"inode"`
+	Size     uint64 `json:"size"`
+}
+
+// ExtentOwners maps the extents of a partition back to the volume and the inodes they belong to.
+type ExtentOwners struct {
+	PartitionID uint64         `json:"partitionID"`
+	VolName     string         `json:"volName"`
+	Extents     []*ExtentOwner `json:"extents"`
+}
+
+// LookupExtentOwners returns the volume of the partition and the inode of each of the extents, in the order
+// of the ids given. An extent not in the store is returned as not existing rather than failing the others.
+func (dp *DataPartition) LookupExtentOwners(extentIDs []uint64) *ExtentOwners {
+	owners := &ExtentOwners{
+		PartitionID: dp.partitionID,
+		VolName:     dp.volumeID,
+		Extents:     make([]*ExtentOwner, 0, len(extentIDs)),
+	}
+	for _, extentID := range extentIDs {
+		owner := &ExtentOwner{ExtentID: extentID, IsTiny: storage.IsTinyExtent(extentID)}
+		if ei, err := dp.extentStore.Watermark(extentID); err == nil && !ei.IsDeleted {
+			owner.Exists = true
+			owner.Inode = ei.Inode
+			owner.Size = ei.Size
+		}
+		owners.Extents = append(owners.Extents, owner)
+	}
+	return owners
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestLookupExtentOwners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_owners")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.NewExtentStore(dir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	dp := newMockPartition(store)
+	dp.volumeID = "vol"
+	if err = store.Create(1025, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Create(1026, 0); err != nil {
+		t.Fatal(err)
+	}
+	owners := dp.LookupExtentOwners([]uint64{1026, storage.TinyExtentStartID, 1025, 2048})
+	if owners.VolName != "vol" || owners.PartitionID != 1 || len(owners.Extents) != 4 {
+		t.Fatalf("owners(%+v), expected 4 extents of partition 1 of vol", owners)
+	}
+	expects := []ExtentOwner{
+		{ExtentID: 1026, Exists: true},
+		{ExtentID: storage.TinyExtentStartID, Exists: true, IsTiny: true},
+		{ExtentID: 1025, Exists: true, Inode: 7},
+		{ExtentID: 2048},
+	}
+	for i, expect := range expects {
+		if *owners.Extents[i] != expect {
+			t.Errorf("extent %v owner(%+v), expected(%+v)", i, owners.Extents[i], expect)
+		}
+	}
+}
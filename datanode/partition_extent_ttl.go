@@ -0,0 +1,196 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	ExtentExpiryInterval = time.Minute // how often the leader looks for the expired extents
+	MaxExpiredExtents    = 1024        // extents deleted by one round of the expiry at most
+)
+
+// extentExpiry counts the extents expired by the TTL since the partition is loaded.
+type extentExpiry struct {
+	sync.Mutex
+	expired  uint64
+	failed   uint64 // rounds failed to delete the expired extents on all the replicas
+	lastTime int64  // when the latest round deleted any extent
+}
+
+// ExtentExpiryStats describes the TTL of the extents of a partition and the extents expired by it.
+type ExtentExpiryStats struct {
+	TTL          int64  `json:"ttl"`          // seconds in effect, 0 if the expiry is disabled
+	PartitionTTL int64  `json:"partitionTTL"` // seconds set for the partition, 0 if it follows the volume
+	Expired      uint64 `json:"expired"`
+	Failed       uint64 `json:"failed"`
+	LastTime     int64  `json:"lastTime"`
+}
+
+// ExtentTTL returns the seconds after their creation the normal extents of the partition expire, which is the
+// one set for the partition, or the one configured for its volume or for the node. 0 disables the expiry.
+func (dp *DataPartition) ExtentTTL() int64 {
+	if dp.extentTTL > 0 {
+		return dp.extentTTL
+	}
+	if dp.disk == nil || dp.disk.space == nil {
+		return 0
+	}
+	return dp.disk.space.GetExtentTTL(dp.volumeID)
+}
+
+// SetExtentTTL sets the TTL of the extents of the partition and persists it, 0 makes it follow the volume.
+func (dp *DataPartition) SetExtentTTL(ttl int64) (err error) {
+	if ttl < 0 {
+		return fmt.Errorf("extent ttl(%v) must not be negative", ttl)
+	}
+	old := dp.extentTTL
+	dp.extentTTL = ttl
+	if err = dp.PersistMetadata(); err != nil {
+		dp.extentTTL = old
+		log.LogErrorf("action[SetExtentTTL] partition(%v) persist metadata err(%v).", dp.partitionID, err)
+		return
+	}
+	log.LogInfof("action[SetExtentTTL] partition(%v) extent ttl from (%v) to (%v).", dp.partitionID, old, ttl)
+	return
+}
+
+// GetExtentExpiryStats returns the TTL of the extents of the partition and the counts of the expired ones.
+func (dp *DataPartition) GetExtentExpiryStats() *ExtentExpiryStats {
+	e := &dp.extentExpiry
+	e.Lock()
+	defer e.Unlock()
+	return &ExtentExpiryStats{
+		TTL:          dp.ExtentTTL(),
+		PartitionTTL: dp.extentTTL,
+		Expired:      e.expired,
+		Failed:       e.failed,
+		LastTime:     e.lastTime,
+	}
+}
+
+// ExpireExtents deletes the normal extents created longer than the TTL ago, on the leader only. The tiny
+// extents are shared by the files, so they never expire. The extents are deleted on the followers first, and
+// on the leader only after all the followers replied none failed, as the repair recreates on the leader the
+// extents left on any follower. The deletes are flushed at last, so that the expired extents are not found again on a restart.
+// The creation times are the local ones of the leader, an extent repaired to a new leader expires later.
+func (dp *DataPartition) ExpireExtents() (expired int, err error) {
+	ttl := dp.ExtentTTL()
+	if ttl <= 0 || !dp.isRepairLeader() {
+		return
+	}
+	now := time.Now().Unix()
+	extents, _, err := dp.extentStore.GetAllWatermarks(func(ei *storage.ExtentInfo) bool {
+		return !storage.IsTinyExtent(ei.FileID) && !ei.IsDeleted && ei.CreateTime > 0 && now-ei.CreateTime > ttl
+	})
+	if err != nil || len(extents) == 0 {
+		return
+	}
+	sort.Slice(extents, func(i, j int) bool { return extents[i].CreateTime < extents[j].CreateTime })
+	if len(extents) > MaxExpiredExtents {
+		extents = extents[:MaxExpiredExtents]
+	}
+	exts := make([]*proto.ExtentKey, 0, len(extents))
+	for _, ei := range extents {
+		exts = append(exts, &proto.ExtentKey{PartitionId: dp.partitionID, ExtentId: ei.FileID})
+	}
+	defer func() {
+		dp.recordExtentExpiry(expired, err)
+	}()
+	replicas := dp.Replicas()
+	for i := 1; i < len(replicas); i++ {
+		if err = dp.deleteExtentsOnReplica(replicas[i], exts); err != nil {
+			err = fmt.Errorf("delete expired extents on replica(%v): %v", replicas[i], err)
+			return
+		}
+	}
+	for _, ext := range exts {
+		if err = dp.markDelete(ext.ExtentId, 0, 0, DeleteOpExpiry); err != nil {
+			err = fmt.Errorf("delete expired extent(%v): %v", ext.ExtentId, err)
+			return
+		}
+		expired++
+	}
+	if err = dp.flushDeletes(); err != nil {
+		return
+	}
+	dp.logEvent(EventExtentExpiry, "expired(%v) extents created longer than ttl(%v) ago", expired, ttl)
+	log.LogInfof("action[ExpireExtents] partition(%v) expired(%v) extents by ttl(%v).", dp.partitionID, expired, ttl)
+	return
+}
+
+func (dp *DataPartition) recordExtentExpiry(expired int, err error) {
+	e := &dp.extentExpiry
+	e.Lock()
+	defer e.Unlock()
+	e.expired += uint64(expired)
+	if expired > 0 {
+		e.lastTime = time.Now().Unix()
+	}
+	if err != nil {
+		e.failed++
+		log.LogWarnf("action[ExpireExtents] partition(%v) expired(%v) err(%v).", dp.partitionID, expired, err)
+	}
+}
+
+// Delete the extents on the replica of the given address only, the packet is not forwarded by the replica.
+func (dp *DataPartition) deleteExtentsOnReplica(target string, exts []*proto.ExtentKey) (err error) {
+	var conn *net.TCPConn
+	if conn, err = gConnPool.GetConnect(target); err != nil {
+		return
+	}
+	defer gConnPool.PutConnect(conn, true)
+	p := repl.NewPacketToBatchDeleteExtent(dp.partitionID, exts)
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	if err = p.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		return
+	}
+	if p.ResultCode != proto.OpOk {
+		err = fmt.Errorf("%v", p.GetResultMsg())
+	}
+	return
+}
+
+// Parse the TTL of the extents of the volumes in the format VOLUME:SECONDS.
+func parseVolExtentTTL(values []interface{}) (ttls map[string]int64, err error) {
+	ttls = make(map[string]int64, len(values))
+	for _, value := range values {
+		str, _ := value.(string)
+		arr := strings.Split(str, ":")
+		if len(arr) != 2 || arr[0] == "" {
+			return nil, fmt.Errorf("Err:%v invalid (%v), expected VOLUME:SECONDS", ConfigKeyVolExtentTTL, value)
+		}
+		ttl, parseErr := strconv.ParseInt(arr[1], 10, 64)
+		if parseErr != nil || ttl <= 0 {
+			return nil, fmt.Errorf("Err:%v of volume(%v) must be a positive integer", ConfigKeyVolExtentTTL, arr[0])
+		}
+		ttls[arr[0]] = ttl
+	}
+	return
+}
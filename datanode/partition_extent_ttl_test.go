@@ -0,0 +1,95 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+// expiringExtentStore keeps the extent infos for the expiry, and records the deletes and the flushes.
+type expiringExtentStore struct {
+	ExtentStorer
+	extents map[uint64]*storage.ExtentInfo
+	deleted []uint64
+	flushed int
+}
+
+func (s *expiringExtentStore) GetAllWatermarks(filter storage.ExtentFilter) (extents []*storage.ExtentInfo, tinyDeleteFileSize int64, err error) {
+	for _, ei := range s.extents {
+		if filter(ei) {
+			extents = append(extents, ei)
+		}
+	}
+	return
+}
+
+func (s *expiringExtentStore) MarkDelete(extentID uint64, offset, size int64) (err error) {
+	s.extents[extentID].IsDeleted = true
+	s.deleted = append(s.deleted, extentID)
+	return
+}
+
+func (s *expiringExtentStore) FlushDelete() (err error) {
+	s.flushed++
+	return
+}
+
+func TestExpireExtents(t *testing.T) {
+	now := time.Now().Unix()
+	store := &expiringExtentStore{extents: map[uint64]*storage.ExtentInfo{
+		storage.TinyExtentStartID: {FileID: storage.TinyExtentStartID},
+		1025:                      {FileID: 1025, CreateTime: now - 7200},
+		1026:                      {FileID: 1026, CreateTime: now - 60},
+		1027:                      {FileID: 1027, CreateTime: now - 7200, IsDeleted: true},
+	}}
+	dp := newMockPartition(store)
+	dp.volumeID = "tmp"
+	dp.replicas = []string{"127.0.0.1:17310"}
+	dp.disk = &Disk{space: &SpaceManager{volExtentTTL: map[string]int64{"tmp": 3600}}}
+
+	if expired, err := dp.ExpireExtents(); expired != 0 || err != nil {
+		t.Fatalf("follower expired(%v) err(%v)", expired, err)
+	}
+	dp.isLeader = true
+	expired, err := dp.ExpireExtents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 1 || len(store.deleted) != 1 || store.deleted[0] != 1025 || store.flushed != 1 {
+		t.Fatalf("expired(%v) deleted(%v) flushed(%v), expected extent 1025 flushed", expired, store.deleted, store.flushed)
+	}
+	if stats := dp.GetExtentExpiryStats(); stats.TTL != 3600 || stats.Expired != 1 || stats.LastTime == 0 {
+		t.Fatalf("unexpected expiry stats(%+v)", stats)
+	}
+
+	// the ttl of the partition overrides the one of the volume
+	dp.extentTTL = 30
+	if expired, err = dp.ExpireExtents(); expired != 1 || store.deleted[1] != 1026 {
+		t.Fatalf("expired(%v) deleted(%v) err(%v) by the ttl of the partition", expired, store.deleted, err)
+	}
+	dp.extentTTL = 0
+	dp.volumeID = "vol"
+	if dp.ExtentTTL() != 0 {
+		t.Fatalf("extent ttl(%v) of a volume not configured", dp.ExtentTTL())
+	}
+}
+
+func (s *expiringExtentStore) HasExtent(extentID uint64) (exist bool) {
+	ei, exist := s.extents[extentID]
+	return exist && !ei.IsDeleted
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The fsync policy decides when the writes to the extents of a partition reach the disk, which trades the
+// durability on a power loss of the node for the throughput:
+//
+//   - always: every write is synced before it is acknowledged, so an acknowledged write survives a power
+//     loss, at the cost of waiting for the disk on every write.
+//   - interval: the extents written are synced together every fsync interval, so the writes to an extent
+//     within the interval share one sync. The writes acknowledged within the latest interval may be lost on
+//     a power loss and have to be repaired from the other replicas.
+//   - os: the writes are left to the page cache of the os, which is the fastest and the least durable.
+//
+// The writes the clients ask to sync by the sync opcodes are synced before the reply by any policy.
+const (
+	FsyncPolicyOS       = "os"
+	FsyncPolicyAlways   = "always"
+	FsyncPolicyInterval = "interval"
+
+	DefaultFsyncInterval = time.Second
+)
+
+// FsyncStats describes the fsync policy of a partition and the syncs of the extents by the interval.
+type FsyncStats struct {
+	Policy   string `json:"policy"`
+	Interval int64  `json:"interval"` // ms between the syncs of the extents written by the interval policy
+	Pending  int    `json:"pending"`  // extents written since the latest sync
+	Synced   uint64 `json:"synced"`
+	Failed   uint64 `json:"failed"`
+	LastTime int64  `json:"lastTime"` // when the latest sync synced any extent
+}
+
+// extentFsync keeps the extents written but not synced yet by the interval policy.
+type extentFsync struct {
+	sync.Mutex
+	dirty    map[uint64]bool
+	synced   uint64
+	failed   uint64
+	lastTime int64
+}
+
+func isValidFsyncPolicy(policy string) bool {
+	return policy == FsyncPolicyOS || policy == FsyncPolicyAlways || policy == FsyncPolicyInterval
+}
+
+// Parse the fsync policy of the volumes in the format VOLUME:POLICY.
+func parseVolFsyncPolicy(values []interface{}) (policies map[string]string, err error) {
+	policies = make(map[string]string, len(values))
+	for _, value := range values {
+		str, _ := value.(string)
+		arr := strings.Split(str, ":")
+		if len(arr) != 2 || arr[0] == "" {
+			return nil, fmt.Errorf("Err:%v invalid (%v), expected VOLUME:POLICY", ConfigKeyVolFsyncPolicy, value)
+		}
+		if !isValidFsyncPolicy(arr[1]) {
+			return nil, fmt.Errorf("Err:%v of volume(%v) must be one of %v, %v and %v", ConfigKeyVolFsyncPolicy,
+				arr[0], FsyncPolicyOS, FsyncPolicyAlways, FsyncPolicyInterval)
+		}
+		policies[arr[0]] = arr[1]
+	}
+	return
+}
+
+func (manager *SpaceManager) SetFsyncPolicy(policy string, volPolicies map[string]string, interval time.Duration) {
+	manager.fsyncPolicy = policy
+	manager.volFsyncPolicy = volPolicies
+	manager.fsyncInterval = interval
+}
+
+// GetFsyncPolicy returns the fsync policy of the volume, which is the one configured for the volume or for the node.
+func (manager *SpaceManager) GetFsyncPolicy(volName string) string {
+	if policy, ok := manager.volFsyncPolicy[volName]; ok {
+		return policy
+	}
+	if manager.fsyncPolicy == "" {
+		return FsyncPolicyOS
+	}
+	return manager.fsyncPolicy
+}
+
+// GetFsyncInterval returns how often the extents written by the interval policy are synced.
+func (manager *SpaceManager) GetFsyncInterval() time.Duration {
+	if manager.fsyncInterval <= 0 {
+		return DefaultFsyncInterval
+	}
+	return manager.fsyncInterval
+}
+
+// FsyncPolicy returns the fsync policy of the partition by its volume.
+func (dp *DataPartition) FsyncPolicy() string {
+	if dp.disk == nil || dp.disk.space == nil {
+		return FsyncPolicyOS
+	}
+	return dp.disk.space.GetFsyncPolicy(dp.volumeID)
+}
+
+func (dp *DataPartition) fsyncInterval() time.Duration {
+	if dp.disk == nil || dp.disk.space == nil {
+		return DefaultFsyncInterval
+	}
+	return dp.disk.space.GetFsyncInterval()
+}
+
+// Tell if a write is synced before the reply by the fsync policy of the partition, requested is if the
+// client asks to sync it.
+func (dp *DataPartition) syncOnWrite(requested bool) bool {
+	return requested || dp.FsyncPolicy() == FsyncPolicyAlways
+}
+
+// Keep the extent written without a sync to be synced by the interval policy. It is called after the write,
+// so that a sync running in the middle of the write does not leave the write unsynced.
+func (dp *DataPartition) recordWrite(extentID uint64, synced bool) {
+	if synced || dp.FsyncPolicy() != FsyncPolicyInterval {
+		return
+	}
+	f := &dp.extentFsync
+	f.Lock()
+	if f.dirty == nil {
+		f.dirty = make(map[uint64]bool)
+	}
+	f.dirty[extentID] = true
+	f.Unlock()
+}
+
+// Sync the extents written since the latest sync by the interval policy. The extents failed to be synced are
+// kept to be synced again by the next round.
+func (dp *DataPartition) syncDirtyExtents() (synced int, err error) {
+	f := &dp.extentFsync
+	f.Lock()
+	dirty := f.dirty
+	f.dirty = nil
+	f.Unlock()
+	if len(dirty) == 0 {
+		return
+	}
+	failed := make([]uint64, 0)
+	for extentID := range dirty {
+		if syncErr := dp.extentStore.SyncExtent(extentID); syncErr != nil {
+			dp.checkIsDiskError(syncErr)
+			failed = append(failed, extentID)
+			err = syncErr
+			continue
+		}
+		synced++
+	}
+	f.Lock()
+	f.synced += uint64(synced)
+	f.failed += uint64(len(failed))
+	if synced > 0 {
+		f.lastTime = time.Now().Unix()
+	}
+	if len(failed) > 0 && f.dirty == nil {
+		f.dirty = make(map[uint64]bool)
+	}
+	for _, extentID := range failed {
+		f.dirty[extentID] = true
+	}
+	f.Unlock()
+	if err != nil {
+		log.LogWarnf("action[syncDirtyExtents] partition(%v) synced(%v) failed(%v) err(%v).",
+			dp.partitionID, synced, len(failed), err)
+	}
+	return
+}
+
+// GetFsyncStats returns the fsync policy of the partition and the syncs of the extents by the interval.
+func (dp *DataPartition) GetFsyncStats() *FsyncStats {
+	f := &dp.extentFsync
+	f.Lock()
+	defer f.Unlock()
+	return &FsyncStats{
+		Policy:   dp.FsyncPolicy(),
+		Interval: int64(dp.fsyncInterval() / time.Millisecond),
+		Pending:  len(f.dirty),
+		Synced:   f.synced,
+		Failed:   f.failed,
+		LastTime: f.lastTime,
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// syncingExtentStore records the extents synced, and fails to sync the extents in failing.
+type syncingExtentStore struct {
+	mockExtentStore
+	synced  []uint64
+	failing map[uint64]bool
+}
+
+func (s *syncingExtentStore) SyncExtent(extentID uint64) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.failing[extentID] {
+		return errors.New("sync failed")
+	}
+	s.synced = append(s.synced, extentID)
+	return
+}
+
+func TestFsyncPolicy(t *testing.T) {
+	if _, err := parseVolFsyncPolicy([]interface{}{"vol1:always", "vol2:interval"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []interface{}{"vol1", ":always", "vol1:never", 1} {
+		if _, err := parseVolFsyncPolicy([]interface{}{value}); err == nil {
+			t.Errorf("parseVolFsyncPolicy(%v) expect an error", value)
+		}
+	}
+
+	store := &syncingExtentStore{failing: map[uint64]bool{1026: true}}
+	dp := newMockPartition(store)
+	dp.volumeID = "vol1"
+	if dp.FsyncPolicy() != FsyncPolicyOS || dp.syncOnWrite(false) || !dp.syncOnWrite(true) {
+		t.Fatalf("the os policy is not the default or does not honor the sync requested")
+	}
+	space := &SpaceManager{}
+	dp.disk = &Disk{space: space}
+	space.SetFsyncPolicy(FsyncPolicyOS, map[string]string{"vol1": FsyncPolicyAlways}, time.Second)
+	if dp.FsyncPolicy() != FsyncPolicyAlways || !dp.syncOnWrite(false) {
+		t.Fatalf("policy(%v) of the volume does not override the one of the node", dp.FsyncPolicy())
+	}
+	dp.recordWrite(1025, dp.syncOnWrite(false))
+	if stats := dp.GetFsyncStats(); stats.Pending != 0 {
+		t.Fatalf("write synced by the always policy is pending(%v)", stats.Pending)
+	}
+
+	space.SetFsyncPolicy(FsyncPolicyInterval, nil, 0)
+	for _, extentID := range []uint64{1025, 1025, 1026, 1027} {
+		dp.recordWrite(extentID, dp.syncOnWrite(false))
+	}
+	dp.recordWrite(1028, dp.syncOnWrite(true))
+	if stats := dp.GetFsyncStats(); stats.Pending != 3 || stats.Interval != int64(DefaultFsyncInterval/time.Millisecond) {
+		t.Fatalf("unexpected stats(%+v) before the sync", stats)
+	}
+	synced, err := dp.syncDirtyExtents()
+	if synced != 2 || err == nil || len(store.synced) != 2 {
+		t.Fatalf("synced(%v) extents(%v) err(%v), expect 1025 and 1027 synced and 1026 failed", synced, store.synced, err)
+	}
+	if stats := dp.GetFsyncStats(); stats.Pending != 1 || stats.Synced != 2 || stats.Failed != 1 || stats.LastTime == 0 {
+		t.Fatalf("unexpected stats(%+v) after the sync", stats)
+	}
+
+	// the failed extent is synced again by the next round
+	delete(store.failing, 1026)
+	if synced, err = dp.syncDirtyExtents(); synced != 1 || err != nil || store.synced[2] != 1026 {
+		t.Fatalf("synced(%v) extents(%v) err(%v) by the retry", synced, store.synced, err)
+	}
+	if synced, err = dp.syncDirtyExtents(); synced != 0 || err != nil {
+		t.Fatalf("synced(%v) err(%v) without any write", synced, err)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// FullNotifyInterval is the min interval between two notifications of the full partitions to the master.
+const FullNotifyInterval = 5 * time.Second
+
+// fullPartition is a partition turned read-only by the fullness, waiting to be reported to the master.
+type fullPartition struct {
+	partitionID uint64
+	volName     string
+	used        uint64
+	size        uint64
+}
+
+// fullNotifier reports the partitions turned read-only by the fullness to the master at once, instead of
+// leaving the master to learn it from the next heartbeat it polls, so the master redirects the writes and the
+// rebalancing begins sooner. The notification is best effort: the partitions are queued without blocking the
+// status update, and the ones queued within FullNotifyInterval are sent together.
+type fullNotifier struct {
+	sync.Mutex
+	pending map[uint64]*fullPartition
+	notifyC chan struct{}
+}
+
+func (n *fullNotifier) init() {
+	n.notifyC = make(chan struct{}, 1)
+}
+
+func (n *fullNotifier) add(fp *fullPartition) {
+	n.Lock()
+	if n.pending == nil {
+		n.pending = make(map[uint64]*fullPartition)
+	}
+	n.pending[fp.partitionID] = fp
+	n.Unlock()
+	select {
+	case n.notifyC <- struct{}{}:
+	default:
+	}
+}
+
+func (n *fullNotifier) take() (pending map[uint64]*fullPartition) {
+	n.Lock()
+	pending = n.pending
+	n.pending = nil
+	n.Unlock()
+	return
+}
+
+// Queue the partition to be reported to the master as full. It is called by the status update when the
+// partition turns read-only by the fullness.
+func (dp *DataPartition) notifyFull() {
+	if dp.disk == nil || dp.disk.space == nil || dp.disk.space.fullNotifier.notifyC == nil {
+		return
+	}
+	dp.disk.space.fullNotifier.add(&fullPartition{
+		partitionID: dp.partitionID,
+		volName:     dp.volumeID,
+		used:        uint64(dp.used),
+		size:        uint64(dp.Size()),
+	})
+}
+
+// Report the full partitions to the master as they are queued. They are reported by a heartbeat sent without
+// waiting for the master, which carries the reports of all the partitions of the node with the status, the used
+// and the size of the full ones, since the master replaces the reports of the node by the ones of a heartbeat.
+func (manager *SpaceManager) fullNotifyScheduler() {
+	n := &manager.fullNotifier
+	for {
+		select {
+		case <-n.notifyC:
+		case <-manager.stopC:
+			return
+		}
+		if pending := n.take(); len(pending) > 0 {
+			manager.sendFullNotification(pending)
+		}
+		select {
+		case <-time.After(FullNotifyInterval):
+		case <-manager.stopC:
+			return
+		}
+	}
+}
+
+func (manager *SpaceManager) sendFullNotification(pending map[uint64]*fullPartition) {
+	if manager.dataNode == nil || manager.dataNode.localServerAddr == "" {
+		return
+	}
+	response := &proto.DataNodeHeartbeatResponse{}
+	manager.dataNode.buildHeartBeatResponse(response)
+	task := proto.NewAdminTask(proto.OpDataNodeHeartbeat, manager.dataNode.localServerAddr, &proto.HeartBeatRequest{})
+	task.Response = response
+	if err := MasterClient.NodeAPI().ResponseDataNodeTask(task); err != nil {
+		log.LogWarnf("action[sendFullNotification] notify the master of %v full partitions err(%v), left to the next heartbeat.",
+			len(pending), err)
+		return
+	}
+	for _, fp := range pending {
+		log.LogInfof("action[sendFullNotification] notified the master of partition(%v) volume(%v) full, used(%v) size(%v).",
+			fp.partitionID, fp.volName, fp.used, fp.size)
+	}
+}
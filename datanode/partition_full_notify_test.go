@@ -0,0 +1,56 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+)
+
+func TestFullNotifier(t *testing.T) {
+	space := &SpaceManager{}
+	dp := newMockPartition(newMockExtentStore(nil))
+	dp.disk = &Disk{space: space}
+	dp.volumeID, dp.used, dp.partitionSize = "vol", 200, 100
+	// not started
+	dp.notifyFull()
+	if pending := space.fullNotifier.take(); len(pending) != 0 {
+		t.Fatalf("full partitions(%v) queued without the notifier", len(pending))
+	}
+
+	space.fullNotifier.init()
+	dp.notifyFull()
+	dp.used = 300
+	dp.notifyFull()
+	other := newMockPartition(newMockExtentStore(nil))
+	other.partitionID, other.disk = 2, dp.disk
+	other.notifyFull()
+	select {
+	case <-space.fullNotifier.notifyC:
+	default:
+		t.Fatalf("full partitions queued without the notification")
+	}
+	select {
+	case <-space.fullNotifier.notifyC:
+		t.Fatalf("notifications of the full partitions not merged")
+	default:
+	}
+	pending := space.fullNotifier.take()
+	if len(pending) != 2 || pending[1].used != 300 || pending[1].size != 100 || pending[1].volName != "vol" {
+		t.Fatalf("unexpected full partitions(%v)", pending)
+	}
+	if pending = space.fullNotifier.take(); len(pending) != 0 {
+		t.Fatalf("full partitions(%v) taken twice", len(pending))
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	usageSampleInterval = time.Minute
+	usageSampleCount    = 30 // the growth rate is computed over the latest half an hour
+
+	// TimeToFullUnknown is returned by EstimateTimeToFull when the partition is not growing.
+	TimeToFullUnknown time.Duration = -1
+)
+
+// PartitionGrowth describes how fast a partition grows, and when it will be full at that rate.
+type PartitionGrowth struct {
+	ID         uint64  `json:"id"`
+	VolName    string  `json:"volName"`
+	Used       int     `json:"used"`
+	Size       int     `json:"size"`
+	Rate       float64 `json:"rate"`       // bytes per second
+	TimeToFull int64   `json:"timeToFull"` // seconds, -1 if the partition is not growing
+}
+
+type usageSample struct {
+	time int64 // unix seconds
+	used int
+}
+
+// usageHistory keeps the latest used sizes sampled by the status update.
+type usageHistory struct {
+	sync.Mutex
+	samples []usageSample
+}
+
+// Add a sample of the used size, the samples closer than usageSampleInterval to the last one are dropped.
+func (h *usageHistory) record(used int, now time.Time) {
+	h.Lock()
+	defer h.Unlock()
+	if n := len(h.samples); n > 0 && now.Unix()-h.samples[n-1].time < int64(usageSampleInterval/time.Second) {
+		return
+	}
+	h.samples = append(h.samples, usageSample{time: now.Unix(), used: used})
+	if len(h.samples) > usageSampleCount {
+		h.samples = h.samples[len(h.samples)-usageSampleCount:]
+	}
+}
+
+// Compute the growth rate in bytes per second by the least squares fit of the samples.
+func (h *usageHistory) rate() (rate float64, ok bool) {
+	h.Lock()
+	defer h.Unlock()
+	n := float64(len(h.samples))
+	if n < 2 {
+		return
+	}
+	base := h.samples[0].time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range h.samples {
+		x, y := float64(sample.time-base), float64(sample.used)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return
+	}
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
+
+// EstimateTimeToFull projects when the used space reaches the size of the partition, at the growth rate
+// of the latest samples. TimeToFullUnknown is returned if the partition is not growing.
+func (dp *DataPartition) EstimateTimeToFull() time.Duration {
+	rate, ok := dp.usageHistory.rate()
+	if !ok || rate <= 0 {
+		return TimeToFullUnknown
+	}
+	remaining := dp.Size() - dp.used
+	if remaining <= 0 {
+		return 0
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second))
+}
+
+// GetGrowth returns the growth rate of the partition and its time to full.
+func (dp *DataPartition) GetGrowth() (growth *PartitionGrowth) {
+	growth = &PartitionGrowth{
+		ID:         dp.partitionID,
+		VolName:    dp.volumeID,
+		Used:       dp.Used(),
+		Size:       dp.Size(),
+		TimeToFull: -1,
+	}
+	growth.Rate, _ = dp.usageHistory.rate()
+	if timeToFull := dp.EstimateTimeToFull(); timeToFull != TimeToFullUnknown {
+		growth.TimeToFull = int64(timeToFull / time.Second)
+	}
+	return
+}
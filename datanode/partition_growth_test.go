@@ -0,0 +1,47 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateTimeToFull(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	dp.partitionSize = 10000
+	if eta := dp.EstimateTimeToFull(); eta != TimeToFullUnknown {
+		t.Fatalf("time to full without samples: %v", eta)
+	}
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		dp.usageHistory.record(1000+i*60, now.Add(time.Duration(i)*usageSampleInterval))
+		// dropped since it is too close to the last sample
+		dp.usageHistory.record(0, now.Add(time.Duration(i)*usageSampleInterval+time.Second))
+	}
+	dp.used = 1240
+	// one byte per second, 8760 bytes to go
+	if eta := dp.EstimateTimeToFull(); eta < 8759*time.Second || eta > 8761*time.Second {
+		t.Fatalf("unexpected time to full: %v", eta)
+	}
+
+	dp.usageHistory.samples = nil
+	for i := 0; i < 5; i++ {
+		dp.usageHistory.record(1000, now.Add(time.Duration(i)*usageSampleInterval))
+	}
+	if eta := dp.EstimateTimeToFull(); eta != TimeToFullUnknown {
+		t.Fatalf("time to full of a partition not growing: %v", eta)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/raftstore"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/util/log"
+	"github.com/tiglabs/raft"
+)
+
+// The raft has no leader transfer of its own, the leader asks the target to campaign by OpDataPartitionTryToLeader
+// once the target has matched the log committed, so the target wins the election at once and the followers do
+// not time out into one of their own.
+const (
+	DefaultLeaderTransferTimeout  = 5 * time.Second
+	leaderTransferCheckInterval   = 100 * time.Millisecond
+	DefaultLeaderTransferParallel = 8 // partitions transferred at once by TransferLeaderships
+)
+
+// LeaderTransfer is the transfer of the leadership of a partition to a follower.
+type LeaderTransfer struct {
+	PartitionID uint64 `json:"partitionID"`
+	TargetID    uint64 `json:"targetID"`
+	TargetAddr  string `json:"targetAddr"`
+	Transferred bool   `json:"transferred"`
+	Err         string `json:"err,omitempty"`
+	Duration    int64  `json:"durationMs"`
+}
+
+// LeaderTransferResult describes the transfers of the leaderships of all the partitions led by the node.
+type LeaderTransferResult struct {
+	Transferred int               `json:"transferred"`
+	Failed      int               `json:"failed"`
+	Transfers   []*LeaderTransfer `json:"transfers"`
+	Duration    int64             `json:"durationMs"`
+}
+
+// Check the follower can take over the leadership without falling behind, which the leader knows by the match
+// of the follower against the index committed.
+func checkTransferTarget(peerID uint64, replica *raft.ReplicaStatus, committedID uint64) (err error) {
+	switch {
+	case replica == nil:
+		err = fmt.Errorf("peer(%v) has no replication progress on the leader", peerID)
+	case !replica.Active:
+		err = fmt.Errorf("peer(%v) is not active, last active at %v", peerID, replica.LastActive.Format(TimeLayout))
+	case replica.Snapshoting:
+		err = fmt.Errorf("peer(%v) is receiving a snapshot", peerID)
+	case replica.Match < committedID:
+		err = fmt.Errorf("peer(%v) matched(%v) falls behind the committed(%v)", peerID, replica.Match, committedID)
+	}
+	return
+}
+
+// Pick the follower to transfer the leadership to from the ones caught up, the one matched the most log first,
+// and the one active last among them.
+func pickTransferTarget(selfID uint64, peers []proto.Peer, status *raftstore.PartitionStatus, committedID uint64) (target proto.Peer, err error) {
+	var (
+		best    *raft.ReplicaStatus
+		reasons []string
+	)
+	for _, peer := range peers {
+		if peer.ID == selfID {
+			continue
+		}
+		replica := status.Replicas[peer.ID]
+		if checkErr := checkTransferTarget(peer.ID, replica, committedID); checkErr != nil {
+			reasons = append(reasons, checkErr.Error())
+			continue
+		}
+		if best == nil || replica.Match > best.Match || (replica.Match == best.Match && replica.LastActive.After(best.LastActive)) {
+			best, target = replica, peer
+		}
+	}
+	if best == nil {
+		err = fmt.Errorf("no follower caught up: %v", reasons)
+	}
+	return
+}
+
+// Check the partition is led by the node, and return its raft status and the index committed.
+func (dp *DataPartition) leaderTransferState() (status *raftstore.PartitionStatus, committedID uint64, err error) {
+	progress, ok := dp.GetRaftProgress()
+	if !ok {
+		return nil, 0, fmt.Errorf("partition(%v) raft not started", dp.partitionID)
+	}
+	if _, isLeader := dp.IsRaftLeader(); !isLeader {
+		return nil, 0, fmt.Errorf("partition(%v) is not led by the node", dp.partitionID)
+	}
+	if status = dp.RaftStatus(); status == nil {
+		return nil, 0, fmt.Errorf("partition(%v) has no raft status", dp.partitionID)
+	}
+	return status, progress.CommittedID, nil
+}
+
+// TransferLeadership hands the leadership of the partition over to the peer, which has to be a follower caught
+// up with the log committed. It returns once the peer is seen as the leader, or fails after the timeout.
+func (dp *DataPartition) TransferLeadership(targetPeerID uint64) (err error) {
+	status, committedID, err := dp.leaderTransferState()
+	if err != nil {
+		return
+	}
+	var target *proto.Peer
+	for i := range dp.config.Peers {
+		if dp.config.Peers[i].ID == targetPeerID {
+			target = &dp.config.Peers[i]
+			break
+		}
+	}
+	if target == nil || targetPeerID == dp.config.NodeID {
+		return fmt.Errorf("partition(%v) peer(%v) is not a follower", dp.partitionID, targetPeerID)
+	}
+	if err = checkTransferTarget(targetPeerID, status.Replicas[targetPeerID], committedID); err != nil {
+		return fmt.Errorf("partition(%v) %v", dp.partitionID, err)
+	}
+	return dp.transferLeadershipTo(*target)
+}
+
+func (dp *DataPartition) transferLeadershipTo(target proto.Peer) (err error) {
+	log.LogInfof("action[TransferLeadership] partition(%v) transfer the leadership to peer(%v) addr(%v).",
+		dp.partitionID, target.ID, target.Addr)
+	if err = dp.askToCampaign(target.Addr); err != nil {
+		return fmt.Errorf("partition(%v) ask peer(%v) addr(%v) to campaign: %v", dp.partitionID, target.ID, target.Addr, err)
+	}
+	deadline := time.Now().Add(DefaultLeaderTransferTimeout)
+	for time.Now().Before(deadline) {
+		if leader, ok := dp.GetRaftLeader(); ok && leader.LeaderID == target.ID {
+			dp.logEvent(EventLeaderTransfer, "transferred the leadership to peer(%v) addr(%v)", target.ID, target.Addr)
+			return
+		}
+		time.Sleep(leaderTransferCheckInterval)
+	}
+	leader, _ := dp.GetRaftLeader()
+	return fmt.Errorf("partition(%v) leader is peer(%v) after %v, not peer(%v)",
+		dp.partitionID, leader.LeaderID, DefaultLeaderTransferTimeout, target.ID)
+}
+
+// Ask the replica of the address to campaign for the leadership, as the master does by OpDataPartitionTryToLeader.
+func (dp *DataPartition) askToCampaign(target string) (err error) {
+	var conn *net.TCPConn
+	if conn, err = gConnPool.GetConnect(target); err != nil {
+		return
+	}
+	defer gConnPool.PutConnect(conn, true)
+	p := repl.NewPacketToTryToLeader(dp.partitionID)
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	if err = p.ReadFromConn(conn, proto.ReadDeadlineTime); err != nil {
+		return
+	}
+	if p.ResultCode != proto.OpOk {
+		err = fmt.Errorf("%v", p.GetResultMsg())
+	}
+	return
+}
+
+// Transfer the leadership of the partition to the best follower, which is picked by pickTransferTarget.
+func (dp *DataPartition) transferLeadershipToBest() (transfer *LeaderTransfer) {
+	start := time.Now()
+	transfer = &LeaderTransfer{PartitionID: dp.partitionID}
+	defer func() {
+		transfer.Duration = int64(time.Since(start) / time.Millisecond)
+	}()
+	status, committedID, err := dp.leaderTransferState()
+	if err == nil {
+		var target proto.Peer
+		if target, err = pickTransferTarget(dp.config.NodeID, dp.config.Peers, status, committedID); err == nil {
+			transfer.TargetID, transfer.TargetAddr = target.ID, target.Addr
+			err = dp.transferLeadershipTo(target)
+		}
+	}
+	if err != nil {
+		log.LogWarnf("action[TransferLeaderships] partition(%v) err(%v).", dp.partitionID, err)
+		transfer.Err = err.Error()
+		return
+	}
+	transfer.Transferred = true
+	return
+}
+
+// TransferLeaderships moves the leadership of every partition led by the node to the best follower of each, so
+// the node can be stopped for maintenance without the elections of all its partitions timing out at once.
+func (manager *SpaceManager) TransferLeaderships() (result *LeaderTransferResult) {
+	start := time.Now()
+	result = &LeaderTransferResult{Transfers: make([]*LeaderTransfer, 0)}
+	partitions := make([]*DataPartition, 0)
+	manager.RangePartitions(func(partition *DataPartition) bool {
+		if _, isLeader := partition.IsRaftLeader(); isLeader {
+			partitions = append(partitions, partition)
+		}
+		return true
+	})
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		tokens = make(chan struct{}, DefaultLeaderTransferParallel)
+	)
+	for _, partition := range partitions {
+		wg.Add(1)
+		tokens <- struct{}{}
+		go func(dp *DataPartition) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			transfer := dp.transferLeadershipToBest()
+			mu.Lock()
+			result.Transfers = append(result.Transfers, transfer)
+			mu.Unlock()
+		}(partition)
+	}
+	wg.Wait()
+	sort.Slice(result.Transfers, func(i, j int) bool {
+		return result.Transfers[i].PartitionID < result.Transfers[j].PartitionID
+	})
+	for _, transfer := range result.Transfers {
+		if transfer.Transferred {
+			result.Transferred++
+		} else {
+			result.Failed++
+		}
+	}
+	result.Duration = int64(time.Since(start) / time.Millisecond)
+	return
+}
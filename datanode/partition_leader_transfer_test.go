@@ -0,0 +1,60 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/raftstore"
+	"github.com/tiglabs/raft"
+)
+
+func TestPickTransferTarget(t *testing.T) {
+	now := time.Now()
+	peers := []proto.Peer{{ID: 1, Addr: "192.168.0.11:17310"}, {ID: 2, Addr: "192.168.0.12:17310"},
+		{ID: 3, Addr: "192.168.0.13:17310"}, {ID: 4, Addr: "192.168.0.14:17310"}}
+	status := &raftstore.PartitionStatus{Replicas: map[uint64]*raft.ReplicaStatus{
+		1: {Match: 100, Active: true, LastActive: now},
+		2: {Match: 100, Active: true, LastActive: now.Add(-time.Second)},
+		3: {Match: 100, Active: true, LastActive: now},
+		4: {Match: 100, Active: false, LastActive: now.Add(-time.Minute)},
+	}}
+	// the leader itself and the inactive follower are never picked, the one active last wins the tie
+	target, err := pickTransferTarget(1, peers, status, 100)
+	if err != nil || target.ID != 3 {
+		t.Fatalf("picked peer(%v) err(%v), expected peer(3)", target.ID, err)
+	}
+	status.Replicas[3].Match = 99
+	if target, err = pickTransferTarget(1, peers, status, 100); err != nil || target.ID != 2 {
+		t.Fatalf("picked peer(%v) err(%v), expected peer(2) caught up", target.ID, err)
+	}
+	status.Replicas[2].Snapshoting = true
+	delete(status.Replicas, 3)
+	if target, err = pickTransferTarget(1, peers, status, 100); err == nil {
+		t.Fatalf("picked peer(%v) without any follower caught up", target.ID)
+	}
+	for _, reason := range []string{"peer(2) is receiving a snapshot", "peer(3) has no replication progress", "peer(4) is not active"} {
+		if !strings.Contains(err.Error(), reason) {
+			t.Errorf("err(%v) misses the reason %v", err, reason)
+		}
+	}
+	if err = checkTransferTarget(3, &raft.ReplicaStatus{Match: 99, Active: true}, 100); err == nil ||
+		!strings.Contains(err.Error(), "falls behind") {
+		t.Fatalf("follower falling behind checked err(%v)", err)
+	}
+}
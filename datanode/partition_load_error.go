@@ -0,0 +1,128 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+	"golang.org/x/sys/unix"
+)
+
+// The kinds of the errors an extent store fails to be loaded with.
+var (
+	ErrExtentStoreDirMissing     = errors.New("Extent store directory is missing")
+	ErrExtentStoreFilesMissing   = errors.New("Extent store files are missing")
+	ErrExtentStoreAccessDenied   = errors.New("Extent store access is denied")
+	ErrExtentStoreCorrupted      = errors.New("Extent store is corrupted")
+	ErrExtentStoreKeyUnavailable = errors.New("Extent store encryption key is unavailable")
+)
+
+// The files an extent store keeps its metadata in. They are created along with the extent store, so a
+// loaded partition missing any of them has lost the metadata, such as the crcs and the deleted extents.
+var extentStoreFiles = []string{
+	storage.ExtCrcHeaderFileName,
+	storage.ExtBaseExtentIDFileName,
+	storage.TinyExtDeletedFileName,
+	storage.NormalExtDeletedFileName,
+}
+
+// ExtentStoreLoadError is the error the extent store of a partition fails to be loaded with. Kind is one of
+// the ErrExtentStore errors, and Err is the cause of it.
+type ExtentStoreLoadError struct {
+	Kind error
+	Path string
+	Err  error
+}
+
+func (e *ExtentStoreLoadError) Error() string {
+	return fmt.Sprintf("%v: path(%v) err(%v)", e.Kind, e.Path, e.Err)
+}
+
+// ExtentStoreLoadErrorKind returns the kind of the error if it is an ExtentStoreLoadError, or nil.
+func ExtentStoreLoadErrorKind(err error) error {
+	if loadErr, ok := err.(*ExtentStoreLoadError); ok {
+		return loadErr.Kind
+	}
+	return nil
+}
+
+func newExtentStoreLoadError(kind error, path string, err error) error {
+	return &ExtentStoreLoadError{Kind: kind, Path: path, Err: err}
+}
+
+// Classify the error the extent store is opened with by the cause of it. The errors other than the missing
+// and the denied ones come from the content of the extent store.
+func classifyExtentStoreError(dir string, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case os.IsNotExist(err):
+		return newExtentStoreLoadError(ErrExtentStoreDirMissing, dir, err)
+	case os.IsPermission(err):
+		return newExtentStoreLoadError(ErrExtentStoreAccessDenied, dir, err)
+	case err == storage.ExtentStoreEncryptedError || err == storage.ExtentKeyMismatchError:
+		return newExtentStoreLoadError(ErrExtentStoreKeyUnavailable, dir, err)
+	default:
+		return newExtentStoreLoadError(ErrExtentStoreCorrupted, dir, err)
+	}
+}
+
+// Check the directory of a partition to be loaded before opening the extent store in it, which would create
+// whatever is missing and hide the loss. The missing extent store files are left to be recreated by the
+// extent store if repair is set, while a missing directory is never recreated as the partition metadata in
+// it is gone as well.
+func checkExtentStoreDir(dir string, repair bool) (err error) {
+	info, err := os.Stat(dir)
+	switch {
+	case os.IsNotExist(err):
+		return newExtentStoreLoadError(ErrExtentStoreDirMissing, dir, err)
+	case os.IsPermission(err):
+		return newExtentStoreLoadError(ErrExtentStoreAccessDenied, dir, err)
+	case err != nil:
+		return newExtentStoreLoadError(ErrExtentStoreCorrupted, dir, err)
+	case !info.IsDir():
+		return newExtentStoreLoadError(ErrExtentStoreCorrupted, dir, errors.New("not a directory"))
+	}
+	if err = unix.Access(dir, unix.R_OK|unix.W_OK|unix.X_OK); err != nil {
+		return newExtentStoreLoadError(ErrExtentStoreAccessDenied, dir, err)
+	}
+	for _, name := range extentStoreFiles {
+		filename := path.Join(dir, name)
+		info, err = os.Stat(filename)
+		switch {
+		case os.IsNotExist(err) && repair:
+			log.LogWarnf("action[checkExtentStoreDir] %v is missing and recreated.", filename)
+			continue
+		case os.IsNotExist(err):
+			return newExtentStoreLoadError(ErrExtentStoreFilesMissing, filename, err)
+		case os.IsPermission(err):
+			return newExtentStoreLoadError(ErrExtentStoreAccessDenied, filename, err)
+		case err != nil:
+			return newExtentStoreLoadError(ErrExtentStoreCorrupted, filename, err)
+		case !info.Mode().IsRegular():
+			return newExtentStoreLoadError(ErrExtentStoreCorrupted, filename, errors.New("not a regular file"))
+		}
+		if err = unix.Access(filename, unix.R_OK|unix.W_OK); err != nil {
+			return newExtentStoreLoadError(ErrExtentStoreAccessDenied, filename, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestCheckExtentStoreDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_store_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	expectKind := func(err, kind error) {
+		t.Helper()
+		if ExtentStoreLoadErrorKind(err) != kind {
+			t.Fatalf("err(%v), expected the kind %v", err, kind)
+		}
+	}
+
+	partitionDir := path.Join(dir, "datapartition_1_128849018880")
+	expectKind(checkExtentStoreDir(partitionDir, true), ErrExtentStoreDirMissing)
+
+	if err = ioutil.WriteFile(partitionDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectKind(checkExtentStoreDir(partitionDir, false), ErrExtentStoreCorrupted)
+	if err = os.Remove(partitionDir); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := storage.NewExtentStore(partitionDir, 1, 128*1024*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if err = checkExtentStoreDir(partitionDir, false); err != nil {
+		t.Fatalf("check a complete extent store: %v", err)
+	}
+
+	crcFile := path.Join(partitionDir, storage.ExtCrcHeaderFileName)
+	if err = os.Remove(crcFile); err != nil {
+		t.Fatal(err)
+	}
+	expectKind(checkExtentStoreDir(partitionDir, false), ErrExtentStoreFilesMissing)
+	if err = checkExtentStoreDir(partitionDir, true); err != nil {
+		t.Fatalf("check with the missing files repaired: %v", err)
+	}
+
+	if err = os.Mkdir(crcFile, 0755); err != nil {
+		t.Fatal(err)
+	}
+	expectKind(checkExtentStoreDir(partitionDir, true), ErrExtentStoreCorrupted)
+	if err = os.Remove(crcFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Log("skip the access denied check as root")
+		return
+	}
+	if err = os.Chmod(partitionDir, 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(partitionDir, 0755)
+	expectKind(checkExtentStoreDir(partitionDir, true), ErrExtentStoreAccessDenied)
+}
+
+func TestClassifyExtentStoreError(t *testing.T) {
+	cases := []struct {
+		err  error
+		kind error
+	}{
+		{err: &os.PathError{Op: "open", Path: "EXTENT_CRC", Err: syscall.ENOENT}, kind: ErrExtentStoreDirMissing},
+		{err: &os.PathError{Op: "open", Path: "EXTENT_CRC", Err: syscall.EACCES}, kind: ErrExtentStoreAccessDenied},
+		{err: errors.New("init base field ID: unexpected EOF"), kind: ErrExtentStoreCorrupted},
+	}
+	for _, c := range cases {
+		if kind := ExtentStoreLoadErrorKind(classifyExtentStoreError("dir", c.err)); kind != c.kind {
+			t.Fatalf("err(%v) classified as %v, expected %v", c.err, kind, c.kind)
+		}
+	}
+	if classifyExtentStoreError("dir", nil) != nil {
+		t.Fatal("nil error classified")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// PartitionLoadFailure describes a partition failed to be loaded from a disk on the startup. Kind is the one
+// of the ErrExtentStore errors if the extent store of the partition failed to be loaded.
+type PartitionLoadFailure struct {
+	ID    uint64 `json:"id"`
+	Disk  string `json:"disk"`
+	Dir   string `json:"dir"`
+	Kind  string `json:"kind,omitempty"`
+	Error string `json:"error"`
+	Time  int64  `json:"time"`
+}
+
+// DiskLoadReport describes the load of the partitions of a disk on the startup.
+type DiskLoadReport struct {
+	Disk     string
+	Loaded   int
+	Failed   []*PartitionLoadFailure
+	Duration time.Duration
+}
+
+// partitionLoadFailures keeps the partitions failed to be loaded on the startup, so that they are reported
+// until the data node restarts instead of being left on the disks unnoticed.
+type partitionLoadFailures struct {
+	sync.RWMutex
+	failures map[uint64]*PartitionLoadFailure
+}
+
+func newPartitionLoadFailure(partitionID uint64, disk, dir string, err error) (failure *PartitionLoadFailure) {
+	failure = &PartitionLoadFailure{
+		ID:    partitionID,
+		Disk:  disk,
+		Dir:   dir,
+		Error: err.Error(),
+		Time:  time.Now().Unix(),
+	}
+	if kind := ExtentStoreLoadErrorKind(err); kind != nil {
+		failure.Kind = kind.Error()
+	}
+	return
+}
+
+func (manager *SpaceManager) SetLoadConcurrency(concurrency int) {
+	manager.loadConcurrency = concurrency
+}
+
+// GetLoadConcurrency returns the number of the partitions of a disk loaded at once on the startup.
+func (manager *SpaceManager) GetLoadConcurrency() (concurrency int) {
+	if manager.loadConcurrency <= 0 {
+		return DefaultLoadConcurrency
+	}
+	return manager.loadConcurrency
+}
+
+func (manager *SpaceManager) recordLoadFailures(failures []*PartitionLoadFailure) {
+	f := &manager.loadFailures
+	f.Lock()
+	defer f.Unlock()
+	if f.failures == nil {
+		f.failures = make(map[uint64]*PartitionLoadFailure)
+	}
+	for _, failure := range failures {
+		f.failures[failure.ID] = failure
+	}
+}
+
+// Forget the failure of the partition once it is loaded, e.g. after its metadata is rebuilt.
+func (manager *SpaceManager) clearLoadFailure(partitionID uint64) {
+	f := &manager.loadFailures
+	f.Lock()
+	defer f.Unlock()
+	delete(f.failures, partitionID)
+}
+
+// LoadFailures returns the partitions failed to be loaded on the startup, sorted by the id.
+func (manager *SpaceManager) LoadFailures() (failures []*PartitionLoadFailure) {
+	f := &manager.loadFailures
+	f.RLock()
+	defer f.RUnlock()
+	failures = make([]*PartitionLoadFailure, 0, len(f.failures))
+	for _, failure := range f.failures {
+		failures = append(failures, failure)
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].ID < failures[j].ID
+	})
+	return
+}
+
+// A partition directory on a disk to be loaded.
+type partitionDir struct {
+	partitionID uint64
+	filename    string
+}
+
+// Load the partitions by the given number of workers at most, and return the errors of them in the same order.
+// A partition failed to be loaded does not stop the others.
+func loadPartitions(dirs []*partitionDir, concurrency int, load func(dir *partitionDir) error) (errs []error) {
+	errs = make([]error, len(dirs))
+	if concurrency > len(dirs) {
+		concurrency = len(dirs)
+	}
+	indexes := make(chan int, len(dirs))
+	for i := range dirs {
+		indexes <- i
+	}
+	close(indexes)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = load(dirs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return
+}
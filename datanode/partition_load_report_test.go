@@ -0,0 +1,69 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadPartitions(t *testing.T) {
+	dirs := make([]*partitionDir, 0)
+	for id := uint64(1); id <= 20; id++ {
+		dirs = append(dirs, &partitionDir{partitionID: id, filename: "datapartition_" + strconv.FormatUint(id, 10) + "_128"})
+	}
+	var running, maxRunning int32
+	var lock sync.Mutex
+	errs := loadPartitions(dirs, 3, func(dir *partitionDir) error {
+		lock.Lock()
+		if running++; running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		lock.Lock()
+		running--
+		lock.Unlock()
+		if dir.partitionID%7 == 0 {
+			return errors.New("broken partition")
+		}
+		return nil
+	})
+	if maxRunning > 3 {
+		t.Fatalf("(%v) partitions loaded at once, expected 3 at most", maxRunning)
+	}
+	for i, err := range errs {
+		if failed := dirs[i].partitionID%7 == 0; failed != (err != nil) {
+			t.Fatalf("partition(%v) err(%v)", dirs[i].partitionID, err)
+		}
+	}
+
+	// the failures are kept by the space manager until the restart
+	space := &SpaceManager{}
+	if concurrency := space.GetLoadConcurrency(); concurrency != DefaultLoadConcurrency {
+		t.Fatalf("load concurrency(%v), expected the default", concurrency)
+	}
+	space.recordLoadFailures([]*PartitionLoadFailure{
+		newPartitionLoadFailure(14, "/data1", dirs[13].filename, errs[13]),
+		newPartitionLoadFailure(7, "/data1", dirs[6].filename, errs[6]),
+	})
+	failures := space.LoadFailures()
+	if len(failures) != 2 || failures[0].ID != 7 || failures[1].ID != 14 || failures[0].Error != "broken partition" {
+		t.Fatalf("unexpected load failures(%+v)", failures)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// The locks of a data partition are acquired in the order of their ranks below, so a goroutine holding a lock
+// only acquires the locks of the higher ranks, and never the one it holds again:
+//
+//	resizeLock < snapshotReload < snapshotMutex < usageLock < persistLock < replicasLock < inflightLock
+//	< repairStatsLock < statusChangeHandlerLock
+//
+// applyResize persists the metadata with resizeLock held, and ReloadSnapshot publishes the snapshot with
+// snapshotReload held. The other locks are not held while acquiring another one now, they are ranked to keep
+// it so. The locks of the per-feature states, such as quarantine or extentExpiry, are not ranked, and must not
+// be held while acquiring any of the locks above.
+//
+// The order is verified by the data node built with the lockorder tag and by the tests, which panic on the
+// acquisition out of the order instead of deadlocking some day.
+type lockRank int
+
+const (
+	lockRankNone lockRank = iota // not verified, such as the locks of a partition not initialized by newDataPartition
+	lockRankResize
+	lockRankSnapshotReload
+	lockRankSnapshot
+	lockRankUsage
+	lockRankPersist
+	lockRankReplicas
+	lockRankInflight
+	lockRankRepairStats
+	lockRankStatusChangeHandler
+)
+
+var lockRankNames = map[lockRank]string{
+	lockRankResize:              "resizeLock",
+	lockRankSnapshotReload:      "snapshotReload",
+	lockRankSnapshot:            "snapshotMutex",
+	lockRankUsage:               "usageLock",
+	lockRankPersist:             "persistLock",
+	lockRankReplicas:            "replicasLock",
+	lockRankInflight:            "inflightLock",
+	lockRankRepairStats:         "repairStatsLock",
+	lockRankStatusChangeHandler: "statusChangeHandlerLock",
+}
+
+func (rank lockRank) String() string {
+	if name, ok := lockRankNames[rank]; ok {
+		return name
+	}
+	return "lockRank(" + strconv.Itoa(int(rank)) + ")"
+}
+
+// Rank the locks of the partition to verify the order of them.
+func (dp *DataPartition) initLockOrder() {
+	dp.resizeLock.rank = lockRankResize
+	dp.snapshotReload.rank = lockRankSnapshotReload
+	dp.snapshotMutex.rank = lockRankSnapshot
+	dp.usageLock.rank = lockRankUsage
+	dp.persistLock.rank = lockRankPersist
+	dp.replicasLock.rank = lockRankReplicas
+	dp.inflightLock.rank = lockRankInflight
+	dp.repairStatsLock.rank = lockRankRepairStats
+	dp.statusChangeHandlerLock.rank = lockRankStatusChangeHandler
+}
+
+// orderedMutex is a mutex verified to be acquired in the order of its rank.
+type orderedMutex struct {
+	mu   sync.Mutex
+	rank lockRank
+}
+
+func (m *orderedMutex) Lock() {
+	lockOrder.acquire(m, m.rank)
+	m.mu.Lock()
+}
+
+func (m *orderedMutex) Unlock() {
+	lockOrder.release(m, m.rank)
+	m.mu.Unlock()
+}
+
+// orderedRWMutex is a read-write mutex verified to be acquired in the order of its rank, for both the reads
+// and the writes, since a read waits for a write already waiting as well.
+type orderedRWMutex struct {
+	mu   sync.RWMutex
+	rank lockRank
+}
+
+func (m *orderedRWMutex) Lock() {
+	lockOrder.acquire(m, m.rank)
+	m.mu.Lock()
+}
+
+func (m *orderedRWMutex) Unlock() {
+	lockOrder.release(m, m.rank)
+	m.mu.Unlock()
+}
+
+func (m *orderedRWMutex) RLock() {
+	lockOrder.acquire(m, m.rank)
+	m.mu.RLock()
+}
+
+func (m *orderedRWMutex) RUnlock() {
+	lockOrder.release(m, m.rank)
+	m.mu.RUnlock()
+}
+
+type heldLock struct {
+	lock interface{}
+	rank lockRank
+}
+
+// lockOrderTracker keeps the ranked locks held by each goroutine.
+type lockOrderTracker struct {
+	sync.Mutex
+	held map[uint64][]heldLock // goroutine id -> locks in the order of the acquisition
+}
+
+var lockOrder = &lockOrderTracker{}
+
+// Panic if the lock is acquired while holding a lock of the same or a higher rank.
+func (t *lockOrderTracker) acquire(lock interface{}, rank lockRank) {
+	if !checkLockOrder || rank == lockRankNone {
+		return
+	}
+	gid := goroutineID()
+	t.Lock()
+	defer t.Unlock()
+	for _, h := range t.held[gid] {
+		if h.rank >= rank {
+			panic(fmt.Sprintf("lock order violation: %v acquired while holding %v", rank, h.rank))
+		}
+	}
+	if t.held == nil {
+		t.held = make(map[uint64][]heldLock)
+	}
+	t.held[gid] = append(t.held[gid], heldLock{lock: lock, rank: rank})
+}
+
+// Forget the lock held by the goroutine. The ranked locks are released by the goroutines acquired them.
+func (t *lockOrderTracker) release(lock interface{}, rank lockRank) {
+	if !checkLockOrder || rank == lockRankNone {
+		return
+	}
+	gid := goroutineID()
+	t.Lock()
+	defer t.Unlock()
+	held := t.held[gid]
+	for i := len(held) - 1; i >= 0; i-- {
+		if held[i].lock == lock {
+			held = append(held[:i], held[i+1:]...)
+			break
+		}
+	}
+	if len(held) == 0 {
+		delete(t.held, gid)
+		return
+	}
+	t.held[gid] = held
+}
+
+// The id of the current goroutine parsed from its stack, which is only affordable for the verification.
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// The tests verify the order of the locks of the partitions, see lockRank.
+func init() {
+	checkLockOrder = true
+}
+
+func expectLockOrderViolation(t *testing.T, name string, fn func()) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("%v: expect a lock order violation", name)
+		} else if !strings.Contains(fmt.Sprint(r), "lock order violation") {
+			t.Errorf("%v: unexpected panic(%v)", name, r)
+		}
+	}()
+	fn()
+}
+
+func TestLockOrder(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+
+	// the canonical order and the acquisitions after the release are fine
+	dp.resizeLock.Lock()
+	dp.snapshotReload.Lock()
+	dp.snapshotMutex.RLock()
+	dp.persistLock.Lock()
+	dp.replicasLock.RLock()
+	dp.repairStatsLock.Lock()
+	dp.repairStatsLock.Unlock()
+	dp.replicasLock.RUnlock()
+	dp.persistLock.Unlock()
+	dp.snapshotMutex.RUnlock()
+	dp.snapshotReload.Unlock()
+	dp.resizeLock.Unlock()
+	dp.replicasLock.Lock()
+	dp.replicasLock.Unlock()
+	dp.snapshotMutex.Lock()
+	dp.snapshotMutex.Unlock()
+
+	dp.replicasLock.Lock()
+	expectLockOrderViolation(t, "snapshotMutex after replicasLock", func() {
+		dp.snapshotMutex.RLock()
+	})
+	dp.replicasLock.Unlock()
+	dp.snapshotMutex.RLock()
+	expectLockOrderViolation(t, "snapshotMutex read again", func() {
+		dp.snapshotMutex.RLock()
+	})
+	dp.snapshotMutex.RUnlock()
+	other := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	dp.inflightLock.Lock()
+	expectLockOrderViolation(t, "inflightLock of another partition", func() {
+		other.inflightLock.Lock()
+	})
+	dp.inflightLock.Unlock()
+
+	// the locks held by another goroutine do not count
+	dp.persistLock.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dp.usageLock.Lock()
+		dp.usageLock.Unlock()
+	}()
+	<-done
+	dp.persistLock.Unlock()
+
+	// the locks of a partition not initialized are not verified
+	unranked := &DataPartition{}
+	unranked.replicasLock.Lock()
+	unranked.snapshotMutex.Lock()
+	unranked.snapshotMutex.Unlock()
+	unranked.replicasLock.Unlock()
+
+	lockOrder.Lock()
+	held := lockOrder.held[goroutineID()]
+	lockOrder.Unlock()
+	if len(held) != 0 {
+		t.Fatalf("locks(%v) are left held", held)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// MembershipDiscrepancy describes where the replicas listed by the master disagree with the raft peers
+// the partition replicates to.
+type MembershipDiscrepancy struct {
+	ID          uint64       `json:"id"`
+	Replicas    []string     `json:"replicas"`
+	Peers       []proto.Peer `json:"peers"`
+	NotInRaft   []string     `json:"notInRaft"`   // listed by the master, but not a raft peer
+	NotOnMaster []proto.Peer `json:"notOnMaster"` // a raft peer, but not listed by the master
+	Since       int64        `json:"since"`       // when the same discrepancy is found first
+}
+
+// membershipCheck keeps the discrepancy found by the latest check of the membership, nil if none.
+type membershipCheck struct {
+	sync.RWMutex
+	discrepancy *MembershipDiscrepancy
+}
+
+// Compare the replicas listed by the master with the raft peers by their addresses.
+func diffMembership(replicas []string, peers []proto.Peer) (notInRaft []string, notOnMaster []proto.Peer) {
+	peerAddrs := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		peerAddrs[peer.Addr] = true
+	}
+	hosts := make(map[string]bool, len(replicas))
+	for _, replica := range replicas {
+		hosts[replica] = true
+		if !peerAddrs[replica] {
+			notInRaft = append(notInRaft, replica)
+		}
+	}
+	for _, peer := range peers {
+		if !hosts[peer.Addr] {
+			notOnMaster = append(notOnMaster, peer)
+		}
+	}
+	return
+}
+
+// checkMembership cross-checks the replicas fetched from the master against the raft peers of the partition.
+// A discrepancy is logged and warned once when it is found or changes, and kept until the two agree again.
+func (dp *DataPartition) checkMembership(replicas []string) {
+	peers := make([]proto.Peer, len(dp.config.Peers))
+	copy(peers, dp.config.Peers)
+	notInRaft, notOnMaster := diffMembership(replicas, peers)
+	c := &dp.membershipCheck
+	c.Lock()
+	defer c.Unlock()
+	if len(notInRaft) == 0 && len(notOnMaster) == 0 {
+		if c.discrepancy != nil {
+			log.LogInfof("action[checkMembership] partition(%v) replicas(%v) agree with raft peers(%v) again.",
+				dp.partitionID, replicas, peers)
+			c.discrepancy = nil
+		}
+		return
+	}
+	if old := c.discrepancy; old != nil && fmt.Sprint(old.NotInRaft, old.NotOnMaster) == fmt.Sprint(notInRaft, notOnMaster) {
+		old.Replicas, old.Peers = replicas, peers
+		return
+	}
+	c.discrepancy = &MembershipDiscrepancy{
+		ID:          dp.partitionID,
+		Replicas:    replicas,
+		Peers:       peers,
+		NotInRaft:   notInRaft,
+		NotOnMaster: notOnMaster,
+		Since:       time.Now().Unix(),
+	}
+	dp.logEvent(EventPeersMismatch, "replicas(%v) peers(%v) not in raft(%v) not on master(%v)",
+		replicas, peers, notInRaft, notOnMaster)
+	mesg := fmt.Sprintf("action[checkMembership] partition(%v) on %v master replicas(%v) mismatch raft peers(%v), "+
+		"not in raft(%v) not on master(%v)", dp.partitionID, LocalIP, replicas, peers, notInRaft, notOnMaster)
+	log.LogWarn(mesg)
+	exporter.Warning(mesg)
+}
+
+// GetMembershipDiscrepancy returns the discrepancy between the replicas listed by the master and the raft
+// peers found by the latest check, nil if they agree.
+func (dp *DataPartition) GetMembershipDiscrepancy() *MembershipDiscrepancy {
+	c := &dp.membershipCheck
+	c.RLock()
+	defer c.RUnlock()
+	if c.discrepancy == nil {
+		return nil
+	}
+	discrepancy := *c.discrepancy
+	return &discrepancy
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestCheckMembership(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(nil))
+	dp.config = &dataPartitionCfg{Peers: []proto.Peer{
+		{ID: 1, Addr: "192.168.0.11:17310"},
+		{ID: 2, Addr: "192.168.0.12:17310"},
+	}}
+	dp.checkMembership([]string{"192.168.0.12:17310", "192.168.0.11:17310"})
+	if discrepancy := dp.GetMembershipDiscrepancy(); discrepancy != nil {
+		t.Fatalf("discrepancy(%+v) of the same members in another order", discrepancy)
+	}
+
+	// the master still lists a host removed from raft, and misses the one added
+	dp.config.Peers = []proto.Peer{{ID: 1, Addr: "192.168.0.11:17310"}, {ID: 3, Addr: "192.168.0.13:17310"}}
+	replicas := []string{"192.168.0.11:17310", "192.168.0.12:17310"}
+	dp.checkMembership(replicas)
+	discrepancy := dp.GetMembershipDiscrepancy()
+	if discrepancy == nil || len(discrepancy.NotInRaft) != 1 || discrepancy.NotInRaft[0] != "192.168.0.12:17310" ||
+		len(discrepancy.NotOnMaster) != 1 || discrepancy.NotOnMaster[0].ID != 3 {
+		t.Fatalf("unexpected discrepancy(%+v)", discrepancy)
+	}
+	since := discrepancy.Since
+	discrepancy.Since = 0
+	dp.checkMembership(replicas)
+	if again := dp.GetMembershipDiscrepancy(); again == nil || again.Since != since {
+		t.Fatalf("discrepancy(%+v) found again, expected the one since %v", again, since)
+	}
+
+	dp.checkMembership([]string{"192.168.0.11:17310", "192.168.0.13:17310"})
+	if discrepancy = dp.GetMembershipDiscrepancy(); discrepancy != nil {
+		t.Fatalf("discrepancy(%+v) kept after the members agree", discrepancy)
+	}
+}
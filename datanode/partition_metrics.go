@@ -0,0 +1,260 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/exporter"
+)
+
+// The latency histogram keeps latencyHistogramSubBuckets linear sub-buckets for each power of two,
+// so that the relative error of a recorded value is bounded by 1/latencyHistogramSubBuckets.
+const (
+	latencyHistogramSubBits    = 4
+	latencyHistogramSubBuckets = 1 << latencyHistogramSubBits
+	latencyHistogramMaxBits    = 31 // latencies are recorded in microseconds, larger ones are clamped
+	latencyHistogramBuckets    = (latencyHistogramMaxBits - latencyHistogramSubBits + 1) * latencyHistogramSubBuckets
+	latencyHistogramMaxValue   = 1<<latencyHistogramMaxBits - 1
+)
+
+type latencyHistogram struct {
+	counts [latencyHistogramBuckets]uint64
+	sum    uint64 // microseconds
+}
+
+func latencyBucketIndex(v uint64) int {
+	if v > latencyHistogramMaxValue {
+		v = latencyHistogramMaxValue
+	}
+	if v < latencyHistogramSubBuckets {
+		return int(v)
+	}
+	shift := uint(bits.Len64(v) - latencyHistogramSubBits - 1)
+	return int(shift+1)*latencyHistogramSubBuckets + int(v>>shift) - latencyHistogramSubBuckets
+}
+
+// latencyBucketValue returns the highest value which falls into the given bucket.
+func latencyBucketValue(index int) uint64 {
+	if index < latencyHistogramSubBuckets {
+		return uint64(index)
+	}
+	shift := uint(index/latencyHistogramSubBuckets - 1)
+	sub := uint64(index%latencyHistogramSubBuckets + latencyHistogramSubBuckets)
+	return (sub+1)<<shift - 1
+}
+
+func (h *latencyHistogram) record(v uint64) {
+	atomic.AddUint64(&h.counts[latencyBucketIndex(v)], 1)
+	atomic.AddUint64(&h.sum, v)
+}
+
+// LatencyPercentiles describes the distribution of the latencies recorded by a partition.
+type LatencyPercentiles struct {
+	Count uint64
+	Sum   time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// windowedHistogram records the latencies into the histogram of the current window. When the window expires,
+// it becomes the previous window and a new one is started, so the percentiles cover between one and two windows.
+type windowedHistogram struct {
+	current  atomic.Value // *latencyHistogram
+	previous atomic.Value // *latencyHistogram
+}
+
+func newWindowedHistogram() (h *windowedHistogram) {
+	h = new(windowedHistogram)
+	h.current.Store(new(latencyHistogram))
+	h.previous.Store(new(latencyHistogram))
+	return
+}
+
+func (h *windowedHistogram) record(latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+	h.current.Load().(*latencyHistogram).record(uint64(latency / time.Microsecond))
+}
+
+func (h *windowedHistogram) rotate() {
+	h.previous.Store(h.current.Load())
+	h.current.Store(new(latencyHistogram))
+}
+
+func (h *windowedHistogram) percentiles() (percentiles *LatencyPercentiles) {
+	var merged [latencyHistogramBuckets]uint64
+	percentiles = new(LatencyPercentiles)
+	for _, histogram := range []*latencyHistogram{h.previous.Load().(*latencyHistogram), h.current.Load().(*latencyHistogram)} {
+		for i := range histogram.counts {
+			count := atomic.LoadUint64(&histogram.counts[i])
+			merged[i] += count
+			percentiles.Count += count
+		}
+		percentiles.Sum += time.Duration(atomic.LoadUint64(&histogram.sum)) * time.Microsecond
+	}
+	if percentiles.Count == 0 {
+		return
+	}
+	targets := []struct {
+		quantile float64
+		result   *time.Duration
+	}{
+		{0.50, &percentiles.P50},
+		{0.95, &percentiles.P95},
+		{0.99, &percentiles.P99},
+	}
+	var seen uint64
+	index := 0
+	for i, count := range merged {
+		seen += count
+		for index < len(targets) && float64(seen) >= targets[index].quantile*float64(percentiles.Count) {
+			*targets[index].result = time.Duration(latencyBucketValue(i)) * time.Microsecond
+			index++
+		}
+		if index == len(targets) {
+			break
+		}
+	}
+	return
+}
+
+// DataPartitionMetrics collects the metrics of a data partition: the latencies of the writes, the number of
+// the extents waiting to be repaired, and how long an extent waits from the receipt of the repair task
+// until its repair starts. Everything is recorded with atomic operations to stay off the locks of the write path.
+type DataPartitionMetrics struct {
+	partitionID      uint64
+	window           int64 // seconds
+	windowStartTime  int64
+	writeLatency     *windowedHistogram
+	repairWait       *windowedHistogram
+	repairQueueDepth int64
+	readRepairs      uint64
+	ioCount          uint64 // reads and writes served, counted to find the partition idle
+	lastIOCount      uint64 // ioCount seen by the latest status tick
+	idleTicks        int64  // status ticks in a row without any read or write
+}
+
+// NewDataPartitionMetrics creates a new DataPartitionMetrics.
+func NewDataPartitionMetrics(partitionID uint64, window int64) *DataPartitionMetrics {
+	if window <= 0 {
+		window = DefaultLatencyWindow
+	}
+	return &DataPartitionMetrics{
+		partitionID:     partitionID,
+		window:          window,
+		windowStartTime: time.Now().Unix(),
+		writeLatency:    newWindowedHistogram(),
+		repairWait:      newWindowedHistogram(),
+	}
+}
+
+// RecordWriteLatency records the latency of a write.
+func (m *DataPartitionMetrics) RecordWriteLatency(latency time.Duration) {
+	m.writeLatency.record(latency)
+}
+
+// RecordRepairWait records how long an extent waited before its repair started.
+func (m *DataPartitionMetrics) RecordRepairWait(wait time.Duration) {
+	m.repairWait.record(wait)
+}
+
+// Add the number of the extents queued to be repaired, which is negative when they leave the queue.
+func (m *DataPartitionMetrics) addRepairQueueDepth(delta int) {
+	atomic.AddInt64(&m.repairQueueDepth, int64(delta))
+}
+
+// RepairQueueDepth returns the number of the extents waiting to be repaired.
+func (m *DataPartitionMetrics) RepairQueueDepth() int64 {
+	return atomic.LoadInt64(&m.repairQueueDepth)
+}
+
+func (m *DataPartitionMetrics) recordReadRepair() {
+	atomic.AddUint64(&m.readRepairs, 1)
+}
+
+// ReadRepairs returns the number of the extents repaired on the reads since the partition is loaded.
+func (m *DataPartitionMetrics) ReadRepairs() uint64 {
+	return atomic.LoadUint64(&m.readRepairs)
+}
+
+// Count a read or a write served by the partition, which wakes the partition up if idle.
+func (m *DataPartitionMetrics) recordIO() {
+	atomic.AddUint64(&m.ioCount, 1)
+}
+
+// IsIdle tells if the partition has served no read or write for IdleMetricsIntervals status intervals. The
+// partition is not idle since the first IO afterwards, without waiting for the next tick.
+func (m *DataPartitionMetrics) IsIdle() bool {
+	return atomic.LoadInt64(&m.idleTicks) >= IdleMetricsIntervals &&
+		atomic.LoadUint64(&m.ioCount) == atomic.LoadUint64(&m.lastIOCount)
+}
+
+// Count the status tick in the idle ticks, and tell if the metrics are reported by it. An idle partition only
+// reports once every IdleMetricsBackoff ticks, on the tick it becomes idle first, since its metrics do not
+// change. The tick after an IO always reports, so the latencies of the first IOs after the idle are reported
+// as soon as the ones of a busy partition.
+func (m *DataPartitionMetrics) tick() (report bool) {
+	count := atomic.LoadUint64(&m.ioCount)
+	if count != atomic.LoadUint64(&m.lastIOCount) {
+		atomic.StoreUint64(&m.lastIOCount, count)
+		atomic.StoreInt64(&m.idleTicks, 0)
+		return true
+	}
+	idleTicks := atomic.AddInt64(&m.idleTicks, 1)
+	if idleTicks < IdleMetricsIntervals {
+		return true
+	}
+	return (idleTicks-IdleMetricsIntervals)%IdleMetricsBackoff == 0
+}
+
+func (m *DataPartitionMetrics) rotateIfExpired() {
+	now := time.Now().Unix()
+	if now-m.windowStartTime < m.window {
+		return
+	}
+	m.writeLatency.rotate()
+	m.repairWait.rotate()
+	m.windowStartTime = now
+}
+
+// LatencyPercentiles returns the percentiles of the write latencies of the recent windows.
+func (m *DataPartitionMetrics) LatencyPercentiles() (percentiles *LatencyPercentiles) {
+	return m.writeLatency.percentiles()
+}
+
+// RepairWaitPercentiles returns the percentiles of the repair waits of the recent windows.
+func (m *DataPartitionMetrics) RepairWaitPercentiles() (percentiles *LatencyPercentiles) {
+	return m.repairWait.percentiles()
+}
+
+func (m *DataPartitionMetrics) report() {
+	labels := map[string]string{"partid": fmt.Sprintf("%v", m.partitionID)}
+	percentiles := m.LatencyPercentiles()
+	exporter.NewGauge("dataPartitionWriteLatencyP50").SetWithLabels(int64(percentiles.P50/time.Microsecond), labels)
+	exporter.NewGauge("dataPartitionWriteLatencyP95").SetWithLabels(int64(percentiles.P95/time.Microsecond), labels)
+	exporter.NewGauge("dataPartitionWriteLatencyP99").SetWithLabels(int64(percentiles.P99/time.Microsecond), labels)
+	percentiles = m.RepairWaitPercentiles()
+	exporter.NewGauge("dataPartitionRepairWaitP50").SetWithLabels(int64(percentiles.P50/time.Microsecond), labels)
+	exporter.NewGauge("dataPartitionRepairWaitP95").SetWithLabels(int64(percentiles.P95/time.Microsecond), labels)
+	exporter.NewGauge("dataPartitionRepairWaitP99").SetWithLabels(int64(percentiles.P99/time.Microsecond), labels)
+	exporter.NewGauge("dataPartitionRepairQueueDepth").SetWithLabels(m.RepairQueueDepth(), labels)
+	exporter.NewGauge("dataPartitionReadRepairs").SetWithLabels(int64(m.ReadRepairs()), labels)
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricsIdle(t *testing.T) {
+	m := NewDataPartitionMetrics(1, 0)
+	for i := 0; i < IdleMetricsIntervals-1; i++ {
+		if !m.tick() || m.IsIdle() {
+			t.Fatalf("tick(%v) before the partition is idle not reported", i)
+		}
+	}
+	if !m.tick() || !m.IsIdle() {
+		t.Fatalf("tick the partition becomes idle on not reported")
+	}
+	for i := 1; i < IdleMetricsBackoff; i++ {
+		if m.tick() {
+			t.Fatalf("idle tick(%v) reported", i)
+		}
+	}
+	if !m.tick() {
+		t.Fatalf("idle tick after the backoff not reported")
+	}
+
+	m.RecordWriteLatency(time.Millisecond)
+	m.recordIO()
+	if m.IsIdle() {
+		t.Fatalf("partition idle after an IO")
+	}
+	if !m.tick() || m.IsIdle() {
+		t.Fatalf("tick after an IO not reported")
+	}
+	if percentiles := m.LatencyPercentiles(); percentiles.Count != 1 {
+		t.Fatalf("latencies recorded(%v) after the idle", percentiles.Count)
+	}
+}
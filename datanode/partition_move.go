@@ -0,0 +1,386 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	movingDirPrefix    = ".moving_" // the source directory of a partition switched to the target disk
+	moveTempDirPrefix  = ".move_"   // the copy of a partition on the target disk not verified yet
+	moveTargetSuffix   = ".target"  // the file next to the .moving_ directory naming the target disk
+	moveRepairWaitTime = DefaultDrainTimeout
+)
+
+// MovePartitionResult describes a partition moved to another disk of the node.
+type MovePartitionResult struct {
+	PartitionID uint64 `json:"partitionID"`
+	SourcePath  string `json:"sourcePath"`
+	TargetPath  string `json:"targetPath"`
+	Files       int    `json:"files"`
+	Bytes       int64  `json:"bytes"`
+	Cost        int64  `json:"cost"` // ms the partition is not served
+}
+
+// MovePartitionToDisk moves the partition to another disk of the node, and returns the partition loaded from
+// the target disk, which replaces this one. The partition is detached from the space manager first, so the
+// new writes are refused to be retried by the clients instead of being lost, and it is drained and stopped like
+// on the shutdown, which waits for the extents being repaired and stops the status update and the raft. The
+// stopped directory, with the extents, the metadata and the raft log, is copied to the target disk and verified
+// by the crcs of the files read back, before the directories are switched by the renames and the partition is
+// loaded from the target disk. The partition is loaded from the source disk again on any failure before the
+// switch.
+//
+// The source directory is renamed away before the copy is renamed to the partition directory, so a crash in
+// between leaves the partition on neither disk instead of on both. It is found as the .moving_ directory of the
+// source disk, next to the .target file naming the target disk, and the .move_ directory of the target disk if
+// the crash happens before the switch. The disks recover them on the restart, see recoverMove.
+func (dp *DataPartition) MovePartitionToDisk(targetDisk *Disk) (moved *DataPartition, result *MovePartitionResult, err error) {
+	sourceDisk := dp.disk
+	if targetDisk == nil || sourceDisk == nil || targetDisk.space != sourceDisk.space {
+		return nil, nil, fmt.Errorf("partition(%v) can only be moved between the disks of the node", dp.partitionID)
+	}
+	if targetDisk.Path == sourceDisk.Path {
+		return nil, nil, fmt.Errorf("partition(%v) is already on disk(%v)", dp.partitionID, targetDisk.Path)
+	}
+	if targetDisk.Status != proto.ReadWrite {
+		return nil, nil, fmt.Errorf("disk(%v) is not writable, status(%v)", targetDisk.Path, targetDisk.Status)
+	}
+	if err = targetDisk.checkHealthToCreate(); err != nil {
+		return
+	}
+	// the copy keeps the holes of the extents, so it takes at most the size of the partition
+	if err = targetDisk.checkSpaceToCreate(dp.Size()); err != nil {
+		return
+	}
+	if _, findErr := targetDisk.findPartitionDir(dp.partitionID); findErr == nil {
+		return nil, nil, fmt.Errorf("partition(%v) already exists on disk(%v)", dp.partitionID, targetDisk.Path)
+	}
+	if !atomic.CompareAndSwapInt32(&dp.isMoving, 0, 1) {
+		return nil, nil, fmt.Errorf("partition(%v) is being moved", dp.partitionID)
+	}
+	sourceDir := dp.path
+	targetDir := path.Join(targetDisk.Path, path.Base(sourceDir))
+	movingDir := path.Join(sourceDisk.Path, movingDirPrefix+path.Base(sourceDir))
+	tempDir := path.Join(targetDisk.Path, fmt.Sprintf(moveTempDirPrefix+"%v_%v", dp.partitionID, time.Now().UnixNano()))
+	result = &MovePartitionResult{PartitionID: dp.partitionID, SourcePath: sourceDir, TargetPath: targetDir}
+	start := time.Now()
+
+	space := sourceDisk.space
+	space.DetachDataPartition(dp.partitionID)
+	dp.Drain(DefaultDrainTimeout)
+	dp.waitRepairStopped(moveRepairWaitTime)
+	// Stop may leave the store to be closed in the background, which is waited for here.
+	dp.extentStore.Close()
+
+	// reload the partition from the source disk if it fails before the switch
+	switched := false
+	defer func() {
+		if err == nil || switched {
+			return
+		}
+		os.RemoveAll(tempDir)
+		if _, loadErr := LoadDataPartition(sourceDir, sourceDisk); loadErr != nil {
+			log.LogErrorf("action[MovePartitionToDisk] partition(%v) reload from %v err(%v).",
+				dp.partitionID, sourceDir, loadErr)
+		}
+	}()
+	if result.Files, result.Bytes, err = copyPartitionDir(sourceDir, tempDir); err != nil {
+		return
+	}
+	if err = syncDir(targetDisk.Path); err != nil {
+		return
+	}
+	if err = writeMoveTarget(movingDir, targetDisk.Path); err != nil {
+		os.Remove(movingDir + moveTargetSuffix)
+		return
+	}
+	if err = os.Rename(sourceDir, movingDir); err != nil {
+		os.Remove(movingDir + moveTargetSuffix)
+		return
+	}
+	if err = os.Rename(tempDir, targetDir); err != nil {
+		if restoreErr := os.Rename(movingDir, sourceDir); restoreErr != nil {
+			switched = true
+			log.LogErrorf("action[MovePartitionToDisk] partition(%v) restore %v err(%v), recover it by hand.",
+				dp.partitionID, movingDir, restoreErr)
+			return
+		}
+		os.Remove(movingDir + moveTargetSuffix)
+		return
+	}
+	switched = true
+	syncDir(sourceDisk.Path)
+	if err = syncDir(targetDisk.Path); err != nil {
+		log.LogErrorf("action[MovePartitionToDisk] partition(%v) sync disk(%v) err(%v).",
+			dp.partitionID, targetDisk.Path, err)
+		err = nil
+	}
+
+	sourceDisk.DetachDataPartition(dp)
+	if moved, err = LoadDataPartition(targetDir, targetDisk); err != nil {
+		log.LogErrorf("action[MovePartitionToDisk] partition(%v) load from %v err(%v), switch back to %v.",
+			dp.partitionID, targetDir, err, sourceDir)
+		if restoreErr := os.Rename(movingDir, sourceDir); restoreErr != nil {
+			log.LogErrorf("action[MovePartitionToDisk] partition(%v) restore %v err(%v), recover it by hand.",
+				dp.partitionID, movingDir, restoreErr)
+			return nil, nil, err
+		}
+		os.RemoveAll(targetDir)
+		os.Remove(movingDir + moveTargetSuffix)
+		syncDir(sourceDisk.Path)
+		if _, loadErr := LoadDataPartition(sourceDir, sourceDisk); loadErr != nil {
+			log.LogErrorf("action[MovePartitionToDisk] partition(%v) reload from %v err(%v).",
+				dp.partitionID, sourceDir, loadErr)
+		}
+		return nil, nil, err
+	}
+	if removeErr := os.RemoveAll(movingDir); removeErr != nil {
+		log.LogWarnf("action[MovePartitionToDisk] partition(%v) remove %v err(%v).", dp.partitionID, movingDir, removeErr)
+	} else {
+		os.Remove(movingDir + moveTargetSuffix)
+	}
+	result.Cost = int64(time.Since(start) / time.Millisecond)
+	moved.logEvent(EventPartitionMove, "from disk(%v) to disk(%v) files(%v) bytes(%v) cost(%vms)",
+		sourceDisk.Path, targetDisk.Path, result.Files, result.Bytes, result.Cost)
+	log.LogInfof("action[MovePartitionToDisk] partition(%v) moved from %v to %v, files(%v) bytes(%v) cost(%vms).",
+		dp.partitionID, sourceDir, targetDir, result.Files, result.Bytes, result.Cost)
+	return
+}
+
+// Name the target disk of the move next to the moving directory, before the source directory is renamed to it.
+func writeMoveTarget(movingDir, targetPath string) (err error) {
+	name := movingDir + moveTargetSuffix
+	if err = ioutil.WriteFile(name, []byte(targetPath), 0644); err != nil {
+		return
+	}
+	var file *os.File
+	if file, err = os.Open(name); err != nil {
+		return
+	}
+	err = file.Sync()
+	file.Close()
+	if err != nil {
+		return
+	}
+	return syncDir(path.Dir(movingDir))
+}
+
+// Recover the move of a partition left by a crash, found as the entry of the disk with the prefix of the move.
+// The copy on the target disk not switched yet is removed. The source directory is removed once the target disk
+// has the partition directory, which the switch renames the copy to last, or renamed back to the partition
+// directory otherwise. It returns the name of the partition directory to be loaded from the disk, if any.
+func (d *Disk) recoverMove(filename string) (partitionDir string) {
+	name := path.Join(d.Path, filename)
+	switch {
+	case strings.HasPrefix(filename, moveTempDirPrefix):
+		log.LogWarnf("action[recoverMove] remove the copy(%v) not switched on disk(%v).", filename, d.Path)
+		os.RemoveAll(name)
+		return
+	case strings.HasSuffix(filename, moveTargetSuffix):
+		if _, err := os.Stat(strings.TrimSuffix(name, moveTargetSuffix)); os.IsNotExist(err) {
+			os.Remove(name)
+		}
+		return
+	}
+	partitionDir = strings.TrimPrefix(filename, movingDirPrefix)
+	target, err := ioutil.ReadFile(name + moveTargetSuffix)
+	if err != nil {
+		log.LogErrorf("action[recoverMove] partition dir(%v) moved from disk(%v) to an unknown disk, err(%v), recover it by hand.",
+			partitionDir, d.Path, err)
+		return ""
+	}
+	if _, err = os.Stat(path.Join(string(target), partitionDir)); err == nil {
+		log.LogWarnf("action[recoverMove] partition dir(%v) moved from disk(%v) to disk(%v), remove the source.",
+			partitionDir, d.Path, string(target))
+		if err = os.RemoveAll(name); err == nil {
+			os.Remove(name + moveTargetSuffix)
+		}
+		return ""
+	} else if !os.IsNotExist(err) {
+		log.LogErrorf("action[recoverMove] partition dir(%v) moved from disk(%v) to disk(%v) not found, err(%v), recover it by hand.",
+			partitionDir, d.Path, string(target), err)
+		return ""
+	}
+	log.LogWarnf("action[recoverMove] partition dir(%v) not switched to disk(%v), restore it on disk(%v).",
+		partitionDir, string(target), d.Path)
+	if err = os.Rename(name, path.Join(d.Path, partitionDir)); err != nil {
+		log.LogErrorf("action[recoverMove] restore partition dir(%v) on disk(%v) err(%v), recover it by hand.",
+			partitionDir, d.Path, err)
+		return ""
+	}
+	os.Remove(name + moveTargetSuffix)
+	syncDir(d.Path)
+	return
+}
+
+// Wait for the repair of the partition to return after it is stopped, so no repair writes the extents being
+// copied.
+func (dp *DataPartition) waitRepairStopped(timeout time.Duration) {
+	dp.repairingLock.Lock()
+	stopped := waitCondTimeout(dp.repairingCond, timeout, func() bool { return !dp.IsRepairing() })
+	dp.repairingLock.Unlock()
+	if !stopped {
+		log.LogWarnf("action[waitRepairStopped] partition(%v) still repairing after %v.", dp.partitionID, timeout)
+	}
+}
+
+// Copy the directory of a partition recursively into dst, which must not exist. Every file is synced and read
+// back to be checked against the crc of the source.
+func copyPartitionDir(src, dst string) (files int, bytes int64, err error) {
+	if err = os.Mkdir(dst, 0755); err != nil {
+		return
+	}
+	var fileInfos []os.FileInfo
+	if fileInfos, err = ioutil.ReadDir(src); err != nil {
+		return
+	}
+	for _, fileInfo := range fileInfos {
+		srcPath, dstPath := path.Join(src, fileInfo.Name()), path.Join(dst, fileInfo.Name())
+		if fileInfo.IsDir() {
+			var n int
+			var size int64
+			if n, size, err = copyPartitionDir(srcPath, dstPath); err != nil {
+				return
+			}
+			files += n
+			bytes += size
+			continue
+		}
+		if !fileInfo.Mode().IsRegular() {
+			continue
+		}
+		var size int64
+		if size, err = copyFileVerified(srcPath, dstPath); err != nil {
+			return
+		}
+		files++
+		bytes += size
+	}
+	err = syncDir(dst)
+	return
+}
+
+// Copy the file into dst, which must not exist, and check the copy read back against the crc of the source.
+// Only the data ranges are copied, so the holes punched in the tiny extents by the deletes and the compaction
+// stay holes on the target disk, and the copy takes no more space than the source.
+func copyFileVerified(src, dst string) (size int64, err error) {
+	var srcFile, dstFile *os.File
+	if srcFile, err = os.Open(src); err != nil {
+		return
+	}
+	defer srcFile.Close()
+	if dstFile, err = os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666); err != nil {
+		return
+	}
+	defer dstFile.Close()
+	var info os.FileInfo
+	if info, err = srcFile.Stat(); err != nil {
+		return
+	}
+	size = info.Size()
+	hash := crc32.NewIEEE()
+	if err = copyDataRanges(dstFile, srcFile, size, hash); err != nil {
+		return
+	}
+	// the size covers the hole at the end of the file, if any
+	if err = dstFile.Truncate(size); err != nil {
+		return
+	}
+	if err = dstFile.Sync(); err != nil {
+		return
+	}
+	var crc uint32
+	if crc, err = fileCrc(dst); err != nil {
+		return
+	}
+	if crc != hash.Sum32() {
+		err = fmt.Errorf("copy of %v is corrupted, crc(%v) expected(%v)", src, crc, hash.Sum32())
+	}
+	return
+}
+
+// Copy the data ranges of src found by SEEK_DATA and SEEK_HOLE into dst at the same offsets, and hash the whole
+// content of src, the holes as zeros. The rest of the file is copied as data if the file system can not seek
+// the data.
+func copyDataRanges(dst, src *os.File, size int64, sum hash.Hash32) (err error) {
+	zeros := make([]byte, storage.PageSize)
+	for offset := int64(0); offset < size; {
+		dataOffset, holeOffset := offset, size
+		if dataOffset, err = src.Seek(offset, storage.SEEK_DATA); err != nil {
+			if isNoDataErr(err) {
+				dataOffset = size
+			} else {
+				dataOffset = offset
+			}
+		}
+		if dataOffset < size {
+			if holeOffset, err = src.Seek(dataOffset, storage.SEEK_HOLE); err != nil || holeOffset > size {
+				holeOffset = size
+			}
+		}
+		err = nil
+		for hole := dataOffset - offset; hole > 0; {
+			n := util.Min(int(hole), len(zeros))
+			sum.Write(zeros[:n])
+			hole -= int64(n)
+		}
+		if dataOffset >= size {
+			return
+		}
+		if _, err = dst.Seek(dataOffset, io.SeekStart); err != nil {
+			return
+		}
+		if _, err = io.Copy(io.MultiWriter(dst, sum), io.NewSectionReader(src, dataOffset, holeOffset-dataOffset)); err != nil {
+			return
+		}
+		offset = holeOffset
+	}
+	return
+}
+
+// SEEK_DATA fails with ENXIO beyond the last data of the file.
+func isNoDataErr(err error) bool {
+	return strings.Contains(err.Error(), syscall.ENXIO.Error())
+}
+
+func fileCrc(name string) (crc uint32, err error) {
+	var file *os.File
+	if file, err = os.Open(name); err != nil {
+		return
+	}
+	defer file.Close()
+	hash := crc32.NewIEEE()
+	if _, err = io.Copy(hash, file); err != nil {
+		return
+	}
+	return hash.Sum32(), nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestRecoverMove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recover_move")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source, target := &Disk{Path: path.Join(dir, "source")}, &Disk{Path: path.Join(dir, "target")}
+	mkdir := func(name string) {
+		if err := os.MkdirAll(name, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(name)
+		return err == nil
+	}
+	moving := func(partitionDir string) string {
+		movingDir := path.Join(source.Path, movingDirPrefix+partitionDir)
+		mkdir(movingDir)
+		if err := writeMoveTarget(movingDir, target.Path); err != nil {
+			t.Fatal(err)
+		}
+		return movingDir
+	}
+	mkdir(target.Path)
+
+	// the crash before the switch rolls back to the source disk, and the copy is removed
+	rollback := moving("datapartition_1_1000")
+	mkdir(path.Join(target.Path, moveTempDirPrefix+"1_100"))
+	if name := source.recoverMove(path.Base(rollback)); name != "datapartition_1_1000" {
+		t.Fatalf("restored partition dir(%v)", name)
+	}
+	if exists(rollback) || exists(rollback+moveTargetSuffix) || !exists(path.Join(source.Path, "datapartition_1_1000")) {
+		t.Fatal("partition dir not restored on the source disk")
+	}
+	if name := target.recoverMove(moveTempDirPrefix + "1_100"); name != "" || exists(path.Join(target.Path, moveTempDirPrefix+"1_100")) {
+		t.Fatalf("copy not switched is kept, name(%v)", name)
+	}
+
+	// the crash after the switch rolls forward to the target disk
+	forward := moving("datapartition_2_1000")
+	mkdir(path.Join(target.Path, "datapartition_2_1000"))
+	if name := source.recoverMove(path.Base(forward)); name != "" {
+		t.Fatalf("partition dir(%v) loaded from the source disk after the switch", name)
+	}
+	if exists(forward) || exists(forward+moveTargetSuffix) {
+		t.Fatal("source dir kept after the switch")
+	}
+
+	// the source dir without the target is kept for the operator, a target file left alone is removed
+	unknown := path.Join(source.Path, movingDirPrefix+"datapartition_3_1000")
+	mkdir(unknown)
+	if name := source.recoverMove(path.Base(unknown)); name != "" || !exists(unknown) {
+		t.Fatalf("source dir of an unknown target recovered, name(%v)", name)
+	}
+	left := path.Join(source.Path, movingDirPrefix+"datapartition_4_1000"+moveTargetSuffix)
+	if err = ioutil.WriteFile(left, []byte(target.Path), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if source.recoverMove(path.Base(left)); exists(left) {
+		t.Fatal("target file left alone is kept")
+	}
+}
+
+func TestCopyPartitionDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copy_partition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := path.Join(dir, "datapartition_1_128")
+	files := map[string][]byte{
+		"1025":                        bytes.Repeat([]byte("extent"), 100000),
+		DataPartitionMetadataFileName: []byte(`{"VolumeID":"vol"}`),
+		"wal_1/0000000000000001.log":  []byte("raft log"),
+		"empty":                       nil,
+	}
+	for name, data := range files {
+		os.MkdirAll(path.Dir(path.Join(src, name)), 0755)
+		if err = ioutil.WriteFile(path.Join(src, name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := path.Join(dir, moveTempDirPrefix+"1")
+	n, size, err := copyPartitionDir(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for name, data := range files {
+		total += int64(len(data))
+		copied, err := ioutil.ReadFile(path.Join(dst, name))
+		if err != nil || !bytes.Equal(copied, data) {
+			t.Fatalf("file(%v) copied err(%v)", name, err)
+		}
+	}
+	if n != len(files) || size != total {
+		t.Fatalf("copied files(%v) bytes(%v), expected(%v) (%v)", n, size, len(files), total)
+	}
+	if _, _, err = copyPartitionDir(src, dst); err == nil {
+		t.Fatalf("copied into an existing directory")
+	}
+}
+
+func TestCopyPartitionDirSparse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copy_partition_sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := path.Join(dir, "datapartition_1_128")
+	if err = os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// a tiny extent with the holes of the deleted data between and after the live data
+	name := strconv.FormatUint(storage.TinyExtentStartID, 10)
+	file, err := os.Create(path.Join(src, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("tiny"), 1024)
+	for _, offset := range []int64{0, 4 * util.MB, 8 * util.MB} {
+		if _, err = file.WriteAt(data, offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = file.Truncate(16 * util.MB); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	allocated := func(name string) int64 {
+		var stat syscall.Stat_t
+		if err := syscall.Stat(name, &stat); err != nil {
+			t.Fatal(err)
+		}
+		return stat.Blocks * 512
+	}
+	srcAllocated := allocated(path.Join(src, name))
+	if srcAllocated >= 4*util.MB {
+		t.Skipf("the file system allocated %v bytes for the holes", srcAllocated)
+	}
+
+	dst := path.Join(dir, moveTempDirPrefix+"1")
+	if _, size, err := copyPartitionDir(src, dst); err != nil || size != 16*util.MB {
+		t.Fatalf("copied bytes(%v) err(%v)", size, err)
+	}
+	if dstAllocated := allocated(path.Join(dst, name)); dstAllocated > srcAllocated {
+		t.Fatalf("copy allocated %v bytes, the source %v", dstAllocated, srcAllocated)
+	}
+	expected, _ := ioutil.ReadFile(path.Join(src, name))
+	if copied, err := ioutil.ReadFile(path.Join(dst, name)); err != nil || !bytes.Equal(copied, expected) {
+		t.Fatalf("sparse extent copied err(%v)", err)
+	}
+}
+
+func TestWaitRepairStopped(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	atomic.StoreInt32(&dp.isRepairing, 1)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		dp.endRepairing()
+	}()
+	start := time.Now()
+	dp.waitRepairStopped(10 * time.Second)
+	if cost := time.Since(start); cost > 5*time.Second || dp.IsRepairing() {
+		t.Fatalf("wait returned after %v, repairing(%v)", cost, dp.IsRepairing())
+	}
+	atomic.StoreInt32(&dp.isRepairing, 1)
+	dp.waitRepairStopped(20 * time.Millisecond)
+	if !dp.IsRepairing() {
+		t.Fatal("repair stopped without the repair returning")
+	}
+}
@@ -236,12 +236,14 @@ func (dp *DataPartition) ApplyRandomWrite(command []byte, raftApplyID uint64) (r
 	}
 	log.LogDebugf("[ApplyRandomWrite] ApplyID(%v) Partition(%v)_Extent(%v)_ExtentOffset(%v)_Size(%v)",
 		raftApplyID, dp.partitionID, opItem.extentID, opItem.offset, opItem.size)
+	isSync := dp.syncOnWrite(opItem.opcode == proto.OpSyncRandomWrite)
 	for i := 0; i < 20; i++ {
-		err = dp.ExtentStore().Write(opItem.extentID, opItem.offset, opItem.size, opItem.data, opItem.crc, storage.RandomWriteType, opItem.opcode == proto.OpSyncRandomWrite)
+		err = dp.ExtentStore().Write(opItem.extentID, opItem.offset, opItem.size, opItem.data, opItem.crc, storage.RandomWriteType, isSync)
 		if dp.checkIsDiskError(err) {
 			return
 		}
 		if err == nil {
+			dp.recordWrite(opItem.extentID, isSync)
 			break
 		}
 		log.LogErrorf("[ApplyRandomWrite] ApplyID(%v) Partition(%v)_Extent(%v)_ExtentOffset(%v)_Size(%v) apply err(%v) retry(%v)", raftApplyID, dp.partitionID, opItem.extentID, opItem.offset, opItem.size, err, i)
@@ -250,6 +252,28 @@ func (dp *DataPartition) ApplyRandomWrite(command []byte, raftApplyID uint64) (r
 	return
 }
 
+// The resize is kept in the frame of the random write, with the opcode of the resize and the new size as the offset.
+func isResizeRaftLog(raw []byte) bool {
+	return len(raw) > 4 && binary.BigEndian.Uint32(raw) == BinaryMarshalMagicVersion && raw[4] == proto.OpResizeDataPartition
+}
+
+// ApplyResize applies the resize of the partition. The failure of a replica is logged and answered
+// by the response, the log is applied anyway since it is never retried.
+func (dp *DataPartition) ApplyResize(command []byte, raftApplyID uint64) (resp interface{}) {
+	defer dp.uploadApplyID(raftApplyID)
+	opItem, err := UnmarshalRandWriteRaftLog(command)
+	if err == nil {
+		err = dp.applyResize(int(opItem.offset))
+	}
+	if err != nil {
+		err = fmt.Errorf("[ApplyResize] ApplyID(%v) Partition(%v) apply err(%v)", raftApplyID, dp.partitionID, err)
+		log.LogErrorf(err.Error())
+		exporter.Warning(err.Error())
+		return proto.OpArgMismatchErr
+	}
+	return proto.OpOk
+}
+
 // RandomWriteSubmit submits the proposal to raft.
 func (dp *DataPartition) RandomWriteSubmit(pkg *repl.Packet) (err error) {
 	val, err := MarshalRandWriteRaftLog(pkg.Opcode, pkg.ExtentID, pkg.ExtentOffset, int64(pkg.Size), pkg.Data, pkg.CRC)
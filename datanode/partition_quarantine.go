@@ -0,0 +1,185 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	QuarantineFileName     = "QUARANTINE"
+	TempQuarantineFileName = ".quarantine"
+
+	// the number of the consecutive repair failures after which an extent is quarantined
+	RepairFailuresToQuarantine = 5
+)
+
+// QuarantinedExtent records an extent excluded from the automatic repair after failing repeatedly.
+type QuarantinedExtent struct {
+	ExtentID       uint64 `json:"extentID"`
+	Failures       int    `json:"failures"`
+	Reason         string `json:"reason"`
+	QuarantineTime int64  `json:"quarantineTime"`
+}
+
+type extentQuarantine struct {
+	sync.Mutex
+	failures    map[uint64]int
+	quarantined map[uint64]*QuarantinedExtent
+}
+
+// Load the quarantined extents persisted in the partition directory.
+func (dp *DataPartition) loadQuarantine() (err error) {
+	q := &dp.quarantine
+	q.Lock()
+	defer q.Unlock()
+	q.failures = make(map[uint64]int)
+	q.quarantined = make(map[uint64]*QuarantinedExtent)
+	data, err := ioutil.ReadFile(path.Join(dp.Path(), QuarantineFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	extents := make([]*QuarantinedExtent, 0)
+	if err = json.Unmarshal(data, &extents); err != nil {
+		return
+	}
+	for _, extent := range extents {
+		q.quarantined[extent.ExtentID] = extent
+	}
+	return
+}
+
+// Persist the quarantined extents, the caller must hold the lock of the quarantine.
+func (dp *DataPartition) persistQuarantine() (err error) {
+	data, err := json.Marshal(dp.sortedQuarantinedExtents())
+	if err != nil {
+		return
+	}
+	return writeFileAtomically(dp.Path(), TempQuarantineFileName, QuarantineFileName, data)
+}
+
+func (dp *DataPartition) sortedQuarantinedExtents() (extents []*QuarantinedExtent) {
+	extents = make([]*QuarantinedExtent, 0, len(dp.quarantine.quarantined))
+	for _, extent := range dp.quarantine.quarantined {
+		extents = append(extents, extent)
+	}
+	sort.Slice(extents, func(i, j int) bool {
+		return extents[i].ExtentID < extents[j].ExtentID
+	})
+	return
+}
+
+// Count a failed repair of the extent, and quarantine the extent if it keeps failing.
+func (dp *DataPartition) recordRepairFailure(extentID uint64, reason error) {
+	q := &dp.quarantine
+	q.Lock()
+	defer q.Unlock()
+	if q.failures == nil {
+		q.failures = make(map[uint64]int)
+		q.quarantined = make(map[uint64]*QuarantinedExtent)
+	}
+	if _, ok := q.quarantined[extentID]; ok {
+		return
+	}
+	q.failures[extentID]++
+	if q.failures[extentID] < RepairFailuresToQuarantine {
+		return
+	}
+	dp.quarantineLocked(extentID, q.failures[extentID], reason)
+}
+
+// Quarantine the extent at once, such as the one the repair has found no source for too long.
+func (dp *DataPartition) quarantineExtent(extentID uint64, failures int, reason error) {
+	q := &dp.quarantine
+	q.Lock()
+	defer q.Unlock()
+	if q.failures == nil {
+		q.failures = make(map[uint64]int)
+		q.quarantined = make(map[uint64]*QuarantinedExtent)
+	}
+	if _, ok := q.quarantined[extentID]; ok {
+		return
+	}
+	dp.quarantineLocked(extentID, failures, reason)
+}
+
+// Quarantine the extent and persist the quarantine, the caller must hold the lock of the quarantine.
+func (dp *DataPartition) quarantineLocked(extentID uint64, failures int, reason error) {
+	q := &dp.quarantine
+	q.quarantined[extentID] = &QuarantinedExtent{
+		ExtentID:       extentID,
+		Failures:       failures,
+		Reason:         reason.Error(),
+		QuarantineTime: time.Now().Unix(),
+	}
+	delete(q.failures, extentID)
+	mesg := fmt.Sprintf("action[quarantineExtent] partition(%v) extent(%v) quarantined after %v repair failures on %v, last err(%v)",
+		dp.partitionID, extentID, failures, LocalIP, reason)
+	log.LogErrorf("%v", mesg)
+	exporter.Warning(mesg)
+	if err := dp.persistQuarantine(); err != nil {
+		log.LogErrorf("action[quarantineExtent] partition(%v) persist quarantine err(%v).", dp.partitionID, err)
+	}
+}
+
+// Reset the failure count of the extent after a successful repair.
+func (dp *DataPartition) recordRepairSuccess(extentID uint64) {
+	q := &dp.quarantine
+	q.Lock()
+	delete(q.failures, extentID)
+	q.Unlock()
+}
+
+// IsQuarantined tells if the extent is excluded from the automatic repair.
+func (dp *DataPartition) IsQuarantined(extentID uint64) (quarantined bool) {
+	q := &dp.quarantine
+	q.Lock()
+	_, quarantined = q.quarantined[extentID]
+	q.Unlock()
+	return
+}
+
+// QuarantinedExtents returns the extents excluded from the automatic repair, sorted by the extent id.
+func (dp *DataPartition) QuarantinedExtents() (extents []*QuarantinedExtent) {
+	dp.quarantine.Lock()
+	defer dp.quarantine.Unlock()
+	return dp.sortedQuarantinedExtents()
+}
+
+// ReleaseQuarantinedExtent lets the extent be repaired automatically again, after the operator fixes it.
+func (dp *DataPartition) ReleaseQuarantinedExtent(extentID uint64) (err error) {
+	q := &dp.quarantine
+	q.Lock()
+	defer q.Unlock()
+	if _, ok := q.quarantined[extentID]; !ok {
+		return fmt.Errorf("extent(%v) of partition(%v) is not quarantined", extentID, dp.partitionID)
+	}
+	delete(q.quarantined, extentID)
+	log.LogInfof("action[ReleaseQuarantinedExtent] partition(%v) extent(%v) released.", dp.partitionID, extentID)
+	return dp.persistQuarantine()
+}
@@ -24,6 +24,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
@@ -31,6 +32,7 @@ import (
 	"github.com/chubaofs/chubaofs/repl"
 	"github.com/chubaofs/chubaofs/util/config"
 	"github.com/chubaofs/chubaofs/util/errors"
+	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
 	raftproto "github.com/tiglabs/raft/proto"
 )
@@ -40,10 +42,22 @@ type dataPartitionCfg struct {
 	ClusterID     string              `json:"cluster_id"`
 	PartitionID   uint64              `json:"partition_id"`
 	PartitionSize int                 `json:"partition_size"`
+	LogicalSize   int                 `json:"-"` // the size set by ResizePartition, 0 if never resized
 	Peers         []proto.Peer        `json:"peers"`
 	Hosts         []string            `json:"hosts"`
 	NodeID        uint64              `json:"-"`
 	RaftStore     raftstore.RaftStore `json:"-"`
+
+	RepairConcurrency   int   `json:"-"` // number of extents to be recovered simultaneously, 0 means default
+	UsageUpdateInterval int64 `json:"-"` // seconds between two computations of the used space, 0 means default
+	LatencyWindow       int64 `json:"-"` // seconds of the window of the write latency histogram, 0 means default
+	StatusInterval      int64 `json:"-"` // seconds between two status updates, 0 means default
+	SnapshotInterval    int64 `json:"-"` // seconds between two snapshot reloads, 0 means default
+	TickerJitter        bool  `json:"-"` // delay the first tick by an offset derived from the partition id
+	LayoutExtents       bool  `json:"-"` // lay the extents out by ExtentShards before the store opens, or keep the layout found
+	ExtentShards        int   `json:"-"` // shard directories of the normal extents, 0 if flat
+	Encrypted           bool  `json:"-"` // the extents are sealed by the key of the volume
+	TinySize            int   `json:"-"` // size limit of the files written into the tiny extents, 0 means default
 }
 
 func (dp *DataPartition) raftPort() (heartbeat, replica int, err error) {
@@ -108,11 +122,148 @@ func (dp *DataPartition) StartRaft() (err error) {
 		WalPath: dp.path,
 	}
 
-	dp.raftPartition, err = dp.config.RaftStore.CreatePartition(pc)
+	if dp.raftPartition, err = dp.config.RaftStore.CreatePartition(pc); err == nil {
+		dp.raftReadiness.signal(nil)
+	}
 
 	return
 }
 
+// raftReadiness signals when the raft of the partition is started, which may happen after the partition is loaded.
+type raftReadiness struct {
+	sync.Mutex
+	readyC chan struct{}
+	ready  bool
+	err    error // the error if the raft fails to start
+}
+
+func (r *raftReadiness) channel() chan struct{} {
+	r.Lock()
+	defer r.Unlock()
+	if r.readyC == nil {
+		r.readyC = make(chan struct{})
+	}
+	return r.readyC
+}
+
+// Signal the result of the raft start, only the first one is kept.
+func (r *raftReadiness) signal(err error) {
+	readyC := r.channel()
+	r.Lock()
+	defer r.Unlock()
+	if r.ready {
+		return
+	}
+	r.ready = true
+	r.err = err
+	close(readyC)
+}
+
+func (r *raftReadiness) result() (err error) {
+	r.Lock()
+	defer r.Unlock()
+	return r.err
+}
+
+// Start the raft of a loaded partition in the background, so that the partitions start their raft concurrently.
+// The applied id is loaded before, and the partition turns unavailable if the raft fails to start.
+func (dp *DataPartition) startRaftOnLoad() {
+	err := dp.StartRaft()
+	if err != nil {
+		mesg := fmt.Sprintf("action[startRaftOnLoad] partition(%v) start raft on %v err(%v)", dp.partitionID, LocalIP, err)
+		log.LogErrorf("%v", mesg)
+		exporter.Warning(mesg)
+		oldStatus := dp.partitionStatus
+		dp.partitionStatus = proto.Unavailable
+		if oldStatus != dp.partitionStatus {
+			dp.notifyStatusChange(oldStatus, dp.partitionStatus)
+		}
+	}
+	dp.raftReadiness.signal(err)
+}
+
+// RaftReady returns a channel closed once the raft of the partition is started or fails to start.
+func (dp *DataPartition) RaftReady() <-chan struct{} {
+	return dp.raftReadiness.channel()
+}
+
+// WaitRaftReady waits until the raft of the partition is started, and returns the error if it fails to start.
+func (dp *DataPartition) WaitRaftReady(timeout time.Duration) (err error) {
+	select {
+	case <-dp.RaftReady():
+		return dp.raftReadiness.result()
+	case <-dp.stopC:
+		return fmt.Errorf("partition(%v) stopped before the raft started", dp.partitionID)
+	case <-time.After(timeout):
+		return fmt.Errorf("partition(%v) raft not started in %v", dp.partitionID, timeout)
+	}
+}
+
+// RaftProgress describes how far the state machine of the partition falls behind the raft log.
+type RaftProgress struct {
+	AppliedID      uint64 `json:"appliedID"`
+	CommittedID    uint64 `json:"committedID"`
+	Lag            uint64 `json:"lag"`
+	LastTruncateID uint64 `json:"lastTruncateID"`
+	MinAppliedID   uint64 `json:"minAppliedID"`
+	MaxAppliedID   uint64 `json:"maxAppliedID"`
+}
+
+// GetRaftProgress returns the raft progress of the partition, ok is false if the raft has not been started yet.
+func (dp *DataPartition) GetRaftProgress() (progress RaftProgress, ok bool) {
+	raftPartition := dp.raftPartition
+	if raftPartition == nil {
+		return
+	}
+	progress.AppliedID = dp.appliedID
+	progress.CommittedID = raftPartition.CommittedIndex()
+	if progress.CommittedID > progress.AppliedID {
+		progress.Lag = progress.CommittedID - progress.AppliedID
+	}
+	progress.LastTruncateID = dp.lastTruncateID
+	progress.MinAppliedID = dp.minAppliedID
+	progress.MaxAppliedID = dp.maxAppliedID
+	return progress, true
+}
+
+// RaftLeader describes the raft leader of the partition seen by the replica.
+type RaftLeader struct {
+	LeaderID   uint64 `json:"leaderID"`
+	LeaderAddr string `json:"leaderAddr"`
+	Term       uint64 `json:"term"`
+	IsLeader   bool   `json:"isLeader"`
+}
+
+// GetRaftLeader returns the raft leader and the term of the partition, ok is false if the raft has not been started yet.
+// The leader id is zero if the replica does not know the leader, e.g. during an election.
+func (dp *DataPartition) GetRaftLeader() (leader RaftLeader, ok bool) {
+	raftPartition := dp.raftPartition
+	if raftPartition == nil {
+		return
+	}
+	leader.LeaderID, leader.Term = raftPartition.LeaderTerm()
+	if leader.LeaderID == 0 {
+		return leader, true
+	}
+	leader.IsLeader = leader.LeaderID == dp.config.NodeID
+	for _, peer := range dp.config.Peers {
+		if peer.ID == leader.LeaderID {
+			leader.LeaderAddr = peer.Addr
+			break
+		}
+	}
+	return leader, true
+}
+
+// RaftStatus returns the raft status of the partition, nil if the raft has not been started yet.
+func (dp *DataPartition) RaftStatus() *raftstore.PartitionStatus {
+	raftPartition := dp.raftPartition
+	if raftPartition == nil {
+		return nil
+	}
+	return raftPartition.Status()
+}
+
 func (dp *DataPartition) stopRaft() {
 	if dp.raftPartition != nil {
 		log.LogErrorf("[FATAL] stop raft partition(%v)", dp.partitionID)
@@ -164,7 +315,8 @@ func (dp *DataPartition) CanRemoveRaftMember(peer proto.Peer) error {
 func (dp *DataPartition) StartRaftLoggingSchedule() {
 	getAppliedIDTimer := time.NewTimer(time.Second * 1)
 	truncateRaftLogTimer := time.NewTimer(time.Minute * 10)
-	storeAppliedIDTimer := time.NewTimer(time.Second * 10)
+	storeAppliedIDTimer := time.NewTimer(StoreAppliedIDInterval)
+	dp.applyIDPersistence.start()
 
 	log.LogDebugf("[startSchedule] hello DataPartition schedule")
 
@@ -200,12 +352,17 @@ func (dp *DataPartition) StartRaftLoggingSchedule() {
 			}
 			truncateRaftLogTimer.Reset(time.Minute)
 
+		case <-dp.storeC:
+			dp.drainStoreRequests()
+			if err := dp.persistAppliedID(); err != nil {
+				log.LogErrorf("[startSchedule]: %v", err)
+			}
+
 		case <-storeAppliedIDTimer.C:
-			if err := dp.storeAppliedID(dp.appliedID); err != nil {
-				err = errors.NewErrorf("[startSchedule]: dump partition=%d: %v", dp.config.PartitionID, err.Error())
-				log.LogErrorf(err.Error())
+			if err := dp.persistAppliedID(); err != nil {
+				log.LogErrorf("[startSchedule]: %v", err)
 			}
-			storeAppliedIDTimer.Reset(time.Second * 10)
+			storeAppliedIDTimer.Reset(StoreAppliedIDInterval)
 		}
 	}
 }
@@ -225,7 +382,7 @@ func (dp *DataPartition) StartRaftAfterRepair() {
 		select {
 		case <-timer.C:
 			err = nil
-			if dp.isLeader { // primary does not need to wait repair
+			if dp.isRepairLeader() { // primary does not need to wait repair
 				if err := dp.StartRaft(); err != nil {
 					log.LogErrorf("PartitionID(%v) leader start raft err(%v).", dp.partitionID, err)
 					timer.Reset(5 * time.Second)
@@ -371,7 +528,21 @@ func (dp *DataPartition) updateRaftNode(req *proto.DataPartitionDecommissionRequ
 	return
 }
 
+// Persist the current applied id into the APPLY file, and track the result of the persistence.
+func (dp *DataPartition) persistAppliedID() (err error) {
+	appliedID := dp.appliedID
+	if err = dp.storeAppliedID(appliedID); err != nil {
+		err = errors.NewErrorf("dump partition=%d: %v", dp.config.PartitionID, err.Error())
+		dp.applyIDPersistence.fail(err)
+		return
+	}
+	dp.applyIDPersistence.succeed(appliedID)
+	return
+}
+
 func (dp *DataPartition) storeAppliedID(applyIndex uint64) (err error) {
+	dp.persistLock.Lock()
+	defer dp.persistLock.Unlock()
 	filename := path.Join(dp.Path(), TempApplyIndexFile)
 	fp, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_TRUNC|os.O_CREATE, 0755)
 	if err != nil {
@@ -385,7 +556,10 @@ func (dp *DataPartition) storeAppliedID(applyIndex uint64) (err error) {
 		return
 	}
 	fp.Sync()
-	err = os.Rename(filename, path.Join(dp.Path(), ApplyIndexFile))
+	if err = os.Rename(filename, path.Join(dp.Path(), ApplyIndexFile)); err != nil {
+		return
+	}
+	dp.recordApplyCheckpoint(applyIndex, ApplyCheckpointPersist)
 	return
 }
 
@@ -413,6 +587,75 @@ func (dp *DataPartition) LoadAppliedID() (err error) {
 		err = errors.NewErrorf("[loadApplyID] ReadApplyID: %s", err.Error())
 		return
 	}
+	dp.applyIDPersistence.succeed(dp.appliedID)
+	dp.persistLock.Lock()
+	dp.recordApplyCheckpoint(dp.appliedID, ApplyCheckpointLoad)
+	dp.persistLock.Unlock()
+	return
+}
+
+// applyIDPersistence tracks whether the applied id keeps being persisted into the APPLY file.
+type applyIDPersistence struct {
+	sync.Mutex
+	persistedID uint64
+	persistTime int64 // last time the applied id is persisted
+	startTime   int64 // time the persistence schedule started
+	lastError   string
+}
+
+func (p *applyIDPersistence) start() {
+	p.Lock()
+	p.startTime = time.Now().Unix()
+	p.Unlock()
+}
+
+func (p *applyIDPersistence) succeed(appliedID uint64) {
+	p.Lock()
+	p.persistedID = appliedID
+	p.persistTime = time.Now().Unix()
+	p.lastError = ""
+	p.Unlock()
+}
+
+func (p *applyIDPersistence) fail(err error) {
+	p.Lock()
+	p.lastError = err.Error()
+	p.Unlock()
+}
+
+// ApplyIndexStatus describes how far the persisted applied id falls behind the one in the memory.
+type ApplyIndexStatus struct {
+	ID                 uint64 `json:"id"`
+	AppliedID          uint64 `json:"appliedID"`
+	PersistedAppliedID uint64 `json:"persistedAppliedID"`
+	Lag                uint64 `json:"lag"`
+	LastPersistTime    int64  `json:"lastPersistTime"`
+	LastError          string `json:"lastError"`
+	Stale              bool   `json:"stale"`
+}
+
+// GetApplyIndexStatus returns the status of the persistence of the applied id. The status is stale if the
+// applied id moves on but has not been persisted for ApplyIDPersistStaleAfter, which means the APPLY file
+// is failing to be written, and the partition would replay more raft log than expected after a restart.
+func (dp *DataPartition) GetApplyIndexStatus() (status *ApplyIndexStatus) {
+	p := &dp.applyIDPersistence
+	p.Lock()
+	defer p.Unlock()
+	status = &ApplyIndexStatus{
+		ID:                 dp.partitionID,
+		AppliedID:          dp.appliedID,
+		PersistedAppliedID: p.persistedID,
+		LastPersistTime:    p.persistTime,
+		LastError:          p.lastError,
+	}
+	if status.AppliedID > status.PersistedAppliedID {
+		status.Lag = status.AppliedID - status.PersistedAppliedID
+	}
+	since := p.persistTime
+	if p.startTime > since {
+		since = p.startTime
+	}
+	status.Stale = status.Lag > 0 && since > 0 && time.Now().Unix()-since > int64(ApplyIDPersistStaleAfter/time.Second)
 	return
 }
 
@@ -635,9 +878,9 @@ func (dp *DataPartition) getLeaderMaxExtentIDAndPartitionSize() (maxExtentID, Pa
 }
 
 func (dp *DataPartition) broadcastMinAppliedID(minAppliedID uint64) (err error) {
-	for i := 0; i < dp.getReplicaLen(); i++ {
+	for _, replica := range dp.Replicas() {
 		p := NewPacketToBroadcastMinAppliedID(dp.partitionID, minAppliedID)
-		replicaHostParts := strings.Split(dp.getReplicaAddr(i), ":")
+		replicaHostParts := strings.Split(replica, ":")
 		replicaHost := strings.TrimSpace(replicaHostParts[0])
 		if LocalIP == replicaHost {
 			log.LogDebugf("partition(%v) local no send msg. localIP(%v) replicaHost(%v) appliedId(%v)",
@@ -645,7 +888,7 @@ func (dp *DataPartition) broadcastMinAppliedID(minAppliedID uint64) (err error)
 			dp.minAppliedID = minAppliedID
 			continue
 		}
-		target := dp.getReplicaAddr(i)
+		target := replica
 		var conn *net.TCPConn
 		conn, err = gConnPool.GetConnect(target)
 		if err != nil {
@@ -670,10 +913,11 @@ func (dp *DataPartition) broadcastMinAppliedID(minAppliedID uint64) (err error)
 
 // Get all replica applied ids
 func (dp *DataPartition) getAllReplicaAppliedID() (allAppliedID []uint64, replyNum uint8) {
-	allAppliedID = make([]uint64, dp.getReplicaLen())
-	for i := 0; i < dp.getReplicaLen(); i++ {
+	replicas := dp.Replicas()
+	allAppliedID = make([]uint64, len(replicas))
+	for i, replica := range replicas {
 		p := NewPacketToGetAppliedID(dp.partitionID)
-		replicaHostParts := strings.Split(dp.getReplicaAddr(i), ":")
+		replicaHostParts := strings.Split(replica, ":")
 		replicaHost := strings.TrimSpace(replicaHostParts[0])
 		if LocalIP == replicaHost {
 			log.LogDebugf("partition(%v) local no send msg. localIP(%v) replicaHost(%v) appliedId(%v)",
@@ -682,7 +926,7 @@ func (dp *DataPartition) getAllReplicaAppliedID() (allAppliedID []uint64, replyN
 			replyNum++
 			continue
 		}
-		target := dp.getReplicaAddr(i)
+		target := replica
 		appliedID, err := dp.getRemoteAppliedID(target, p)
 		if err != nil {
 			log.LogErrorf("partition(%v) getRemoteAppliedID Failed(%v).", dp.partitionID, err)
@@ -0,0 +1,52 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	raftProto "github.com/tiglabs/raft/proto"
+)
+
+func TestRaftNotStarted(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	if status := dp.RaftStatus(); status != nil {
+		t.Fatalf("raft status(%v) of the partition without the raft", status)
+	}
+	if _, err := dp.ChangeRaftMember(raftProto.ConfAddNode, raftProto.Peer{ID: 2}, nil); err == nil {
+		t.Fatal("member of the partition without the raft changed")
+	}
+	if _, _, err := dp.leaderTransferState(); err == nil {
+		t.Fatal("leadership of the partition without the raft transferable")
+	}
+}
+
+func TestWaitRaftReady(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(nil))
+	if err := dp.WaitRaftReady(10 * time.Millisecond); err == nil {
+		t.Fatal("raft ready before started")
+	}
+	startErr := errors.New("raft store closed")
+	go dp.raftReadiness.signal(startErr)
+	if err := dp.WaitRaftReady(time.Second); err != startErr {
+		t.Fatalf("unexpected raft start error: %v", err)
+	}
+	dp.raftReadiness.signal(nil)
+	if err := dp.WaitRaftReady(time.Second); err != startErr {
+		t.Fatalf("raft start result overwritten: %v", err)
+	}
+}
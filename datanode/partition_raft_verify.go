@@ -0,0 +1,110 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// The verdicts of the raft state verification.
+const (
+	RaftStateConsistent   = "consistent"
+	RaftStateInconsistent = "inconsistent"
+)
+
+// RaftState is the raft state of a partition cross-checked by VerifyRaftState, with the problems found.
+type RaftState struct {
+	PersistedAppliedID uint64   `json:"persistedAppliedID"` // in the APPLY file
+	AppliedID          uint64   `json:"appliedID"`          // applied by the partition
+	RaftAppliedID      uint64   `json:"raftAppliedID"`      // applied seen by the raft
+	CommittedID        uint64   `json:"committedID"`
+	LastIndex          uint64   `json:"lastIndex"`
+	LastTruncateID     uint64   `json:"lastTruncateID"` // the raft logs up to it are truncated
+	Verdict            string   `json:"verdict"`
+	Problems           []string `json:"problems"`
+}
+
+// VerifyRaftState cross-checks the applied ids of the partition against the raft log and the truncate point,
+// and reports the gaps and the regressions among them. It only reads the state, ok is false if the raft has
+// not been started yet.
+func (dp *DataPartition) VerifyRaftState() (state *RaftState, ok bool, err error) {
+	raftPartition := dp.raftPartition
+	if raftPartition == nil {
+		return
+	}
+	state = &RaftState{
+		AppliedID:      dp.appliedID,
+		RaftAppliedID:  raftPartition.AppliedIndex(),
+		CommittedID:    raftPartition.CommittedIndex(),
+		LastTruncateID: dp.lastTruncateID,
+	}
+	if status := raftPartition.Status(); status != nil {
+		state.LastIndex = status.Index
+	}
+	if state.PersistedAppliedID, err = dp.readPersistedAppliedID(); err != nil {
+		return nil, true, err
+	}
+	state.Problems = checkRaftState(state)
+	state.Verdict = RaftStateConsistent
+	if len(state.Problems) > 0 {
+		state.Verdict = RaftStateInconsistent
+	}
+	return state, true, nil
+}
+
+// The applied ids are checked against the point a restart applies the logs from, which is the larger one of the
+// persisted applied id and the truncate id, since the logs up to the truncate id are applied by all the replicas
+// and a restart behind it is caught up by a snapshot.
+func checkRaftState(state *RaftState) (problems []string) {
+	problems = make([]string, 0)
+	restartID := state.PersistedAppliedID
+	if state.LastTruncateID > restartID {
+		restartID = state.LastTruncateID
+	}
+	if restartID > state.AppliedID {
+		problems = append(problems, fmt.Sprintf("applied id(%v) regressed below the restart point(%v), "+
+			"max of the persisted applied id(%v) and the truncate id(%v)",
+			state.AppliedID, restartID, state.PersistedAppliedID, state.LastTruncateID))
+	}
+	if state.AppliedID > state.CommittedID {
+		problems = append(problems, fmt.Sprintf("applied id(%v) is ahead of the committed id(%v)",
+			state.AppliedID, state.CommittedID))
+	}
+	if state.CommittedID > state.LastIndex {
+		problems = append(problems, fmt.Sprintf("committed id(%v) is ahead of the last raft log(%v)",
+			state.CommittedID, state.LastIndex))
+	}
+	return
+}
+
+// Read the applied id persisted in the APPLY file without loading it, zero if it is not persisted yet.
+func (dp *DataPartition) readPersistedAppliedID() (appliedID uint64, err error) {
+	dp.persistLock.Lock()
+	data, err := ioutil.ReadFile(path.Join(dp.Path(), ApplyIndexFile))
+	dp.persistLock.Unlock()
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return
+	}
+	if _, err = fmt.Sscanf(string(data), "%d", &appliedID); err != nil {
+		err = fmt.Errorf("parse %v: %v", ApplyIndexFile, err)
+	}
+	return
+}
@@ -0,0 +1,40 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+)
+
+func TestCheckRaftState(t *testing.T) {
+	cases := []struct {
+		state    RaftState
+		problems int
+	}{
+		{state: RaftState{PersistedAppliedID: 90, AppliedID: 100, CommittedID: 100, LastIndex: 105, LastTruncateID: 80}},
+		{state: RaftState{PersistedAppliedID: 120, AppliedID: 100, CommittedID: 100, LastIndex: 105, LastTruncateID: 80}, problems: 1},
+		{state: RaftState{PersistedAppliedID: 90, AppliedID: 110, CommittedID: 100, LastIndex: 105, LastTruncateID: 80}, problems: 1},
+		{state: RaftState{PersistedAppliedID: 90, AppliedID: 100, CommittedID: 100, LastIndex: 95, LastTruncateID: 80}, problems: 1},
+		// a restart applies from the truncate id beyond the persisted applied id
+		{state: RaftState{PersistedAppliedID: 90, AppliedID: 100, CommittedID: 100, LastIndex: 105, LastTruncateID: 95}},
+		{state: RaftState{PersistedAppliedID: 90, AppliedID: 100, CommittedID: 100, LastIndex: 105, LastTruncateID: 101}, problems: 1},
+		{state: RaftState{PersistedAppliedID: 120, AppliedID: 100, CommittedID: 100, LastIndex: 105, LastTruncateID: 110}, problems: 1},
+	}
+	for i, c := range cases {
+		if problems := checkRaftState(&c.state); len(problems) != c.problems {
+			t.Fatalf("case %v: problems %v, expected %v of them", i, problems, c.problems)
+		}
+	}
+}
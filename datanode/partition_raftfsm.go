@@ -31,6 +31,10 @@ import (
 
 // Apply puts the data onto the disk.
 func (dp *DataPartition) Apply(command []byte, index uint64) (resp interface{}, err error) {
+	if isResizeRaftLog(command) {
+		resp = dp.ApplyResize(command, index)
+		return
+	}
 	resp, err = dp.ApplyRandomWrite(command, index)
 	return
 }
@@ -38,8 +42,13 @@ func (dp *DataPartition) Apply(command []byte, index uint64) (resp interface{},
 // ApplyMemberChange supports adding new raft member or deleting an existing raft member.
 // It does not support updating an existing member at this point.
 func (dp *DataPartition) ApplyMemberChange(confChange *raftproto.ConfChange, index uint64) (resp interface{}, err error) {
+	var persist bool
 	defer func(index uint64) {
 		dp.uploadApplyID(index)
+		// persist the applied id of the change at once, not to apply it again on a restart
+		if persist {
+			dp.notifyStoreAppliedID(index)
+		}
 	}(index)
 
 	req := &proto.DataPartitionDecommissionRequest{}
@@ -64,11 +73,15 @@ func (dp *DataPartition) ApplyMemberChange(confChange *raftproto.ConfChange, ind
 		return
 	}
 	if isUpdated {
+		dp.logEvent(EventMembershipChange, "type(%v) add(%v) remove(%v) index(%v) peers(%v)",
+			confChange.Type, req.AddPeer, req.RemovePeer, index, dp.config.Peers)
+		dp.invalidateReplicaCache()
 		dp.DataPartitionCreateType = proto.NormalCreateDataPartition
 		if err = dp.PersistMetadata(); err != nil {
 			log.LogErrorf("action[ApplyMemberChange] dp(%v) PersistMetadata err(%v).", dp.partitionID, err)
 			return
 		}
+		persist = true
 	}
 	return
 }
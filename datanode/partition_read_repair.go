@@ -0,0 +1,204 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/repl"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The read repairs run in the background, in the slots shared by all the partitions of the node.
+const (
+	DefaultReadRepairSlots = 4
+)
+
+// readRepairer keeps the extents of the partition queued for the read repair, so an extent is repaired once
+// however many reads hit it.
+type readRepairer struct {
+	sync.Mutex
+	pending map[uint64]bool
+}
+
+// QueueReadRepair queues the repair of a normal extent found to be shorter than a client read asks for, from the
+// replica holding the largest size. The read fails anyway, the client retries it on another replica. The repair
+// starts in the background only if a read repair slot of the node is free, or the extent is left to the next read
+// or the repair cycle. The extents already queued and the tiny extents are not queued again.
+func (dp *DataPartition) QueueReadRepair(extentID uint64) (queued bool) {
+	if storage.IsTinyExtent(extentID) || dp.disk == nil || dp.disk.space == nil {
+		return false
+	}
+	slots := dp.disk.space.readRepairSlots
+	r := &dp.readRepairer
+	r.Lock()
+	if r.pending[extentID] {
+		r.Unlock()
+		return false
+	}
+	select {
+	case slots <- struct{}{}:
+	default:
+		r.Unlock()
+		return false
+	}
+	if r.pending == nil {
+		r.pending = make(map[uint64]bool)
+	}
+	r.pending[extentID] = true
+	r.Unlock()
+
+	go func() {
+		defer func() {
+			r.Lock()
+			delete(r.pending, extentID)
+			r.Unlock()
+			<-slots
+		}()
+		if err := dp.ReadRepairExtent(extentID); err != nil {
+			log.LogWarnf("action[QueueReadRepair] partition(%v) extent(%v) read repair err(%v).",
+				dp.partitionID, extentID, err)
+		}
+	}()
+	return true
+}
+
+// ReadRepairExtent repairs a normal extent shorter than a replica of it. The tiny extents are left to the repair
+// cycles.
+func (dp *DataPartition) ReadRepairExtent(extentID uint64) (err error) {
+	if storage.IsTinyExtent(extentID) {
+		return fmt.Errorf("tiny extent(%v) is not read repaired", extentID)
+	}
+	return dp.readRepairExtent(extentID)
+}
+
+func (dp *DataPartition) readRepairExtent(extentID uint64) (err error) {
+	if dp.partitionStatus == proto.Unavailable || dp.IsDraining() {
+		return fmt.Errorf("partition(%v) is not available for repair", dp.partitionID)
+	}
+	if dp.IsQuarantined(extentID) {
+		return fmt.Errorf("extent(%v) of partition(%v) is quarantined", extentID, dp.partitionID)
+	}
+	if !dp.tryAddInflightExtent(extentID) {
+		return fmt.Errorf("extent(%v) of partition(%v) is being repaired", extentID, dp.partitionID)
+	}
+	defer dp.removeInflightExtent(extentID)
+	localExtentInfo, err := dp.extentStore.Watermark(extentID)
+	if err != nil {
+		return
+	}
+	remoteExtentInfo, err := dp.largestRemoteExtent(extentID)
+	if err != nil {
+		return
+	}
+	if remoteExtentInfo == nil || remoteExtentInfo.Size <= localExtentInfo.Size {
+		return fmt.Errorf("no replica of extent(%v) of partition(%v) is larger than the local size(%v)",
+			extentID, dp.partitionID, localExtentInfo.Size)
+	}
+	ctx, cancel := dp.newRepairContext(context.Background())
+	defer cancel()
+	if _, err = dp.streamRepairExtent(ctx, remoteExtentInfo); err != nil {
+		if !isRepairCanceled(err) {
+			dp.recordRepairFailure(extentID, err)
+		}
+		return
+	}
+	dp.recordRepairSuccess(extentID)
+	dp.metrics.recordReadRepair()
+	log.LogWarnf("action[ReadRepairExtent] partition(%v) extent(%v) repaired from size(%v) to size(%v) by %v.",
+		dp.partitionID, extentID, localExtentInfo.Size, remoteExtentInfo.Size, remoteExtentInfo.Source)
+	return
+}
+
+// Find the extent with the largest size on the other replicas.
+func (dp *DataPartition) largestRemoteExtent(extentID uint64) (largest *storage.ExtentInfo, err error) {
+	var lastErr error
+	for _, addr := range dp.Replicas() {
+		if isLocalAddr(addr) {
+			continue
+		}
+		extentInfo, getErr := dp.getRemoteExtentWatermark(extentID, addr)
+		if getErr != nil {
+			lastErr = getErr
+			continue
+		}
+		if extentInfo != nil && (largest == nil || extentInfo.Size > largest.Size) {
+			largest = extentInfo
+			largest.Source = addr
+		}
+	}
+	if largest == nil && lastErr != nil {
+		err = lastErr
+	}
+	return
+}
+
+// Get the watermark of a normal extent on the replica, nil if the replica has no such extent to repair from.
+// The extent is listed in the data of the request, so the replica returns its watermark alone. The replicas
+// before the list was added ignore it and return the watermarks of all the normal extents, which are filtered
+// here.
+func (dp *DataPartition) getRemoteExtentWatermark(extentID uint64, target string) (extentInfo *storage.ExtentInfo, err error) {
+	p := repl.NewPacketToGetAllWatermarks(dp.partitionID, proto.NormalExtentType)
+	if p.Data, err = json.Marshal([]uint64{extentID}); err != nil {
+		return
+	}
+	p.Size = uint32(len(p.Data))
+	var conn *net.TCPConn
+	if conn, err = gConnPool.GetConnect(target); err != nil {
+		return
+	}
+	defer gConnPool.PutConnect(conn, true)
+	if err = p.WriteToConn(conn); err != nil {
+		return
+	}
+	reply := new(repl.Packet)
+	if err = reply.ReadFromConn(conn, proto.GetAllWatermarksDeadLineTime); err != nil {
+		return
+	}
+	if reply.ResultCode != proto.OpOk {
+		return nil, fmt.Errorf("get watermark of extent(%v) from %v: %v", extentID, target, string(reply.Data[:reply.Size]))
+	}
+	extents := make([]*storage.ExtentInfo, 0)
+	if err = json.Unmarshal(reply.Data[:reply.Size], &extents); err != nil {
+		return
+	}
+	for _, ei := range extents {
+		if ei.FileID == extentID && !ei.IsDeleted {
+			return ei, nil
+		}
+	}
+	return
+}
+
+// Get the watermarks of the listed normal extents, with the same filter as the repair of the normal extents.
+func normalExtentWatermarks(store ExtentStorer, extentIDs []uint64) (extents []*storage.ExtentInfo) {
+	filter := storage.NormalExtentFilter()
+	extents = make([]*storage.ExtentInfo, 0, len(extentIDs))
+	for _, extentID := range extentIDs {
+		if storage.IsTinyExtent(extentID) {
+			continue
+		}
+		if ei, err := store.Watermark(extentID); err == nil && filter(ei) {
+			extents = append(extents, ei)
+		}
+	}
+	return
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestReadRepairExtentSkipped(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{1025: 4096}))
+	if err := dp.ReadRepairExtent(storage.TinyExtentStartID); err == nil {
+		t.Fatal("tiny extent read repaired")
+	}
+	dp.addInflightExtent(1025)
+	if err := dp.ReadRepairExtent(1025); err == nil {
+		t.Fatal("extent being repaired read repaired again")
+	}
+	if !dp.isInflightExtent(1025) {
+		t.Fatal("extent being repaired dropped by the read repair refused")
+	}
+	// the read repair holds the extent in flight until it returns
+	dp.removeInflightExtent(1025)
+	if err := dp.ReadRepairExtent(1025); err == nil || dp.isInflightExtent(1025) {
+		t.Fatalf("read repair without a larger replica err(%v) inflight(%v)", err, dp.isInflightExtent(1025))
+	}
+	if count := dp.metrics.ReadRepairs(); count != 0 {
+		t.Fatalf("unexpected read repairs(%v)", count)
+	}
+
+	// the read repairs are queued within the slots of the node, once for an extent
+	slots := make(chan struct{}, 1)
+	dp.disk = &Disk{space: &SpaceManager{readRepairSlots: slots}}
+	if dp.QueueReadRepair(storage.TinyExtentStartID) {
+		t.Fatal("tiny extent queued for read repair")
+	}
+	slots <- struct{}{}
+	if dp.QueueReadRepair(1025) {
+		t.Fatal("read repair queued without a free slot")
+	}
+	<-slots
+	dp.readRepairer.pending = map[uint64]bool{1025: true}
+	if dp.QueueReadRepair(1025) || len(slots) != 0 {
+		t.Fatal("extent queued for read repair twice")
+	}
+
+	// the watermark of a single extent is looked up for the read repair
+	extents := normalExtentWatermarks(dp.extentStore, []uint64{1025, storage.TinyExtentStartID})
+	if len(extents) != 1 || extents[0].FileID != 1025 || extents[0].Size != 4096 {
+		t.Fatalf("watermarks(%v) of the listed extents", extents)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// RebuildMetadata writes a fresh metadata for the partition under the given directory, after the META and the
+// META.bak are lost. The partition id and the size are taken from the directory name, and the volume and the
+// peers have to be given, e.g. by the master. The hosts are the addresses of the peers if not given.
+// A valid metadata is only overwritten with force. The metadata is written the same way as PersistMetadata,
+// and the states only kept in the metadata, like the frozen or the manual read-only one, start over. The
+// encryption is found from the extent store, which keeps the fingerprint of its key.
+func RebuildMetadata(dir, volumeID string, peers []proto.Peer, hosts []string, force bool) (md *DataPartitionMetadata, err error) {
+	partitionID, partitionSize, err := unmarshalPartitionName(path.Base(dir))
+	if err != nil {
+		return
+	}
+	var fileInfo os.FileInfo
+	if fileInfo, err = os.Stat(dir); err != nil {
+		return
+	}
+	if !fileInfo.IsDir() {
+		return nil, fmt.Errorf("%v is not a directory", dir)
+	}
+	// the metadata of a newer version is valid to the data node which wrote it
+	if _, metaErr := readMetadataFile(path.Join(dir, DataPartitionMetadataFileName)); (metaErr == nil || IsMetadataVersionError(metaErr)) && !force {
+		return nil, ErrMetadataExists
+	}
+	if len(hosts) == 0 {
+		for _, peer := range peers {
+			hosts = append(hosts, peer.Addr)
+		}
+	}
+	var encrypted bool
+	if encrypted, err = storage.IsEncryptedExtentStore(dir); err != nil {
+		return
+	}
+	sp := make(sortedPeers, len(peers))
+	copy(sp, peers)
+	sort.Sort(sp)
+	md = &DataPartitionMetadata{
+		Version:       DataPartitionMetadataVersion,
+		VolumeID:      strings.TrimSpace(volumeID),
+		PartitionID:   partitionID,
+		PartitionSize: partitionSize,
+		CreateTime:    time.Now().Format(TimeLayout),
+		Peers:         sp,
+		Hosts:         hosts,
+		Encrypted:     encrypted,
+	}
+	if err = md.Validate(); err != nil {
+		return
+	}
+	var metaData []byte
+	if md.Checksum, err = md.ComputeChecksum(); err != nil {
+		return
+	}
+	if metaData, err = json.Marshal(md); err != nil {
+		return
+	}
+	if err = writeFileAtomically(dir, TempMetadataFileName, DataPartitionMetadataFileName, metaData); err != nil {
+		return
+	}
+	if err = writeFileAtomically(dir, TempMetadataBackupFileName, MetadataBackupFileName, metaData); err != nil {
+		return
+	}
+	log.LogWarnf("action[RebuildMetadata] dir(%v) rebuilt metadata(%v) force(%v).", dir, string(metaData), force)
+	return
+}
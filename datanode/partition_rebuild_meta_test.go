@@ -0,0 +1,69 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestRebuildMetadata(t *testing.T) {
+	disk, err := ioutil.TempDir("", "rebuild_metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(disk)
+	dir := path.Join(disk, DataPartitionPrefix+"_12_1024")
+	if err = os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = RebuildMetadata(dir, "vol", nil, nil, false); err == nil {
+		t.Fatalf("metadata rebuilt without peers")
+	}
+	peers := []proto.Peer{testPeers[1], testPeers[0]}
+	if _, err = RebuildMetadata(dir, "vol", peers, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := loadMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.VolumeID != "vol" || meta.PartitionID != 12 || meta.PartitionSize != 1024 || meta.Peers[0].ID != 1 ||
+		len(meta.Hosts) != 2 || meta.Hosts[0] != testPeers[1].Addr {
+		t.Fatalf("unexpected rebuilt metadata(%+v)", meta)
+	}
+	if backup, err := readMetadataFile(path.Join(dir, MetadataBackupFileName)); err != nil || backup.Checksum != meta.Checksum {
+		t.Fatalf("backup(%+v) err(%v) of the rebuilt metadata", backup, err)
+	}
+
+	// a valid metadata is only overwritten with force
+	if _, err = RebuildMetadata(dir, "other", peers, nil, false); err != ErrMetadataExists {
+		t.Fatalf("valid metadata overwritten without force, err(%v)", err)
+	}
+	if _, err = RebuildMetadata(dir, "other", peers, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err = loadMetadata(dir); err != nil || meta.VolumeID != "other" {
+		t.Fatalf("metadata(%+v) err(%v) after forced rebuild", meta, err)
+	}
+	if peers, err = proto.ParsePeers("1:192.168.0.11:17310, 2:192.168.0.12:17310"); err != nil || len(peers) != 2 ||
+		peers[1].ID != 2 || peers[1].Addr != "192.168.0.12:17310" {
+		t.Fatalf("parsed peers(%v) err(%v)", peers, err)
+	}
+}
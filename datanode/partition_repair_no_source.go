@@ -0,0 +1,186 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// An extent whose repair source can not be reached is retried by the next repair cycles, and it is handled by
+// the policy once the cycles without a source reach noSourceCycles:
+//
+//   - retry: the extent keeps being retried, only logged at the info level.
+//   - escalate: an alert is raised once for the extent, and it keeps being retried.
+//   - pending: the extent is quarantined as unrecoverable until the operator releases it.
+const (
+	NoSourcePolicyRetry    = "retry"
+	NoSourcePolicyEscalate = "escalate"
+	NoSourcePolicyPending  = "pending"
+
+	DefaultNoSourceCycles = 10
+)
+
+// RepairSourceUnavailableError is the error of the repair of an extent whose source replica can not be reached,
+// unlike the failures of the repair with the source, which count toward the quarantine.
+type RepairSourceUnavailableError struct {
+	Source string
+	Err    error
+}
+
+func (e *RepairSourceUnavailableError) Error() string {
+	return fmt.Sprintf("repair source(%v) unavailable: %v", e.Source, e.Err)
+}
+
+// IsRepairSourceUnavailableError tells if the error is the one of an unreachable repair source.
+func IsRepairSourceUnavailableError(err error) bool {
+	_, ok := err.(*RepairSourceUnavailableError)
+	return ok
+}
+
+// NoSourceExtent is an extent of the partition whose repair found no source available in the latest cycles.
+type NoSourceExtent struct {
+	ExtentID  uint64 `json:"extentID"`
+	Source    string `json:"source"`
+	Cycles    int    `json:"cycles"`
+	FirstTime int64  `json:"firstTime"`
+	LastTime  int64  `json:"lastTime"`
+	LastErr   string `json:"lastErr"`
+	Escalated bool   `json:"escalated"`
+}
+
+type noSourceExtents struct {
+	sync.Mutex
+	extents map[uint64]*NoSourceExtent
+}
+
+func isValidNoSourcePolicy(policy string) bool {
+	return policy == NoSourcePolicyRetry || policy == NoSourcePolicyEscalate || policy == NoSourcePolicyPending
+}
+
+func (manager *SpaceManager) SetNoSourcePolicy(policy string, cycles int) {
+	manager.noSourcePolicy = policy
+	manager.noSourceCycles = cycles
+}
+
+// GetNoSourcePolicy returns the policy of the extents without a repair source, and the cycles it applies after.
+func (manager *SpaceManager) GetNoSourcePolicy() (policy string, cycles int) {
+	if policy = manager.noSourcePolicy; policy == "" {
+		policy = NoSourcePolicyRetry
+	}
+	if cycles = manager.noSourceCycles; cycles <= 0 {
+		cycles = DefaultNoSourceCycles
+	}
+	return
+}
+
+func (dp *DataPartition) noSourcePolicy() (policy string, cycles int) {
+	if dp.disk != nil && dp.disk.space != nil {
+		return dp.disk.space.GetNoSourcePolicy()
+	}
+	return NoSourcePolicyRetry, DefaultNoSourceCycles
+}
+
+// Count a repair cycle of the extent without a source, and apply the policy once the cycles reach the limit.
+func (dp *DataPartition) recordNoSource(extentID uint64, source string, reason error) {
+	policy, cycles := dp.noSourcePolicy()
+	n := &dp.noSource
+	n.Lock()
+	if n.extents == nil {
+		n.extents = make(map[uint64]*NoSourceExtent)
+	}
+	now := time.Now().Unix()
+	extent, ok := n.extents[extentID]
+	if !ok {
+		extent = &NoSourceExtent{ExtentID: extentID, FirstTime: now}
+		n.extents[extentID] = extent
+	}
+	extent.Source, extent.LastTime, extent.LastErr = source, now, reason.Error()
+	extent.Cycles++
+	escalate := policy == NoSourcePolicyEscalate && extent.Cycles >= cycles && !extent.Escalated
+	if escalate {
+		extent.Escalated = true
+	}
+	pending := policy == NoSourcePolicyPending && extent.Cycles >= cycles
+	if pending {
+		delete(n.extents, extentID)
+	}
+	n.Unlock()
+
+	switch {
+	case escalate:
+		mesg := fmt.Sprintf("action[recordNoSource] partition(%v) extent(%v) has had no repair source for %v cycles on %v, last err(%v)",
+			dp.partitionID, extentID, extent.Cycles, LocalIP, reason)
+		log.LogErrorf("%v", mesg)
+		exporter.Warning(mesg)
+	case pending:
+		dp.quarantineExtent(extentID, extent.Cycles,
+			fmt.Errorf("unrecoverable pending, no repair source for %v cycles: %v", extent.Cycles, reason))
+	default:
+		log.LogInfof("action[recordNoSource] partition(%v) extent(%v) no repair source for %v cycles, err(%v).",
+			dp.partitionID, extentID, extent.Cycles, reason)
+	}
+}
+
+// Forget the extent once it is repaired, or no longer to be repaired.
+func (dp *DataPartition) clearNoSource(extentID uint64) {
+	n := &dp.noSource
+	n.Lock()
+	delete(n.extents, extentID)
+	n.Unlock()
+}
+
+// Forget the extents of the type not to be repaired by the latest cycle, which have been repaired in other ways,
+// such as from the new leader.
+func (dp *DataPartition) pruneNoSource(isTiny bool, toBeRepaired map[uint64]bool) {
+	n := &dp.noSource
+	n.Lock()
+	defer n.Unlock()
+	for extentID := range n.extents {
+		if storage.IsTinyExtent(extentID) == isTiny && !toBeRepaired[extentID] {
+			delete(n.extents, extentID)
+		}
+	}
+}
+
+// NoSourceExtents returns the extents stuck without a repair source, sorted by the extent id.
+func (dp *DataPartition) NoSourceExtents() (extents []*NoSourceExtent) {
+	n := &dp.noSource
+	n.Lock()
+	defer n.Unlock()
+	extents = make([]*NoSourceExtent, 0, len(n.extents))
+	for _, extent := range n.extents {
+		e := *extent
+		extents = append(extents, &e)
+	}
+	sort.Slice(extents, func(i, j int) bool {
+		return extents[i].ExtentID < extents[j].ExtentID
+	})
+	return
+}
+
+// NoSourceExtentCount returns the number of the extents stuck without a repair source.
+func (dp *DataPartition) NoSourceExtentCount() int {
+	n := &dp.noSource
+	n.Lock()
+	defer n.Unlock()
+	return len(n.extents)
+}
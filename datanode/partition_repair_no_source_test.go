@@ -0,0 +1,84 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNoSourcePolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "no_source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dp := newMockPartition(newMockExtentStore(nil))
+	dp.path = dir
+	space := &SpaceManager{}
+	dp.disk = &Disk{space: space}
+	unavailable := &RepairSourceUnavailableError{Source: "192.168.0.12:17310", Err: errors.New("connection refused")}
+	if !IsRepairSourceUnavailableError(unavailable) || IsRepairSourceUnavailableError(errors.New("crc mismatch")) {
+		t.Fatalf("source unavailable error not told from the others")
+	}
+
+	// the default policy keeps retrying, the extents stuck are counted until they are repaired
+	space.SetNoSourcePolicy("", 2)
+	for i := 0; i < 3; i++ {
+		dp.recordNoSource(1025, unavailable.Source, unavailable)
+	}
+	dp.recordNoSource(1026, unavailable.Source, unavailable)
+	extents := dp.NoSourceExtents()
+	if len(extents) != 2 || extents[0].ExtentID != 1025 || extents[0].Cycles != 3 || extents[0].Escalated ||
+		dp.IsQuarantined(1025) {
+		t.Fatalf("unexpected extents(%+v) without source by the retry policy", extents)
+	}
+	dp.clearNoSource(1026)
+	if dp.NoSourceExtentCount() != 1 {
+		t.Fatalf("repaired extent still counted without source")
+	}
+
+	// escalate once after the cycles, and keep the extent to be retried
+	space.SetNoSourcePolicy(NoSourcePolicyEscalate, 2)
+	dp.recordNoSource(1027, unavailable.Source, unavailable)
+	if extents = dp.NoSourceExtents(); extents[1].Escalated {
+		t.Fatalf("extent(%+v) escalated before the cycles", extents[1])
+	}
+	dp.recordNoSource(1027, unavailable.Source, unavailable)
+	if extents = dp.NoSourceExtents(); !extents[1].Escalated || dp.IsQuarantined(1027) {
+		t.Fatalf("extent(%+v) not escalated after the cycles", extents[1])
+	}
+
+	// pending quarantines the extent, which is released by the operator as the others
+	space.SetNoSourcePolicy(NoSourcePolicyPending, 2)
+	dp.recordNoSource(1025, unavailable.Source, unavailable)
+	if !dp.IsQuarantined(1025) || dp.NoSourceExtentCount() != 1 {
+		t.Fatalf("extent not quarantined as unrecoverable pending, stuck(%v)", dp.NoSourceExtents())
+	}
+	if quarantined := dp.QuarantinedExtents(); len(quarantined) != 1 ||
+		!strings.Contains(quarantined[0].Reason, "no repair source") {
+		t.Fatalf("unexpected quarantined extents(%+v)", quarantined)
+	}
+
+	// the extents no longer to be repaired are forgotten, the ones of the other type are kept
+	dp.recordNoSource(1, unavailable.Source, unavailable)
+	dp.pruneNoSource(false, map[uint64]bool{})
+	if extents = dp.NoSourceExtents(); len(extents) != 1 || extents[0].ExtentID != 1 {
+		t.Fatalf("unexpected extents(%+v) after the prune", extents)
+	}
+}
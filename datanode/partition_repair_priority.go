@@ -0,0 +1,248 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The repair priority of a partition follows its volume. The partitions of the higher priorities take the repair
+// slots of the node first, and a repair pays more of the shared repair bandwidth per byte while the repairs of
+// the higher priorities are running, so the latency-sensitive volumes recover first after a failure.
+const (
+	RepairPriorityLow = iota
+	RepairPriorityNormal
+	RepairPriorityHigh
+)
+
+var repairPriorityNames = []string{"low", "normal", "high"}
+
+// RepairPriorityName returns the name of the repair priority in the config.
+func RepairPriorityName(priority int) string {
+	if priority < 0 || priority >= len(repairPriorityNames) {
+		return fmt.Sprintf("unknown(%v)", priority)
+	}
+	return repairPriorityNames[priority]
+}
+
+func parseRepairPriority(name string) (priority int, ok bool) {
+	for i, n := range repairPriorityNames {
+		if n == name {
+			return i, true
+		}
+	}
+	return
+}
+
+// Parse the repair priority of the volumes in the format VOLUME:PRIORITY.
+func parseVolRepairPriority(values []interface{}) (priorities map[string]int, err error) {
+	priorities = make(map[string]int, len(values))
+	for _, value := range values {
+		str, _ := value.(string)
+		arr := strings.Split(str, ":")
+		if len(arr) != 2 || arr[0] == "" {
+			return nil, fmt.Errorf("Err:%v invalid (%v), expected VOLUME:PRIORITY", ConfigKeyVolRepairPriority, value)
+		}
+		priority, ok := parseRepairPriority(arr[1])
+		if !ok {
+			return nil, fmt.Errorf("Err:%v of volume(%v) must be one of %v", ConfigKeyVolRepairPriority,
+				arr[0], strings.Join(repairPriorityNames, ", "))
+		}
+		priorities[arr[0]] = priority
+	}
+	return
+}
+
+// RepairOrderEntry describes a partition running or waiting for a repair slot of the node.
+type RepairOrderEntry struct {
+	PartitionID uint64 `json:"partitionID"`
+	VolName     string `json:"volName"`
+	Priority    string `json:"priority"`
+	Since       int64  `json:"since"` // when the partition began to run or to wait
+}
+
+// RepairOrder lists the partitions repairing now and the ones waiting, in the order they take the slots.
+type RepairOrder struct {
+	Slots   int                 `json:"slots"` // partitions repaired at once, 0 means unlimited
+	Running []*RepairOrderEntry `json:"running"`
+	Waiting []*RepairOrderEntry `json:"waiting"`
+}
+
+type repairTicket struct {
+	partitionID uint64
+	volName     string
+	priority    int
+	since       time.Time
+	ready       chan struct{} // closed once the ticket takes a slot
+}
+
+// repairScheduler orders the repairs of the partitions of the node by the priority, the earlier waiting first
+// within the same priority.
+type repairScheduler struct {
+	sync.Mutex
+	slots   int
+	running map[uint64]*repairTicket
+	waiting []*repairTicket
+}
+
+func (s *repairScheduler) setSlots(slots int) {
+	s.Lock()
+	s.slots = slots
+	s.dispatch()
+	s.Unlock()
+}
+
+// Wait for a repair slot of the node until the stop channel is closed, and return the ticket to release the
+// slot with, or nil if stopped.
+func (s *repairScheduler) acquire(partitionID uint64, volName string, priority int, stopC chan bool) *repairTicket {
+	t := &repairTicket{partitionID: partitionID, volName: volName, priority: priority, since: time.Now(),
+		ready: make(chan struct{})}
+	s.Lock()
+	i := sort.Search(len(s.waiting), func(i int) bool {
+		return s.waiting[i].priority < priority
+	})
+	s.waiting = append(s.waiting, nil)
+	copy(s.waiting[i+1:], s.waiting[i:])
+	s.waiting[i] = t
+	s.dispatch()
+	s.Unlock()
+	select {
+	case <-t.ready:
+		return t
+	case <-stopC:
+	}
+	s.Lock()
+	defer s.Unlock()
+	for i, w := range s.waiting {
+		if w == t {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			return nil
+		}
+	}
+	// the slot is taken in the meantime
+	s.releaseLocked(t)
+	return nil
+}
+
+func (s *repairScheduler) release(t *repairTicket) {
+	s.Lock()
+	s.releaseLocked(t)
+	s.Unlock()
+}
+
+func (s *repairScheduler) releaseLocked(t *repairTicket) {
+	if s.running[t.partitionID] == t {
+		delete(s.running, t.partitionID)
+	}
+	s.dispatch()
+}
+
+// Hand the free slots to the waiting tickets in the order. It must be called with the lock held.
+func (s *repairScheduler) dispatch() {
+	for len(s.waiting) > 0 && (s.slots <= 0 || len(s.running) < s.slots) {
+		t := s.waiting[0]
+		s.waiting = s.waiting[1:]
+		if s.running == nil {
+			s.running = make(map[uint64]*repairTicket)
+		}
+		t.since = time.Now()
+		s.running[t.partitionID] = t
+		close(t.ready)
+	}
+}
+
+// The factor of the bandwidth a repair of the priority is charged per byte, doubled for every priority between
+// it and the highest one running.
+func (s *repairScheduler) bandwidthFactor(priority int) int {
+	s.Lock()
+	defer s.Unlock()
+	highest := priority
+	for _, t := range s.running {
+		if t.priority > highest {
+			highest = t.priority
+		}
+	}
+	return 1 << uint(highest-priority)
+}
+
+func (s *repairScheduler) order() (order *RepairOrder) {
+	s.Lock()
+	defer s.Unlock()
+	order = &RepairOrder{Slots: s.slots, Running: make([]*RepairOrderEntry, 0, len(s.running)),
+		Waiting: make([]*RepairOrderEntry, 0, len(s.waiting))}
+	for _, t := range s.running {
+		order.Running = append(order.Running, t.entry())
+	}
+	sort.Slice(order.Running, func(i, j int) bool {
+		return order.Running[i].Since < order.Running[j].Since
+	})
+	for _, t := range s.waiting {
+		order.Waiting = append(order.Waiting, t.entry())
+	}
+	return
+}
+
+func (t *repairTicket) entry() *RepairOrderEntry {
+	return &RepairOrderEntry{
+		PartitionID: t.partitionID,
+		VolName:     t.volName,
+		Priority:    RepairPriorityName(t.priority),
+		Since:       t.since.Unix(),
+	}
+}
+
+func (manager *SpaceManager) SetRepairPriority(slots int, volPriorities map[string]int) {
+	manager.volRepairPriority = volPriorities
+	manager.repairScheduler.setSlots(slots)
+}
+
+// GetRepairPriority returns the repair priority of the partitions of the volume, normal if not configured.
+func (manager *SpaceManager) GetRepairPriority(volName string) int {
+	if priority, ok := manager.volRepairPriority[volName]; ok {
+		return priority
+	}
+	return RepairPriorityNormal
+}
+
+// RepairOrder returns the partitions repairing and waiting for the repair slots of the node.
+func (manager *SpaceManager) RepairOrder() *RepairOrder {
+	return manager.repairScheduler.order()
+}
+
+// RepairPriority returns the effective repair priority of the partition by its volume.
+func (dp *DataPartition) RepairPriority() int {
+	if dp.disk == nil || dp.disk.space == nil {
+		return RepairPriorityNormal
+	}
+	return dp.disk.space.GetRepairPriority(dp.volumeID)
+}
+
+// Wait for a repair slot of the node by the priority of the partition. It returns false if the partition is
+// stopped in the meantime.
+func (dp *DataPartition) acquireRepairSlot() (release func(), ok bool) {
+	if dp.disk == nil || dp.disk.space == nil {
+		return func() {}, true
+	}
+	scheduler := &dp.disk.space.repairScheduler
+	ticket := scheduler.acquire(dp.partitionID, dp.volumeID, dp.RepairPriority(), dp.stopC)
+	if ticket == nil {
+		return nil, false
+	}
+	return func() { scheduler.release(ticket) }, true
+}
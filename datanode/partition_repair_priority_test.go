@@ -0,0 +1,140 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+func TestRepairPriority(t *testing.T) {
+	if _, err := parseVolRepairPriority([]interface{}{"vol1:high", "vol2:low"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []interface{}{"vol1", ":high", "vol1:urgent", 1} {
+		if _, err := parseVolRepairPriority([]interface{}{value}); err == nil {
+			t.Errorf("parseVolRepairPriority(%v) expect an error", value)
+		}
+	}
+	space := &SpaceManager{}
+	space.SetRepairPriority(1, map[string]int{"vol1": RepairPriorityHigh})
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	dp.volumeID = "vol1"
+	if dp.RepairPriority() != RepairPriorityNormal {
+		t.Fatalf("priority(%v) of a partition without a disk is not normal", dp.RepairPriority())
+	}
+	dp.disk = &Disk{space: space}
+	if dp.RepairPriority() != RepairPriorityHigh || space.GetRepairPriority("vol2") != RepairPriorityNormal {
+		t.Fatalf("unexpected priorities(%v, %v)", dp.RepairPriority(), space.GetRepairPriority("vol2"))
+	}
+
+	s := &space.repairScheduler
+	stopC := make(chan bool)
+	first := s.acquire(1, "vol2", RepairPriorityNormal, stopC)
+	if first == nil {
+		t.Fatalf("the free slot is not taken")
+	}
+	granted := make(chan uint64, 3)
+	isWaiting := func(partitionID uint64) bool {
+		for _, e := range s.order().Waiting {
+			if e.PartitionID == partitionID {
+				return true
+			}
+		}
+		return false
+	}
+	waitFor := func(partitionID uint64, priority int) {
+		go func() {
+			ticket := s.acquire(partitionID, "vol", priority, stopC)
+			granted <- partitionID
+			s.release(ticket)
+		}()
+		for deadline := time.Now().Add(time.Second); !isWaiting(partitionID); time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("partition(%v) is not waiting", partitionID)
+			}
+		}
+	}
+	waitFor(2, RepairPriorityLow)
+	waitFor(3, RepairPriorityHigh)
+	waitFor(4, RepairPriorityNormal)
+	order := s.order()
+	if len(order.Running) != 1 || len(order.Waiting) != 3 || order.Waiting[0].PartitionID != 3 ||
+		order.Waiting[1].PartitionID != 4 || order.Waiting[2].PartitionID != 2 || order.Waiting[0].Priority != "high" {
+		t.Fatalf("unexpected repair order(%+v)", order)
+	}
+	if factor := s.bandwidthFactor(RepairPriorityLow); factor != 2 {
+		t.Fatalf("factor(%v) of a low priority repair while a normal one is running", factor)
+	}
+	s.release(first)
+	for _, expect := range []uint64{3, 4, 2} {
+		if actual := <-granted; actual != expect {
+			t.Fatalf("partition(%v) is repaired before (%v)", actual, expect)
+		}
+	}
+
+	// a partition stopped while waiting leaves the queue
+	blocker := s.acquire(5, "vol1", RepairPriorityHigh, stopC)
+	if factor := s.bandwidthFactor(RepairPriorityLow); factor != 4 {
+		t.Fatalf("factor(%v) of a low priority repair while a high one is running", factor)
+	}
+	close(stopC)
+	if ticket := s.acquire(6, "vol2", RepairPriorityLow, stopC); ticket != nil {
+		t.Fatalf("partition stopped while waiting takes the slot")
+	}
+	s.release(blocker)
+	if order = s.order(); len(order.Running) != 0 || len(order.Waiting) != 0 {
+		t.Fatalf("unexpected repair order(%+v) after the repairs", order)
+	}
+}
+
+func TestLaunchRepairWaitsForSlot(t *testing.T) {
+	space := &SpaceManager{}
+	space.SetRepairPriority(1, nil)
+	blocker := space.repairScheduler.acquire(2, "vol", RepairPriorityNormal, make(chan bool))
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	dp.volumeID = "vol"
+	dp.disk = &Disk{space: space}
+	dp.stopC = make(chan bool)
+	dp.isLeader = true
+	dp.intervalToUpdateReplicas = time.Now().Unix()
+
+	// the scheduled cycle waits in the background, without the partition marked repairing
+	dp.launchRepairAsync(proto.NormalExtentType)
+	dp.launchRepairAsync(proto.TinyExtentType)
+	for deadline := time.Now().Add(time.Second); len(space.RepairOrder().Waiting) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the scheduled repair is not waiting for the slot")
+		}
+	}
+	if order := space.RepairOrder(); len(order.Waiting) != 1 || dp.IsRepairing() {
+		t.Fatalf("repair order(%+v) repairing(%v) while waiting for the slot", order, dp.IsRepairing())
+	}
+
+	// the cycle waiting gives up once the partition stops
+	close(dp.stopC)
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&dp.repairLaunching) != 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the scheduled repair still waits after the stop")
+		}
+	}
+	space.repairScheduler.release(blocker)
+	if order := space.RepairOrder(); len(order.Running) != 0 || len(order.Waiting) != 0 {
+		t.Fatalf("unexpected repair order(%+v) after the stop", order)
+	}
+}
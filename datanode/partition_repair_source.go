@@ -0,0 +1,82 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sync"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// RepairSourceCandidate is a replica an extent can be repaired from, as it has the extent in the size the
+// extent is repaired to.
+type RepairSourceCandidate struct {
+	Addr     string
+	IsLeader bool
+}
+
+// SourceSelector chooses the replica an extent is repaired from on the target replica. The candidates are
+// never empty, and the first one is the source chosen by default. The topology of the replicas, such as the
+// racks, is up to the selector to resolve by their addresses, and a source out of the candidates falls back
+// to the default one.
+type SourceSelector interface {
+	SelectSource(partitionID, extentID uint64, target string, candidates []*RepairSourceCandidate) (source string)
+}
+
+type repairSource struct {
+	sync.RWMutex
+	selector SourceSelector
+}
+
+// RegisterSourceSelector registers the selector to choose the sources of the extents repaired by the partition
+// as the leader. A nil selector restores the default, which is the first replica seen with the largest size.
+func (dp *DataPartition) RegisterSourceSelector(selector SourceSelector) {
+	dp.repairSource.Lock()
+	dp.repairSource.selector = selector
+	dp.repairSource.Unlock()
+}
+
+// Choose the source of the extent to be repaired on the target replica among the replicas having it in the
+// size of maxFileInfo. It is the source of maxFileInfo unless a selector chooses another one.
+func (dp *DataPartition) selectRepairSource(repairTasks []*DataPartitionRepairTask, target int, extentID uint64,
+	maxFileInfo *storage.ExtentInfo) (source string) {
+	dp.repairSource.RLock()
+	selector := dp.repairSource.selector
+	dp.repairSource.RUnlock()
+	if selector == nil {
+		return maxFileInfo.Source
+	}
+	candidates := []*RepairSourceCandidate{{Addr: maxFileInfo.Source, IsLeader: maxFileInfo.Source == repairTasks[0].addr}}
+	for index, repairTask := range repairTasks {
+		if repairTask == nil || index == target || repairTask.addr == maxFileInfo.Source {
+			continue
+		}
+		extentInfo, ok := repairTask.extents[extentID]
+		if !ok || extentInfo.IsDeleted || extentInfo.Size < maxFileInfo.Size {
+			continue
+		}
+		candidates = append(candidates, &RepairSourceCandidate{Addr: repairTask.addr, IsLeader: index == 0})
+	}
+	source = selector.SelectSource(dp.partitionID, extentID, repairTasks[target].addr, candidates)
+	for _, candidate := range candidates {
+		if candidate.Addr == source {
+			return
+		}
+	}
+	log.LogWarnf("action[selectRepairSource] partition(%v) extent(%v) source(%v) selected for(%v) is not a candidate, "+
+		"use(%v) instead.", dp.partitionID, extentID, source, repairTasks[target].addr, maxFileInfo.Source)
+	return maxFileInfo.Source
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+type sameRackSelector struct {
+	racks map[string]string
+}
+
+func (s *sameRackSelector) SelectSource(partitionID, extentID uint64, target string,
+	candidates []*RepairSourceCandidate) string {
+	for _, candidate := range candidates {
+		if s.racks[candidate.Addr] == s.racks[target] {
+			return candidate.Addr
+		}
+	}
+	return candidates[0].Addr
+}
+
+func TestSelectRepairSource(t *testing.T) {
+	addrs := []string{"10.0.0.1:17310", "10.0.1.1:17310", "10.0.1.2:17310"}
+	buildTasks := func() []*DataPartitionRepairTask {
+		sizes := [][]uint64{{1000, 1000}, {1000, 0}, {500, 0}}
+		repairTasks := make([]*DataPartitionRepairTask, len(addrs))
+		for index, addr := range addrs {
+			extents := []*storage.ExtentInfo{{FileID: 1025, Size: sizes[index][0]}}
+			if sizes[index][1] > 0 {
+				extents = append(extents, &storage.ExtentInfo{FileID: 1026, Size: sizes[index][1]})
+			}
+			repairTasks[index] = NewDataPartitionRepairTask(extents, 0, addr, addrs[0])
+			repairTasks[index].addr = addr
+		}
+		return repairTasks
+	}
+	sources := func(dp *DataPartition) map[uint64]string {
+		repairTasks := buildTasks()
+		maxSizeExtents := map[uint64]*storage.ExtentInfo{1025: repairTasks[0].extents[1025], 1026: repairTasks[0].extents[1026]}
+		dp.buildExtentCreationTasks(repairTasks, maxSizeExtents)
+		dp.buildExtentRepairTasks(repairTasks, maxSizeExtents)
+		result := make(map[uint64]string)
+		for _, extent := range repairTasks[2].ExtentsToBeRepaired {
+			result[extent.FileID] = extent.Source
+		}
+		return result
+	}
+
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	if result := sources(dp); result[1025] != addrs[0] || result[1026] != addrs[0] {
+		t.Fatalf("default sources %v, expected the leader", result)
+	}
+	dp.RegisterSourceSelector(&sameRackSelector{racks: map[string]string{
+		addrs[0]: "rack0", addrs[1]: "rack1", addrs[2]: "rack1",
+	}})
+	result := sources(dp)
+	if result[1025] != addrs[1] {
+		t.Fatalf("extent 1025 repaired from %v, expected the same rack replica %v", result[1025], addrs[1])
+	}
+	if result[1026] != addrs[0] {
+		t.Fatalf("extent 1026 repaired from %v, expected the only replica having it %v", result[1026], addrs[0])
+	}
+	dp.RegisterSourceSelector(nil)
+	if result = sources(dp); result[1025] != addrs[0] {
+		t.Fatalf("sources %v after the selector removed, expected the leader", result)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// PartitionRepairStatus describes whether a partition needs repair, as found by its latest repair cycles.
+type PartitionRepairStatus struct {
+	ID                      uint64 `json:"id"`
+	VolName                 string `json:"volName"`
+	IsLeader                bool   `json:"isLeader"`
+	Repairing               bool   `json:"repairing"`
+	BrokenTinyExtents       int    `json:"brokenTinyExtents"`
+	MismatchedNormalExtents int    `json:"mismatchedNormalExtents"`
+	MismatchedTinyExtents   int    `json:"mismatchedTinyExtents"`
+	PendingExtents          int    `json:"pendingExtents"` // extents to be repaired on the replicas in the latest cycles
+	QueuedExtents           int64  `json:"queuedExtents"`  // extents waiting to be repaired locally
+	LastCheckTime           int64  `json:"lastCheckTime"`
+}
+
+// repairCycleResult keeps the extents found to be mismatched by the latest repair cycle of each extent type,
+// since the cycles of the tiny and the normal extents alternate.
+type repairCycleResult struct {
+	sync.Mutex
+	mismatched    [2]int // indexed by the extent type
+	pending       [2]int
+	lastCheckTime int64
+}
+
+// Record the extents mismatched among the replicas, missing on a replica or with a size mismatched, found by
+// a repair cycle of the leader.
+func (dp *DataPartition) recordRepairCycle(extentType uint8, repairTasks []*DataPartitionRepairTask) {
+	if extentType != proto.TinyExtentType && extentType != proto.NormalExtentType {
+		return
+	}
+	mismatched := make(map[uint64]bool)
+	var pending int
+	for _, task := range repairTasks {
+		if task == nil {
+			continue
+		}
+		for _, extentInfo := range task.ExtentsToBeCreated {
+			mismatched[extentInfo.FileID] = true
+		}
+		for _, extentInfo := range task.ExtentsToBeRepaired {
+			mismatched[extentInfo.FileID] = true
+		}
+		pending += len(task.ExtentsToBeCreated) + len(task.ExtentsToBeRepaired)
+	}
+	r := &dp.repairCycleResult
+	r.Lock()
+	r.mismatched[extentType] = len(mismatched)
+	r.pending[extentType] = pending
+	r.lastCheckTime = time.Now().Unix()
+	r.Unlock()
+}
+
+// GetRepairStatus returns whether the partition needs repair.
+func (dp *DataPartition) GetRepairStatus() (status *PartitionRepairStatus) {
+	r := &dp.repairCycleResult
+	r.Lock()
+	status = &PartitionRepairStatus{
+		ID:                      dp.partitionID,
+		VolName:                 dp.volumeID,
+		IsLeader:                dp.isRepairLeader(),
+		Repairing:               dp.IsRepairing(),
+		BrokenTinyExtents:       dp.extentStore.BrokenTinyExtentCnt(),
+		MismatchedNormalExtents: r.mismatched[proto.NormalExtentType],
+		MismatchedTinyExtents:   r.mismatched[proto.TinyExtentType],
+		PendingExtents:          r.pending[proto.NormalExtentType] + r.pending[proto.TinyExtentType],
+		QueuedExtents:           dp.metrics.RepairQueueDepth(),
+		LastCheckTime:           r.lastCheckTime,
+	}
+	r.Unlock()
+	return
+}
+
+// NeedRepair tells if the partition has broken tiny extents or extents mismatched among the replicas.
+func (status *PartitionRepairStatus) NeedRepair() bool {
+	return status.BrokenTinyExtents > 0 || status.MismatchedNormalExtents > 0 || status.MismatchedTinyExtents > 0 ||
+		status.QueuedExtents > 0
+}
@@ -0,0 +1,45 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestGetRepairStatus(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(nil))
+	if dp.GetRepairStatus().NeedRepair() {
+		t.Fatal("partition needs repair before any repair cycle")
+	}
+	extent := &storage.ExtentInfo{FileID: 1025, Size: 4096}
+	tasks := []*DataPartitionRepairTask{
+		{ExtentsToBeRepaired: []*storage.ExtentInfo{extent}},
+		nil,
+		{ExtentsToBeRepaired: []*storage.ExtentInfo{extent, {FileID: 1026}}},
+		{ExtentsToBeCreated: []*storage.ExtentInfo{{FileID: 1027}}, ExtentsToBeRepaired: []*storage.ExtentInfo{}},
+	}
+	dp.recordRepairCycle(proto.NormalExtentType, tasks)
+	status := dp.GetRepairStatus()
+	if !status.NeedRepair() || status.MismatchedNormalExtents != 3 || status.PendingExtents != 4 {
+		t.Fatalf("unexpected repair status(%+v)", status)
+	}
+	dp.recordRepairCycle(proto.NormalExtentType, tasks[1:2])
+	if status = dp.GetRepairStatus(); status.NeedRepair() {
+		t.Fatalf("partition still needs repair after a clean cycle: %+v", status)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sync"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// repairVerifier keeps the normal extents whose repaired data failed the verification, with the offsets
+// the failed repairs started from. Their watermarks are reported as these offsets in the next repair,
+// so the range is repaired again, overwriting the bad data.
+type repairVerifier struct {
+	sync.Mutex
+	unverified map[uint64]uint64
+}
+
+// Return the offset the repair of the extent starts from, which is the local size unless the last repair
+// of the extent failed the verification.
+func (dp *DataPartition) repairStartOffset(extentID, localSize uint64) uint64 {
+	v := &dp.repairVerifier
+	v.Lock()
+	defer v.Unlock()
+	if offset, ok := v.unverified[extentID]; ok && offset < localSize {
+		return offset
+	}
+	return localSize
+}
+
+func (dp *DataPartition) markUnverified(extentID, offset uint64) {
+	v := &dp.repairVerifier
+	v.Lock()
+	defer v.Unlock()
+	if v.unverified == nil {
+		v.unverified = make(map[uint64]uint64)
+	}
+	if old, ok := v.unverified[extentID]; ok && old < offset {
+		offset = old
+	}
+	v.unverified[extentID] = offset
+}
+
+func (dp *DataPartition) clearUnverified(extentID uint64) {
+	v := &dp.repairVerifier
+	v.Lock()
+	delete(v.unverified, extentID)
+	v.Unlock()
+}
+
+// Report the extents failed the verification with the sizes the repairs have to start from.
+// The watermarks of the store are shared, so the changed ones are copied.
+func (dp *DataPartition) maskUnverifiedExtents(extents []*storage.ExtentInfo) []*storage.ExtentInfo {
+	v := &dp.repairVerifier
+	v.Lock()
+	defer v.Unlock()
+	if len(v.unverified) == 0 {
+		return extents
+	}
+	masked := make([]*storage.ExtentInfo, len(extents))
+	for i, ei := range extents {
+		masked[i] = ei
+		if offset, ok := v.unverified[ei.FileID]; ok && offset < ei.Size {
+			copied := *ei
+			copied.Size = offset
+			masked[i] = &copied
+		}
+	}
+	return masked
+}
+
+// Re-read the range of the extent written by the repair, and check its crc against the one of the data
+// received from the source. The extent is repaired again from the offset in the next repair if they differ.
+func (dp *DataPartition) verifyRepairedExtent(extentID, offset, end uint64, expectCrc uint32) (err error) {
+	data := make([]byte, util.BlockSize)
+	var actualCrc uint32
+	for current := offset; current < end; {
+		size := end - current
+		if size > util.BlockSize {
+			size = util.BlockSize
+		}
+		if _, err = dp.extentStore.Read(extentID, int64(current), int64(size), data, true); err != nil {
+			err = fmt.Errorf("read offset(%v) size(%v) err(%v)", current, size, err)
+			break
+		}
+		actualCrc = crc32.Update(actualCrc, crc32.IEEETable, data[:size])
+		current += size
+	}
+	if err == nil && actualCrc != expectCrc {
+		err = fmt.Errorf("crc mismatch expectCrc(%v) actualCrc(%v)", expectCrc, actualCrc)
+	}
+	if err != nil {
+		dp.markUnverified(extentID, offset)
+		err = fmt.Errorf("partition(%v) extent(%v) range(%v-%v) on %v failed the verification: %v",
+			dp.partitionID, extentID, offset, end, LocalIP, err)
+		log.LogErrorf("action[verifyRepairedExtent] %v", err)
+		exporter.Warning(err.Error())
+	}
+	return
+}
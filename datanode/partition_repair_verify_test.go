@@ -0,0 +1,54 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"hash/crc32"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestVerifyRepairedExtent(t *testing.T) {
+	store := newMockExtentStore(map[uint64]uint64{1024: 8192})
+	store.data = map[uint64][]byte{1024: make([]byte, 8192)}
+	for i := range store.data[1024] {
+		store.data[1024][i] = byte(i)
+	}
+	dp := newMockPartition(store)
+	if err := dp.verifyRepairedExtent(1024, 4096, 8192, crc32.ChecksumIEEE(store.data[1024][4096:])); err != nil {
+		t.Fatal(err)
+	}
+	if offset := dp.repairStartOffset(1024, 8192); offset != 8192 {
+		t.Fatalf("verified extent repaired again from offset(%v)", offset)
+	}
+
+	if err := dp.verifyRepairedExtent(1024, 4096, 8192, 0); err == nil {
+		t.Fatalf("crc mismatch not found")
+	}
+	if offset := dp.repairStartOffset(1024, 8192); offset != 4096 {
+		t.Fatalf("extent failed the verification repaired from offset(%v)", offset)
+	}
+	watermarks := []*storage.ExtentInfo{{FileID: 1024, Size: 8192}, {FileID: 1025, Size: 100}}
+	masked := dp.maskUnverifiedExtents(watermarks)
+	if masked[0].Size != 4096 || masked[1].Size != 100 || watermarks[0].Size != 8192 {
+		t.Fatalf("unexpected masked watermarks(%v) of watermarks(%v)", masked, watermarks)
+	}
+
+	dp.clearUnverified(1024)
+	if offset := dp.repairStartOffset(1024, 8192); offset != 8192 {
+		t.Fatalf("cleared extent repaired again from offset(%v)", offset)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"strconv"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// The snapshot is rebuilt in full instead if the changed extents are more than 1/incrementalSnapshotRatio of it.
+const incrementalSnapshotRatio = 4
+
+// snapshotReload keeps what the reload of the snapshot needs to update it by the changed extents only.
+type snapshotReload struct {
+	orderedMutex
+	loaded    bool
+	seq       uint64          // the change sequence of the extent store the snapshot is up to
+	positions map[uint64]int  // extent id to its position in the snapshot
+	unsettled map[uint64]bool // the changed extents left out of the snapshot for being modified recently
+}
+
+// Build the snapshot from the previous one by the extents changed since the last reload. The previous one is
+// left untouched for its readers, the changed extents get new files in a copy of it. ok is false if the changes
+// are not tracked or too many, and the snapshot has to be rebuilt in full.
+func (dp *DataPartition) updateSnapshot(r *snapshotReload) (files []*proto.File, ok bool) {
+	if !r.loaded {
+		return
+	}
+	changed, seq, ok := dp.extentStore.ChangedExtentsSince(r.seq)
+	if !ok {
+		return
+	}
+	dp.snapshotMutex.RLock()
+	files = make([]*proto.File, len(dp.snapshot), len(dp.snapshot)+len(changed))
+	copy(files, dp.snapshot)
+	dp.snapshotMutex.RUnlock()
+	if len(changed)+len(r.unsettled) > len(files)/incrementalSnapshotRatio+1 {
+		return nil, false
+	}
+	for extentID := range r.unsettled {
+		changed = append(changed, extentID)
+	}
+	var file proto.File
+	for _, extentID := range changed {
+		in, unsettled := dp.extentStore.ExtentSnapShot(extentID, &file)
+		if unsettled {
+			r.unsettled[extentID] = true
+		} else {
+			delete(r.unsettled, extentID)
+		}
+		position, has := r.positions[extentID]
+		switch {
+		case in && has:
+			files[position] = newSnapshotFile(&file)
+		case in:
+			r.positions[extentID] = len(files)
+			files = append(files, newSnapshotFile(&file))
+		case has:
+			// move the last one into the position of the removed one
+			last := files[len(files)-1]
+			files[position] = last
+			files = files[:len(files)-1]
+			if lastID, err := strconv.ParseUint(last.Name, 10, 64); err == nil {
+				r.positions[lastID] = position
+			}
+			delete(r.positions, extentID)
+		}
+	}
+	r.seq = seq
+	return files, true
+}
+
+// Rebuild the snapshot from all the extents, and restart tracking the changes from the sequence the
+// rebuild starts at. The extents changed during the rebuild are updated again by the next reload, and the
+// unsettled ones are taken before the snapshot, so none of them is missed by settling in between.
+func (dp *DataPartition) rebuildSnapshot(r *snapshotReload) (files []*proto.File, err error) {
+	seq := dp.extentStore.ChangeSeq()
+	unsettled := dp.extentStore.UnsettledExtents()
+	if files, err = dp.extentStore.SnapShot(); err != nil {
+		return
+	}
+	r.positions = make(map[uint64]int, len(files))
+	for i, file := range files {
+		if extentID, parseErr := strconv.ParseUint(file.Name, 10, 64); parseErr == nil {
+			r.positions[extentID] = i
+		}
+	}
+	r.unsettled = make(map[uint64]bool, len(unsettled))
+	for _, extentID := range unsettled {
+		r.unsettled[extentID] = true
+	}
+	r.seq = seq
+	r.loaded = true
+	return
+}
+
+func newSnapshotFile(file *proto.File) (f *proto.File) {
+	f = new(proto.File)
+	*f = *file
+	return
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The store requests ask the raft schedule of the partition to persist the applied id ahead of the store
+// interval, and are queued in storeC. The requests queued are served by one persistence, so the queue only
+// fills up when the persistence falls behind, such as on a stuck disk. A full queue is handled by the policy:
+//
+//   - block: the request waits for the room until the timeout, and is rejected after.
+//   - reject: the request is rejected at once.
+//
+// A rejected request is not lost for good, as the applied id is still persisted by the store interval.
+const (
+	StoreQueuePolicyBlock  = "block"
+	StoreQueuePolicyReject = "reject"
+
+	DefaultStoreQueueCapacity = 128
+	DefaultStoreQueueTimeout  = time.Second
+)
+
+// StoreQueueFullError is the error a store request is rejected with when storeC of the partition is full.
+type StoreQueueFullError struct {
+	PartitionID uint64
+	Capacity    int
+	Policy      string
+}
+
+func (e *StoreQueueFullError) Error() string {
+	return fmt.Sprintf("partition(%v) store queue of capacity(%v) is full, rejected by policy(%v)",
+		e.PartitionID, e.Capacity, e.Policy)
+}
+
+// IsStoreQueueFullError tells if the error is the one of a store request rejected by a full queue.
+func IsStoreQueueFullError(err error) bool {
+	_, ok := err.(*StoreQueueFullError)
+	return ok
+}
+
+// storeQueue counts the store requests of the partition rejected by a full storeC, and the ones of the apply
+// coalesced into the requests queued.
+type storeQueue struct {
+	rejected  uint64
+	coalesced uint64
+}
+
+func isValidStoreQueuePolicy(policy string) bool {
+	return policy == StoreQueuePolicyBlock || policy == StoreQueuePolicyReject
+}
+
+func (manager *SpaceManager) SetStoreQueue(capacity int, policy string, timeout time.Duration) {
+	manager.storeQueueCapacity = capacity
+	manager.storeQueuePolicy = policy
+	manager.storeQueueTimeout = timeout
+}
+
+// GetStoreQueue returns the capacity of storeC of the new partitions, and the policy when it is full.
+func (manager *SpaceManager) GetStoreQueue() (capacity int, policy string, timeout time.Duration) {
+	if capacity = manager.storeQueueCapacity; capacity <= 0 {
+		capacity = DefaultStoreQueueCapacity
+	}
+	if policy = manager.storeQueuePolicy; policy == "" {
+		policy = StoreQueuePolicyBlock
+	}
+	if timeout = manager.storeQueueTimeout; timeout <= 0 {
+		timeout = DefaultStoreQueueTimeout
+	}
+	return
+}
+
+func storeQueueCapacity(disk *Disk) (capacity int) {
+	if disk != nil && disk.space != nil {
+		capacity, _, _ = disk.space.GetStoreQueue()
+		return
+	}
+	return DefaultStoreQueueCapacity
+}
+
+func (dp *DataPartition) storeQueuePolicy() (policy string, timeout time.Duration) {
+	if dp.disk != nil && dp.disk.space != nil {
+		_, policy, timeout = dp.disk.space.GetStoreQueue()
+		return
+	}
+	return StoreQueuePolicyBlock, DefaultStoreQueueTimeout
+}
+
+// Ask the raft schedule to persist the applied id, which fails with StoreQueueFullError if storeC is full
+// by the policy.
+func (dp *DataPartition) requestStoreAppliedID(appliedID uint64) (err error) {
+	policy, timeout := dp.storeQueuePolicy()
+	select {
+	case dp.storeC <- appliedID:
+		return
+	default:
+	}
+	if policy == StoreQueuePolicyBlock {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case dp.storeC <- appliedID:
+			return
+		case <-timer.C:
+		}
+	}
+	rejected := atomic.AddUint64(&dp.storeQueue.rejected, 1)
+	err = &StoreQueueFullError{PartitionID: dp.partitionID, Capacity: cap(dp.storeC), Policy: policy}
+	log.LogWarnf("action[requestStoreAppliedID] appliedID(%v) err(%v), rejected(%v) since loaded.", appliedID, err, rejected)
+	return
+}
+
+// Ask the raft schedule to persist the applied id from the apply, which never waits for the room by the policy
+// not to hold the apply up. On a full storeC the request is coalesced into the ones queued, which persist the
+// latest applied id when served, since the applied id is uploaded ahead of the request.
+func (dp *DataPartition) notifyStoreAppliedID(appliedID uint64) {
+	select {
+	case dp.storeC <- appliedID:
+		return
+	default:
+	}
+	coalesced := atomic.AddUint64(&dp.storeQueue.coalesced, 1)
+	log.LogWarnf("action[notifyStoreAppliedID] partition(%v) appliedID(%v) coalesced into the full store queue of capacity(%v), coalesced(%v) since loaded.",
+		dp.partitionID, appliedID, cap(dp.storeC), coalesced)
+}
+
+// Drain the store requests queued, which are all served by the persistence of the current applied id.
+func (dp *DataPartition) drainStoreRequests() (drained int) {
+	for {
+		select {
+		case <-dp.storeC:
+			drained++
+		default:
+			return
+		}
+	}
+}
+
+// StoreQueueRejections returns the store requests rejected by a full storeC since the partition is loaded.
+func (dp *DataPartition) StoreQueueRejections() uint64 {
+	return atomic.LoadUint64(&dp.storeQueue.rejected)
+}
+
+// StoreQueueCoalesced returns the store requests of the apply coalesced into a full storeC since the partition is loaded.
+func (dp *DataPartition) StoreQueueCoalesced() uint64 {
+	return atomic.LoadUint64(&dp.storeQueue.coalesced)
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreQueueBackpressure(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(nil))
+	dp.disk = &Disk{space: &SpaceManager{}}
+	dp.disk.space.SetStoreQueue(2, StoreQueuePolicyReject, 0)
+	dp.storeC = make(chan uint64, storeQueueCapacity(dp.disk))
+	for i := uint64(1); i <= 2; i++ {
+		if err := dp.requestStoreAppliedID(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dp.requestStoreAppliedID(3); !IsStoreQueueFullError(err) {
+		t.Fatalf("request to a full queue err(%v), expected StoreQueueFullError", err)
+	}
+
+	dp.disk.space.SetStoreQueue(2, StoreQueuePolicyBlock, 20*time.Millisecond)
+	start := time.Now()
+	if err := dp.requestStoreAppliedID(4); !IsStoreQueueFullError(err) || time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("blocked request err(%v) after(%v), expected rejected after the timeout", err, time.Since(start))
+	}
+	if rejected := dp.StoreQueueRejections(); rejected != 2 {
+		t.Fatalf("rejections(%v), expected 2", rejected)
+	}
+
+	dp.disk.space.SetStoreQueue(2, StoreQueuePolicyBlock, time.Second)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-dp.storeC
+	}()
+	if err := dp.requestStoreAppliedID(5); err != nil {
+		t.Fatalf("blocked request err(%v), expected queued once the room is made", err)
+	}
+	if drained := dp.drainStoreRequests(); drained != 2 {
+		t.Fatalf("drained(%v), expected 2", drained)
+	}
+
+	// the apply never waits for the room, even by the block policy
+	dp.notifyStoreAppliedID(6)
+	dp.notifyStoreAppliedID(7)
+	start = time.Now()
+	dp.notifyStoreAppliedID(8)
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Fatalf("apply request to a full queue waited(%v)", elapsed)
+	}
+	if coalesced, rejected := dp.StoreQueueCoalesced(), dp.StoreQueueRejections(); coalesced != 1 || rejected != 2 {
+		t.Fatalf("coalesced(%v) rejected(%v), expected 1 and 2", coalesced, rejected)
+	}
+}
@@ -0,0 +1,709 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestIsLocalAddr(t *testing.T) {
+	origin := LocalIP
+	defer func() {
+		LocalIP = origin
+	}()
+	cases := []struct {
+		localIP string
+		addr    string
+		expect  bool
+	}{
+		{"192.168.0.11", "192.168.0.11:17310", true},
+		{"192.168.0.11", " 192.168.0.11:17310 ", true},
+		{"192.168.0.11", "192.168.0.12:17310", false},
+		{"192.168.0.11", "192.168.0.11", false},
+		{"fe80::1", "[fe80::1]:17310", true},
+		{"fe80::1", "[fe80::2]:17310", false},
+		{"fe80::1", "fe80::1:17310", false},
+		{"2001:db8::1", "[2001:db8::1]:17310", true},
+		{"datanode1", "datanode1:17310", true},
+		{"datanode1", "datanode2:17310", false},
+	}
+	for _, c := range cases {
+		LocalIP = c.localIP
+		if actual := isLocalAddr(c.addr); actual != c.expect {
+			t.Errorf("isLocalAddr(%v) with local ip(%v): expect(%v) actual(%v)", c.addr, c.localIP, c.expect, actual)
+		}
+	}
+}
+
+func TestDoExtentStoreRepairWithMockStore(t *testing.T) {
+	store := newMockExtentStore(map[uint64]uint64{1025: 4096})
+	dp := newMockPartition(store)
+	task := &DataPartitionRepairTask{
+		addr: "192.168.0.11:17310",
+		ExtentsToBeCreated: []*storage.ExtentInfo{
+			{FileID: 1025, Size: 4096},
+			{FileID: 1026, Size: 0},
+		},
+		ExtentsToBeRepaired: make([]*storage.ExtentInfo, 0),
+	}
+	summary, err := dp.DoExtentStoreRepair(context.Background(), task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.created) != 1 || store.created[0] != 1026 {
+		t.Fatalf("expect extent 1026 to be created, actual(%v)", store.created)
+	}
+	if summary.ExtentsCompleted != 2 || summary.ExtentsCanceled != 0 {
+		t.Fatalf("unexpected summary(%+v)", summary)
+	}
+	if stats := dp.GetRepairStats(); stats.ExtentsCreated != 1 {
+		t.Fatalf("unexpected repair stats(%+v)", stats)
+	}
+	if depth, waits := dp.metrics.RepairQueueDepth(), dp.metrics.RepairWaitPercentiles(); depth != 0 || waits.Count != 2 {
+		t.Fatalf("unexpected repair queue depth(%v) waits(%+v)", depth, waits)
+	}
+	// the next cycle counts from zero, with nothing left to be created
+	task.ExtentsToBeRepaired = make([]*storage.ExtentInfo, 0)
+	if _, err = dp.DoExtentStoreRepair(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	if stats := dp.GetRepairStats(); stats.ExtentsCreated != 0 {
+		t.Fatalf("repair stats(%+v) not reset for the next cycle", stats)
+	}
+}
+
+func TestDoExtentStoreRepairCanceled(t *testing.T) {
+	store := newMockExtentStore(map[uint64]uint64{1025: 0, 1026: 0})
+	dp := newMockPartition(store)
+	task := &DataPartitionRepairTask{
+		addr:               "192.168.0.11:17310",
+		ExtentsToBeCreated: make([]*storage.ExtentInfo, 0),
+		ExtentsToBeRepaired: []*storage.ExtentInfo{
+			{FileID: 1025, Size: 4096},
+			{FileID: 1026, Size: 4096},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary, err := dp.DoExtentStoreRepair(ctx, task)
+	if err == nil {
+		t.Fatal("expect the canceled repair to fail")
+	}
+	if summary.ExtentsCompleted != 0 || summary.ExtentsCanceled != 2 {
+		t.Fatalf("unexpected summary(%+v)", summary)
+	}
+}
+
+func TestCleanupTempFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cleanup_temp_files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		ApplyIndexFile:       "1024",
+		TempApplyIndexFile:   "10",
+		TempMetadataFileName: "{}",
+	}
+	for name, data := range files {
+		if err = ioutil.WriteFile(path.Join(dir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanupTempFiles(dir)
+	if _, err = os.Stat(path.Join(dir, TempApplyIndexFile)); !os.IsNotExist(err) {
+		t.Fatalf("temp apply file beside a valid APPLY is kept: %v", err)
+	}
+	if _, err = os.Stat(path.Join(dir, TempMetadataFileName)); err != nil {
+		t.Fatalf("temp meta file without a valid META is removed: %v", err)
+	}
+
+	if err = ioutil.WriteFile(path.Join(dir, ApplyIndexFile), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path.Join(dir, TempApplyIndexFile), []byte("10"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cleanupTempFiles(dir)
+	if _, err = os.Stat(path.Join(dir, TempApplyIndexFile)); err != nil {
+		t.Fatalf("temp apply file beside an empty APPLY is removed: %v", err)
+	}
+}
+
+func TestLaunchRepairNotRun(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	dp.intervalToUpdateReplicas = time.Now().Unix()
+	if ran, err := dp.LaunchRepair(proto.NormalExtentType); ran || err == nil {
+		t.Fatalf("repair of a follower ran(%v) err(%v)", ran, err)
+	}
+	atomic.StoreInt32(&dp.isRepairing, 1)
+	if ran, err := dp.LaunchRepair(proto.NormalExtentType); ran || err == nil {
+		t.Fatalf("repair of a partition being repaired ran(%v) err(%v)", ran, err)
+	}
+	atomic.StoreInt32(&dp.isRepairing, 0)
+	dp.partitionStatus = proto.Unavailable
+	if ran, err := dp.LaunchRepair(proto.NormalExtentType); ran || err == nil {
+		t.Fatalf("repair of an unavailable partition ran(%v) err(%v)", ran, err)
+	}
+	if last := dp.setRepairJobID("repair_1_1"); last != "" || dp.RepairJobID() != "repair_1_1" {
+		t.Fatalf("repair job id(%v) last(%v)", dp.RepairJobID(), last)
+	}
+}
+
+func TestFreezePartition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freeze_partition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{1024: 10}))
+	dp.path = dir
+	dp.config = &dataPartitionCfg{VolName: "vol", PartitionID: 1, PartitionSize: 1024, Peers: testPeers}
+	dp.partitionSize = 1024
+	dp.usageUpdateInterval = IntervalToUpdatePartitionSize
+	dp.intervalToUpdatePartitionSize = time.Now().Unix()
+	dp.disk = &Disk{Status: proto.ReadWrite, space: &SpaceManager{nearFullRatio: DefaultNearFullRatio}}
+	dp.partitionStatus = proto.ReadWrite
+
+	if err = dp.Freeze("investigation"); err != nil {
+		t.Fatal(err)
+	}
+	if dp.Status() != proto.Unavailable {
+		t.Fatalf("frozen partition status(%v)", dp.Status())
+	}
+	dp.statusUpdate()
+	if dp.Status() != proto.Unavailable {
+		t.Fatalf("frozen partition turns to status(%v) on update", dp.Status())
+	}
+	meta, err := loadMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.Frozen || meta.FrozenReason != "investigation" {
+		t.Fatalf("frozen state not persisted: %+v", meta)
+	}
+
+	if err = dp.Unfreeze(); err != nil {
+		t.Fatal(err)
+	}
+	if dp.Status() != proto.ReadWrite {
+		t.Fatalf("unfrozen partition status(%v)", dp.Status())
+	}
+	if meta, err = loadMetadata(dir); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Frozen || meta.FrozenReason != "" {
+		t.Fatalf("frozen state not cleared: %+v", meta)
+	}
+	if err = dp.Unfreeze(); err == nil {
+		t.Fatalf("unfreeze a partition not frozen")
+	}
+}
+
+func TestReplicasConcurrentUpdate(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	dp.replicas = []string{"192.168.0.1:17310", "192.168.0.2:17310", "192.168.0.3:17310"}
+	replicas := dp.Replicas()
+	replicas[0] = "192.168.0.4:17310"
+	if dp.getReplicaAddr(0) != "192.168.0.1:17310" {
+		t.Fatalf("replicas modified through the returned copy: %v", dp.Replicas())
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			dp.replicasLock.Lock()
+			dp.isLeader = i%2 == 0
+			dp.replicas = []string{replicas[i%len(replicas)]}
+			dp.replicasLock.Unlock()
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if len(dp.Replicas()) == 0 {
+			t.Fatalf("torn read of the replicas")
+		}
+		dp.isRepairLeader()
+	}
+	wg.Wait()
+}
+
+func TestSetManualReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manual_read_only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{1024: 10}))
+	dp.path = dir
+	dp.config = &dataPartitionCfg{VolName: "vol", PartitionID: 1, PartitionSize: 1024, Peers: testPeers}
+	dp.partitionSize = 1024
+	dp.usageUpdateInterval = IntervalToUpdatePartitionSize
+	dp.intervalToUpdatePartitionSize = time.Now().Unix()
+	dp.disk = &Disk{Status: proto.ReadWrite, space: &SpaceManager{nearFullRatio: DefaultNearFullRatio}}
+	dp.partitionStatus = proto.ReadWrite
+
+	if err = dp.SetManualReadOnly(true, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if dp.Status() != proto.ReadOnly {
+		t.Fatalf("manual read-only partition status(%v)", dp.Status())
+	}
+	meta, err := loadMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.ManualReadOnly || meta.ReadOnlySetBy != "alice" || meta.ReadOnlySetTime == "" {
+		t.Fatalf("manual read-only state not persisted: %+v", meta)
+	}
+
+	if err = dp.SetManualReadOnly(false, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if dp.Status() != proto.ReadWrite {
+		t.Fatalf("partition status(%v) after manual read-only off", dp.Status())
+	}
+	if operator, setTime := dp.ManualReadOnlySetBy(); operator != "bob" || setTime == "" {
+		t.Fatalf("unexpected operator(%v) time(%v)", operator, setTime)
+	}
+
+	// the state is rolled back if it fails to be persisted
+	dp.path = path.Join(dir, "missing")
+	if err = dp.SetManualReadOnly(true, "carol"); err == nil {
+		t.Fatalf("set manual read-only without persisting")
+	}
+	if operator, _ := dp.ManualReadOnlySetBy(); dp.IsManualReadOnly() || operator != "bob" {
+		t.Fatalf("manual read-only state not rolled back: readOnly(%v) operator(%v)", dp.IsManualReadOnly(), operator)
+	}
+}
+
+func TestApplyResize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	dp.path = dir
+	dp.config = &dataPartitionCfg{VolName: "vol", PartitionID: 1, PartitionSize: 1000, Peers: testPeers}
+	dp.partitionSize = 1000
+	dp.used = 600
+	dp.usageUpdateInterval = IntervalToUpdatePartitionSize
+	dp.intervalToUpdatePartitionSize = time.Now().Unix()
+	other := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	other.partitionSize = 1500
+	dp.disk = &Disk{Path: dir, Status: proto.ReadWrite, Total: 3000, space: &SpaceManager{nearFullRatio: DefaultNearFullRatio},
+		partitionMap: map[uint64]*DataPartition{1: dp, 2: other}}
+	resize := func(size int, index uint64) interface{} {
+		command, err := MarshalRandWriteRaftLog(proto.OpResizeDataPartition, 0, int64(size), 0, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isResizeRaftLog(command) {
+			t.Fatalf("resize raft log not recognized")
+		}
+		resp, err := dp.Apply(command, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dp.appliedID != index {
+			t.Fatalf("applied id(%v), want %v", dp.appliedID, index)
+		}
+		return resp
+	}
+
+	// the growth beyond the space not allocated to the other partitions and the shrink below the used space fail
+	if resp := resize(2000, 1); resp != proto.OpArgMismatchErr || dp.Size() != 1000 {
+		t.Fatalf("resp(%v) size(%v) after the growth beyond the disk", resp, dp.Size())
+	}
+	if resp := resize(500, 2); resp != proto.OpArgMismatchErr || dp.Size() != 1000 {
+		t.Fatalf("resp(%v) size(%v) after the shrink below the used space", resp, dp.Size())
+	}
+	if resp := resize(1500, 3); resp != proto.OpOk || dp.Size() != 1500 {
+		t.Fatalf("resp(%v) size(%v) after the growth", resp, dp.Size())
+	}
+	meta, err := loadMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.PartitionSize != 1000 || meta.LogicalSize != 1500 {
+		t.Fatalf("unexpected persisted sizes(%v, %v)", meta.PartitionSize, meta.LogicalSize)
+	}
+
+	// the size on creation is kept without the logical size, and only the leader submits a resize
+	if resp := resize(1000, 4); resp != proto.OpOk {
+		t.Fatalf("resp(%v) after the resize back", resp)
+	}
+	if meta, err = loadMetadata(dir); err != nil || meta.LogicalSize != 0 {
+		t.Fatalf("logical size(%v) err(%v) after the resize back", meta.LogicalSize, err)
+	}
+	if err = dp.ResizePartition(1200); err == nil {
+		t.Fatalf("resize submitted without the raft")
+	}
+}
+
+func TestPersistRestartCount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "restart_count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	dp.path = dir
+	dp.config = &dataPartitionCfg{VolName: "vol", PartitionID: 1, PartitionSize: 1024, Peers: testPeers}
+	dp.loadTime = time.Now().Unix() - 60
+	for i := 0; i < 3; i++ {
+		dp.restartCount++
+		if err = dp.PersistMetadata(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta, err := loadMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.RestartCount != 3 {
+		t.Fatalf("unexpected persisted restart count(%v)", meta.RestartCount)
+	}
+	if uptime := dp.GetUptimeInfo(); uptime.RestartCount != 3 || uptime.Uptime < 60 {
+		t.Fatalf("unexpected uptime(%+v)", uptime)
+	}
+}
+
+func TestActualSizeSectorSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "actual_size")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tinyFile := path.Join(dir, strconv.Itoa(storage.TinyExtentStartID))
+	if err = ioutil.WriteFile(tinyFile, make([]byte, 3*4096), 0666); err != nil {
+		t.Fatal(err)
+	}
+	finfo, err := os.Stat(tinyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := new(syscall.Stat_t)
+	if err = syscall.Stat(tinyFile, stat); err != nil {
+		t.Fatal(err)
+	}
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	for _, sectorSize := range []int64{0, DiskSectorSize} {
+		dp.disk = &Disk{SectorSize: sectorSize}
+		expected := stat.Blocks * sectorSize
+		if sectorSize == 0 {
+			expected = stat.Blocks * DiskSectorSize
+		}
+		if size := dp.actualSize(dir, finfo); size != expected {
+			t.Fatalf("actual size(%v) with sector size(%v), expected(%v)", size, sectorSize, expected)
+		}
+	}
+}
+
+func TestReloadSnapshotIncrementally(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload_snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.NewExtentStore(dir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	dp := newMockPartition(store)
+	snapshotSizes := func() map[string]uint32 {
+		sizes := make(map[string]uint32)
+		for _, file := range dp.SnapShot() {
+			sizes[file.Name] = file.Size
+		}
+		return sizes
+	}
+
+	dp.ReloadSnapshot()
+	if sizes := snapshotSizes(); len(sizes) != storage.TinyExtentCount {
+		t.Fatalf("snapshot of %v extents, expected the %v tiny extents", len(sizes), storage.TinyExtentCount)
+	}
+	held := dp.SnapShot()
+	data := make([]byte, 4096)
+	crc := crc32.ChecksumIEEE(data)
+	if err = store.Write(storage.TinyExtentStartID, 0, int64(len(data)), data, crc, storage.AppendWriteType, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Create(1025, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Write(1025, 0, int64(len(data)), data, crc, storage.AppendWriteType, false); err != nil {
+		t.Fatal(err)
+	}
+	seq := dp.snapshotReload.seq
+	dp.ReloadSnapshot()
+	if !dp.snapshotReload.loaded || dp.snapshotReload.seq != seq+3 {
+		t.Fatalf("snapshot reloaded to seq(%v), expected the incremental update to %v", dp.snapshotReload.seq, seq+3)
+	}
+	sizes := snapshotSizes()
+	if len(sizes) != storage.TinyExtentCount || sizes[strconv.Itoa(storage.TinyExtentStartID)] != uint32(len(data)) {
+		t.Fatalf("snapshot of %v extents, tiny extent of size(%v)", len(sizes), sizes[strconv.Itoa(storage.TinyExtentStartID)])
+	}
+	if _, ok := sizes["1025"]; ok || !dp.snapshotReload.unsettled[1025] {
+		t.Fatalf("extent modified recently in the snapshot, or not kept to be checked again")
+	}
+	for _, file := range held {
+		if file.Size != 0 {
+			t.Fatalf("snapshot held across the reload changed, extent(%v) of size(%v)", file.Name, file.Size)
+		}
+	}
+}
+
+type stuckDeleteStore struct {
+	*mockExtentStore
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func (s *stuckDeleteStore) FlushDelete() error {
+	<-s.release
+	return nil
+}
+
+func (s *stuckDeleteStore) PendingDeletes() int64 {
+	return 3
+}
+
+func (s *stuckDeleteStore) Close() {
+	close(s.closed)
+}
+
+func TestStopFlushDeleteTimeout(t *testing.T) {
+	store := &stuckDeleteStore{
+		mockExtentStore: newMockExtentStore(map[uint64]uint64{}),
+		release:         make(chan struct{}),
+		closed:          make(chan struct{}),
+	}
+	dp := newMockPartition(store)
+	dp.stopC = make(chan bool)
+	if dp.flushDelete(10 * time.Millisecond) {
+		t.Fatal("stuck flush of the deletes not timed out")
+	}
+	close(store.release)
+	if !dp.flushDelete(time.Second) {
+		t.Fatal("flush of the deletes timed out")
+	}
+	dp.Stop()
+	select {
+	case <-store.closed:
+	case <-time.After(time.Second):
+		t.Fatal("extent store not closed on stop")
+	}
+	// stopped again by the deletion after the drain
+	dp.Stop()
+}
+
+// usageStore records the running total reset by the reconciliation.
+type usageStore struct {
+	*mockExtentStore
+	reset int64
+}
+
+func (s *usageStore) ResetUsedSize(used int64) {
+	s.reset = used
+}
+
+func TestReconcileUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reconcile_usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for extentID, size := range map[uint64]int{1025: 4096, 1026: 8192} {
+		if err = ioutil.WriteFile(path.Join(dir, strconv.FormatUint(extentID, 10)), make([]byte, size), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := &usageStore{mockExtentStore: newMockExtentStore(map[uint64]uint64{1025: 4096})}
+	dp := newMockPartition(store)
+	dp.path = dir
+	dp.disk = &Disk{}
+	result, err := dp.ReconcileUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Recorded != 4096 || result.Computed != 4096+8192 || result.Drift != 8192 {
+		t.Fatalf("unexpected usage reconciliation(%+v)", result)
+	}
+	if store.reset != 4096+8192 || dp.used != 4096+8192 {
+		t.Fatalf("running total(%v) used(%v) not corrected", store.reset, dp.used)
+	}
+}
+
+func TestDrainWaitsForRepairs(t *testing.T) {
+	store := &stuckDeleteStore{
+		mockExtentStore: newMockExtentStore(map[uint64]uint64{}),
+		release:         make(chan struct{}),
+		closed:          make(chan struct{}),
+	}
+	close(store.release)
+	dp := newMockPartition(store)
+	dp.stopC = make(chan bool)
+	dp.addInflightExtent(1025)
+	dp.addInflightExtent(1026)
+	go func() {
+		dp.removeInflightExtent(1025)
+		time.Sleep(20 * time.Millisecond)
+		dp.removeInflightExtent(1026)
+	}()
+	start := time.Now()
+	dp.Drain(10 * time.Second)
+	if cost := time.Since(start); cost > 5*time.Second || len(dp.inflightRepairExtents()) != 0 {
+		t.Fatalf("drain returned after %v, extents(%v) still being repaired", cost, dp.inflightRepairExtents())
+	}
+	select {
+	case <-store.closed:
+	default:
+		t.Fatal("partition not stopped after the drain")
+	}
+
+	// the repairs never return, and the drain gives up after the timeout
+	dp = newMockPartition(&stuckDeleteStore{mockExtentStore: store.mockExtentStore, release: store.release,
+		closed: make(chan struct{})})
+	dp.stopC = make(chan bool)
+	dp.addInflightExtent(1025)
+	dp.Drain(20 * time.Millisecond)
+	if extents := dp.inflightRepairExtents(); len(extents) != 1 {
+		t.Fatalf("extents(%v) being repaired, expected 1025 left", extents)
+	}
+}
+
+func TestValidatePeers(t *testing.T) {
+	md := &DataPartitionMetadata{VolumeID: "vol", PartitionID: 1, PartitionSize: 1024, Peers: testPeers}
+	if err := md.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		peers  []proto.Peer
+		expect string
+	}{
+		{nil, "no peers"},
+		{[]proto.Peer{{ID: 1, Addr: "192.168.0.11:17310"}, {Addr: "192.168.0.12:17310"}}, "peer(192.168.0.12:17310) has no id"},
+		{[]proto.Peer{{ID: 1, Addr: "192.168.0.11"}}, "peer(1) addr(192.168.0.11)"},
+		{[]proto.Peer{{ID: 1, Addr: ":17310"}}, "is not host:port"},
+		{[]proto.Peer{{ID: 1, Addr: "192.168.0.11:port"}}, "is not host:port"},
+		{[]proto.Peer{{ID: 1, Addr: "192.168.0.11:17310"}, {ID: 1, Addr: "192.168.0.12:17310"}}, "peer(1) duplicated"},
+	}
+	for i, c := range cases {
+		md.Peers = c.peers
+		if err := md.Validate(); err == nil || !strings.Contains(err.Error(), c.expect) {
+			t.Fatalf("case(%v) peers(%v): err(%v), expected %v", i, c.peers, err, c.expect)
+		}
+	}
+}
+
+func TestMetadataVersion(t *testing.T) {
+	disk, err := ioutil.TempDir("", "metadata_version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(disk)
+	dir := path.Join(disk, DataPartitionPrefix+"_12_1024")
+	if err = os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeMeta := func(name string, md *DataPartitionMetadata, extra string) {
+		var err error
+		if md.Checksum, err = md.ComputeChecksum(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(md)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if extra != "" {
+			data = append(data[:len(data)-1], []byte(","+extra+"}")...)
+		}
+		if err = ioutil.WriteFile(path.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the metadata persisted before the version carries none, and its checksum still holds
+	legacy := &DataPartitionMetadata{VolumeID: "vol", PartitionID: 12, PartitionSize: 1024, Peers: testPeers}
+	writeMeta(DataPartitionMetadataFileName, legacy, "")
+	meta, err := loadMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Version != DataPartitionMetadataVersion {
+		t.Fatalf("legacy metadata(%+v) not upgraded", meta)
+	}
+	if meta.CreateTime != "" {
+		t.Fatalf("unknown creation time of the legacy metadata set to %v", meta.CreateTime)
+	}
+
+	// the metadata of a newer version is refused rather than replaced by the older backup
+	writeMeta(MetadataBackupFileName, legacy, "")
+	newer := &DataPartitionMetadata{Version: DataPartitionMetadataVersion + 1, VolumeID: "vol", PartitionID: 12,
+		PartitionSize: 1024, Peers: testPeers}
+	writeMeta(DataPartitionMetadataFileName, newer, `"NewField":true`)
+	if meta, err = loadMetadata(dir); !IsMetadataVersionError(err) {
+		t.Fatalf("metadata(%+v) of a newer version loaded, err(%v)", meta, err)
+	}
+	if _, err = RebuildMetadata(dir, "vol", testPeers, nil, false); err != ErrMetadataExists {
+		t.Fatalf("metadata of a newer version overwritten without force, err(%v)", err)
+	}
+}
+
+func TestFrozenStateConcurrent(t *testing.T) {
+	var state frozenState
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			state.set(i%2 == 0, fmt.Sprintf("investigation %v", i))
+		}
+		state.set(false, "")
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			if frozen, reason := state.get(); frozen && !strings.HasPrefix(reason, "investigation") {
+				t.Errorf("frozen with a torn reason(%v)", reason)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	if frozen, reason := state.get(); frozen || reason != "" {
+		t.Fatalf("frozen(%v) reason(%v) after the unfreeze", frozen, reason)
+	}
+}
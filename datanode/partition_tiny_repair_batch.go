@@ -0,0 +1,85 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sync"
+	"time"
+)
+
+// tinyRepairBatch adapts the number of the broken tiny extents repaired by a cycle of the partition.
+//
+// While the partition has no more broken tiny extents than MinTinyExtentsToRepair, the batch stays at the minimum,
+// which keeps the rolling check of the healthy partitions cheap. With a backlog of broken extents, e.g. after
+// a long outage of a replica, the batch doubles after each cycle finishing within half of the status interval,
+// and halves after a cycle lasting longer than the interval, so the repair speeds up as long as the replicas
+// keep up with it. The batch never exceeds the configured maximum nor the number of the broken extents.
+type tinyRepairBatch struct {
+	sync.Mutex
+	size int
+}
+
+func (b *tinyRepairBatch) get() (size int) {
+	b.Lock()
+	defer b.Unlock()
+	if b.size < MinTinyExtentsToRepair {
+		b.size = MinTinyExtentsToRepair
+	}
+	return b.size
+}
+
+// Adapt the batch after a cycle, given the number of the tiny extents still broken and the cost of the cycle.
+func (b *tinyRepairBatch) adapt(broken, maxSize int, cost, statusInterval time.Duration) (size int) {
+	if maxSize < MinTinyExtentsToRepair {
+		maxSize = MinTinyExtentsToRepair
+	}
+	b.Lock()
+	defer b.Unlock()
+	if size = b.size; size < MinTinyExtentsToRepair {
+		size = MinTinyExtentsToRepair
+	}
+	switch {
+	case broken <= MinTinyExtentsToRepair:
+		size = MinTinyExtentsToRepair
+	case cost < statusInterval/2:
+		size *= 2
+	case cost > statusInterval:
+		size /= 2
+	}
+	if size > broken {
+		size = broken
+	}
+	if size > maxSize {
+		size = maxSize
+	}
+	if size < MinTinyExtentsToRepair {
+		size = MinTinyExtentsToRepair
+	}
+	b.size = size
+	return
+}
+
+// TinyRepairBatchSize returns the number of the broken tiny extents the next repair cycle takes.
+func (dp *DataPartition) TinyRepairBatchSize() int {
+	return dp.tinyRepairBatch.get()
+}
+
+// Adapt the tiny repair batch to the backlog of the broken tiny extents and the cost of the latest cycle.
+func (dp *DataPartition) adaptTinyRepairBatch() {
+	statusInterval, _, _ := dp.tickerIntervals()
+	cost := dp.GetRepairStats().LastRepairDuration
+	dp.tinyRepairBatch.adapt(dp.extentStore.BrokenTinyExtentCnt(), dp.disk.space.GetMaxTinyRepair(),
+		cost, statusInterval)
+}
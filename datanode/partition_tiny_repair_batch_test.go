@@ -0,0 +1,42 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTinyRepairBatchAdapt(t *testing.T) {
+	var b tinyRepairBatch
+	interval := time.Minute
+	cases := []struct {
+		broken int
+		cost   time.Duration
+		expect int
+	}{
+		{broken: 64, cost: time.Second, expect: 2 * MinTinyExtentsToRepair},
+		{broken: 64, cost: time.Second, expect: 4 * MinTinyExtentsToRepair},
+		{broken: 64, cost: time.Second, expect: 48},
+		{broken: 30, cost: 40 * time.Second, expect: 30},
+		{broken: 64, cost: 2 * time.Minute, expect: 15},
+		{broken: 5, cost: time.Second, expect: MinTinyExtentsToRepair},
+	}
+	for i, c := range cases {
+		if size := b.adapt(c.broken, 48, c.cost, interval); size != c.expect || b.get() != c.expect {
+			t.Fatalf("case(%v) broken(%v) cost(%v): expect batch(%v) actual(%v)", i, c.broken, c.cost, c.expect, size)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+
+	"github.com/chubaofs/chubaofs/util"
+)
+
+// The tiny size is aligned to the pages, so the tiny extents written by the clients and
+// the holes punched by the deletes stay on the page boundaries.
+const tinySizeAlignment = 4 * util.KB
+
+func checkTinySize(size int) (err error) {
+	if size <= 0 || size > util.DefaultTinySizeLimit || size%tinySizeAlignment != 0 {
+		err = fmt.Errorf("invalid tiny size(%v): it must be a multiple of %v and no larger than %v",
+			size, tinySizeAlignment, util.DefaultTinySizeLimit)
+	}
+	return
+}
+
+// TinySize returns the size limit of the files kept in the tiny extents of the partition.
+func (dp *DataPartition) TinySize() int {
+	if dp.config.TinySize <= 0 {
+		return util.DefaultTinySizeLimit
+	}
+	return dp.config.TinySize
+}
+
+// The client writes a file into the tiny extents while its end is within the tiny size, so a
+// tiny write ending beyond it comes from a client whose tiny size is larger than the partition's.
+func (dp *DataPartition) checkTinyWrite(fileOffset uint64, size uint32) (err error) {
+	if limit := dp.TinySize(); fileOffset+uint64(size) > uint64(limit) {
+		err = fmt.Errorf("partition(%v) tiny write at file offset(%v) size(%v) exceeds the tiny size(%v)",
+			dp.partitionID, fileOffset, size, limit)
+	}
+	return
+}
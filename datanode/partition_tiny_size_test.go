@@ -0,0 +1,53 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"testing"
+
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func TestCheckTinySize(t *testing.T) {
+	for _, size := range []int{4 * util.KB, 128 * util.KB, util.DefaultTinySizeLimit} {
+		if err := checkTinySize(size); err != nil {
+			t.Fatalf("tiny size(%v): %v", size, err)
+		}
+	}
+	for _, size := range []int{-1, 0, 1000, util.DefaultTinySizeLimit + tinySizeAlignment} {
+		if err := checkTinySize(size); err == nil {
+			t.Fatalf("tiny size(%v) is accepted", size)
+		}
+	}
+}
+
+func TestCheckTinyWrite(t *testing.T) {
+	dp := newMockPartition(newMockExtentStore(nil))
+	dp.config = &dataPartitionCfg{}
+	if size := dp.TinySize(); size != util.DefaultTinySizeLimit {
+		t.Fatalf("default tiny size(%v), want %v", size, util.DefaultTinySizeLimit)
+	}
+	if err := dp.checkTinyWrite(0, util.DefaultTinySizeLimit); err != nil {
+		t.Fatalf("write within the default tiny size: %v", err)
+	}
+
+	dp.config.TinySize = 64 * util.KB
+	if err := dp.checkTinyWrite(32*util.KB, 32*util.KB); err != nil {
+		t.Fatalf("write ending at the tiny size: %v", err)
+	}
+	if err := dp.checkTinyWrite(32*util.KB, 32*util.KB+1); err == nil {
+		t.Fatal("write beyond the tiny size is accepted")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"container/heap"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+const (
+	DefaultTopExtentsLimit = 20
+	topExtentsReadDirBatch = 1024
+)
+
+// ExtentSize is the size an extent takes on the disk.
+type ExtentSize struct {
+	ExtentID uint64 `json:"extentID"`
+	IsTiny   bool   `json:"isTiny"`
+	Size     int64  `json:"size"`
+}
+
+// TopExtents lists the largest extents of a partition, with the count and the size of all the extents
+// to show the share of the largest ones.
+type TopExtents struct {
+	ExtentCount int           `json:"extentCount"`
+	TotalSize   int64         `json:"totalSize"`
+	Extents     []*ExtentSize `json:"extents"`
+}
+
+// extentSizeHeap is a min heap of the extents by the size, which keeps the largest ones seen so far.
+type extentSizeHeap []*ExtentSize
+
+func (h extentSizeHeap) Len() int            { return len(h) }
+func (h extentSizeHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h extentSizeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *extentSizeHeap) Push(x interface{}) { *h = append(*h, x.(*ExtentSize)) }
+func (h *extentSizeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// ListExtentsBySize returns the limit largest extents of the partition by the size on the disk, largest first.
+// The directories are read in batches and only the largest ones are kept, so neither all the entries of a
+// directory nor the extent store are held at once. The shard directories are read after the partition directory.
+func (dp *DataPartition) ListExtentsBySize(limit int) (top *TopExtents, err error) {
+	if limit <= 0 {
+		limit = DefaultTopExtentsLimit
+	}
+	top = &TopExtents{}
+	// the limit comes from the request, so the heap is sized by the extents in the store at most
+	// and grows beyond only if the disk holds more extent files than the store knows
+	capacity := limit
+	if count := dp.extentStore.GetExtentCount(); count < capacity {
+		capacity = count
+	}
+	h := make(extentSizeHeap, 0, capacity)
+	dirs := []string{dp.path}
+	for i := 0; i < len(dirs); i++ {
+		var shardDirs []string
+		if shardDirs, err = dp.listExtentsBySize(dirs[i], top, &h, limit); err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			dirs = append(dirs, shardDirs...)
+		}
+	}
+	top.Extents = []*ExtentSize(h)
+	sort.Slice(top.Extents, func(i, j int) bool {
+		if top.Extents[i].Size != top.Extents[j].Size {
+			return top.Extents[i].Size > top.Extents[j].Size
+		}
+		return top.Extents[i].ExtentID < top.Extents[j].ExtentID
+	})
+	return
+}
+
+// Read the extents of the directory into the heap of the largest ones, and return the shard directories in it.
+func (dp *DataPartition) listExtentsBySize(dirPath string, top *TopExtents, h *extentSizeHeap, limit int) (shardDirs []string, err error) {
+	var dir *os.File
+	if dir, err = os.Open(dirPath); err != nil {
+		return
+	}
+	defer dir.Close()
+	for {
+		files, readErr := dir.Readdir(topExtentsReadDirBatch)
+		for _, file := range files {
+			if file.IsDir() && storage.IsExtentShardDir(file.Name()) {
+				shardDirs = append(shardDirs, path.Join(dirPath, file.Name()))
+				continue
+			}
+			extentID, isExtent := parseFileName(file.Name())
+			if !isExtent {
+				continue
+			}
+			extent := &ExtentSize{ExtentID: extentID, IsTiny: storage.IsTinyExtent(extentID), Size: dp.actualSize(dirPath, file)}
+			top.ExtentCount++
+			top.TotalSize += extent.Size
+			if h.Len() < limit {
+				heap.Push(h, extent)
+			} else if extent.Size > (*h)[0].Size {
+				(*h)[0] = extent
+				heap.Fix(h, 0)
+			}
+		}
+		if readErr == io.EOF {
+			return shardDirs, nil
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+}
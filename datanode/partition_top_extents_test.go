@@ -0,0 +1,73 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+func TestListExtentsBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "top_extents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sizes := map[uint64]int{1024: 4096, 1025: 1 << 20, 1026: 8192, 1027: 512 << 10, 1028: 0}
+	for extentID, size := range sizes {
+		if err = ioutil.WriteFile(path.Join(dir, strconv.FormatUint(extentID, 10)), make([]byte, size), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = ioutil.WriteFile(path.Join(dir, "META"), make([]byte, 1<<21), 0666); err != nil {
+		t.Fatal(err)
+	}
+	dp := newMockPartition(newMockExtentStore(map[uint64]uint64{}))
+	dp.path = dir
+	dp.disk = &Disk{}
+
+	top, err := dp.ListExtentsBySize(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.ExtentCount != len(sizes) || top.TotalSize != 4096+(1<<20)+8192+(512<<10) {
+		t.Fatalf("extent count(%v) total size(%v) unexpected", top.ExtentCount, top.TotalSize)
+	}
+	expected := []uint64{1025, 1027, 1026}
+	if len(top.Extents) != len(expected) {
+		t.Fatalf("top extents(%v), expected %v", len(top.Extents), expected)
+	}
+	for i, extent := range top.Extents {
+		if extent.ExtentID != expected[i] || extent.Size != int64(sizes[extent.ExtentID]) {
+			t.Fatalf("top extent(%v) %+v, expected extent(%v) of size(%v)", i, extent, expected[i], sizes[expected[i]])
+		}
+	}
+	if top, err = dp.ListExtentsBySize(10); err != nil {
+		t.Fatal(err)
+	}
+	if len(top.Extents) != len(sizes) || top.Extents[len(sizes)-1].ExtentID != 1028 {
+		t.Fatalf("all the extents not listed by size: %v", len(top.Extents))
+	}
+	if top, err = dp.ListExtentsBySize(math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+	if len(top.Extents) != len(sizes) {
+		t.Fatalf("all the extents not listed by a huge limit: %v", len(top.Extents))
+	}
+}
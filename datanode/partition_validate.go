@@ -0,0 +1,81 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+// PartitionValidationReport is the result of ValidatePartitionOffline.
+type PartitionValidationReport struct {
+	Dir              string                     `json:"dir"`
+	PartitionID      uint64                     `json:"partitionID"`
+	VolumeID         string                     `json:"volumeID"`
+	PartitionSize    int                        `json:"partitionSize"`
+	MetadataProblems []string                   `json:"metadataProblems"`
+	Store            *storage.StoreVerifyReport `json:"store"`
+}
+
+// Healthy tells if neither the metadata nor the extents have any problem.
+func (r *PartitionValidationReport) Healthy() bool {
+	return len(r.MetadataProblems) == 0 && r.Store != nil && len(r.Store.Anomalies) == 0
+}
+
+// ValidatePartitionOffline checks the metadata and the extents of the partition under the given directory.
+// It neither starts raft nor talks to the network, and only reads the files, so it can be used to inspect
+// a disk pulled from a dead node on another machine. The problems found are collected into the report,
+// err is only returned if the directory can not be read at all.
+func ValidatePartitionOffline(dir string) (report *PartitionValidationReport, err error) {
+	report = &PartitionValidationReport{Dir: dir, MetadataProblems: make([]string, 0)}
+	dirID, dirSize, nameErr := unmarshalPartitionName(path.Base(dir))
+	if nameErr != nil {
+		report.MetadataProblems = append(report.MetadataProblems, nameErr.Error())
+	}
+	meta, metaErr := readMetadataFile(path.Join(dir, DataPartitionMetadataFileName))
+	if metaErr != nil {
+		report.MetadataProblems = append(report.MetadataProblems,
+			fmt.Sprintf("read %v: %v", DataPartitionMetadataFileName, metaErr))
+		meta = nil
+	}
+	backup, backupErr := readMetadataFile(path.Join(dir, MetadataBackupFileName))
+	if backupErr != nil {
+		// the partitions created before the backup was introduced have no backup file
+		if !os.IsNotExist(backupErr) {
+			report.MetadataProblems = append(report.MetadataProblems,
+				fmt.Sprintf("read %v: %v", MetadataBackupFileName, backupErr))
+		}
+		backup = nil
+	}
+	if meta == nil {
+		meta = backup
+	}
+	if meta != nil {
+		report.PartitionID = meta.PartitionID
+		report.VolumeID = meta.VolumeID
+		report.PartitionSize = meta.PartitionSize
+		if nameErr == nil && (meta.PartitionID != dirID || meta.PartitionSize != dirSize) {
+			report.MetadataProblems = append(report.MetadataProblems,
+				fmt.Sprintf("partition(%v) size(%v) in metadata mismatches the dir name", meta.PartitionID, meta.PartitionSize))
+		}
+	}
+	if report.Store, err = storage.VerifyExtentStore(dir); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/exporter"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// ExtentCrcMismatchError is the error a verified read fails with, when the data of a block differs from the crc
+// stored in the extent header.
+type ExtentCrcMismatchError struct {
+	PartitionID uint64
+	ExtentID    uint64
+	BlockNo     int
+	Expected    uint32
+	Actual      uint32
+}
+
+func (e *ExtentCrcMismatchError) Error() string {
+	return fmt.Sprintf("partition(%v) extent(%v) block(%v) crc(%v) mismatches the stored crc(%v)",
+		e.PartitionID, e.ExtentID, e.BlockNo, e.Actual, e.Expected)
+}
+
+// IsExtentCrcMismatch tells if the error is the one of a verified read failed the crc check.
+func IsExtentCrcMismatch(err error) bool {
+	_, ok := err.(*ExtentCrcMismatchError)
+	return ok
+}
+
+func (manager *SpaceManager) SetVerifiedRead(vols map[string]bool, repair bool) {
+	manager.volVerifiedRead = vols
+	manager.verifiedReadRepair = repair
+}
+
+// IsVerifiedRead tells if the client reads of the volume are verified against the block crcs.
+func (manager *SpaceManager) IsVerifiedRead(volName string) bool {
+	return manager.volVerifiedRead[volName]
+}
+
+// GetVerifiedReadRepair tells if the blocks failed the verified reads are repaired by the next repair.
+func (manager *SpaceManager) GetVerifiedReadRepair() bool {
+	return manager.verifiedReadRepair
+}
+
+// Parse the volumes whose client reads are verified.
+func parseVolVerifiedRead(values []interface{}) (vols map[string]bool, err error) {
+	vols = make(map[string]bool, len(values))
+	for _, value := range values {
+		vol, _ := value.(string)
+		if vol == "" {
+			return nil, fmt.Errorf("Err:%v invalid volume (%v)", ConfigKeyVolVerifiedRead, value)
+		}
+		vols[vol] = true
+	}
+	return
+}
+
+// Tell if the client read of the extent is verified by the volume of the partition. The tiny extents have no
+// block crcs to verify.
+func (dp *DataPartition) verifyClientRead(extentID uint64) bool {
+	if storage.IsTinyExtent(extentID) || dp.disk == nil || dp.disk.space == nil {
+		return false
+	}
+	return dp.disk.space.IsVerifiedRead(dp.volumeID)
+}
+
+// VerifiedRead reads the range of a normal extent, and checks the blocks it covers against the crcs stored in the
+// extent header before returning the data. The whole blocks are read for the check, so it costs up to two blocks
+// of reads more than a plain read. A block whose crc is not computed yet, such as the last one being written, is
+// returned unverified.
+func (dp *DataPartition) VerifiedRead(extentID uint64, offset, size int) (data []byte, err error) {
+	data = make([]byte, size)
+	if _, err = dp.verifiedRead(extentID, int64(offset), int64(size), data); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Read the range into nbuf with the verification, and return the crc of the range. A range beyond the extent
+// fails with io.EOF as the plain read, so the short extent is read repaired the same way.
+func (dp *DataPartition) verifiedRead(extentID uint64, offset, size int64, nbuf []byte) (crc uint32, err error) {
+	if storage.IsTinyExtent(extentID) {
+		return 0, fmt.Errorf("tiny extent(%v) has no block crcs to verify", extentID)
+	}
+	if offset < 0 || size <= 0 || int64(len(nbuf)) < size {
+		return 0, storage.NewParameterMismatchErr(fmt.Sprintf("offset=%v size=%v", offset, size))
+	}
+	ei, err := dp.extentStore.Watermark(extentID)
+	if err != nil {
+		return
+	}
+	if offset+size > int64(ei.Size) {
+		return 0, io.EOF
+	}
+	crcs, err := dp.storedBlockCrcs(extentID)
+	if err != nil {
+		return
+	}
+	block := make([]byte, util.BlockSize)
+	for blockStart := offset / util.BlockSize * util.BlockSize; blockStart < offset+size; blockStart += util.BlockSize {
+		blockSize := int64(ei.Size) - blockStart
+		if blockSize > util.BlockSize {
+			blockSize = util.BlockSize
+		}
+		if err = dp.verifyBlock(extentID, int(blockStart/util.BlockSize), block[:blockSize], &crcs); err != nil {
+			return
+		}
+		start, end := offset, offset+size
+		if start < blockStart {
+			start = blockStart
+		}
+		if end > blockStart+blockSize {
+			end = blockStart + blockSize
+		}
+		copy(nbuf[start-offset:end-offset], block[start-blockStart:end-blockStart])
+	}
+	return crc32.ChecksumIEEE(nbuf[:size]), nil
+}
+
+// Read the whole block into data, and check it against its stored crc in crcs. A write to the block after the
+// crcs are read may change the data before the stored crc, so the crcs and the block are read again once
+// before it is failed.
+func (dp *DataPartition) verifyBlock(extentID uint64, blockNo int, data []byte, crcs *[]uint32) (err error) {
+	var expected, actual uint32
+	for attempt := 0; attempt < 2; attempt++ {
+		if attempt > 0 {
+			if *crcs, err = dp.storedBlockCrcs(extentID); err != nil {
+				return
+			}
+		}
+		if blockNo < len(*crcs) {
+			expected = (*crcs)[blockNo]
+		}
+		if actual, err = dp.extentStore.Read(extentID, int64(blockNo)*util.BlockSize, int64(len(data)), data, false); err != nil {
+			return
+		}
+		if expected == 0 || actual == expected {
+			return nil
+		}
+	}
+	err = &ExtentCrcMismatchError{PartitionID: dp.partitionID, ExtentID: extentID, BlockNo: blockNo,
+		Expected: expected, Actual: actual}
+	log.LogErrorf("action[VerifiedRead] %v on %v.", err, LocalIP)
+	exporter.Warning(err.Error())
+	if dp.disk != nil && dp.disk.space != nil && dp.disk.space.GetVerifiedReadRepair() {
+		dp.markUnverified(extentID, uint64(blockNo)*util.BlockSize)
+	}
+	return
+}
+
+// Return the stored crcs of the blocks of the extent by the block number, read from the header at once.
+func (dp *DataPartition) storedBlockCrcs(extentID uint64) (crcs []uint32, err error) {
+	bcs, err := dp.extentStore.ScanBlocks(extentID)
+	if err != nil {
+		return
+	}
+	crcs = make([]uint32, len(bcs))
+	for _, bc := range bcs {
+		if bc.BlockNo < len(crcs) {
+			crcs[bc.BlockNo] = bc.Crc
+		}
+	}
+	return
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
+)
+
+// scanCountingStore counts the scans of the block crcs.
+type scanCountingStore struct {
+	ExtentStorer
+	scans int
+}
+
+func (s *scanCountingStore) ScanBlocks(extentID uint64) (bcs []*storage.BlockCrc, err error) {
+	s.scans++
+	return s.ExtentStorer.ScanBlocks(extentID)
+}
+
+func TestVerifiedRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verified_read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.NewExtentStore(dir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	counting := &scanCountingStore{ExtentStorer: store}
+	dp := newMockPartition(counting)
+	dp.volumeID = "vol1"
+	dp.disk = &Disk{space: &SpaceManager{volVerifiedRead: map[string]bool{"vol1": true}, verifiedReadRepair: true}}
+	if !dp.verifyClientRead(1025) || dp.verifyClientRead(storage.TinyExtentStartID) {
+		t.Fatalf("client reads of the normal extents of the volume are not verified only")
+	}
+
+	// the first block is written in full with its crc, the crc of the second one is left to be computed
+	data := make([]byte, util.BlockSize+4096)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	if err = store.Create(1025, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Write(1025, 0, util.BlockSize, data, crc32.ChecksumIEEE(data[:util.BlockSize]), storage.AppendWriteType, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Write(1025, util.BlockSize, 4096, data[util.BlockSize:], crc32.ChecksumIEEE(data[util.BlockSize:]), storage.AppendWriteType, false); err != nil {
+		t.Fatal(err)
+	}
+	read, err := dp.VerifiedRead(1025, util.BlockSize-100, 200)
+	if err != nil || !bytes.Equal(read, data[util.BlockSize-100:util.BlockSize+100]) {
+		t.Fatalf("verified read across the blocks err(%v)", err)
+	}
+	if counting.scans != 1 {
+		t.Fatalf("block crcs scanned %v times by the read across the blocks, expected once", counting.scans)
+	}
+	if _, err = dp.VerifiedRead(1025, util.BlockSize, 8192); err != io.EOF {
+		t.Fatalf("verified read beyond the extent err(%v)", err)
+	}
+	if _, err = dp.VerifiedRead(storage.TinyExtentStartID, 0, 100); err == nil {
+		t.Fatalf("verified read of a tiny extent is served")
+	}
+
+	// corrupt the first block behind the store
+	fp, err := os.OpenFile(path.Join(dir, "1025"), os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fp.WriteAt([]byte("corrupted"), 10)
+	fp.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dp.VerifiedRead(1025, util.BlockSize-100, 200); !IsExtentCrcMismatch(err) {
+		t.Fatalf("verified read of a corrupted block err(%v)", err)
+	}
+	if offset := dp.repairStartOffset(1025, uint64(len(data))); offset != 0 {
+		t.Fatalf("corrupted block is repaired from offset(%v)", offset)
+	}
+	if _, err = dp.VerifiedRead(1025, util.BlockSize, 100); err != nil {
+		t.Fatalf("verified read of the block not corrupted err(%v)", err)
+	}
+}
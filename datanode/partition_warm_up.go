@@ -0,0 +1,256 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util/log"
+	"golang.org/x/sys/unix"
+)
+
+// The warm-up preloads the hottest extents of a partition into the page cache in the background after the
+// partition is loaded, so the first reads after a restart are not all served from the disk. The extents read
+// by the clients most recently are the hottest ones, and they are preloaded up to the warm-up size of the
+// partition, and up to the warm-up size of the node across all the partitions, so the warm-up does not evict
+// the cache of a busy node.
+const (
+	WarmUpConcurrency = 2 // partitions of the node warming up at once
+
+	WarmUpStatePending  = "pending"
+	WarmUpStateRunning  = "running"
+	WarmUpStateDone     = "done"
+	WarmUpStateCanceled = "canceled" // the partition is stopped meanwhile
+)
+
+// WarmUpProgress describes the warm-up of a partition.
+type WarmUpProgress struct {
+	PartitionID   uint64 `json:"partitionID"`
+	State         string `json:"state"`
+	Extents       int    `json:"extents"` // extents picked to be preloaded
+	ExtentsWarmed int    `json:"extentsWarmed"`
+	Bytes         uint64 `json:"bytes"`
+	BytesWarmed   uint64 `json:"bytesWarmed"`
+	Failed        int    `json:"failed"`
+	StartTime     int64  `json:"startTime"`
+	EndTime       int64  `json:"endTime"`
+}
+
+// extentWarmUp keeps the progress of the warm-up of the partition, nil state if it never warms up.
+type extentWarmUp struct {
+	sync.Mutex
+	progress WarmUpProgress
+}
+
+// warmUpLimiter caps the warm-ups of the partitions of the node.
+type warmUpLimiter struct {
+	slots     chan struct{}
+	remaining int64 // bytes the partitions may still preload, negative if not capped
+}
+
+func (manager *SpaceManager) SetWarmUpSize(partitionSize, nodeSize int64) {
+	manager.warmUpSize = partitionSize
+	manager.warmUpLimiter.slots = make(chan struct{}, WarmUpConcurrency)
+	if nodeSize > 0 {
+		manager.warmUpLimiter.remaining = nodeSize
+	} else {
+		manager.warmUpLimiter.remaining = -1
+	}
+}
+
+// GetWarmUpSize returns the max bytes of the extents of a partition preloaded after the load, 0 if disabled.
+func (manager *SpaceManager) GetWarmUpSize() int64 {
+	return manager.warmUpSize
+}
+
+// Take the bytes out of the warm-up size left to the node, false if not enough left.
+func (l *warmUpLimiter) take(size int64) bool {
+	for {
+		remaining := atomic.LoadInt64(&l.remaining)
+		if remaining < 0 {
+			return true
+		}
+		if remaining < size {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&l.remaining, remaining, remaining-size) {
+			return true
+		}
+	}
+}
+
+// WarmUpProgress returns the progress of the warm-ups of the partitions of the node, which are the only ones
+// ever warmed up since the start.
+func (manager *SpaceManager) WarmUpProgress() (progresses []*WarmUpProgress) {
+	progresses = make([]*WarmUpProgress, 0)
+	manager.RangePartitions(func(dp *DataPartition) bool {
+		if progress := dp.WarmUpProgress(); progress.State != "" {
+			progresses = append(progresses, progress)
+		}
+		return true
+	})
+	sort.Slice(progresses, func(i, j int) bool {
+		return progresses[i].PartitionID < progresses[j].PartitionID
+	})
+	return
+}
+
+// WarmUpProgress returns the progress of the warm-up of the partition.
+func (dp *DataPartition) WarmUpProgress() *WarmUpProgress {
+	w := &dp.extentWarmUp
+	w.Lock()
+	defer w.Unlock()
+	progress := w.progress
+	progress.PartitionID = dp.partitionID
+	return &progress
+}
+
+func (dp *DataPartition) updateWarmUp(update func(progress *WarmUpProgress)) {
+	w := &dp.extentWarmUp
+	w.Lock()
+	update(&w.progress)
+	w.Unlock()
+}
+
+// Start the warm-up of the partition in the background if configured.
+func (dp *DataPartition) startWarmUp() {
+	if dp.disk == nil || dp.disk.space == nil || dp.disk.space.GetWarmUpSize() <= 0 {
+		return
+	}
+	dp.updateWarmUp(func(progress *WarmUpProgress) {
+		progress.State = WarmUpStatePending
+	})
+	go dp.WarmUp()
+}
+
+// WarmUp preloads the hottest extents of the partition into the page cache, waiting for a warm-up slot of the
+// node first. An extent is advised to the kernel to be read ahead, and read through if the advice fails.
+func (dp *DataPartition) WarmUp() {
+	limiter := &dp.disk.space.warmUpLimiter
+	select {
+	case limiter.slots <- struct{}{}:
+	case <-dp.stopC:
+		dp.finishWarmUp(WarmUpStateCanceled)
+		return
+	}
+	defer func() { <-limiter.slots }()
+
+	extents := dp.hottestExtents(dp.disk.space.GetWarmUpSize(), limiter)
+	var bytes uint64
+	for _, ei := range extents {
+		bytes += ei.Size
+	}
+	dp.updateWarmUp(func(progress *WarmUpProgress) {
+		progress.State = WarmUpStateRunning
+		progress.Extents, progress.Bytes = len(extents), bytes
+		progress.StartTime = time.Now().Unix()
+	})
+	for _, ei := range extents {
+		select {
+		case <-dp.stopC:
+			dp.finishWarmUp(WarmUpStateCanceled)
+			return
+		default:
+		}
+		err := warmUpFile(dp.extentFilePath(ei.FileID), int64(ei.Size))
+		dp.updateWarmUp(func(progress *WarmUpProgress) {
+			if err != nil {
+				progress.Failed++
+				return
+			}
+			progress.ExtentsWarmed++
+			progress.BytesWarmed += ei.Size
+		})
+		if err != nil {
+			log.LogWarnf("action[WarmUp] partition(%v) extent(%v) err(%v).", dp.partitionID, ei.FileID, err)
+		}
+	}
+	dp.finishWarmUp(WarmUpStateDone)
+	progress := dp.WarmUpProgress()
+	log.LogInfof("action[WarmUp] partition(%v) warmed up extents(%v) bytes(%v) failed(%v) cost(%vs).",
+		dp.partitionID, progress.ExtentsWarmed, progress.BytesWarmed, progress.Failed, progress.EndTime-progress.StartTime)
+}
+
+func (dp *DataPartition) finishWarmUp(state string) {
+	dp.updateWarmUp(func(progress *WarmUpProgress) {
+		progress.State = state
+		progress.EndTime = time.Now().Unix()
+	})
+}
+
+// Pick the normal extents read by the clients most recently, until the size of the partition or the size left
+// to the node is used up. The extents never read since the tracking began are not picked.
+func (dp *DataPartition) hottestExtents(size int64, limiter *warmUpLimiter) (extents []*storage.ExtentInfo) {
+	all, _, err := dp.extentStore.GetAllWatermarks(func(ei *storage.ExtentInfo) bool {
+		return !storage.IsTinyExtent(ei.FileID) && !ei.IsDeleted && ei.Size > 0
+	})
+	if err != nil {
+		log.LogWarnf("action[hottestExtents] partition(%v) err(%v).", dp.partitionID, err)
+		return
+	}
+	a := &dp.extentAccess
+	a.RLock()
+	times := make(map[uint64]int64, len(a.times))
+	for _, ei := range all {
+		if bucket, ok := a.times[ei.FileID]; ok {
+			times[ei.FileID] = bucket
+		}
+	}
+	a.RUnlock()
+	hot := make([]*storage.ExtentInfo, 0, len(times))
+	for _, ei := range all {
+		if _, ok := times[ei.FileID]; ok {
+			hot = append(hot, ei)
+		}
+	}
+	sort.Slice(hot, func(i, j int) bool {
+		if times[hot[i].FileID] != times[hot[j].FileID] {
+			return times[hot[i].FileID] > times[hot[j].FileID]
+		}
+		return hot[i].FileID < hot[j].FileID
+	})
+	for _, ei := range hot {
+		if int64(ei.Size) > size || !limiter.take(int64(ei.Size)) {
+			break
+		}
+		size -= int64(ei.Size)
+		extents = append(extents, ei)
+	}
+	return
+}
+
+// Preload the file into the page cache by the advice, or by reading it through if the advice fails.
+func warmUpFile(name string, size int64) (err error) {
+	var file *os.File
+	if file, err = os.Open(name); err != nil {
+		return
+	}
+	defer file.Close()
+	if err = unix.Fadvise(int(file.Fd()), 0, size, unix.FADV_WILLNEED); err == nil {
+		return
+	}
+	_, err = io.CopyN(ioutil.Discard, file, size)
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
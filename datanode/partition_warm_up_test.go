@@ -0,0 +1,87 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/storage"
+)
+
+func TestWarmUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warm_up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := &expiringExtentStore{extents: map[uint64]*storage.ExtentInfo{
+		1:    {FileID: 1, Size: 100},
+		1025: {FileID: 1025, Size: 100},
+		1026: {FileID: 1026, Size: 200},
+		1027: {FileID: 1027, Size: 300},
+		1028: {FileID: 1028, Size: 100, IsDeleted: true},
+	}}
+	for extentID, ei := range store.extents {
+		if err = ioutil.WriteFile(path.Join(dir, strconv.FormatUint(extentID, 10)), make([]byte, ei.Size), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dp := newMockPartition(store)
+	dp.path, dp.stopC = dir, make(chan bool)
+	dp.extentAccess.times = map[uint64]int64{1: 40, 1025: 10, 1026: 20, 1028: 30}
+	space := &SpaceManager{}
+	dp.disk = &Disk{space: space}
+
+	// not configured
+	dp.startWarmUp()
+	if progress := dp.WarmUpProgress(); progress.State != "" {
+		t.Fatalf("warm-up(%v) started without the size", progress.State)
+	}
+
+	pick := func(partitionSize, nodeSize int64) (ids []uint64) {
+		space.SetWarmUpSize(partitionSize, nodeSize)
+		for _, ei := range dp.hottestExtents(space.GetWarmUpSize(), &space.warmUpLimiter) {
+			ids = append(ids, ei.FileID)
+		}
+		return
+	}
+	if ids := pick(250, 0); len(ids) != 1 || ids[0] != 1026 {
+		t.Fatalf("extents(%v) picked by the partition size", ids)
+	}
+	if ids := pick(1000, 250); len(ids) != 1 || ids[0] != 1026 {
+		t.Fatalf("extents(%v) picked by the node size", ids)
+	}
+	if ids := pick(1000, 0); len(ids) != 2 || ids[0] != 1026 || ids[1] != 1025 {
+		t.Fatalf("extents(%v) picked", ids)
+	}
+
+	dp.startWarmUp()
+	var progress *WarmUpProgress
+	for i := 0; i < 100; i++ {
+		if progress = dp.WarmUpProgress(); progress.State == WarmUpStateDone {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if progress.State != WarmUpStateDone || progress.Extents != 2 || progress.ExtentsWarmed != 2 ||
+		progress.BytesWarmed != 300 || progress.Failed != 0 {
+		t.Fatalf("unexpected warm-up progress(%+v)", progress)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// The spans of a repair cycle. The cycle launched by the leader notifies the followers with the span context,
+// so the repairs of the followers and the extents they fix are traced under the cycle of the leader.
+const (
+	SpanLaunchRepair         = "datanode.LaunchRepair"
+	SpanDoExtentStoreRepair  = "datanode.DoExtentStoreRepair"
+	SpanStreamExtentRepair   = "datanode.doStreamExtentFixRepair"
+	TraceAttrPartitionID     = "partition.id"
+	TraceAttrExtentType      = "extent.type"
+	TraceAttrExtentID        = "extent.id"
+	TraceAttrSource          = "repair.source"
+	TraceAttrExtentsCreated  = "extents.created"
+	TraceAttrExtentsRepaired = "extents.toBeRepaired"
+	TraceAttrExtentsDone     = "extents.completed"
+	TraceAttrExtentsCanceled = "extents.canceled"
+	TraceAttrBytes           = "bytes.transferred"
+)
+
+// RepairTracer adapts the tracing backend, such as OpenTelemetry, to the spans of the repairs. It is installed
+// by DataNode.SetRepairTracer, and the repairs are not traced at all without it.
+type RepairTracer interface {
+	// Start starts a span as the child of the span in ctx if any, and returns ctx with the span.
+	Start(ctx context.Context, name string) (context.Context, RepairSpan)
+	// Inject writes the span context in ctx into the carrier sent to another node.
+	Inject(ctx context.Context, carrier map[string]string)
+	// Extract returns ctx with the span context read from the carrier received from another node.
+	Extract(ctx context.Context, carrier map[string]string) context.Context
+}
+
+// RepairSpan is a span started by the RepairTracer.
+type RepairSpan interface {
+	SetAttribute(key string, value interface{})
+	End(err error)
+}
+
+type noopRepairSpan struct{}
+
+func (noopRepairSpan) SetAttribute(key string, value interface{}) {}
+func (noopRepairSpan) End(err error)                              {}
+
+// repairTracerHolder keeps the interface in an atomic.Value, which needs a value of the same concrete type.
+type repairTracerHolder struct {
+	tracer RepairTracer
+}
+
+var repairTracer atomic.Value
+
+// SetRepairTracer installs the tracer of the repairs of the node, nil to stop tracing.
+func (s *DataNode) SetRepairTracer(tracer RepairTracer) {
+	repairTracer.Store(repairTracerHolder{tracer: tracer})
+}
+
+func getRepairTracer() RepairTracer {
+	if holder, ok := repairTracer.Load().(repairTracerHolder); ok {
+		return holder.tracer
+	}
+	return nil
+}
+
+// Start a span of the repair of the partition, a no-op one if no tracer is installed.
+func (dp *DataPartition) startRepairSpan(ctx context.Context, name string) (context.Context, RepairSpan) {
+	tracer := getRepairTracer()
+	if tracer == nil {
+		return ctx, noopRepairSpan{}
+	}
+	ctx, span := tracer.Start(ctx, name)
+	span.SetAttribute(TraceAttrPartitionID, dp.partitionID)
+	return ctx, span
+}
+
+// Carry the span context in ctx to the repair task sent to a follower.
+func injectRepairTrace(ctx context.Context, task *DataPartitionRepairTask) {
+	tracer := getRepairTracer()
+	if tracer == nil {
+		return
+	}
+	task.TraceContext = make(map[string]string)
+	tracer.Inject(ctx, task.TraceContext)
+}
+
+// Return ctx with the span context carried by the repair task received from the leader.
+func extractRepairTrace(ctx context.Context, task *DataPartitionRepairTask) context.Context {
+	tracer := getRepairTracer()
+	if tracer == nil || len(task.TraceContext) == 0 {
+		return ctx
+	}
+	return tracer.Extract(ctx, task.TraceContext)
+}
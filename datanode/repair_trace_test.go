@@ -0,0 +1,116 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+type testSpanKey struct{}
+
+type testSpan struct {
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	ended  bool
+	err    error
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *testSpan) End(err error)                              { s.ended, s.err = true, err }
+
+type testTracer struct {
+	sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, RepairSpan) {
+	span := &testSpan{name: name, attrs: make(map[string]interface{})}
+	if parent, ok := ctx.Value(testSpanKey{}).(string); ok {
+		span.parent = parent
+	}
+	t.Lock()
+	t.spans = append(t.spans, span)
+	t.Unlock()
+	return context.WithValue(ctx, testSpanKey{}, name), span
+}
+
+func (t *testTracer) Inject(ctx context.Context, carrier map[string]string) {
+	if parent, ok := ctx.Value(testSpanKey{}).(string); ok {
+		carrier["parent"] = parent
+	}
+}
+
+func (t *testTracer) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return context.WithValue(ctx, testSpanKey{}, "remote:"+carrier["parent"])
+}
+
+func TestRepairTrace(t *testing.T) {
+	s := &DataNode{}
+	dp := &DataPartition{partitionID: 7}
+
+	// no tracer installed
+	ctx, span := dp.startRepairSpan(context.Background(), SpanLaunchRepair)
+	span.SetAttribute(TraceAttrExtentType, proto.NormalExtentType)
+	span.End(nil)
+	task := &DataPartitionRepairTask{}
+	injectRepairTrace(ctx, task)
+	if task.TraceContext != nil {
+		t.Fatalf("trace context(%v) carried without a tracer", task.TraceContext)
+	}
+	if data, _ := json.Marshal(task); strings.Contains(string(data), "TraceContext") {
+		t.Fatalf("empty trace context sent to the followers: %s", data)
+	}
+
+	tracer := &testTracer{}
+	s.SetRepairTracer(tracer)
+	defer s.SetRepairTracer(nil)
+	ctx, span = dp.startRepairSpan(context.Background(), SpanLaunchRepair)
+	injectRepairTrace(ctx, task)
+	span.End(nil)
+	data, err := json.Marshal(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := &DataPartitionRepairTask{}
+	if err = json.Unmarshal(data, received); err != nil {
+		t.Fatal(err)
+	}
+	followerCtx, followerSpan := dp.startRepairSpan(extractRepairTrace(context.Background(), received), SpanDoExtentStoreRepair)
+	_, streamSpan := dp.startRepairSpan(followerCtx, SpanStreamExtentRepair)
+	streamSpan.End(errors.New("canceled"))
+	followerSpan.End(nil)
+
+	if len(tracer.spans) != 3 {
+		t.Fatalf("spans(%v), expected 3", len(tracer.spans))
+	}
+	launch, follower, stream := tracer.spans[0], tracer.spans[1], tracer.spans[2]
+	if launch.attrs[TraceAttrPartitionID] != uint64(7) || !launch.ended {
+		t.Fatalf("launch span attrs(%v) ended(%v)", launch.attrs, launch.ended)
+	}
+	if follower.parent != "remote:"+SpanLaunchRepair {
+		t.Fatalf("follower span parent(%v), expected the launch span of the leader", follower.parent)
+	}
+	if stream.parent != SpanDoExtentStoreRepair || stream.err == nil {
+		t.Fatalf("stream span parent(%v) err(%v)", stream.parent, stream.err)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// The replicas of the partitions fetched from the master are cached by the node for a short TTL, so the
+// callers updating the replicas of a partition at once, such as the status update and a repair, share one request.
+// The replicas are asked for by the partition from the master, never from the volume view the master caches for
+// the clients. The TTL is kept far below IntervalToUpdateReplica, so a partition asking the master once an
+// interval still sees the replicas as the master had them within the TTL.
+const (
+	DefaultReplicaCacheTTL = 10 * time.Second
+)
+
+type replicaCacheEntry struct {
+	hosts     []string
+	fetchTime time.Time
+}
+
+type replicaFlight struct {
+	done  chan struct{}
+	hosts []string
+	err   error
+}
+
+// ReplicaCacheStats counts the lookups of the replica cache and the requests sent to the master since the start.
+type ReplicaCacheStats struct {
+	Entries           int    `json:"entries"`
+	TTL               int64  `json:"ttlMs"`
+	Hits              uint64 `json:"hits"`
+	Misses            uint64 `json:"misses"`
+	PartitionRequests uint64 `json:"partitionRequests"`
+}
+
+type replicaCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[uint64]*replicaCacheEntry
+	flights map[uint64]*replicaFlight
+
+	fetchPartition func(volName string, partitionID uint64) ([]string, error)
+
+	hits              uint64
+	misses            uint64
+	partitionRequests uint64
+}
+
+func newReplicaCache() *replicaCache {
+	return &replicaCache{
+		ttl:            DefaultReplicaCacheTTL,
+		entries:        make(map[uint64]*replicaCacheEntry),
+		flights:        make(map[uint64]*replicaFlight),
+		fetchPartition: fetchPartitionReplicasFromMaster,
+	}
+}
+
+func fetchPartitionReplicasFromMaster(volName string, partitionID uint64) (hosts []string, err error) {
+	var partition *proto.DataPartitionInfo
+	if partition, err = MasterClient.AdminAPI().GetDataPartition(volName, partitionID); err != nil {
+		return
+	}
+	return partition.Hosts, nil
+}
+
+func (c *replicaCache) setTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultReplicaCacheTTL
+	}
+	c.Lock()
+	c.ttl = ttl
+	c.Unlock()
+}
+
+func (c *replicaCache) lookup(partitionID uint64) (hosts []string, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.entries[partitionID]
+	if !ok || time.Since(entry.fetchTime) >= c.ttl {
+		return nil, false
+	}
+	return append([]string(nil), entry.hosts...), true
+}
+
+// Get the replicas of the partition, from the cache if fetched within the TTL. The callers missing the cache
+// at the same time share one request to the master.
+func (c *replicaCache) get(volName string, partitionID uint64) (hosts []string, err error) {
+	var ok bool
+	if hosts, ok = c.lookup(partitionID); ok {
+		atomic.AddUint64(&c.hits, 1)
+		return
+	}
+	atomic.AddUint64(&c.misses, 1)
+	c.Lock()
+	if flight, ok := c.flights[partitionID]; ok {
+		c.Unlock()
+		<-flight.done
+		return append([]string(nil), flight.hosts...), flight.err
+	}
+	flight := &replicaFlight{done: make(chan struct{})}
+	c.flights[partitionID] = flight
+	c.Unlock()
+
+	atomic.AddUint64(&c.partitionRequests, 1)
+	flight.hosts, flight.err = c.fetchPartition(volName, partitionID)
+	c.Lock()
+	// the flight invalidated on the way is left out of the cache, since its replicas may predate the change
+	if c.flights[partitionID] == flight {
+		delete(c.flights, partitionID)
+		if flight.err == nil {
+			c.entries[partitionID] = &replicaCacheEntry{hosts: flight.hosts, fetchTime: time.Now()}
+		}
+	}
+	c.Unlock()
+	close(flight.done)
+	return append([]string(nil), flight.hosts...), flight.err
+}
+
+// Drop the replicas of the partition, whose membership has changed locally. The request in flight is
+// detached too, so the next caller asks the master again.
+func (c *replicaCache) invalidate(partitionID uint64) {
+	c.Lock()
+	delete(c.entries, partitionID)
+	delete(c.flights, partitionID)
+	c.Unlock()
+}
+
+func (c *replicaCache) stats() (stats *ReplicaCacheStats) {
+	c.Lock()
+	stats = &ReplicaCacheStats{Entries: len(c.entries), TTL: int64(c.ttl / time.Millisecond)}
+	c.Unlock()
+	stats.Hits = atomic.LoadUint64(&c.hits)
+	stats.Misses = atomic.LoadUint64(&c.misses)
+	stats.PartitionRequests = atomic.LoadUint64(&c.partitionRequests)
+	return
+}
+
+func (manager *SpaceManager) SetReplicaCacheTTL(ttl time.Duration) {
+	manager.replicaCache.setTTL(ttl)
+}
+
+// ReplicaCacheStats returns the statistics of the replicas of the partitions cached by the node.
+func (manager *SpaceManager) ReplicaCacheStats() *ReplicaCacheStats {
+	return manager.replicaCache.stats()
+}
+
+// Fetch the replicas of the partition through the cache of the node. The partitions not on a disk of a space
+// manager, such as the ones of the tests, ask the master directly.
+func (dp *DataPartition) fetchReplicaHosts() (hosts []string, err error) {
+	if dp.disk != nil && dp.disk.space != nil && dp.disk.space.replicaCache != nil {
+		return dp.disk.space.replicaCache.get(dp.volumeID, dp.partitionID)
+	}
+	return fetchPartitionReplicasFromMaster(dp.volumeID, dp.partitionID)
+}
+
+func (dp *DataPartition) invalidateReplicaCache() {
+	if dp.disk != nil && dp.disk.space != nil && dp.disk.space.replicaCache != nil {
+		dp.disk.space.replicaCache.invalidate(dp.partitionID)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReplicaCache(t *testing.T) {
+	var (
+		partitionRequests int32
+		release           = make(chan struct{})
+		fetchErr          error
+	)
+	hosts := []string{"192.168.0.11:17310", "192.168.0.12:17310"}
+	cache := newReplicaCache()
+	cache.fetchPartition = func(volName string, partitionID uint64) ([]string, error) {
+		atomic.AddInt32(&partitionRequests, 1)
+		<-release
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return hosts, nil
+	}
+
+	// a burst of the callers of a partition shares one request to the master
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := cache.get("vol", 1); err != nil || len(got) != 2 {
+				t.Errorf("hosts(%v) err(%v)", got, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if partitionRequests != 1 {
+		t.Fatalf("partition requests(%v) for a burst", partitionRequests)
+	}
+	if stats := cache.stats(); stats.Entries != 1 || stats.Hits+stats.Misses != 20 || stats.PartitionRequests != 1 {
+		t.Fatalf("unexpected stats(%+v)", stats)
+	}
+
+	// a hit does not ask the master, the membership changed locally and the ttl expired refetch
+	cache.get("vol", 1)
+	if partitionRequests != 1 {
+		t.Fatalf("cached replicas fetched again")
+	}
+	cache.invalidate(1)
+	cache.get("vol", 1)
+	if partitionRequests != 2 {
+		t.Fatalf("invalidated replicas not fetched again")
+	}
+	fetchErr = errors.New("master unavailable")
+	cache.setTTL(time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	if _, err := cache.get("vol", 1); err == nil || partitionRequests != 3 {
+		t.Fatalf("err(%v) partition requests(%v) after the ttl expired", err, partitionRequests)
+	}
+	if stats := cache.stats(); stats.Entries != 1 {
+		t.Fatalf("failed request cached, stats(%+v)", stats)
+	}
+}
+
+func TestReplicaCacheInvalidateInFlight(t *testing.T) {
+	var (
+		requests int32
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+	)
+	stale, fresh := []string{"192.168.0.11:17310"}, []string{"192.168.0.12:17310"}
+	cache := newReplicaCache()
+	cache.fetchPartition = func(volName string, partitionID uint64) ([]string, error) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(started)
+			<-release
+			return stale, nil
+		}
+		return fresh, nil
+	}
+	done := make(chan []string)
+	go func() {
+		got, _ := cache.get("vol", 1)
+		done <- got
+	}()
+	<-started
+
+	// the request started before the change is not shared with the callers after it, nor cached
+	cache.invalidate(1)
+	if got, err := cache.get("vol", 1); err != nil || !reflect.DeepEqual(got, fresh) {
+		t.Fatalf("hosts(%v) err(%v) after the invalidation", got, err)
+	}
+	close(release)
+	if got := <-done; !reflect.DeepEqual(got, stale) {
+		t.Fatalf("hosts(%v) of the request in flight", got)
+	}
+	if got, _ := cache.lookup(1); !reflect.DeepEqual(got, fresh) {
+		t.Fatalf("cached hosts(%v), want %v", got, fresh)
+	}
+}
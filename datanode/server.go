@@ -34,6 +34,7 @@ import (
 	"github.com/chubaofs/chubaofs/raftstore"
 	"github.com/chubaofs/chubaofs/repl"
 	masterSDK "github.com/chubaofs/chubaofs/sdk/master"
+	"github.com/chubaofs/chubaofs/storage"
 	"github.com/chubaofs/chubaofs/util"
 	"github.com/chubaofs/chubaofs/util/config"
 	"github.com/chubaofs/chubaofs/util/exporter"
@@ -43,7 +44,12 @@ import (
 var (
 	ErrIncorrectStoreType       = errors.New("Incorrect store type")
 	ErrNoSpaceToCreatePartition = errors.New("No disk space to create a data partition")
+	ErrNoHealthyDisk            = errors.New("No disk space to create a data partition, the disks failing by SMART are excluded")
 	ErrNewSpaceManagerFailed    = errors.New("Creater new space manager failed")
+	ErrMetadataCorrupted        = errors.New("Data partition metadata checksum mismatch")
+	ErrPartitionSizeMismatch    = errors.New("Data partition size in metadata mismatches the directory name")
+	ErrPartitionFrozen          = errors.New("Data partition is frozen")
+	ErrMetadataExists           = errors.New("Data partition has a valid metadata, force to overwrite it")
 
 	LocalIP, serverPort string
 	gConnPool           = util.NewConnectPool()
@@ -53,8 +59,9 @@ var (
 const (
 	DefaultZoneName         = proto.DefaultZoneName
 	DefaultRaftDir          = "raft"
-	DefaultRaftLogsToRetain = 10 // Count of raft logs per data partition
-	DefaultDiskMaxErr       = 1
+	DefaultRaftLogsToRetain = 10           // Count of raft logs per data partition
+	DefaultDiskMaxErr       = 10           // io errors of a disk tolerated within DiskErrWindow
+	DefaultLoadConcurrency  = 8            // partitions of a disk loaded at once on the startup
 	DefaultDiskRetainMin    = 5 * util.GB  // GB
 	DefaultDiskRetainMax    = 30 * util.GB // GB
 )
@@ -72,6 +79,52 @@ const (
 	ConfigKeyRaftDir       = "raftDir"       // string
 	ConfigKeyRaftHeartbeat = "raftHeartbeat" // string
 	ConfigKeyRaftReplica   = "raftReplica"   // string
+
+	ConfigKeyRepairConcurrency   = "repairConcurrency"   // int
+	ConfigKeyUsageUpdateInterval = "usageUpdateInterval" // int, seconds
+	ConfigKeyLatencyWindow       = "latencyWindow"       // int, seconds
+	ConfigKeyReconcilePeers      = "reconcilePeers"      // bool
+	ConfigKeyRepairBandwidth     = "repairBandwidth"     // int, bytes per second, 0 means unlimited
+	ConfigKeyStatusInterval      = "statusInterval"      // int, seconds
+	ConfigKeySnapshotInterval    = "snapshotInterval"    // int, seconds
+	ConfigKeyTickerJitter        = "tickerJitter"        // bool
+	ConfigKeyEventLogFile        = "eventLogFile"        // string, file of the partition lifecycle events in json, empty to disable
+	ConfigKeyRepairTimeout       = "repairTimeout"       // int, seconds, 0 means no limit
+	ConfigKeyCreateReserveRatio  = "createReserveRatio"  // float, fraction of the disk kept free beyond a new partition
+	ConfigKeyNearFullRatio       = "nearFullRatio"       // float, fraction of the partition size to be near full
+	ConfigKeyMaxTinyRepair       = "maxTinyRepairBatch"  // int, cap of the tiny extents to repair in a cycle
+	ConfigKeyRepairVerify        = "repairVerify"        // bool, re-read the repaired normal extents to check their crcs
+	ConfigKeyMasterProbe         = "masterProbeInterval" // int, seconds between the probes of the failed masters
+	ConfigKeyDiskMaxErr          = "diskMaxErr"          // int, io errors of a disk tolerated within DiskErrWindow
+	ConfigKeyApplyHistory        = "applyHistorySize"    // int, bytes of the applied id history of a partition, 0 disables it
+	ConfigKeyRepairStoreFiles    = "repairStoreFiles"    // bool, recreate the missing extent store files of the partitions on load
+	ConfigKeyMaxActiveExtents    = "maxActiveExtents"    // int, extents of a partition above which it turns read only
+	ConfigKeyVolMaxActiveExtents = "volMaxActiveExtents" // array, VOLUME:COUNT overriding maxActiveExtents for the volumes
+	ConfigKeyExtentTTL           = "extentTTL"           // int, seconds after the creation the extents expire, 0 disables it
+	ConfigKeyVolExtentTTL        = "volExtentTTL"        // array, VOLUME:SECONDS overriding extentTTL for the volumes
+	ConfigKeyUsageBackoff        = "usageBackoffLatency" // int, ms of the p99 write latency above which the used space is recomputed less often
+	ConfigKeyLoadConcurrency     = "loadConcurrency"     // int, partitions of a disk loaded at once on the startup
+	ConfigKeyFsyncPolicy         = "fsyncPolicy"         // string, when the writes are synced: os (default), always or interval
+	ConfigKeyVolFsyncPolicy      = "volFsyncPolicy"      // array, VOLUME:POLICY overriding fsyncPolicy for the volumes
+	ConfigKeyFsyncInterval       = "fsyncInterval"       // int, ms between the syncs of the interval policy
+	ConfigKeyRepairSlots         = "repairSlots"         // int, partitions repaired at once in the order of the priority, 0 means unlimited
+	ConfigKeyVolRepairPriority   = "volRepairPriority"   // array, VOLUME:PRIORITY of high, normal (default) or low
+	ConfigKeyVolVerifiedRead     = "volVerifiedRead"     // array, volumes whose client reads are verified against the block crcs
+	ConfigKeyVerifiedReadRepair  = "verifiedReadRepair"  // bool, repair the blocks failed the verified reads by the next repair
+	ConfigKeyWarmUpSize          = "warmUpSize"          // int, MB of the hottest extents of a partition preloaded after the load, 0 disables it
+	ConfigKeyWarmUpNodeSize      = "warmUpNodeSize"      // int, MB preloaded for all the partitions of the node, 0 means no limit
+	ConfigKeyExtentShards        = "extentShards"        // int, subdirectories the normal extents of a new partition are spread over, 0 keeps them flat
+	ConfigKeyShardExtentsOnLoad  = "shardExtentsOnLoad"  // bool, migrate the extents of the loaded partitions to the layout of extentShards
+	ConfigKeyDeleteAuditSize     = "deleteAuditSize"     // int, bytes of the delete audit log of a partition, 0 disables it
+	ConfigKeyStoreQueueCapacity  = "storeQueueCapacity"  // int, store requests of a partition queued to persist the applied id
+	ConfigKeyStoreQueuePolicy    = "storeQueuePolicy"    // string, when the store queue is full: block (default) with storeQueueTimeout or reject
+	ConfigKeyStoreQueueTimeout   = "storeQueueTimeout"   // int, ms a store request waits for a full queue by the block policy
+	ConfigKeyNoSourcePolicy      = "noSourcePolicy"      // string, for the extents without a repair source: retry (default), escalate or pending
+	ConfigKeyNoSourceCycles      = "noSourceCycles"      // int, repair cycles without a source after which noSourcePolicy applies
+	ConfigKeyReplicaCacheTTL     = "replicaCacheTTL"     // int, seconds the replicas fetched from the master are cached by the node, 0 means 10
+	ConfigKeyVolEncryption       = "volEncryption"       // array, volumes whose new partitions are encrypted at rest
+	ConfigKeyVolumeKeyDir        = "volumeKeyDir"        // string, dir of the hex keys of the encrypted volumes in VOLUME.key, unless a key source is installed
+	ConfigKeyTinySize            = "tinySize"            // int, bytes of the largest file the new partitions keep in the tiny extents, 0 means 1MB
 )
 
 // DataNode defines the structure of a data node.
@@ -88,6 +141,54 @@ type DataNode struct {
 	raftReplica     string
 	raftStore       raftstore.RaftStore
 
+	repairConcurrency   int
+	usageUpdateInterval int64
+	latencyWindow       int64
+	reconcilePeers      bool
+	repairBandwidth     int64
+	statusInterval      int64
+	snapshotInterval    int64
+	tickerJitter        bool
+	eventLogFile        string
+	repairTimeout       int64
+	createReserveRatio  float64
+	nearFullRatio       float64
+	maxTinyRepair       int
+	repairVerify        bool
+	masterProbeInterval int64
+	diskMaxErr          int
+	applyHistorySize    int64
+	repairStoreFiles    bool
+	maxActiveExtents    int
+	volMaxActiveExtents map[string]int
+	extentTTL           int64
+	volExtentTTL        map[string]int64
+	usageBackoffLatency int64
+	loadConcurrency     int
+	fsyncPolicy         string
+	volFsyncPolicy      map[string]string
+	fsyncInterval       int64
+	repairSlots         int
+	volRepairPriority   map[string]int
+	volVerifiedRead     map[string]bool
+	verifiedReadRepair  bool
+	warmUpSize          int64
+	warmUpNodeSize      int64
+	extentShards        int
+	shardExtentsOnLoad  bool
+	deleteAuditSize     int64
+	storeQueueCapacity  int
+	storeQueuePolicy    string
+	storeQueueTimeout   int64
+	noSourcePolicy      string
+	noSourceCycles      int
+	replicaCacheTTL     int64
+	volEncryption       map[string]bool
+	volumeKeyDir        string
+	volumeKeySource     VolumeKeySource
+	tinySize            int
+	diskHealthSource    DiskHealthSource
+
 	tcpListener net.Listener
 	stopC       chan bool
 
@@ -127,7 +228,15 @@ func doStart(server common.Server, cfg *config.Config) (err error) {
 		return
 	}
 
+	// fail over among the masters, and probe the failed ones to move back once they recover
+	MasterClient.StartHealthProbe(time.Duration(s.masterProbeInterval)*time.Second, s.stopC)
+
 	exporter.Init(ModuleName, cfg)
+	if s.eventLogFile != "" {
+		if err = partitionEventLog.open(s.eventLogFile); err != nil {
+			return
+		}
+	}
 	s.register(cfg)
 
 	// start the raft server
@@ -139,6 +248,7 @@ func doStart(server common.Server, cfg *config.Config) (err error) {
 	if err = s.startSpaceManager(cfg); err != nil {
 		return
 	}
+	exporter.RegisterCollector(newPartitionCollector(s.space))
 
 	// check local partition compare with master ,if lack,then not start
 	if err = s.checkLocalPartitionMatchWithMaster(); err != nil {
@@ -163,7 +273,11 @@ func doShutdown(server common.Server) {
 	}
 	close(s.stopC)
 	s.stopTCPService()
+	if s.space != nil {
+		s.space.DrainPartitions(DefaultDrainTimeout)
+	}
 	s.stopRaftServer()
+	partitionEventLog.close()
 }
 
 func (s *DataNode) parseConfig(cfg *config.Config) (err error) {
@@ -191,9 +305,210 @@ func (s *DataNode) parseConfig(cfg *config.Config) (err error) {
 	if s.zoneName == "" {
 		s.zoneName = DefaultZoneName
 	}
+	s.repairConcurrency = int(cfg.GetInt64(ConfigKeyRepairConcurrency))
+	if s.repairConcurrency < 0 || s.repairConcurrency > MaxNumOfFilesToRecoverInParallel {
+		return fmt.Errorf("Err:%v must be between 0 and %v", ConfigKeyRepairConcurrency, MaxNumOfFilesToRecoverInParallel)
+	}
+	if s.usageUpdateInterval = cfg.GetInt64(ConfigKeyUsageUpdateInterval); s.usageUpdateInterval < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyUsageUpdateInterval)
+	}
+	s.latencyWindow = cfg.GetInt64(ConfigKeyLatencyWindow)
+	if s.latencyWindow != 0 && s.latencyWindow < MinLatencyWindow {
+		return fmt.Errorf("Err:%v must not be less than %v", ConfigKeyLatencyWindow, MinLatencyWindow)
+	}
+	s.reconcilePeers = cfg.GetBool(ConfigKeyReconcilePeers)
+	if s.repairBandwidth = cfg.GetInt64(ConfigKeyRepairBandwidth); s.repairBandwidth < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyRepairBandwidth)
+	}
+	if s.statusInterval = cfg.GetInt64(ConfigKeyStatusInterval); s.statusInterval < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyStatusInterval)
+	}
+	if s.snapshotInterval = cfg.GetInt64(ConfigKeySnapshotInterval); s.snapshotInterval < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeySnapshotInterval)
+	}
+	s.tickerJitter = cfg.GetBool(ConfigKeyTickerJitter)
+	s.eventLogFile = cfg.GetString(ConfigKeyEventLogFile)
+	if s.repairTimeout = cfg.GetInt64(ConfigKeyRepairTimeout); s.repairTimeout < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyRepairTimeout)
+	}
+	// a negative ratio means it is absent from the config file
+	if s.createReserveRatio = cfg.GetFloat(ConfigKeyCreateReserveRatio); s.createReserveRatio < 0 {
+		s.createReserveRatio = DefaultCreateReserveRatio
+	}
+	if s.createReserveRatio >= 1 {
+		return fmt.Errorf("Err:%v must be less than 1", ConfigKeyCreateReserveRatio)
+	}
+	if s.nearFullRatio = cfg.GetFloat(ConfigKeyNearFullRatio); s.nearFullRatio < 0 {
+		s.nearFullRatio = DefaultNearFullRatio
+	}
+	if s.nearFullRatio == 0 || s.nearFullRatio > 1 {
+		return fmt.Errorf("Err:%v must be in (0, 1]", ConfigKeyNearFullRatio)
+	}
+	if s.maxTinyRepair = int(cfg.GetInt64(ConfigKeyMaxTinyRepair)); s.maxTinyRepair == 0 {
+		s.maxTinyRepair = DefaultMaxTinyExtentsToRepair
+	}
+	if s.maxTinyRepair < MinTinyExtentsToRepair || s.maxTinyRepair > storage.TinyExtentCount {
+		return fmt.Errorf("Err:%v must be in [%v, %v]", ConfigKeyMaxTinyRepair, MinTinyExtentsToRepair,
+			storage.TinyExtentCount)
+	}
+	s.repairVerify = cfg.GetBool(ConfigKeyRepairVerify)
+	if s.masterProbeInterval = cfg.GetInt64(ConfigKeyMasterProbe); s.masterProbeInterval < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyMasterProbe)
+	}
+	if s.diskMaxErr = int(cfg.GetInt64(ConfigKeyDiskMaxErr)); s.diskMaxErr == 0 {
+		s.diskMaxErr = DefaultDiskMaxErr
+	}
+	if s.diskMaxErr < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyDiskMaxErr)
+	}
+	if s.applyHistorySize = cfg.GetInt64(ConfigKeyApplyHistory); s.applyHistorySize < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyApplyHistory)
+	}
+	s.repairStoreFiles = cfg.GetBool(ConfigKeyRepairStoreFiles)
+	if s.maxActiveExtents = int(cfg.GetInt64(ConfigKeyMaxActiveExtents)); s.maxActiveExtents == 0 {
+		s.maxActiveExtents = storage.MaxExtentCount
+	}
+	if s.maxActiveExtents < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyMaxActiveExtents)
+	}
+	if s.volMaxActiveExtents, err = parseVolMaxActiveExtents(cfg.GetSlice(ConfigKeyVolMaxActiveExtents)); err != nil {
+		return
+	}
+	if s.extentTTL = cfg.GetInt64(ConfigKeyExtentTTL); s.extentTTL < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyExtentTTL)
+	}
+	if s.volExtentTTL, err = parseVolExtentTTL(cfg.GetSlice(ConfigKeyVolExtentTTL)); err != nil {
+		return
+	}
+	if s.usageBackoffLatency = cfg.GetInt64(ConfigKeyUsageBackoff); s.usageBackoffLatency < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyUsageBackoff)
+	}
+	if s.loadConcurrency = int(cfg.GetInt64(ConfigKeyLoadConcurrency)); s.loadConcurrency == 0 {
+		s.loadConcurrency = DefaultLoadConcurrency
+	}
+	if s.loadConcurrency < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyLoadConcurrency)
+	}
+	if s.fsyncPolicy = cfg.GetString(ConfigKeyFsyncPolicy); s.fsyncPolicy == "" {
+		s.fsyncPolicy = FsyncPolicyOS
+	}
+	if !isValidFsyncPolicy(s.fsyncPolicy) {
+		return fmt.Errorf("Err:%v must be one of %v, %v and %v", ConfigKeyFsyncPolicy,
+			FsyncPolicyOS, FsyncPolicyAlways, FsyncPolicyInterval)
+	}
+	if s.volFsyncPolicy, err = parseVolFsyncPolicy(cfg.GetSlice(ConfigKeyVolFsyncPolicy)); err != nil {
+		return
+	}
+	if s.fsyncInterval = cfg.GetInt64(ConfigKeyFsyncInterval); s.fsyncInterval < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyFsyncInterval)
+	}
+	if s.repairSlots = int(cfg.GetInt64(ConfigKeyRepairSlots)); s.repairSlots < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyRepairSlots)
+	}
+	if s.volRepairPriority, err = parseVolRepairPriority(cfg.GetSlice(ConfigKeyVolRepairPriority)); err != nil {
+		return
+	}
+	if s.volVerifiedRead, err = parseVolVerifiedRead(cfg.GetSlice(ConfigKeyVolVerifiedRead)); err != nil {
+		return
+	}
+	s.verifiedReadRepair = cfg.GetBool(ConfigKeyVerifiedReadRepair)
+	if s.warmUpSize = cfg.GetInt64(ConfigKeyWarmUpSize); s.warmUpSize < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyWarmUpSize)
+	}
+	if s.warmUpNodeSize = cfg.GetInt64(ConfigKeyWarmUpNodeSize); s.warmUpNodeSize < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyWarmUpNodeSize)
+	}
+	if s.extentShards = int(cfg.GetInt64(ConfigKeyExtentShards)); s.extentShards < 0 || s.extentShards > storage.MaxExtentShards {
+		return fmt.Errorf("Err:%v must be within [0, %v]", ConfigKeyExtentShards, storage.MaxExtentShards)
+	}
+	s.shardExtentsOnLoad = cfg.GetBool(ConfigKeyShardExtentsOnLoad)
+	if s.deleteAuditSize = cfg.GetInt64(ConfigKeyDeleteAuditSize); s.deleteAuditSize < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyDeleteAuditSize)
+	}
+	if s.storeQueueCapacity = int(cfg.GetInt64(ConfigKeyStoreQueueCapacity)); s.storeQueueCapacity == 0 {
+		s.storeQueueCapacity = DefaultStoreQueueCapacity
+	}
+	if s.storeQueueCapacity < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyStoreQueueCapacity)
+	}
+	if s.storeQueuePolicy = cfg.GetString(ConfigKeyStoreQueuePolicy); s.storeQueuePolicy == "" {
+		s.storeQueuePolicy = StoreQueuePolicyBlock
+	}
+	if !isValidStoreQueuePolicy(s.storeQueuePolicy) {
+		return fmt.Errorf("Err:%v must be one of %v and %v", ConfigKeyStoreQueuePolicy,
+			StoreQueuePolicyBlock, StoreQueuePolicyReject)
+	}
+	if s.storeQueueTimeout = cfg.GetInt64(ConfigKeyStoreQueueTimeout); s.storeQueueTimeout < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyStoreQueueTimeout)
+	}
+	if s.noSourcePolicy = cfg.GetString(ConfigKeyNoSourcePolicy); s.noSourcePolicy == "" {
+		s.noSourcePolicy = NoSourcePolicyRetry
+	}
+	if !isValidNoSourcePolicy(s.noSourcePolicy) {
+		return fmt.Errorf("Err:%v must be one of %v, %v and %v", ConfigKeyNoSourcePolicy,
+			NoSourcePolicyRetry, NoSourcePolicyEscalate, NoSourcePolicyPending)
+	}
+	if s.noSourceCycles = int(cfg.GetInt64(ConfigKeyNoSourceCycles)); s.noSourceCycles < 0 {
+		return fmt.Errorf("Err:%v must not be negative", ConfigKeyNoSourceCycles)
+	}
+	if s.replicaCacheTTL = cfg.GetInt64(ConfigKeyReplicaCacheTTL); s.replicaCacheTTL < 0 || s.replicaCacheTTL >= IntervalToUpdateReplica {
+		return fmt.Errorf("Err:%v must be within [0, %v)", ConfigKeyReplicaCacheTTL, IntervalToUpdateReplica)
+	}
+	if s.volEncryption, err = parseVolEncryption(cfg.GetSlice(ConfigKeyVolEncryption)); err != nil {
+		return
+	}
+	if s.volumeKeyDir = cfg.GetString(ConfigKeyVolumeKeyDir); s.volumeKeySource == nil && s.volumeKeyDir != "" {
+		s.volumeKeySource = keyDirSource(s.volumeKeyDir)
+	}
+	if len(s.volEncryption) > 0 && s.volumeKeySource == nil {
+		return fmt.Errorf("Err:%v needs %v or a volume key source", ConfigKeyVolEncryption, ConfigKeyVolumeKeyDir)
+	}
+	if s.tinySize = int(cfg.GetInt64(ConfigKeyTinySize)); s.tinySize == 0 {
+		s.tinySize = util.DefaultTinySizeLimit
+	}
+	if err = checkTinySize(s.tinySize); err != nil {
+		return fmt.Errorf("Err:%v %v", ConfigKeyTinySize, err)
+	}
 	log.LogDebugf("action[parseConfig] load masterAddrs(%v).", MasterClient.Nodes())
 	log.LogDebugf("action[parseConfig] load port(%v).", s.port)
 	log.LogDebugf("action[parseConfig] load zoneName(%v).", s.zoneName)
+	log.LogDebugf("action[parseConfig] load repairConcurrency(%v).", s.repairConcurrency)
+	log.LogDebugf("action[parseConfig] load usageUpdateInterval(%v).", s.usageUpdateInterval)
+	log.LogDebugf("action[parseConfig] load latencyWindow(%v).", s.latencyWindow)
+	log.LogDebugf("action[parseConfig] load reconcilePeers(%v).", s.reconcilePeers)
+	log.LogDebugf("action[parseConfig] load repairBandwidth(%v).", s.repairBandwidth)
+	log.LogDebugf("action[parseConfig] load statusInterval(%v) snapshotInterval(%v) tickerJitter(%v).",
+		s.statusInterval, s.snapshotInterval, s.tickerJitter)
+	log.LogDebugf("action[parseConfig] load eventLogFile(%v).", s.eventLogFile)
+	log.LogDebugf("action[parseConfig] load repairTimeout(%v).", s.repairTimeout)
+	log.LogDebugf("action[parseConfig] load createReserveRatio(%v).", s.createReserveRatio)
+	log.LogDebugf("action[parseConfig] load nearFullRatio(%v).", s.nearFullRatio)
+	log.LogDebugf("action[parseConfig] load maxTinyRepairBatch(%v).", s.maxTinyRepair)
+	log.LogDebugf("action[parseConfig] load repairVerify(%v).", s.repairVerify)
+	log.LogDebugf("action[parseConfig] load masterProbeInterval(%v).", s.masterProbeInterval)
+	log.LogDebugf("action[parseConfig] load diskMaxErr(%v).", s.diskMaxErr)
+	log.LogDebugf("action[parseConfig] load applyHistorySize(%v).", s.applyHistorySize)
+	log.LogDebugf("action[parseConfig] load repairStoreFiles(%v).", s.repairStoreFiles)
+	log.LogDebugf("action[parseConfig] load maxActiveExtents(%v) volMaxActiveExtents(%v).",
+		s.maxActiveExtents, s.volMaxActiveExtents)
+	log.LogDebugf("action[parseConfig] load extentTTL(%v) volExtentTTL(%v).", s.extentTTL, s.volExtentTTL)
+	log.LogDebugf("action[parseConfig] load usageBackoffLatency(%v).", s.usageBackoffLatency)
+	log.LogDebugf("action[parseConfig] load loadConcurrency(%v).", s.loadConcurrency)
+	log.LogDebugf("action[parseConfig] load fsyncPolicy(%v) volFsyncPolicy(%v) fsyncInterval(%v).",
+		s.fsyncPolicy, s.volFsyncPolicy, s.fsyncInterval)
+	log.LogDebugf("action[parseConfig] load repairSlots(%v) volRepairPriority(%v).", s.repairSlots, s.volRepairPriority)
+	log.LogDebugf("action[parseConfig] load volVerifiedRead(%v) verifiedReadRepair(%v).",
+		s.volVerifiedRead, s.verifiedReadRepair)
+	log.LogDebugf("action[parseConfig] load warmUpSize(%v) warmUpNodeSize(%v).", s.warmUpSize, s.warmUpNodeSize)
+	log.LogDebugf("action[parseConfig] load extentShards(%v) shardExtentsOnLoad(%v).", s.extentShards, s.shardExtentsOnLoad)
+	log.LogDebugf("action[parseConfig] load deleteAuditSize(%v).", s.deleteAuditSize)
+	log.LogDebugf("action[parseConfig] load storeQueueCapacity(%v) storeQueuePolicy(%v) storeQueueTimeout(%v).",
+		s.storeQueueCapacity, s.storeQueuePolicy, s.storeQueueTimeout)
+	log.LogDebugf("action[parseConfig] load noSourcePolicy(%v) noSourceCycles(%v).",
+		s.noSourcePolicy, s.noSourceCycles)
+	log.LogDebugf("action[parseConfig] load replicaCacheTTL(%v).", s.replicaCacheTTL)
+	log.LogDebugf("action[parseConfig] load volEncryption(%v) volumeKeyDir(%v).", s.volEncryption, s.volumeKeyDir)
+	log.LogDebugf("action[parseConfig] load tinySize(%v).", s.tinySize)
 	return
 }
 
@@ -207,15 +522,45 @@ func (s *DataNode) startSpaceManager(cfg *config.Config) (err error) {
 	s.space.SetRaftStore(s.raftStore)
 	s.space.SetNodeID(s.nodeID)
 	s.space.SetClusterID(s.clusterID)
-
+	s.space.SetRepairConcurrency(s.repairConcurrency)
+	s.space.SetUsageUpdateInterval(s.usageUpdateInterval)
+	s.space.SetLatencyWindow(s.latencyWindow)
+	s.space.SetReconcilePeers(s.reconcilePeers)
+	s.space.SetRepairBandwidth(s.repairBandwidth)
+	s.space.SetTickerIntervals(s.statusInterval, s.snapshotInterval, s.tickerJitter)
+	s.space.SetRepairTimeout(s.repairTimeout)
+	s.space.SetCreateReserveRatio(s.createReserveRatio)
+	s.space.SetNearFullRatio(s.nearFullRatio)
+	s.space.SetMaxTinyRepair(s.maxTinyRepair)
+	s.space.SetRepairVerify(s.repairVerify)
+	s.space.SetApplyHistorySize(s.applyHistorySize)
+	s.space.SetRepairStoreFiles(s.repairStoreFiles)
+	s.space.SetMaxActiveExtents(s.maxActiveExtents, s.volMaxActiveExtents)
+	s.space.SetExtentTTL(s.extentTTL, s.volExtentTTL)
+	s.space.SetUsageBackoffLatency(time.Duration(s.usageBackoffLatency) * time.Millisecond)
+	s.space.SetLoadConcurrency(s.loadConcurrency)
+	s.space.SetFsyncPolicy(s.fsyncPolicy, s.volFsyncPolicy, time.Duration(s.fsyncInterval)*time.Millisecond)
+	s.space.SetRepairPriority(s.repairSlots, s.volRepairPriority)
+	s.space.SetVerifiedRead(s.volVerifiedRead, s.verifiedReadRepair)
+	s.space.SetWarmUpSize(s.warmUpSize*util.MB, s.warmUpNodeSize*util.MB)
+	s.space.SetExtentShards(s.extentShards, s.shardExtentsOnLoad)
+	s.space.SetDeleteAuditSize(s.deleteAuditSize)
+	s.space.SetStoreQueue(s.storeQueueCapacity, s.storeQueuePolicy, time.Duration(s.storeQueueTimeout)*time.Millisecond)
+	s.space.SetNoSourcePolicy(s.noSourcePolicy, s.noSourceCycles)
+	s.space.SetReplicaCacheTTL(time.Duration(s.replicaCacheTTL) * time.Second)
+	s.space.SetEncryption(s.volEncryption, s.volumeKeySource)
+	s.space.SetDiskHealthSource(s.diskHealthSource)
+	s.space.SetTinySize(s.tinySize)
+
+	start := time.Now()
 	var wg sync.WaitGroup
 	for _, d := range cfg.GetSlice(ConfigKeyDisks) {
 		log.LogDebugf("action[startSpaceManager] load disk raw config(%v).", d)
 
-		// format "PATH:RESET_SIZE
+		// format "PATH:RESET_SIZE[:SECTOR_SIZE]
 		arr := strings.Split(d.(string), ":")
-		if len(arr) != 2 {
-			return errors.New("Invalid disk configuration. Example: PATH:RESERVE_SIZE")
+		if len(arr) != 2 && len(arr) != 3 {
+			return errors.New("Invalid disk configuration. Example: PATH:RESERVE_SIZE[:SECTOR_SIZE]")
 		}
 		path := arr[0]
 		fileInfo, err := os.Stat(path)
@@ -225,6 +570,9 @@ func (s *DataNode) startSpaceManager(cfg *config.Config) (err error) {
 		if !fileInfo.IsDir() {
 			return errors.New("Disk path is not dir")
 		}
+		if err = checkActiveExtentsLimit(path, s.space.maxActiveExtentsUpperBound()); err != nil {
+			return err
+		}
 		reservedSpace, err := strconv.ParseUint(arr[1], 10, 64)
 		if err != nil {
 			return errors.New(fmt.Sprintf("Invalid disk reserved space. Error: %s", err.Error()))
@@ -233,14 +581,32 @@ func (s *DataNode) startSpaceManager(cfg *config.Config) (err error) {
 		if reservedSpace < DefaultDiskRetainMin {
 			reservedSpace = DefaultDiskRetainMin
 		}
+		sectorSize := int64(DiskSectorSize)
+		if len(arr) == 3 {
+			if sectorSize, err = strconv.ParseInt(arr[2], 10, 64); err != nil {
+				return errors.New(fmt.Sprintf("Invalid disk sector size. Error: %s", err.Error()))
+			}
+			// stat counts the blocks in 512 bytes on Linux whatever the sector size of the disk
+			if sectorSize != DiskSectorSize {
+				return errors.New(fmt.Sprintf("Invalid disk sector size(%v), the blocks are counted in %v bytes",
+					sectorSize, DiskSectorSize))
+			}
+		}
 
 		wg.Add(1)
-		go func(wg *sync.WaitGroup, path string, reservedSpace uint64) {
+		go func(wg *sync.WaitGroup, path string, reservedSpace uint64, sectorSize int64) {
 			defer wg.Done()
-			s.space.LoadDisk(path, reservedSpace, DefaultDiskMaxErr)
-		}(&wg, path, reservedSpace)
+			s.space.LoadDisk(path, reservedSpace, sectorSize, s.diskMaxErr)
+		}(&wg, path, reservedSpace, sectorSize)
 	}
 	wg.Wait()
+	loaded := 0
+	s.space.RangePartitions(func(partition *DataPartition) bool {
+		loaded++
+		return true
+	})
+	log.LogInfof("action[startSpaceManager] loaded(%v) partitions failed(%v) on disks(%v) cost(%v).",
+		loaded, len(s.space.LoadFailures()), len(cfg.GetSlice(ConfigKeyDisks)), time.Since(start))
 	return nil
 }
 
@@ -339,11 +705,56 @@ func (s *DataNode) registerHandler() {
 	http.HandleFunc("/disks", s.getDiskAPI)
 	http.HandleFunc("/partitions", s.getPartitionsAPI)
 	http.HandleFunc("/partition", s.getPartitionAPI)
+	http.HandleFunc("/partitionMetadata", s.getPartitionMetadataAPI)
 	http.HandleFunc("/extent", s.getExtentAPI)
 	http.HandleFunc("/block", s.getBlockCrcAPI)
 	http.HandleFunc("/stats", s.getStatAPI)
 	http.HandleFunc("/raftStatus", s.getRaftStatus)
 	http.HandleFunc("/setAutoRepairStatus", s.setAutoRepairStatus)
+	http.HandleFunc("/repairStats", s.getRepairStatsAPI)
+	http.HandleFunc("/repairingPartitions", s.getRepairingPartitionsAPI)
+	http.HandleFunc("/flushPartitions", s.flushPartitionsAPI)
+	http.HandleFunc("/transferLeadership", s.transferLeadershipAPI)
+	http.HandleFunc("/partitionsGrowth", s.getPartitionsGrowthAPI)
+	http.HandleFunc("/setRepairConcurrency", s.setRepairConcurrency)
+	http.HandleFunc("/repairPlan", s.getRepairPlanAPI)
+	http.HandleFunc("/fragmentation", s.getFragmentationAPI)
+	http.HandleFunc("/repair", s.launchRepair)
+	http.HandleFunc("/partitionSpace", s.getPartitionSpaceAPI)
+	http.HandleFunc("/raftProgress", s.getRaftProgressAPI)
+	http.HandleFunc("/raftLeader", s.getRaftLeaderAPI)
+	http.HandleFunc("/partitionHealth", s.getPartitionHealthAPI)
+	http.HandleFunc("/compactTinyExtents", s.compactTinyExtentsAPI)
+	http.HandleFunc("/quarantinedExtents", s.quarantinedExtentsAPI)
+	http.HandleFunc("/noSourceExtents", s.noSourceExtentsAPI)
+	http.HandleFunc("/activeRepairs", s.activeRepairsAPI)
+	http.HandleFunc("/topExtents", s.topExtentsAPI)
+	http.HandleFunc("/applyHistory", s.applyHistoryAPI)
+	http.HandleFunc("/deleteAudit", s.deleteAuditAPI)
+	http.HandleFunc("/verifyRaft", s.verifyRaftAPI)
+	http.HandleFunc("/resizePartition", s.resizePartitionAPI)
+	http.HandleFunc("/freezePartition", s.freezePartitionAPI)
+	http.HandleFunc("/manualReadOnly", s.manualReadOnlyAPI)
+	http.HandleFunc("/extentTTL", s.extentTTLAPI)
+	http.HandleFunc("/membershipMismatches", s.membershipMismatchesAPI)
+	http.HandleFunc("/replicaCache", s.replicaCacheAPI)
+	http.HandleFunc("/usageBackoff", s.getUsageBackoffAPI)
+	http.HandleFunc("/loadFailures", s.getLoadFailuresAPI)
+	http.HandleFunc("/coldExtents", s.coldExtentsAPI)
+	http.HandleFunc("/extentOwners", s.extentOwnersAPI)
+	http.HandleFunc("/fsyncPolicy", s.getFsyncPolicyAPI)
+	http.HandleFunc("/repairOrder", s.getRepairOrderAPI)
+	http.HandleFunc("/verifiedRead", s.verifiedReadAPI)
+	http.HandleFunc("/movePartition", s.movePartitionAPI)
+	http.HandleFunc("/warmUp", s.getWarmUpAPI)
+	http.HandleFunc("/partitionUptime", s.getPartitionUptimeAPI)
+	http.HandleFunc("/scrub", s.scrubExtentsAPI)
+	http.HandleFunc("/diffSnapshot", s.diffSnapshotAPI)
+	http.HandleFunc("/snapshot", s.getSnapshotAPI)
+	http.HandleFunc("/setRepairBandwidth", s.setRepairBandwidth)
+	http.HandleFunc("/repairPartitionSize", s.repairPartitionSize)
+	http.HandleFunc("/rebuildMetadata", s.rebuildMetadataAPI)
+	http.HandleFunc("/diskStatus", s.getDiskStatusAPI)
 }
 
 func (s *DataNode) startTCPService() (err error) {
@@ -17,11 +17,17 @@ package datanode
 import (
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
 	"net/http"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/storage"
+	"github.com/chubaofs/chubaofs/util"
 	"github.com/tiglabs/raft"
 )
 
@@ -42,6 +48,8 @@ func (s *DataNode) getDiskAPI(w http.ResponseWriter, r *http.Request) {
 			Status      int    `json:"status"`
 			RestSize    uint64 `json:"restSize"`
 			Partitions  int    `json:"partitions"`
+			Health      string `json:"health"`
+			HealthInfo  string `json:"healthInfo"`
 		}{
 			Path:        diskItem.Path,
 			Total:       diskItem.Total,
@@ -53,6 +61,7 @@ func (s *DataNode) getDiskAPI(w http.ResponseWriter, r *http.Request) {
 			RestSize:    diskItem.ReservedSpace,
 			Partitions:  diskItem.PartitionCount(),
 		}
+		disk.Health, disk.HealthInfo = diskItem.Health()
 		disks = append(disks, disk)
 	}
 	diskReport := &struct {
@@ -171,6 +180,7 @@ func (s *DataNode) getPartitionAPI(w http.ResponseWriter, r *http.Request) {
 		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	frozen, frozenReason := partition.IsFrozen()
 	result := &struct {
 		VolName              string                `json:"volName"`
 		ID                   uint64                `json:"id"`
@@ -183,6 +193,14 @@ func (s *DataNode) getPartitionAPI(w http.ResponseWriter, r *http.Request) {
 		Replicas             []string              `json:"replicas"`
 		TinyDeleteRecordSize int64                 `json:"tinyDeleteRecordSize"`
 		RaftStatus           *raft.Status          `json:"raftStatus"`
+		CreateTime           string                `json:"createTime"`
+		NearFull             bool                  `json:"nearFull"`
+		Frozen               bool                  `json:"frozen"`
+		FrozenReason         string                `json:"frozenReason"`
+		RepairPriority       string                `json:"repairPriority"`
+		Idle                 bool                  `json:"idle"`
+		Encrypted            bool                  `json:"encrypted"`
+		TinySize             int                   `json:"tinySize"`
 	}{
 		VolName:              partition.volumeID,
 		ID:                   partition.partitionID,
@@ -194,7 +212,1493 @@ func (s *DataNode) getPartitionAPI(w http.ResponseWriter, r *http.Request) {
 		FileCount:            len(files),
 		Replicas:             partition.Replicas(),
 		TinyDeleteRecordSize: tinyDeleteRecordSize,
-		RaftStatus:           partition.raftPartition.Status(),
+		RaftStatus:           partition.RaftStatus(),
+		CreateTime:           partition.createTime,
+		NearFull:             partition.IsNearFull(),
+		Frozen:               frozen,
+		FrozenReason:         frozenReason,
+		RepairPriority:       RepairPriorityName(partition.RepairPriority()),
+		Idle:                 partition.IsIdle(),
+		Encrypted:            partition.IsEncrypted(),
+		TinySize:             partition.TinySize(),
+	}
+	s.buildSuccessResp(w, result)
+}
+
+// Return the metadata persisted in the META file of a partition, with the peers sorted by the id,
+// so the metadata of the replicas can be compared.
+func (s *DataNode) getPartitionMetadataAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	meta, err := readMetadataFile(path.Join(partition.Path(), DataPartitionMetadataFileName))
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sp := sortedPeers(meta.Peers)
+	sort.Sort(sp)
+	s.buildSuccessResp(w, meta)
+}
+
+func (s *DataNode) getRepairStatsAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	s.buildSuccessResp(w, buildRepairStatsResp(partition))
+}
+
+func (s *DataNode) getRepairingPartitionsAPI(w http.ResponseWriter, r *http.Request) {
+	s.buildSuccessResp(w, s.space.PartitionsNeedingRepair())
+}
+
+// List the growth rates of the partitions, the ones to be full first come first.
+func (s *DataNode) getPartitionsGrowthAPI(w http.ResponseWriter, r *http.Request) {
+	s.buildSuccessResp(w, s.space.PartitionsGrowth())
+}
+
+// Show how much the recomputation of the used space of the partitions backs off under the write latency.
+func (s *DataNode) getUsageBackoffAPI(w http.ResponseWriter, r *http.Request) {
+	s.buildSuccessResp(w, s.space.GetUsageBackoff())
+}
+
+// List the partitions failed to be loaded on the startup of the data node.
+func (s *DataNode) getLoadFailuresAPI(w http.ResponseWriter, r *http.Request) {
+	s.buildSuccessResp(w, s.space.LoadFailures())
+}
+
+func (s *DataNode) flushPartitionsAPI(w http.ResponseWriter, r *http.Request) {
+	s.buildSuccessResp(w, s.space.FlushPartitions())
+}
+
+// Transfer the leadership of a partition to the given follower, or of all the partitions led by the node to the
+// best followers if no partition is given.
+func (s *DataNode) transferLeadershipAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramTarget      = "target"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.FormValue(paramPartitionID) == "" {
+		s.buildSuccessResp(w, s.space.TransferLeaderships())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	targetID, err := strconv.ParseUint(r.FormValue(paramTarget), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramTarget, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	if err = partition.TransferLeadership(targetID); err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	leader, _ := partition.GetRaftLeader()
+	s.buildSuccessResp(w, leader)
+}
+
+type repairStatsResp struct {
+	ID                 uint64 `json:"id"`
+	JobID              string `json:"jobID"`
+	Repairing          bool   `json:"repairing"`
+	ExtentsCreated     uint64 `json:"extentsCreated"`
+	ExtentsRepaired    uint64 `json:"extentsRepaired"`
+	BytesTransferred   uint64 `json:"bytesTransferred"`
+	LastRepairDuration int64  `json:"lastRepairDurationMs"`
+	ReadRepairs        uint64 `json:"readRepairs"`
+	TinyRepairBatch    int    `json:"tinyRepairBatch"`
+	NoSourceExtents    int    `json:"noSourceExtents"`
+	Finished           bool   `json:"finished,omitempty"` // the repair launched by the request finished within the wait
+}
+
+func buildRepairStatsResp(partition *DataPartition) *repairStatsResp {
+	stats := partition.GetRepairStats()
+	return &repairStatsResp{
+		ID:                 partition.partitionID,
+		JobID:              partition.RepairJobID(),
+		Repairing:          partition.IsRepairing(),
+		ExtentsCreated:     stats.ExtentsCreated,
+		ExtentsRepaired:    stats.ExtentsRepaired,
+		BytesTransferred:   stats.BytesTransferred,
+		LastRepairDuration: int64(stats.LastRepairDuration / time.Millisecond),
+		ReadRepairs:        partition.metrics.ReadRepairs(),
+		TinyRepairBatch:    partition.TinyRepairBatchSize(),
+		NoSourceExtents:    partition.NoSourceExtentCount(),
+	}
+}
+
+func (s *DataNode) launchRepair(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramExtentType  = "extentType"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	extentType, err := parseExtentType(r.FormValue(paramExtentType))
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramExtentType, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	jobID, finished, err := partition.LaunchManualRepair(extentType, ManualRepairWaitTime*time.Second)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp := buildRepairStatsResp(partition)
+	resp.JobID, resp.Finished = jobID, finished
+	s.buildSuccessResp(w, resp)
+}
+
+func parseExtentType(value string) (extentType uint8, err error) {
+	switch value {
+	case "", "normal":
+		extentType = proto.NormalExtentType
+	case "tiny":
+		extentType = proto.TinyExtentType
+	default:
+		err = fmt.Errorf("unknown extent type %v", value)
+	}
+	return
+}
+
+func (s *DataNode) setRepairConcurrency(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramConcurrency = "concurrency"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	concurrency, err := strconv.Atoi(r.FormValue(paramConcurrency))
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramConcurrency, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	if err = partition.SetRepairConcurrency(concurrency); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, partition.RepairConcurrency())
+}
+
+// Set the bytes per second read from the peers by the repairs on the data node, 0 disables the limit.
+func (s *DataNode) setRepairBandwidth(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramBandwidth = "bandwidth"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bandwidth, err := strconv.ParseInt(r.FormValue(paramBandwidth), 10, 64)
+	if err != nil || bandwidth < 0 {
+		err = fmt.Errorf("parse param %v fail: %v", paramBandwidth, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.space.SetRepairBandwidth(bandwidth)
+	s.buildSuccessResp(w, s.space.GetRepairBandwidth())
+}
+
+// Rewrite the partition size in the metadata of a partition which failed to load because of the size mismatch.
+// Nothing is changed unless confirm is set, so the operator can check the sizes first.
+func (s *DataNode) repairPartitionSize(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramDisk        = "disk"
+		paramPartitionID = "id"
+		paramConfirm     = "confirm"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var confirm bool
+	if r.FormValue(paramConfirm) != "" {
+		if confirm, err = strconv.ParseBool(r.FormValue(paramConfirm)); err != nil {
+			err = fmt.Errorf("parse param %v fail: %v", paramConfirm, err)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if s.space.Partition(partitionID) != nil {
+		s.buildFailureResp(w, http.StatusConflict, "partition already loaded")
+		return
+	}
+	disk, err := s.space.GetDisk(r.FormValue(paramDisk))
+	if err != nil {
+		s.buildFailureResp(w, http.StatusNotFound, err.Error())
+		return
+	}
+	partitionDir, err := disk.findPartitionDir(partitionID)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusNotFound, err.Error())
+		return
+	}
+	meta, err := loadMetadata(partitionDir)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	dirSize, err := checkPartitionSize(partitionDir, meta)
+	if err != nil && err != ErrPartitionSizeMismatch {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result := &struct {
+		Path     string `json:"path"`
+		MetaSize int    `json:"metaSize"`
+		DirSize  int    `json:"dirSize"`
+		Repaired bool   `json:"repaired"`
+	}{
+		Path:     partitionDir,
+		MetaSize: meta.PartitionSize,
+		DirSize:  dirSize,
+	}
+	if err == nil || !confirm {
+		s.buildSuccessResp(w, result)
+		return
+	}
+	if _, err = RepairPartitionSize(partitionDir); err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result.Repaired = true
+	if _, err = LoadDataPartition(partitionDir, disk); err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, fmt.Sprintf("metadata repaired but load partition failed: %v", err))
+		return
+	}
+	s.buildSuccessResp(w, result)
+}
+
+// Rebuild the lost metadata of a partition not loaded from its directory name and the given volume and peers,
+// and load the partition with it.
+func (s *DataNode) rebuildMetadataAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramDir    = "dir"
+		paramVolume = "volume"
+		paramPeers  = "peers"
+		paramHosts  = "hosts"
+		paramForce  = "force"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionDir := path.Clean(r.FormValue(paramDir))
+	partitionID, _, err := unmarshalPartitionName(path.Base(partitionDir))
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramDir, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	peers, err := proto.ParsePeers(r.FormValue(paramPeers))
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPeers, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var hosts []string
+	if value := r.FormValue(paramHosts); value != "" {
+		hosts = strings.Split(value, ",")
+	}
+	var force bool
+	if r.FormValue(paramForce) != "" {
+		if force, err = strconv.ParseBool(r.FormValue(paramForce)); err != nil {
+			err = fmt.Errorf("parse param %v fail: %v", paramForce, err)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if s.space.Partition(partitionID) != nil {
+		s.buildFailureResp(w, http.StatusConflict, "partition already loaded")
+		return
+	}
+	disk, err := s.space.GetDisk(path.Dir(partitionDir))
+	if err != nil {
+		s.buildFailureResp(w, http.StatusNotFound, err.Error())
+		return
+	}
+	md, err := RebuildMetadata(partitionDir, r.FormValue(paramVolume), peers, hosts, force)
+	if err == ErrMetadataExists {
+		s.buildFailureResp(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if _, err = LoadDataPartition(partitionDir, disk); err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, fmt.Sprintf("metadata rebuilt but load partition failed: %v", err))
+		return
+	}
+	s.space.clearLoadFailure(partitionID)
+	s.buildSuccessResp(w, md)
+}
+
+func (s *DataNode) getDiskStatusAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPath = "path"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	disk, err := s.space.GetDisk(r.FormValue(paramPath))
+	if err != nil {
+		s.buildFailureResp(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, disk.Summary())
+}
+
+func (s *DataNode) getRepairPlanAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramExtentType  = "extentType"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	extentType, err := parseExtentType(r.FormValue(paramExtentType))
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramExtentType, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	summaries, err := partition.PlanRepair(extentType)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, summaries)
+}
+
+func (s *DataNode) scrubExtentsAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	suspects, err := partition.ScrubExtents()
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, suspects)
+}
+
+func (s *DataNode) diffSnapshotAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramPeer        = "peer"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	peerAddr := r.FormValue(paramPeer)
+	if peerAddr == "" {
+		s.buildFailureResp(w, http.StatusBadRequest, fmt.Sprintf("param %v is empty", paramPeer))
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	diff, err := partition.DiffSnapshots(peerAddr)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, diff)
+}
+
+func (s *DataNode) getSnapshotAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	s.buildSuccessResp(w, partition.CopySnapShot())
+}
+
+func (s *DataNode) getFragmentationAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	report, err := partition.FragmentationReport()
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, report)
+}
+
+// List the latest applied ids recorded in the apply history of a partition.
+func (s *DataNode) applyHistoryAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramLimit       = "limit"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := DefaultApplyHistoryLimit
+	if value := r.FormValue(paramLimit); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			err = fmt.Errorf("parse param %v fail: must be a positive integer", paramLimit)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	checkpoints, err := partition.ApplyHistory(limit)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, checkpoints)
+}
+
+// List the latest deletes recorded in the delete audit log of a partition.
+func (s *DataNode) deleteAuditAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramLimit       = "limit"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := DefaultDeleteAuditLimit
+	if value := r.FormValue(paramLimit); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			err = fmt.Errorf("parse param %v fail: must be a positive integer", paramLimit)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	records, err := partition.RecentDeletes(limit)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, records)
+}
+
+// List the partitions whose replicas listed by the master disagree with their raft peers, sorted by the id.
+func (s *DataNode) membershipMismatchesAPI(w http.ResponseWriter, r *http.Request) {
+	discrepancies := make([]*MembershipDiscrepancy, 0)
+	s.space.RangePartitions(func(partition *DataPartition) bool {
+		if discrepancy := partition.GetMembershipDiscrepancy(); discrepancy != nil {
+			discrepancies = append(discrepancies, discrepancy)
+		}
+		return true
+	})
+	sort.Slice(discrepancies, func(i, j int) bool {
+		return discrepancies[i].ID < discrepancies[j].ID
+	})
+	s.buildSuccessResp(w, discrepancies)
+}
+
+// Show how the replicas of the partitions fetched from the master are served by the cache of the node.
+func (s *DataNode) replicaCacheAPI(w http.ResponseWriter, r *http.Request) {
+	s.buildSuccessResp(w, s.space.ReplicaCacheStats())
+}
+
+// Cross-check the applied ids of a partition against its raft log, read only.
+func (s *DataNode) verifyRaftAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	state, ok, err := partition.VerifyRaftState()
+	if !ok {
+		s.buildFailureResp(w, http.StatusServiceUnavailable, "raft of the partition not started")
+		return
+	}
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result := &struct {
+		ID uint64 `json:"id"`
+		*RaftState
+	}{
+		ID:        partition.partitionID,
+		RaftState: state,
+	}
+	s.buildSuccessResp(w, result)
+}
+
+// Show the fsync policy of a partition and the syncs of its extents by the interval.
+func (s *DataNode) getFsyncPolicyAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	s.buildSuccessResp(w, partition.GetFsyncStats())
+}
+
+// Return the partitions repairing and waiting for the repair slots of the node, in the order of the priority.
+func (s *DataNode) getRepairOrderAPI(w http.ResponseWriter, r *http.Request) {
+	s.buildSuccessResp(w, s.space.RepairOrder())
+}
+
+// Read a range of a normal extent verified against the block crcs, regardless of whether the client reads of
+// the volume are verified. A range failed the verification is replied with the conflict status.
+func (s *DataNode) verifiedReadAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramExtentID    = "extent"
+		paramOffset      = "offset"
+		paramSize        = "size"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var values [4]uint64
+	for i, param := range []string{paramPartitionID, paramExtentID, paramOffset, paramSize} {
+		value, err := strconv.ParseUint(r.FormValue(param), 10, 64)
+		if err != nil {
+			err = fmt.Errorf("parse param %v fail: %v", param, err)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		values[i] = value
+	}
+	partitionID, extentID, offset, size := values[0], values[1], values[2], values[3]
+	if size == 0 || size > util.BlockSize || offset >= util.ExtentSize {
+		s.buildFailureResp(w, http.StatusBadRequest, fmt.Sprintf("offset(%v) or size(%v) out of range", offset, size))
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	data, err := partition.VerifiedRead(extentID, int(offset), int(size))
+	if IsExtentCrcMismatch(err) {
+		s.buildFailureResp(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, &struct {
+		Crc  uint32 `json:"crc"`
+		Data []byte `json:"data"`
+	}{
+		Crc:  crc32.ChecksumIEEE(data),
+		Data: data,
+	})
+}
+
+// Move a partition to another disk of the node. The partition is not served until it is loaded from the
+// target disk, so the requests to it fail to be retried meanwhile.
+func (s *DataNode) movePartitionAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramDisk        = "disk"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	disk, err := s.space.GetDisk(path.Clean(r.FormValue(paramDisk)))
+	if err != nil {
+		s.buildFailureResp(w, http.StatusNotFound, err.Error())
+		return
+	}
+	_, result, err := partition.MovePartitionToDisk(disk)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, result)
+}
+
+// Show the progress of the warm-up of a partition, or of all the partitions warmed up if no id is given.
+func (s *DataNode) getWarmUpAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.FormValue(paramPartitionID) == "" {
+		s.buildSuccessResp(w, s.space.WarmUpProgress())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	s.buildSuccessResp(w, partition.WarmUpProgress())
+}
+
+// List the normal extents of a partition not read by the clients within the given seconds.
+func (s *DataNode) coldExtentsAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramOlderThan   = "olderThan"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	olderThan, err := strconv.ParseInt(r.FormValue(paramOlderThan), 10, 64)
+	if err != nil || olderThan <= 0 {
+		err = fmt.Errorf("parse param %v fail: must be a positive integer of seconds", paramOlderThan)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	cold, err := partition.ColdExtents(time.Duration(olderThan) * time.Second)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, cold)
+}
+
+// Map the extents of a partition back to the volume and the inodes they belong to.
+func (s *DataNode) extentOwnersAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramExtents     = "extents"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var extentIDs []uint64
+	for _, value := range strings.Split(r.FormValue(paramExtents), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		extentID, parseErr := strconv.ParseUint(value, 10, 64)
+		if parseErr != nil {
+			err = fmt.Errorf("parse param %v fail: %v", paramExtents, parseErr)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		extentIDs = append(extentIDs, extentID)
+	}
+	if len(extentIDs) == 0 || len(extentIDs) > MaxExtentOwnersLookup {
+		err = fmt.Errorf("parse param %v fail: 1 to %v extent ids separated by commas", paramExtents, MaxExtentOwnersLookup)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	s.buildSuccessResp(w, partition.LookupExtentOwners(extentIDs))
+}
+
+// List the largest extents of a partition by the size on the disk.
+func (s *DataNode) topExtentsAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramLimit       = "limit"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := DefaultTopExtentsLimit
+	if value := r.FormValue(paramLimit); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			err = fmt.Errorf("parse param %v fail: must be a positive integer", paramLimit)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	top, err := partition.ListExtentsBySize(limit)
+	if err != nil {
+		s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, top)
+}
+
+func (s *DataNode) getPartitionSpaceAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramForce       = "force"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var force bool
+	if r.FormValue(paramForce) != "" {
+		if force, err = strconv.ParseBool(r.FormValue(paramForce)); err != nil {
+			err = fmt.Errorf("parse param %v fail: %v", paramForce, err)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	var reconciliation *UsageReconciliation
+	if force {
+		if reconciliation, err = partition.ReconcileUsage(); err != nil {
+			s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	result := &struct {
+		ID             uint64               `json:"id"`
+		Size           int                  `json:"size"`
+		Used           int                  `json:"used"`
+		Available      int                  `json:"available"`
+		Reconciliation *UsageReconciliation `json:"reconciliation,omitempty"` // only with force
+	}{
+		ID:             partition.partitionID,
+		Size:           partition.Size(),
+		Used:           partition.Used(),
+		Available:      partition.Available(),
+		Reconciliation: reconciliation,
+	}
+	s.buildSuccessResp(w, result)
+}
+
+func (s *DataNode) getRaftProgressAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	progress, ok := partition.GetRaftProgress()
+	if !ok {
+		s.buildFailureResp(w, http.StatusServiceUnavailable, "raft of the partition not started")
+		return
+	}
+	result := &struct {
+		ID uint64 `json:"id"`
+		RaftProgress
+	}{
+		ID:           partition.partitionID,
+		RaftProgress: progress,
+	}
+	s.buildSuccessResp(w, result)
+}
+
+func (s *DataNode) getRaftLeaderAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	leader, ok := partition.GetRaftLeader()
+	if !ok {
+		s.buildFailureResp(w, http.StatusServiceUnavailable, "raft of the partition not started")
+		return
+	}
+	result := &struct {
+		ID uint64 `json:"id"`
+		RaftLeader
+	}{
+		ID:         partition.partitionID,
+		RaftLeader: leader,
+	}
+	s.buildSuccessResp(w, result)
+}
+
+// Reply 200 if the partition is ready to serve, or 503 with the reasons otherwise, for the readiness probes.
+func (s *DataNode) getPartitionHealthAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	health := partition.HealthCheck()
+	if !health.Ready {
+		s.buildJSONResp(w, http.StatusServiceUnavailable, health, "partition not ready")
+		return
+	}
+	s.buildSuccessResp(w, health)
+}
+
+// Start, pause, resume or cancel the compaction of the tiny extents of a partition, and reply the progress.
+func (s *DataNode) compactTinyExtentsAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramAction      = "action"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	switch action := r.FormValue(paramAction); action {
+	case "start":
+		if partition.GetTinyCompactionProgress().Running {
+			err = fmt.Errorf("partition(%v) is being compacted", partitionID)
+			break
+		}
+		if !partition.isRepairLeader() {
+			err = fmt.Errorf("partition(%v) is not the leader to compact on %v", partitionID, LocalIP)
+			break
+		}
+		go partition.CompactTinyExtents()
+	case "pause":
+		err = partition.PauseTinyCompaction(true)
+	case "resume":
+		err = partition.PauseTinyCompaction(false)
+	case "cancel":
+		err = partition.CancelTinyCompaction()
+	case "", "status":
+	default:
+		err = fmt.Errorf("unknown %v(%v), expect start, pause, resume, cancel or status", paramAction, action)
+	}
+	if err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.buildSuccessResp(w, partition.GetTinyCompactionProgress())
+}
+
+// List the quarantined extents of a partition, and release the given extent from the quarantine if any.
+func (s *DataNode) quarantinedExtentsAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramRelease     = "release"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	if value := r.FormValue(paramRelease); value != "" {
+		var extentID uint64
+		if extentID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			err = fmt.Errorf("parse param %v fail: %v", paramRelease, err)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err = partition.ReleaseQuarantinedExtent(extentID); err != nil {
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	s.buildSuccessResp(w, partition.QuarantinedExtents())
+}
+
+// List the extents of a partition stuck without a repair source.
+func (s *DataNode) noSourceExtentsAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	s.buildSuccessResp(w, partition.NoSourceExtents())
+}
+
+func (s *DataNode) getPartitionUptimeAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	s.buildSuccessResp(w, partition.GetUptimeInfo())
+}
+
+// Freeze or unfreeze a partition for an investigation, the state of the partition is returned
+// without any change if the freeze param is absent.
+func (s *DataNode) freezePartitionAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramFreeze      = "freeze"
+		paramReason      = "reason"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	if value := r.FormValue(paramFreeze); value != "" {
+		var freeze bool
+		if freeze, err = strconv.ParseBool(value); err != nil {
+			err = fmt.Errorf("parse param %v fail: %v", paramFreeze, err)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if freeze {
+			err = partition.Freeze(r.FormValue(paramReason))
+		} else {
+			err = partition.Unfreeze()
+		}
+		if err != nil {
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	frozen, reason := partition.IsFrozen()
+	result := &struct {
+		ID     uint64 `json:"id"`
+		Frozen bool   `json:"frozen"`
+		Reason string `json:"reason"`
+		Status int    `json:"status"`
+	}{
+		ID:     partitionID,
+		Frozen: frozen,
+		Reason: reason,
+		Status: partition.Status(),
+	}
+	s.buildSuccessResp(w, result)
+}
+
+// Show the manual read-only state of a partition, and set it on behalf of the operator if readOnly is given.
+func (s *DataNode) manualReadOnlyAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramReadOnly    = "readOnly"
+		paramOperator    = "operator"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	if value := r.FormValue(paramReadOnly); value != "" {
+		var readOnly bool
+		if readOnly, err = strconv.ParseBool(value); err != nil {
+			err = fmt.Errorf("parse param %v fail: %v", paramReadOnly, err)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		operator := r.FormValue(paramOperator)
+		if operator == "" {
+			s.buildFailureResp(w, http.StatusBadRequest, fmt.Sprintf("param %v is required to set %v", paramOperator, paramReadOnly))
+			return
+		}
+		if err = partition.SetManualReadOnly(readOnly, operator); err != nil {
+			s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	setBy, setTime := partition.ManualReadOnlySetBy()
+	result := &struct {
+		ID             uint64 `json:"id"`
+		ManualReadOnly bool   `json:"manualReadOnly"`
+		SetBy          string `json:"setBy"`
+		SetTime        string `json:"setTime"`
+		Status         int    `json:"status"`
+	}{
+		ID:             partitionID,
+		ManualReadOnly: partition.IsManualReadOnly(),
+		SetBy:          setBy,
+		SetTime:        setTime,
+		Status:         partition.Status(),
+	}
+	s.buildSuccessResp(w, result)
+}
+
+// Show the TTL of the extents of a partition and the extents expired by it, and set the TTL of the partition
+// if ttl is given, 0 makes it follow the volume.
+func (s *DataNode) extentTTLAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramTTL         = "ttl"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	if value := r.FormValue(paramTTL); value != "" {
+		var ttl int64
+		if ttl, err = strconv.ParseInt(value, 10, 64); err != nil {
+			err = fmt.Errorf("parse param %v fail: %v", paramTTL, err)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err = partition.SetExtentTTL(ttl); err != nil {
+			s.buildFailureResp(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	s.buildSuccessResp(w, partition.GetExtentExpiryStats())
+}
+
+// List the repairs of the extents being run on a partition, and cancel the ones of the extent given by cancel.
+func (s *DataNode) activeRepairsAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramCancel      = "cancel"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	if value := r.FormValue(paramCancel); value != "" {
+		var extentID uint64
+		if extentID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			err = fmt.Errorf("parse param %v fail: %v", paramCancel, err)
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err = partition.CancelRepair(extentID); err != nil {
+			s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	s.buildSuccessResp(w, partition.ListActiveRepairs())
+}
+
+// Change the logical capacity of a partition on all its replicas, e.g. to expand a hot partition in place.
+// It is sent to the raft leader of the partition.
+func (s *DataNode) resizePartitionAPI(w http.ResponseWriter, r *http.Request) {
+	const (
+		paramPartitionID = "id"
+		paramSize        = "size"
+	)
+	if err := r.ParseForm(); err != nil {
+		err = fmt.Errorf("parse form fail: %v", err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partitionID, err := strconv.ParseUint(r.FormValue(paramPartitionID), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramPartitionID, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	size, err := strconv.Atoi(r.FormValue(paramSize))
+	if err != nil {
+		err = fmt.Errorf("parse param %v fail: %v", paramSize, err)
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	partition := s.space.Partition(partitionID)
+	if partition == nil {
+		s.buildFailureResp(w, http.StatusNotFound, "partition not exist")
+		return
+	}
+	if err = partition.ResizePartition(size); err != nil {
+		s.buildFailureResp(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	result := &struct {
+		ID     uint64 `json:"id"`
+		Size   int    `json:"size"`
+		Used   int    `json:"used"`
+		Status int    `json:"status"`
+	}{
+		ID:     partitionID,
+		Size:   partition.Size(),
+		Used:   partition.Used(),
+		Status: partition.Status(),
 	}
 	s.buildSuccessResp(w, result)
 }
@@ -15,14 +15,18 @@
 package datanode
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/raftstore"
+	"github.com/chubaofs/chubaofs/storage"
 	"github.com/chubaofs/chubaofs/util"
 	"github.com/chubaofs/chubaofs/util/log"
+	"golang.org/x/time/rate"
 	"math"
 	"os"
 )
@@ -42,6 +46,53 @@ type SpaceManager struct {
 	diskList             []string
 	dataNode             *DataNode
 	createPartitionMutex sync.RWMutex
+	repairConcurrency    int
+	usageUpdateInterval  int64
+	latencyWindow        int64
+	reconcilePeers       bool
+	repairLimiter        *rate.Limiter // shared by the repairs of all the partitions
+	statusInterval       int64
+	snapshotInterval     int64
+	tickerJitter         bool
+	repairTimeout        int64   // seconds a repair cycle is allowed to run, 0 means no limit
+	createReserveRatio   float64 // fraction of the disk kept free beyond the size of a new partition
+	nearFullRatio        float64 // fraction of the partition size above which the partition is near full
+	maxTinyRepair        int     // cap of the adaptive number of the tiny extents to repair in a cycle
+	repairVerify         bool    // re-read the repaired normal extents and check their crcs against the sources
+	applyHistorySize     int64   // bytes of the apply history of a partition, 0 disables the history
+	repairStoreFiles     bool    // recreate the missing extent store files of the partitions on load
+	maxActiveExtents     int     // extents of a partition above which it turns read only
+	volMaxActiveExtents  map[string]int
+	extentTTL            int64 // seconds after the creation the extents expire, 0 disables the expiry
+	volExtentTTL         map[string]int64
+	usageBackoff         usageBackoff
+	loadConcurrency      int // partitions of a disk loaded at once on the startup
+	loadFailures         partitionLoadFailures
+	fsyncPolicy          string // when the writes to the extents are synced, one of the FsyncPolicy
+	volFsyncPolicy       map[string]string
+	fsyncInterval        time.Duration
+	volRepairPriority    map[string]int // repair priorities of the volumes, the others are normal
+	repairScheduler      repairScheduler
+	volVerifiedRead      map[string]bool // volumes whose client reads are verified against the block crcs
+	verifiedReadRepair   bool
+	fullNotifier         fullNotifier // partitions turned read-only by the fullness, to be reported to the master
+	warmUpSize           int64        // bytes of the hottest extents of a partition preloaded after the load, 0 disables it
+	warmUpLimiter        warmUpLimiter
+	extentShards         int   // shard directories of the normal extents of the new partitions, 0 if flat
+	shardExtentsOnLoad   bool  // migrate the loaded partitions to the layout of extentShards
+	deleteAuditSize      int64 // bytes of the delete audit log of a partition, 0 disables the log
+	storeQueueCapacity   int   // store requests queued in storeC of a new partition
+	storeQueuePolicy     string
+	storeQueueTimeout    time.Duration
+	noSourcePolicy       string // when the extents without a repair source are escalated or quarantined
+	noSourceCycles       int
+	tinySize             int             // size limit of the files of the new partitions in the tiny extents
+	replicaCache         *replicaCache   // replicas of the partitions fetched from the master
+	readRepairSlots      chan struct{}   // read repairs running at once on the node
+	volEncryption        map[string]bool // volumes whose new partitions are encrypted at rest
+	volumeKeySource      VolumeKeySource
+	diskHealthSource     DiskHealthSource
+	diskHealthMutex      sync.RWMutex
 }
 
 // NewSpaceManager creates a new space manager.
@@ -54,8 +105,14 @@ func NewSpaceManager(dataNode *DataNode) *SpaceManager {
 	space.stats = NewStats(dataNode.zoneName)
 	space.stopC = make(chan bool, 0)
 	space.dataNode = dataNode
+	space.repairLimiter = rate.NewLimiter(rate.Inf, RepairBandwidthBurst)
+	space.readRepairSlots = make(chan struct{}, DefaultReadRepairSlots)
+
+	space.fullNotifier.init()
+	space.replicaCache = newReplicaCache()
 
 	go space.statUpdateScheduler()
+	go space.fullNotifyScheduler()
 
 	return space
 }
@@ -90,6 +147,197 @@ func (manager *SpaceManager) GetRaftStore() (raftStore raftstore.RaftStore) {
 	return manager.raftStore
 }
 
+func (manager *SpaceManager) SetRepairConcurrency(repairConcurrency int) {
+	manager.repairConcurrency = repairConcurrency
+}
+
+func (manager *SpaceManager) GetRepairConcurrency() (repairConcurrency int) {
+	return manager.repairConcurrency
+}
+
+func (manager *SpaceManager) SetUsageUpdateInterval(usageUpdateInterval int64) {
+	manager.usageUpdateInterval = usageUpdateInterval
+}
+
+func (manager *SpaceManager) GetUsageUpdateInterval() (usageUpdateInterval int64) {
+	return manager.usageUpdateInterval
+}
+
+func (manager *SpaceManager) SetLatencyWindow(latencyWindow int64) {
+	manager.latencyWindow = latencyWindow
+}
+
+func (manager *SpaceManager) GetLatencyWindow() (latencyWindow int64) {
+	return manager.latencyWindow
+}
+
+func (manager *SpaceManager) SetReconcilePeers(reconcilePeers bool) {
+	manager.reconcilePeers = reconcilePeers
+}
+
+func (manager *SpaceManager) GetReconcilePeers() (reconcilePeers bool) {
+	return manager.reconcilePeers
+}
+
+func (manager *SpaceManager) SetTickerIntervals(statusInterval, snapshotInterval int64, tickerJitter bool) {
+	manager.statusInterval = statusInterval
+	manager.snapshotInterval = snapshotInterval
+	manager.tickerJitter = tickerJitter
+}
+
+func (manager *SpaceManager) GetTickerIntervals() (statusInterval, snapshotInterval int64, tickerJitter bool) {
+	return manager.statusInterval, manager.snapshotInterval, manager.tickerJitter
+}
+
+func (manager *SpaceManager) SetRepairTimeout(repairTimeout int64) {
+	manager.repairTimeout = repairTimeout
+}
+
+func (manager *SpaceManager) GetRepairTimeout() (repairTimeout int64) {
+	return manager.repairTimeout
+}
+
+func (manager *SpaceManager) SetCreateReserveRatio(ratio float64) {
+	manager.createReserveRatio = ratio
+}
+
+func (manager *SpaceManager) GetCreateReserveRatio() (ratio float64) {
+	return manager.createReserveRatio
+}
+
+func (manager *SpaceManager) SetNearFullRatio(ratio float64) {
+	manager.nearFullRatio = ratio
+}
+
+func (manager *SpaceManager) GetNearFullRatio() (ratio float64) {
+	return manager.nearFullRatio
+}
+
+func (manager *SpaceManager) SetMaxTinyRepair(max int) {
+	manager.maxTinyRepair = max
+}
+
+func (manager *SpaceManager) GetMaxTinyRepair() (max int) {
+	return manager.maxTinyRepair
+}
+
+func (manager *SpaceManager) SetRepairVerify(verify bool) {
+	manager.repairVerify = verify
+}
+
+func (manager *SpaceManager) GetRepairVerify() (verify bool) {
+	return manager.repairVerify
+}
+
+func (manager *SpaceManager) SetApplyHistorySize(size int64) {
+	manager.applyHistorySize = size
+}
+
+func (manager *SpaceManager) GetApplyHistorySize() (size int64) {
+	return manager.applyHistorySize
+}
+
+func (manager *SpaceManager) SetDeleteAuditSize(size int64) {
+	manager.deleteAuditSize = size
+}
+
+func (manager *SpaceManager) GetDeleteAuditSize() (size int64) {
+	return manager.deleteAuditSize
+}
+
+func (manager *SpaceManager) SetTinySize(size int) {
+	manager.tinySize = size
+}
+
+func (manager *SpaceManager) GetTinySize() (size int) {
+	return manager.tinySize
+}
+
+func (manager *SpaceManager) SetRepairStoreFiles(repair bool) {
+	manager.repairStoreFiles = repair
+}
+
+func (manager *SpaceManager) GetRepairStoreFiles() (repair bool) {
+	return manager.repairStoreFiles
+}
+
+func (manager *SpaceManager) SetMaxActiveExtents(limit int, volLimits map[string]int) {
+	manager.maxActiveExtents = limit
+	manager.volMaxActiveExtents = volLimits
+}
+
+// GetMaxActiveExtents returns the max active extents of the partitions of the volume, which is the one
+// configured for the volume if any, or storage.MaxExtentCount if none is configured at all.
+func (manager *SpaceManager) GetMaxActiveExtents(volName string) (limit int) {
+	if limit = manager.volMaxActiveExtents[volName]; limit > 0 {
+		return
+	}
+	if limit = manager.maxActiveExtents; limit > 0 {
+		return
+	}
+	return storage.MaxExtentCount
+}
+
+func (manager *SpaceManager) SetExtentTTL(ttl int64, volTTLs map[string]int64) {
+	manager.extentTTL = ttl
+	manager.volExtentTTL = volTTLs
+}
+
+// GetExtentTTL returns the TTL of the extents of the volume, which is the one configured for the volume
+// if any, or the one of the node.
+func (manager *SpaceManager) GetExtentTTL(volName string) (ttl int64) {
+	if ttl = manager.volExtentTTL[volName]; ttl > 0 {
+		return
+	}
+	return manager.extentTTL
+}
+
+// The largest of the max active extents configured for the node and the volumes.
+func (manager *SpaceManager) maxActiveExtentsUpperBound() (limit int) {
+	limit = manager.GetMaxActiveExtents("")
+	for _, volLimit := range manager.volMaxActiveExtents {
+		if volLimit > limit {
+			limit = volLimit
+		}
+	}
+	return
+}
+
+// SetRepairBandwidth limits the bytes per second read from the peers by the repairs, 0 disables the limit.
+func (manager *SpaceManager) SetRepairBandwidth(bandwidth int64) {
+	if bandwidth <= 0 {
+		manager.repairLimiter.SetLimit(rate.Inf)
+		return
+	}
+	manager.repairLimiter.SetLimit(rate.Limit(bandwidth))
+}
+
+// GetRepairBandwidth returns the bytes per second allowed for the repairs, 0 means unlimited.
+func (manager *SpaceManager) GetRepairBandwidth() (bandwidth int64) {
+	limit := manager.repairLimiter.Limit()
+	if limit == rate.Inf {
+		return 0
+	}
+	return int64(limit)
+}
+
+// Wait until the repair of the priority is allowed to read the given bytes from the peers. The bytes are charged
+// by the factor of the priority, see bandwidthFactor.
+func (manager *SpaceManager) waitRepairBandwidth(size int, priority int) {
+	factor := manager.repairScheduler.bandwidthFactor(priority)
+	for size > 0 {
+		n := size
+		if n > RepairBandwidthBurst/factor {
+			n = RepairBandwidthBurst / factor
+		}
+		if err := manager.repairLimiter.WaitN(context.Background(), n*factor); err != nil {
+			log.LogWarnf("action[waitRepairBandwidth] wait size(%v) err(%v).", n, err)
+			return
+		}
+		size -= n
+	}
+}
+
 func (manager *SpaceManager) RangePartitions(f func(partition *DataPartition) bool) {
 	if f == nil {
 		return
@@ -122,7 +370,7 @@ func (manager *SpaceManager) Stats() *Stats {
 	return manager.stats
 }
 
-func (manager *SpaceManager) LoadDisk(path string, reservedSpace uint64, maxErrCnt int) (err error) {
+func (manager *SpaceManager) LoadDisk(path string, reservedSpace uint64, sectorSize int64, maxErrCnt int) (err error) {
 	var (
 		disk    *Disk
 		visitor PartitionVisitor
@@ -137,8 +385,11 @@ func (manager *SpaceManager) LoadDisk(path string, reservedSpace uint64, maxErrC
 		}
 	}
 	if _, err = manager.GetDisk(path); err != nil {
-		disk = NewDisk(path, reservedSpace, maxErrCnt, manager)
-		disk.RestorePartition(visitor)
+		disk = NewDisk(path, reservedSpace, sectorSize, maxErrCnt, manager)
+		report := disk.RestorePartition(visitor)
+		manager.recordLoadFailures(report.Failed)
+		log.LogInfof("action[LoadDisk] disk(%v) loaded(%v) partitions failed(%v) cost(%v).",
+			path, report.Loaded, len(report.Failed), report.Duration)
 		manager.putDisk(disk)
 		err = nil
 		go disk.autoComputeExtentCrc()
@@ -178,8 +429,12 @@ func (manager *SpaceManager) updateMetrics() {
 		used += d.Used
 		available += d.Available
 		totalPartitionSize += d.Allocated
-		remainingCapacityToCreatePartition += d.Unallocated
 		partitionCnt += uint64(d.PartitionCount())
+		// the dying disks refused by checkHealthToCreate take no new partitions, see minPartitionCnt
+		if health, _ := d.Health(); isUnhealthy(health) {
+			continue
+		}
+		remainingCapacityToCreatePartition += d.Unallocated
 		if maxCapacityToCreatePartition < d.Unallocated {
 			maxCapacityToCreatePartition = d.Unallocated
 		}
@@ -203,6 +458,9 @@ func (manager *SpaceManager) minPartitionCnt() (d *Disk) {
 		if disk.Available <= 5*util.GB || disk.Status != proto.ReadWrite {
 			continue
 		}
+		if health, _ := disk.Health(); isUnhealthy(health) {
+			continue
+		}
 		diskWeight := disk.getSelectWeight()
 		if diskWeight < minWeight {
 			minWeight = diskWeight
@@ -225,6 +483,7 @@ func (manager *SpaceManager) statUpdateScheduler() {
 			select {
 			case <-ticker.C:
 				manager.updateMetrics()
+				manager.updateUsageBackoff()
 			case <-manager.stopC:
 				ticker.Stop()
 				return
@@ -233,6 +492,68 @@ func (manager *SpaceManager) statUpdateScheduler() {
 	}()
 }
 
+// FlushResult describes the flush of the metadata and the applied ids of all the partitions on the node.
+type FlushResult struct {
+	Flushed  int               `json:"flushed"`
+	Failed   map[uint64]string `json:"failed"` // partition id -> error
+	Duration int64             `json:"durationMs"`
+}
+
+// FlushPartitions persists the metadata and the applied id of every partition on the node, before a controlled
+// shutdown for example. A failed partition does not stop the flush of the others.
+func (manager *SpaceManager) FlushPartitions() (result *FlushResult) {
+	start := time.Now()
+	result = &FlushResult{Failed: make(map[uint64]string)}
+	manager.RangePartitions(func(partition *DataPartition) bool {
+		if err := partition.Flush(); err != nil {
+			log.LogErrorf("action[FlushPartitions] partition(%v) err(%v).", partition.partitionID, err)
+			result.Failed[partition.partitionID] = err.Error()
+			return true
+		}
+		result.Flushed++
+		return true
+	})
+	result.Duration = int64(time.Since(start) / time.Millisecond)
+	log.LogInfof("action[FlushPartitions] flushed(%v) failed(%v) cost(%vms).", result.Flushed, len(result.Failed), result.Duration)
+	return
+}
+
+// PartitionsNeedingRepair returns the partitions on the node which have broken tiny extents, or extents
+// mismatched among the replicas in their latest repair cycles, sorted by the partition id.
+func (manager *SpaceManager) PartitionsNeedingRepair() (statuses []*PartitionRepairStatus) {
+	statuses = make([]*PartitionRepairStatus, 0)
+	manager.RangePartitions(func(partition *DataPartition) bool {
+		if status := partition.GetRepairStatus(); status.NeedRepair() {
+			statuses = append(statuses, status)
+		}
+		return true
+	})
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+	return
+}
+
+// PartitionsGrowth returns the growth of all the partitions, the ones to be full first come first,
+// and the ones not growing come last.
+func (manager *SpaceManager) PartitionsGrowth() (growths []*PartitionGrowth) {
+	growths = make([]*PartitionGrowth, 0)
+	manager.RangePartitions(func(partition *DataPartition) bool {
+		growths = append(growths, partition.GetGrowth())
+		return true
+	})
+	sort.Slice(growths, func(i, j int) bool {
+		if (growths[i].TimeToFull < 0) != (growths[j].TimeToFull < 0) {
+			return growths[j].TimeToFull < 0
+		}
+		if growths[i].TimeToFull != growths[j].TimeToFull {
+			return growths[i].TimeToFull < growths[j].TimeToFull
+		}
+		return growths[i].ID < growths[j].ID
+	})
+	return
+}
+
 func (manager *SpaceManager) Partition(partitionID uint64) (dp *DataPartition) {
 	manager.partitionMutex.RLock()
 	defer manager.partitionMutex.RUnlock()
@@ -266,6 +587,23 @@ func (manager *SpaceManager) CreatePartition(request *proto.CreateDataPartitionR
 		NodeID:        manager.nodeID,
 		ClusterID:     manager.clusterID,
 		PartitionSize: request.PartitionSize,
+
+		RepairConcurrency:   manager.repairConcurrency,
+		UsageUpdateInterval: manager.usageUpdateInterval,
+		LatencyWindow:       manager.latencyWindow,
+		StatusInterval:      manager.statusInterval,
+		SnapshotInterval:    manager.snapshotInterval,
+		TickerJitter:        manager.tickerJitter,
+		LayoutExtents:       manager.extentShards > 0,
+		ExtentShards:        manager.extentShards,
+		Encrypted:           manager.IsVolumeEncrypted(request.VolumeId),
+		TinySize:            manager.tinySize,
+	}
+	if request.TinySize > 0 {
+		if err = checkTinySize(request.TinySize); err != nil {
+			return nil, err
+		}
+		dpCfg.TinySize = request.TinySize
 	}
 	dp = manager.partitions[dpCfg.PartitionID]
 	if dp != nil {
@@ -275,6 +613,9 @@ func (manager *SpaceManager) CreatePartition(request *proto.CreateDataPartitionR
 		return
 	}
 	disk := manager.minPartitionCnt()
+	if disk == nil && manager.hasUnhealthyDisk() {
+		return nil, ErrNoHealthyDisk
+	}
 	if disk == nil {
 		return nil, ErrNoSpaceToCreatePartition
 	}
@@ -286,6 +627,20 @@ func (manager *SpaceManager) CreatePartition(request *proto.CreateDataPartitionR
 	return
 }
 
+// DrainPartitions drains all the partitions concurrently before the data node shuts down.
+func (manager *SpaceManager) DrainPartitions(timeout time.Duration) {
+	var wg sync.WaitGroup
+	manager.RangePartitions(func(dp *DataPartition) bool {
+		wg.Add(1)
+		go func(dp *DataPartition) {
+			defer wg.Done()
+			dp.Drain(timeout)
+		}(dp)
+		return true
+	})
+	wg.Wait()
+}
+
 // DeletePartition deletes a partition based on the partition id.
 func (manager *SpaceManager) DeletePartition(dpID uint64) {
 	dp := manager.Partition(dpID)
@@ -329,6 +684,7 @@ func (s *DataNode) buildHeartBeatResponse(response *proto.DataNodeHeartbeatRespo
 			IsLeader:        isLeader,
 			ExtentCount:     partition.GetExtentCount(),
 			NeedCompare:     true,
+			NearFull:        partition.IsNearFull(),
 		}
 		log.LogDebugf("action[Heartbeats] dpid(%v), status(%v) total(%v) used(%v) leader(%v) isLeader(%v).", vr.PartitionID, vr.PartitionStatus, vr.Total, vr.Used, leaderAddr, vr.IsLeader)
 		response.PartitionReports = append(response.PartitionReports, vr)
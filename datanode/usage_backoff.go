@@ -0,0 +1,123 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// MaxUsageBackoffFactor is the max times the intervals to recompute the used space are extended by.
+const MaxUsageBackoffFactor = 8
+
+// usageBackoff extends the intervals the partitions recompute their used space at while the write latency
+// of the node is high, so that walking the directories does not compete with the clients. The factor doubles
+// each time the latency is found above the threshold, and halves once it drops below the half of it.
+type usageBackoff struct {
+	sync.RWMutex
+	threshold time.Duration // p99 of the write latency above which to back off, 0 disables the backoff
+	latency   time.Duration // the highest p99 of the write latencies of the partitions at the latest check
+	factor    int64
+}
+
+// UsageBackoff describes the backoff of the recomputation of the used space under the load of the node.
+type UsageBackoff struct {
+	Threshold         int64 `json:"thresholdMs"`
+	Latency           int64 `json:"latencyUs"` // the highest p99 of the write latencies of the partitions
+	Factor            int64 `json:"factor"`
+	Interval          int64 `json:"interval"`          // seconds to recompute the used space at without the backoff
+	EffectiveInterval int64 `json:"effectiveInterval"` // seconds to recompute the used space at currently
+}
+
+func (b *usageBackoff) update(latency time.Duration) (factor int64, changed bool) {
+	b.Lock()
+	defer b.Unlock()
+	b.latency = latency
+	old := b.factor
+	switch {
+	case b.threshold <= 0:
+		b.factor = 1
+	case latency >= b.threshold && b.factor < MaxUsageBackoffFactor:
+		b.factor *= 2
+	case latency < b.threshold/2 && b.factor > 1:
+		b.factor /= 2
+	}
+	return b.factor, b.factor != old
+}
+
+func (b *usageBackoff) getFactor() int64 {
+	b.RLock()
+	defer b.RUnlock()
+	if b.factor < 1 {
+		return 1
+	}
+	return b.factor
+}
+
+func (manager *SpaceManager) SetUsageBackoffLatency(threshold time.Duration) {
+	manager.usageBackoff.Lock()
+	defer manager.usageBackoff.Unlock()
+	manager.usageBackoff.threshold = threshold
+	manager.usageBackoff.factor = 1
+}
+
+// GetUsageBackoffFactor returns the times the intervals to recompute the used space are extended by currently.
+func (manager *SpaceManager) GetUsageBackoffFactor() int64 {
+	return manager.usageBackoff.getFactor()
+}
+
+// GetUsageBackoff returns the current backoff of the recomputation of the used space.
+func (manager *SpaceManager) GetUsageBackoff() *UsageBackoff {
+	b := &manager.usageBackoff
+	b.RLock()
+	defer b.RUnlock()
+	factor := b.factor
+	if factor < 1 {
+		factor = 1
+	}
+	return &UsageBackoff{
+		Threshold:         int64(b.threshold / time.Millisecond),
+		Latency:           int64(b.latency / time.Microsecond),
+		Factor:            factor,
+		Interval:          manager.usageUpdateInterval,
+		EffectiveInterval: manager.usageUpdateInterval * factor,
+	}
+}
+
+// Check the write latency of the node by the highest p99 of the recent write latencies of the partitions,
+// and adjust the backoff of the recomputation of the used space by it.
+func (manager *SpaceManager) updateUsageBackoff() {
+	var latency time.Duration
+	manager.RangePartitions(func(partition *DataPartition) bool {
+		if p99 := partition.GetLatencyPercentiles().P99; p99 > latency {
+			latency = p99
+		}
+		return true
+	})
+	if factor, changed := manager.usageBackoff.update(latency); changed {
+		log.LogWarnf("action[updateUsageBackoff] write latency p99(%v) usage update interval extended by (%v) times.",
+			latency, factor)
+	}
+}
+
+// The factor the intervals to recompute the used space of the partition are extended by under the load.
+func (dp *DataPartition) usageBackoffFactor() int64 {
+	if dp.disk == nil || dp.disk.space == nil {
+		return 1
+	}
+	return dp.disk.space.GetUsageBackoffFactor()
+}
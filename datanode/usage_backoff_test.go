@@ -0,0 +1,64 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datanode
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestUsageBackoff(t *testing.T) {
+	space := &SpaceManager{usageUpdateInterval: 60}
+	space.SetUsageBackoffLatency(100 * time.Millisecond)
+	b := &space.usageBackoff
+	for _, c := range []struct {
+		latency time.Duration
+		factor  int64
+	}{
+		{10 * time.Millisecond, 1},
+		{200 * time.Millisecond, 2},
+		{200 * time.Millisecond, 4},
+		{200 * time.Millisecond, 8},
+		{200 * time.Millisecond, MaxUsageBackoffFactor},
+		{80 * time.Millisecond, MaxUsageBackoffFactor}, // between the half and the threshold, kept as it is
+		{20 * time.Millisecond, 4},
+		{20 * time.Millisecond, 2},
+		{20 * time.Millisecond, 1},
+		{20 * time.Millisecond, 1},
+	} {
+		if factor, _ := b.update(c.latency); factor != c.factor {
+			t.Fatalf("factor(%v) at latency(%v), expected %v", factor, c.latency, c.factor)
+		}
+	}
+
+	// the running total is taken without walking the directory until the extended reconcile interval
+	store := newMockExtentStore(map[uint64]uint64{1025: 4096})
+	dp := newMockPartition(store)
+	dp.disk = &Disk{space: space}
+	dp.usageUpdateInterval = 60
+	dp.lastUsageReconcileTime = time.Now().Unix() - 2*UsageReconcileInterval
+	dp.path = path.Join(os.TempDir(), "usage_backoff_missing")
+	b.update(time.Second)
+	b.update(time.Second)
+	if backoff := space.GetUsageBackoff(); backoff.Factor != 4 || backoff.EffectiveInterval != 240 {
+		t.Fatalf("unexpected usage backoff(%+v)", backoff)
+	}
+	dp.computeUsage()
+	if dp.used != 4096 {
+		t.Fatalf("used(%v) with the reconcile backed off, expected the running total", dp.used)
+	}
+}
@@ -16,9 +16,11 @@ package datanode
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
 	"time"
@@ -139,7 +141,12 @@ func (s *DataNode) handlePacketToCreateExtent(p *repl.Packet) {
 		err = storage.BrokenDiskError
 		return
 	}
-	err = partition.ExtentStore().Create(p.ExtentID)
+	// the client sends the inode the extent is created for, which the older clients may not
+	var inode uint64
+	if p.Size >= 8 && len(p.Data) >= 8 {
+		inode = binary.BigEndian.Uint64(p.Data[0:8])
+	}
+	err = partition.ExtentStore().Create(p.ExtentID, inode)
 
 	return
 }
@@ -325,12 +332,12 @@ func (s *DataNode) handleMarkDeletePacket(p *repl.Packet, c net.Conn) {
 		if err == nil {
 			log.LogInfof("handleMarkDeletePacket Delete PartitionID(%v)_Extent(%v)_Offset(%v)_Size(%v)",
 				p.PartitionID, p.ExtentID, ext.ExtentOffset, ext.Size)
-			err = partition.ExtentStore().MarkDelete(p.ExtentID, int64(ext.ExtentOffset), int64(ext.Size))
+			err = partition.markDelete(p.ExtentID, int64(ext.ExtentOffset), int64(ext.Size), DeleteOpClient)
 		}
 	} else {
 		log.LogInfof("handleMarkDeletePacket Delete PartitionID(%v)_Extent(%v)",
 			p.PartitionID, p.ExtentID)
-		err = partition.ExtentStore().MarkDelete(p.ExtentID, 0, 0)
+		err = partition.markDelete(p.ExtentID, 0, 0, DeleteOpClient)
 	}
 	if err != nil {
 		p.PackErrorBody(ActionMarkDelete, err.Error())
@@ -349,11 +356,23 @@ func (s *DataNode) handleBatchMarkDeletePacket(p *repl.Packet, c net.Conn) {
 	partition := p.Object.(*DataPartition)
 	var exts []*proto.ExtentKey
 	err = json.Unmarshal(p.Data, &exts)
-	store := partition.ExtentStore()
 	if err == nil {
+		// all the extents are deleted, and the ones failed are reported, so that the sender knows they are left
+		var failed []uint64
+		var deleteErr error
+		op := DeleteOpClientBatch
+		if p.IsExpiryDeletePacket() {
+			op = DeleteOpExpiry
+		}
 		for _, ext := range exts {
 			log.LogInfof(fmt.Sprintf("recive DeleteExtent (%v) from (%v)", ext, c.RemoteAddr().String()))
-			store.MarkDelete(ext.ExtentId, int64(ext.ExtentOffset), int64(ext.Size))
+			if e := partition.markDelete(ext.ExtentId, int64(ext.ExtentOffset), int64(ext.Size), op); e != nil {
+				failed = append(failed, ext.ExtentId)
+				deleteErr = e
+			}
+		}
+		if len(failed) > 0 {
+			err = fmt.Errorf("mark delete extents(%v) failed, last err(%v)", failed, deleteErr)
 		}
 	}
 
@@ -386,14 +405,21 @@ func (s *DataNode) handleWritePacket(p *repl.Packet) {
 		return
 	}
 	store := partition.ExtentStore()
+	isSync := partition.syncOnWrite(p.IsSyncWrite())
 	if p.ExtentType == proto.TinyExtentType {
-		err = store.Write(p.ExtentID, p.ExtentOffset, int64(p.Size), p.Data, p.CRC, storage.AppendWriteType, p.IsSyncWrite())
+		if err = partition.checkTinyWrite(p.KernelOffset, p.Size); err != nil {
+			return
+		}
+		err = store.Write(p.ExtentID, p.ExtentOffset, int64(p.Size), p.Data, p.CRC, storage.AppendWriteType, isSync)
+		if err == nil {
+			partition.recordWrite(p.ExtentID, isSync)
+		}
 		s.incDiskErrCnt(p.PartitionID, err, WriteFlag)
 		return
 	}
 
 	if p.Size <= util.BlockSize {
-		err = store.Write(p.ExtentID, p.ExtentOffset, int64(p.Size), p.Data, p.CRC, storage.AppendWriteType, p.IsSyncWrite())
+		err = store.Write(p.ExtentID, p.ExtentOffset, int64(p.Size), p.Data, p.CRC, storage.AppendWriteType, isSync)
 		partition.checkIsDiskError(err)
 	} else {
 		size := p.Size
@@ -405,7 +431,7 @@ func (s *DataNode) handleWritePacket(p *repl.Packet) {
 			currSize := util.Min(int(size), util.BlockSize)
 			data := p.Data[offset : offset+currSize]
 			crc := crc32.ChecksumIEEE(data)
-			err = store.Write(p.ExtentID, p.ExtentOffset+int64(offset), int64(currSize), data, crc, storage.AppendWriteType, p.IsSyncWrite())
+			err = store.Write(p.ExtentID, p.ExtentOffset+int64(offset), int64(currSize), data, crc, storage.AppendWriteType, isSync)
 			partition.checkIsDiskError(err)
 			if err != nil {
 				break
@@ -414,6 +440,9 @@ func (s *DataNode) handleWritePacket(p *repl.Packet) {
 			offset += currSize
 		}
 	}
+	if err == nil {
+		partition.recordWrite(p.ExtentID, isSync)
+	}
 	s.incDiskErrCnt(p.PartitionID, err, WriteFlag)
 	return
 }
@@ -479,6 +508,12 @@ func (s *DataNode) handleExtentRepaiReadPacket(p *repl.Packet, connect net.Conn,
 	needReplySize := p.Size
 	offset := p.ExtentOffset
 	store := partition.ExtentStore()
+	read := store.Read
+	if !isRepairRead && partition.verifyClientRead(p.ExtentID) {
+		read = func(extentID uint64, offset, size int64, nbuf []byte, isRepairRead bool) (uint32, error) {
+			return partition.verifiedRead(extentID, offset, size, nbuf)
+		}
+	}
 
 	for {
 		if needReplySize <= 0 {
@@ -497,7 +532,12 @@ func (s *DataNode) handleExtentRepaiReadPacket(p *repl.Packet, connect net.Conn,
 		reply.ExtentOffset = offset
 		p.Size = uint32(currReadSize)
 		p.ExtentOffset = offset
-		reply.CRC, err = store.Read(reply.ExtentID, offset, int64(currReadSize), reply.Data, isRepairRead)
+		reply.CRC, err = read(reply.ExtentID, offset, int64(currReadSize), reply.Data, isRepairRead)
+		if err == io.EOF && !isRepairRead && partition.QueueReadRepair(reply.ExtentID) {
+			// the local extent is shorter than the read, it is repaired from the other replicas in the background
+			log.LogWarnf("action[handleExtentRepaiReadPacket] partition(%v) extent(%v) offset(%v) beyond the local size, read repair queued.",
+				p.PartitionID, reply.ExtentID, offset)
+		}
 		partition.checkIsDiskError(err)
 		tpObject.Set(err)
 		p.CRC = reply.CRC
@@ -520,6 +560,9 @@ func (s *DataNode) handleExtentRepaiReadPacket(p *repl.Packet, connect net.Conn,
 			reply.LogMessage(reply.GetOpMsg(), connect.RemoteAddr().String(), reply.StartT, err))
 		log.LogReadf(logContent)
 	}
+	if !isRepairRead {
+		partition.recordExtentAccess(p.ExtentID)
+	}
 	p.PacketOkReply()
 
 	return
@@ -533,7 +576,13 @@ func (s *DataNode) handlePacketToGetAllWatermarks(p *repl.Packet) {
 	)
 	partition := p.Object.(*DataPartition)
 	store := partition.ExtentStore()
-	if p.ExtentType == proto.NormalExtentType {
+	if p.ExtentType == proto.NormalExtentType && p.Size > 0 {
+		// the watermarks of the listed normal extents only, such as the one of a read repair
+		extents := make([]uint64, 0)
+		if err = json.Unmarshal(p.Data[:p.Size], &extents); err == nil {
+			fInfoList = normalExtentWatermarks(store, extents)
+		}
+	} else if p.ExtentType == proto.NormalExtentType {
 		fInfoList, _, err = store.GetAllWatermarks(storage.NormalExtentFilter())
 	} else {
 		extents := make([]uint64, 0)
@@ -545,7 +594,7 @@ func (s *DataNode) handlePacketToGetAllWatermarks(p *repl.Packet) {
 	if err != nil {
 		p.PackErrorBody(ActionGetAllExtentWatermarks, err.Error())
 	} else {
-		buf, err = json.Marshal(fInfoList)
+		buf, err = json.Marshal(partition.maskUnverifiedExtents(fInfoList))
 		p.PacketOkWithBody(buf)
 	}
 	return
@@ -641,6 +690,7 @@ func (s *DataNode) handleTinyExtentRepairRead(request *repl.Packet, connect net.
 		reply.ExtentOffset = offset
 		reply.CRC, err = store.Read(reply.ExtentID, offset, int64(currReadSize), reply.Data, false)
 		if err != nil {
+			s.incDiskErrCnt(request.PartitionID, err, ReadFlag)
 			return
 		}
 		reply.Size = uint32(currReadSize)
@@ -722,7 +772,11 @@ func (s *DataNode) handlePacketToNotifyExtentRepair(p *repl.Packet) {
 		p.PackErrorBody(ActionRepair, err.Error())
 		return
 	}
-	partition.DoExtentStoreRepair(mf)
+	ctx, cancel := partition.newRepairContext(extractRepairTrace(context.Background(), mf))
+	defer cancel()
+	if _, err = partition.DoExtentStoreRepair(ctx, mf); err != nil {
+		log.LogWarnf("action[handlePacketToNotifyExtentRepair] %v.", err)
+	}
 	p.PacketOkReply()
 	return
 }
@@ -969,10 +1023,15 @@ func (s *DataNode) handlePacketToDataPartitionTryToLeaderrr(p *repl.Packet) {
 		return
 	}
 
-	if dp.raftPartition.IsRaftLeader() {
+	raftPartition := dp.raftPartition
+	if raftPartition == nil {
+		err = fmt.Errorf("%s partition(%v)", RaftNotStarted, dp.partitionID)
+		return
+	}
+	if raftPartition.IsRaftLeader() {
 		return
 	}
-	err = dp.raftPartition.TryToLeader(dp.partitionID)
+	err = raftPartition.TryToLeader(dp.partitionID)
 	return
 }
 
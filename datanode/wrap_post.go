@@ -18,6 +18,7 @@ import (
 	"github.com/chubaofs/chubaofs/repl"
 	"github.com/chubaofs/chubaofs/storage"
 	"sync/atomic"
+	"time"
 )
 
 func (s *DataNode) Post(p *repl.Packet) error {
@@ -74,4 +75,10 @@ func (s *DataNode) addMetrics(p *repl.Packet) {
 	if partition == nil {
 		return
 	}
+	if p.IsWriteOperation() {
+		partition.metrics.RecordWriteLatency(time.Duration(time.Now().UnixNano() - p.StartT))
+	}
+	if p.IsWriteOperation() || p.IsReadOperation() {
+		partition.metrics.recordIO()
+	}
 }
@@ -80,6 +80,10 @@ func (s *DataNode) checkPartition(p *repl.Packet) (err error) {
 		return
 	}
 	p.Object = dp
+	if frozen, _ := dp.IsFrozen(); frozen {
+		err = ErrPartitionFrozen
+		return
+	}
 	if p.IsWriteOperation() || p.IsCreateExtentOperation() {
 		if dp.Available() <= 0 {
 			err = storage.NoSpaceError
@@ -107,7 +111,7 @@ func (s *DataNode) addExtentInfo(p *repl.Packet) error {
 			return fmt.Errorf("addExtentInfo partition %v  %v GetTinyExtentOffset error %v", p.PartitionID, extentID, err.Error())
 		}
 	} else if p.IsLeaderPacket() && p.IsCreateExtentOperation() {
-		if partition.GetExtentCount() >= storage.MaxExtentCount*3 {
+		if partition.GetExtentCount() >= partition.MaxActiveExtents()*maxActiveExtentsCreateFactor {
 			return fmt.Errorf("addExtentInfo partition %v has reached maxExtentId", p.PartitionID)
 		}
 		p.ExtentID, err = store.NextExtentID()
@@ -518,6 +518,7 @@ func (partition *DataPartition) updateMetric(vr *proto.PartitionReport, dataNode
 	replica.Status = int8(vr.PartitionStatus)
 	replica.Total = vr.Total
 	replica.Used = vr.Used
+	replica.nearFull = vr.NearFull
 	partition.setMaxUsed()
 	replica.FileCount = uint32(vr.ExtentCount)
 	replica.setAlive()
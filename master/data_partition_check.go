@@ -55,6 +55,13 @@ func (partition *DataPartition) checkStatus(clusterName string, needLog bool, dp
 }
 
 func (partition *DataPartition) canWrite() bool {
+	// stop placing new writes on a partition once any replica is near full,
+	// so that the volume creates new partitions before it turns read-only
+	for _, replica := range partition.Replicas {
+		if replica.nearFull {
+			return false
+		}
+	}
 	avail := partition.total - partition.used
 	if int64(avail) > 10*util.GB {
 		return true
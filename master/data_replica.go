@@ -25,6 +25,7 @@ type DataReplica struct {
 	proto.DataReplica
 	dataNode *DataNode
 	loc      uint8
+	nearFull bool // reported by the data node once the used space reaches its soft limit
 }
 
 func newDataReplica(dataNode *DataNode) (replica *DataReplica) {
@@ -136,6 +136,7 @@ type CreateDataPartitionRequest struct {
 	Members       []Peer
 	Hosts         []string
 	CreateType    int
+	TinySize      int // size limit of the files written into the tiny extents, 0 follows the data node
 }
 
 // CreateDataPartitionResponse defines the response to the request of creating a data partition.
@@ -204,6 +205,9 @@ type LoadDataPartitionResponse struct {
 	PartitionStatus   int
 	Result            string
 	VolName           string
+	ManualReadOnly    bool
+	NearFull          bool
+	MaxActiveExtents  int
 }
 
 // File defines the file struct.
@@ -261,6 +265,7 @@ type PartitionReport struct {
 	IsLeader        bool
 	ExtentCount     int
 	NeedCompare     bool
+	NearFull        bool // still writable, but the used space reaches the soft limit
 }
 
 // DataNodeHeartbeatResponse defines the response to the data node heartbeat.
@@ -14,6 +14,12 @@
 
 package proto
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // CreateNameSpaceRequest defines the request to create a name space.
 type CreateNameSpaceRequest struct {
 	Name string
@@ -31,6 +37,26 @@ type Peer struct {
 	Addr string `json:"addr"`
 }
 
+// ParsePeers parses the peers in the format ID:HOST:PORT separated by the commas.
+func ParsePeers(value string) (peers []Peer, err error) {
+	for _, str := range strings.Split(value, ",") {
+		if str = strings.TrimSpace(str); str == "" {
+			continue
+		}
+		arr := strings.SplitN(str, ":", 2)
+		if len(arr) != 2 {
+			return nil, fmt.Errorf("peer(%v) invalid, expected ID:HOST:PORT", str)
+		}
+		var peer Peer
+		if peer.ID, err = strconv.ParseUint(arr[0], 10, 64); err != nil {
+			return nil, fmt.Errorf("peer(%v) invalid id: %v", str, err)
+		}
+		peer.Addr = arr[1]
+		peers = append(peers, peer)
+	}
+	return
+}
+
 // CreateMetaPartitionRequest defines the request to create a meta partition.
 type CreateMetaPartitionRequest struct {
 	MetaId      string
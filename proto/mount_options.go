@@ -45,6 +45,7 @@ const (
 	FsyncOnClose
 	MaxCPUs
 	EnableXattr
+	TinySize
 
 	MaxMountOption
 )
@@ -107,6 +108,7 @@ func InitMountOptions(opts []MountOption) {
 	opts[FsyncOnClose] = MountOption{"fsyncOnClose", "Perform fsync upon file close", "", true}
 	opts[MaxCPUs] = MountOption{"maxcpus", "The maximum number of CPUs that can be executing", "", int64(-1)}
 	opts[EnableXattr] = MountOption{"enableXattr", "Enable xattr support", "", false}
+	opts[TinySize] = MountOption{"tinySize", "Size limit in bytes of the files written into the tiny extents", "", int64(-1)}
 
 	for i := 0; i < MaxMountOption; i++ {
 		flag.StringVar(&opts[i].cmdlineValue, opts[i].keyword, "", opts[i].description)
@@ -234,4 +236,5 @@ type MountOptions struct {
 	FsyncOnClose  bool
 	MaxCPUs       int64
 	EnableXattr   bool
+	TinySize      int64
 }
@@ -123,6 +123,7 @@ const (
 	OpAddDataPartitionRaftMember    uint8 = 0x67
 	OpRemoveDataPartitionRaftMember uint8 = 0x68
 	OpDataPartitionTryToLeader      uint8 = 0x69
+	OpResizeDataPartition           uint8 = 0x6A // raft log of the data partition to change its size
 
 	// Operations: MultipartInfo
 	OpCreateMultipart  uint8 = 0x70
@@ -351,6 +352,8 @@ func (p *Packet) GetOpMsg() (m string) {
 		m = "OpMetaPartitionTryToLeader"
 	case OpDataPartitionTryToLeader:
 		m = "OpDataPartitionTryToLeader"
+	case OpResizeDataPartition:
+		m = "OpResizeDataPartition"
 	case OpMetaDeleteInode:
 		m = "OpMetaDeleteInode"
 	case OpMetaBatchDeleteInode:
@@ -15,6 +15,7 @@
 package repl
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
@@ -34,6 +35,10 @@ var (
 	ErrArgLenMismatch = errors.New("ArgLenMismatchErr")
 )
 
+// BatchDeleteExpiryArg marks the batch delete packets of the extents expired by the ttl, which are sent to a
+// replica only, so the arg carries no follower addresses.
+const BatchDeleteExpiryArg = "ttl_expiry"
+
 type Packet struct {
 	proto.Packet
 	followersAddrs  []string
@@ -272,6 +277,35 @@ func NewPacketToNotifyExtentRepair(partitionID uint64) (p *Packet) {
 	return
 }
 
+// NewPacketToTryToLeader returns a packet asking the replica to campaign for the leadership of the partition.
+func NewPacketToTryToLeader(partitionID uint64) (p *Packet) {
+	p = new(Packet)
+	p.Opcode = proto.OpDataPartitionTryToLeader
+	p.PartitionID = partitionID
+	p.Magic = proto.ProtoMagic
+	p.ExtentType = proto.NormalExtentType
+	p.ReqID = proto.GenerateRequestID()
+
+	return
+}
+
+// NewPacketToBatchDeleteExtent returns a packet to delete the extents expired by the ttl on a replica only, it is
+// not forwarded.
+func NewPacketToBatchDeleteExtent(partitionID uint64, exts []*proto.ExtentKey) (p *Packet) {
+	p = new(Packet)
+	p.Opcode = proto.OpBatchDeleteExtent
+	p.PartitionID = partitionID
+	p.Magic = proto.ProtoMagic
+	p.ExtentType = proto.NormalExtentType
+	p.Data, _ = json.Marshal(exts)
+	p.Size = uint32(len(p.Data))
+	p.Arg = []byte(BatchDeleteExpiryArg)
+	p.ArgLen = uint32(len(p.Arg))
+	p.ReqID = proto.GenerateRequestID()
+
+	return
+}
+
 func (p *Packet) IsErrPacket() bool {
 	return p.ResultCode != proto.OpOk && p.ResultCode != proto.OpInitResultCode
 }
@@ -374,6 +408,11 @@ func (p *Packet) IsMasterCommand() bool {
 	return false
 }
 
+// IsExpiryDeletePacket tells if the packet batch deletes the extents expired by the ttl of the leader.
+func (p *Packet) IsExpiryDeletePacket() bool {
+	return p.Opcode == proto.OpBatchDeleteExtent && string(p.Arg) == BatchDeleteExpiryArg
+}
+
 func (p *Packet) IsForwardPacket() bool {
 	r := p.RemainingFollowers > 0
 	return r
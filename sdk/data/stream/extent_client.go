@@ -23,6 +23,7 @@ import (
 
 	"github.com/chubaofs/chubaofs/proto"
 	"github.com/chubaofs/chubaofs/sdk/data/wrapper"
+	"github.com/chubaofs/chubaofs/util"
 	"github.com/chubaofs/chubaofs/util/errors"
 	"github.com/chubaofs/chubaofs/util/exporter"
 	"github.com/chubaofs/chubaofs/util/log"
@@ -41,6 +42,10 @@ const (
 
 	defaultWriteLimitRate  = rate.Inf
 	defaultWriteLimitBurst = 128
+
+	// the tiny extents are written in pages, and a tiny write must fit into a single packet buffer
+	tinySizeAlignment = 4 * util.KB
+	maxTinySize       = util.DefaultTinySizeLimit
 )
 
 var (
@@ -81,6 +86,7 @@ type ExtentConfig struct {
 	FollowerRead      bool
 	ReadRate          int64
 	WriteRate         int64
+	TinySize          int64 // files smaller than it are written into the tiny extents, zero for the default, no larger than the data nodes'
 	OnAppendExtentKey AppendExtentKeyFunc
 	OnGetExtents      GetExtentsFunc
 	OnTruncate        TruncateFunc
@@ -99,11 +105,15 @@ type ExtentClient struct {
 	getExtents      GetExtentsFunc
 	truncate        TruncateFunc
 	followerRead    bool
+	tinySize        int
 }
 
 // NewExtentClient returns a new extent client.
 func NewExtentClient(config *ExtentConfig) (client *ExtentClient, err error) {
 	client = new(ExtentClient)
+	if client.tinySize, err = parseTinySize(config.TinySize); err != nil {
+		return nil, err
+	}
 
 	limit := MaxMountRetryLimit
 retry:
@@ -142,6 +152,21 @@ retry:
 	return
 }
 
+// The boundary only decides where the new files are written. The existing extents are never moved between
+// the normal and tiny extents, since their kind is told by the extent id, so changing it takes effect on
+// the files written after the change only.
+func parseTinySize(size int64) (tinySize int, err error) {
+	if size <= 0 {
+		return util.DefaultTinySizeLimit, nil
+	}
+	if size > maxTinySize || size%tinySizeAlignment != 0 {
+		err = fmt.Errorf("invalid tiny size(%v): it must be a multiple of %v and no larger than %v",
+			size, tinySizeAlignment, maxTinySize)
+		return
+	}
+	return int(size), nil
+}
+
 // Open request shall grab the lock until request is sent to the request channel
 func (client *ExtentClient) OpenStream(inode uint64) error {
 	client.streamerLock.Lock()
@@ -567,5 +567,5 @@ func (s *Streamer) truncate(size int) error {
 }
 
 func (s *Streamer) tinySizeLimit() int {
-	return util.DefaultTinySizeLimit
+	return s.client.tinySize
 }
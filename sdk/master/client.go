@@ -43,6 +43,7 @@ type MasterClient struct {
 	masters    []string
 	useSSL     bool
 	leaderAddr string
+	failed     map[string]time.Time // the masters failed on connection errors, with the times they failed
 
 	adminAPI  *AdminAPI
 	clientAPI *ClientAPI
@@ -89,16 +90,8 @@ func (c *MasterClient) setLeader(addr string) {
 }
 
 func (c *MasterClient) serveRequest(r *request) (repsData []byte, err error) {
-	leaderAddr, nodes := c.prepareRequest()
-	host := leaderAddr
-	for i := -1; i < len(nodes); i++ {
-		if i == -1 {
-			if host == "" {
-				continue
-			}
-		} else {
-			host = nodes[i]
-		}
+	leaderAddr := c.Leader()
+	for _, host := range c.requestOrder() {
 		var resp *http.Response
 		var schema string
 		if c.useSSL {
@@ -111,6 +104,7 @@ func (c *MasterClient) serveRequest(r *request) (repsData []byte, err error) {
 		resp, err = c.httpRequest(r.method, url, r.params, r.header, r.body)
 		if err != nil {
 			log.LogErrorf("serveRequest: send http request fail: method(%v) url(%v) err(%v)", r.method, url, err)
+			c.markFailed(host)
 			continue
 		}
 		stateCode := resp.StatusCode
@@ -133,6 +127,7 @@ func (c *MasterClient) serveRequest(r *request) (repsData []byte, err error) {
 			repsData, err = c.serveRequest(r)
 			return
 		case http.StatusOK:
+			c.markHealthy(host)
 			if leaderAddr != host {
 				c.setLeader(host)
 			}
@@ -168,15 +163,6 @@ func (c *MasterClient) Nodes() (nodes []string) {
 	return
 }
 
-// prepareRequest returns the leader address and all master addresses.
-func (c *MasterClient) prepareRequest() (addr string, nodes []string) {
-	c.RLock()
-	addr = c.leaderAddr
-	nodes = c.masters
-	c.RUnlock()
-	return
-}
-
 func (c *MasterClient) httpRequest(method, url string, param, header map[string]string, reqData []byte) (resp *http.Response, err error) {
 	client := http.DefaultClient
 	reader := bytes.NewReader(reqData)
@@ -0,0 +1,179 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+const (
+	DefaultHealthProbeInterval = 10 * time.Second
+	healthProbeTimeout         = 3 * time.Second
+)
+
+// Return the masters in the order to be tried by a request. The last-known-good one comes first, followed
+// by the others rotated to start after it. The masters failed on connection errors are moved to the end,
+// so they are tried only if all the others fail, until the health probe finds them recovered.
+func (c *MasterClient) requestOrder() (hosts []string) {
+	c.RLock()
+	defer c.RUnlock()
+	start := 0
+	for i, master := range c.masters {
+		if master == c.leaderAddr {
+			start = i + 1
+			break
+		}
+	}
+	hosts = make([]string, 0, len(c.masters)+1)
+	if c.leaderAddr != "" {
+		hosts = append(hosts, c.leaderAddr)
+	}
+	failed := make([]string, 0)
+	for i := 0; i < len(c.masters); i++ {
+		master := c.masters[(start+i)%len(c.masters)]
+		if master == c.leaderAddr {
+			continue
+		}
+		if _, ok := c.failed[master]; ok {
+			failed = append(failed, master)
+			continue
+		}
+		hosts = append(hosts, master)
+	}
+	if _, ok := c.failed[c.leaderAddr]; ok && len(hosts) > 0 {
+		hosts = append(hosts[1:], hosts[0])
+	}
+	return append(hosts, failed...)
+}
+
+func (c *MasterClient) markFailed(addr string) {
+	c.Lock()
+	defer c.Unlock()
+	if c.failed == nil {
+		c.failed = make(map[string]time.Time)
+	}
+	if _, ok := c.failed[addr]; !ok {
+		c.failed[addr] = time.Now()
+		log.LogWarnf("markFailed: master(%v) failed, fail over to the others", addr)
+	}
+}
+
+func (c *MasterClient) markHealthy(addr string) {
+	c.Lock()
+	defer c.Unlock()
+	if since, ok := c.failed[addr]; ok {
+		delete(c.failed, addr)
+		log.LogInfof("markHealthy: master(%v) recovered after %v", addr, time.Since(since))
+	}
+}
+
+// FailedNodes returns the masters failed on connection errors and not recovered yet.
+func (c *MasterClient) FailedNodes() (nodes []string) {
+	c.RLock()
+	defer c.RUnlock()
+	nodes = make([]string, 0, len(c.failed))
+	for _, master := range c.masters {
+		if _, ok := c.failed[master]; ok {
+			nodes = append(nodes, master)
+		}
+	}
+	return
+}
+
+// StartHealthProbe probes the failed masters at the interval until stopC is closed. A recovered master is
+// tried in its turn again, and becomes the first one to be tried if it answers as the leader, so the
+// requests move back to the leader once it recovers.
+func (c *MasterClient) StartHealthProbe(interval time.Duration, stopC chan bool) {
+	if interval <= 0 {
+		interval = DefaultHealthProbeInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopC:
+				return
+			case <-ticker.C:
+				c.probeFailedNodes()
+			}
+		}
+	}()
+}
+
+func (c *MasterClient) probeFailedNodes() {
+	for _, master := range c.FailedNodes() {
+		if _, err := c.probe(master, proto.AdminGetIP); err != nil {
+			log.LogDebugf("probeFailedNodes: master(%v) still failed: err(%v)", master, err)
+			continue
+		}
+		c.markHealthy(master)
+		leader, err := c.probeLeader(master)
+		if err != nil {
+			log.LogDebugf("probeFailedNodes: get the leader from master(%v) failed: err(%v)", master, err)
+			continue
+		}
+		if leader == master && c.Leader() != master {
+			log.LogInfof("probeFailedNodes: recovered master(%v) answered as the leader", master)
+			c.setLeader(master)
+		}
+	}
+}
+
+// Return the leader in the cluster view of the master, the followers proxy the request to the leader.
+func (c *MasterClient) probeLeader(addr string) (leader string, err error) {
+	var data []byte
+	if data, err = c.probe(addr, proto.AdminGetCluster); err != nil {
+		return
+	}
+	body := &struct {
+		Code int32             `json:"code"`
+		Msg  string            `json:"msg"`
+		Data proto.ClusterView `json:"data"`
+	}{}
+	if err = json.Unmarshal(data, body); err != nil {
+		return
+	}
+	if body.Code != 0 {
+		err = proto.ParseErrorCode(body.Code)
+		return
+	}
+	return body.Data.LeaderAddr, nil
+}
+
+func (c *MasterClient) probe(addr, path string) (data []byte, err error) {
+	var schema = "http"
+	if c.useSSL {
+		schema = "https"
+	}
+	client := &http.Client{Timeout: healthProbeTimeout}
+	var resp *http.Response
+	if resp, err = client.Get(fmt.Sprintf("%s://%s%s", schema, addr, path)); err != nil {
+		return
+	}
+	data, err = ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("status(%v)", resp.StatusCode)
+	}
+	return
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package master
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// The test master answers with its own address, and with the address returned by leader to the cluster view.
+func newTestMaster(t *testing.T, listener net.Listener, leader func() string) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == proto.AdminGetCluster {
+			fmt.Fprintf(w, `{"code":0,"msg":"success","data":{"LeaderAddr":"%v"}}`, leader())
+			return
+		}
+		fmt.Fprintf(w, `{"code":0,"msg":"success","data":"%v"}`, listener.Addr().String())
+	}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	return server
+}
+
+func listenTestMaster(t *testing.T, addr string) net.Listener {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+func TestMasterFailover(t *testing.T) {
+	preferred := listenTestMaster(t, "127.0.0.1:0")
+	preferredAddr := preferred.Addr().String()
+	preferred.Close()
+	var leaderAddr atomic.Value
+	leader := func() string { return leaderAddr.Load().(string) }
+	second := newTestMaster(t, listenTestMaster(t, "127.0.0.1:0"), leader)
+	defer second.Close()
+	third := newTestMaster(t, listenTestMaster(t, "127.0.0.1:0"), leader)
+	defer third.Close()
+	secondAddr, thirdAddr := second.Listener.Addr().String(), third.Listener.Addr().String()
+	leaderAddr.Store(thirdAddr)
+
+	mc := NewMasterClient([]string{preferredAddr, secondAddr, thirdAddr}, false)
+	data, err := mc.serveRequest(newAPIRequest(http.MethodGet, "/test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"`+secondAddr+`"` || mc.Leader() != secondAddr {
+		t.Fatalf("served by %s leader(%v), expected %v", data, mc.Leader(), secondAddr)
+	}
+	if failed := mc.FailedNodes(); !reflect.DeepEqual(failed, []string{preferredAddr}) {
+		t.Fatalf("failed masters(%v), expected %v", failed, preferredAddr)
+	}
+	if order := mc.requestOrder(); !reflect.DeepEqual(order, []string{secondAddr, thirdAddr, preferredAddr}) {
+		t.Fatalf("request order(%v) unexpected", order)
+	}
+
+	// the failed master is kept failed until it recovers
+	mc.probeFailedNodes()
+	if mc.Leader() != secondAddr || len(mc.FailedNodes()) != 1 {
+		t.Fatalf("leader(%v) failed(%v) changed by the probe of a failed master", mc.Leader(), mc.FailedNodes())
+	}
+	recovered := newTestMaster(t, listenTestMaster(t, preferredAddr), leader)
+	defer recovered.Close()
+	mc.probeFailedNodes()
+	if mc.Leader() != secondAddr || len(mc.FailedNodes()) != 0 {
+		t.Fatalf("leader(%v) failed(%v), expected the recovered follower only marked healthy", mc.Leader(), mc.FailedNodes())
+	}
+
+	// the recovered master answering as the leader is tried first
+	leaderAddr.Store(preferredAddr)
+	mc.markFailed(preferredAddr)
+	mc.probeFailedNodes()
+	if mc.Leader() != preferredAddr || len(mc.FailedNodes()) != 0 {
+		t.Fatalf("leader(%v) failed(%v), expected the recovered leader preferred", mc.Leader(), mc.FailedNodes())
+	}
+	if data, err = mc.serveRequest(newAPIRequest(http.MethodGet, "/test")); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"`+preferredAddr+`"` {
+		t.Fatalf("served by %s, expected %v", data, preferredAddr)
+	}
+}
+
+func TestMasterRequestOrder(t *testing.T) {
+	mc := NewMasterClient([]string{"m1", "m2", "m3"}, false)
+	if order := mc.requestOrder(); !reflect.DeepEqual(order, []string{"m1", "m2", "m3"}) {
+		t.Fatalf("request order(%v) without a leader unexpected", order)
+	}
+	mc.setLeader("m2")
+	if order := mc.requestOrder(); !reflect.DeepEqual(order, []string{"m2", "m3", "m1"}) {
+		t.Fatalf("request order(%v) not rotated after the leader", order)
+	}
+	mc.markFailed("m2")
+	mc.markFailed("m3")
+	if order := mc.requestOrder(); !reflect.DeepEqual(order, []string{"m1", "m2", "m3"}) {
+		t.Fatalf("request order(%v) with the failed leader unexpected", order)
+	}
+	mc.markHealthy("m3")
+	if order := mc.requestOrder(); !reflect.DeepEqual(order, []string{"m3", "m1", "m2"}) {
+		t.Fatalf("request order(%v) after the recovery unexpected", order)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import "golang.org/x/sys/unix"
+
+// Returns the birth time of the file in seconds, 0 if the file system does not keep it.
+func fileBirthTime(name string) (sec int64, err error) {
+	var stat unix.Statx_t
+	if err = unix.Statx(unix.AT_FDCWD, name, unix.AT_SYMLINK_NOFOLLOW, unix.STATX_BTIME, &stat); err != nil {
+		return
+	}
+	if stat.Mask&unix.STATX_BTIME == 0 {
+		return
+	}
+	return stat.Btime.Sec, nil
+}
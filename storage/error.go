@@ -33,6 +33,10 @@ var (
 	ExtentIsFullError         = errors.New("extent is full")
 	BrokenExtentError         = errors.New("extent has been broken")
 	BrokenDiskError           = errors.New("disk has broken")
+
+	ExtentStoreEncryptedError    = errors.New("extent store is encrypted, the key is required")
+	ExtentKeyMismatchError       = errors.New("extent store is encrypted by another key")
+	ExtentStoreNotEncryptedError = errors.New("extent store is kept in plaintext, it is not encrypted in place")
 )
 
 func NewParameterMismatchErr(msg string) (err error) {
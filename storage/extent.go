@@ -44,7 +44,9 @@ type ExtentInfo struct {
 	Crc        uint32 `json:"Crc"`
 	IsDeleted  bool   `json:"deleted"`
 	ModifyTime int64  `json:"modTime"`
+	CreateTime int64  `json:"createTime,omitempty"`
 	Source     string `json:"src"`
+	Inode      uint64 `json:"ino,omitempty"` // the inode the extent is created for, 0 if unknown
 }
 
 func (ei *ExtentInfo) String() (m string) {
@@ -63,9 +65,11 @@ type Extent struct {
 	filePath   string
 	extentID   uint64
 	modifyTime int64
+	createTime int64
 	dataSize   int64
 	hasClose   int32
 	header     []byte
+	sealer     *extentSealer // nil if the extent is kept in plaintext
 	sync.Mutex
 }
 
@@ -90,6 +94,9 @@ func (e *Extent) Close() (err error) {
 	if err = e.file.Close(); err != nil {
 		return
 	}
+	if e.sealer != nil {
+		err = e.sealer.close()
+	}
 	return
 }
 
@@ -117,12 +124,19 @@ func (e *Extent) InitToFS() (err error) {
 			os.Remove(e.filePath)
 		}
 	}()
+	// the records left by a failed creation are not of the new extent
+	if e.sealer != nil {
+		if err = e.sealer.open(os.O_CREATE | os.O_TRUNC | os.O_RDWR); err != nil {
+			return
+		}
+	}
 
 	if IsTinyExtent(e.extentID) {
 		e.dataSize = 0
 		return
 	}
 	atomic.StoreInt64(&e.modifyTime, time.Now().Unix())
+	e.createTime = e.modifyTime
 	e.dataSize = 0
 	return
 }
@@ -135,6 +149,12 @@ func (e *Extent) RestoreFromFS() (err error) {
 		}
 		return err
 	}
+	if e.sealer != nil {
+		if err = e.sealer.open(os.O_RDWR); err != nil {
+			e.file.Close()
+			return fmt.Errorf("open seal file: %v", err)
+		}
+	}
 	var (
 		info os.FileInfo
 	)
@@ -152,6 +172,10 @@ func (e *Extent) RestoreFromFS() (err error) {
 	}
 	e.dataSize = info.Size()
 	atomic.StoreInt64(&e.modifyTime, info.ModTime().Unix())
+	if e.createTime, err = fileBirthTime(e.filePath); err != nil || e.createTime == 0 {
+		// the file system keeps no birth time, the modification time is never earlier than the creation
+		e.createTime, err = info.ModTime().Unix(), nil
+	}
 	return
 }
 
@@ -160,6 +184,11 @@ func (e *Extent) Size() (size int64) {
 	return e.dataSize
 }
 
+// CreateTime returns the time when this extent was created on the local disk.
+func (e *Extent) CreateTime() int64 {
+	return e.createTime
+}
+
 // ModifyTime returns the time when this extent was modified recently.
 func (e *Extent) ModifyTime() int64 {
 	return atomic.LoadInt64(&e.modifyTime)
@@ -186,11 +215,11 @@ func (e *Extent) WriteTiny(data []byte, offset, size int64, crc uint32, writeTyp
 		return ParameterMismatchError
 	}
 
-	if _, err = e.file.WriteAt(data[:size], int64(offset)); err != nil {
+	if err = e.writeAt(data[:size], int64(offset)); err != nil {
 		return
 	}
 	if isSync {
-		if err = e.file.Sync(); err != nil {
+		if err = e.Flush(); err != nil {
 			return
 		}
 	}
@@ -216,7 +245,7 @@ func (e *Extent) Write(data []byte, offset, size int64, crc uint32, writeType in
 	if err = e.checkOffsetAndSize(offset, size); err != nil {
 		return
 	}
-	if _, err = e.file.WriteAt(data[:size], int64(offset)); err != nil {
+	if err = e.writeAt(data[:size], int64(offset)); err != nil {
 		return
 	}
 	blockNo := offset / util.BlockSize
@@ -228,7 +257,7 @@ func (e *Extent) Write(data []byte, offset, size int64, crc uint32, writeType in
 		}
 	}()
 	if isSync {
-		if err = e.file.Sync(); err != nil {
+		if err = e.Flush(); err != nil {
 			return
 		}
 	}
@@ -255,7 +284,7 @@ func (e *Extent) Read(data []byte, offset, size int64, isRepairRead bool) (crc u
 	if err = e.checkOffsetAndSize(offset, size); err != nil {
 		return
 	}
-	if _, err = e.file.ReadAt(data[:size], offset); err != nil {
+	if _, err = e.readAt(data[:size], offset); err != nil {
 		return
 	}
 	crc = crc32.ChecksumIEEE(data)
@@ -264,7 +293,7 @@ func (e *Extent) Read(data []byte, offset, size int64, isRepairRead bool) (crc u
 
 // ReadTiny read data from a tiny extent.
 func (e *Extent) ReadTiny(data []byte, offset, size int64, isRepairRead bool) (crc uint32, err error) {
-	_, err = e.file.ReadAt(data[:size], offset)
+	_, err = e.readAt(data[:size], offset)
 	if isRepairRead && err == io.EOF {
 		err = nil
 	}
@@ -289,8 +318,10 @@ func (e *Extent) checkOffsetAndSize(offset, size int64) error {
 
 // Flush synchronizes data to the disk.
 func (e *Extent) Flush() (err error) {
-	err = e.file.Sync()
-	return
+	if err = e.file.Sync(); err != nil || e.sealer == nil {
+		return
+	}
+	return e.sealer.sync()
 }
 
 func (e *Extent) autoComputeExtentCrc(crcFunc UpdateCrcFunc) (crc uint32, err error) {
@@ -308,7 +339,7 @@ func (e *Extent) autoComputeExtentCrc(crcFunc UpdateCrcFunc) (crc uint32, err er
 		}
 		bdata := make([]byte, util.BlockSize)
 		offset := int64(blockNo * util.BlockSize)
-		readN, err := e.file.ReadAt(bdata[:util.BlockSize], offset)
+		readN, err := e.readAt(bdata[:util.BlockSize], offset)
 		if readN == 0 && err != nil {
 			break
 		}
@@ -330,6 +361,48 @@ const (
 	FallocFLPunchHole = 2
 )
 
+// Punch the holes on the allocated pages in [offset, offset+size) holding only zeros.
+// The holes in the range are skipped with SEEK_DATA, so only the allocated pages are read.
+func (e *Extent) punchZeroPages(offset, size int64) (err error) {
+	page := make([]byte, PageSize)
+	end := offset + size
+	offset = offset - offset%PageSize
+	for offset < end {
+		var dataOffset int64
+		if dataOffset, err = e.file.Seek(offset, SEEK_DATA); err != nil {
+			if strings.Contains(err.Error(), syscall.ENXIO.Error()) {
+				return nil
+			}
+			return
+		}
+		offset = dataOffset - dataOffset%PageSize
+		if offset >= end {
+			return
+		}
+		var readN int
+		if readN, err = e.readAt(page, offset); err != nil && err != io.EOF {
+			return
+		}
+		err = nil
+		if readN == PageSize && isZeroPage(page) {
+			if err = e.punchHole(offset, PageSize); err != nil {
+				return
+			}
+		}
+		offset += PageSize
+	}
+	return
+}
+
+func isZeroPage(page []byte) bool {
+	for _, b := range page {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // DeleteTiny deletes a tiny extent.
 func (e *Extent) DeleteTiny(offset, size int64) (hasDelete bool, err error) {
 	if int(offset)%PageSize != 0 {
@@ -354,7 +427,7 @@ func (e *Extent) DeleteTiny(offset, size int64) (hasDelete bool, err error) {
 		hasDelete = true
 		return true, nil
 	}
-	err = fallocate(int(e.file.Fd()), FallocFLPunchHole|FallocFLKeepSize, offset, size)
+	err = e.punchHole(offset, size)
 	return
 }
 
@@ -388,9 +461,9 @@ func (e *Extent) TinyExtentRecover(data []byte, offset, size int64, crc uint32,
 		if err = syscall.Ftruncate(int(e.file.Fd()), offset+size); err != nil {
 			return err
 		}
-		err = fallocate(int(e.file.Fd()), FallocFLPunchHole|FallocFLKeepSize, offset, size)
+		err = e.punchHole(offset, size)
 	} else {
-		_, err = e.file.WriteAt(data[:size], int64(offset))
+		err = e.writeAt(data[:size], int64(offset))
 	}
 	if err != nil {
 		return
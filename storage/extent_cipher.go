@@ -0,0 +1,524 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+)
+
+// The extents of an encrypted store are sealed page by page by AES-GCM, under a key derived from the key of the
+// store for every extent:
+//
+//   - the extent file keeps the ciphertext at the offsets of the plaintext and is as long as it, so the sizes,
+//     the watermarks and the holes punched on the tiny extents are the same as the ones of a plain store.
+//   - the nonce, the tag and the length sealed of every page are recorded in the seal file of the extent under
+//     ExtentSealDirName, and a page without a record is a hole which reads as zeros.
+//   - every page has two record slots, and a page sealed again is recorded in the slot not holding the record
+//     of the ciphertext on the disk, which is synced before the ciphertext is overwritten. So a crash in between
+//     leaves the old ciphertext opened by the old record, the page is opened by whichever slot opens it. The
+//     record of a page sealed for the first time is written after the ciphertext, a crash in between leaves a
+//     hole.
+//   - the block crcs and the crcs returned by the reads are all of the plaintext, so the replicas sealed by the
+//     nonces of their own agree on them, and the repair streams the plaintext the same way the clients write it.
+//
+// A store is encrypted from its creation on, which is recorded by the cipher file along with the fingerprint of
+// the key, and it is never opened by another key or without one.
+const (
+	ExtentCipherFileName     = "EXTENT_CIPHER"
+	TempExtentCipherFileName = ".EXTENT_CIPHER"
+	ExtentSealDirName        = "EXTENT_SEAL"
+	ExtentCipherAESGCM       = "aes-gcm"
+
+	sealPageSize   = PageSize
+	sealNonceSize  = 12
+	sealTagSize    = 16
+	sealRecordSize = 32 // the nonce, the tag and the length sealed of a page
+
+	sealSlotCount      = 2
+	sealPageRecordSize = sealRecordSize * sealSlotCount // the record slots of a page
+)
+
+// ExtentCipherInfo is the content of the cipher file.
+type ExtentCipherInfo struct {
+	Cipher      string `json:"cipher"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// ExtentCipher seals the extents of a store by the key of it.
+type ExtentCipher struct {
+	key         []byte
+	fingerprint string
+}
+
+// NewExtentCipher returns the cipher of the key of 16, 24 or 32 bytes, for AES-128, AES-192 or AES-256.
+func NewExtentCipher(key []byte) (c *ExtentCipher, err error) {
+	if _, err = aes.NewCipher(key); err != nil {
+		return nil, fmt.Errorf("new extent cipher: %v", err)
+	}
+	c = &ExtentCipher{key: append([]byte(nil), key...)}
+	c.fingerprint = hex.EncodeToString(c.derive([]byte("fingerprint"))[:8])
+	return
+}
+
+func (c *ExtentCipher) derive(info []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(info)
+	return mac.Sum(nil)
+}
+
+// Fingerprint identifies the key without revealing it.
+func (c *ExtentCipher) Fingerprint() string {
+	return c.fingerprint
+}
+
+// The AEAD of the extent of the partition under the key derived for it, which keeps the nonces drawn at random
+// for the pages far from colliding under one key.
+func (c *ExtentCipher) extentAEAD(partitionID, extentID uint64) (aead cipher.AEAD, err error) {
+	info := make([]byte, len("extent")+16)
+	copy(info, "extent")
+	binary.BigEndian.PutUint64(info[len("extent"):], partitionID)
+	binary.BigEndian.PutUint64(info[len("extent")+8:], extentID)
+	block, err := aes.NewCipher(c.derive(info)[:len(c.key)])
+	if err != nil {
+		return
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncryptedExtentStore tells if the extent store under the directory is encrypted.
+func IsEncryptedExtentStore(dataDir string) (encrypted bool, err error) {
+	if _, err = os.Stat(path.Join(dataDir, ExtentCipherFileName)); os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Check the cipher the store under the directory is opened with against the cipher file. The cipher file of a
+// new store is written by the cipher, while a store created in plaintext is not to be encrypted in place.
+func checkExtentCipher(dataDir string, c *ExtentCipher) (err error) {
+	data, err := ioutil.ReadFile(path.Join(dataDir, ExtentCipherFileName))
+	switch {
+	case os.IsNotExist(err) && c == nil:
+		return nil
+	case os.IsNotExist(err):
+		if _, statErr := os.Stat(path.Join(dataDir, ExtBaseExtentIDFileName)); statErr == nil {
+			return ExtentStoreNotEncryptedError
+		}
+		if err = MkdirAll(path.Join(dataDir, ExtentSealDirName)); err != nil {
+			return
+		}
+		return writeExtentCipherInfo(dataDir, &ExtentCipherInfo{Cipher: ExtentCipherAESGCM, Fingerprint: c.Fingerprint()})
+	case err != nil:
+		return
+	case c == nil:
+		return ExtentStoreEncryptedError
+	}
+	info := &ExtentCipherInfo{}
+	if err = json.Unmarshal(data, info); err != nil {
+		return fmt.Errorf("parse %v: %v", ExtentCipherFileName, err)
+	}
+	if info.Cipher != ExtentCipherAESGCM {
+		return fmt.Errorf("parse %v: unknown cipher(%v)", ExtentCipherFileName, info.Cipher)
+	}
+	if info.Fingerprint != c.Fingerprint() {
+		return ExtentKeyMismatchError
+	}
+	return MkdirAll(path.Join(dataDir, ExtentSealDirName))
+}
+
+func writeExtentCipherInfo(dataDir string, info *ExtentCipherInfo) (err error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	tempFile := path.Join(dataDir, TempExtentCipherFileName)
+	var fp *os.File
+	if fp, err = os.OpenFile(tempFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666); err != nil {
+		return
+	}
+	if _, err = fp.Write(data); err != nil {
+		fp.Close()
+		return
+	}
+	if err = fp.Sync(); err != nil {
+		fp.Close()
+		return
+	}
+	fp.Close()
+	if err = os.Rename(tempFile, path.Join(dataDir, ExtentCipherFileName)); err != nil {
+		return
+	}
+	return syncDir(dataDir)
+}
+
+func sealFilePath(dataDir string, extentID uint64) string {
+	return path.Join(dataDir, ExtentSealDirName, strconv.FormatUint(extentID, 10))
+}
+
+// extentSealer seals the pages of an extent file, and keeps the records of them in the seal file.
+type extentSealer struct {
+	sync.RWMutex // a page written in part is merged with the plaintext of it, which must not change meanwhile
+	aead         cipher.AEAD
+	filePath     string
+	file         *os.File
+}
+
+func (s *extentSealer) open(flag int) (err error) {
+	s.file, err = os.OpenFile(s.filePath, flag, 0666)
+	return
+}
+
+func (s *extentSealer) close() error {
+	return s.file.Close()
+}
+
+func (s *extentSealer) sync() error {
+	return s.file.Sync()
+}
+
+func sealedLength(record []byte) int {
+	return int(binary.BigEndian.Uint32(record[sealNonceSize+sealTagSize:]))
+}
+
+func pageAAD(pageNo int64, length int) []byte {
+	aad := make([]byte, 12)
+	binary.BigEndian.PutUint64(aad, uint64(pageNo))
+	binary.BigEndian.PutUint32(aad[8:], uint32(length))
+	return aad
+}
+
+// Read the record slots of the pages [first, first+count), the ones beyond the seal file are the records of holes.
+func (s *extentSealer) readRecords(first, count int64) (records []byte, err error) {
+	records = make([]byte, count*sealPageRecordSize)
+	if _, err = s.file.ReadAt(records, first*sealPageRecordSize); err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+func recordSlot(records []byte, slot int) []byte {
+	return records[slot*sealRecordSize : (slot+1)*sealRecordSize]
+}
+
+// The slot a page is sealed again into, the one not holding the record of its ciphertext.
+func otherSlot(slot int) int {
+	if slot == 0 {
+		return 1
+	}
+	return 0
+}
+
+// Open the ciphertext of the page by the record slot which opens it into the plaintext, which is a page long and
+// zero beyond the length sealed. The slot is -1 if the page is a hole.
+func (s *extentSealer) openPage(pageNo int64, records, ciphertext, plaintext []byte) (slot, length int, err error) {
+	for i := range plaintext {
+		plaintext[i] = 0
+	}
+	slot = -1
+	for i := 0; i < sealSlotCount; i++ {
+		record := recordSlot(records, i)
+		if length = sealedLength(record); length == 0 {
+			continue
+		}
+		if length > sealPageSize || length > len(ciphertext) {
+			err = fmt.Errorf("page(%v) sealed length(%v) exceeds the data(%v) of the extent", pageNo, length, len(ciphertext))
+			continue
+		}
+		sealed := make([]byte, 0, length+sealTagSize)
+		sealed = append(sealed, ciphertext[:length]...)
+		sealed = append(sealed, record[sealNonceSize:sealNonceSize+sealTagSize]...)
+		if _, openErr := s.aead.Open(plaintext[:0], record[:sealNonceSize], sealed, pageAAD(pageNo, length)); openErr != nil {
+			err = fmt.Errorf("open page(%v): %v", pageNo, openErr)
+			continue
+		}
+		return i, length, nil
+	}
+	length = 0
+	return
+}
+
+// Seal the plaintext of the page into the ciphertext, and fill the record of it.
+func (s *extentSealer) sealPage(pageNo int64, plaintext, ciphertext, record []byte) (err error) {
+	nonce := record[:sealNonceSize]
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+	sealed := s.aead.Seal(make([]byte, 0, len(plaintext)+sealTagSize), nonce, plaintext, pageAAD(pageNo, len(plaintext)))
+	copy(ciphertext, sealed[:len(plaintext)])
+	copy(record[sealNonceSize:], sealed[len(plaintext):])
+	binary.BigEndian.PutUint32(record[sealNonceSize+sealTagSize:], uint32(len(plaintext)))
+	return
+}
+
+// Read the plaintext of [offset, offset+len(data)) of the extent file the same way as os.File.ReadAt, which
+// reads short with io.EOF at the end of the file.
+func (s *extentSealer) readAt(file *os.File, data []byte, offset int64) (n int, err error) {
+	if len(data) == 0 {
+		return
+	}
+	s.RLock()
+	defer s.RUnlock()
+	first, last := offset/sealPageSize, (offset+int64(len(data))-1)/sealPageSize
+	start := first * sealPageSize
+	buf := make([]byte, (last-first+1)*sealPageSize)
+	readN, err := file.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return
+	}
+	buf = buf[:readN]
+	records, err := s.readRecords(first, last-first+1)
+	if err != nil {
+		return
+	}
+	// the pages are opened in place, the ciphertext of a page is copied out before its plaintext is written
+	plaintext := make([]byte, sealPageSize)
+	for i := int64(0); i*sealPageSize < int64(len(buf)); i++ {
+		page := buf[i*sealPageSize:]
+		if len(page) > sealPageSize {
+			page = page[:sealPageSize]
+		}
+		if _, _, err = s.openPage(first+i, records[i*sealPageRecordSize:(i+1)*sealPageRecordSize], page, plaintext); err != nil {
+			return 0, err
+		}
+		copy(page, plaintext)
+	}
+	if offset-start < int64(len(buf)) {
+		n = copy(data, buf[offset-start:])
+	}
+	if n < len(data) {
+		err = io.EOF
+	}
+	return
+}
+
+// Seal the data into [offset, offset+len(data)) of the extent file. A page written in part is merged with the
+// plaintext of it, and every page is sealed again from its start to the end of either the old or the new data.
+// The pages holding data already are recorded in their other slots, which are synced before the ciphertext is
+// written, and the records of the new pages are written after it.
+func (s *extentSealer) writeAt(file *os.File, data []byte, offset int64) (err error) {
+	if len(data) == 0 {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	end := offset + int64(len(data))
+	first, last := offset/sealPageSize, (end-1)/sealPageSize
+	start, count := first*sealPageSize, last-first+1
+	records, err := s.readRecords(first, count)
+	if err != nil {
+		return
+	}
+	buf := make([]byte, count*sealPageSize)
+	lengths := make([]int, count)
+	slots := make([]int, count)
+	for i := int64(0); i < count; i++ {
+		pageStart := (first + i) * sealPageSize
+		inEnd := int64(sealPageSize)
+		if end < pageStart+sealPageSize {
+			inEnd = end - pageStart
+		}
+		pageRecords := records[i*sealPageRecordSize : (i+1)*sealPageRecordSize]
+		var length int
+		if slots[i], length, err = s.readPage(file, first+i, pageRecords, buf[i*sealPageSize:(i+1)*sealPageSize]); err != nil {
+			return
+		}
+		if lengths[i] = length; int64(length) < inEnd {
+			lengths[i] = int(inEnd)
+		}
+	}
+	copy(buf[offset-start:], data)
+	ciphertext := make([]byte, len(buf))
+	sealed := make([]byte, len(records))
+	copy(sealed, records)
+	resealed := false
+	for i := int64(0); i < count; i++ {
+		page := buf[i*sealPageSize : i*sealPageSize+int64(lengths[i])]
+		slot := otherSlot(slots[i])
+		record := recordSlot(sealed[i*sealPageRecordSize:], slot)
+		if err = s.sealPage(first+i, page, ciphertext[i*sealPageSize:], record); err != nil {
+			return
+		}
+		if slots[i] >= 0 {
+			copy(recordSlot(records[i*sealPageRecordSize:], slot), record)
+			resealed = true
+		}
+	}
+	if resealed {
+		if _, err = s.file.WriteAt(records, first*sealPageRecordSize); err != nil {
+			return
+		}
+		if err = s.file.Sync(); err != nil {
+			return
+		}
+	}
+	// the pages before the last one are whole, so the ciphertext written is contiguous
+	if _, err = file.WriteAt(ciphertext[:(count-1)*sealPageSize+int64(lengths[count-1])], start); err != nil {
+		return
+	}
+	_, err = s.file.WriteAt(sealed, first*sealPageRecordSize)
+	return
+}
+
+// Read the plaintext of the page sealed by one of the record slots, and return the slot and the length sealed.
+func (s *extentSealer) readPage(file *os.File, pageNo int64, records, plaintext []byte) (slot, length int, err error) {
+	for i := 0; i < sealSlotCount; i++ {
+		if n := sealedLength(recordSlot(records, i)); n > length {
+			length = n
+		}
+	}
+	if length == 0 {
+		for i := range plaintext {
+			plaintext[i] = 0
+		}
+		return -1, 0, nil
+	}
+	if length > sealPageSize {
+		length = sealPageSize
+	}
+	ciphertext := make([]byte, length)
+	var readN int
+	if readN, err = file.ReadAt(ciphertext, pageNo*sealPageSize); err != nil && err != io.EOF {
+		return
+	}
+	return s.openPage(pageNo, records, ciphertext[:readN], plaintext)
+}
+
+// Punch the holes of [offset, offset+size) on the extent file and drop the records of the pages punched, which
+// read as zeros after. A page punched in part is not punched on the file, but sealed again with the range zeroed,
+// since the ciphertext left in the page is needed to open it.
+func (s *extentSealer) punch(file *os.File, offset, size int64) (err error) {
+	if size <= 0 {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	end := offset + size
+	first, last := (offset+sealPageSize-1)/sealPageSize, end/sealPageSize
+	if first > last {
+		return s.zeroPage(file, offset/sealPageSize, offset%sealPageSize, end-offset/sealPageSize*sealPageSize)
+	}
+	if offset < first*sealPageSize {
+		if err = s.zeroPage(file, first-1, offset%sealPageSize, sealPageSize); err != nil {
+			return
+		}
+	}
+	if last > first {
+		if err = fallocate(int(file.Fd()), FallocFLPunchHole|FallocFLKeepSize, first*sealPageSize, (last-first)*sealPageSize); err != nil {
+			return
+		}
+		if _, err = s.file.WriteAt(make([]byte, (last-first)*sealPageRecordSize), first*sealPageRecordSize); err != nil {
+			return
+		}
+	}
+	if end > last*sealPageSize {
+		err = s.zeroPage(file, last, 0, end-last*sealPageSize)
+	}
+	return
+}
+
+// Zero [inStart, inEnd) of the page and seal it again as long as before, the range beyond the length sealed
+// reads as zeros already. The page is recorded in its other slot, which is synced before the ciphertext is
+// written.
+func (s *extentSealer) zeroPage(file *os.File, pageNo, inStart, inEnd int64) (err error) {
+	records, err := s.readRecords(pageNo, 1)
+	if err != nil {
+		return
+	}
+	plaintext := make([]byte, sealPageSize)
+	slot, sealedLen, err := s.readPage(file, pageNo, records, plaintext)
+	if err != nil {
+		return
+	}
+	length := int64(sealedLen)
+	if length <= inStart {
+		return
+	}
+	if inEnd > length {
+		inEnd = length
+	}
+	for i := inStart; i < inEnd; i++ {
+		plaintext[i] = 0
+	}
+	ciphertext := make([]byte, length)
+	if err = s.sealPage(pageNo, plaintext[:length], ciphertext, recordSlot(records, otherSlot(slot))); err != nil {
+		return
+	}
+	if _, err = s.file.WriteAt(records, pageNo*sealPageRecordSize); err != nil {
+		return
+	}
+	if err = s.file.Sync(); err != nil {
+		return
+	}
+	_, err = file.WriteAt(ciphertext, pageNo*sealPageSize)
+	return
+}
+
+// Create the sealer of the extent if the store is encrypted.
+func (s *ExtentStore) newExtent(extentID uint64) (e *Extent, err error) {
+	e = NewExtentInCore(s.extentPath(extentID), extentID)
+	if s.cipher == nil {
+		return
+	}
+	var aead cipher.AEAD
+	if aead, err = s.cipher.extentAEAD(s.partitionID, extentID); err != nil {
+		return nil, err
+	}
+	e.sealer = &extentSealer{aead: aead, filePath: sealFilePath(s.dataPath, extentID)}
+	return
+}
+
+// IsEncrypted tells if the extents of the store are sealed by a cipher.
+func (s *ExtentStore) IsEncrypted() bool {
+	return s.cipher != nil
+}
+
+// Write the data at the offset of the extent file, sealed if the extent is encrypted.
+func (e *Extent) writeAt(data []byte, offset int64) (err error) {
+	if e.sealer == nil {
+		_, err = e.file.WriteAt(data, offset)
+		return
+	}
+	return e.sealer.writeAt(e.file, data, offset)
+}
+
+// Read the data at the offset of the extent file as os.File.ReadAt does, opened if the extent is encrypted.
+func (e *Extent) readAt(data []byte, offset int64) (n int, err error) {
+	if e.sealer == nil {
+		return e.file.ReadAt(data, offset)
+	}
+	return e.sealer.readAt(e.file, data, offset)
+}
+
+// Punch the holes of [offset, offset+size) on the extent file.
+func (e *Extent) punchHole(offset, size int64) (err error) {
+	if e.sealer == nil {
+		return fallocate(int(e.file.Fd()), FallocFLPunchHole|FallocFLKeepSize, offset, size)
+	}
+	return e.sealer.punch(e.file, offset, size)
+}
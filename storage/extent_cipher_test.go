@@ -0,0 +1,218 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestEncryptedExtentStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_cipher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := NewExtentCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewEncryptedExtentStore(dir, 1, 1<<30, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extentID := uint64(MinExtentID + 1)
+	if err = s.Create(extentID, 0); err != nil {
+		t.Fatal(err)
+	}
+	expected := bytes.Repeat([]byte("plaintext of the extent "), 250)
+	for _, w := range []struct {
+		offset, size int64
+		writeType    int
+	}{{0, 1000, AppendWriteType}, {1000, 5000, AppendWriteType}, {500, 200, RandomWriteType}} {
+		data := expected[w.offset : w.offset+w.size]
+		if w.writeType == RandomWriteType {
+			data = bytes.Repeat([]byte{'x'}, int(w.size))
+			copy(expected[w.offset:], data)
+		}
+		if err = s.Write(extentID, w.offset, w.size, data, crc32.ChecksumIEEE(data), w.writeType, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected = expected[:6000]
+	buf := make([]byte, len(expected))
+	if crc, err := s.Read(extentID, 0, int64(len(buf)), buf, false); err != nil || !bytes.Equal(buf, expected) ||
+		crc != crc32.ChecksumIEEE(expected) {
+		t.Fatalf("read crc(%v) err(%v), expected the crc(%v) of the plaintext", crc, err, crc32.ChecksumIEEE(expected))
+	}
+	raw, err := ioutil.ReadFile(s.extentPath(extentID))
+	if err != nil || len(raw) != len(expected) || bytes.Contains(raw, []byte("plaintext")) {
+		t.Fatalf("extent file of size(%v) err(%v) is not the ciphertext of size(%v)", len(raw), err, len(expected))
+	}
+
+	// the holes punched on the tiny extent read as zeros, the pages punched in part are sealed again
+	tinyID := uint64(TinyExtentStartID)
+	tiny := bytes.Repeat([]byte{'t'}, 5000)
+	if err = s.Write(tinyID, 0, int64(len(tiny)), tiny, crc32.ChecksumIEEE(tiny), AppendWriteType, true); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Write(tinyID, 8192, 100, tiny[:100], crc32.ChecksumIEEE(tiny[:100]), AppendWriteType, true); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.MarkDelete(tinyID, 0, 5000); err != nil {
+		t.Fatal(err)
+	}
+	if offset, _, err := s.TinyExtentAvaliOffset(tinyID, 0); err != nil || offset != 8192 {
+		t.Fatalf("data of the tiny extent found at %v err(%v), expected 8192", offset, err)
+	}
+	buf = make([]byte, 8292)
+	if _, err = s.Read(tinyID, 0, int64(len(buf)), buf, true); err != nil ||
+		!bytes.Equal(buf[:8192], make([]byte, 8192)) || !bytes.Equal(buf[8192:], tiny[:100]) {
+		t.Fatalf("read the punched tiny extent err(%v)", err)
+	}
+	e, err := s.extentWithHeaderByExtentID(extentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.punchHole(100, 5000); err != nil {
+		t.Fatal(err)
+	}
+	copy(expected[100:5100], make([]byte, 5000))
+	buf = make([]byte, len(expected))
+	if _, err = s.Read(extentID, 0, int64(len(buf)), buf, false); err != nil || !bytes.Equal(buf, expected) {
+		t.Fatalf("read the extent punched in part err(%v)", err)
+	}
+	s.Close()
+
+	// the store is only opened by its key
+	other, _ := NewExtentCipher(bytes.Repeat([]byte{2}, 32))
+	if _, err = NewExtentStore(dir, 1, 1<<30); err != ExtentStoreEncryptedError {
+		t.Fatalf("open the encrypted store without the key err(%v)", err)
+	}
+	if _, err = NewEncryptedExtentStore(dir, 1, 1<<30, other); err != ExtentKeyMismatchError {
+		t.Fatalf("open the encrypted store by another key err(%v)", err)
+	}
+	if report, err := VerifyExtentStore(dir); err != nil || !report.Encrypted || len(report.Anomalies) != 0 {
+		t.Fatalf("verify the encrypted store report(%+v) err(%v)", report, err)
+	}
+	if s, err = NewEncryptedExtentStore(dir, 1, 1<<30, c); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err = s.Read(extentID, 0, int64(len(buf)), buf, false); err != nil || !bytes.Equal(buf, expected) {
+		t.Fatalf("read the reopened extent err(%v)", err)
+	}
+
+	// the tampered ciphertext fails to open
+	if raw, err = ioutil.ReadFile(s.extentPath(extentID)); err != nil {
+		t.Fatal(err)
+	}
+	raw[4096] ^= 0xff
+	if err = ioutil.WriteFile(s.extentPath(extentID), raw, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Read(extentID, 4096, 100, buf, false); err == nil {
+		t.Fatal("read the tampered extent")
+	}
+
+	plainDir, err := ioutil.TempDir("", "extent_plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(plainDir)
+	plain, err := NewExtentStore(plainDir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain.Close()
+	if _, err = NewEncryptedExtentStore(plainDir, 1, 1<<30, c); err != ExtentStoreNotEncryptedError {
+		t.Fatalf("encrypt the plain store in place err(%v)", err)
+	}
+}
+
+func TestEncryptedExtentTornWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_cipher_torn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := NewExtentCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewEncryptedExtentStore(dir, 1, 1<<30, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extentID := uint64(MinExtentID + 1)
+	if err = s.Create(extentID, 0); err != nil {
+		t.Fatal(err)
+	}
+	expected := bytes.Repeat([]byte("acknowledged "), 400)[:5096]
+	write := func(offset, size int64) {
+		data := expected[offset : offset+size]
+		if err := s.Write(extentID, offset, size, data, crc32.ChecksumIEEE(data), AppendWriteType, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reopen := func() {
+		s.Close()
+		if s, err = NewEncryptedExtentStore(dir, 1, 1<<30, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(size int) []byte {
+		buf := make([]byte, size)
+		if _, err := s.Read(extentID, 0, int64(size), buf, false); err != nil {
+			t.Fatalf("read %v bytes err(%v)", size, err)
+		}
+		return buf
+	}
+	extentPath, sealPath := s.extentPath(extentID), sealFilePath(dir, extentID)
+	write(0, 1000)
+	oldCiphertext, err := ioutil.ReadFile(extentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the page written in part is sealed again, and the crash leaves the record but not the ciphertext
+	write(1000, 1000)
+	if err = ioutil.WriteFile(extentPath, oldCiphertext, 0666); err != nil {
+		t.Fatal(err)
+	}
+	reopen()
+	if !bytes.Equal(read(1000), expected[:1000]) {
+		t.Fatal("acknowledged data lost by the page sealed again")
+	}
+
+	// a new page is recorded after the ciphertext, and the crash leaves the ciphertext but not the record
+	write(1000, 4096)
+	records, err := ioutil.ReadFile(sealPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(sealPath, records[:sealPageRecordSize], 0666); err != nil {
+		t.Fatal(err)
+	}
+	reopen()
+	defer s.Close()
+	buf := read(5096)
+	if !bytes.Equal(buf[:4096], expected[:4096]) || !bytes.Equal(buf[4096:], make([]byte, 1000)) {
+		t.Fatal("page without the record not read as a hole")
+	}
+}
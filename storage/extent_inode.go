@@ -0,0 +1,118 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// The inode a normal extent is created for is appended to the inode file as a record of the extent id and the
+// inode, both big endian. The records of the deleted extents are dropped when the store is opened, once they
+// outnumber the ones of the extents left.
+const (
+	ExtInodeFileName      = "EXTENT_INODE"
+	TempExtInodeFileName  = ".EXTENT_INODE"
+	ExtentInodeRecordSize = 16
+	ExtInodeFileOpt       = os.O_CREATE | os.O_RDWR | os.O_APPEND
+)
+
+// Append the inode record of the extent. The extents created without the inode, such as the tiny extents
+// shared by many files, have no record.
+func (s *ExtentStore) recordExtentInode(extentID, inode uint64) (err error) {
+	if inode == 0 {
+		return
+	}
+	record := make([]byte, ExtentInodeRecordSize)
+	binary.BigEndian.PutUint64(record[0:8], extentID)
+	binary.BigEndian.PutUint64(record[8:16], inode)
+	_, err = s.inodeFp.Write(record)
+	return
+}
+
+// Read the inode records, the last record of an extent winning. A partial record left by a crash is ignored.
+func readExtentInodes(name string) (inodes map[uint64]uint64, records int, err error) {
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return make(map[uint64]uint64), 0, nil
+	}
+	if err != nil {
+		return
+	}
+	records = len(data) / ExtentInodeRecordSize
+	inodes = make(map[uint64]uint64, records)
+	for off := 0; off+ExtentInodeRecordSize <= len(data); off += ExtentInodeRecordSize {
+		extentID := binary.BigEndian.Uint64(data[off : off+8])
+		inodes[extentID] = binary.BigEndian.Uint64(data[off+8 : off+16])
+	}
+	return
+}
+
+// Load the inodes of the extents loaded by initBaseFileID, and open the inode file to append to.
+func (s *ExtentStore) initExtentInodes() (err error) {
+	name := path.Join(s.dataPath, ExtInodeFileName)
+	inodes, records, err := readExtentInodes(name)
+	if err != nil {
+		return fmt.Errorf("read %v: %v", ExtInodeFileName, err)
+	}
+	live := make(map[uint64]uint64)
+	s.eiMutex.Lock()
+	for extentID, inode := range inodes {
+		if ei, ok := s.extentInfoMap[extentID]; ok {
+			ei.Inode = inode
+			live[extentID] = inode
+		}
+	}
+	s.eiMutex.Unlock()
+	if records > 2*len(live) {
+		if err = rewriteExtentInodes(s.dataPath, live); err != nil {
+			return fmt.Errorf("rewrite %v: %v", ExtInodeFileName, err)
+		}
+	}
+	s.inodeFp, err = os.OpenFile(name, ExtInodeFileOpt, 0666)
+	return
+}
+
+// Replace the inode file with the records of the given extents only.
+func rewriteExtentInodes(dataDir string, inodes map[uint64]uint64) (err error) {
+	data := make([]byte, 0, len(inodes)*ExtentInodeRecordSize)
+	record := make([]byte, ExtentInodeRecordSize)
+	for extentID, inode := range inodes {
+		binary.BigEndian.PutUint64(record[0:8], extentID)
+		binary.BigEndian.PutUint64(record[8:16], inode)
+		data = append(data, record...)
+	}
+	tempFile := path.Join(dataDir, TempExtInodeFileName)
+	var fp *os.File
+	if fp, err = os.OpenFile(tempFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666); err != nil {
+		return
+	}
+	if _, err = fp.Write(data); err != nil {
+		fp.Close()
+		return
+	}
+	if err = fp.Sync(); err != nil {
+		fp.Close()
+		return
+	}
+	fp.Close()
+	if err = os.Rename(tempFile, path.Join(dataDir, ExtInodeFileName)); err != nil {
+		return
+	}
+	return syncDir(dataDir)
+}
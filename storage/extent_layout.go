@@ -0,0 +1,342 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/chubaofs/chubaofs/util"
+	"github.com/chubaofs/chubaofs/util/log"
+)
+
+// The normal extents of a store are either all in its directory, which is the flat layout every store had
+// before, or spread over the shard subdirectories by the extent id modulo the shard count, so a store of a
+// great many extents does not slow down the lookups and the listings of one huge directory. The tiny extents
+// and the metadata files always stay in the store directory. The layout is recorded in the layout file, and a
+// store without it is flat.
+const (
+	ExtentLayoutFileName     = "EXTENT_LAYOUT"
+	TempExtentLayoutFileName = ".EXTENT_LAYOUT"
+	ExtentShardDirPrefix     = "shard_"
+	MaxExtentShards          = 4096
+
+	// The suffix of a copy of an extent found out of its directory, which differs from the copy the layout
+	// expects. It is kept aside for the operator instead of being removed, and the store ignores it.
+	MisplacedExtentSuffix = ".misplaced"
+)
+
+// ExtentLayout is the content of the layout file.
+type ExtentLayout struct {
+	Shards int `json:"shards"` // 0 if flat
+}
+
+// ReadExtentLayout returns the shard count of the normal extents under the directory, 0 if flat.
+func ReadExtentLayout(dataDir string) (shards int, err error) {
+	data, err := ioutil.ReadFile(path.Join(dataDir, ExtentLayoutFileName))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return
+	}
+	layout := &ExtentLayout{}
+	if err = json.Unmarshal(data, layout); err != nil {
+		return 0, fmt.Errorf("parse %v: %v", ExtentLayoutFileName, err)
+	}
+	if err = checkExtentShards(layout.Shards); err != nil {
+		return 0, fmt.Errorf("parse %v: %v", ExtentLayoutFileName, err)
+	}
+	return layout.Shards, nil
+}
+
+func checkExtentShards(shards int) error {
+	if shards < 0 || shards > MaxExtentShards {
+		return fmt.Errorf("extent shards(%v) out of range [0, %v]", shards, MaxExtentShards)
+	}
+	return nil
+}
+
+// ExtentFilePath returns the path of the extent file under the directory laid out by the shard count.
+func ExtentFilePath(dataDir string, shards int, extentID uint64) string {
+	return path.Join(extentDir(dataDir, shards, extentID), strconv.FormatUint(extentID, 10))
+}
+
+func extentDir(dataDir string, shards int, extentID uint64) string {
+	if shards <= 0 || IsTinyExtent(extentID) {
+		return dataDir
+	}
+	return extentShardDir(dataDir, int(extentID%uint64(shards)))
+}
+
+func extentShardDir(dataDir string, shard int) string {
+	return path.Join(dataDir, ExtentShardDirPrefix+strconv.Itoa(shard))
+}
+
+// IsExtentShardDir tells if the name is the one of a shard directory.
+func IsExtentShardDir(name string) bool {
+	_, ok := parseExtentShardDir(name)
+	return ok
+}
+
+// Parse the shard of the subdirectory name, false if it is not a shard directory.
+func parseExtentShardDir(name string) (shard int, ok bool) {
+	if !strings.HasPrefix(name, ExtentShardDirPrefix) {
+		return
+	}
+	shard, err := strconv.Atoi(strings.TrimPrefix(name, ExtentShardDirPrefix))
+	return shard, err == nil && shard >= 0
+}
+
+// WalkExtentDir calls fn with every regular file in the directory of the store and in its shard directories
+// whatever the layout is, which covers the extents not moved yet by an interrupted migration as well.
+func WalkExtentDir(dataDir string, fn func(dir string, info os.FileInfo)) (err error) {
+	var fileInfos []os.FileInfo
+	if fileInfos, err = ioutil.ReadDir(dataDir); err != nil {
+		return
+	}
+	for _, info := range fileInfos {
+		if info.Mode().IsRegular() {
+			fn(dataDir, info)
+			continue
+		}
+		if _, ok := parseExtentShardDir(info.Name()); !ok || !info.IsDir() {
+			continue
+		}
+		shardDir := path.Join(dataDir, info.Name())
+		var shardInfos []os.FileInfo
+		if shardInfos, err = ioutil.ReadDir(shardDir); err != nil {
+			return
+		}
+		for _, shardInfo := range shardInfos {
+			if shardInfo.Mode().IsRegular() {
+				fn(shardDir, shardInfo)
+			}
+		}
+	}
+	return
+}
+
+// MigrateExtentLayout lays the normal extents under the directory out by the shard count, 0 for flat, and
+// returns the number of extents moved. It must not be called on a directory opened by an extent store.
+// The layout file is switched first and the extents are moved after, so an interrupted migration is
+// completed by the next open of the store, which moves whatever extent is not where the layout expects.
+func MigrateExtentLayout(dataDir string, shards int) (moved int, err error) {
+	if err = checkExtentShards(shards); err != nil {
+		return
+	}
+	if err = MkdirAll(dataDir); err != nil {
+		return
+	}
+	var current int
+	if current, err = ReadExtentLayout(dataDir); err != nil {
+		return
+	}
+	if current == shards {
+		return
+	}
+	if err = writeExtentLayout(dataDir, shards); err != nil {
+		return
+	}
+	if moved, err = relocateExtents(dataDir, shards); err != nil {
+		return
+	}
+	log.LogInfof("action[MigrateExtentLayout] dir(%v) extent shards from %v to %v, moved %v extents.",
+		dataDir, current, shards, moved)
+	return
+}
+
+func writeExtentLayout(dataDir string, shards int) (err error) {
+	data, err := json.Marshal(&ExtentLayout{Shards: shards})
+	if err != nil {
+		return
+	}
+	tempFile := path.Join(dataDir, TempExtentLayoutFileName)
+	var fp *os.File
+	if fp, err = os.OpenFile(tempFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666); err != nil {
+		return
+	}
+	if _, err = fp.Write(data); err != nil {
+		fp.Close()
+		return
+	}
+	if err = fp.Sync(); err != nil {
+		fp.Close()
+		return
+	}
+	fp.Close()
+	if err = os.Rename(tempFile, path.Join(dataDir, ExtentLayoutFileName)); err != nil {
+		return
+	}
+	return syncDir(dataDir)
+}
+
+// misplacedExtent is a normal extent file out of the directory the layout expects.
+type misplacedExtent struct {
+	dir      string
+	extentID uint64
+}
+
+// Tell if the file in the directory is a normal extent out of the directory the layout expects.
+func isMisplacedExtent(dataDir string, shards int, dir string, info os.FileInfo) (extentID uint64, misplaced bool) {
+	if !RegexpExtentFile.MatchString(info.Name()) {
+		return
+	}
+	extentID, err := strconv.ParseUint(info.Name(), 10, 64)
+	if err != nil || IsTinyExtent(extentID) {
+		return
+	}
+	return extentID, dir != extentDir(dataDir, shards, extentID)
+}
+
+// Move every normal extent to the directory the shard count expects, and remove the shard directories left
+// empty out of the layout.
+func relocateExtents(dataDir string, shards int) (moved int, err error) {
+	var misplaced []misplacedExtent
+	err = WalkExtentDir(dataDir, func(dir string, info os.FileInfo) {
+		if extentID, ok := isMisplacedExtent(dataDir, shards, dir, info); ok {
+			misplaced = append(misplaced, misplacedExtent{dir: dir, extentID: extentID})
+		}
+	})
+	if err != nil {
+		return
+	}
+	if moved, err = moveExtents(dataDir, shards, misplaced); err != nil {
+		return
+	}
+	removeStaleShardDirs(dataDir, shards)
+	return
+}
+
+// Move the misplaced extents into the directories the shard count expects. An extent found at both places
+// keeps the one the layout expects: the misplaced copy is removed if it is the same, and renamed aside with
+// the misplaced suffix otherwise.
+func moveExtents(dataDir string, shards int, misplaced []misplacedExtent) (moved int, err error) {
+	for shard := 0; shard < shards; shard++ {
+		if err = MkdirAll(extentShardDir(dataDir, shard)); err != nil {
+			return
+		}
+	}
+	changedDirs := make(map[string]bool)
+	for _, m := range misplaced {
+		name := strconv.FormatUint(m.extentID, 10)
+		source := path.Join(m.dir, name)
+		targetDir := extentDir(dataDir, shards, m.extentID)
+		target := path.Join(targetDir, name)
+		if _, statErr := os.Stat(target); statErr == nil {
+			if err = resolveDuplicateExtent(m.extentID, source, target); err != nil {
+				break
+			}
+			changedDirs[m.dir] = true
+			continue
+		}
+		if err = os.Rename(source, target); err != nil {
+			break
+		}
+		changedDirs[m.dir], changedDirs[targetDir] = true, true
+		moved++
+	}
+	for dir := range changedDirs {
+		if syncErr := syncDir(dir); syncErr != nil && err == nil {
+			err = syncErr
+		}
+	}
+	return
+}
+
+// Remove the misplaced copy of an extent the same as the one at the target, or rename it aside if not.
+func resolveDuplicateExtent(extentID uint64, source, target string) (err error) {
+	var same bool
+	if same, err = sameFileContent(source, target); err != nil {
+		return
+	}
+	if same {
+		log.LogWarnf("action[moveExtents] extent(%v) exists in both %v and %v with the same data, remove the former.",
+			extentID, source, target)
+		return os.Remove(source)
+	}
+	log.LogWarnf("action[moveExtents] extent(%v) exists in both %v and %v with different data, keep the latter "+
+		"and rename the former to %v.", extentID, source, target, source+MisplacedExtentSuffix)
+	return os.Rename(source, source+MisplacedExtentSuffix)
+}
+
+// Tell if the two files have the same data.
+func sameFileContent(name1, name2 string) (same bool, err error) {
+	var fp1, fp2 *os.File
+	if fp1, err = os.Open(name1); err != nil {
+		return
+	}
+	defer fp1.Close()
+	if fp2, err = os.Open(name2); err != nil {
+		return
+	}
+	defer fp2.Close()
+	var info1, info2 os.FileInfo
+	if info1, err = fp1.Stat(); err != nil {
+		return
+	}
+	if info2, err = fp2.Stat(); err != nil {
+		return
+	}
+	if info1.Size() != info2.Size() {
+		return false, nil
+	}
+	buf1, buf2 := make([]byte, util.BlockSize), make([]byte, util.BlockSize)
+	for {
+		n1, err1 := io.ReadFull(fp1, buf1)
+		n2, err2 := io.ReadFull(fp2, buf2)
+		if n1 != n2 || !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+		if err1 == io.EOF || err1 == io.ErrUnexpectedEOF {
+			return err2 == io.EOF || err2 == io.ErrUnexpectedEOF, nil
+		}
+		if err1 != nil {
+			return false, err1
+		}
+		if err2 != nil {
+			return false, err2
+		}
+	}
+}
+
+// Remove the shard directories out of the layout, which fails harmlessly on the ones still holding files.
+func removeStaleShardDirs(dataDir string, shards int) {
+	fileInfos, err := ioutil.ReadDir(dataDir)
+	if err != nil {
+		return
+	}
+	for _, info := range fileInfos {
+		if shard, ok := parseExtentShardDir(info.Name()); ok && info.IsDir() && shard >= shards {
+			os.Remove(path.Join(dataDir, info.Name()))
+		}
+	}
+}
+
+func syncDir(dir string) (err error) {
+	var fp *os.File
+	if fp, err = os.Open(dir); err != nil {
+		return
+	}
+	defer fp.Close()
+	return fp.Sync()
+}
@@ -116,12 +116,22 @@ type ExtentStore struct {
 	normalExtentDeleteFp              *os.File
 	closeC                            chan bool
 	closed                            bool
-	availableTinyExtentC              chan uint64 // available tinyExtent channel
-	brokenTinyExtentC                 chan uint64 // broken tinyExtent channel
+	availableTinyExtentC              chan uint64     // available tinyExtent channel
+	brokenTinyExtentC                 chan uint64     // broken tinyExtent channel
+	brokenTinyExtents                 map[uint64]bool // the extents in brokenTinyExtentC, to be peeked
+	brokenTinyExtentsLock             sync.Mutex
 	blockSize                         int
 	partitionID                       uint64
 	verifyExtentFp                    *os.File
+	inodeFp                           *os.File // inode records of the normal extents
 	hasAllocSpaceExtentIDOnVerfiyFile uint64
+	usedSize                          int64 // running total of the extent sizes, maintained on write and delete
+	usageDirty                        int32 // the running total is not trustworthy until it is reset by a full walk
+	shards                            int   // shard directories of the normal extents, 0 if flat
+
+	changes        extentChanges // the extents changed by the change sequence
+	pendingDeletes int64         // delete records written since the delete record files are synced
+	cipher         *ExtentCipher // seals the extents, nil if the store is kept in plaintext
 }
 
 func MkdirAll(name string) (err error) {
@@ -129,12 +139,28 @@ func MkdirAll(name string) (err error) {
 }
 
 func NewExtentStore(dataDir string, partitionID uint64, storeSize int) (s *ExtentStore, err error) {
+	return NewEncryptedExtentStore(dataDir, partitionID, storeSize, nil)
+}
+
+// NewEncryptedExtentStore creates the extent store whose extents are sealed by the cipher, or the plain one if
+// the cipher is nil. It fails with ExtentStoreEncryptedError or ExtentKeyMismatchError if the store is encrypted
+// and the cipher is missing or of another key, and with ExtentStoreNotEncryptedError if a plain store is given
+// a cipher.
+func NewEncryptedExtentStore(dataDir string, partitionID uint64, storeSize int, c *ExtentCipher) (s *ExtentStore, err error) {
 	s = new(ExtentStore)
 	s.dataPath = dataDir
 	s.partitionID = partitionID
+	s.cipher = c
 	if err = MkdirAll(dataDir); err != nil {
 		return nil, fmt.Errorf("NewExtentStore [%v] err[%v]", dataDir, err)
 	}
+	if s.shards, err = ReadExtentLayout(dataDir); err != nil {
+		return nil, fmt.Errorf("NewExtentStore [%v] err[%v]", dataDir, err)
+	}
+	// the errors of the cipher are returned as they are, so the caller tells them from the ones of the files
+	if err = checkExtentCipher(dataDir, c); err != nil {
+		return nil, err
+	}
 	if s.tinyExtentDeleteFp, err = os.OpenFile(path.Join(s.dataPath, TinyExtDeletedFileName), TinyDeleteFileOpt, 0666); err != nil {
 		return
 	}
@@ -163,8 +189,12 @@ func NewExtentStore(dataDir string, partitionID uint64, storeSize int) (s *Exten
 		err = fmt.Errorf("init base field ID: %v", err)
 		return
 	}
+	if err = s.initExtentInodes(); err != nil {
+		return
+	}
 	s.hasAllocSpaceExtentIDOnVerfiyFile = s.GetPreAllocSpaceExtentIDOnVerfiyFile()
 	s.storeSize = storeSize
+	s.usageDirty = 1
 	s.closeC = make(chan bool, 1)
 	s.closed = false
 	err = s.initTinyExtent()
@@ -184,62 +214,95 @@ func (ei *ExtentInfo) UpdateExtentInfo(extent *Extent, crc uint32) {
 	if !IsTinyExtent(ei.FileID) {
 		atomic.StoreUint32(&ei.Crc, crc)
 		ei.ModifyTime = extent.ModifyTime()
+		if ei.CreateTime == 0 {
+			ei.CreateTime = extent.CreateTime()
+		}
 	}
 }
 
 // SnapShot returns the information of all the extents on the current data partition.
 // When the master sends the loadDataPartition request, the snapshot is used to compare the replicas.
 func (s *ExtentStore) SnapShot() (files []*proto.File, err error) {
-	var (
-		normalExtentSnapshot, tinyExtentSnapshot []*ExtentInfo
-	)
+	files = make([]*proto.File, 0, s.GetExtentCount())
+	s.RangeSnapShot(func(f *proto.File) bool {
+		file := GetSnapShotFileFromPool()
+		*file = *f
+		files = append(files, file)
+		return true
+	})
+	return
+}
 
-	if normalExtentSnapshot, _, err = s.GetAllWatermarks(NormalExtentFilter()); err != nil {
-		return
+// RangeSnapShot calls fn with the snapshot of every extent in the same order as SnapShot until fn returns false.
+// The file passed to fn is reused between the calls, so fn has to copy it if it is kept after fn returns.
+func (s *ExtentStore) RangeSnapShot(fn func(file *proto.File) bool) {
+	var tinyExtentInfos [TinyExtentCount]*ExtentInfo
+	s.eiMutex.RLock()
+	extentInfoSlice := make([]*ExtentInfo, 0, len(s.extentInfoMap))
+	for _, extentInfo := range s.extentInfoMap {
+		extentInfoSlice = append(extentInfoSlice, extentInfo)
+	}
+	for i := range tinyExtentInfos {
+		tinyExtentInfos[i] = s.extentInfoMap[uint64(i)+TinyExtentStartID]
 	}
+	s.eiMutex.RUnlock()
 
-	files = make([]*proto.File, 0, len(normalExtentSnapshot))
-	for _, ei := range normalExtentSnapshot {
-		file := GetSnapShotFileFromPool()
+	file := new(proto.File)
+	filter := NormalExtentFilter()
+	for _, ei := range extentInfoSlice {
+		if !filter(ei) {
+			continue
+		}
 		file.Name = strconv.FormatUint(ei.FileID, 10)
 		file.Size = uint32(ei.Size)
 		file.Modified = ei.ModifyTime
 		file.Crc = atomic.LoadUint32(&ei.Crc)
-		files = append(files, file)
+		if !fn(file) {
+			return
+		}
 	}
-	tinyExtentSnapshot = s.getTinyExtentInfo()
-	for _, ei := range tinyExtentSnapshot {
-		file := GetSnapShotFileFromPool()
+	for _, ei := range tinyExtentInfos {
+		if ei == nil {
+			continue
+		}
 		file.Name = strconv.FormatUint(ei.FileID, 10)
 		file.Size = uint32(ei.Size)
 		file.Modified = ei.ModifyTime
 		file.Crc = 0
-		files = append(files, file)
+		if !fn(file) {
+			return
+		}
 	}
-
-	return
 }
 
-// Create creates an extent.
-func (s *ExtentStore) Create(extentID uint64) (err error) {
+// Create creates an extent for the inode, 0 if the extent is not created for a single inode.
+func (s *ExtentStore) Create(extentID, inode uint64) (err error) {
 	var e *Extent
-	name := path.Join(s.dataPath, strconv.Itoa(int(extentID)))
 	if s.HasExtent(extentID) {
 		err = ExtentExistsError
 		return err
 	}
-	e = NewExtentInCore(name, extentID)
+	if e, err = s.newExtent(extentID); err != nil {
+		return err
+	}
 	e.header = make([]byte, util.BlockHeaderSize)
 	err = e.InitToFS()
 	if err != nil {
 		return err
 	}
+	// record the inode only once the extent is on the disk, so a failed creation leaves no record behind
+	if err = s.recordExtentInode(extentID, inode); err != nil {
+		e.Close()
+		os.Remove(e.filePath)
+		return err
+	}
 	s.cache.Put(e)
-	extInfo := &ExtentInfo{FileID: extentID}
+	extInfo := &ExtentInfo{FileID: extentID, Inode: inode}
 	extInfo.UpdateExtentInfo(e, 0)
 	s.eiMutex.Lock()
 	s.extentInfoMap[extentID] = extInfo
 	s.eiMutex.Unlock()
+	s.changes.record(extentID)
 
 	s.UpdateBaseExtentID(extentID)
 	return
@@ -250,22 +313,45 @@ func (s *ExtentStore) initBaseFileID() (err error) {
 		baseFileID uint64
 	)
 	baseFileID, _ = s.GetPersistenceBaseExtentID()
-	files, err := ioutil.ReadDir(s.dataPath)
+	var (
+		extentIDs []uint64
+		misplaced []misplacedExtent
+	)
+	err = WalkExtentDir(s.dataPath, func(dir string, info os.FileInfo) {
+		extentID, isExtent := s.ExtentID(info.Name())
+		if !isExtent {
+			return
+		}
+		if _, ok := isMisplacedExtent(s.dataPath, s.shards, dir, info); ok {
+			misplaced = append(misplaced, misplacedExtent{dir: dir, extentID: extentID})
+			return
+		}
+		// the tiny extents are only in the store directory
+		if dir == extentDir(s.dataPath, s.shards, extentID) {
+			extentIDs = append(extentIDs, extentID)
+		}
+	})
 	if err != nil {
 		return err
 	}
+	// the extents left out of the layout by an interrupted migration
+	moved, err := moveExtents(s.dataPath, s.shards, misplaced)
+	if err != nil {
+		return fmt.Errorf("move the extents out of the layout: %v", err)
+	}
+	if moved > 0 {
+		log.LogWarnf("datadir(%v) moved %v extents into the layout of %v shards.", s.dataPath, moved, s.shards)
+	}
+	for _, m := range misplaced {
+		extentIDs = append(extentIDs, m.extentID)
+	}
 
 	var (
-		extentID uint64
-		isExtent bool
-		e        *Extent
-		ei       *ExtentInfo
-		loadErr  error
+		e       *Extent
+		ei      *ExtentInfo
+		loadErr error
 	)
-	for _, f := range files {
-		if extentID, isExtent = s.ExtentID(f.Name()); !isExtent {
-			continue
-		}
+	for _, extentID := range extentIDs {
 		if e, loadErr = s.extent(extentID); loadErr != nil {
 			continue
 		}
@@ -305,11 +391,14 @@ func (s *ExtentStore) Write(extentID uint64, offset, size int64, data []byte, cr
 	if err = s.checkOffsetAndSize(extentID, offset, size); err != nil {
 		return err
 	}
+	oldSize := ei.Size
 	err = e.Write(data, offset, size, crc, writeType, isSync, s.PersistenceBlockCrc, ei)
 	if err != nil {
 		return err
 	}
 	ei.UpdateExtentInfo(e, 0)
+	s.addUsedSize(int64(ei.Size) - int64(oldSize))
+	s.changes.record(extentID)
 
 	return nil
 }
@@ -366,6 +455,7 @@ func (s *ExtentStore) tinyDelete(e *Extent, offset, size int64) (err error) {
 	if hasDelete {
 		return
 	}
+	s.addUsedSize(-size)
 	if err = s.RecordTinyDelete(e.extentID, offset, size); err != nil {
 		return
 	}
@@ -391,19 +481,45 @@ func (s *ExtentStore) MarkDelete(extentID uint64, offset, size int64) (err error
 	}
 	e.Close()
 	s.cache.Del(extentID)
-	extentFilePath := path.Join(s.dataPath, strconv.FormatUint(extentID, 10))
+	extentFilePath := s.extentPath(extentID)
 	if err = os.Remove(extentFilePath); err != nil {
 		return
 	}
+	if s.cipher != nil {
+		if removeErr := os.Remove(sealFilePath(s.dataPath, extentID)); removeErr != nil {
+			log.LogWarnf("datadir(%v) remove seal file of extent(%v) err(%v).", s.dataPath, extentID, removeErr)
+		}
+	}
 	s.PersistenceHasDeleteExtent(extentID)
+	s.addUsedSize(-int64(ei.Size))
 	ei.IsDeleted = true
 	ei.ModifyTime = time.Now().Unix()
+	s.changes.record(extentID)
 	s.cache.Del(e.extentID)
 	s.DeleteBlockCrc(extentID)
 
 	return
 }
 
+// FlushDelete syncs the delete records of the extents to the disk, so that the extents deleted are not
+// found again after a crash or a restart.
+func (s *ExtentStore) FlushDelete() (err error) {
+	pending := atomic.LoadInt64(&s.pendingDeletes)
+	if err = s.tinyExtentDeleteFp.Sync(); err != nil {
+		return
+	}
+	if err = s.normalExtentDeleteFp.Sync(); err != nil {
+		return
+	}
+	atomic.AddInt64(&s.pendingDeletes, -pending)
+	return
+}
+
+// PendingDeletes returns the number of the delete records not synced to the disk yet.
+func (s *ExtentStore) PendingDeletes() int64 {
+	return atomic.LoadInt64(&s.pendingDeletes)
+}
+
 // Close closes the extent store.
 func (s *ExtentStore) Close() {
 	s.mutex.Lock()
@@ -421,6 +537,8 @@ func (s *ExtentStore) Close() {
 	s.normalExtentDeleteFp.Close()
 	s.verifyExtentFp.Sync()
 	s.verifyExtentFp.Close()
+	s.inodeFp.Sync()
+	s.inodeFp.Close()
 	s.closed = true
 }
 
@@ -477,22 +595,6 @@ func (s *ExtentStore) GetAllWatermarks(filter ExtentFilter) (extents []*ExtentIn
 	return
 }
 
-func (s *ExtentStore) getTinyExtentInfo() (extents []*ExtentInfo) {
-	extents = make([]*ExtentInfo, 0)
-	s.eiMutex.RLock()
-	var extentID uint64
-	for extentID = TinyExtentStartID; extentID < TinyExtentCount+TinyExtentStartID; extentID++ {
-		ei := s.extentInfoMap[extentID]
-		if ei == nil {
-			continue
-		}
-		extents = append(extents, ei)
-	}
-	s.eiMutex.RUnlock()
-
-	return
-}
-
 // ExtentID return the extent ID.
 func (s *ExtentStore) ExtentID(filename string) (extentID uint64, isExtent bool) {
 	if isExtent = RegexpExtentFile.MatchString(filename); !isExtent {
@@ -512,13 +614,14 @@ func (s *ExtentStore) ExtentID(filename string) (extentID uint64, isExtent bool)
 func (s *ExtentStore) initTinyExtent() (err error) {
 	s.availableTinyExtentC = make(chan uint64, TinyExtentCount)
 	s.brokenTinyExtentC = make(chan uint64, TinyExtentCount)
+	s.brokenTinyExtents = make(map[uint64]bool, TinyExtentCount)
 	var extentID uint64
 
 	for extentID = TinyExtentStartID; extentID < TinyExtentStartID+TinyExtentCount; extentID++ {
-		err = s.Create(extentID)
+		err = s.Create(extentID, 0)
 		if err == nil || strings.Contains(err.Error(), syscall.EEXIST.Error()) || err == ExtentExistsError {
 			err = nil
-			s.brokenTinyExtentC <- extentID
+			s.SendToBrokenTinyExtentC(extentID)
 			continue
 		}
 		return err
@@ -546,7 +649,7 @@ func (s *ExtentStore) SendToAvailableTinyExtentC(extentID uint64) {
 // SendAllToBrokenTinyExtentC sends all the extents to the channel that stores the broken extents.
 func (s *ExtentStore) SendAllToBrokenTinyExtentC(extentIds []uint64) {
 	for _, extentID := range extentIds {
-		s.brokenTinyExtentC <- extentID
+		s.SendToBrokenTinyExtentC(extentID)
 	}
 }
 
@@ -573,13 +676,132 @@ func (s *ExtentStore) MoveAllToBrokenTinyExtentC(cnt int) {
 
 // SendToBrokenTinyExtentC sends the given extent id to the channel.
 func (s *ExtentStore) SendToBrokenTinyExtentC(extentID uint64) {
+	s.markBrokenTinyExtent(extentID, true)
 	s.brokenTinyExtentC <- extentID
 }
 
+// PeekBrokenTinyExtents returns at most limit extents in the channel of the broken tiny extents, without taking
+// them out of the channel.
+func (s *ExtentStore) PeekBrokenTinyExtents(limit int) (extentIDs []uint64) {
+	s.brokenTinyExtentsLock.Lock()
+	defer s.brokenTinyExtentsLock.Unlock()
+	extentIDs = make([]uint64, 0, len(s.brokenTinyExtents))
+	for extentID := range s.brokenTinyExtents {
+		extentIDs = append(extentIDs, extentID)
+	}
+	sort.Slice(extentIDs, func(i, j int) bool { return extentIDs[i] < extentIDs[j] })
+	if len(extentIDs) > limit {
+		extentIDs = extentIDs[:limit]
+	}
+	return
+}
+
+func (s *ExtentStore) markBrokenTinyExtent(extentID uint64, broken bool) {
+	s.brokenTinyExtentsLock.Lock()
+	if broken {
+		s.brokenTinyExtents[extentID] = true
+	} else {
+		delete(s.brokenTinyExtents, extentID)
+	}
+	s.brokenTinyExtentsLock.Unlock()
+}
+
+// TakeTinyExtents takes the given extents out of the channels of the available and the broken tiny extents.
+// The extents which are in neither channel, e.g. being written, are not taken.
+func (s *ExtentStore) TakeTinyExtents(extentIDs []uint64) (taken []uint64) {
+	wanted := make(map[uint64]bool, len(extentIDs))
+	for _, extentID := range extentIDs {
+		wanted[extentID] = true
+	}
+	taken = takeTinyExtentsFromChannel(s.availableTinyExtentC, wanted)
+	brokenTaken := takeTinyExtentsFromChannel(s.brokenTinyExtentC, wanted)
+	for _, extentID := range brokenTaken {
+		s.markBrokenTinyExtent(extentID, false)
+	}
+	taken = append(taken, brokenTaken...)
+	return
+}
+
+// TakeAvailableTinyExtents takes the given extents out of the channel of the available tiny extents only,
+// the caller is supposed to send them back with SendToAvailableTinyExtentC.
+func (s *ExtentStore) TakeAvailableTinyExtents(extentIDs []uint64) (taken []uint64) {
+	wanted := make(map[uint64]bool, len(extentIDs))
+	for _, extentID := range extentIDs {
+		wanted[extentID] = true
+	}
+	return takeTinyExtentsFromChannel(s.availableTinyExtentC, wanted)
+}
+
+func takeTinyExtentsFromChannel(c chan uint64, wanted map[uint64]bool) (taken []uint64) {
+	for i := len(c); i > 0; i-- {
+		var extentID uint64
+		select {
+		case extentID = <-c:
+		default:
+			return
+		}
+		if wanted[extentID] {
+			delete(wanted, extentID)
+			taken = append(taken, extentID)
+			continue
+		}
+		c <- extentID
+	}
+	return
+}
+
+// PunchTinyZeroPages punches the holes on the pages of the tiny extent in [offset, offset+size) which are
+// allocated but hold only zeros, which read the same from a hole. The range beyond the watermark is ignored.
+func (s *ExtentStore) PunchTinyZeroPages(extentID uint64, offset, size int64) (err error) {
+	var e *Extent
+	if !IsTinyExtent(extentID) {
+		return ParameterMismatchError
+	}
+	if e, err = s.extentWithHeaderByExtentID(extentID); err != nil {
+		return
+	}
+	if offset+size > e.dataSize {
+		size = e.dataSize - offset
+	}
+	if size <= 0 {
+		return
+	}
+	return e.punchZeroPages(offset, size)
+}
+
+// ReplayTinyDeletes punches the holes of the tiny extent again for all its delete records,
+// to reclaim the space whose data was written back after the deletion, e.g. by a repair.
+func (s *ExtentStore) ReplayTinyDeletes(extentID uint64) (err error) {
+	var (
+		e    *Extent
+		data []byte
+	)
+	if !IsTinyExtent(extentID) {
+		return ParameterMismatchError
+	}
+	if e, err = s.extentWithHeaderByExtentID(extentID); err != nil {
+		return
+	}
+	if data, err = ioutil.ReadFile(path.Join(s.dataPath, TinyExtDeletedFileName)); err != nil {
+		return
+	}
+	for offset := 0; offset+DeleteTinyRecordSize <= len(data); offset += DeleteTinyRecordSize {
+		recordExtentID, deleteOffset, deleteSize := UnMarshalTinyExtent(data[offset : offset+DeleteTinyRecordSize])
+		if recordExtentID != extentID || int64(deleteOffset+deleteSize) > e.dataSize {
+			continue
+		}
+		if _, err = e.DeleteTiny(int64(deleteOffset), int64(deleteSize)); err != nil {
+			return
+		}
+	}
+	return
+}
+
 // GetBrokenTinyExtent returns the first broken extent in the channel.
 func (s *ExtentStore) GetBrokenTinyExtent() (extentID uint64, err error) {
 	select {
 	case extentID = <-s.brokenTinyExtentC:
+		s.markBrokenTinyExtent(extentID, false)
 		return
 	default:
 		return 0, NoBrokenExtentError
@@ -655,7 +877,7 @@ func (s *ExtentStore) RecordTinyDelete(extentID uint64, offset, size int64) (err
 	if err != nil {
 		return
 	}
-
+	atomic.AddInt64(&s.pendingDeletes, 1)
 	return
 }
 
@@ -737,6 +959,18 @@ func (s *ExtentStore) extentWithHeaderByExtentID(extentID uint64) (e *Extent, er
 	return
 }
 
+// SyncExtent synchronizes the data written to the extent to the disk. A deleted extent has nothing to sync.
+func (s *ExtentStore) SyncExtent(extentID uint64) (err error) {
+	if !s.HasExtent(extentID) {
+		return
+	}
+	var e *Extent
+	if e, err = s.extentWithHeaderByExtentID(extentID); err != nil {
+		return
+	}
+	return e.Flush()
+}
+
 // HasExtent tells if the extent store has the extent with the given ID
 func (s *ExtentStore) HasExtent(extentID uint64) (exist bool) {
 	s.eiMutex.RLock()
@@ -745,6 +979,29 @@ func (s *ExtentStore) HasExtent(extentID uint64) (exist bool) {
 	return
 }
 
+// ExportSnapshot returns the infos of all the extents not deleted, whatever their sizes and modification times,
+// and the base extent id, taken at once under the lock of the extent infos.
+func (s *ExtentStore) ExportSnapshot() (extents []*ExtentInfo, baseExtentID uint64) {
+	s.eiMutex.RLock()
+	defer s.eiMutex.RUnlock()
+	baseExtentID = atomic.LoadUint64(&s.baseExtentID)
+	extents = make([]*ExtentInfo, 0, len(s.extentInfoMap))
+	for _, ei := range s.extentInfoMap {
+		if ei.IsDeleted {
+			continue
+		}
+		extents = append(extents, &ExtentInfo{
+			FileID:     ei.FileID,
+			Size:       ei.Size,
+			Crc:        atomic.LoadUint32(&ei.Crc),
+			ModifyTime: ei.ModifyTime,
+			CreateTime: ei.CreateTime,
+			Inode:      ei.Inode,
+		})
+	}
+	return
+}
+
 // GetExtentCount returns the number of extents in the extentInfoMap
 func (s *ExtentStore) GetExtentCount() (count int) {
 	s.eiMutex.RLock()
@@ -752,9 +1009,16 @@ func (s *ExtentStore) GetExtentCount() (count int) {
 	return len(s.extentInfoMap)
 }
 
+// The path of the extent file by the layout of the store.
+func (s *ExtentStore) extentPath(extentID uint64) string {
+	return ExtentFilePath(s.dataPath, s.shards, extentID)
+}
+
 func (s *ExtentStore) loadExtentFromDisk(extentID uint64, putCache bool) (e *Extent, err error) {
-	name := path.Join(s.dataPath, strconv.Itoa(int(extentID)))
-	e = NewExtentInCore(name, extentID)
+	name := s.extentPath(extentID)
+	if e, err = s.newExtent(extentID); err != nil {
+		return
+	}
 	if err = e.RestoreFromFS(); err != nil {
 		err = fmt.Errorf("restore from file %v putCache %v system: %v", name, putCache, err)
 		return
@@ -777,7 +1041,9 @@ func (s *ExtentStore) loadExtentFromDisk(extentID uint64, putCache bool) (e *Ext
 func (s *ExtentStore) ScanBlocks(extentID uint64) (bcs []*BlockCrc, err error) {
 	var blockCnt int
 	bcs = make([]*BlockCrc, 0)
+	s.eiMutex.RLock()
 	ei := s.extentInfoMap[extentID]
+	s.eiMutex.RUnlock()
 	e, err := s.extentWithHeader(ei)
 	if err != nil {
 		return bcs, err
@@ -844,6 +1110,7 @@ func (s *ExtentStore) AutoComputeExtentCrc() {
 				continue
 			}
 			ei.UpdateExtentInfo(e, extentCrc)
+			s.changes.record(ei.FileID)
 		}
 		time.Sleep(time.Millisecond * 100)
 	}
@@ -867,14 +1134,47 @@ func (s *ExtentStore) TinyExtentRecover(extentID uint64, offset, size int64, dat
 		return nil
 	}
 
+	oldSize := ei.Size
 	if err = e.TinyExtentRecover(data, offset, size, crc, isEmptyPacket); err != nil {
 		return err
 	}
 	ei.UpdateExtentInfo(e, 0)
+	if !isEmptyPacket {
+		s.addUsedSize(int64(ei.Size) - int64(oldSize))
+	}
+	s.changes.record(extentID)
 
 	return nil
 }
 
+func (s *ExtentStore) addUsedSize(delta int64) {
+	if delta == 0 {
+		return
+	}
+	if atomic.AddInt64(&s.usedSize, delta) < 0 {
+		s.MarkUsageDirty()
+	}
+}
+
+// UsedSize returns the running total of the extent sizes, ok is false if the total has to be recomputed.
+func (s *ExtentStore) UsedSize() (used int64, ok bool) {
+	if atomic.LoadInt32(&s.usageDirty) == 1 {
+		return
+	}
+	return atomic.LoadInt64(&s.usedSize), true
+}
+
+// ResetUsedSize resets the running total with the size computed by walking the whole directory.
+func (s *ExtentStore) ResetUsedSize(used int64) {
+	atomic.StoreInt64(&s.usedSize, used)
+	atomic.StoreInt32(&s.usageDirty, 0)
+}
+
+// MarkUsageDirty forces the next usage computation to walk the whole directory.
+func (s *ExtentStore) MarkUsageDirty() {
+	atomic.StoreInt32(&s.usageDirty, 1)
+}
+
 func (s *ExtentStore) TinyExtentGetFinfoSize(extentID uint64) (size uint64, err error) {
 	var (
 		e *Extent
@@ -0,0 +1,115 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+// MaxTrackedExtentChanges is the number of the changed extents tracked by an extent store. The tracking
+// restarts once more extents changed, and the callers behind it have to take a full snapshot.
+const MaxTrackedExtentChanges = 4096
+
+// extentChanges tracks the changed extents by the change sequence, so that a snapshot taken at a sequence
+// can be brought up to date by the extents changed after it.
+type extentChanges struct {
+	sync.Mutex
+	seq     uint64
+	base    uint64            // the changes after the base sequence are tracked
+	changed map[uint64]uint64 // extent id to the sequence of its last change
+}
+
+func (c *extentChanges) record(extentID uint64) {
+	c.Lock()
+	defer c.Unlock()
+	c.seq++
+	if _, ok := c.changed[extentID]; !ok && len(c.changed) >= MaxTrackedExtentChanges {
+		c.changed = nil
+		c.base = c.seq - 1
+	}
+	if c.changed == nil {
+		c.changed = make(map[uint64]uint64)
+	}
+	c.changed[extentID] = c.seq
+}
+
+// ChangeSeq returns the current change sequence of the extents.
+func (s *ExtentStore) ChangeSeq() uint64 {
+	s.changes.Lock()
+	defer s.changes.Unlock()
+	return s.changes.seq
+}
+
+// ChangedExtentsSince returns the extents changed after the change sequence seq, and the current sequence.
+// ok is false if the changes after seq are no longer tracked.
+func (s *ExtentStore) ChangedExtentsSince(seq uint64) (extentIDs []uint64, current uint64, ok bool) {
+	c := &s.changes
+	c.Lock()
+	defer c.Unlock()
+	if current = c.seq; seq < c.base {
+		return
+	}
+	extentIDs = make([]uint64, 0)
+	for extentID, changeSeq := range c.changed {
+		if changeSeq > seq {
+			extentIDs = append(extentIDs, extentID)
+		}
+	}
+	return extentIDs, current, true
+}
+
+// ExtentSnapShot fills the snapshot of the extent in the same way as RangeSnapShot, and returns whether the
+// extent is in the snapshot. unsettled is true if the extent is left out only for being modified recently,
+// so it gets into the snapshot later without changing again.
+func (s *ExtentStore) ExtentSnapShot(extentID uint64, file *proto.File) (in, unsettled bool) {
+	s.eiMutex.RLock()
+	ei, ok := s.extentInfoMap[extentID]
+	s.eiMutex.RUnlock()
+	if !ok {
+		return
+	}
+	file.Name = strconv.FormatUint(ei.FileID, 10)
+	file.Size = uint32(ei.Size)
+	file.Modified = ei.ModifyTime
+	if IsTinyExtent(extentID) {
+		file.Crc = 0
+		return true, false
+	}
+	if NormalExtentFilter()(ei) {
+		file.Crc = atomic.LoadUint32(&ei.Crc)
+		return true, false
+	}
+	unsettled = !ei.IsDeleted && ei.Size > 0 && time.Now().Unix()-ei.ModifyTime <= RepairInterval
+	return
+}
+
+// UnsettledExtents returns the normal extents left out of the snapshot only for being modified recently.
+func (s *ExtentStore) UnsettledExtents() (extentIDs []uint64) {
+	now := time.Now().Unix()
+	extentIDs = make([]uint64, 0)
+	s.eiMutex.RLock()
+	defer s.eiMutex.RUnlock()
+	for extentID, ei := range s.extentInfoMap {
+		if !IsTinyExtent(extentID) && !ei.IsDeleted && ei.Size > 0 && now-ei.ModifyTime <= RepairInterval {
+			extentIDs = append(extentIDs, extentID)
+		}
+	}
+	return
+}
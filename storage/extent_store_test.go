@@ -0,0 +1,365 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/chubaofs/chubaofs/proto"
+)
+
+const benchmarkExtentCount = 100000
+
+func newBenchmarkExtentStore() *ExtentStore {
+	s := &ExtentStore{extentInfoMap: make(map[uint64]*ExtentInfo)}
+	for extentID := uint64(TinyExtentStartID); extentID < TinyExtentStartID+TinyExtentCount; extentID++ {
+		s.extentInfoMap[extentID] = &ExtentInfo{FileID: extentID, Size: 4096}
+	}
+	for extentID := uint64(MinExtentID); extentID < MinExtentID+benchmarkExtentCount; extentID++ {
+		s.extentInfoMap[extentID] = &ExtentInfo{FileID: extentID, Size: 4096}
+	}
+	return s
+}
+
+func TestRangeSnapShot(t *testing.T) {
+	s := newBenchmarkExtentStore()
+	files, err := s.SnapShot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != benchmarkExtentCount+TinyExtentCount {
+		t.Fatalf("expect %v files, actual %v", benchmarkExtentCount+TinyExtentCount, len(files))
+	}
+	var count int
+	s.RangeSnapShot(func(file *proto.File) bool {
+		count++
+		return count < 10
+	})
+	if count != 10 {
+		t.Fatalf("expect the range to stop after 10 files, actual %v", count)
+	}
+}
+
+func BenchmarkSnapShot(b *testing.B) {
+	s := newBenchmarkExtentStore()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		files, _ := s.SnapShot()
+		var size uint64
+		for _, file := range files {
+			size += uint64(file.Size)
+		}
+	}
+}
+
+func BenchmarkRangeSnapShot(b *testing.B) {
+	s := newBenchmarkExtentStore()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var size uint64
+		s.RangeSnapShot(func(file *proto.File) bool {
+			size += uint64(file.Size)
+			return true
+		})
+	}
+}
+
+func TestChangedExtentsSince(t *testing.T) {
+	s := newBenchmarkExtentStore()
+	seq := s.ChangeSeq()
+	s.changes.record(MinExtentID)
+	s.changes.record(MinExtentID + 1)
+	s.changes.record(MinExtentID)
+	changed, current, ok := s.ChangedExtentsSince(seq)
+	if !ok || current != seq+3 || len(changed) != 2 {
+		t.Fatalf("changed(%v) current(%v) ok(%v), expected 2 extents at %v", changed, current, ok, seq+3)
+	}
+	if changed, _, ok = s.ChangedExtentsSince(current); !ok || len(changed) != 0 {
+		t.Fatalf("changed(%v) ok(%v) since the current sequence", changed, ok)
+	}
+	for i := 0; i < MaxTrackedExtentChanges; i++ {
+		s.changes.record(MinExtentID + 2 + uint64(i))
+	}
+	if _, _, ok = s.ChangedExtentsSince(current); ok {
+		t.Fatalf("changes dropped by the restart of the tracking are reported")
+	}
+	last := s.ChangeSeq()
+	s.changes.record(MinExtentID)
+	if changed, _, ok = s.ChangedExtentsSince(last); !ok || len(changed) != 1 || changed[0] != MinExtentID {
+		t.Fatalf("changed(%v) ok(%v) after the restart of the tracking", changed, ok)
+	}
+}
+
+func TestExtentSnapShot(t *testing.T) {
+	s := newBenchmarkExtentStore()
+	now := time.Now().Unix()
+	s.extentInfoMap[MinExtentID].ModifyTime = now
+	s.extentInfoMap[MinExtentID+1].IsDeleted = true
+	var file proto.File
+	if in, unsettled := s.ExtentSnapShot(MinExtentID, &file); in || !unsettled {
+		t.Fatalf("extent modified recently in(%v) unsettled(%v)", in, unsettled)
+	}
+	if in, unsettled := s.ExtentSnapShot(MinExtentID+1, &file); in || unsettled {
+		t.Fatalf("extent deleted in(%v) unsettled(%v)", in, unsettled)
+	}
+	if in, _ := s.ExtentSnapShot(MinExtentID+2, &file); !in || file.Name != strconv.Itoa(MinExtentID+2) || file.Size != 4096 {
+		t.Fatalf("extent settled in(%v) file(%v)", in, file)
+	}
+	if in, _ := s.ExtentSnapShot(TinyExtentStartID, &file); !in || file.Crc != 0 {
+		t.Fatalf("tiny extent in(%v) file(%v)", in, file)
+	}
+	if unsettled := s.UnsettledExtents(); len(unsettled) != 1 || unsettled[0] != MinExtentID {
+		t.Fatalf("unsettled extents(%v), expected %v", unsettled, MinExtentID)
+	}
+}
+
+func TestFlushDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flush_delete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewExtentStore(dir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Create(MinExtentID+1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.MarkDelete(MinExtentID+1, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RecordTinyDelete(TinyExtentStartID, 0, 4096); err != nil {
+		t.Fatal(err)
+	}
+	if pending := s.PendingDeletes(); pending != 2 {
+		t.Fatalf("pending deletes(%v), expected 2", pending)
+	}
+	if err = s.FlushDelete(); err != nil {
+		t.Fatal(err)
+	}
+	if pending := s.PendingDeletes(); pending != 0 {
+		t.Fatalf("pending deletes(%v) after the flush", pending)
+	}
+	s.Close()
+	if err = s.FlushDelete(); err == nil {
+		t.Fatal("flush the deletes of a closed store")
+	}
+}
+
+func TestMigrateExtentLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewExtentStore(dir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("extent layout")
+	for extentID := uint64(MinExtentID + 1); extentID <= MinExtentID+6; extentID++ {
+		if err = s.Create(extentID, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Write(extentID, 0, int64(len(data)), data, crc32.ChecksumIEEE(data), AppendWriteType, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	if moved, err := MigrateExtentLayout(dir, 4); err != nil || moved != 6 {
+		t.Fatalf("migrate to 4 shards moved(%v) err(%v), expected 6", moved, err)
+	}
+	if shards, err := ReadExtentLayout(dir); err != nil || shards != 4 {
+		t.Fatalf("layout shards(%v) err(%v), expected 4", shards, err)
+	}
+	for extentID := uint64(MinExtentID + 1); extentID <= MinExtentID+6; extentID++ {
+		if _, err = os.Stat(ExtentFilePath(dir, 4, extentID)); err != nil {
+			t.Fatalf("extent(%v) not in its shard: %v", extentID, err)
+		}
+	}
+	if _, err = os.Stat(ExtentFilePath(dir, 4, TinyExtentStartID)); err != nil {
+		t.Fatalf("tiny extent moved out of the store directory: %v", err)
+	}
+
+	// an interrupted migration leaves an extent out of its shard, which the store moves on the open
+	if err = os.Rename(ExtentFilePath(dir, 4, MinExtentID+1), ExtentFilePath(dir, 0, MinExtentID+1)); err != nil {
+		t.Fatal(err)
+	}
+	// a copy left at both places is removed if the same, and renamed aside if it differs
+	sameCopy, err := ioutil.ReadFile(ExtentFilePath(dir, 4, MinExtentID+3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(ExtentFilePath(dir, 0, MinExtentID+3), sameCopy, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(ExtentFilePath(dir, 0, MinExtentID+4), []byte("other data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = NewExtentStore(dir, 1, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(ExtentFilePath(dir, 4, MinExtentID+1)); err != nil {
+		t.Fatalf("stray extent not moved into its shard: %v", err)
+	}
+	if _, err = os.Stat(ExtentFilePath(dir, 0, MinExtentID+3)); !os.IsNotExist(err) {
+		t.Fatalf("same copy of the extent left out of its shard: %v", err)
+	}
+	if otherCopy, err := ioutil.ReadFile(ExtentFilePath(dir, 0, MinExtentID+4) + MisplacedExtentSuffix); err != nil || string(otherCopy) != "other data" {
+		t.Fatalf("different copy of the extent not renamed aside: %v", err)
+	}
+	if _, err = s.Read(MinExtentID+4, 0, int64(len(data)), make([]byte, len(data)), false); err != nil {
+		t.Fatalf("read the extent kept in its shard: %v", err)
+	}
+	buf := make([]byte, len(data))
+	if _, err = s.Read(MinExtentID+1, 0, int64(len(data)), buf, false); err != nil || string(buf) != string(data) {
+		t.Fatalf("read the sharded extent data(%s) err(%v)", buf, err)
+	}
+	if err = s.Create(MinExtentID+7, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(ExtentFilePath(dir, 4, MinExtentID+7)); err != nil {
+		t.Fatalf("new extent not created in its shard: %v", err)
+	}
+	if err = s.MarkDelete(MinExtentID+2, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(ExtentFilePath(dir, 4, MinExtentID+2)); !os.IsNotExist(err) {
+		t.Fatalf("deleted extent left in its shard: %v", err)
+	}
+	if report, err := VerifyExtentStore(dir); err != nil || report.NormalExtentCount != 6 {
+		t.Fatalf("verify the sharded store report(%+v) err(%v), expected 6 normal extents", report, err)
+	}
+	s.Close()
+
+	if moved, err := MigrateExtentLayout(dir, 0); err != nil || moved != 6 {
+		t.Fatalf("migrate to flat moved(%v) err(%v), expected 6", moved, err)
+	}
+	if _, err = os.Stat(extentShardDir(dir, 0)); !os.IsNotExist(err) {
+		t.Fatalf("empty shard directory left after the migration to flat: %v", err)
+	}
+	if s, err = NewExtentStore(dir, 1, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if !s.HasExtent(MinExtentID+7) || s.HasExtent(MinExtentID+2) {
+		t.Fatal("extents of the flat store mismatch the sharded one")
+	}
+}
+
+func TestExtentInodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_inode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewExtentStore(dir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 4; i++ {
+		if err = s.Create(MinExtentID+i, 100+i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.Create(MinExtentID+5, 0); err != nil {
+		t.Fatal(err)
+	}
+	if ei, err := s.Watermark(MinExtentID + 1); err != nil || ei.Inode != 101 {
+		t.Fatalf("watermark(%v) err(%v), expected inode 101", ei, err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		if err = s.MarkDelete(MinExtentID+i, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	// the records of the 3 deleted extents outnumber the one left, and are dropped on the open
+	if s, err = NewExtentStore(dir, 1, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if ei, err := s.Watermark(MinExtentID + 4); err != nil || ei.Inode != 104 {
+		t.Fatalf("reopened watermark(%v) err(%v), expected inode 104", ei, err)
+	}
+	if ei, err := s.Watermark(MinExtentID + 5); err != nil || ei.Inode != 0 {
+		t.Fatalf("reopened watermark(%v) err(%v), expected no inode", ei, err)
+	}
+	info, err := os.Stat(path.Join(dir, ExtInodeFileName))
+	if err != nil || info.Size() != ExtentInodeRecordSize {
+		t.Fatalf("inode file(%v) err(%v), expected the record of 1 extent only", info, err)
+	}
+	if err = s.Create(MinExtentID+6, 106); err != nil {
+		t.Fatal(err)
+	}
+	if info, err = os.Stat(path.Join(dir, ExtInodeFileName)); err != nil || info.Size() != 2*ExtentInodeRecordSize {
+		t.Fatalf("inode file(%v) err(%v), expected the new record appended", info, err)
+	}
+	// the failed creations of an existing extent and of a file in the way leave no record
+	if err = s.Create(MinExtentID+6, 206); err != ExtentExistsError {
+		t.Fatalf("create the existing extent err(%v), expected %v", err, ExtentExistsError)
+	}
+	if err = ioutil.WriteFile(ExtentFilePath(dir, 0, MinExtentID+7), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Create(MinExtentID+7, 107); err == nil {
+		t.Fatal("create the extent over a file in the way succeeded")
+	}
+	if info, err = os.Stat(path.Join(dir, ExtInodeFileName)); err != nil || info.Size() != 2*ExtentInodeRecordSize {
+		t.Fatalf("inode file(%v) err(%v), expected no record of the failed creations", info, err)
+	}
+}
+
+func TestPeekBrokenTinyExtents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peek_broken_tiny")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewExtentStore(dir, 1, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	peeked := s.PeekBrokenTinyExtents(3)
+	if len(peeked) != 3 || peeked[0] != TinyExtentStartID || s.BrokenTinyExtentCnt() != TinyExtentCount {
+		t.Fatalf("peeked(%v) broken count(%v), expected the first 3 left in the channel", peeked, s.BrokenTinyExtentCnt())
+	}
+	extentID, err := s.GetBrokenTinyExtent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peeked = s.PeekBrokenTinyExtents(TinyExtentCount); len(peeked) != TinyExtentCount-1 {
+		t.Fatalf("peeked(%v) extents, expected the taken extent(%v) not peeked", len(peeked), extentID)
+	}
+	if taken := s.TakeTinyExtents([]uint64{TinyExtentStartID + 1}); len(taken) != 1 {
+		t.Fatalf("taken(%v), expected the broken extent", taken)
+	}
+	s.SendToBrokenTinyExtentC(extentID)
+	if peeked = s.PeekBrokenTinyExtents(TinyExtentCount); len(peeked) != TinyExtentCount-1 {
+		t.Fatalf("peeked(%v) extents, expected only the extent taken by TakeTinyExtents not peeked", len(peeked))
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPunchZeroPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "punch_zero_pages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	e := NewExtentInCore(path.Join(dir, "1"), 1)
+	if err = e.InitToFS(); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	data := make([]byte, 4*PageSize)
+	copy(data[PageSize:], bytes.Repeat([]byte{1}, PageSize))
+	copy(data[3*PageSize:], bytes.Repeat([]byte{2}, 10))
+	if _, err = e.file.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.file.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.punchZeroPages(0, int64(len(data))); err != nil {
+		t.Skipf("punch hole is not supported: %v", err)
+	}
+	read := make([]byte, len(data))
+	if _, err = e.file.ReadAt(read, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Fatalf("the data changes after punching the zero pages")
+	}
+	stat := new(syscall.Stat_t)
+	if err = syscall.Stat(path.Join(dir, "1"), stat); err != nil {
+		t.Fatal(err)
+	}
+	if allocated := stat.Blocks * 512; allocated > 2*PageSize {
+		t.Fatalf("expect at most 2 pages allocated, actual %v bytes", allocated)
+	}
+}
+
+func TestExtentCreateTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extent_create_time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := path.Join(dir, "1025")
+	e := NewExtentInCore(name, 1025)
+	if err = e.InitToFS(); err != nil {
+		t.Fatal(err)
+	}
+	created := e.CreateTime()
+	e.Close()
+	if created == 0 {
+		t.Fatalf("no create time of the extent initialized")
+	}
+	// the modification time is later than the creation, the restored creation time is never later than it
+	modified := time.Unix(created+3600, 0)
+	if err = os.Chtimes(name, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	e = NewExtentInCore(name, 1025)
+	if err = e.RestoreFromFS(); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if restored := e.CreateTime(); restored == 0 || restored > modified.Unix() {
+		t.Fatalf("restored create time(%v), modified at %v", restored, modified.Unix())
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/chubaofs/chubaofs/util"
+)
+
+// The kinds of the anomalies found by VerifyExtentStore.
+const (
+	AnomalyUnexpectedExtentID   = "unexpected extent id"
+	AnomalyOversizedExtent      = "oversized extent"
+	AnomalyBlockCrcMismatch     = "block crc mismatch"
+	AnomalyMissingTinyExtent    = "missing tiny extent"
+	AnomalyDeletedExtentPresent = "deleted extent present"
+	AnomalyBadTinyDeleteRecord  = "bad tiny delete record"
+	AnomalyUnreadableFile       = "unreadable file"
+)
+
+// ExtentAnomaly describes an integrity problem of the extent store.
+type ExtentAnomaly struct {
+	ExtentID uint64 `json:"extentID"`
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail"`
+}
+
+// StoreVerifyReport is the result of VerifyExtentStore.
+type StoreVerifyReport struct {
+	NormalExtentCount int              `json:"normalExtentCount"`
+	TinyExtentCount   int              `json:"tinyExtentCount"`
+	VerifiedBlocks    int              `json:"verifiedBlocks"`
+	Encrypted         bool             `json:"encrypted"` // the block crcs are of the plaintext, and left unverified
+	Anomalies         []*ExtentAnomaly `json:"anomalies"`
+}
+
+func (r *StoreVerifyReport) addAnomaly(extentID uint64, kind string, format string, args ...interface{}) {
+	r.Anomalies = append(r.Anomalies, &ExtentAnomaly{ExtentID: extentID, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+}
+
+// VerifyExtentStore checks the extents under the given directory against the metadata files of the extent store.
+// Unlike NewExtentStore, it opens every file read-only and never creates, truncates or punches anything,
+// so it is safe to run against a disk pulled from another node.
+// The sizes of the extents, the persisted block crcs of the normal extents and the delete records
+// of the tiny extents are checked. The block crcs of an encrypted store are skipped without the key.
+func VerifyExtentStore(dataDir string) (report *StoreVerifyReport, err error) {
+	var (
+		fileInfos []os.FileInfo
+		fileDirs  []string
+	)
+	err = WalkExtentDir(dataDir, func(dir string, info os.FileInfo) {
+		fileInfos, fileDirs = append(fileInfos, info), append(fileDirs, dir)
+	})
+	if err != nil {
+		return
+	}
+	report = &StoreVerifyReport{Anomalies: make([]*ExtentAnomaly, 0)}
+	if report.Encrypted, err = IsEncryptedExtentStore(dataDir); err != nil {
+		report.addAnomaly(0, AnomalyUnreadableFile, "stat %v: %v", ExtentCipherFileName, err)
+		err = nil
+	}
+	deleted := readDeletedNormalExtents(dataDir, report)
+	var crcFp *os.File
+	if crcFp, err = os.Open(path.Join(dataDir, ExtCrcHeaderFileName)); err != nil {
+		report.addAnomaly(0, AnomalyUnreadableFile, "open %v: %v", ExtCrcHeaderFileName, err)
+		err = nil
+	} else {
+		defer crcFp.Close()
+	}
+	tinySizes := make(map[uint64]int64, TinyExtentCount)
+	for i, info := range fileInfos {
+		if !RegexpExtentFile.MatchString(info.Name()) {
+			continue
+		}
+		extentID, parseErr := strconv.ParseUint(info.Name(), 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		switch {
+		case IsTinyExtent(extentID):
+			report.TinyExtentCount++
+			tinySizes[extentID] = info.Size()
+		case extentID < MinExtentID:
+			report.addAnomaly(extentID, AnomalyUnexpectedExtentID, "extent id is in neither the tiny nor the normal range")
+		default:
+			report.NormalExtentCount++
+			if deleted[extentID] {
+				report.addAnomaly(extentID, AnomalyDeletedExtentPresent, "extent is recorded in %v", NormalExtDeletedFileName)
+			}
+			if info.Size() > util.ExtentSize {
+				report.addAnomaly(extentID, AnomalyOversizedExtent, "size(%v) exceeds the extent size(%v)", info.Size(), util.ExtentSize)
+				continue
+			}
+			if crcFp != nil && !report.Encrypted {
+				verifyBlockCrcs(fileDirs[i], crcFp, extentID, info.Size(), report)
+			}
+		}
+	}
+	for extentID := uint64(TinyExtentStartID); extentID < TinyExtentStartID+TinyExtentCount; extentID++ {
+		if _, ok := tinySizes[extentID]; !ok {
+			report.addAnomaly(extentID, AnomalyMissingTinyExtent, "tiny extent file does not exist")
+		}
+	}
+	verifyTinyDeleteRecords(dataDir, tinySizes, report)
+	return
+}
+
+func readDeletedNormalExtents(dataDir string, report *StoreVerifyReport) (deleted map[uint64]bool) {
+	deleted = make(map[uint64]bool)
+	data, err := ioutil.ReadFile(path.Join(dataDir, NormalExtDeletedFileName))
+	if err != nil {
+		report.addAnomaly(0, AnomalyUnreadableFile, "read %v: %v", NormalExtDeletedFileName, err)
+		return
+	}
+	for offset := 0; offset+8 <= len(data); offset += 8 {
+		deleted[binary.BigEndian.Uint64(data[offset:offset+8])] = true
+	}
+	return
+}
+
+// Compare the crc of every block of the normal extent with the one persisted in the crc file.
+// The blocks whose crc is not computed yet are skipped.
+func verifyBlockCrcs(extentDir string, crcFp *os.File, extentID uint64, size int64, report *StoreVerifyReport) {
+	header := make([]byte, util.BlockHeaderSize)
+	if _, err := crcFp.ReadAt(header, int64(extentID*util.BlockHeaderSize)); err != nil && err != io.EOF {
+		report.addAnomaly(extentID, AnomalyUnreadableFile, "read block crcs: %v", err)
+		return
+	}
+	file, err := os.Open(path.Join(extentDir, strconv.FormatUint(extentID, 10)))
+	if err != nil {
+		report.addAnomaly(extentID, AnomalyUnreadableFile, "open extent: %v", err)
+		return
+	}
+	defer file.Close()
+	data := make([]byte, util.BlockSize)
+	for blockNo := 0; int64(blockNo)*util.BlockSize < size; blockNo++ {
+		expected := binary.BigEndian.Uint32(header[blockNo*util.PerBlockCrcSize : (blockNo+1)*util.PerBlockCrcSize])
+		if expected == 0 {
+			continue
+		}
+		readN, err := file.ReadAt(data, int64(blockNo)*util.BlockSize)
+		if readN == 0 && err != nil {
+			report.addAnomaly(extentID, AnomalyUnreadableFile, "read block(%v): %v", blockNo, err)
+			return
+		}
+		report.VerifiedBlocks++
+		if actual := crc32.ChecksumIEEE(data[:readN]); actual != expected {
+			report.addAnomaly(extentID, AnomalyBlockCrcMismatch, "block(%v) crc(%v) persisted crc(%v)", blockNo, actual, expected)
+		}
+	}
+}
+
+// Every delete record of the tiny extents must be page aligned and fall into the written range of the extent.
+func verifyTinyDeleteRecords(dataDir string, tinySizes map[uint64]int64, report *StoreVerifyReport) {
+	data, err := ioutil.ReadFile(path.Join(dataDir, TinyExtDeletedFileName))
+	if err != nil {
+		report.addAnomaly(0, AnomalyUnreadableFile, "read %v: %v", TinyExtDeletedFileName, err)
+		return
+	}
+	if len(data)%DeleteTinyRecordSize != 0 {
+		report.addAnomaly(0, AnomalyBadTinyDeleteRecord, "size(%v) of %v is not a multiple of the record size(%v)",
+			len(data), TinyExtDeletedFileName, DeleteTinyRecordSize)
+	}
+	for offset := 0; offset+DeleteTinyRecordSize <= len(data); offset += DeleteTinyRecordSize {
+		extentID, deleteOffset, deleteSize := UnMarshalTinyExtent(data[offset : offset+DeleteTinyRecordSize])
+		size, ok := tinySizes[extentID]
+		watermark := (size + PageSize - 1) / PageSize * PageSize
+		switch {
+		case !IsTinyExtent(extentID):
+			report.addAnomaly(extentID, AnomalyBadTinyDeleteRecord, "record at %v is not of a tiny extent", offset)
+		case deleteOffset%PageSize != 0:
+			report.addAnomaly(extentID, AnomalyBadTinyDeleteRecord, "record at %v offset(%v) is not page aligned", offset, deleteOffset)
+		case ok && int64(deleteOffset+deleteSize) > watermark:
+			report.addAnomaly(extentID, AnomalyBadTinyDeleteRecord, "record at %v [%v, %v) exceeds the extent size(%v)",
+				offset, deleteOffset, deleteOffset+deleteSize, size)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The Chubao Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/chubaofs/chubaofs/util"
+)
+
+func writeTestStore(t *testing.T, dir string, extentData []byte) {
+	files := map[string][]byte{
+		NormalExtDeletedFileName: nil,
+		TinyExtDeletedFileName:   MarshalTinyExtent(TinyExtentStartID, 0, PageSize),
+		"1024":                   extentData,
+	}
+	header := make([]byte, util.BlockHeaderSize*1025)
+	binary.BigEndian.PutUint32(header[util.BlockHeaderSize*1024:], crc32.ChecksumIEEE(extentData))
+	files[ExtCrcHeaderFileName] = header
+	for extentID := uint64(TinyExtentStartID); extentID < TinyExtentStartID+TinyExtentCount; extentID++ {
+		files[strconv.FormatUint(extentID, 10)] = make([]byte, PageSize)
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(path.Join(dir, name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyExtentStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify_extent_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	extentData := make([]byte, util.BlockSize)
+	for i := range extentData {
+		extentData[i] = byte(i)
+	}
+	writeTestStore(t, dir, extentData)
+
+	report, err := VerifyExtentStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Anomalies) != 0 || report.NormalExtentCount != 1 || report.TinyExtentCount != TinyExtentCount || report.VerifiedBlocks != 1 {
+		t.Fatalf("unexpected report of a healthy store: %+v anomalies(%v)", report, report.Anomalies)
+	}
+
+	extentData[100]++
+	if err = ioutil.WriteFile(path.Join(dir, "1024"), extentData, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(path.Join(dir, "2")); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = VerifyExtentStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string]uint64)
+	for _, anomaly := range report.Anomalies {
+		kinds[anomaly.Kind] = anomaly.ExtentID
+	}
+	if len(report.Anomalies) != 2 || kinds[AnomalyBlockCrcMismatch] != 1024 || kinds[AnomalyMissingTinyExtent] != 2 {
+		t.Fatalf("unexpected anomalies of a broken store: %v", kinds)
+	}
+}
@@ -115,5 +115,6 @@ func (s *ExtentStore) PersistenceHasDeleteExtent(extentID uint64) (err error) {
 	if _, err = s.normalExtentDeleteFp.Write(data); err != nil {
 		return
 	}
+	atomic.AddInt64(&s.pendingDeletes, 1)
 	return
 }
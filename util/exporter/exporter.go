@@ -109,6 +109,22 @@ func InitWithRouter(role string, cfg *config.Config, router *mux.Router, exPort
 	log.LogInfof("exporter Start: %v %v", exporterPort, m)
 }
 
+// NewDesc creates the descriptor of a metric named in the namespace of the module, to be collected by
+// a collector registered with RegisterCollector.
+func NewDesc(name, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(metricsName(name), help, labels, nil)
+}
+
+// RegisterCollector registers the collector to be gathered by the prometheus handler, if the exporter is enabled.
+func RegisterCollector(collector prometheus.Collector) {
+	if !enabledPrometheus {
+		return
+	}
+	if err := prometheus.Register(collector); err != nil {
+		log.LogErrorf("exporter register collector error: %v", err)
+	}
+}
+
 func RegistConsul(cluster string, role string, cfg *config.Config) {
 	clustername = replacer.Replace(cluster)
 	consulAddr := cfg.GetString(ConfigKeyConsulAddr)